@@ -1,24 +1,42 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/cobra/doc"
 
 	"github.com/amarbel-llc/go-lib-mcp/purse"
 	"github.com/amarbel-llc/go-lib-mcp/transport"
+	"github.com/amarbel-llc/lux/internal/buildinfo"
 	"github.com/amarbel-llc/lux/internal/capabilities"
-	"github.com/amarbel-llc/lux/internal/config"
-	"github.com/amarbel-llc/lux/internal/control"
+	"github.com/amarbel-llc/lux/internal/check"
+	"github.com/amarbel-llc/lux/internal/dap"
 	"github.com/amarbel-llc/lux/internal/formatter"
+	"github.com/amarbel-llc/lux/internal/lsp"
 	"github.com/amarbel-llc/lux/internal/mcp"
+	"github.com/amarbel-llc/lux/internal/report"
 	"github.com/amarbel-llc/lux/internal/server"
+	"github.com/amarbel-llc/lux/internal/stats"
 	"github.com/amarbel-llc/lux/internal/subprocess"
 	luxtransport "github.com/amarbel-llc/lux/internal/transport"
+	luxclient "github.com/amarbel-llc/lux/pkg/client"
+	"github.com/amarbel-llc/lux/pkg/config"
+
+	// Traffic filter plugin runtimes.
+	_ "github.com/amarbel-llc/lux/pkg/plugin/wasm"
 )
 
 var rootCmd = &cobra.Command{
@@ -37,15 +55,92 @@ var serveCmd = &cobra.Command{
 			return fmt.Errorf("loading config: %w", err)
 		}
 
+		if serveDryRun {
+			if serveMCPSSEAddr != "" || serveMCPHTTPAddr != "" {
+				return fmt.Errorf("--dry-run cannot be combined with --mcp-sse or --mcp-http")
+			}
+			srv, err := server.NewDryRun(cfg, os.Stderr)
+			if err != nil {
+				return fmt.Errorf("creating server: %w", err)
+			}
+			return srv.Run(cmd.Context())
+		}
+
 		srv, err := server.New(cfg)
 		if err != nil {
 			return fmt.Errorf("creating server: %w", err)
 		}
+		srv.SetPrewarmAll(servePrewarm)
+
+		if serveMCPSSEAddr != "" {
+			t := luxtransport.NewSSE(serveMCPSSEAddr)
+			mcpSrv, err := mcp.NewShared(cfg, t, srv)
+			if err != nil {
+				return fmt.Errorf("creating MCP server: %w", err)
+			}
+			t.SetDocumentLifecycle(mcpSrv.DocumentManager())
+			srv.AddListener("mcp-sse", mcpListener(mcpSrv, t, serveMCPSSEAddr))
+		}
+
+		if serveMCPHTTPAddr != "" {
+			t := luxtransport.NewStreamableHTTP(serveMCPHTTPAddr)
+			mcpSrv, err := mcp.NewShared(cfg, t, srv)
+			if err != nil {
+				return fmt.Errorf("creating MCP server: %w", err)
+			}
+			srv.AddListener("mcp-http", mcpListener(mcpSrv, t, serveMCPHTTPAddr))
+		}
 
 		return srv.Run(cmd.Context())
 	},
 }
 
+var dapCmd = &cobra.Command{
+	Use:   "dap",
+	Short: "Start a debug adapter session",
+	Long: `Act as a debug adapter on stdin and stdout. The adapterID of the client's
+initialize request selects a [[dap]] entry from the config (by name or
+adapter_ids), which is started and routed to until the session ends.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.LoadWithProject(config.ResolveWorkspace(cwd))
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		proxy := dap.New(cfg, subprocess.NewExecutor(cfg.ExecutorKind(), config.StateDir()))
+		return proxy.Run(cmd.Context(), os.Stdin, os.Stdout)
+	},
+}
+
+var serveDryRun bool
+var servePrewarm bool
+var serveMCPSSEAddr string
+var serveMCPHTTPAddr string
+
+type httpTransport interface {
+	Start(ctx context.Context) error
+}
+
+// mcpListener runs an MCP server and its HTTP transport as a listener hosted
+// by the LSP server, so both share one pool of warmed backends.
+func mcpListener(srv *mcp.Server, t httpTransport, addr string) server.Listener {
+	return server.ListenerFunc(func(ctx context.Context) error {
+		go func() {
+			if err := t.Start(ctx); err != nil && err != http.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "MCP server error on %s: %v\n", addr, err)
+			}
+		}()
+
+		fmt.Fprintf(os.Stderr, "MCP server listening on %s\n", addr)
+		return srv.Run(ctx)
+	})
+}
+
 var addBinary string
 var addConfigPath string
 
@@ -60,6 +155,112 @@ var addCmd = &cobra.Command{
 	},
 }
 
+var (
+	initForce      bool
+	initStdout     bool
+	initConfigPath string
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init [workspace]",
+	Short: "Write a starter config for the languages in a workspace",
+	Long: `Count the source files in a workspace (the current directory by default),
+propose a server from the built-in registry for each language found, and write
+a commented starter config.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := "."
+		if len(args) == 1 {
+			root = args[0]
+		}
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+
+		data, err := config.StarterConfig(root)
+		if err != nil {
+			return err
+		}
+		if initStdout {
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+
+		configPath := initConfigPath
+		if configPath == "" {
+			configPath = config.ConfigPath()
+		}
+		if _, err := os.Stat(configPath); err == nil && !initForce {
+			return fmt.Errorf("%s already exists (use --force to overwrite, or --stdout to print)", configPath)
+		}
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			return fmt.Errorf("creating config directory: %w", err)
+		}
+		if err := os.WriteFile(configPath, data, 0644); err != nil {
+			return fmt.Errorf("writing config: %w", err)
+		}
+		fmt.Printf("Wrote %s\n", configPath)
+		return nil
+	},
+}
+
+var (
+	probeWrite       bool
+	probeName        string
+	probeFlake       string
+	probeExtensions  []string
+	probeLanguageIDs []string
+	probeConfigPath  string
+)
+
+var probeCmd = &cobra.Command{
+	Use:   "probe -- <command> [args...]",
+	Short: "Print the capabilities of an arbitrary LSP command",
+	Long: `Start any LSP server command, run the initialize handshake, and print its
+serverInfo and capabilities. Use this to evaluate a server before adding it
+with a flake reference; --write adds it to the config as a binary.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := capabilities.Probe(cmd.Context(), args)
+		if err != nil {
+			return err
+		}
+
+		out, err := json.MarshalIndent(struct {
+			ServerInfo   *lsp.ServerInfo        `json:"serverInfo,omitempty"`
+			Capabilities lsp.ServerCapabilities `json:"capabilities"`
+		}{result.ServerInfo, result.Capabilities}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+
+		if !probeWrite {
+			return nil
+		}
+
+		entry := capabilities.ProbedLSP(args, result)
+		if probeName != "" {
+			entry.Name = probeName
+		}
+		entry.Flake = probeFlake
+		entry.Extensions = append(entry.Extensions, probeExtensions...)
+		entry.LanguageIDs = append(entry.LanguageIDs, probeLanguageIDs...)
+
+		configPath := probeConfigPath
+		if configPath == "" {
+			configPath = config.ConfigPath()
+		}
+		if err := capabilities.AddProbed(configPath, entry); err != nil {
+			return fmt.Errorf("not adding %s to the config: %w", entry.Name, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "\nAdded LSP %s to %s\n", entry.Name, configPath)
+		return nil
+	},
+}
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List configured LSPs",
@@ -80,6 +281,9 @@ var listCmd = &cobra.Command{
 			if lsp.Binary != "" {
 				fmt.Printf("  binary:     %s\n", lsp.Binary)
 			}
+			if lsp.Command != "" {
+				fmt.Printf("  command:    %s\n", lsp.Command)
+			}
 			if len(lsp.Extensions) > 0 {
 				fmt.Printf("  extensions: %v\n", lsp.Extensions)
 			}
@@ -94,6 +298,94 @@ var listCmd = &cobra.Command{
 	},
 }
 
+var buildJobs int
+
+var buildCmd = &cobra.Command{
+	Use:   "build [name...]",
+	Short: "Build configured LSPs ahead of use",
+	Long: `Run the executor's build step (nix build, for the nix executor) for every
+configured LSP, or only those named, so the first request from an editor
+doesn't wait on it. Useful in CI or after changing the config. LSPs that lux
+attaches to or runs remotely are skipped.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		cfg, err := config.LoadWithProject(config.ResolveWorkspace(cwd))
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		var lsps []config.LSP
+		for _, name := range args {
+			if cfg.FindLSP(name) == nil {
+				return fmt.Errorf("unknown LSP: %s", name)
+			}
+		}
+		for _, l := range cfg.LSPs {
+			if len(args) > 0 && !slices.Contains(args, l.Name) {
+				continue
+			}
+			if l.Attaches() || l.Remote != "" {
+				continue
+			}
+			lsps = append(lsps, l)
+		}
+
+		jobs := buildJobs
+		if jobs < 1 {
+			jobs = 1
+		}
+		pool := subprocess.NewPool(subprocess.NewExecutor(cfg.ExecutorKind(), config.StateDir()), nil)
+		for _, l := range lsps {
+			r, err := server.NewRegistration(l)
+			if err == nil {
+				err = pool.Register(l.Name, r)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", l.Name, err)
+			}
+		}
+		var (
+			mu     sync.Mutex
+			failed int
+			wg     sync.WaitGroup
+			sem    = make(chan struct{}, jobs)
+		)
+		for _, l := range lsps {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(l config.LSP) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				path, err := pool.Prebuild(cmd.Context(), l.Name)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					failed++
+					fmt.Fprintf(os.Stderr, "%s: %v\n", l.Name, err)
+					return
+				}
+				fmt.Printf("%-20s %s\n", l.Name, path)
+			}(l)
+		}
+		wg.Wait()
+
+		if failed > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d of %d builds failed", failed, len(lsps))
+		}
+		return nil
+	},
+}
+
+var (
+	statusSort   string
+	statusStates []string
+)
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show status of running LSPs",
@@ -104,13 +396,13 @@ var statusCmd = &cobra.Command{
 			return fmt.Errorf("loading config: %w", err)
 		}
 
-		client, err := control.NewClient(cfg.SocketPath())
+		client, err := luxclient.NewClient(controlSocketPath(cfg))
 		if err != nil {
 			return fmt.Errorf("connecting to server: %w", err)
 		}
 		defer client.Close()
 
-		return client.Status(os.Stdout)
+		return client.Status(os.Stdout, luxclient.StatusOptions{SortBy: statusSort, States: statusStates})
 	},
 }
 
@@ -125,7 +417,7 @@ var startCmd = &cobra.Command{
 			return fmt.Errorf("loading config: %w", err)
 		}
 
-		client, err := control.NewClient(cfg.SocketPath())
+		client, err := luxclient.NewClient(controlSocketPath(cfg))
 		if err != nil {
 			return fmt.Errorf("connecting to server: %w", err)
 		}
@@ -146,7 +438,7 @@ var stopCmd = &cobra.Command{
 			return fmt.Errorf("loading config: %w", err)
 		}
 
-		client, err := control.NewClient(cfg.SocketPath())
+		client, err := luxclient.NewClient(controlSocketPath(cfg))
 		if err != nil {
 			return fmt.Errorf("connecting to server: %w", err)
 		}
@@ -156,6 +448,228 @@ var stopCmd = &cobra.Command{
 	},
 }
 
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload configuration in a running server",
+	Long:  `Ask a running Lux server to re-read its configuration and apply any changes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		client, err := luxclient.NewClient(controlSocketPath(cfg))
+		if err != nil {
+			return fmt.Errorf("connecting to server: %w", err)
+		}
+		defer client.Close()
+
+		return client.Reload(os.Stdout)
+	},
+}
+
+var stateOutput string
+var stateText bool
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Export or import a server's routing state",
+	Long: `Dump a running server's routing state (open documents and the servers
+they route to, workspace folders, backend capabilities, and command owners) as
+JSON, or load a dump into another server to reproduce its routing.`,
+}
+
+var stateDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Write a running server's routing state as JSON",
+	Long: `Write a running server's routing state as JSON, to attach to a bug
+report. Open documents are listed by URI, version, and length; --text also
+includes their text.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		client, err := luxclient.NewClient(controlSocketPath(cfg))
+		if err != nil {
+			return fmt.Errorf("connecting to server: %w", err)
+		}
+		defer client.Close()
+
+		if stateOutput == "" {
+			return client.State(os.Stdout, stateText)
+		}
+		f, err := os.Create(stateOutput)
+		if err != nil {
+			return err
+		}
+		if err := client.State(f, stateText); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	},
+}
+
+var stateLoadCmd = &cobra.Command{
+	Use:   "load <file>",
+	Short: "Load a routing state dump into a running server",
+	Long: `Open the documents in a state dump in a running server, typically a test
+instance, as if its client had, and take over the dump's workspace folders and
+command owners. Documents dumped without --text are opened empty. Documents that
+route differently than they did in the dumped server are listed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		state, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		client, err := luxclient.NewClient(controlSocketPath(cfg))
+		if err != nil {
+			return fmt.Errorf("connecting to server: %w", err)
+		}
+		defer client.Close()
+
+		return client.LoadState(state, os.Stdout)
+	},
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Inspect local usage statistics",
+	Long: `Inspect the local record of which LSP servers and methods lux forwards
+requests to. Recording is opt-in (usage_stats = true in the config) and the
+data never leaves this machine.`,
+}
+
+var statsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export usage statistics as JSON",
+	Long:  `Print a JSON summary of recorded usage per server and method, including configured servers that were never used.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		if !cfg.UsageStats {
+			fmt.Fprintln(os.Stderr, "note: usage_stats is not enabled in the config; nothing new is being recorded")
+		}
+
+		usage, err := stats.Load(stats.DefaultPath())
+		if err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(stats.Export(usage, cfg), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	},
+}
+
+var (
+	reportOutput string
+	reportYes    bool
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Bundle config and server state for a bug report",
+	Long: `Collect version information, the effective config, cached server
+capabilities, and the status and state dump of the running server into a
+tarball for attaching to a bug report. Environment and argument values and
+secret-looking settings are redacted, along with those values wherever they
+appear in the status and dump, and so is the home directory; the files and
+redactions are listed for confirmation before anything is written.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		workspace := controlWorkspace
+		if workspace == "" {
+			workspace = "."
+		}
+		opts := report.Options{
+			Build:     buildinfo.Get(),
+			Workspace: config.ResolveWorkspace(workspace),
+		}
+		socket := controlSocketPath(cfg)
+		if _, err := os.Stat(socket); err == nil {
+			opts.Status = func(w io.Writer) error {
+				client, err := luxclient.NewClient(socket)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+				return client.Status(w, luxclient.StatusOptions{})
+			}
+			opts.Dump = func(w io.Writer) error {
+				client, err := luxclient.NewClient(socket)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+				return client.Dump(w)
+			}
+		}
+
+		bundle, err := report.Collect(opts)
+		if err != nil {
+			return err
+		}
+
+		output := reportOutput
+		if output == "" {
+			output = fmt.Sprintf("lux-report-%s.tar.gz", time.Now().Format("20060102-150405"))
+		}
+
+		fmt.Fprint(os.Stderr, bundle.Summary())
+		if !reportYes {
+			fmt.Fprintf(os.Stderr, "Write %s? [y/N] ", output)
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer != "y" && answer != "yes" {
+				return fmt.Errorf("aborted")
+			}
+		}
+
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("creating report: %w", err)
+		}
+		defer f.Close()
+		if err := bundle.WriteTarGz(f, strings.TrimSuffix(filepath.Base(output), ".tar.gz")); err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+		fmt.Printf("Wrote %s\n", output)
+		return nil
+	},
+}
+
+var controlWorkspace string
+
+// controlSocketPath resolves the socket of the server for --workspace, or for
+// the workspace containing the current directory.
+func controlSocketPath(cfg *config.Config) string {
+	if controlWorkspace == "" {
+		return cfg.SocketPath()
+	}
+	return cfg.SocketPathFor(config.ResolveWorkspace(controlWorkspace))
+}
+
 var mcpCmd = &cobra.Command{
 	Use:   "mcp",
 	Short: "Run as MCP server",
@@ -318,7 +832,12 @@ var formatCmd = &cobra.Command{
 			return fmt.Errorf("reading file: %w", err)
 		}
 
-		executor := subprocess.NewNixExecutor()
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		executor := subprocess.NewExecutor(cfg.ExecutorKind(), config.StateDir())
 		result, err := formatter.Format(cmd.Context(), f, filePath, content, executor)
 		if err != nil {
 			return err
@@ -341,7 +860,193 @@ var formatCmd = &cobra.Command{
 	},
 }
 
-var version = "dev"
+var applyEditCmd = &cobra.Command{
+	Use:   "apply-edit [file]",
+	Short: "Apply an LSP WorkspaceEdit to files on disk",
+	Long: `Apply an LSP WorkspaceEdit, read as JSON from file or stdin, to the files it
+changes. If a lux server is running for the workspace, the edit is refused
+without writing anything when a document it changes is open in the editor at
+another version than the edit was computed against, or has unsaved changes.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var data []byte
+		var err error
+		if len(args) == 1 {
+			data, err = os.ReadFile(args[0])
+		} else {
+			data, err = io.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			return err
+		}
+		var edit mcp.WorkspaceEdit
+		if err := json.Unmarshal(data, &edit); err != nil {
+			return fmt.Errorf("parsing workspace edit: %w", err)
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		docs := mcp.OpenDocuments{}
+		if client, err := luxclient.NewClient(controlSocketPath(cfg)); err == nil {
+			open, err := client.Documents()
+			client.Close()
+			if err != nil {
+				return fmt.Errorf("reading open documents: %w", err)
+			}
+			for _, doc := range open {
+				docs[lsp.DocumentURI(doc.URI)] = mcp.OpenDocument{Version: doc.Version, Text: doc.Text}
+			}
+		}
+
+		applied, err := mcp.ApplyWorkspaceEdit(edit, docs)
+		for _, uri := range applied {
+			fmt.Println(uri.Path())
+		}
+		return err
+	},
+}
+
+var (
+	checkTimeout time.Duration
+	checkSettle  time.Duration
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check <file>...",
+	Short: "Print diagnostics for files, compiler-style",
+	Long: `Open each file against its configured LSP, wait for diagnostics, and print
+them with the offending source line and carets under the range. Exits non-zero
+if any file has errors, so it can be used as a lint command in git hooks.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		root := config.ResolveWorkspace(cwd)
+
+		cfg, err := config.LoadWithProject(root)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		checker, err := check.New(cfg, root)
+		if err != nil {
+			return err
+		}
+		defer checker.Close()
+		checker.Timeout = checkTimeout
+		checker.Settle = checkSettle
+
+		var total check.Counts
+		for _, path := range args {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			diagnostics, err := checker.Check(cmd.Context(), path)
+			if err != nil {
+				return err
+			}
+
+			counts := check.Render(os.Stdout, path, content, diagnostics)
+			total.Errors += counts.Errors
+			total.Warnings += counts.Warnings
+			total.Other += counts.Other
+		}
+
+		if total.Errors+total.Warnings > 0 {
+			fmt.Fprintln(os.Stderr, total)
+		}
+		if total.Errors > 0 {
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return fmt.Errorf("%s", total)
+		}
+		return nil
+	},
+}
+
+var doctorWorkspace bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [dir]",
+	Short: "Check configuration and report coverage gaps",
+	Long: `Validate the Lux configuration. With --workspace, also scan a workspace
+(default: the current directory) for source files that no configured LSP
+handles and suggest servers from the built-in registry.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("resolving path: %w", err)
+		}
+
+		cfg, err := config.LoadWithProject(dir)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		fmt.Printf("config ok: %d LSP(s) configured\n", len(cfg.LSPs))
+
+		if !doctorWorkspace {
+			return nil
+		}
+
+		gaps, err := config.ScanWorkspace(dir, cfg)
+		if err != nil {
+			return fmt.Errorf("scanning workspace: %w", err)
+		}
+
+		if len(gaps) == 0 {
+			fmt.Println("No unmatched file types found")
+			return nil
+		}
+
+		for _, gap := range gaps {
+			fmt.Println(gap)
+		}
+		return nil
+	},
+}
+
+var versionJSON bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show lux's version and the protocol versions it speaks",
+	Long: `Print lux's release, the commit it was built from, the LSP protocol
+version it implements, and its MCP protocol revision.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := buildinfo.Get()
+		if versionJSON {
+			data, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		commit := info.Commit
+		if commit == "" {
+			commit = "unknown"
+		}
+		fmt.Printf("lux %s\n", info.Version)
+		fmt.Printf("commit %s\n", commit)
+		fmt.Printf("lsp protocol %s\n", info.LSPProtocol)
+		fmt.Printf("mcp protocol %s\n", info.MCPProtocol)
+		return nil
+	},
+}
 
 var genmanCmd = &cobra.Command{
 	Use:    "genman <output-dir>",
@@ -352,7 +1057,7 @@ var genmanCmd = &cobra.Command{
 		header := &doc.GenManHeader{
 			Title:   "LUX",
 			Section: "1",
-			Source:  "lux " + version,
+			Source:  "lux " + buildinfo.Version,
 			Manual:  "User Commands",
 		}
 		return doc.GenManTree(rootCmd, header, args[0])
@@ -415,7 +1120,16 @@ func buildPlugin() purse.Plugin {
 func init() {
 	formatCmd.Flags().BoolVar(&formatStdout, "stdout", false, "Print formatted output to stdout instead of writing in-place")
 
+	serveCmd.Flags().BoolVar(&serveDryRun, "dry-run", false,
+		"Log which servers would handle each message without starting any")
+	serveCmd.Flags().BoolVar(&servePrewarm, "prewarm", false,
+		"Build and start every configured LSP at startup, not just those with prewarm = true")
+	serveCmd.Flags().StringVar(&serveMCPSSEAddr, "mcp-sse", "",
+		"Also serve MCP over SSE on this address, sharing LSP processes with the editor session")
+	serveCmd.Flags().StringVar(&serveMCPHTTPAddr, "mcp-http", "",
+		"Also serve MCP over streamable HTTP on this address, sharing LSP processes with the editor session")
 	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(dapCmd)
 
 	addCmd.Flags().StringVarP(&addBinary, "binary", "b", "",
 		"Specify custom binary name or path within the flake (e.g., 'rust-analyzer' or 'bin/custom-lsp')")
@@ -423,11 +1137,61 @@ func init() {
 		"Write to a custom config file location instead of the default")
 	rootCmd.AddCommand(addCmd)
 
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Overwrite an existing config")
+	initCmd.Flags().BoolVar(&initStdout, "stdout", false, "Print the config instead of writing it")
+	initCmd.Flags().StringVar(&initConfigPath, "config-path", "",
+		"Write to a custom config file location instead of the default")
+	rootCmd.AddCommand(initCmd)
+
+	probeCmd.Flags().BoolVar(&probeWrite, "write", false, "Add the probed server to the config")
+	probeCmd.Flags().StringVar(&probeName, "name", "", "Name for the config entry (default: the server's reported name)")
+	probeCmd.Flags().StringVar(&probeFlake, "flake", "", "Flake reference to record in the config entry")
+	probeCmd.Flags().StringSliceVar(&probeExtensions, "ext", nil, "File extensions for the config entry")
+	probeCmd.Flags().StringSliceVar(&probeLanguageIDs, "language-id", nil, "Language IDs for the config entry")
+	probeCmd.Flags().StringVar(&probeConfigPath, "config-path", "",
+		"Write to a custom config file location instead of the default")
+	rootCmd.AddCommand(probeCmd)
+
 	rootCmd.AddCommand(listCmd)
+
+	buildCmd.Flags().IntVarP(&buildJobs, "jobs", "j", 1, "Number of LSPs to build at once")
+	rootCmd.AddCommand(buildCmd)
+
+	for _, c := range []*cobra.Command{statusCmd, startCmd, stopCmd, reloadCmd, reportCmd, stateDumpCmd, stateLoadCmd, applyEditCmd} {
+		c.Flags().StringVarP(&controlWorkspace, "workspace", "w", "",
+			"Workspace directory of the server to control (default: the current directory's workspace)")
+	}
+	statusCmd.Flags().StringVar(&statusSort, "sort", subprocess.StatusSortName, "Sort by name, state, or uptime")
+	statusCmd.Flags().StringSliceVar(&statusStates, "state", nil, "Only show servers in these states (e.g. running,failed)")
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(stopCmd)
+	rootCmd.AddCommand(reloadCmd)
+
+	stateDumpCmd.Flags().StringVarP(&stateOutput, "output", "o", "", "File to write (default: stdout)")
+	stateDumpCmd.Flags().BoolVar(&stateText, "text", false, "Include the text of open documents")
+	stateCmd.AddCommand(stateDumpCmd)
+	stateCmd.AddCommand(stateLoadCmd)
+	rootCmd.AddCommand(stateCmd)
+
+	statsCmd.AddCommand(statsExportCmd)
+	rootCmd.AddCommand(statsCmd)
+
+	reportCmd.Flags().StringVarP(&reportOutput, "output", "o", "", "Tarball to write (default: lux-report-<time>.tar.gz)")
+	reportCmd.Flags().BoolVarP(&reportYes, "yes", "y", false, "Write without asking for confirmation")
+	rootCmd.AddCommand(reportCmd)
 	rootCmd.AddCommand(formatCmd)
+	rootCmd.AddCommand(applyEditCmd)
+
+	checkCmd.Flags().DurationVar(&checkTimeout, "timeout", 30*time.Second,
+		"How long to wait for a server's first diagnostics")
+	checkCmd.Flags().DurationVar(&checkSettle, "settle", time.Second,
+		"How long diagnostics must stay unchanged before they are reported")
+	rootCmd.AddCommand(checkCmd)
+
+	doctorCmd.Flags().BoolVar(&doctorWorkspace, "workspace", false,
+		"Scan the workspace for file types with no configured LSP")
+	rootCmd.AddCommand(doctorCmd)
 
 	mcpCmd.AddCommand(mcpStdioCmd)
 
@@ -440,6 +1204,9 @@ func init() {
 	mcpCmd.AddCommand(mcpInstallClaudeCmd)
 
 	rootCmd.AddCommand(mcpCmd)
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "Print the version information as JSON")
+	rootCmd.AddCommand(versionCmd)
+
 	rootCmd.AddCommand(genmanCmd)
 	rootCmd.AddCommand(generatePluginCmd)
 }
@@ -40,7 +40,7 @@
 
           nativeBuildInputs = [ pkgs.scdoc ];
 
-          ldflags = [ "-X main.version=${version}" ];
+          ldflags = [ "-X github.com/amarbel-llc/lux/internal/buildinfo.Version=${version}" ];
 
           postInstall = ''
             # Section 1: generate from cobra commands
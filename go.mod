@@ -5,8 +5,12 @@ go 1.22
 require (
 	github.com/BurntSushi/toml v1.3.2
 	github.com/amarbel-llc/go-lib-mcp v0.0.0-20260215160001-e634f96c4717
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/gobwas/glob v0.2.3
 	github.com/spf13/cobra v1.8.0
+	github.com/tetratelabs/wazero v1.8.2
+	golang.org/x/sync v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -14,5 +18,5 @@ require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
@@ -0,0 +1,86 @@
+// Package buildinfo describes the lux binary: its release, the commit it was
+// built from, and the protocol versions it speaks to clients. It is reported
+// by `lux version`, in serverInfo on initialize, in `lux status`, and in
+// `lux report` bundles, so a problem can be matched to the release that has it.
+package buildinfo
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/amarbel-llc/go-lib-mcp/protocol"
+)
+
+// Version and Commit are set at link time:
+//
+//	go build -ldflags "-X github.com/amarbel-llc/lux/internal/buildinfo.Version=0.1.0"
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// LSPProtocol is the version of the Language Server Protocol lux implements
+// towards editors and backends.
+const LSPProtocol = "3.17"
+
+// MCPProtocol is the MCP protocol revision lux's MCP server implements.
+const MCPProtocol = protocol.ProtocolVersion
+
+// Info is the build and protocol information of a lux binary.
+type Info struct {
+	Version     string `json:"version"`
+	Commit      string `json:"commit,omitempty"`
+	LSPProtocol string `json:"lspProtocol"`
+	MCPProtocol string `json:"mcpProtocol"`
+}
+
+// Get returns the running binary's Info. The commit falls back to the one the
+// Go toolchain stamped into the binary when none was set at link time.
+func Get() Info {
+	return Info{
+		Version:     Version,
+		Commit:      commit(),
+		LSPProtocol: LSPProtocol,
+		MCPProtocol: MCPProtocol,
+	}
+}
+
+func commit() string {
+	if Commit != "" {
+		return Commit
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision string
+	var modified bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// String formats i on one line, e.g.
+// "lux 0.1.0 (commit 1a2b3c4, LSP 3.17, MCP 2024-11-05)".
+func (i Info) String() string {
+	commit, dirty := strings.CutSuffix(i.Commit, "-dirty")
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if commit == "" {
+		commit = "unknown"
+	} else if dirty {
+		commit += "-dirty"
+	}
+	return fmt.Sprintf("lux %s (commit %s, LSP %s, MCP %s)", i.Version, commit, i.LSPProtocol, i.MCPProtocol)
+}
@@ -0,0 +1,22 @@
+package buildinfo
+
+import "testing"
+
+func TestInfo_String(t *testing.T) {
+	tests := []struct {
+		commit   string
+		expected string
+	}{
+		{"", "lux 0.1.0 (commit unknown, LSP 3.17, MCP 2024-11-05)"},
+		{"1a2b3c4", "lux 0.1.0 (commit 1a2b3c4, LSP 3.17, MCP 2024-11-05)"},
+		{"0123456789abcdef0123", "lux 0.1.0 (commit 0123456789ab, LSP 3.17, MCP 2024-11-05)"},
+		{"0123456789abcdef0123-dirty", "lux 0.1.0 (commit 0123456789ab-dirty, LSP 3.17, MCP 2024-11-05)"},
+	}
+
+	for _, tt := range tests {
+		info := Info{Version: "0.1.0", Commit: tt.commit, LSPProtocol: "3.17", MCPProtocol: "2024-11-05"}
+		if got := info.String(); got != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, got)
+		}
+	}
+}
@@ -10,18 +10,23 @@ import (
 	"time"
 
 	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
-	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/lsp"
 	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
 )
 
 func Bootstrap(ctx context.Context, flake, binarySpec, configPath string) error {
 	if configPath == "" {
 		configPath = config.ConfigPath()
 	}
+	cfg, err := config.LoadFrom(configPath)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
 	fmt.Printf("Building %s...\n", flake)
 
-	executor := subprocess.NewNixExecutor()
+	executor := subprocess.NewExecutor(cfg.ExecutorKind(), config.StateDir())
 	binPath, err := executor.Build(ctx, flake, binarySpec)
 	if err != nil {
 		return fmt.Errorf("building flake: %w", err)
@@ -36,6 +41,63 @@ func Bootstrap(ctx context.Context, flake, binarySpec, configPath string) error
 	}
 	defer proc.Kill()
 
+	initResult, err := initialize(ctx, proc)
+	if err != nil {
+		return err
+	}
+
+	name := inferName(flake)
+	extensions, languageIDs := inferFileTypes(name)
+
+	if len(extensions) == 0 && len(languageIDs) == 0 {
+		fmt.Println("Warning: Could not infer file types from capabilities")
+		fmt.Println("You will need to configure extensions or language_ids manually")
+	}
+
+	cache := &CachedCapabilities{
+		Flake:        flake,
+		Version:      "",
+		DiscoveredAt: time.Now().Format(time.RFC3339),
+		Capabilities: initResult.Capabilities,
+	}
+
+	if initResult.ServerInfo != nil {
+		cache.Version = initResult.ServerInfo.Version
+	}
+
+	if err := saveCache(name, cache); err != nil {
+		fmt.Printf("Warning: could not save capabilities cache: %v\n", err)
+	}
+
+	lspConfig := config.LSP{
+		Name:        name,
+		Flake:       flake,
+		Binary:      binarySpec,
+		Extensions:  extensions,
+		LanguageIDs: languageIDs,
+	}
+
+	if err := config.AddLSPTo(configPath, lspConfig); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+
+	fmt.Printf("\nAdded LSP: %s\n", name)
+	fmt.Printf("  Flake: %s\n", flake)
+	if len(extensions) > 0 {
+		fmt.Printf("  Extensions: %v\n", extensions)
+	}
+	if len(languageIDs) > 0 {
+		fmt.Printf("  Languages: %v\n", languageIDs)
+	}
+	fmt.Printf("\nConfig saved to: %s\n", configPath)
+	fmt.Println("You can edit the config to adjust file type matching.")
+
+	return nil
+}
+
+// initialize runs the initialize handshake against a freshly started server,
+// then shuts it down, returning what it reported about itself.
+func initialize(ctx context.Context, proc *subprocess.Process) (*lsp.InitializeResult, error) {
 	conn := jsonrpc.NewConn(proc.Stdout, proc.Stdin, nil)
 
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -95,12 +157,12 @@ func Bootstrap(ctx context.Context, flake, binarySpec, configPath string) error
 
 	result, err := conn.Call(ctx, lsp.MethodInitialize, initParams)
 	if err != nil {
-		return fmt.Errorf("initialize failed: %w", err)
+		return nil, fmt.Errorf("initialize failed: %w", err)
 	}
 
 	var initResult lsp.InitializeResult
 	if err := json.Unmarshal(result, &initResult); err != nil {
-		return fmt.Errorf("parsing initialize result: %w", err)
+		return nil, fmt.Errorf("parsing initialize result: %w", err)
 	}
 
 	conn.Notify(lsp.MethodInitialized, struct{}{})
@@ -108,53 +170,7 @@ func Bootstrap(ctx context.Context, flake, binarySpec, configPath string) error
 	conn.Call(ctx, lsp.MethodShutdown, nil)
 	conn.Notify(lsp.MethodExit, nil)
 
-	name := inferName(flake)
-	extensions, languageIDs := inferFileTypes(initResult.Capabilities)
-
-	if len(extensions) == 0 && len(languageIDs) == 0 {
-		fmt.Println("Warning: Could not infer file types from capabilities")
-		fmt.Println("You will need to configure extensions or language_ids manually")
-	}
-
-	cache := &CachedCapabilities{
-		Flake:        flake,
-		Version:      "",
-		DiscoveredAt: time.Now().Format(time.RFC3339),
-		Capabilities: initResult.Capabilities,
-	}
-
-	if initResult.ServerInfo != nil {
-		cache.Version = initResult.ServerInfo.Version
-	}
-
-	if err := saveCache(name, cache); err != nil {
-		fmt.Printf("Warning: could not save capabilities cache: %v\n", err)
-	}
-
-	lspConfig := config.LSP{
-		Name:        name,
-		Flake:       flake,
-		Binary:      binarySpec,
-		Extensions:  extensions,
-		LanguageIDs: languageIDs,
-	}
-
-	if err := config.AddLSPTo(configPath, lspConfig); err != nil {
-		return fmt.Errorf("saving config: %w", err)
-	}
-
-	fmt.Printf("\nAdded LSP: %s\n", name)
-	fmt.Printf("  Flake: %s\n", flake)
-	if len(extensions) > 0 {
-		fmt.Printf("  Extensions: %v\n", extensions)
-	}
-	if len(languageIDs) > 0 {
-		fmt.Printf("  Languages: %v\n", languageIDs)
-	}
-	fmt.Printf("\nConfig saved to: %s\n", configPath)
-	fmt.Println("You can edit the config to adjust file type matching.")
-
-	return nil
+	return &initResult, nil
 }
 
 func inferName(flake string) string {
@@ -173,7 +189,13 @@ func inferName(flake string) string {
 	return flake
 }
 
-func inferFileTypes(caps lsp.ServerCapabilities) (extensions []string, languageIDs []string) {
+// inferFileTypes returns the file types of the built-in registry server
+// called name. Capabilities say nothing about file types, so a server lux
+// doesn't know gets none.
+func inferFileTypes(name string) (extensions []string, languageIDs []string) {
+	if entry := config.LookupRegistryByName(name); entry != nil {
+		return entry.Extensions, entry.LanguageIDs
+	}
 	return nil, nil
 }
 
@@ -4,8 +4,8 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
 )
 
 func LoadAllCached() (map[string]*CachedCapabilities, error) {
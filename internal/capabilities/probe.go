@@ -0,0 +1,75 @@
+package capabilities
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// Probe starts an arbitrary server command, which need not be configured or
+// packaged as a flake, and returns its initialize result.
+func Probe(ctx context.Context, command []string) (*lsp.InitializeResult, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command given")
+	}
+
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return nil, fmt.Errorf("finding %s: %w", command[0], err)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	proc, err := subprocess.NewBinaryExecutor().Execute(ctx, path, command[1:], nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("starting %s: %w", command[0], err)
+	}
+	defer proc.Kill()
+
+	return initialize(ctx, proc)
+}
+
+// ProbedLSP builds a config entry that runs command as a binary. The name
+// defaults to the server's reported name, or the command's base name.
+func ProbedLSP(command []string, result *lsp.InitializeResult) config.LSP {
+	name := filepath.Base(command[0])
+	if result.ServerInfo != nil && result.ServerInfo.Name != "" {
+		name = result.ServerInfo.Name
+	}
+
+	extensions, languageIDs := inferFileTypes(name)
+
+	return config.LSP{
+		Name:        name,
+		Binary:      command[0],
+		Args:        command[1:],
+		Extensions:  extensions,
+		LanguageIDs: languageIDs,
+	}
+}
+
+// AddProbed adds entry, built by ProbedLSP, to the config at path. Nothing is
+// written if the entry has no file types to route to it, or if the config
+// would no longer validate, as when its executor is nix and entry has no
+// flake.
+func AddProbed(path string, entry config.LSP) error {
+	if len(entry.Extensions) == 0 && len(entry.LanguageIDs) == 0 && len(entry.Patterns) == 0 {
+		return fmt.Errorf("no file types known for %s: pass --ext or --language-id", entry.Name)
+	}
+
+	cfg, err := config.LoadFrom(path)
+	if err != nil {
+		return err
+	}
+	if entry.Flake == "" && cfg.ExecutorKind() == config.ExecutorNix {
+		return fmt.Errorf("%s uses the nix executor, which runs servers from flakes: pass --flake, or set executor = %q", path, config.ExecutorBinary)
+	}
+
+	return config.AddLSPTo(path, entry)
+}
@@ -0,0 +1,85 @@
+package capabilities
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestProbedLSP(t *testing.T) {
+	entry := ProbedLSP([]string{"/usr/bin/gopls", "serve"}, &lsp.InitializeResult{
+		ServerInfo: &lsp.ServerInfo{Name: "gopls"},
+	})
+	if entry.Name != "gopls" || entry.Binary != "/usr/bin/gopls" || len(entry.Args) != 1 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if len(entry.Extensions) != 1 || entry.Extensions[0] != "go" {
+		t.Errorf("expected the registry's extensions for gopls, got %v", entry.Extensions)
+	}
+
+	if unknown := ProbedLSP([]string{"my-lsp"}, &lsp.InitializeResult{}); len(unknown.Extensions) != 0 || unknown.Name != "my-lsp" {
+		t.Errorf("expected an unknown server named after its command with no file types, got %+v", unknown)
+	}
+}
+
+func TestAddProbed(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "lsps.toml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	unchanged := func(t *testing.T, path, content string) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("expected the config left as it was, got:\n%s", data)
+		}
+	}
+
+	probed := config.LSP{Name: "my-lsp", Binary: "/usr/bin/my-lsp"}
+
+	t.Run("no file types", func(t *testing.T) {
+		content := "executor = \"binary\"\n"
+		path := write(t, content)
+		if err := AddProbed(path, probed); err == nil {
+			t.Error("expected an error for an entry with no file types")
+		}
+		unchanged(t, path, content)
+	})
+
+	t.Run("nix without flake", func(t *testing.T) {
+		content := "executor = \"nix\"\n"
+		path := write(t, content)
+		entry := probed
+		entry.Extensions = []string{"my"}
+		if err := AddProbed(path, entry); err == nil {
+			t.Error("expected an error for an entry without a flake under the nix executor")
+		}
+		unchanged(t, path, content)
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		path := write(t, "executor = \"binary\"\n")
+		entry := probed
+		entry.Extensions = []string{"my"}
+		if err := AddProbed(path, entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cfg, err := config.LoadFrom(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.LSPs) != 1 || cfg.LSPs[0].Binary != "/usr/bin/my-lsp" {
+			t.Errorf("expected the probed entry written, got %+v", cfg.LSPs)
+		}
+	})
+}
@@ -0,0 +1,360 @@
+// Package check runs files through their configured LSP once, outside of an
+// editor, and reports the diagnostics it publishes.
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/server"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// Checker opens files against their LSPs and collects diagnostics. Servers
+// started for one file are reused for the next.
+type Checker struct {
+	cfg    *config.Config
+	router *server.Router
+	pool   *subprocess.Pool
+	root   string
+
+	// Timeout bounds the wait for a server's first diagnostics; Settle is
+	// how long to keep listening for updated diagnostics after that.
+	Timeout time.Duration
+	Settle  time.Duration
+
+	published map[lsp.DocumentURI]*publication
+	// quiet holds servers that let a wait time out without publishing.
+	// Later files get only Settle to hear from them.
+	quiet map[string]bool
+	mu    sync.Mutex
+}
+
+// publication holds the latest diagnostics pushed for a document by server.
+// idle is signalled when server ends a work-done progress, such as its
+// analysis, so a server with nothing to say isn't waited on for Timeout.
+type publication struct {
+	server      string
+	diagnostics []lsp.Diagnostic
+	version     int
+	updated     chan struct{}
+	idle        chan struct{}
+}
+
+// New creates a Checker for files in the workspace rooted at root.
+func New(cfg *config.Config, root string) (*Checker, error) {
+	router, err := server.NewRouter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating router: %w", err)
+	}
+	if err := router.LoadOwnerRoutes(root); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+
+	c := &Checker{
+		cfg:       cfg,
+		router:    router,
+		root:      root,
+		Timeout:   30 * time.Second,
+		Settle:    time.Second,
+		published: make(map[lsp.DocumentURI]*publication),
+		quiet:     make(map[string]bool),
+	}
+
+	c.pool = subprocess.NewPool(subprocess.NewExecutor(cfg.ExecutorKind(), config.StateDir()), c.handler)
+	maxFailures, window := cfg.RestartBudget()
+	c.pool.SetRestartPolicy(subprocess.RestartPolicy{MaxFailures: maxFailures, Window: window})
+
+	for _, l := range cfg.LSPs {
+		r, err := server.NewRegistration(l)
+		if err == nil {
+			err = c.pool.Register(l.Name, r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", l.Name, err)
+		}
+	}
+
+	return c, nil
+}
+
+// Close stops every server the Checker started.
+func (c *Checker) Close() {
+	c.pool.StopAll()
+}
+
+// Check opens path against the LSP routed to it and returns its diagnostics,
+// using pull diagnostics when the server supports them and otherwise waiting
+// for it to publish.
+func (c *Checker) Check(ctx context.Context, path string) ([]lsp.Diagnostic, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("resolving path: %w", err)
+	}
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := lsp.URIFromPath(abs)
+	name := c.router.RouteByURI(uri)
+	if name == "" {
+		return nil, fmt.Errorf("no LSP configured for %s", path)
+	}
+	l := c.cfg.FindLSP(name)
+
+	inst, err := c.pool.GetOrStart(ctx, name, c.initParams())
+	if err != nil {
+		return nil, fmt.Errorf("starting LSP %s: %w", name, err)
+	}
+
+	pub := c.watch(name, uri)
+	defer c.unwatch(uri)
+
+	languageID := uri.LanguageID()
+	if len(l.LanguageIDs) > 0 && !slices.Contains(l.LanguageIDs, languageID) {
+		languageID = l.LanguageIDs[0]
+	}
+	if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, LanguageID: languageID, Version: 1, Text: string(content)},
+	}); err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer inst.Notify(lsp.MethodTextDocumentDidClose, lsp.DidCloseTextDocumentParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	})
+
+	if inst.Capabilities != nil && inst.Capabilities.DiagnosticProvider != nil {
+		return c.pull(ctx, inst, l, uri)
+	}
+	return c.wait(ctx, name, pub)
+}
+
+func (c *Checker) pull(ctx context.Context, inst *subprocess.LSPInstance, l *config.LSP, uri lsp.DocumentURI) ([]lsp.Diagnostic, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	result, err := inst.Call(ctx, lsp.MethodTextDocumentDiagnostic, map[string]any{
+		"textDocument": lsp.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("requesting diagnostics from %s: %w", l.Name, err)
+	}
+	result = server.ApplyDiagnosticConfig(l, uri, result)
+
+	var report struct {
+		Items []lsp.Diagnostic `json:"items"`
+	}
+	if err := json.Unmarshal(result, &report); err != nil {
+		return nil, fmt.Errorf("parsing diagnostics from %s: %w", l.Name, err)
+	}
+	return report.Items, nil
+}
+
+// wait returns the diagnostics published for a document once they have
+// stopped changing for Settle, since servers often publish an empty list
+// before their analysis finishes. Some servers publish nothing for a file
+// without problems: waiting ends early when the server reports its work
+// done, and a server that lets Timeout pass is taken to have nothing to say,
+// for this file and the next.
+func (c *Checker) wait(ctx context.Context, name string, pub *publication) ([]lsp.Diagnostic, error) {
+	c.mu.Lock()
+	quiet := c.quiet[name]
+	c.mu.Unlock()
+	first := c.Timeout
+	if quiet {
+		first = c.Settle
+	}
+	timeout := time.NewTimer(first)
+	defer timeout.Stop()
+
+	select {
+	case <-pub.updated:
+	case <-pub.idle:
+	case <-timeout.C:
+		if !quiet {
+			c.mu.Lock()
+			c.quiet[name] = true
+			c.mu.Unlock()
+			fmt.Fprintf(os.Stderr, "warning: %s published no diagnostics within %s\n", name, first)
+		}
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	settle := time.NewTimer(c.Settle)
+	defer settle.Stop()
+	for {
+		select {
+		case <-pub.updated:
+			settle.Reset(c.Settle)
+		case <-settle.C:
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return pub.diagnostics, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Checker) watch(server string, uri lsp.DocumentURI) *publication {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pub := &publication{server: server, updated: make(chan struct{}, 1), idle: make(chan struct{}, 1)}
+	c.published[uri] = pub
+	return pub
+}
+
+func (c *Checker) unwatch(uri lsp.DocumentURI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.published, uri)
+}
+
+func (c *Checker) handler(lspName string) jsonrpc.Handler {
+	return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		if msg.IsRequest() {
+			if msg.Method == lsp.MethodWorkspaceConfiguration {
+				return c.configuration(lspName, msg)
+			}
+			return jsonrpc.NewResponse(*msg.ID, nil)
+		}
+
+		if msg.Method == lsp.MethodProgress && msg.Params != nil {
+			c.progress(lspName, msg.Params)
+			return nil, nil
+		}
+		if msg.Method != lsp.MethodTextDocumentPublishDiagnostics || msg.Params == nil {
+			return nil, nil
+		}
+
+		var target struct {
+			URI lsp.DocumentURI `json:"uri"`
+		}
+		json.Unmarshal(msg.Params, &target)
+		raw := server.ApplyDiagnosticConfig(c.cfg.FindLSP(lspName), target.URI, msg.Params)
+
+		var params lsp.PublishDiagnosticsParams
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, nil
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if pub, ok := c.published[params.URI]; ok {
+			// Notifications are handled concurrently, so a stale version
+			// can arrive after a newer one.
+			if params.Version != nil {
+				if *params.Version < pub.version {
+					return nil, nil
+				}
+				pub.version = *params.Version
+			}
+			pub.diagnostics = params.Diagnostics
+			select {
+			case pub.updated <- struct{}{}:
+			default:
+			}
+		}
+		return nil, nil
+	}
+}
+
+// progress signals the documents waiting on lspName when it ends a
+// work-done progress.
+func (c *Checker) progress(lspName string, raw json.RawMessage) {
+	var params struct {
+		Value struct {
+			Kind string `json:"kind"`
+		} `json:"value"`
+	}
+	if json.Unmarshal(raw, &params) != nil || params.Value.Kind != "end" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pub := range c.published {
+		if pub.server != lspName {
+			continue
+		}
+		select {
+		case pub.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// configuration answers workspace/configuration from the LSP's settings.
+func (c *Checker) configuration(lspName string, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	var params struct {
+		Items []struct {
+			Section string `json:"section"`
+		} `json:"items"`
+	}
+	json.Unmarshal(msg.Params, &params)
+
+	var settings map[string]any
+	if l := c.cfg.FindLSP(lspName); l != nil {
+		settings = l.Settings
+	}
+
+	results := make([]any, len(params.Items))
+	for i, item := range params.Items {
+		results[i] = settingsSection(settings, item.Section)
+	}
+	return jsonrpc.NewResponse(*msg.ID, results)
+}
+
+func settingsSection(settings map[string]any, section string) any {
+	var current any = settings
+	if section == "" {
+		return current
+	}
+	for _, part := range strings.Split(section, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return map[string]any{}
+		}
+		if current, ok = m[part]; !ok {
+			return map[string]any{}
+		}
+	}
+	return current
+}
+
+func (c *Checker) initParams() *lsp.InitializeParams {
+	pid := os.Getpid()
+	rootURI := lsp.URIFromPath(c.root)
+	root := c.root
+	return &lsp.InitializeParams{
+		ProcessID: &pid,
+		RootURI:   &rootURI,
+		RootPath:  &root,
+		ClientInfo: &lsp.ClientInfo{
+			Name:    "lux-check",
+			Version: "0.1.0",
+		},
+		Capabilities: lsp.ClientCapabilities{
+			Workspace: &lsp.WorkspaceClientCapabilities{
+				Configuration: true,
+			},
+			Window: &lsp.WindowClientCapabilities{
+				WorkDoneProgress: true,
+			},
+		},
+		WorkspaceFolders: []lsp.WorkspaceFolder{{URI: rootURI, Name: filepath.Base(c.root)}},
+	}
+}
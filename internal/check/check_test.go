@@ -0,0 +1,58 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func newTestChecker() *Checker {
+	return &Checker{
+		cfg:       &config.Config{},
+		Timeout:   time.Minute,
+		Settle:    10 * time.Millisecond,
+		published: make(map[lsp.DocumentURI]*publication),
+		quiet:     make(map[string]bool),
+	}
+}
+
+func TestChecker_WaitEndsWithProgress(t *testing.T) {
+	c := newTestChecker()
+	pub := c.watch("gopls", "file:///src/main.go")
+
+	note, _ := jsonrpc.NewNotification(lsp.MethodProgress, map[string]any{
+		"token": "load",
+		"value": map[string]any{"kind": "end"},
+	})
+	c.handler("gopls")(context.Background(), note)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if diagnostics, err := c.wait(context.Background(), "gopls", pub); err != nil || len(diagnostics) != 0 {
+			t.Errorf("expected no diagnostics, got %v (err %v)", diagnostics, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the wait to end once the server finished its work")
+	}
+}
+
+func TestChecker_WaitQuietServer(t *testing.T) {
+	c := newTestChecker()
+	c.Timeout = 10 * time.Millisecond
+
+	pub := c.watch("taplo", "file:///src/a.toml")
+	if diagnostics, err := c.wait(context.Background(), "taplo", pub); err != nil || diagnostics != nil {
+		t.Errorf("expected a timeout to mean no diagnostics, got %v (err %v)", diagnostics, err)
+	}
+	if !c.quiet["taplo"] {
+		t.Error("expected the server to be remembered as quiet")
+	}
+}
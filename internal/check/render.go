@@ -0,0 +1,132 @@
+package check
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// Counts tallies rendered diagnostics by severity.
+type Counts struct {
+	Errors   int
+	Warnings int
+	Other    int
+}
+
+// Render prints diagnostics compiler-style: a "path:line:col: severity:
+// message" header followed by the source line and carets under the range.
+// Diagnostics without a severity are treated as errors.
+func Render(w io.Writer, path string, content []byte, diagnostics []lsp.Diagnostic) Counts {
+	lines := strings.Split(string(content), "\n")
+
+	sorted := append([]lsp.Diagnostic(nil), diagnostics...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range.Start, sorted[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+
+	var counts Counts
+	for _, d := range sorted {
+		severity := lsp.DiagnosticSeverityError
+		if d.Severity != nil {
+			severity = *d.Severity
+		}
+		switch severity {
+		case lsp.DiagnosticSeverityError:
+			counts.Errors++
+		case lsp.DiagnosticSeverityWarning:
+			counts.Warnings++
+		default:
+			counts.Other++
+		}
+
+		start := d.Range.Start
+		fmt.Fprintf(w, "%s:%d:%d: %s: %s", path, start.Line+1, start.Character+1, severityName(severity), d.Message)
+		if d.Source != "" {
+			fmt.Fprintf(w, " [%s]", d.Source)
+		}
+		fmt.Fprintln(w)
+
+		if start.Line < 0 || start.Line >= len(lines) {
+			continue
+		}
+		line := strings.TrimRight(lines[start.Line], "\r")
+
+		end := d.Range.End.Character
+		if d.Range.End.Line > start.Line {
+			end = utf16Len(line)
+		}
+
+		gutter := fmt.Sprintf("%5d", start.Line+1)
+		fmt.Fprintf(w, "%s | %s\n", gutter, line)
+		fmt.Fprintf(w, "%s | %s\n", strings.Repeat(" ", len(gutter)), caretLine(line, start.Character, end))
+	}
+
+	return counts
+}
+
+// String summarizes the counts, e.g. "2 errors, 1 warning".
+func (c Counts) String() string {
+	return fmt.Sprintf("%s, %s", plural(c.Errors, "error"), plural(c.Warnings, "warning"))
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func severityName(s lsp.DiagnosticSeverity) string {
+	switch s {
+	case lsp.DiagnosticSeverityError:
+		return "error"
+	case lsp.DiagnosticSeverityWarning:
+		return "warning"
+	case lsp.DiagnosticSeverityInformation:
+		return "info"
+	case lsp.DiagnosticSeverityHint:
+		return "hint"
+	default:
+		return "diagnostic"
+	}
+}
+
+// caretLine marks the UTF-16 character range [start, end) of line with
+// carets, keeping tabs before it so the carets line up. Empty ranges get a
+// single caret.
+func caretLine(line string, start, end int) string {
+	var b strings.Builder
+	col := 0
+	carets := 0
+	for _, r := range line {
+		if col >= end && carets > 0 {
+			break
+		}
+		switch {
+		case col >= start:
+			b.WriteByte('^')
+			carets++
+		case r == '\t':
+			b.WriteByte('\t')
+		default:
+			b.WriteByte(' ')
+		}
+		col += len(utf16.Encode([]rune{r}))
+	}
+	if carets == 0 {
+		b.WriteByte('^')
+	}
+	return b.String()
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
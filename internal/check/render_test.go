@@ -0,0 +1,74 @@
+package check
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func severity(s lsp.DiagnosticSeverity) *lsp.DiagnosticSeverity {
+	return &s
+}
+
+func TestRender(t *testing.T) {
+	content := []byte("package main\n\nfunc main() {\n\tfmt.Println(x)\n}\n")
+	diagnostics := []lsp.Diagnostic{
+		{
+			Range:    lsp.Range{Start: lsp.Position{Line: 3, Character: 13}, End: lsp.Position{Line: 3, Character: 14}},
+			Severity: severity(lsp.DiagnosticSeverityError),
+			Source:   "compiler",
+			Message:  "undefined: x",
+		},
+		{
+			Range:    lsp.Range{Start: lsp.Position{Line: 3, Character: 1}, End: lsp.Position{Line: 3, Character: 4}},
+			Severity: severity(lsp.DiagnosticSeverityWarning),
+			Message:  "fmt not imported",
+		},
+	}
+
+	var out bytes.Buffer
+	counts := Render(&out, "main.go", content, diagnostics)
+
+	expected := "main.go:4:2: warning: fmt not imported\n" +
+		"    4 | \tfmt.Println(x)\n" +
+		"      | \t^^^\n" +
+		"main.go:4:14: error: undefined: x [compiler]\n" +
+		"    4 | \tfmt.Println(x)\n" +
+		"      | \t            ^\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	if counts.Errors != 1 || counts.Warnings != 1 {
+		t.Errorf("expected 1 error and 1 warning, got %+v", counts)
+	}
+}
+
+func TestCaretLine(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		start, end int
+		expected   string
+	}{
+		{name: "range", line: "abc def", start: 4, end: 7, expected: "    ^^^"},
+		{name: "empty range", line: "abc", start: 1, end: 1, expected: " ^"},
+		{name: "end of line", line: "abc", start: 3, end: 3, expected: "   ^"},
+		{name: "wide runes", line: "é😀x", start: 3, end: 4, expected: "  ^"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := caretLine(tt.line, tt.start, tt.end); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCountsString(t *testing.T) {
+	if got := (Counts{Errors: 1, Warnings: 2}).String(); got != "1 error, 2 warnings" {
+		t.Errorf("expected %q, got %q", "1 error, 2 warnings", got)
+	}
+}
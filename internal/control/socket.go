@@ -8,21 +8,32 @@ import (
 	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/amarbel-llc/lux/internal/buildinfo"
 	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
 )
 
 type Server struct {
 	path     string
 	pool     *subprocess.Pool
+	gaps     func() []config.WorkspaceGap
+	reload   func() (config.Diff, error)
+	dump     func(io.Writer)
+	state    func(withText bool) any
+	load     func([]byte) (any, error)
 	listener net.Listener
 	mu       sync.Mutex
 	closed   bool
 }
 
 func NewServer(path string, pool *subprocess.Pool) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating socket directory: %w", err)
+	}
 	os.Remove(path)
 
 	listener, err := net.Listen("unix", path)
@@ -37,6 +48,32 @@ func NewServer(path string, pool *subprocess.Pool) (*Server, error) {
 	}, nil
 }
 
+// SetGapsProvider supplies the workspace scan results served by the "gaps"
+// command.
+func (s *Server) SetGapsProvider(fn func() []config.WorkspaceGap) {
+	s.gaps = fn
+}
+
+// SetReloader supplies the handler for the "reload" command.
+func (s *Server) SetReloader(fn func() (config.Diff, error)) {
+	s.reload = fn
+}
+
+// SetDumper supplies the state dump served by the "dump" command, the same
+// one SIGUSR1 writes to stderr.
+func (s *Server) SetDumper(fn func(io.Writer)) {
+	s.dump = fn
+}
+
+// SetStateProvider supplies the routing state snapshot served by the
+// "state" command, with document text for "state text", and the loader for
+// "load-state", which returns the documents that route differently after
+// loading.
+func (s *Server) SetStateProvider(export func(withText bool) any, load func([]byte) (any, error)) {
+	s.state = export
+	s.load = load
+}
+
 func (s *Server) Run(ctx context.Context) error {
 	go func() {
 		<-ctx.Done()
@@ -80,6 +117,11 @@ func (s *Server) handleConn(conn net.Conn) {
 }
 
 func (s *Server) handleCommand(line string) string {
+	// The state to load is one line of JSON, which may contain spaces.
+	if data, ok := strings.CutPrefix(line, "load-state "); ok {
+		return s.handleLoadState([]byte(data))
+	}
+
 	parts := strings.Fields(line)
 	if len(parts) == 0 {
 		return `{"error": "empty command"}`
@@ -90,7 +132,7 @@ func (s *Server) handleCommand(line string) string {
 
 	switch cmd {
 	case "status":
-		return s.handleStatus()
+		return s.handleStatus(args)
 	case "list":
 		return s.handleList()
 	case "start":
@@ -103,14 +145,42 @@ func (s *Server) handleCommand(line string) string {
 			return `{"error": "stop requires LSP name"}`
 		}
 		return s.handleStop(args[0])
+	case "gaps":
+		return s.handleGaps()
+	case "reload":
+		return s.handleReload()
+	case "dump":
+		return s.handleDump()
+	case "state":
+		return s.handleState(args)
+	case "load-state":
+		return `{"error": "load-state requires a state"}`
 	default:
 		return fmt.Sprintf(`{"error": "unknown command: %s"}`, cmd)
 	}
 }
 
-func (s *Server) handleStatus() string {
-	statuses := s.pool.Status()
+// handleStatus answers "status [sort=<key>] [state=<state>,...]".
+func (s *Server) handleStatus(args []string) string {
+	var opts subprocess.StatusOptions
+	for _, arg := range args {
+		key, value, _ := strings.Cut(arg, "=")
+		switch key {
+		case "sort":
+			opts.SortBy = value
+		case "state":
+			opts.States = strings.Split(value, ",")
+		default:
+			return fmt.Sprintf(`{"error": "unknown status option: %s"}`, key)
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
+	}
+
+	statuses := s.pool.StatusWith(opts)
 	data, err := json.Marshal(map[string]any{
+		"lux":  buildinfo.Get(),
 		"lsps": statuses,
 	})
 	if err != nil {
@@ -135,6 +205,9 @@ func (s *Server) handleList() string {
 }
 
 func (s *Server) handleStart(name string) string {
+	if err := s.pool.ResetFailures(name); err != nil {
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
+	}
 	_, err := s.pool.GetOrStart(context.Background(), name, nil)
 	if err != nil {
 		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
@@ -149,92 +222,100 @@ func (s *Server) handleStop(name string) string {
 	return `{"ok": true}`
 }
 
-func (s *Server) Close() error {
-	s.mu.Lock()
-	s.closed = true
-	s.mu.Unlock()
-
-	if s.listener != nil {
-		s.listener.Close()
-	}
-	os.Remove(s.path)
-	return nil
-}
-
-type Client struct {
-	conn net.Conn
-}
-
-func NewClient(path string) (*Client, error) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, fmt.Errorf("no lux server running (socket %s not found)", path)
+func (s *Server) handleGaps() string {
+	var gaps []config.WorkspaceGap
+	if s.gaps != nil {
+		gaps = s.gaps()
 	}
-	conn, err := net.Dial("unix", path)
+	data, err := json.Marshal(map[string]any{
+		"gaps": gaps,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("connecting to socket: %w", err)
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
 	}
-	return &Client{conn: conn}, nil
-}
-
-func (c *Client) Close() error {
-	return c.conn.Close()
+	return string(data)
 }
 
-func (c *Client) sendCommand(cmd string) (map[string]any, error) {
-	_, err := c.conn.Write([]byte(cmd + "\n"))
+func (s *Server) handleReload() string {
+	if s.reload == nil {
+		return `{"error": "reload not supported"}`
+	}
+	diff, err := s.reload()
 	if err != nil {
-		return nil, err
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
 	}
-
-	reader := bufio.NewReader(c.conn)
-	line, err := reader.ReadString('\n')
+	data, err := json.Marshal(map[string]any{
+		"ok":      true,
+		"changes": diff,
+	})
 	if err != nil {
-		return nil, err
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
 	}
+	return string(data)
+}
 
-	var result map[string]any
-	if err := json.Unmarshal([]byte(line), &result); err != nil {
-		return nil, err
+func (s *Server) handleDump() string {
+	if s.dump == nil {
+		return `{"error": "dump not supported"}`
 	}
-
-	if errMsg, ok := result["error"].(string); ok {
-		return nil, fmt.Errorf("%s", errMsg)
+	var b strings.Builder
+	s.dump(&b)
+	data, err := json.Marshal(map[string]any{
+		"dump": b.String(),
+	})
+	if err != nil {
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
 	}
-
-	return result, nil
+	return string(data)
 }
 
-func (c *Client) Status(w io.Writer) error {
-	result, err := c.sendCommand("status")
+// handleState answers "state [text]".
+func (s *Server) handleState(args []string) string {
+	if s.state == nil {
+		return `{"error": "state not supported"}`
+	}
+	withText := false
+	for _, arg := range args {
+		if arg != "text" {
+			return fmt.Sprintf(`{"error": "unknown state option: %s"}`, arg)
+		}
+		withText = true
+	}
+	data, err := json.Marshal(map[string]any{
+		"state": s.state(withText),
+	})
 	if err != nil {
-		return err
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
 	}
+	return string(data)
+}
 
-	lsps, ok := result["lsps"].([]any)
-	if !ok {
-		fmt.Fprintln(w, "No LSPs registered")
-		return nil
+func (s *Server) handleLoadState(state []byte) string {
+	if s.load == nil {
+		return `{"error": "load-state not supported"}`
 	}
-
-	for _, l := range lsps {
-		lsp, ok := l.(map[string]any)
-		if !ok {
-			continue
-		}
-		name := lsp["name"].(string)
-		state := lsp["state"].(string)
-		fmt.Fprintf(w, "%-20s %s\n", name, state)
+	mismatches, err := s.load(state)
+	if err != nil {
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
 	}
-
-	return nil
+	data, err := json.Marshal(map[string]any{
+		"ok":         true,
+		"mismatches": mismatches,
+	})
+	if err != nil {
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
+	}
+	return string(data)
 }
 
-func (c *Client) Start(name string) error {
-	_, err := c.sendCommand("start " + name)
-	return err
-}
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
 
-func (c *Client) Stop(name string) error {
-	_, err := c.sendCommand("stop " + name)
-	return err
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	os.Remove(s.path)
+	return nil
 }
@@ -0,0 +1,242 @@
+// Package dap fronts debug adapters for `lux dap`. Editors start lux as
+// their debug adapter; lux reads the client's initialize request, picks the
+// configured adapter for its adapterID, starts it in a pool like language
+// servers, and routes the session's messages between them until either side
+// closes.
+//
+// The Debug Adapter Protocol frames messages with Content-Length headers
+// like LSP but isn't JSON-RPC. Both ends are read with the DAP framing of
+// package subprocess, which translates it to JSON-RPC, so requests are
+// forwarded and answered by ID like a language server's, and a client's
+// cancel request cancels the request it names.
+package dap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// Proxy routes debug sessions between a client and the adapters in its
+// config.
+type Proxy struct {
+	cfg      *config.Config
+	executor subprocess.Executor
+}
+
+// New returns a proxy starting adapters from cfg with executor.
+func New(cfg *config.Config, executor subprocess.Executor) *Proxy {
+	return &Proxy{cfg: cfg, executor: executor}
+}
+
+// session is one client's debug session.
+type session struct {
+	cfg    *config.Config
+	ctx    context.Context
+	pool   *subprocess.Pool
+	client *subprocess.Conn
+
+	mu       sync.Mutex
+	adapter  *subprocess.Conn
+	inflight map[string]context.CancelFunc // client request ID -> cancel
+	replies  sync.WaitGroup
+
+	endOnce sync.Once
+	ended   chan struct{}
+	err     error
+}
+
+// Run serves the session on in and out until the client closes its end or
+// the adapter exits.
+func (p *Proxy) Run(ctx context.Context, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s := &session{
+		cfg:      p.cfg,
+		ctx:      ctx,
+		inflight: make(map[string]context.CancelFunc),
+		ended:    make(chan struct{}),
+	}
+	s.pool = subprocess.NewPool(p.executor, s.adapterHandler)
+	for _, adapter := range p.cfg.DAPs {
+		err := s.pool.Register(adapter.Name, subprocess.Registration{
+			Flake:   adapter.Flake,
+			Binary:  adapter.Binary,
+			Args:    adapter.Args,
+			Env:     adapter.Env,
+			Framing: subprocess.FramingDAP,
+		})
+		if err != nil {
+			return fmt.Errorf("registering %s: %w", adapter.Name, err)
+		}
+	}
+	// The session ends when the adapter exits, e.g. after a disconnect.
+	s.pool.AddHooks(subprocess.Hooks{
+		OnCrash: func(subprocess.LifecycleEvent) { s.end(nil) },
+	})
+
+	r, w := subprocess.FrameStdio(subprocess.FramingDAP, in, out)
+	s.client = subprocess.NewConn(r, w, s.clientHandler)
+	s.client.HandleInOrder()
+	go func() {
+		err := s.client.Run(ctx)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		s.end(err)
+	}()
+
+	<-s.ended
+	// A client that goes away first closes the adapter's input, which
+	// adapters take as the end of the session too. Answers already on their
+	// way to the client are passed on before returning.
+	s.pool.StopAll()
+	s.replies.Wait()
+	return s.err
+}
+
+func (s *session) end(err error) {
+	s.endOnce.Do(func() {
+		s.err = err
+		close(s.ended)
+	})
+}
+
+// clientHandler routes the client's requests to its adapter, starting it
+// for the initialize request that must come first.
+func (s *session) clientHandler(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	if !msg.IsRequest() {
+		return nil, nil
+	}
+	if msg.Method == "cancel" && s.cancel(msg.Params) {
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	}
+
+	s.mu.Lock()
+	adapter := s.adapter
+	s.mu.Unlock()
+	if adapter == nil {
+		var err error
+		if adapter, err = s.start(msg); err != nil {
+			// The editor shows why the session couldn't start.
+			s.client.Reply(*msg.ID, nil, err)
+			s.end(err)
+			return nil, nil
+		}
+	}
+	s.forward(adapter, msg)
+	return nil, nil
+}
+
+// start starts the adapter serving the adapterID of an initialize request.
+func (s *session) start(msg *jsonrpc.Message) (*subprocess.Conn, error) {
+	if msg.Method != "initialize" {
+		return nil, fmt.Errorf("expected an initialize request, got %q", msg.Method)
+	}
+	var args struct {
+		AdapterID string `json:"adapterID"`
+	}
+	json.Unmarshal(msg.Params, &args)
+
+	adapter, ok := s.cfg.DebugAdapter(args.AdapterID)
+	if !ok {
+		return nil, fmt.Errorf("no debug adapter configured for adapterID %q", args.AdapterID)
+	}
+	inst, err := s.pool.GetOrStart(s.ctx, adapter.Name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.adapter = inst.Conn
+	return s.adapter, nil
+}
+
+// forward sends a client request to the adapter and answers the client with
+// the adapter's response. The answer is written as the adapter's response
+// is read, so it reaches the client in order with the adapter's events.
+func (s *session) forward(adapter *subprocess.Conn, msg *jsonrpc.Message) {
+	id := *msg.ID
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	s.inflight[id.String()] = cancel
+	s.mu.Unlock()
+
+	s.replies.Add(1)
+	done := func(result json.RawMessage, err error) {
+		defer s.replies.Done()
+		s.mu.Lock()
+		delete(s.inflight, id.String())
+		s.mu.Unlock()
+		cancel()
+		s.client.Reply(id, result, err)
+	}
+	if err := adapter.Go(ctx, msg.Method, params(msg.Params), done); err != nil {
+		done(nil, err)
+	}
+}
+
+// cancel cancels the forwarded request a client's cancel request names,
+// and reports whether it named one. Cancel requests naming a progress are
+// the adapter's to answer.
+func (s *session) cancel(raw json.RawMessage) bool {
+	var args struct {
+		RequestID *int `json:"requestId"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil || args.RequestID == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	cancel, ok := s.inflight[strconv.Itoa(*args.RequestID)]
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return true
+}
+
+// adapterHandler passes the adapter's events and reverse requests, such as
+// runInTerminal, on to the client.
+func (s *session) adapterHandler(name string) jsonrpc.Handler {
+	return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		if msg.IsNotification() {
+			s.client.Notify(msg.Method, params(msg.Params))
+			return nil, nil
+		}
+		if !msg.IsRequest() {
+			return nil, nil
+		}
+
+		s.mu.Lock()
+		adapter := s.adapter
+		s.mu.Unlock()
+		id := *msg.ID
+		done := func(result json.RawMessage, err error) {
+			adapter.Reply(id, result, err)
+		}
+		if err := s.client.Go(s.ctx, msg.Method, params(msg.Params), done); err != nil {
+			done(nil, err)
+		}
+		return nil, nil
+	}
+}
+
+// params passes raw on as a message's params, leaving them out if there
+// were none.
+func params(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
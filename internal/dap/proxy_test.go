@@ -0,0 +1,174 @@
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// echoExecutor starts an in-process adapter that answers every request
+// with a response naming the adapter it was started as.
+type echoExecutor struct {
+	started []string
+}
+
+func (e *echoExecutor) Build(ctx context.Context, flake, binary string) (string, error) {
+	return flake + binary, nil
+}
+
+func (e *echoExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*subprocess.Process, error) {
+	e.started = append(e.started, path)
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+
+	go func() {
+		defer stdoutW.Close()
+		r := bufio.NewReader(stdinR)
+		for {
+			body, err := readFrame(r)
+			if err != nil {
+				return
+			}
+			var req struct {
+				Seq     int    `json:"seq"`
+				Command string `json:"command"`
+			}
+			json.Unmarshal(body, &req)
+			if req.Command == "launch" {
+				event, _ := json.Marshal(map[string]any{"seq": 100, "type": "event", "event": "initialized"})
+				writeFrame(stdoutW, event)
+			}
+			resp, _ := json.Marshal(map[string]any{
+				"type":        "response",
+				"request_seq": req.Seq,
+				"success":     true,
+				"command":     req.Command,
+				"body":        map[string]string{"adapter": path},
+			})
+			writeFrame(stdoutW, resp)
+			if req.Command == "disconnect" {
+				return
+			}
+		}
+	}()
+
+	return &subprocess.Process{
+		Stdin:  stdinW,
+		Stdout: stdoutR,
+		Stderr: io.NopCloser(strings.NewReader("")),
+		Wait:   func() error { return nil },
+		Kill:   func() error { stdinR.Close(); return nil },
+	}, nil
+}
+
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	var length int
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+			length, _ = strconv.Atoi(value)
+		}
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+func writeFrame(w io.Writer, body []byte) {
+	fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func frames(messages ...string) io.Reader {
+	var buf bytes.Buffer
+	for _, m := range messages {
+		writeFrame(&buf, []byte(m))
+	}
+	return &buf
+}
+
+func readAll(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	r := bufio.NewReader(out)
+	var messages []map[string]any
+	for {
+		body, err := readFrame(r)
+		if err != nil {
+			return messages
+		}
+		var m map[string]any
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatalf("invalid message %s", body)
+		}
+		messages = append(messages, m)
+	}
+}
+
+func TestProxy_RoutesByAdapterID(t *testing.T) {
+	cfg := &config.Config{DAPs: []config.DAP{
+		{Name: "debugpy", Flake: "nixpkgs#debugpy"},
+		{Name: "delve", Flake: "nixpkgs#delve", AdapterIDs: []string{"go"}},
+	}}
+	executor := &echoExecutor{}
+
+	in := frames(
+		`{"seq":1,"type":"request","command":"initialize","arguments":{"adapterID":"go"}}`,
+		`{"seq":2,"type":"request","command":"launch"}`,
+		`{"seq":3,"type":"request","command":"disconnect"}`,
+	)
+	var out bytes.Buffer
+	if err := New(cfg, executor).Run(context.Background(), in, &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(executor.started) != 1 || executor.started[0] != "nixpkgs#delve" {
+		t.Errorf("expected delve to be started, got %v", executor.started)
+	}
+	messages := readAll(t, &out)
+	var got []string
+	for _, m := range messages {
+		switch m["type"] {
+		case "response":
+			got = append(got, fmt.Sprintf("%v:%v", m["command"], m["request_seq"]))
+		case "event":
+			got = append(got, fmt.Sprint(m["event"]))
+		}
+	}
+	// The adapter's event comes before its answer to launch.
+	if expected := "[initialize:1 initialized launch:2 disconnect:3]"; fmt.Sprint(got) != expected {
+		t.Errorf("expected %s, got %v", expected, got)
+	}
+}
+
+func TestProxy_UnknownAdapter(t *testing.T) {
+	cfg := &config.Config{DAPs: []config.DAP{{Name: "delve", Flake: "nixpkgs#delve"}}}
+	executor := &echoExecutor{}
+
+	in := frames(`{"seq":7,"type":"request","command":"initialize","arguments":{"adapterID":"lldb"}}`)
+	var out bytes.Buffer
+	if err := New(cfg, executor).Run(context.Background(), in, &out); err == nil {
+		t.Fatal("expected an error for an unknown adapter")
+	}
+
+	if len(executor.started) != 0 {
+		t.Errorf("expected no adapter to be started, got %v", executor.started)
+	}
+	messages := readAll(t, &out)
+	if len(messages) != 1 || messages[0]["success"] != false || messages[0]["request_seq"] != float64(7) {
+		t.Errorf("expected a failed initialize response, got %v", messages)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/amarbel-llc/lux/internal/config"
+	"github.com/amarbel-llc/lux/pkg/config"
 	"github.com/amarbel-llc/lux/pkg/filematch"
 )
 
@@ -3,7 +3,7 @@ package formatter
 import (
 	"testing"
 
-	"github.com/amarbel-llc/lux/internal/config"
+	"github.com/amarbel-llc/lux/pkg/config"
 )
 
 func TestRouterMatch(t *testing.T) {
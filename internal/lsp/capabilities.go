@@ -67,17 +67,29 @@ func MergeCapabilities(caps ...ServerCapabilities) ServerCapabilities {
 			merged.SelectionRangeProvider = mergeBoolOrOptions(merged.SelectionRangeProvider, c.SelectionRangeProvider)
 		}
 		if c.WorkspaceSymbolProvider != nil {
-			merged.WorkspaceSymbolProvider = mergeBoolOrOptions(merged.WorkspaceSymbolProvider, c.WorkspaceSymbolProvider)
+			merged.WorkspaceSymbolProvider = mergeResolvableOptions(merged.WorkspaceSymbolProvider, c.WorkspaceSymbolProvider)
+		}
+		if c.MonikerProvider != nil {
+			merged.MonikerProvider = mergeBoolOrOptions(merged.MonikerProvider, c.MonikerProvider)
+		}
+		if c.LinkedEditingRangeProvider != nil {
+			merged.LinkedEditingRangeProvider = mergeBoolOrOptions(merged.LinkedEditingRangeProvider, c.LinkedEditingRangeProvider)
 		}
 		if c.SemanticTokensProvider != nil {
 			merged.SemanticTokensProvider = mergeBoolOrOptions(merged.SemanticTokensProvider, c.SemanticTokensProvider)
 		}
 		if c.InlayHintProvider != nil {
-			merged.InlayHintProvider = mergeBoolOrOptions(merged.InlayHintProvider, c.InlayHintProvider)
+			merged.InlayHintProvider = mergeResolvableOptions(merged.InlayHintProvider, c.InlayHintProvider)
 		}
 		if c.DiagnosticProvider != nil {
 			merged.DiagnosticProvider = mergeBoolOrOptions(merged.DiagnosticProvider, c.DiagnosticProvider)
 		}
+		if c.CallHierarchyProvider != nil {
+			merged.CallHierarchyProvider = mergeBoolOrOptions(merged.CallHierarchyProvider, c.CallHierarchyProvider)
+		}
+		if c.TypeHierarchyProvider != nil {
+			merged.TypeHierarchyProvider = mergeBoolOrOptions(merged.TypeHierarchyProvider, c.TypeHierarchyProvider)
+		}
 		if c.ExecuteCommandProvider != nil {
 			merged.ExecuteCommandProvider = mergeExecuteCommandOptions(merged.ExecuteCommandProvider, c.ExecuteCommandProvider)
 		}
@@ -119,6 +131,30 @@ func mergeBoolOrOptions(a, b any) any {
 	return a
 }
 
+// mergeResolvableOptions is mergeBoolOrOptions for providers whose options
+// may declare resolveProvider: the merged options declare it if either
+// server does, since lux routes each resolve to the server that can answer.
+func mergeResolvableOptions(a, b any) any {
+	merged := mergeBoolOrOptions(a, b)
+	resolves := func(p any) bool {
+		opts, _ := p.(map[string]any)
+		resolve, _ := opts["resolveProvider"].(bool)
+		return resolve
+	}
+	if resolves(merged) || !(resolves(a) || resolves(b)) {
+		return merged
+	}
+
+	opts := map[string]any{}
+	if m, ok := merged.(map[string]any); ok {
+		for k, v := range m {
+			opts[k] = v
+		}
+	}
+	opts["resolveProvider"] = true
+	return opts
+}
+
 func mergeCompletionOptions(a, b *CompletionOptions) *CompletionOptions {
 	if a == nil {
 		return b
@@ -186,9 +222,64 @@ func mergeWorkspaceCaps(a, b *ServerWorkspaceCaps) *ServerWorkspaceCaps {
 			merged.WorkspaceFolders = &wf
 		}
 	}
+	if b.FileOperations != nil {
+		merged.FileOperations = mergeFileOperationOptions(a.FileOperations, b.FileOperations)
+	}
 	return &merged
 }
 
+// mergeFileOperationOptions takes the union of the files each operation is
+// wanted for.
+func mergeFileOperationOptions(a, b *FileOperationOptions) *FileOperationOptions {
+	if a == nil {
+		return b
+	}
+	return &FileOperationOptions{
+		DidCreate:  mergeFileOperationFilters(a.DidCreate, b.DidCreate),
+		WillCreate: mergeFileOperationFilters(a.WillCreate, b.WillCreate),
+		DidRename:  mergeFileOperationFilters(a.DidRename, b.DidRename),
+		WillRename: mergeFileOperationFilters(a.WillRename, b.WillRename),
+		DidDelete:  mergeFileOperationFilters(a.DidDelete, b.DidDelete),
+		WillDelete: mergeFileOperationFilters(a.WillDelete, b.WillDelete),
+	}
+}
+
+func mergeFileOperationFilters(a, b *FileOperationRegistrationOptions) *FileOperationRegistrationOptions {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	filters := append(append([]FileOperationFilter{}, a.Filters...), b.Filters...)
+	return &FileOperationRegistrationOptions{Filters: filters}
+}
+
+// FileOperationFilters returns the filters caps declares for the
+// workspace/{will,did}{Create,Rename,Delete}Files method, or nil if the
+// server doesn't want it.
+func FileOperationFilters(caps *ServerCapabilities, method string) *FileOperationRegistrationOptions {
+	if caps == nil || caps.Workspace == nil || caps.Workspace.FileOperations == nil {
+		return nil
+	}
+	ops := caps.Workspace.FileOperations
+	switch method {
+	case MethodWorkspaceWillCreateFiles:
+		return ops.WillCreate
+	case MethodWorkspaceDidCreateFiles:
+		return ops.DidCreate
+	case MethodWorkspaceWillRenameFiles:
+		return ops.WillRename
+	case MethodWorkspaceDidRenameFiles:
+		return ops.DidRename
+	case MethodWorkspaceWillDeleteFiles:
+		return ops.WillDelete
+	case MethodWorkspaceDidDeleteFiles:
+		return ops.DidDelete
+	}
+	return nil
+}
+
 func mergeStringSlices(a, b []string) []string {
 	seen := make(map[string]bool)
 	var result []string
@@ -215,6 +306,220 @@ func ParseCapabilities(data json.RawMessage) (*ServerCapabilities, error) {
 	return &result.Capabilities, nil
 }
 
+// SupportsMethod reports whether caps advertise a provider for method.
+// Methods without a corresponding provider capability are assumed supported.
+func SupportsMethod(caps *ServerCapabilities, method string) bool {
+	if caps == nil {
+		return true
+	}
+
+	var provider any
+	switch method {
+	case MethodTextDocumentCompletion:
+		return caps.CompletionProvider != nil
+	case MethodTextDocumentSignatureHelp:
+		return caps.SignatureHelpProvider != nil
+	case MethodTextDocumentCodeLens:
+		return caps.CodeLensProvider != nil
+	case MethodCodeLensResolve:
+		return caps.CodeLensProvider != nil && caps.CodeLensProvider.ResolveProvider
+	case MethodTextDocumentDocumentLink:
+		return caps.DocumentLinkProvider != nil
+	case MethodTextDocumentOnTypeFormatting:
+		return caps.DocumentOnTypeFormattingProvider != nil
+	case MethodWorkspaceExecuteCommand:
+		return caps.ExecuteCommandProvider != nil
+	case MethodWorkspaceWillCreateFiles, MethodWorkspaceDidCreateFiles,
+		MethodWorkspaceWillRenameFiles, MethodWorkspaceDidRenameFiles,
+		MethodWorkspaceWillDeleteFiles, MethodWorkspaceDidDeleteFiles:
+		return FileOperationFilters(caps, method) != nil
+	case MethodTextDocumentHover:
+		provider = caps.HoverProvider
+	case MethodTextDocumentDefinition:
+		provider = caps.DefinitionProvider
+	case MethodTextDocumentTypeDefinition:
+		provider = caps.TypeDefinitionProvider
+	case MethodTextDocumentImplementation:
+		provider = caps.ImplementationProvider
+	case MethodTextDocumentReferences:
+		provider = caps.ReferencesProvider
+	case MethodTextDocumentDocumentHighlight:
+		provider = caps.DocumentHighlightProvider
+	case MethodTextDocumentDocumentSymbol:
+		provider = caps.DocumentSymbolProvider
+	case MethodTextDocumentCodeAction:
+		provider = caps.CodeActionProvider
+	case MethodCodeActionResolve:
+		opts, _ := caps.CodeActionProvider.(map[string]any)
+		provider = opts["resolveProvider"]
+	case MethodTextDocumentDocumentColor, MethodTextDocumentColorPresentation:
+		provider = caps.ColorProvider
+	case MethodTextDocumentFormatting:
+		provider = caps.DocumentFormattingProvider
+	case MethodTextDocumentRangeFormatting:
+		provider = caps.DocumentRangeFormattingProvider
+	case MethodTextDocumentRename, MethodTextDocumentPrepareRename:
+		provider = caps.RenameProvider
+	case MethodTextDocumentFoldingRange:
+		provider = caps.FoldingRangeProvider
+	case MethodTextDocumentSelectionRange:
+		provider = caps.SelectionRangeProvider
+	case MethodTextDocumentSemanticTokensFull, MethodTextDocumentSemanticTokensDelta, MethodTextDocumentSemanticTokensRange:
+		provider = caps.SemanticTokensProvider
+	case MethodTextDocumentInlayHint:
+		provider = caps.InlayHintProvider
+	case MethodInlayHintResolve:
+		opts, _ := caps.InlayHintProvider.(map[string]any)
+		provider = opts["resolveProvider"]
+	case MethodTextDocumentPrepareCallHierarchy, MethodCallHierarchyIncomingCalls, MethodCallHierarchyOutgoingCalls:
+		provider = caps.CallHierarchyProvider
+	case MethodTextDocumentPrepareTypeHierarchy, MethodTypeHierarchySupertypes, MethodTypeHierarchySubtypes:
+		provider = caps.TypeHierarchyProvider
+	case MethodTextDocumentDiagnostic, MethodWorkspaceDiagnostic:
+		provider = caps.DiagnosticProvider
+	case MethodWorkspaceSymbol:
+		provider = caps.WorkspaceSymbolProvider
+	case MethodWorkspaceSymbolResolve:
+		opts, _ := caps.WorkspaceSymbolProvider.(map[string]any)
+		provider = opts["resolveProvider"]
+	case MethodTextDocumentMoniker:
+		provider = caps.MonikerProvider
+	case MethodTextDocumentLinkedEditingRange:
+		provider = caps.LinkedEditingRangeProvider
+	case MethodTextDocumentWillSaveWaitUntil:
+		sync, _ := caps.TextDocumentSync.(map[string]any)
+		provider = sync["willSaveWaitUntil"]
+	default:
+		return true
+	}
+
+	if enabled, ok := provider.(bool); ok {
+		return enabled
+	}
+	return provider != nil
+}
+
+// SaveOptions reports whether a server asked for textDocument/didSave in its
+// textDocumentSync options, and whether it wants the saved text included.
+// Servers with unknown capabilities are assumed to want saves, with text.
+func SaveOptions(caps *ServerCapabilities) (wantsSave, includeText bool) {
+	if caps == nil {
+		return true, true
+	}
+
+	sync, ok := caps.TextDocumentSync.(map[string]any)
+	if !ok {
+		return false, false
+	}
+
+	switch save := sync["save"].(type) {
+	case bool:
+		return save, false
+	case map[string]any:
+		include, _ := save["includeText"].(bool)
+		return true, include
+	}
+	return false, false
+}
+
+// RegistrationMethod returns the method a server dynamically registers to
+// provide method, e.g. textDocument/semanticTokens for its full, delta, and
+// range requests.
+func RegistrationMethod(method string) string {
+	switch method {
+	case MethodTextDocumentSemanticTokensFull, MethodTextDocumentSemanticTokensDelta, MethodTextDocumentSemanticTokensRange:
+		return "textDocument/semanticTokens"
+	case MethodCompletionItemResolve:
+		return MethodTextDocumentCompletion
+	case MethodCodeActionResolve:
+		return MethodTextDocumentCodeAction
+	case MethodCodeLensResolve:
+		return MethodTextDocumentCodeLens
+	case MethodInlayHintResolve:
+		return MethodTextDocumentInlayHint
+	case MethodWorkspaceSymbolResolve:
+		return MethodWorkspaceSymbol
+	case MethodCallHierarchyIncomingCalls, MethodCallHierarchyOutgoingCalls:
+		return MethodTextDocumentPrepareCallHierarchy
+	case MethodTypeHierarchySupertypes, MethodTypeHierarchySubtypes:
+		return MethodTextDocumentPrepareTypeHierarchy
+	case MethodTextDocumentPrepareRename:
+		return MethodTextDocumentRename
+	case MethodTextDocumentColorPresentation:
+		return MethodTextDocumentDocumentColor
+	case MethodWorkspaceDiagnostic:
+		return MethodTextDocumentDiagnostic
+	}
+	return method
+}
+
+// registrationCapabilities maps registration methods to the client
+// capability whose dynamicRegistration flag governs them.
+var registrationCapabilities = map[string][]string{
+	MethodWorkspaceDidChangeConfiguration:  {"workspace", "didChangeConfiguration"},
+	MethodWorkspaceDidChangeWatchedFiles:   {"workspace", "didChangeWatchedFiles"},
+	MethodWorkspaceSymbol:                  {"workspace", "symbol"},
+	MethodWorkspaceExecuteCommand:          {"workspace", "executeCommand"},
+	MethodTextDocumentDidOpen:              {"textDocument", "synchronization"},
+	MethodTextDocumentDidChange:            {"textDocument", "synchronization"},
+	MethodTextDocumentDidClose:             {"textDocument", "synchronization"},
+	MethodTextDocumentDidSave:              {"textDocument", "synchronization"},
+	MethodTextDocumentWillSave:             {"textDocument", "synchronization"},
+	MethodTextDocumentWillSaveWaitUntil:    {"textDocument", "synchronization"},
+	MethodTextDocumentCompletion:           {"textDocument", "completion"},
+	MethodTextDocumentHover:                {"textDocument", "hover"},
+	MethodTextDocumentSignatureHelp:        {"textDocument", "signatureHelp"},
+	MethodTextDocumentDefinition:           {"textDocument", "definition"},
+	MethodTextDocumentTypeDefinition:       {"textDocument", "typeDefinition"},
+	MethodTextDocumentImplementation:       {"textDocument", "implementation"},
+	MethodTextDocumentReferences:           {"textDocument", "references"},
+	MethodTextDocumentDocumentHighlight:    {"textDocument", "documentHighlight"},
+	MethodTextDocumentDocumentSymbol:       {"textDocument", "documentSymbol"},
+	MethodTextDocumentCodeAction:           {"textDocument", "codeAction"},
+	MethodTextDocumentCodeLens:             {"textDocument", "codeLens"},
+	MethodTextDocumentFormatting:           {"textDocument", "formatting"},
+	MethodTextDocumentRangeFormatting:      {"textDocument", "rangeFormatting"},
+	MethodTextDocumentOnTypeFormatting:     {"textDocument", "onTypeFormatting"},
+	MethodTextDocumentRename:               {"textDocument", "rename"},
+	MethodTextDocumentFoldingRange:         {"textDocument", "foldingRange"},
+	MethodTextDocumentSelectionRange:       {"textDocument", "selectionRange"},
+	"textDocument/semanticTokens":          {"textDocument", "semanticTokens"},
+	MethodTextDocumentInlayHint:            {"textDocument", "inlayHint"},
+	MethodTextDocumentPrepareCallHierarchy: {"textDocument", "callHierarchy"},
+	MethodTextDocumentPrepareTypeHierarchy: {"textDocument", "typeHierarchy"},
+	MethodTextDocumentMoniker:              {"textDocument", "moniker"},
+	MethodTextDocumentLinkedEditingRange:   {"textDocument", "linkedEditingRange"},
+}
+
+// SupportsDynamicRegistration reports whether a client accepts
+// client/registerCapability for a registration method. Methods whose client
+// capability lux doesn't model are assumed to be accepted; a client that
+// omits a modeled capability doesn't accept them.
+func SupportsDynamicRegistration(caps *ClientCapabilities, method string) bool {
+	path, ok := registrationCapabilities[method]
+	if !ok || caps == nil {
+		return true
+	}
+
+	data, err := json.Marshal(caps)
+	if err != nil {
+		return true
+	}
+	var current any
+	if err := json.Unmarshal(data, &current); err != nil {
+		return true
+	}
+	for _, key := range append(path, "dynamicRegistration") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return false
+		}
+		current = m[key]
+	}
+	dynamic, _ := current.(bool)
+	return dynamic
+}
+
 type CapabilityOverride struct {
 	Disable []string
 	Enable  []string
@@ -310,12 +615,24 @@ func setCapabilityField(caps *ServerCapabilities, fieldName string, value any) {
 	case "inlayHint", "inlayHintProvider":
 		caps.InlayHintProvider = value
 
+	case "callHierarchy", "callHierarchyProvider":
+		caps.CallHierarchyProvider = value
+
+	case "typeHierarchy", "typeHierarchyProvider":
+		caps.TypeHierarchyProvider = value
+
 	case "diagnostic", "diagnosticProvider":
 		caps.DiagnosticProvider = value
 
 	case "workspaceSymbol", "workspaceSymbolProvider":
 		caps.WorkspaceSymbolProvider = value
 
+	case "moniker", "monikerProvider":
+		caps.MonikerProvider = value
+
+	case "linkedEditingRange", "linkedEditingRangeProvider":
+		caps.LinkedEditingRangeProvider = value
+
 	case "documentLink", "documentLinkProvider":
 		if value == nil {
 			caps.DocumentLinkProvider = nil
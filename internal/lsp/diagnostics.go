@@ -0,0 +1,128 @@
+package lsp
+
+import "encoding/json"
+
+// RewriteDiagnosticSources applies rewrite to the source of every diagnostic
+// in a publishDiagnostics params object or a textDocument/diagnostic report
+// (its "items"). Other fields are passed through untouched; raw is returned
+// as-is when nothing changes or it cannot be parsed.
+func RewriteDiagnosticSources(raw json.RawMessage, rewrite func(source string) string) json.RawMessage {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return raw
+	}
+
+	changed := false
+	for _, key := range []string{"diagnostics", "items"} {
+		list, ok := obj[key]
+		if !ok {
+			continue
+		}
+
+		var diags []map[string]json.RawMessage
+		if err := json.Unmarshal(list, &diags); err != nil {
+			continue
+		}
+
+		listChanged := false
+		for _, d := range diags {
+			var source string
+			if s, ok := d["source"]; ok {
+				json.Unmarshal(s, &source)
+			}
+
+			rewritten := rewrite(source)
+			if rewritten == source {
+				continue
+			}
+
+			if rewritten == "" {
+				delete(d, "source")
+			} else {
+				d["source"], _ = json.Marshal(rewritten)
+			}
+			listChanged = true
+		}
+
+		if listChanged {
+			obj[key], _ = json.Marshal(diags)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return raw
+	}
+
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// FilterDiagnostics removes the diagnostics drop reports true for from a
+// publishDiagnostics params object or a textDocument/diagnostic report, like
+// RewriteDiagnosticSources. drop is given each diagnostic's severity (0 if
+// unset), code as a string, and source.
+func FilterDiagnostics(raw json.RawMessage, drop func(severity int, code, source string) bool) json.RawMessage {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return raw
+	}
+
+	changed := false
+	for _, key := range []string{"diagnostics", "items"} {
+		list, ok := obj[key]
+		if !ok {
+			continue
+		}
+
+		var diags []json.RawMessage
+		if err := json.Unmarshal(list, &diags); err != nil {
+			continue
+		}
+
+		kept := make([]json.RawMessage, 0, len(diags))
+		for _, d := range diags {
+			var fields struct {
+				Severity int             `json:"severity"`
+				Code     json.RawMessage `json:"code"`
+				Source   string          `json:"source"`
+			}
+			json.Unmarshal(d, &fields)
+			if !drop(fields.Severity, diagnosticCode(fields.Code), fields.Source) {
+				kept = append(kept, d)
+			}
+		}
+
+		if len(kept) != len(diags) {
+			obj[key], _ = json.Marshal(kept)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return raw
+	}
+
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// diagnosticCode returns a diagnostic's code, a number or a string, as a
+// string.
+func diagnosticCode(raw json.RawMessage) string {
+	var code string
+	if err := json.Unmarshal(raw, &code); err == nil {
+		return code
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number.String()
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package lsp
+
+import "strings"
+
+// DiffOpKind is what a DiffOp does with its line.
+type DiffOpKind int
+
+const (
+	DiffEqual DiffOpKind = iota
+	DiffDelete
+	DiffInsert
+)
+
+// DiffOp is one line of an edit script.
+type DiffOp struct {
+	Kind DiffOpKind
+	Line string
+}
+
+// SplitLines splits s into lines, each keeping its line ending.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// DiffLines computes a shortest edit script between a and b using Myers'
+// O(ND) algorithm.
+func DiffLines(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit == 0 {
+		return nil
+	}
+
+	offset := limit
+	v := make([]int, 2*limit+2)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace, offset, d)
+			}
+		}
+	}
+
+	return nil
+}
+
+func backtrackDiff(a, b []string, trace [][]int, offset, d int) []DiffOp {
+	x, y := len(a), len(b)
+	var ops []DiffOp
+
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, DiffOp{Kind: DiffEqual, Line: a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, DiffOp{Kind: DiffInsert, Line: b[y]})
+		} else {
+			x--
+			ops = append(ops, DiffOp{Kind: DiffDelete, Line: a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, DiffOp{Kind: DiffEqual, Line: a[x]})
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// DiffEdits returns the edits that turn before into after: one per run of
+// changed lines, so an edit touches only the lines that differ.
+func DiffEdits(before, after string) []TextEdit {
+	var edits []TextEdit
+	var edit *TextEdit
+	at := Position{}
+
+	for _, op := range DiffLines(SplitLines(before), SplitLines(after)) {
+		if op.Kind == DiffEqual {
+			if edit != nil {
+				edits = append(edits, *edit)
+				edit = nil
+			}
+			at = lineEnd(at, op.Line)
+			continue
+		}
+
+		if edit == nil {
+			edit = &TextEdit{Range: Range{Start: at, End: at}}
+		}
+		if op.Kind == DiffDelete {
+			at = lineEnd(at, op.Line)
+			edit.Range.End = at
+		} else {
+			edit.NewText += op.Line
+		}
+	}
+	if edit != nil {
+		edits = append(edits, *edit)
+	}
+	return edits
+}
+
+// lineEnd returns the position after line, which starts at the beginning of
+// at's line: the start of the next line, or the end of line when it is the
+// last and has no line ending.
+func lineEnd(at Position, line string) Position {
+	if strings.HasSuffix(line, "\n") {
+		return Position{Line: at.Line + 1}
+	}
+	return Position{Line: at.Line, Character: utf16Len(line)}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
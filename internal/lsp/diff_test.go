@@ -0,0 +1,39 @@
+package lsp
+
+import "testing"
+
+func TestDiffEdits(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		edits  int
+	}{
+		{"equal", "a\nb\n", "a\nb\n", 0},
+		{"one line", "a\nb\nc\n", "a\nB\nc\n", 1},
+		{"two runs", "a\nb\nc\nd\ne\n", "A\nb\nc\nd\nE\n", 2},
+		{"insert", "a\nc\n", "a\nb\nc\n", 1},
+		{"delete", "a\nb\nc\n", "a\nc\n", 1},
+		{"no final newline", "a\nb", "a\nB", 1},
+		{"add final newline", "a\nb", "a\nb\n", 1},
+		{"utf-16", "😀 x", "😀 y", 1},
+		{"from empty", "", "a\n", 1},
+		{"to empty", "a\n", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := DiffEdits(tt.before, tt.after)
+			if len(edits) != tt.edits {
+				t.Errorf("expected %d edits, got %d: %+v", tt.edits, len(edits), edits)
+			}
+			got, err := ApplyTextEdits(tt.before, edits)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.after {
+				t.Errorf("expected %q, got %q", tt.after, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ApplyTextEdits applies LSP text edits to content. Positions are interpreted
+// as UTF-16 code unit offsets, per the LSP default position encoding.
+func ApplyTextEdits(content string, edits []TextEdit) (string, error) {
+	lineStarts := lineOffsets(content)
+
+	type span struct {
+		start, end int
+		text       string
+	}
+
+	spans := make([]span, 0, len(edits))
+	for _, edit := range edits {
+		start := positionToOffset(content, lineStarts, edit.Range.Start)
+		end := positionToOffset(content, lineStarts, edit.Range.End)
+		if end < start {
+			return "", fmt.Errorf("invalid edit range %d:%d-%d:%d",
+				edit.Range.Start.Line, edit.Range.Start.Character,
+				edit.Range.End.Line, edit.Range.End.Character)
+		}
+		spans = append(spans, span{start: start, end: end, text: edit.NewText})
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	var sb strings.Builder
+	cursor := 0
+	for i, s := range spans {
+		if s.start < cursor {
+			return "", fmt.Errorf("overlapping edits at offset %d", s.start)
+		}
+		sb.WriteString(content[cursor:s.start])
+		sb.WriteString(s.text)
+		cursor = s.end
+		if i+1 < len(spans) && spans[i+1].start < s.end {
+			return "", fmt.Errorf("overlapping edits at offset %d", spans[i+1].start)
+		}
+	}
+	sb.WriteString(content[cursor:])
+
+	return sb.String(), nil
+}
+
+func lineOffsets(content string) []int {
+	offsets := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	return offsets
+}
+
+func positionToOffset(content string, lineStarts []int, pos Position) int {
+	if pos.Line >= len(lineStarts) {
+		return len(content)
+	}
+
+	offset := lineStarts[pos.Line]
+	lineEnd := len(content)
+	if pos.Line+1 < len(lineStarts) {
+		lineEnd = lineStarts[pos.Line+1] - 1
+	}
+
+	units := 0
+	for offset < lineEnd && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(content[offset:lineEnd])
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+		offset += size
+	}
+
+	return offset
+}
@@ -0,0 +1,72 @@
+package lsp
+
+import "testing"
+
+func textEdit(sl, sc, el, ec int, text string) TextEdit {
+	return TextEdit{
+		Range: Range{
+			Start: Position{Line: sl, Character: sc},
+			End:   Position{Line: el, Character: ec},
+		},
+		NewText: text,
+	}
+}
+
+func TestApplyTextEdits(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		edits   []TextEdit
+		want    string
+	}{
+		{
+			name:    "single replacement",
+			content: "func foo() {}\n",
+			edits:   []TextEdit{textEdit(0, 5, 0, 8, "bar")},
+			want:    "func bar() {}\n",
+		},
+		{
+			name:    "multiple edits out of order",
+			content: "foo\nfoo()\n",
+			edits: []TextEdit{
+				textEdit(1, 0, 1, 3, "bar"),
+				textEdit(0, 0, 0, 3, "bar"),
+			},
+			want: "bar\nbar()\n",
+		},
+		{
+			name:    "utf-16 offsets",
+			content: "s := \"😀\"; foo\n",
+			edits:   []TextEdit{textEdit(0, 11, 0, 14, "bar")},
+			want:    "s := \"😀\"; bar\n",
+		},
+		{
+			name:    "insert at end of file",
+			content: "a\n",
+			edits:   []TextEdit{textEdit(1, 0, 1, 0, "b\n")},
+			want:    "a\nb\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyTextEdits(tt.content, tt.edits)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApplyTextEditsOverlap(t *testing.T) {
+	_, err := ApplyTextEdits("abcdef", []TextEdit{
+		textEdit(0, 0, 0, 3, "x"),
+		textEdit(0, 2, 0, 4, "y"),
+	})
+	if err == nil {
+		t.Error("expected error for overlapping edits")
+	}
+}
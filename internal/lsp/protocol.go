@@ -11,40 +11,54 @@ const (
 	MethodSetTrace      = "$/setTrace"
 	MethodLogTrace      = "$/logTrace"
 
-	MethodTextDocumentDidOpen             = "textDocument/didOpen"
-	MethodTextDocumentDidChange           = "textDocument/didChange"
-	MethodTextDocumentDidClose            = "textDocument/didClose"
-	MethodTextDocumentDidSave             = "textDocument/didSave"
-	MethodTextDocumentWillSave            = "textDocument/willSave"
-	MethodTextDocumentWillSaveWaitUntil   = "textDocument/willSaveWaitUntil"
-	MethodTextDocumentCompletion          = "textDocument/completion"
-	MethodTextDocumentHover               = "textDocument/hover"
-	MethodTextDocumentSignatureHelp       = "textDocument/signatureHelp"
-	MethodTextDocumentDefinition          = "textDocument/definition"
-	MethodTextDocumentTypeDefinition      = "textDocument/typeDefinition"
-	MethodTextDocumentImplementation      = "textDocument/implementation"
-	MethodTextDocumentReferences          = "textDocument/references"
-	MethodTextDocumentDocumentHighlight   = "textDocument/documentHighlight"
-	MethodTextDocumentDocumentSymbol      = "textDocument/documentSymbol"
-	MethodTextDocumentCodeAction          = "textDocument/codeAction"
-	MethodTextDocumentCodeLens            = "textDocument/codeLens"
-	MethodTextDocumentFormatting          = "textDocument/formatting"
-	MethodTextDocumentRangeFormatting     = "textDocument/rangeFormatting"
-	MethodTextDocumentOnTypeFormatting    = "textDocument/onTypeFormatting"
-	MethodTextDocumentRename              = "textDocument/rename"
-	MethodTextDocumentPrepareRename       = "textDocument/prepareRename"
-	MethodTextDocumentFoldingRange        = "textDocument/foldingRange"
-	MethodTextDocumentSelectionRange      = "textDocument/selectionRange"
-	MethodTextDocumentDocumentLink        = "textDocument/documentLink"
-	MethodTextDocumentDocumentColor       = "textDocument/documentColor"
-	MethodTextDocumentColorPresentation   = "textDocument/colorPresentation"
-	MethodTextDocumentSemanticTokensFull  = "textDocument/semanticTokens/full"
-	MethodTextDocumentSemanticTokensDelta = "textDocument/semanticTokens/full/delta"
-	MethodTextDocumentSemanticTokensRange = "textDocument/semanticTokens/range"
-	MethodTextDocumentInlayHint           = "textDocument/inlayHint"
-	MethodTextDocumentDiagnostic          = "textDocument/diagnostic"
+	MethodTextDocumentDidOpen              = "textDocument/didOpen"
+	MethodTextDocumentDidChange            = "textDocument/didChange"
+	MethodTextDocumentDidClose             = "textDocument/didClose"
+	MethodTextDocumentDidSave              = "textDocument/didSave"
+	MethodTextDocumentWillSave             = "textDocument/willSave"
+	MethodTextDocumentWillSaveWaitUntil    = "textDocument/willSaveWaitUntil"
+	MethodTextDocumentCompletion           = "textDocument/completion"
+	MethodCompletionItemResolve            = "completionItem/resolve"
+	MethodTextDocumentHover                = "textDocument/hover"
+	MethodTextDocumentSignatureHelp        = "textDocument/signatureHelp"
+	MethodTextDocumentDefinition           = "textDocument/definition"
+	MethodTextDocumentTypeDefinition       = "textDocument/typeDefinition"
+	MethodTextDocumentImplementation       = "textDocument/implementation"
+	MethodTextDocumentReferences           = "textDocument/references"
+	MethodTextDocumentDocumentHighlight    = "textDocument/documentHighlight"
+	MethodTextDocumentDocumentSymbol       = "textDocument/documentSymbol"
+	MethodTextDocumentCodeAction           = "textDocument/codeAction"
+	MethodCodeActionResolve                = "codeAction/resolve"
+	MethodTextDocumentCodeLens             = "textDocument/codeLens"
+	MethodCodeLensResolve                  = "codeLens/resolve"
+	MethodTextDocumentFormatting           = "textDocument/formatting"
+	MethodTextDocumentRangeFormatting      = "textDocument/rangeFormatting"
+	MethodTextDocumentOnTypeFormatting     = "textDocument/onTypeFormatting"
+	MethodTextDocumentRename               = "textDocument/rename"
+	MethodTextDocumentPrepareRename        = "textDocument/prepareRename"
+	MethodTextDocumentFoldingRange         = "textDocument/foldingRange"
+	MethodTextDocumentSelectionRange       = "textDocument/selectionRange"
+	MethodTextDocumentDocumentLink         = "textDocument/documentLink"
+	MethodTextDocumentDocumentColor        = "textDocument/documentColor"
+	MethodTextDocumentColorPresentation    = "textDocument/colorPresentation"
+	MethodTextDocumentSemanticTokensFull   = "textDocument/semanticTokens/full"
+	MethodTextDocumentSemanticTokensDelta  = "textDocument/semanticTokens/full/delta"
+	MethodTextDocumentSemanticTokensRange  = "textDocument/semanticTokens/range"
+	MethodTextDocumentInlayHint            = "textDocument/inlayHint"
+	MethodInlayHintResolve                 = "inlayHint/resolve"
+	MethodTextDocumentPrepareCallHierarchy = "textDocument/prepareCallHierarchy"
+	MethodCallHierarchyIncomingCalls       = "callHierarchy/incomingCalls"
+	MethodCallHierarchyOutgoingCalls       = "callHierarchy/outgoingCalls"
+	MethodTextDocumentPrepareTypeHierarchy = "textDocument/prepareTypeHierarchy"
+	MethodTypeHierarchySupertypes          = "typeHierarchy/supertypes"
+	MethodTypeHierarchySubtypes            = "typeHierarchy/subtypes"
+	MethodTextDocumentDiagnostic           = "textDocument/diagnostic"
+	MethodTextDocumentMoniker              = "textDocument/moniker"
+	MethodTextDocumentLinkedEditingRange   = "textDocument/linkedEditingRange"
+	MethodTextDocumentPublishDiagnostics   = "textDocument/publishDiagnostics"
 
 	MethodWorkspaceSymbol                 = "workspace/symbol"
+	MethodWorkspaceSymbolResolve          = "workspaceSymbol/resolve"
 	MethodWorkspaceExecuteCommand         = "workspace/executeCommand"
 	MethodWorkspaceApplyEdit              = "workspace/applyEdit"
 	MethodWorkspaceDidChangeConfiguration = "workspace/didChangeConfiguration"
@@ -53,16 +67,25 @@ const (
 	MethodWorkspaceConfiguration          = "workspace/configuration"
 	MethodWorkspaceWorkspaceFolders       = "workspace/workspaceFolders"
 	MethodWorkspaceDiagnostic             = "workspace/diagnostic"
+	MethodWorkspaceWillCreateFiles        = "workspace/willCreateFiles"
+	MethodWorkspaceDidCreateFiles         = "workspace/didCreateFiles"
+	MethodWorkspaceWillRenameFiles        = "workspace/willRenameFiles"
+	MethodWorkspaceDidRenameFiles         = "workspace/didRenameFiles"
+	MethodWorkspaceWillDeleteFiles        = "workspace/willDeleteFiles"
+	MethodWorkspaceDidDeleteFiles         = "workspace/didDeleteFiles"
 
 	MethodWindowShowMessage            = "window/showMessage"
 	MethodWindowShowMessageRequest     = "window/showMessageRequest"
 	MethodWindowLogMessage             = "window/logMessage"
 	MethodWindowShowDocument           = "window/showDocument"
 	MethodWindowWorkDoneProgressCreate = "window/workDoneProgress/create"
+	MethodWindowWorkDoneProgressCancel = "window/workDoneProgress/cancel"
 
 	MethodClientRegisterCapability   = "client/registerCapability"
 	MethodClientUnregisterCapability = "client/unregisterCapability"
 
+	MethodTelemetryEvent = "telemetry/event"
+
 	MethodProgress = "$/progress"
 )
 
@@ -116,7 +139,8 @@ type DidChangeWatchedFilesCaps struct {
 }
 
 type WorkspaceSymbolClientCaps struct {
-	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	DynamicRegistration bool          `json:"dynamicRegistration,omitempty"`
+	SymbolKind          *ValueSetCaps `json:"symbolKind,omitempty"`
 }
 
 type ExecuteCommandClientCaps struct {
@@ -149,6 +173,8 @@ type TextDocumentClientCapabilities struct {
 	PublishDiagnostics *PublishDiagnosticsClientCaps `json:"publishDiagnostics,omitempty"`
 	SemanticTokens     *SemanticTokensClientCaps     `json:"semanticTokens,omitempty"`
 	InlayHint          *InlayHintClientCaps          `json:"inlayHint,omitempty"`
+	CallHierarchy      *CallHierarchyClientCaps      `json:"callHierarchy,omitempty"`
+	TypeHierarchy      *TypeHierarchyClientCaps      `json:"typeHierarchy,omitempty"`
 }
 
 type TextDocumentSyncClientCaps struct {
@@ -159,7 +185,8 @@ type TextDocumentSyncClientCaps struct {
 }
 
 type CompletionClientCaps struct {
-	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	DynamicRegistration bool          `json:"dynamicRegistration,omitempty"`
+	CompletionItemKind  *ValueSetCaps `json:"completionItemKind,omitempty"`
 }
 
 type HoverClientCaps struct {
@@ -191,7 +218,14 @@ type DocumentHighlightClientCaps struct {
 }
 
 type DocumentSymbolClientCaps struct {
-	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	DynamicRegistration bool          `json:"dynamicRegistration,omitempty"`
+	SymbolKind          *ValueSetCaps `json:"symbolKind,omitempty"`
+}
+
+// ValueSetCaps lists the values of an enumeration, such as SymbolKind, that
+// a client supports.
+type ValueSetCaps struct {
+	ValueSet []int `json:"valueSet,omitempty"`
 }
 
 type CodeActionClientCaps struct {
@@ -227,6 +261,14 @@ type SelectionRangeClientCaps struct {
 	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
 }
 
+type CallHierarchyClientCaps struct {
+	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+}
+
+type TypeHierarchyClientCaps struct {
+	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+}
+
 type PublishDiagnosticsClientCaps struct {
 	RelatedInformation bool `json:"relatedInformation,omitempty"`
 }
@@ -321,7 +363,10 @@ type ServerCapabilities struct {
 	Workspace                        *ServerWorkspaceCaps             `json:"workspace,omitempty"`
 	SemanticTokensProvider           any                              `json:"semanticTokensProvider,omitempty"`
 	MonikerProvider                  any                              `json:"monikerProvider,omitempty"`
+	LinkedEditingRangeProvider       any                              `json:"linkedEditingRangeProvider,omitempty"`
 	InlayHintProvider                any                              `json:"inlayHintProvider,omitempty"`
+	CallHierarchyProvider            any                              `json:"callHierarchyProvider,omitempty"`
+	TypeHierarchyProvider            any                              `json:"typeHierarchyProvider,omitempty"`
 	DiagnosticProvider               any                              `json:"diagnosticProvider,omitempty"`
 	Experimental                     json.RawMessage                  `json:"experimental,omitempty"`
 }
@@ -508,6 +553,20 @@ type WorkspaceFoldersChangeEvent struct {
 	Removed []WorkspaceFolder `json:"removed"`
 }
 
+type MessageType int
+
+const (
+	MessageTypeError   MessageType = 1
+	MessageTypeWarning MessageType = 2
+	MessageTypeInfo    MessageType = 3
+	MessageTypeLog     MessageType = 4
+)
+
+type ShowMessageParams struct {
+	Type    MessageType `json:"type"`
+	Message string      `json:"message"`
+}
+
 type TextEdit struct {
 	Range   Range  `json:"range"`
 	NewText string `json:"newText"`
@@ -36,6 +36,69 @@ func (u DocumentURI) Extension() string {
 	return strings.ToLower(ext)
 }
 
+// LanguageID returns the LSP language identifier for the document's file
+// extension, or "plaintext" for one it doesn't know.
+func (u DocumentURI) LanguageID() string {
+	switch u.Extension() {
+	case ".go":
+		return "go"
+	case ".py":
+		return "python"
+	case ".js":
+		return "javascript"
+	case ".ts":
+		return "typescript"
+	case ".tsx":
+		return "typescriptreact"
+	case ".jsx":
+		return "javascriptreact"
+	case ".rs":
+		return "rust"
+	case ".nix":
+		return "nix"
+	case ".c":
+		return "c"
+	case ".cpp", ".cc", ".cxx":
+		return "cpp"
+	case ".h", ".hpp":
+		return "cpp"
+	case ".java":
+		return "java"
+	case ".rb":
+		return "ruby"
+	case ".php":
+		return "php"
+	case ".cs":
+		return "csharp"
+	case ".swift":
+		return "swift"
+	case ".kt":
+		return "kotlin"
+	case ".scala":
+		return "scala"
+	case ".lua":
+		return "lua"
+	case ".sh", ".bash":
+		return "shellscript"
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".xml":
+		return "xml"
+	case ".html":
+		return "html"
+	case ".css":
+		return "css"
+	case ".md":
+		return "markdown"
+	default:
+		return "plaintext"
+	}
+}
+
 func (u DocumentURI) IsFile() bool {
 	parsed, err := url.Parse(string(u))
 	if err != nil {
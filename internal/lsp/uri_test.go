@@ -0,0 +1,21 @@
+package lsp
+
+import "testing"
+
+func TestDocumentURI_LanguageID(t *testing.T) {
+	tests := []struct {
+		uri      DocumentURI
+		expected string
+	}{
+		{"file:///src/main.go", "go"},
+		{"file:///src/App.TSX", "typescriptreact"},
+		{"file:///src/build.sh", "shellscript"},
+		{"file:///src/notes.txt", "plaintext"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.uri.LanguageID(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.uri, tt.expected, got)
+		}
+	}
+}
@@ -8,31 +8,50 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
 	"github.com/amarbel-llc/go-lib-mcp/protocol"
-	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/formatter"
 	"github.com/amarbel-llc/lux/internal/lsp"
 	"github.com/amarbel-llc/lux/internal/server"
 	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
 )
 
 type Bridge struct {
 	pool      *subprocess.Pool
-	router    *server.Router
+	router    func() *server.Router
 	fmtRouter *formatter.Router
 	executor  subprocess.Executor
 	docMgr    *DocumentManager
+	responses *server.ResponseCache
+
+	// diagnosticConfig applies per-LSP diagnostic_filter and
+	// diagnostic_source config (see server.ApplyDiagnosticConfig).
+	diagnosticConfig func(lspName string, uri lsp.DocumentURI, raw json.RawMessage) json.RawMessage
+
+	captures   map[string]*outputCapture
+	captureMu  sync.Mutex
+	captureSeq atomic.Int64
+
+	// editMu serializes applyWorkspaceEdit, so one edit's checks still hold
+	// when it is written.
+	editMu sync.Mutex
 }
 
-func NewBridge(pool *subprocess.Pool, router *server.Router, fmtRouter *formatter.Router, executor subprocess.Executor) *Bridge {
+// NewBridge returns a bridge to pool's LSPs, routing documents with the
+// router that router returns at the time.
+func NewBridge(pool *subprocess.Pool, router func() *server.Router, fmtRouter *formatter.Router, executor subprocess.Executor) *Bridge {
 	return &Bridge{
 		pool:      pool,
 		router:    router,
 		fmtRouter: fmtRouter,
 		executor:  executor,
+		responses: server.NewResponseCache(),
+		captures:  make(map[string]*outputCapture),
 	}
 }
 
@@ -40,6 +59,10 @@ func (b *Bridge) SetDocumentManager(dm *DocumentManager) {
 	b.docMgr = dm
 }
 
+func (b *Bridge) SetDiagnosticConfig(fn func(lspName string, uri lsp.DocumentURI, raw json.RawMessage) json.RawMessage) {
+	b.diagnosticConfig = fn
+}
+
 func isRetryableLSPError(err error) bool {
 	var rpcErr *jsonrpc.Error
 	if errors.As(err, &rpcErr) {
@@ -74,13 +97,15 @@ func (b *Bridge) callWithRetry(ctx context.Context, inst *subprocess.LSPInstance
 }
 
 func (b *Bridge) withDocument(ctx context.Context, uri lsp.DocumentURI, fn func(*subprocess.LSPInstance) (json.RawMessage, error)) (json.RawMessage, error) {
-	lspName := b.router.RouteByURI(uri)
+	lspName := b.router().RouteByURI(uri)
 	if lspName == "" {
 		return nil, fmt.Errorf("no LSP configured for %s", uri)
 	}
 
+	// The instance outlives this call, so it isn't started under the
+	// tool's context: its timeout only bounds how long the tool waits.
 	initParams := b.defaultInitParams(uri)
-	inst, err := b.pool.GetOrStart(ctx, lspName, initParams)
+	inst, err := b.pool.GetOrStart(context.WithoutCancel(ctx), lspName, initParams)
 	if err != nil {
 		return nil, fmt.Errorf("starting LSP %s: %w", lspName, err)
 	}
@@ -106,7 +131,7 @@ func (b *Bridge) withDocument(ctx context.Context, uri lsp.DocumentURI, fn func(
 		return nil, fmt.Errorf("reading file: %w", err)
 	}
 
-	langID := b.inferLanguageID(uri)
+	langID := uri.LanguageID()
 
 	if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
 		TextDocument: lsp.TextDocumentItem{
@@ -128,11 +153,39 @@ func (b *Bridge) withDocument(ctx context.Context, uri lsp.DocumentURI, fn func(
 	return b.callWithRetry(ctx, inst, fn)
 }
 
+// withCachedDocument is withDocument for cacheable methods: answers are
+// remembered by the version of uri the DocumentManager has synced, and
+// purged when it syncs a change. Without a DocumentManager, or for documents
+// another frontend owns, versions aren't known and nothing is cached.
+func (b *Bridge) withCachedDocument(ctx context.Context, method string, uri lsp.DocumentURI, pos lsp.Position, fn func(*subprocess.LSPInstance) (json.RawMessage, error)) (json.RawMessage, error) {
+	return b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		if b.docMgr == nil {
+			return fn(inst)
+		}
+		version, _, ok := b.docMgr.Snapshot(uri)
+		if !ok {
+			return fn(inst)
+		}
+
+		key := server.CacheKey{Method: method, URI: uri, Version: version, Line: pos.Line, Character: pos.Character}
+		if result, hit := b.responses.Get(key); hit {
+			return result, nil
+		}
+		gen := b.responses.Generation(uri)
+		result, err := fn(inst)
+		if err == nil {
+			b.responses.Put(key, result, gen)
+		}
+		return result, err
+	})
+}
+
 func (b *Bridge) Hover(ctx context.Context, uri lsp.DocumentURI, line, character int) (*protocol.ToolCallResult, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	pos := lsp.Position{Line: line, Character: character}
+	result, err := b.withCachedDocument(ctx, lsp.MethodTextDocumentHover, uri, pos, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentHover, lsp.TextDocumentPositionParams{
 			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
-			Position:     lsp.Position{Line: line, Character: character},
+			Position:     pos,
 		})
 	})
 	if err != nil {
@@ -159,10 +212,11 @@ func (b *Bridge) Hover(ctx context.Context, uri lsp.DocumentURI, line, character
 }
 
 func (b *Bridge) Definition(ctx context.Context, uri lsp.DocumentURI, line, character int) (*protocol.ToolCallResult, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	pos := lsp.Position{Line: line, Character: character}
+	result, err := b.withCachedDocument(ctx, lsp.MethodTextDocumentDefinition, uri, pos, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentDefinition, lsp.TextDocumentPositionParams{
 			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
-			Position:     lsp.Position{Line: line, Character: character},
+			Position:     pos,
 		})
 	})
 	if err != nil {
@@ -309,7 +363,7 @@ func (b *Bridge) tryExternalFormat(ctx context.Context, uri lsp.DocumentURI) (*p
 }
 
 func (b *Bridge) DocumentSymbols(ctx context.Context, uri lsp.DocumentURI) (*protocol.ToolCallResult, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withCachedDocument(ctx, lsp.MethodTextDocumentDocumentSymbol, uri, lsp.Position{}, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentDocumentSymbol, map[string]any{
 			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
 		})
@@ -332,7 +386,7 @@ func (b *Bridge) DocumentSymbols(ctx context.Context, uri lsp.DocumentURI) (*pro
 }
 
 func (b *Bridge) DocumentSymbolsRaw(ctx context.Context, uri lsp.DocumentURI) ([]Symbol, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withCachedDocument(ctx, lsp.MethodTextDocumentDocumentSymbol, uri, lsp.Position{}, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentDocumentSymbol, map[string]any{
 			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
 		})
@@ -374,7 +428,96 @@ func (b *Bridge) CodeAction(ctx context.Context, uri lsp.DocumentURI, startLine,
 	}, nil
 }
 
-func (b *Bridge) Rename(ctx context.Context, uri lsp.DocumentURI, line, character int, newName string) (*protocol.ToolCallResult, error) {
+func (b *Bridge) Rename(ctx context.Context, uri lsp.DocumentURI, line, character int, newName string, apply bool) (*protocol.ToolCallResult, error) {
+	edit, err := b.renameEdit(ctx, uri, line, character, newName)
+	if err != nil {
+		return protocol.ErrorResult(err.Error()), nil
+	}
+
+	if apply {
+		applied, err := b.applyWorkspaceEdit(ctx, edit)
+		if errors.Is(err, errStaleEdit) {
+			// The files moved under the server; resync and ask again once.
+			if err := b.resyncEditedDocuments(ctx, edit); err != nil {
+				return protocol.ErrorResult(err.Error()), nil
+			}
+			if edit, err = b.renameEdit(ctx, uri, line, character, newName); err != nil {
+				return protocol.ErrorResult(err.Error()), nil
+			}
+			applied, err = b.applyWorkspaceEdit(ctx, edit)
+		}
+		if err != nil {
+			return protocol.ErrorResult(fmt.Sprintf("rename not applied: %v", err)), nil
+		}
+		return &protocol.ToolCallResult{
+			Content: []protocol.ContentBlock{protocol.TextContent(formatAppliedFiles(applied))},
+		}, nil
+	}
+
+	text := formatWorkspaceEdit(edit)
+	return &protocol.ToolCallResult{
+		Content: []protocol.ContentBlock{protocol.TextContent(text)},
+	}, nil
+}
+
+// RenamePreview performs the rename request but, instead of reporting edit
+// counts, returns a unified diff of the changes against the files on disk.
+// Nothing is written.
+func (b *Bridge) RenamePreview(ctx context.Context, uri lsp.DocumentURI, line, character int, newName string) (*protocol.ToolCallResult, error) {
+	edit, err := b.renameEdit(ctx, uri, line, character, newName)
+	if err != nil {
+		return protocol.ErrorResult(err.Error()), nil
+	}
+
+	fileEdits, ops, err := edit.fileEdits()
+	if err != nil {
+		return protocol.ErrorResult(err.Error()), nil
+	}
+
+	var sb strings.Builder
+	for _, fe := range fileEdits {
+		before, err := b.readFile(fe.URI)
+		if err != nil {
+			return protocol.ErrorResult(fmt.Sprintf("reading %s: %v", fe.URI, err)), nil
+		}
+		after, err := lsp.ApplyTextEdits(before, fe.Edits)
+		if err != nil {
+			return protocol.ErrorResult(fmt.Sprintf("applying edits to %s: %v", fe.URI, err)), nil
+		}
+		path := fe.URI.Path()
+		sb.WriteString(unifiedDiff("a"+path, "b"+path, before, after))
+	}
+	for _, op := range ops {
+		sb.WriteString(fmt.Sprintf("# %s\n", op))
+	}
+
+	text := sb.String()
+	if text == "" {
+		text = "No changes to apply"
+	}
+	return &protocol.ToolCallResult{
+		Content: []protocol.ContentBlock{protocol.TextContent(text)},
+	}, nil
+}
+
+func (b *Bridge) resyncEditedDocuments(ctx context.Context, edit WorkspaceEdit) error {
+	fileEdits, _, err := edit.fileEdits()
+	if err != nil {
+		return err
+	}
+	for _, fe := range fileEdits {
+		if b.docMgr == nil || !b.docMgr.IsOpen(fe.URI) {
+			continue
+		}
+		if err := b.docMgr.Open(ctx, fe.URI); err != nil {
+			return fmt.Errorf("syncing %s: %w", fe.URI, err)
+		}
+	}
+	return nil
+}
+
+func (b *Bridge) renameEdit(ctx context.Context, uri lsp.DocumentURI, line, character int, newName string) (WorkspaceEdit, error) {
+	var edit WorkspaceEdit
 	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentRename, map[string]any{
 			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
@@ -383,18 +526,13 @@ func (b *Bridge) Rename(ctx context.Context, uri lsp.DocumentURI, line, characte
 		})
 	})
 	if err != nil {
-		return protocol.ErrorResult(err.Error()), nil
+		return edit, err
 	}
 
-	var edit WorkspaceEdit
 	if err := json.Unmarshal(result, &edit); err != nil {
-		return protocol.ErrorResult(fmt.Sprintf("parsing workspace edit: %v", err)), nil
+		return edit, fmt.Errorf("parsing workspace edit: %w", err)
 	}
-
-	text := formatWorkspaceEdit(edit)
-	return &protocol.ToolCallResult{
-		Content: []protocol.ContentBlock{protocol.TextContent(text)},
-	}, nil
+	return edit, nil
 }
 
 func (b *Bridge) WorkspaceSymbols(ctx context.Context, uri lsp.DocumentURI, query string) (*protocol.ToolCallResult, error) {
@@ -430,6 +568,10 @@ func (b *Bridge) Diagnostics(ctx context.Context, uri lsp.DocumentURI) (*protoco
 		return protocol.ErrorResult(err.Error()), nil
 	}
 
+	if b.diagnosticConfig != nil {
+		result = b.diagnosticConfig(b.router().RouteByURI(uri), uri, result)
+	}
+
 	diagnostics := parseDiagnostics(result)
 	if len(diagnostics) == 0 {
 		return &protocol.ToolCallResult{
@@ -444,6 +586,10 @@ func (b *Bridge) Diagnostics(ctx context.Context, uri lsp.DocumentURI) (*protoco
 }
 
 func (b *Bridge) readFile(uri lsp.DocumentURI) (string, error) {
+	return readFile(uri)
+}
+
+func readFile(uri lsp.DocumentURI) (string, error) {
 	path := uri.Path()
 	if path == "" {
 		return "", fmt.Errorf("invalid URI: %s", uri)
@@ -502,68 +648,6 @@ func (b *Bridge) defaultInitParams(uri lsp.DocumentURI) *lsp.InitializeParams {
 	}
 }
 
-func (b *Bridge) inferLanguageID(uri lsp.DocumentURI) string {
-	ext := uri.Extension()
-	switch ext {
-	case ".go":
-		return "go"
-	case ".py":
-		return "python"
-	case ".js":
-		return "javascript"
-	case ".ts":
-		return "typescript"
-	case ".tsx":
-		return "typescriptreact"
-	case ".jsx":
-		return "javascriptreact"
-	case ".rs":
-		return "rust"
-	case ".nix":
-		return "nix"
-	case ".c":
-		return "c"
-	case ".cpp", ".cc", ".cxx":
-		return "cpp"
-	case ".h", ".hpp":
-		return "cpp"
-	case ".java":
-		return "java"
-	case ".rb":
-		return "ruby"
-	case ".php":
-		return "php"
-	case ".cs":
-		return "csharp"
-	case ".swift":
-		return "swift"
-	case ".kt":
-		return "kotlin"
-	case ".scala":
-		return "scala"
-	case ".lua":
-		return "lua"
-	case ".sh", ".bash":
-		return "shellscript"
-	case ".json":
-		return "json"
-	case ".yaml", ".yml":
-		return "yaml"
-	case ".toml":
-		return "toml"
-	case ".xml":
-		return "xml"
-	case ".html":
-		return "html"
-	case ".css":
-		return "css"
-	case ".md":
-		return "markdown"
-	default:
-		return "plaintext"
-	}
-}
-
 // Helper types and functions
 
 type WorkspaceEdit struct {
@@ -796,6 +880,18 @@ func formatWorkspaceEdit(edit WorkspaceEdit) string {
 	return sb.String()
 }
 
+func formatAppliedFiles(uris []lsp.DocumentURI) string {
+	if len(uris) == 0 {
+		return "No changes to apply"
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Applied edits to %d file(s):\n", len(uris)))
+	for _, uri := range uris {
+		sb.WriteString(fmt.Sprintf("  %s\n", uri.Path()))
+	}
+	return sb.String()
+}
+
 func truncate(s string, max int) string {
 	s = strings.ReplaceAll(s, "\n", "\\n")
 	if len(s) <= max {
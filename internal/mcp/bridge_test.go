@@ -0,0 +1,95 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/server"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/internal/subprocess/subprocesstest"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestBridge_InstanceOutlivesTool(t *testing.T) {
+	cfg := &config.Config{LSPs: []config.LSP{{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}}}}
+	router, err := server.NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor, err := subprocesstest.NewExecutor("gopls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := subprocess.NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register("gopls", subprocess.Registration{Flake: "nixpkgs#gopls"})
+	t.Cleanup(pool.StopAll)
+	b := NewBridge(pool, func() *server.Router { return router }, nil, executor)
+
+	path := filepath.Join(t.TempDir(), "main.go")
+	os.WriteFile(path, []byte("package main\n"), 0o644)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	_, err = b.withDocument(ctx, lsp.URIFromPath(path), func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		return nil, nil
+	})
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if state, _ := pool.State("gopls"); state != subprocess.LSPStateRunning {
+		t.Errorf("expected gopls to keep running after the tool returned, got %s", state)
+	}
+}
+
+func TestDocumentManager_Replay(t *testing.T) {
+	cfg := &config.Config{LSPs: []config.LSP{{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}}}}
+	router, err := server.NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor, err := subprocesstest.NewExecutor("gopls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := subprocess.NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register("gopls", subprocess.Registration{Flake: "nixpkgs#gopls"})
+	t.Cleanup(pool.StopAll)
+	routes := func() *server.Router { return router }
+	b := NewBridge(pool, routes, nil, executor)
+	dm := NewDocumentManager(pool, routes, b)
+	b.SetDocumentManager(dm)
+
+	path := filepath.Join(t.TempDir(), "main.go")
+	os.WriteFile(path, []byte("package main\n"), 0o644)
+	if err := dm.Open(context.Background(), lsp.URIFromPath(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted server has none of the documents open.
+	if err := pool.Stop("gopls"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Replay("gopls"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !slices.Contains(executor.Server("gopls").Received(), lsp.MethodTextDocumentDidOpen) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the document reopened, got %v", executor.Server("gopls").Received())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,200 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/protocol"
+)
+
+// maxStoredOutputs bounds how many oversized results are kept for paging;
+// the oldest is dropped first.
+const maxStoredOutputs = 16
+
+// maxSummaryFiles bounds the per-file counts in a summary.
+const maxSummaryFiles = 20
+
+// filePath matches a path followed by a line number, as tool output formats
+// locations, so results can be counted by file.
+var filePath = regexp.MustCompile(`(/[^\s:]+):\d+`)
+
+// outputStore keeps the pages of results too large to return at once, so
+// agents can fetch them with lsp_output_page.
+type outputStore struct {
+	pages map[string][]string
+	order []string
+	next  int
+	mu    sync.Mutex
+}
+
+func newOutputStore() *outputStore {
+	return &outputStore{pages: make(map[string][]string)}
+}
+
+// put stores pages and returns their handle.
+func (s *outputStore) put(pages []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	handle := fmt.Sprintf("out-%d", s.next)
+	s.pages[handle] = pages
+	s.order = append(s.order, handle)
+	if len(s.order) > maxStoredOutputs {
+		delete(s.pages, s.order[0])
+		s.order = s.order[1:]
+	}
+	return handle
+}
+
+// page returns page n (1-based) of a stored result and the page count.
+func (s *outputStore) page(handle string, n int) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pages, ok := s.pages[handle]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown or expired handle %q", handle)
+	}
+	if n < 1 || n > len(pages) {
+		return "", len(pages), fmt.Errorf("page %d out of range (1-%d)", n, len(pages))
+	}
+	return pages[n-1], len(pages), nil
+}
+
+// paginate splits text into pages of at most budget bytes, breaking between
+// lines where it can.
+func paginate(text string, budget int) []string {
+	var pages []string
+	var page strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		for len(line) > budget {
+			if page.Len() > 0 {
+				pages = append(pages, page.String())
+				page.Reset()
+			}
+			pages = append(pages, line[:budget])
+			line = line[budget:]
+		}
+		if page.Len()+len(line) > budget {
+			pages = append(pages, page.String())
+			page.Reset()
+		}
+		page.WriteString(line)
+	}
+	if page.Len() > 0 {
+		pages = append(pages, page.String())
+	}
+	return pages
+}
+
+// summarize describes text that exceeded budget: its size, how many lines
+// mention each file, and its first lines, followed by how to page through
+// the rest.
+func summarize(text string, budget int, handle string, pageCount int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+
+	var s strings.Builder
+	fmt.Fprintf(&s, "Output too large (%d lines, %d bytes; limit %d bytes). Summary:\n", len(lines), len(text), budget)
+
+	counts := make(map[string]int)
+	for _, line := range lines {
+		if m := filePath.FindStringSubmatch(line); m != nil {
+			counts[m[1]]++
+		}
+	}
+	if len(counts) > 0 {
+		files := make([]string, 0, len(counts))
+		for f := range counts {
+			files = append(files, f)
+		}
+		sort.Slice(files, func(i, j int) bool {
+			if counts[files[i]] != counts[files[j]] {
+				return counts[files[i]] > counts[files[j]]
+			}
+			return files[i] < files[j]
+		})
+		fmt.Fprintf(&s, "\nBy file (%d files):\n", len(files))
+		for i, f := range files {
+			if i == maxSummaryFiles {
+				fmt.Fprintf(&s, "  ... and %d more files\n", len(files)-i)
+				break
+			}
+			fmt.Fprintf(&s, "  %s: %d\n", f, counts[f])
+		}
+	}
+
+	footer := fmt.Sprintf("\nFull output: %d pages. Call lsp_output_page with handle %q and page 1-%d to read it.\n", pageCount, handle, pageCount)
+
+	// The first lines fill what the budget leaves, less room for the
+	// headings around them.
+	s.WriteString("\nFirst lines:\n")
+	room := budget - s.Len() - len(footer) - len(fmt.Sprintf("... %d more lines\n", len(lines)))
+	shown := 0
+	for _, line := range lines {
+		if len(line)+1 > room {
+			break
+		}
+		s.WriteString(line)
+		s.WriteByte('\n')
+		room -= len(line) + 1
+		shown++
+	}
+	if shown < len(lines) {
+		fmt.Fprintf(&s, "... %d more lines\n", len(lines)-shown)
+	}
+
+	s.WriteString(footer)
+	return s.String()
+}
+
+// applyBudget replaces a result whose text exceeds budget bytes with a
+// summary, storing the full text for paging. Results within the budget, and
+// every result when budget is 0, are returned as is.
+func (r *ToolRegistry) applyBudget(result *protocol.ToolCallResult, budget int) *protocol.ToolCallResult {
+	if result == nil || budget <= 0 {
+		return result
+	}
+	var text strings.Builder
+	for _, c := range result.Content {
+		if c.Type != "text" {
+			return result
+		}
+		text.WriteString(c.Text)
+	}
+	if text.Len() <= budget {
+		return result
+	}
+
+	pages := paginate(text.String(), budget)
+	handle := r.outputs.put(pages)
+	return &protocol.ToolCallResult{
+		Content: []protocol.ContentBlock{protocol.TextContent(summarize(text.String(), budget, handle, len(pages)))},
+		IsError: result.IsError,
+	}
+}
+
+type outputPageArgs struct {
+	Handle string `json:"handle"`
+	Page   int    `json:"page"`
+}
+
+func (r *ToolRegistry) handleOutputPage(ctx context.Context, args json.RawMessage) (*protocol.ToolCallResult, error) {
+	var a outputPageArgs
+	if err := json.Unmarshal(args, &a); err != nil {
+		return protocol.ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if a.Page == 0 {
+		a.Page = 1
+	}
+	text, count, err := r.outputs.page(a.Handle, a.Page)
+	if err != nil {
+		return protocol.ErrorResult(err.Error()), nil
+	}
+	return &protocol.ToolCallResult{
+		Content: []protocol.ContentBlock{protocol.TextContent(fmt.Sprintf("Page %d of %d:\n%s", a.Page, count, text))},
+	}, nil
+}
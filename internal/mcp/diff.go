@@ -0,0 +1,86 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+const diffContextLines = 3
+
+// unifiedDiff renders the line-level difference between before and after in
+// unified diff format. It returns an empty string when the inputs are equal.
+func unifiedDiff(oldName, newName, before, after string) string {
+	if before == after {
+		return ""
+	}
+
+	ops := lsp.DiffLines(lsp.SplitLines(before), lsp.SplitLines(after))
+
+	// Line numbers (1-based) in each file at the start of every op.
+	oldAt := make([]int, len(ops)+1)
+	newAt := make([]int, len(ops)+1)
+	oldAt[0], newAt[0] = 1, 1
+	var changes []int
+	for i, op := range ops {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		if op.Kind != lsp.DiffInsert {
+			oldAt[i+1]++
+		}
+		if op.Kind != lsp.DiffDelete {
+			newAt[i+1]++
+		}
+		if op.Kind != lsp.DiffEqual {
+			changes = append(changes, i)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+
+	for c := 0; c < len(changes); {
+		first, last := changes[c], changes[c]
+		c++
+		// Changes separated by no more than two contexts' worth of equal
+		// lines share a hunk.
+		for c < len(changes) && changes[c]-last <= 2*diffContextLines+1 {
+			last = changes[c]
+			c++
+		}
+
+		start := max(first-diffContextLines, 0)
+		end := min(last+1+diffContextLines, len(ops))
+
+		oldCount := oldAt[end] - oldAt[start]
+		newCount := newAt[end] - newAt[start]
+		sb.WriteString(fmt.Sprintf("@@ -%s +%s @@\n",
+			hunkRange(oldAt[start], oldCount), hunkRange(newAt[start], newCount)))
+
+		for _, op := range ops[start:end] {
+			prefix := " "
+			switch op.Kind {
+			case lsp.DiffDelete:
+				prefix = "-"
+			case lsp.DiffInsert:
+				prefix = "+"
+			}
+			sb.WriteString(prefix + op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
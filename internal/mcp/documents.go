@@ -16,17 +16,19 @@ type openDoc struct {
 	langID  string
 	version int
 	lspName string
+	content string
 }
 
 type DocumentManager struct {
-	pool   *subprocess.Pool
-	router *server.Router
-	bridge *Bridge
-	docs   map[lsp.DocumentURI]*openDoc
-	mu     sync.RWMutex
+	pool          *subprocess.Pool
+	router        func() *server.Router
+	bridge        *Bridge
+	docs          map[lsp.DocumentURI]*openDoc
+	externalOwner func(lsp.DocumentURI) bool
+	mu            sync.RWMutex
 }
 
-func NewDocumentManager(pool *subprocess.Pool, router *server.Router, bridge *Bridge) *DocumentManager {
+func NewDocumentManager(pool *subprocess.Pool, router func() *server.Router, bridge *Bridge) *DocumentManager {
 	return &DocumentManager{
 		pool:   pool,
 		router: router,
@@ -35,19 +37,32 @@ func NewDocumentManager(pool *subprocess.Pool, router *server.Router, bridge *Br
 	}
 }
 
+// SetExternalOwner registers a check for documents another frontend sharing
+// the pool (e.g. an editor's LSP session) already has open. Those documents
+// are left alone rather than being opened a second time on the backend.
+func (dm *DocumentManager) SetExternalOwner(owns func(lsp.DocumentURI) bool) {
+	dm.externalOwner = owns
+}
+
 func (dm *DocumentManager) Open(ctx context.Context, uri lsp.DocumentURI) error {
-	lspName := dm.router.RouteByURI(uri)
+	lspName := dm.router().RouteByURI(uri)
 	if lspName == "" {
 		return fmt.Errorf("no LSP configured for %s", uri)
 	}
 
+	if dm.externalOwner != nil && dm.externalOwner(uri) {
+		return nil
+	}
+
 	content, err := readFileContent(uri)
 	if err != nil {
 		return fmt.Errorf("reading file: %w", err)
 	}
 
+	// Like withDocument, the instance isn't started under the tool's
+	// context, which ends when the tool returns.
 	initParams := dm.bridge.defaultInitParams(uri)
-	inst, err := dm.pool.GetOrStart(ctx, lspName, initParams)
+	inst, err := dm.pool.GetOrStart(context.WithoutCancel(ctx), lspName, initParams)
 	if err != nil {
 		return fmt.Errorf("starting LSP %s: %w", lspName, err)
 	}
@@ -57,13 +72,15 @@ func (dm *DocumentManager) Open(ctx context.Context, uri lsp.DocumentURI) error
 		return fmt.Errorf("adding workspace folder: %w", err)
 	}
 
-	langID := dm.bridge.inferLanguageID(uri)
+	langID := uri.LanguageID()
 
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 
 	if existing, ok := dm.docs[uri]; ok {
 		existing.version++
+		existing.content = content
+		dm.bridge.responses.Purge(uri)
 		return inst.Notify(lsp.MethodTextDocumentDidChange, lsp.DidChangeTextDocumentParams{
 			TextDocument: lsp.VersionedTextDocumentIdentifier{
 				TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri},
@@ -91,6 +108,7 @@ func (dm *DocumentManager) Open(ctx context.Context, uri lsp.DocumentURI) error
 		langID:  langID,
 		version: 1,
 		lspName: lspName,
+		content: content,
 	}
 
 	return nil
@@ -105,6 +123,7 @@ func (dm *DocumentManager) Close(uri lsp.DocumentURI) error {
 	}
 	delete(dm.docs, uri)
 	dm.mu.Unlock()
+	dm.bridge.responses.Purge(uri)
 
 	inst, ok := dm.pool.Get(doc.lspName)
 	if !ok {
@@ -124,6 +143,7 @@ func (dm *DocumentManager) CloseAll() {
 	}
 	dm.docs = make(map[lsp.DocumentURI]*openDoc)
 	dm.mu.Unlock()
+	dm.bridge.responses.PurgeAll()
 
 	for uri, doc := range docs {
 		inst, ok := dm.pool.Get(doc.lspName)
@@ -136,6 +156,39 @@ func (dm *DocumentManager) CloseAll() {
 	}
 }
 
+// Replay sends lspName didOpen for the documents opened on it, at the
+// version and with the content last synced, after the pool has restarted it.
+func (dm *DocumentManager) Replay(lspName string) error {
+	inst, ok := dm.pool.Get(lspName)
+	if !ok {
+		return nil
+	}
+
+	dm.mu.RLock()
+	var docs []openDoc
+	for _, doc := range dm.docs {
+		if doc.lspName == lspName {
+			docs = append(docs, *doc)
+		}
+	}
+	dm.mu.RUnlock()
+
+	for _, doc := range docs {
+		dm.bridge.responses.Purge(doc.uri)
+		if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
+			TextDocument: lsp.TextDocumentItem{
+				URI:        doc.uri,
+				LanguageID: doc.langID,
+				Version:    doc.version,
+				Text:       doc.content,
+			},
+		}); err != nil {
+			return fmt.Errorf("opening %s: %w", doc.uri, err)
+		}
+	}
+	return nil
+}
+
 func (dm *DocumentManager) IsOpen(uri lsp.DocumentURI) bool {
 	dm.mu.RLock()
 	defer dm.mu.RUnlock()
@@ -143,6 +196,18 @@ func (dm *DocumentManager) IsOpen(uri lsp.DocumentURI) bool {
 	return ok
 }
 
+// Snapshot returns the version and content last synced to the server for an
+// open document.
+func (dm *DocumentManager) Snapshot(uri lsp.DocumentURI) (int, string, bool) {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	doc, ok := dm.docs[uri]
+	if !ok {
+		return 0, "", false
+	}
+	return doc.version, doc.content, true
+}
+
 // OpenURI implements transport.DocumentLifecycle.
 func (dm *DocumentManager) OpenURI(ctx context.Context, uri string) error {
 	return dm.Open(ctx, lsp.DocumentURI(uri))
@@ -0,0 +1,293 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+type textDocumentEdit struct {
+	TextDocument struct {
+		URI     lsp.DocumentURI `json:"uri"`
+		Version *int            `json:"version"`
+	} `json:"textDocument"`
+	Edits []lsp.TextEdit `json:"edits"`
+}
+
+type resourceOperation struct {
+	Kind   string          `json:"kind"`
+	URI    lsp.DocumentURI `json:"uri,omitempty"`
+	OldURI lsp.DocumentURI `json:"oldUri,omitempty"`
+	NewURI lsp.DocumentURI `json:"newUri,omitempty"`
+}
+
+// errStaleEdit reports that a document changed after the server computed an
+// edit against it.
+var errStaleEdit = errors.New("stale edit")
+
+// fileEdit is the set of text edits a WorkspaceEdit makes to one document,
+// along with the version the server computed them against (if any).
+type fileEdit struct {
+	URI     lsp.DocumentURI
+	Version *int
+	Edits   []lsp.TextEdit
+}
+
+// fileEdits flattens both the `changes` and `documentChanges` forms of a
+// WorkspaceEdit into per-file text edits. Resource operations (create,
+// rename, delete) are returned as human-readable descriptions.
+func (e WorkspaceEdit) fileEdits() ([]fileEdit, []string, error) {
+	var edits []fileEdit
+	var ops []string
+
+	if len(e.DocumentChanges) > 0 && string(e.DocumentChanges) != "null" {
+		var changes []json.RawMessage
+		if err := json.Unmarshal(e.DocumentChanges, &changes); err != nil {
+			return nil, nil, fmt.Errorf("parsing documentChanges: %w", err)
+		}
+
+		for _, raw := range changes {
+			var op resourceOperation
+			if err := json.Unmarshal(raw, &op); err == nil && op.Kind != "" {
+				switch op.Kind {
+				case "create":
+					ops = append(ops, fmt.Sprintf("create %s", op.URI.Path()))
+				case "rename":
+					ops = append(ops, fmt.Sprintf("rename %s -> %s", op.OldURI.Path(), op.NewURI.Path()))
+				case "delete":
+					ops = append(ops, fmt.Sprintf("delete %s", op.URI.Path()))
+				}
+				continue
+			}
+
+			var tde textDocumentEdit
+			if err := json.Unmarshal(raw, &tde); err != nil {
+				return nil, nil, fmt.Errorf("parsing text document edit: %w", err)
+			}
+			edits = append(edits, fileEdit{
+				URI:     tde.TextDocument.URI,
+				Version: tde.TextDocument.Version,
+				Edits:   tde.Edits,
+			})
+		}
+
+		return edits, ops, nil
+	}
+
+	uris := make([]string, 0, len(e.Changes))
+	for uri := range e.Changes {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		edits = append(edits, fileEdit{
+			URI:   lsp.DocumentURI(uri),
+			Edits: e.Changes[uri],
+		})
+	}
+
+	return edits, ops, nil
+}
+
+// editDocuments is what a workspace edit is checked against: the version
+// and text last synced to the servers of each open document.
+type editDocuments interface {
+	Snapshot(uri lsp.DocumentURI) (version int, text string, open bool)
+}
+
+// OpenDocuments are the documents an editor has open, by URI, for checking
+// a workspace edit applied from outside an MCP session.
+type OpenDocuments map[lsp.DocumentURI]OpenDocument
+
+// OpenDocument is the version and text of an open document.
+type OpenDocument struct {
+	Version int
+	Text    string
+}
+
+func (d OpenDocuments) Snapshot(uri lsp.DocumentURI) (int, string, bool) {
+	doc, ok := d[uri]
+	return doc.Version, doc.Text, ok
+}
+
+// ApplyWorkspaceEdit writes edit to disk as the MCP tools do, checking it
+// against docs, the documents open in the editor (see applyWorkspaceEdit).
+// It returns the files written.
+func ApplyWorkspaceEdit(edit WorkspaceEdit, docs OpenDocuments) ([]lsp.DocumentURI, error) {
+	return writeWorkspaceEdit(edit, docs)
+}
+
+// applyWorkspaceEdit writes a WorkspaceEdit to disk and resyncs the documents
+// it changed that the server has open. Edits are applied one at a time, and
+// each is refused with errStaleEdit if it no longer matches the documents
+// (see writeWorkspaceEdit).
+func (b *Bridge) applyWorkspaceEdit(ctx context.Context, edit WorkspaceEdit) ([]lsp.DocumentURI, error) {
+	b.editMu.Lock()
+	defer b.editMu.Unlock()
+
+	var docs editDocuments
+	if b.docMgr != nil {
+		docs = b.docMgr
+	}
+	applied, err := writeWorkspaceEdit(edit, docs)
+	if err != nil {
+		return applied, err
+	}
+
+	for _, uri := range applied {
+		if b.docMgr != nil && b.docMgr.IsOpen(uri) {
+			if err := b.docMgr.Open(ctx, uri); err != nil {
+				return applied, fmt.Errorf("syncing %s: %w", uri, err)
+			}
+		}
+	}
+	return applied, nil
+}
+
+// writeWorkspaceEdit writes edit to disk after checking every document it
+// changes with checkEditVersion, refusing the whole edit if any is stale.
+// Each file's new content is staged next to it, the checks are repeated
+// against what is on disk once everything is staged, and only then are the
+// staged files renamed into place, so a file changed while the edit was
+// computed or staged isn't overwritten. docs may be nil.
+func writeWorkspaceEdit(edit WorkspaceEdit, docs editDocuments) ([]lsp.DocumentURI, error) {
+	fileEdits, ops, err := edit.fileEdits()
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) > 0 {
+		return nil, fmt.Errorf("resource operations are not supported: %s", strings.Join(ops, ", "))
+	}
+
+	type pendingWrite struct {
+		edit    fileEdit
+		before  string
+		content string
+		staged  string
+	}
+
+	writes := make([]*pendingWrite, 0, len(fileEdits))
+	defer func() {
+		for _, w := range writes {
+			if w.staged != "" {
+				os.Remove(w.staged)
+			}
+		}
+	}()
+
+	for _, fe := range fileEdits {
+		before, err := readFile(fe.URI)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", fe.URI, err)
+		}
+
+		if err := checkEditVersion(docs, fe, before); err != nil {
+			return nil, err
+		}
+
+		after, err := lsp.ApplyTextEdits(before, fe.Edits)
+		if err != nil {
+			return nil, fmt.Errorf("applying edits to %s: %w", fe.URI, err)
+		}
+		writes = append(writes, &pendingWrite{edit: fe, before: before, content: after})
+	}
+
+	for _, w := range writes {
+		staged, err := stageFile(w.edit.URI.Path(), w.content)
+		if err != nil {
+			return nil, fmt.Errorf("writing %s: %w", w.edit.URI, err)
+		}
+		w.staged = staged
+	}
+
+	for _, w := range writes {
+		current, err := readFile(w.edit.URI)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", w.edit.URI, err)
+		}
+		if current != w.before {
+			return nil, fmt.Errorf("%w: %s changed on disk while the edit was applied", errStaleEdit, w.edit.URI)
+		}
+		if err := checkEditVersion(docs, w.edit, current); err != nil {
+			return nil, err
+		}
+	}
+
+	var applied []lsp.DocumentURI
+	for _, w := range writes {
+		if err := os.Rename(w.staged, w.edit.URI.Path()); err != nil {
+			return applied, fmt.Errorf("writing %s: %w", w.edit.URI, err)
+		}
+		w.staged = ""
+		applied = append(applied, w.edit.URI)
+	}
+	return applied, nil
+}
+
+// stageFile writes content to a new file beside path, with path's
+// permissions, to be renamed over it.
+func stageFile(path, content string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".lux-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Chmod(info.Mode().Perm()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// checkEditVersion refuses fe if its document is open at a version other
+// than the one fe was computed against, or if the open document's text
+// isn't what is on disk. Servers version edits to documents that aren't
+// open with null, or 0 as gopls does, and those are only checked against
+// the disk by writeWorkspaceEdit; any other version means the document was
+// open when the edit was computed and may have changed since it was closed.
+func checkEditVersion(docs editDocuments, fe fileEdit, onDisk string) error {
+	var version int
+	var synced string
+	var open bool
+	if docs != nil {
+		version, synced, open = docs.Snapshot(fe.URI)
+	}
+
+	if fe.Version != nil {
+		if !open && *fe.Version != 0 {
+			return fmt.Errorf("%w: %s is no longer open (edit computed against version %d)",
+				errStaleEdit, fe.URI, *fe.Version)
+		}
+		if open && *fe.Version != version {
+			return fmt.Errorf("%w: %s is at version %d, edit computed against version %d",
+				errStaleEdit, fe.URI, version, *fe.Version)
+		}
+	}
+
+	if open && synced != onDisk {
+		return fmt.Errorf("%w: %s changed on disk since version %d", errStaleEdit, fe.URI, version)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nK\nl\n"
+
+	want := `--- a/x
++++ b/x
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,5 +8,5 @@
+ h
+ i
+ j
+-k
++K
+ l
+`
+	if got := unifiedDiff("a/x", "b/x", before, after); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if got := unifiedDiff("a/x", "b/x", before, before); got != "" {
+		t.Errorf("expected empty diff for identical input, got %q", got)
+	}
+}
+
+func TestWorkspaceEditFileEdits(t *testing.T) {
+	var edit WorkspaceEdit
+	raw := `{"documentChanges": [
+		{"textDocument": {"uri": "file:///a.go", "version": 3}, "edits": [{"range": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 1}}, "newText": "x"}]},
+		{"kind": "rename", "oldUri": "file:///a.go", "newUri": "file:///b.go"}
+	]}`
+	if err := json.Unmarshal([]byte(raw), &edit); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	files, ops, err := edit.fileEdits()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 1 || files[0].URI != "file:///a.go" || len(files[0].Edits) != 1 {
+		t.Fatalf("unexpected file edits: %+v", files)
+	}
+	if files[0].Version == nil || *files[0].Version != 3 {
+		t.Errorf("expected version 3, got %v", files[0].Version)
+	}
+	if len(ops) != 1 || ops[0] != "rename /a.go -> /b.go" {
+		t.Errorf("unexpected ops: %v", ops)
+	}
+}
+
+func TestCheckEditVersion(t *testing.T) {
+	dm := &DocumentManager{docs: map[lsp.DocumentURI]*openDoc{
+		"file:///a.go": {uri: "file:///a.go", version: 2, content: "package a\n"},
+	}}
+
+	version := func(v int) *int { return &v }
+
+	tests := []struct {
+		name   string
+		edit   fileEdit
+		onDisk string
+		stale  bool
+	}{
+		{"matching version", fileEdit{URI: "file:///a.go", Version: version(2)}, "package a\n", false},
+		{"unversioned", fileEdit{URI: "file:///a.go"}, "package a\n", false},
+		{"version mismatch", fileEdit{URI: "file:///a.go", Version: version(1)}, "package a\n", true},
+		{"changed on disk", fileEdit{URI: "file:///a.go", Version: version(2)}, "package b\n", true},
+		{"versioned but no longer open", fileEdit{URI: "file:///b.go", Version: version(1)}, "", true},
+		{"version 0 and not open", fileEdit{URI: "file:///b.go", Version: version(0)}, "", false},
+		{"unversioned and not open", fileEdit{URI: "file:///b.go"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkEditVersion(dm, tt.edit, tt.onDisk)
+			if got := errors.Is(err, errStaleEdit); got != tt.stale {
+				t.Errorf("expected stale=%v, got err=%v", tt.stale, err)
+			}
+		})
+	}
+}
+
+func TestApplyWorkspaceEdit(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	if err := os.WriteFile(a, []byte("package a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	uri := lsp.URIFromPath(a)
+	b := &Bridge{}
+
+	edit := WorkspaceEdit{Changes: map[string][]lsp.TextEdit{string(uri): {{
+		Range:   lsp.Range{Start: lsp.Position{Line: 0, Character: 8}, End: lsp.Position{Line: 0, Character: 9}},
+		NewText: "b",
+	}}}}
+	applied, err := b.applyWorkspaceEdit(context.Background(), edit)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("expected one file applied, got %v, %v", applied, err)
+	}
+
+	data, _ := os.ReadFile(a)
+	if string(data) != "package b\n" {
+		t.Errorf("expected the edit written, got %q", data)
+	}
+	if info, _ := os.Stat(a); info.Mode().Perm() != 0600 {
+		t.Errorf("expected the file's permissions kept, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected no staged files left behind, got %v", entries)
+	}
+}
+
+func TestApplyWorkspaceEdit_OpenDocuments(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	if err := os.WriteFile(a, []byte("package a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	uri := lsp.URIFromPath(a)
+
+	edit := WorkspaceEdit{DocumentChanges: json.RawMessage(`[{
+		"textDocument": {"uri": "` + string(uri) + `", "version": 3},
+		"edits": [{"range": {"start": {"line": 0, "character": 8}, "end": {"line": 0, "character": 9}}, "newText": "b"}]
+	}]`)}
+
+	docs := OpenDocuments{uri: {Version: 4, Text: "package a\n"}}
+	if _, err := ApplyWorkspaceEdit(edit, docs); !errors.Is(err, errStaleEdit) {
+		t.Fatalf("expected an edit against an older version refused, got %v", err)
+	}
+	if data, _ := os.ReadFile(a); string(data) != "package a\n" {
+		t.Fatalf("expected the file untouched, got %q", data)
+	}
+
+	docs[uri] = OpenDocument{Version: 3, Text: "package a\n"}
+	if applied, err := ApplyWorkspaceEdit(edit, docs); err != nil || len(applied) != 1 {
+		t.Fatalf("expected one file applied, got %v, %v", applied, err)
+	}
+	if data, _ := os.ReadFile(a); string(data) != "package b\n" {
+		t.Errorf("expected the edit written, got %q", data)
+	}
+}
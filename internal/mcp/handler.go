@@ -6,6 +6,7 @@ import (
 
 	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
 	"github.com/amarbel-llc/go-lib-mcp/protocol"
+	"github.com/amarbel-llc/lux/internal/buildinfo"
 )
 
 type Handler struct {
@@ -65,7 +66,7 @@ func (h *Handler) handleInitialize(ctx context.Context, msg *jsonrpc.Message) (*
 		},
 		ServerInfo: protocol.Implementation{
 			Name:    "lux",
-			Version: "0.1.0",
+			Version: buildinfo.Version,
 		},
 	}
 
@@ -10,11 +10,12 @@ import (
 
 	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
 	"github.com/amarbel-llc/go-lib-mcp/transport"
-	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/formatter"
 	"github.com/amarbel-llc/lux/internal/lsp"
 	"github.com/amarbel-llc/lux/internal/server"
+	"github.com/amarbel-llc/lux/internal/stats"
 	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
 )
 
 type Server struct {
@@ -22,15 +23,18 @@ type Server struct {
 	transport  transport.Transport
 	handler    *Handler
 	pool       *subprocess.Pool
-	router     *server.Router
+	router     func() *server.Router
 	bridge     *Bridge
 	docMgr     *DocumentManager
 	diagStore  *DiagnosticsStore
 	tools      *ToolRegistry
 	resources  *ResourceRegistry
 	prompts    *PromptRegistry
+	ownsPool   bool
+	usage      *stats.Recorder
 	done       chan struct{}
 	wg         sync.WaitGroup
+	closeOnce  sync.Once
 }
 
 func New(cfg *config.Config, t transport.Transport) (*Server, error) {
@@ -38,31 +42,85 @@ func New(cfg *config.Config, t transport.Transport) (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("creating router: %w", err)
 	}
+	loadOwnerRoutes(router)
 
 	s := &Server{
 		cfg:       cfg,
 		transport: t,
-		router:    router,
+		router:    func() *server.Router { return router },
+		ownsPool:  true,
 		done:      make(chan struct{}),
 	}
 
-	executor := subprocess.NewNixExecutor()
+	executor := subprocess.NewExecutor(cfg.ExecutorKind(), config.StateDir())
 	s.pool = subprocess.NewPool(executor, func(lspName string) jsonrpc.Handler {
-		return s.lspNotificationHandler()
+		return s.lspNotificationHandler(lspName)
 	})
 
+	maxFailures, window := cfg.RestartBudget()
+	s.pool.SetRestartPolicy(subprocess.RestartPolicy{MaxFailures: maxFailures, Window: window})
+
+	retries, backoff := cfg.AutoRestartPolicy()
+	s.pool.SetAutoRestart(subprocess.AutoRestart{
+		MaxRetries:     retries,
+		InitialBackoff: backoff,
+		MaxBackoff:     config.MaxRestartBackoff,
+	})
+
+	if cfg.UsageStats {
+		s.usage = stats.NewRecorder(stats.DefaultPath())
+		s.pool.SetCallHandler(s.usage.Record)
+	}
+
 	for _, l := range cfg.LSPs {
-		// Convert config.CapabilityOverride to subprocess.CapabilityOverride
-		var capOverrides *subprocess.CapabilityOverride
-		if l.Capabilities != nil {
-			capOverrides = &subprocess.CapabilityOverride{
-				Disable: l.Capabilities.Disable,
-				Enable:  l.Capabilities.Enable,
-			}
+		r, err := server.NewRegistration(l)
+		if err == nil {
+			err = s.pool.Register(l.Name, r)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", l.Name, err)
 		}
-		s.pool.Register(l.Name, l.Flake, l.Binary, l.Args, l.Env, l.InitOptions, l.Settings, l.SettingsWireKey(), capOverrides)
 	}
 
+	s.setup(executor)
+	return s, nil
+}
+
+// Host is an LSP session that shares its backend pool with an MCP server
+// running in the same process.
+type Host interface {
+	Pool() *subprocess.Pool
+	Executor() subprocess.Executor
+	// Router returns the host's current router, which it replaces when it
+	// reloads its config.
+	Router() *server.Router
+	// IsOpenInEditor reports whether the LSP client currently has uri open,
+	// in which case the client owns its document state on the backends.
+	IsOpenInEditor(uri lsp.DocumentURI) bool
+}
+
+// NewShared creates an MCP server that uses host's pool and routes documents
+// as host does, instead of starting its own backends. The host remains
+// responsible for stopping the pool.
+func NewShared(cfg *config.Config, t transport.Transport, host Host) (*Server, error) {
+	s := &Server{
+		cfg:       cfg,
+		transport: t,
+		router:    host.Router,
+		pool:      host.Pool(),
+		done:      make(chan struct{}),
+	}
+
+	s.pool.AddHandlerFactory(func(lspName string) jsonrpc.Handler {
+		return s.lspNotificationHandler(lspName)
+	})
+
+	s.setup(host.Executor())
+	s.docMgr.SetExternalOwner(host.IsOpenInEditor)
+	return s, nil
+}
+
+func (s *Server) setup(executor subprocess.Executor) {
 	var fmtRouter *formatter.Router
 	fmtCfg, err := config.LoadMergedFormatters()
 	if err != nil {
@@ -78,18 +136,31 @@ func New(cfg *config.Config, t transport.Transport) (*Server, error) {
 	s.bridge = NewBridge(s.pool, s.router, fmtRouter, executor)
 	s.docMgr = NewDocumentManager(s.pool, s.router, s.bridge)
 	s.bridge.SetDocumentManager(s.docMgr)
+	s.bridge.SetDiagnosticConfig(s.applyDiagnosticConfig)
+	s.pool.AddHooks(subprocess.Hooks{OnRestart: s.onRestart})
 	s.diagStore = NewDiagnosticsStore()
-	s.tools = NewToolRegistry(s.bridge)
-	s.resources = NewResourceRegistry(s.pool, s.bridge, cfg, s.diagStore)
+	s.tools = NewToolRegistry(s.bridge, s.cfg)
+	s.resources = NewResourceRegistry(s.pool, s.bridge, s.cfg, s.diagStore)
 	s.prompts = NewPromptRegistry()
 	s.handler = NewHandler(s)
-	return s, nil
 }
 
+// dispatchConcurrency bounds how many messages Run handles at once.
+const dispatchConcurrency = 32
+
 func (s *Server) Run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	workers := make(chan struct{}, dispatchConcurrency)
+
+	// The transport read below blocks, so shut down from here when a host
+	// process cancels the context.
+	go func() {
+		<-ctx.Done()
+		s.gracefulShutdown()
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -112,9 +183,22 @@ func (s *Server) Run(ctx context.Context) error {
 			return fmt.Errorf("reading message: %w", err)
 		}
 
+		// A message waits for a free worker before the next one is read, so
+		// a storm of tool calls leaves the rest unread in the transport
+		// rather than each on a goroutine.
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+			s.gracefulShutdown()
+			return ctx.Err()
+		case <-s.done:
+			s.gracefulShutdown()
+			return nil
+		}
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
+			defer func() { <-workers }()
 			s.handleMessage(ctx, msg)
 		}()
 	}
@@ -136,26 +220,85 @@ func (s *Server) handleMessage(ctx context.Context, msg *jsonrpc.Message) {
 }
 
 func (s *Server) gracefulShutdown() {
-	// Wait for all in-flight requests to complete
-	s.wg.Wait()
-	s.docMgr.CloseAll()
-	s.pool.StopAll()
-	s.transport.Close()
+	s.closeOnce.Do(func() {
+		// Wait for all in-flight requests to complete
+		s.wg.Wait()
+		s.docMgr.CloseAll()
+		if s.ownsPool {
+			s.pool.StopAll()
+		}
+		if s.usage != nil {
+			if err := s.usage.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not save usage stats: %v\n", err)
+			}
+		}
+		s.transport.Close()
+	})
 }
 
 func (s *Server) Close() {
 	close(s.done)
 }
 
+// onRestart replays the documents this session has open to a server the
+// pool restarted after it crashed.
+func (s *Server) onRestart(e subprocess.LifecycleEvent) {
+	if err := s.docMgr.Replay(e.Name); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: replaying open documents to %s: %v\n", e.Name, err)
+	}
+}
+
+// loadOwnerRoutes applies the .lux-routes file of the current directory's
+// workspace, if it has one.
+func loadOwnerRoutes(router *server.Router) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	if err := router.LoadOwnerRoutes(config.ResolveWorkspace(cwd)); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
+
+// applyDiagnosticConfig is server.ApplyDiagnosticConfig with lspName's
+// config.
+func (s *Server) applyDiagnosticConfig(lspName string, uri lsp.DocumentURI, raw json.RawMessage) json.RawMessage {
+	return server.ApplyDiagnosticConfig(s.cfg.FindLSP(lspName), uri, raw)
+}
+
 func (s *Server) DocumentManager() *DocumentManager {
 	return s.docMgr
 }
 
-func (s *Server) lspNotificationHandler() jsonrpc.Handler {
+func (s *Server) lspNotificationHandler(lspName string) jsonrpc.Handler {
 	return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
-		if msg.Method == "textDocument/publishDiagnostics" && msg.Params != nil {
+		if msg.Method == lsp.MethodProgress {
+			var params struct {
+				Token json.RawMessage `json:"token"`
+				Value struct {
+					Message string `json:"message"`
+				} `json:"value"`
+			}
+			if err := json.Unmarshal(msg.Params, &params); err == nil {
+				s.bridge.recordProgress(lspName, params.Token, params.Value.Message)
+			}
+		}
+
+		// Backends block on responses to their requests (e.g. progress
+		// token creation), so always answer them.
+		if msg.IsRequest() {
+			return jsonrpc.NewResponse(*msg.ID, nil)
+		}
+
+		if msg.Method == lsp.MethodTextDocumentPublishDiagnostics && msg.Params != nil {
+			var target struct {
+				URI lsp.DocumentURI `json:"uri"`
+			}
+			json.Unmarshal(msg.Params, &target)
+			raw := s.applyDiagnosticConfig(lspName, target.URI, msg.Params)
+
 			var params lsp.PublishDiagnosticsParams
-			if err := json.Unmarshal(msg.Params, &params); err != nil {
+			if err := json.Unmarshal(raw, &params); err != nil {
 				return nil, nil
 			}
 
@@ -10,7 +10,10 @@ import (
 	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
 	"github.com/amarbel-llc/go-lib-mcp/protocol"
 	"github.com/amarbel-llc/go-lib-mcp/transport"
-	"github.com/amarbel-llc/lux/internal/config"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/server"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
 )
 
 func TestMCPInitialize(t *testing.T) {
@@ -73,8 +76,11 @@ func TestMCPToolsList(t *testing.T) {
 		"lsp_document_symbols",
 		"lsp_code_action",
 		"lsp_rename",
+		"lsp_rename_preview",
 		"lsp_workspace_symbols",
 		"lsp_diagnostics",
+		"lsp_run_tests",
+		"lsp_output_page",
 	}
 
 	if len(result.Tools) != len(expectedTools) {
@@ -196,3 +202,42 @@ func parseResponses(t *testing.T, data string) []*jsonrpc.Message {
 
 	return responses
 }
+
+// fakeHost is a Host whose router a test can replace, as a reload does.
+type fakeHost struct {
+	pool   *subprocess.Pool
+	router *server.Router
+}
+
+func (h *fakeHost) Pool() *subprocess.Pool                  { return h.pool }
+func (h *fakeHost) Executor() subprocess.Executor           { return nil }
+func (h *fakeHost) Router() *server.Router                  { return h.router }
+func (h *fakeHost) IsOpenInEditor(uri lsp.DocumentURI) bool { return false }
+
+func TestNewShared_FollowsHostRouter(t *testing.T) {
+	newRouter := func(name string) *server.Router {
+		r, err := server.NewRouter(&config.Config{LSPs: []config.LSP{{Name: name, Flake: "nixpkgs#" + name, Extensions: []string{"go"}}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	host := &fakeHost{
+		pool:   subprocess.NewPool(nil, func(string) jsonrpc.Handler { return nil }),
+		router: newRouter("gopls"),
+	}
+
+	srv, err := NewShared(&config.Config{}, transport.NewStdio(strings.NewReader(""), &bytes.Buffer{}), host)
+	if err != nil {
+		t.Fatalf("NewShared: %v", err)
+	}
+
+	host.router = newRouter("golangci-lint")
+	uri := lsp.DocumentURI("file:///src/main.go")
+	if got := srv.bridge.router().RouteByURI(uri); got != "golangci-lint" {
+		t.Errorf("expected the bridge to route with the host's new router, got %q", got)
+	}
+	if got := srv.docMgr.router().RouteByURI(uri); got != "golangci-lint" {
+		t.Errorf("expected documents to route with the host's new router, got %q", got)
+	}
+}
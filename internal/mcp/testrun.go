@@ -0,0 +1,353 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/protocol"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+const (
+	goplsRunTestsCommand     = "gopls.run_tests"
+	rustAnalyzerRunnables    = "experimental/runnables"
+	maxTestOutputLinesInTool = 40
+)
+
+type TestStatus string
+
+const (
+	TestStatusPass TestStatus = "pass"
+	TestStatusFail TestStatus = "fail"
+	TestStatusSkip TestStatus = "skip"
+)
+
+type TestOutcome struct {
+	Name   string
+	Status TestStatus
+}
+
+// outputCapture collects the $/progress text a backend reports for one test
+// run, identified by the workDoneToken lux passed with the run, so concurrent
+// runs on the same server each see only their own output.
+type outputCapture struct {
+	token string
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func (c *outputCapture) add(text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		c.lines = append(c.lines, line)
+	}
+}
+
+func (c *outputCapture) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.Join(c.lines, "\n")
+}
+
+// captureKey identifies a run's capture by server and progress token.
+func captureKey(lspName, token string) string {
+	return lspName + "\x00" + token
+}
+
+func (b *Bridge) startCapture(lspName string) *outputCapture {
+	c := &outputCapture{token: fmt.Sprintf("lux-test-%d", b.captureSeq.Add(1))}
+	b.captureMu.Lock()
+	defer b.captureMu.Unlock()
+	b.captures[captureKey(lspName, c.token)] = c
+	return c
+}
+
+func (b *Bridge) stopCapture(lspName string, c *outputCapture) {
+	b.captureMu.Lock()
+	defer b.captureMu.Unlock()
+	delete(b.captures, captureKey(lspName, c.token))
+}
+
+// recordProgress adds the message of a $/progress notification from lspName
+// to the run it reports on, if that run is being captured.
+func (b *Bridge) recordProgress(lspName string, token json.RawMessage, text string) {
+	var key string
+	if err := json.Unmarshal(token, &key); err != nil || text == "" {
+		return
+	}
+	b.captureMu.Lock()
+	c := b.captures[captureKey(lspName, key)]
+	b.captureMu.Unlock()
+	if c != nil {
+		c.add(text)
+	}
+}
+
+// RunTests runs the test enclosing the given position using whichever
+// test-running convention the routed server supports.
+func (b *Bridge) RunTests(ctx context.Context, uri lsp.DocumentURI, line, character int) (*protocol.ToolCallResult, error) {
+	lspName := b.router().RouteByURI(uri)
+	if lspName == "" {
+		return protocol.ErrorResult(fmt.Sprintf("no LSP configured for %s", uri)), nil
+	}
+
+	// Start the server (and open the document) before inspecting capabilities.
+	if _, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		return nil, nil
+	}); err != nil {
+		return protocol.ErrorResult(err.Error()), nil
+	}
+
+	inst, ok := b.pool.Get(lspName)
+	if !ok {
+		return protocol.ErrorResult(fmt.Sprintf("unknown LSP: %s", lspName)), nil
+	}
+
+	if supportsCommand(inst.Capabilities, goplsRunTestsCommand) {
+		return b.runGoplsTests(ctx, lspName, uri, line)
+	}
+
+	return b.runRustAnalyzerTests(ctx, uri, line, character)
+}
+
+func supportsCommand(caps *lsp.ServerCapabilities, command string) bool {
+	if caps == nil || caps.ExecuteCommandProvider == nil {
+		return false
+	}
+	for _, c := range caps.ExecuteCommandProvider.Commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bridge) runGoplsTests(ctx context.Context, lspName string, uri lsp.DocumentURI, line int) (*protocol.ToolCallResult, error) {
+	symbols, err := b.DocumentSymbolsRaw(ctx, uri)
+	if err != nil {
+		return protocol.ErrorResult(err.Error()), nil
+	}
+
+	sym := findEnclosingSymbol(symbols, line)
+	if sym == nil || !isGoTestName(sym.Name) {
+		return protocol.ErrorResult(fmt.Sprintf("no Go test function found at line %d", line+1)), nil
+	}
+
+	args := map[string]any{
+		"URI":        uri,
+		"Tests":      []string{},
+		"Benchmarks": []string{},
+	}
+	if strings.HasPrefix(sym.Name, "Benchmark") {
+		args["Benchmarks"] = []string{sym.Name}
+	} else {
+		args["Tests"] = []string{sym.Name}
+	}
+
+	capture := b.startCapture(lspName)
+	defer b.stopCapture(lspName, capture)
+
+	_, err = b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		return inst.Call(ctx, lsp.MethodWorkspaceExecuteCommand, map[string]any{
+			"command":       goplsRunTestsCommand,
+			"arguments":     []any{args},
+			"workDoneToken": capture.token,
+		})
+	})
+	if err != nil {
+		return protocol.ErrorResult(fmt.Sprintf("%s failed: %v", goplsRunTestsCommand, err)), nil
+	}
+
+	output := capture.String()
+	return testRunResult(goplsRunTestsCommand, parseGoTestOutput(output), output), nil
+}
+
+type rustRunnable struct {
+	Label string `json:"label"`
+	Kind  string `json:"kind"`
+	Args  struct {
+		WorkspaceRoot  string   `json:"workspaceRoot"`
+		CargoArgs      []string `json:"cargoArgs"`
+		CargoExtraArgs []string `json:"cargoExtraArgs"`
+		ExecutableArgs []string `json:"executableArgs"`
+	} `json:"args"`
+}
+
+func (b *Bridge) runRustAnalyzerTests(ctx context.Context, uri lsp.DocumentURI, line, character int) (*protocol.ToolCallResult, error) {
+	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		return inst.Call(ctx, rustAnalyzerRunnables, lsp.TextDocumentPositionParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+			Position:     lsp.Position{Line: line, Character: character},
+		})
+	})
+	if err != nil {
+		return protocol.ErrorResult(fmt.Sprintf("server does not support a known test-running convention: %v", err)), nil
+	}
+
+	var runnables []rustRunnable
+	if err := json.Unmarshal(result, &runnables); err != nil {
+		return protocol.ErrorResult(fmt.Sprintf("parsing runnables: %v", err)), nil
+	}
+
+	var runnable *rustRunnable
+	for i := range runnables {
+		if runnables[i].Kind == "cargo" && strings.HasPrefix(runnables[i].Label, "test") {
+			runnable = &runnables[i]
+			break
+		}
+	}
+	if runnable == nil {
+		return protocol.ErrorResult(fmt.Sprintf("no test runnable found at line %d", line+1)), nil
+	}
+
+	cargoArgs := append([]string{}, runnable.Args.CargoArgs...)
+	cargoArgs = append(cargoArgs, runnable.Args.CargoExtraArgs...)
+	if len(runnable.Args.ExecutableArgs) > 0 {
+		cargoArgs = append(cargoArgs, "--")
+		cargoArgs = append(cargoArgs, runnable.Args.ExecutableArgs...)
+	}
+
+	cmd := exec.CommandContext(ctx, "cargo", cargoArgs...)
+	cmd.Dir = runnable.Args.WorkspaceRoot
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	runErr := cmd.Run()
+
+	output := out.String()
+	outcomes := parseCargoTestOutput(output)
+	if runErr != nil && len(outcomes) == 0 {
+		return protocol.ErrorResult(fmt.Sprintf("cargo %s failed: %v\n%s",
+			strings.Join(cargoArgs, " "), runErr, tailLines(output, maxTestOutputLinesInTool))), nil
+	}
+
+	return testRunResult(runnable.Label, outcomes, output), nil
+}
+
+func findEnclosingSymbol(symbols []Symbol, line int) *Symbol {
+	for i := range symbols {
+		sym := &symbols[i]
+		r := sym.Range
+		if sym.Location != nil {
+			r = sym.Location.Range
+		}
+		if line < r.Start.Line || line > r.End.Line {
+			continue
+		}
+		if child := findEnclosingSymbol(sym.Children, line); child != nil {
+			return child
+		}
+		return sym
+	}
+	return nil
+}
+
+func isGoTestName(name string) bool {
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	goTestResultLine    = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (\S+)`)
+	cargoTestResultLine = regexp.MustCompile(`^test (\S+) \.\.\. (ok|FAILED|ignored)`)
+)
+
+func parseGoTestOutput(output string) []TestOutcome {
+	var outcomes []TestOutcome
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		m := goTestResultLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		status := TestStatusPass
+		switch m[1] {
+		case "FAIL":
+			status = TestStatusFail
+		case "SKIP":
+			status = TestStatusSkip
+		}
+		outcomes = append(outcomes, TestOutcome{Name: m[2], Status: status})
+	}
+	return outcomes
+}
+
+func parseCargoTestOutput(output string) []TestOutcome {
+	var outcomes []TestOutcome
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		m := cargoTestResultLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		status := TestStatusPass
+		switch m[2] {
+		case "FAILED":
+			status = TestStatusFail
+		case "ignored":
+			status = TestStatusSkip
+		}
+		outcomes = append(outcomes, TestOutcome{Name: m[1], Status: status})
+	}
+	return outcomes
+}
+
+func testRunResult(runner string, outcomes []TestOutcome, output string) *protocol.ToolCallResult {
+	var passed, failed, skipped int
+	var failures []string
+	for _, o := range outcomes {
+		switch o.Status {
+		case TestStatusPass:
+			passed++
+		case TestStatusFail:
+			failed++
+			failures = append(failures, o.Name)
+		case TestStatusSkip:
+			skipped++
+		}
+	}
+
+	var sb strings.Builder
+	switch {
+	case len(outcomes) == 0:
+		sb.WriteString(fmt.Sprintf("No results parsed (%s)\n", runner))
+	case failed > 0:
+		sb.WriteString(fmt.Sprintf("FAIL: %d passed, %d failed, %d skipped (%s)\n", passed, failed, skipped, runner))
+	default:
+		sb.WriteString(fmt.Sprintf("PASS: %d passed, %d failed, %d skipped (%s)\n", passed, failed, skipped, runner))
+	}
+	for _, name := range failures {
+		sb.WriteString(fmt.Sprintf("--- FAIL: %s\n", name))
+	}
+	if output != "" {
+		sb.WriteString("\n")
+		sb.WriteString(tailLines(output, maxTestOutputLinesInTool))
+	}
+
+	return &protocol.ToolCallResult{
+		Content: []protocol.ContentBlock{protocol.TextContent(sb.String())},
+		IsError: failed > 0,
+	}
+}
+
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return fmt.Sprintf("... (%d lines omitted)\n", len(lines)-n) + strings.Join(lines[len(lines)-n:], "\n")
+}
@@ -0,0 +1,117 @@
+package mcp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestParseGoTestOutput(t *testing.T) {
+	output := `=== RUN   TestAdd
+--- PASS: TestAdd (0.00s)
+=== RUN   TestSub
+    math_test.go:12: expected 1, got 2
+--- FAIL: TestSub (0.00s)
+=== RUN   TestSkipped
+--- SKIP: TestSkipped (0.00s)
+FAIL`
+
+	outcomes := parseGoTestOutput(output)
+	want := []TestOutcome{
+		{Name: "TestAdd", Status: TestStatusPass},
+		{Name: "TestSub", Status: TestStatusFail},
+		{Name: "TestSkipped", Status: TestStatusSkip},
+	}
+
+	if len(outcomes) != len(want) {
+		t.Fatalf("expected %d outcomes, got %d: %v", len(want), len(outcomes), outcomes)
+	}
+	for i := range want {
+		if outcomes[i] != want[i] {
+			t.Errorf("outcome %d: expected %v, got %v", i, want[i], outcomes[i])
+		}
+	}
+}
+
+func TestParseCargoTestOutput(t *testing.T) {
+	output := `running 3 tests
+test tests::adds ... ok
+test tests::subtracts ... FAILED
+test tests::slow ... ignored
+
+test result: FAILED. 1 passed; 1 failed; 1 ignored`
+
+	outcomes := parseCargoTestOutput(output)
+	want := []TestOutcome{
+		{Name: "tests::adds", Status: TestStatusPass},
+		{Name: "tests::subtracts", Status: TestStatusFail},
+		{Name: "tests::slow", Status: TestStatusSkip},
+	}
+
+	if len(outcomes) != len(want) {
+		t.Fatalf("expected %d outcomes, got %d: %v", len(want), len(outcomes), outcomes)
+	}
+	for i := range want {
+		if outcomes[i] != want[i] {
+			t.Errorf("outcome %d: expected %v, got %v", i, want[i], outcomes[i])
+		}
+	}
+}
+
+func TestFindEnclosingSymbol(t *testing.T) {
+	symbols := []Symbol{
+		{
+			Name:  "TestOuter",
+			Range: lsp.Range{Start: lsp.Position{Line: 10}, End: lsp.Position{Line: 20}},
+		},
+		{
+			Name:  "helper",
+			Range: lsp.Range{Start: lsp.Position{Line: 22}, End: lsp.Position{Line: 30}},
+		},
+	}
+
+	if sym := findEnclosingSymbol(symbols, 15); sym == nil || sym.Name != "TestOuter" {
+		t.Errorf("expected TestOuter, got %v", sym)
+	}
+	if sym := findEnclosingSymbol(symbols, 21); sym != nil {
+		t.Errorf("expected nil between symbols, got %v", sym.Name)
+	}
+}
+
+func TestOutputCapture_KeyedByRun(t *testing.T) {
+	b := &Bridge{captures: make(map[string]*outputCapture)}
+	first := b.startCapture("gopls")
+	second := b.startCapture("gopls")
+	token := func(c *outputCapture) json.RawMessage {
+		raw, _ := json.Marshal(c.token)
+		return raw
+	}
+
+	b.recordProgress("gopls", token(first), "--- PASS: TestA (0.00s)")
+	b.recordProgress("gopls", token(second), "--- FAIL: TestB (0.00s)")
+	b.recordProgress("rust-analyzer", token(first), "unrelated")
+	b.recordProgress("gopls", json.RawMessage(`7`), "server-initiated")
+
+	if got := first.String(); got != "--- PASS: TestA (0.00s)" {
+		t.Errorf("expected only the first run's output, got %q", got)
+	}
+	if got := second.String(); got != "--- FAIL: TestB (0.00s)" {
+		t.Errorf("expected only the second run's output, got %q", got)
+	}
+
+	b.stopCapture("gopls", first)
+	b.recordProgress("gopls", token(first), "late")
+	if got := first.String(); got != "--- PASS: TestA (0.00s)" {
+		t.Errorf("expected nothing recorded after the run stopped, got %q", got)
+	}
+}
+
+func TestTestRunResult_NoResults(t *testing.T) {
+	result := testRunResult(goplsRunTestsCommand, nil, "build failed")
+	text := result.Content[0].Text
+	if !strings.HasPrefix(text, "No results parsed (gopls.run_tests)\n") {
+		t.Errorf("expected no results reported, got %q", text)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/amarbel-llc/go-lib-mcp/protocol"
 	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
 )
 
 type ToolHandler func(ctx context.Context, args json.RawMessage) (*protocol.ToolCallResult, error)
@@ -15,17 +17,69 @@ type ToolRegistry struct {
 	tools    []protocol.Tool
 	handlers map[string]ToolHandler
 	bridge   *Bridge
+	cfg      *config.Config
+	outputs  *outputStore
 }
 
-func NewToolRegistry(bridge *Bridge) *ToolRegistry {
+func NewToolRegistry(bridge *Bridge, cfg *config.Config) *ToolRegistry {
 	r := &ToolRegistry{
 		handlers: make(map[string]ToolHandler),
 		bridge:   bridge,
+		cfg:      cfg,
+		outputs:  newOutputStore(),
 	}
 	r.registerBuiltinTools()
 	return r
 }
 
+// toolDefaultTimeouts holds the timeouts of tools that routinely take longer
+// than the default, such as project-wide searches; tool_timeouts entries for
+// them still win.
+var toolDefaultTimeouts = map[string]time.Duration{
+	"lsp_references":        time.Minute,
+	"lsp_workspace_symbols": time.Minute,
+	"lsp_run_tests":         10 * time.Minute,
+}
+
+// timeout returns how long a call to the tool may take: its tool_timeouts
+// entry, its built-in timeout, or the default.
+func (r *ToolRegistry) timeout(name string) time.Duration {
+	cfg := r.cfg
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	if d, ok := cfg.ToolTimeout(name); ok {
+		return d
+	}
+	if d, ok := toolDefaultTimeouts[name]; ok {
+		return d
+	}
+	return cfg.DefaultToolTimeoutDuration()
+}
+
+// timeoutResult reports a tool call that ran out of time, as JSON so agents
+// can tell it from other failures.
+func timeoutResult(name string, timeout time.Duration) *protocol.ToolCallResult {
+	data, _ := json.Marshal(map[string]any{
+		"error":   "timeout",
+		"tool":    name,
+		"timeout": timeout.String(),
+		"message": fmt.Sprintf("%s did not finish within %s; the language server may still be indexing or may be stuck. Retry later, or raise tool_timeouts.%s in the lux config.", name, timeout, name),
+	})
+	return &protocol.ToolCallResult{
+		Content: []protocol.ContentBlock{protocol.TextContent(string(data))},
+		IsError: true,
+	}
+}
+
+// outputBudget returns the byte cap on tool results, or 0 for none.
+func (r *ToolRegistry) outputBudget() int {
+	if r.cfg == nil || r.outputs == nil {
+		return 0
+	}
+	return r.cfg.ToolOutputBudget()
+}
+
 func (r *ToolRegistry) List() []protocol.Tool {
 	return r.tools
 }
@@ -35,7 +89,38 @@ func (r *ToolRegistry) Call(ctx context.Context, name string, args json.RawMessa
 	if !ok {
 		return protocol.ErrorResult(fmt.Sprintf("unknown tool: %s", name)), nil
 	}
-	return handler(ctx, args)
+
+	timeout := r.timeout(name)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		result *protocol.ToolCallResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := handler(ctx, args)
+		done <- outcome{result, err}
+	}()
+
+	// A handler blocked on a stuck server may not notice the deadline, so
+	// the call returns when it passes either way.
+	select {
+	case o := <-done:
+		if ctx.Err() == context.DeadlineExceeded && (o.err != nil || o.result == nil || o.result.IsError) {
+			return timeoutResult(name, timeout), nil
+		}
+		if o.err != nil || name == "lsp_output_page" {
+			return o.result, o.err
+		}
+		return r.applyBudget(o.result, r.outputBudget()), nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return timeoutResult(name, timeout), nil
+		}
+		return nil, ctx.Err()
+	}
 }
 
 func (r *ToolRegistry) register(name, description string, schema json.RawMessage, handler ToolHandler) {
@@ -138,12 +223,26 @@ func (r *ToolRegistry) registerBuiltinTools() {
 				"uri": {"type": "string", "description": "File URI (e.g., file:///path/to/file.go)"},
 				"line": {"type": "integer", "description": "0-indexed line number"},
 				"character": {"type": "integer", "description": "0-indexed character offset"},
-				"new_name": {"type": "string", "description": "New name for the symbol"}
+				"new_name": {"type": "string", "description": "New name for the symbol"},
+				"apply": {"type": "boolean", "description": "Write the edits to disk. Refused if any file changed since the rename was computed."}
 			},
 			"required": ["uri", "line", "character", "new_name"]
 		}`),
 		r.handleRename)
 
+	r.register("lsp_rename_preview", "Preview a rename without applying it. Performs the same semantic rename as lsp_rename but returns a unified diff of every file that would change, computed against the files on disk. Use this to review the scope of a rename before committing to it.",
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"uri": {"type": "string", "description": "File URI (e.g., file:///path/to/file.go)"},
+				"line": {"type": "integer", "description": "0-indexed line number"},
+				"character": {"type": "integer", "description": "0-indexed character offset"},
+				"new_name": {"type": "string", "description": "New name for the symbol"}
+			},
+			"required": ["uri", "line", "character", "new_name"]
+		}`),
+		r.handleRenamePreview)
+
 	r.register("lsp_workspace_symbols", "Search for symbols (functions, types, constants) across the entire workspace by name pattern. Agents MUST use this tool instead of grep/glob when searching for symbol definitions by name. DO NOT use grep to find function or type definitions - grep returns all text matches including usages, comments, and strings. This tool returns only actual symbol definitions with their locations.",
 		json.RawMessage(`{
 			"type": "object",
@@ -164,6 +263,29 @@ func (r *ToolRegistry) registerBuiltinTools() {
 			"required": ["uri"]
 		}`),
 		r.handleDiagnostics)
+
+	r.register("lsp_run_tests", "Run the test under the cursor through the language server's own test-running convention (gopls.run_tests for Go, rust-analyzer runnables for Rust). Returns a normalized summary (passed/failed/skipped counts and failing test names) followed by the tail of the test output. Use this instead of guessing the right `go test -run`/`cargo test` invocation for a single test.",
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"uri": {"type": "string", "description": "File URI (e.g., file:///path/to/file_test.go)"},
+				"line": {"type": "integer", "description": "0-indexed line number inside the test function"},
+				"character": {"type": "integer", "description": "0-indexed character offset"}
+			},
+			"required": ["uri", "line", "character"]
+		}`),
+		r.handleRunTests)
+
+	r.register("lsp_output_page", "Read one page of a tool result that was too large to return at once. Oversized results are replaced by a summary (counts by file and the first lines) that names a handle and the number of pages; pass them here to read the full output. Only the most recent oversized results are kept.",
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"handle": {"type": "string", "description": "Handle from the summary (e.g., out-1)"},
+				"page": {"type": "integer", "description": "1-indexed page number", "default": 1}
+			},
+			"required": ["handle"]
+		}`),
+		r.handleOutputPage)
 }
 
 type positionArgs struct {
@@ -192,6 +314,7 @@ type codeActionArgs struct {
 type renameArgs struct {
 	positionArgs
 	NewName string `json:"new_name"`
+	Apply   bool   `json:"apply"`
 }
 
 type workspaceSymbolsArgs struct {
@@ -266,7 +389,15 @@ func (r *ToolRegistry) handleRename(ctx context.Context, args json.RawMessage) (
 	if err := json.Unmarshal(args, &a); err != nil {
 		return protocol.ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
 	}
-	return r.bridge.Rename(ctx, lsp.DocumentURI(a.URI), a.Line, a.Character, a.NewName)
+	return r.bridge.Rename(ctx, lsp.DocumentURI(a.URI), a.Line, a.Character, a.NewName, a.Apply)
+}
+
+func (r *ToolRegistry) handleRenamePreview(ctx context.Context, args json.RawMessage) (*protocol.ToolCallResult, error) {
+	var a renameArgs
+	if err := json.Unmarshal(args, &a); err != nil {
+		return protocol.ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	return r.bridge.RenamePreview(ctx, lsp.DocumentURI(a.URI), a.Line, a.Character, a.NewName)
 }
 
 func (r *ToolRegistry) handleWorkspaceSymbols(ctx context.Context, args json.RawMessage) (*protocol.ToolCallResult, error) {
@@ -284,3 +415,11 @@ func (r *ToolRegistry) handleDiagnostics(ctx context.Context, args json.RawMessa
 	}
 	return r.bridge.Diagnostics(ctx, lsp.DocumentURI(a.URI))
 }
+
+func (r *ToolRegistry) handleRunTests(ctx context.Context, args json.RawMessage) (*protocol.ToolCallResult, error) {
+	var a positionArgs
+	if err := json.Unmarshal(args, &a); err != nil {
+		return protocol.ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	return r.bridge.RunTests(ctx, lsp.DocumentURI(a.URI), a.Line, a.Character)
+}
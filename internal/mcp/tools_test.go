@@ -0,0 +1,128 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/protocol"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestToolRegistry_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	r := &ToolRegistry{
+		handlers: map[string]ToolHandler{
+			"stuck": func(ctx context.Context, args json.RawMessage) (*protocol.ToolCallResult, error) {
+				<-release // ignores the deadline, like a call blocked on a hung server
+				return nil, nil
+			},
+			"fast": func(ctx context.Context, args json.RawMessage) (*protocol.ToolCallResult, error) {
+				return protocol.ErrorResult("no LSP configured"), nil
+			},
+		},
+		cfg: &config.Config{ToolTimeouts: map[string]string{"stuck": "10ms", "fast": "10ms"}},
+	}
+
+	result, err := r.Call(context.Background(), "stuck", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.IsError || len(result.Content) != 1 {
+		t.Fatalf("expected an error result, got %+v", result)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &payload); err != nil {
+		t.Fatalf("expected a JSON payload, got %q", result.Content[0].Text)
+	}
+	if payload["error"] != "timeout" || payload["tool"] != "stuck" || payload["timeout"] != "10ms" {
+		t.Errorf("unexpected payload %v", payload)
+	}
+
+	result, _ = r.Call(context.Background(), "fast", nil)
+	if !strings.Contains(result.Content[0].Text, "no LSP configured") {
+		t.Errorf("expected the handler's own error, got %q", result.Content[0].Text)
+	}
+}
+
+func TestToolRegistry_TimeoutPrecedence(t *testing.T) {
+	r := &ToolRegistry{cfg: &config.Config{ToolTimeouts: map[string]string{"default": "5s", "lsp_run_tests": "1m"}}}
+
+	tests := []struct {
+		tool     string
+		expected time.Duration
+	}{
+		{"lsp_hover", 5 * time.Second},
+		{"lsp_references", time.Minute},
+		{"lsp_run_tests", time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			if got := r.timeout(tt.tool); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestToolRegistry_OutputBudget(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&text, "/src/a.go:%d:1: reference %d\n", i+1, i)
+	}
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&text, "/src/b.go:%d:1: reference %d\n", i+1, i)
+	}
+
+	r := &ToolRegistry{
+		handlers: map[string]ToolHandler{
+			"big": func(ctx context.Context, args json.RawMessage) (*protocol.ToolCallResult, error) {
+				return &protocol.ToolCallResult{Content: []protocol.ContentBlock{protocol.TextContent(text.String())}}, nil
+			},
+		},
+		cfg:     &config.Config{MaxToolOutput: 2048},
+		outputs: newOutputStore(),
+	}
+	r.handlers["lsp_output_page"] = r.handleOutputPage
+
+	result, err := r.Call(context.Background(), "big", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	summary := result.Content[0].Text
+	if len(summary) > 2048 {
+		t.Errorf("expected the summary within the budget, got %d bytes", len(summary))
+	}
+	for _, want := range []string{"250 lines", "/src/a.go: 200", "/src/b.go: 50", `handle "out-1"`, "/src/a.go:1:1: reference 0"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("expected summary to contain %q, got:\n%s", want, summary)
+		}
+	}
+
+	var full strings.Builder
+	for page := 1; ; page++ {
+		args, _ := json.Marshal(outputPageArgs{Handle: "out-1", Page: page})
+		result, _ := r.Call(context.Background(), "lsp_output_page", args)
+		if result.IsError {
+			break
+		}
+		_, body, _ := strings.Cut(result.Content[0].Text, "\n")
+		full.WriteString(body)
+	}
+	if full.String() != text.String() {
+		t.Error("expected the pages to reassemble the full output")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	pages := paginate("aaaa\nbb\ncccccccccc\n", 6)
+	expected := []string{"aaaa\n", "bb\n", "cccccc", "cccc\n"}
+	if strings.Join(pages, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, pages)
+	}
+}
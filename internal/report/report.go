@@ -0,0 +1,367 @@
+// Package report bundles what is needed to reproduce a lux problem — version
+// information, the effective configuration, cached server capabilities, and
+// the state of a running server — into a tarball for attaching to bug
+// reports. Values that commonly hold secrets are redacted before anything is
+// written, and every redaction is listed so the user can review it.
+package report
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/amarbel-llc/lux/internal/buildinfo"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// Redacted replaces a value removed from the bundle.
+const Redacted = "<redacted>"
+
+// sensitiveKey matches settings and init_options keys whose values are
+// redacted. Environment variables are always redacted.
+var sensitiveKey = regexp.MustCompile(`(?i)(token|secret|password|passwd|credential|auth|api[_-]?key|private[_-]?key)`)
+
+// File is one file of a bundle.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Bundle is a collected report, ready to review and write.
+type Bundle struct {
+	Files      []File
+	Redactions []string // where values were redacted, e.g. "lsp gopls: env.GITHUB_TOKEN"
+}
+
+// Options says what to collect.
+type Options struct {
+	Build     buildinfo.Info
+	Workspace string
+
+	// Status and Dump write the running server's LSP status and state dump.
+	// Either may be nil or fail when no server is running for the workspace.
+	Status func(io.Writer) error
+	Dump   func(io.Writer) error
+}
+
+// Collect gathers a bundle for opts.Workspace. Missing pieces, such as a
+// server that isn't running, are noted in the bundle rather than failing it.
+func Collect(opts Options) (*Bundle, error) {
+	b := &Bundle{}
+
+	var version bytes.Buffer
+	fmt.Fprintf(&version, "lux %s\n", opts.Build.Version)
+	if opts.Build.Commit != "" {
+		fmt.Fprintf(&version, "commit %s\n", opts.Build.Commit)
+	}
+	fmt.Fprintf(&version, "lsp protocol %s\n", opts.Build.LSPProtocol)
+	fmt.Fprintf(&version, "mcp protocol %s\n", opts.Build.MCPProtocol)
+	fmt.Fprintf(&version, "go %s\n", runtime.Version())
+	fmt.Fprintf(&version, "os %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&version, "workspace %s\n", opts.Workspace)
+	fmt.Fprintf(&version, "collected %s\n", time.Now().UTC().Format(time.RFC3339))
+	b.add("version.txt", version.Bytes())
+
+	cfg, err := config.LoadWithProject(opts.Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	var sanitizer sanitizer
+	var cfgBuf bytes.Buffer
+	if err := toml.NewEncoder(&cfgBuf).Encode(sanitizer.config(cfg)); err != nil {
+		return nil, fmt.Errorf("encoding config: %w", err)
+	}
+	b.add("config/lsps.toml", cfgBuf.Bytes())
+
+	if formatters, err := config.LoadMergedFormatters(); err == nil {
+		var fmtBuf bytes.Buffer
+		if err := toml.NewEncoder(&fmtBuf).Encode(sanitizer.formatters(formatters)); err != nil {
+			return nil, fmt.Errorf("encoding formatters: %w", err)
+		}
+		b.add("config/formatters.toml", fmtBuf.Bytes())
+	}
+
+	if err := b.addCapabilities(config.CapabilitiesDir()); err != nil {
+		return nil, err
+	}
+
+	b.Redactions = append(b.Redactions, sanitizer.redactions...)
+
+	b.addOutput("status.txt", opts.Status)
+	b.addOutput("state.txt", opts.Dump)
+
+	b.redactSecrets(sanitizer.secrets)
+	b.redactHome()
+	return b, nil
+}
+
+func (b *Bundle) add(name string, data []byte) {
+	b.Files = append(b.Files, File{Name: name, Data: data})
+}
+
+// addCapabilities adds the cached capabilities of every server.
+func (b *Bundle) addCapabilities(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading capability cache: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		b.add("capabilities/"+e.Name(), data)
+	}
+	return nil
+}
+
+// addOutput adds what fn writes, or why there is nothing.
+func (b *Bundle) addOutput(name string, fn func(io.Writer) error) {
+	if fn == nil {
+		b.add(name, []byte("not collected: no lux server running for the workspace\n"))
+		return
+	}
+	var buf bytes.Buffer
+	if err := fn(&buf); err != nil {
+		b.add(name, []byte(fmt.Sprintf("not collected: %v\n", err)))
+		return
+	}
+	b.add(name, buf.Bytes())
+}
+
+// redactHome replaces the user's home directory with ~ in every file, since
+// paths otherwise name the user.
+func (b *Bundle) redactHome() {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || home == "/" {
+		return
+	}
+	for i, f := range b.Files {
+		if bytes.Contains(f.Data, []byte(home)) {
+			b.Files[i].Data = bytes.ReplaceAll(f.Data, []byte(home), []byte("~"))
+			b.Redactions = append(b.Redactions, fmt.Sprintf("%s: home directory", f.Name))
+		}
+	}
+}
+
+// WriteTarGz writes the bundle as a gzipped tarball under a top-level
+// directory named dir.
+func (b *Bundle) WriteTarGz(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	for _, f := range b.Files {
+		hdr := &tar.Header{
+			Name:    dir + "/" + f.Name,
+			Mode:    0644,
+			Size:    int64(len(f.Data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing %s: %w", f.Name, err)
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return fmt.Errorf("writing %s: %w", f.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// minSecretLen is the shortest redacted value that is also scrubbed from the
+// status and state dump, so short values like "1" don't mangle them.
+const minSecretLen = 6
+
+// sanitizer redacts configuration, remembering the values it removed so they
+// can be scrubbed from the rest of the bundle.
+type sanitizer struct {
+	redactions []string
+	secrets    []string
+}
+
+func (s *sanitizer) redact(where, value string) string {
+	s.redactions = append(s.redactions, where)
+	if len(value) >= minSecretLen {
+		s.secrets = append(s.secrets, value)
+	}
+	return Redacted
+}
+
+// SanitizeConfig returns a copy of cfg with environment values, argument
+// values, and sensitive settings redacted, and where it redacted them.
+func SanitizeConfig(cfg *config.Config) (*config.Config, []string) {
+	var s sanitizer
+	return s.config(cfg), s.redactions
+}
+
+// SanitizeFormatters returns a copy of cfg with environment and argument
+// values redacted, and where it redacted them.
+func SanitizeFormatters(cfg *config.FormatterConfig) (*config.FormatterConfig, []string) {
+	var s sanitizer
+	return s.formatters(cfg), s.redactions
+}
+
+func (s *sanitizer) config(cfg *config.Config) *config.Config {
+	sanitized := *cfg
+	sanitized.LSPs = make([]config.LSP, len(cfg.LSPs))
+	for i, l := range cfg.LSPs {
+		where := "lsp " + l.Name
+		l.Command = s.command(l.Command, where)
+		l.Args = s.args(l.Args, where)
+		l.Env = s.env(l.Env, where)
+		l.InitOptions = s.settings(l.InitOptions, where+": init_options")
+		l.Settings = s.settings(l.Settings, where+": settings")
+		sanitized.LSPs[i] = l
+	}
+	return &sanitized
+}
+
+func (s *sanitizer) formatters(cfg *config.FormatterConfig) *config.FormatterConfig {
+	sanitized := &config.FormatterConfig{Formatters: make([]config.Formatter, len(cfg.Formatters))}
+	for i, f := range cfg.Formatters {
+		where := "formatter " + f.Name
+		f.Args = s.args(f.Args, where)
+		f.Env = s.env(f.Env, where)
+		sanitized.Formatters[i] = f
+	}
+	return sanitized
+}
+
+func (s *sanitizer) env(env map[string]string, where string) map[string]string {
+	if len(env) == 0 {
+		return env
+	}
+	redacted := make(map[string]string, len(env))
+	for _, k := range sortedKeys(env) {
+		redacted[k] = s.redact(fmt.Sprintf("%s: env.%s", where, k), env[k])
+	}
+	return redacted
+}
+
+// args redacts every argument value, keeping bare flags such as --stdio and
+// the names of --flag=value flags, since a token is as easily passed as an
+// argument as in the environment.
+func (s *sanitizer) args(args []string, where string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch {
+		case strings.HasPrefix(arg, "-") && !hasValue:
+			redacted[i] = arg
+		case strings.HasPrefix(arg, "-"):
+			redacted[i] = name + "=" + s.redact(fmt.Sprintf("%s: args[%d]", where, i), value)
+		default:
+			redacted[i] = s.redact(fmt.Sprintf("%s: args[%d]", where, i), arg)
+		}
+	}
+	return redacted
+}
+
+// command redacts the arguments of a command line, keeping the program.
+func (s *sanitizer) command(command, where string) string {
+	fields := strings.Fields(command)
+	if len(fields) < 2 {
+		return command
+	}
+	return strings.Join(append(fields[:1:1], s.args(fields[1:], where+": command")...), " ")
+}
+
+func (s *sanitizer) settings(settings map[string]any, where string) map[string]any {
+	if len(settings) == 0 {
+		return settings
+	}
+	redacted := make(map[string]any, len(settings))
+	for _, k := range sortedKeys(settings) {
+		redacted[k] = s.value(k, settings[k], where+"."+k)
+	}
+	return redacted
+}
+
+// value redacts v, found under key at where: all of it if the key is
+// sensitive, or the sensitive keys within it.
+func (s *sanitizer) value(key string, v any, where string) any {
+	if sensitiveKey.MatchString(key) {
+		value, _ := v.(string)
+		return s.redact(where, value)
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		return s.settings(v, where)
+	case []any:
+		redacted := make([]any, len(v))
+		for i, item := range v {
+			redacted[i] = s.value("", item, fmt.Sprintf("%s[%d]", where, i))
+		}
+		return redacted
+	}
+	return v
+}
+
+// redactSecrets replaces every value redacted from the configuration
+// wherever else it appears in the bundle, such as in a server's command line
+// in the status or a setting echoed in the state dump.
+func (b *Bundle) redactSecrets(secrets []string) {
+	for i, f := range b.Files {
+		redacted := false
+		for _, secret := range secrets {
+			if bytes.Contains(b.Files[i].Data, []byte(secret)) {
+				b.Files[i].Data = bytes.ReplaceAll(b.Files[i].Data, []byte(secret), []byte(Redacted))
+				redacted = true
+			}
+		}
+		if redacted {
+			b.Redactions = append(b.Redactions, fmt.Sprintf("%s: configured values", f.Name))
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Summary describes the bundle's files and redactions for review before it
+// is written.
+func (b *Bundle) Summary() string {
+	var s strings.Builder
+	fmt.Fprintln(&s, "Files:")
+	for _, f := range b.Files {
+		fmt.Fprintf(&s, "  %s (%d bytes)\n", f.Name, len(f.Data))
+	}
+	if len(b.Redactions) == 0 {
+		fmt.Fprintln(&s, "Redactions: none")
+	} else {
+		fmt.Fprintln(&s, "Redactions:")
+		for _, r := range b.Redactions {
+			fmt.Fprintf(&s, "  %s\n", r)
+		}
+	}
+	return s.String()
+}
@@ -0,0 +1,165 @@
+package report
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestSanitizeConfig(t *testing.T) {
+	cfg := &config.Config{LSPs: []config.LSP{{
+		Name:    "gopls",
+		Command: "gopls-wrapper --token ghp_command",
+		Args:    []string{"serve", "--remote=auto", "-rpc.trace"},
+		Env:     map[string]string{"GITHUB_TOKEN": "ghp_secret", "GOFLAGS": "-mod=mod"},
+		Settings: map[string]any{
+			"gopls": map[string]any{
+				"apiKey":      "abc",
+				"staticcheck": true,
+				"registries": []any{
+					map[string]any{"url": "https://example.com", "authToken": "xyz"},
+				},
+			},
+		},
+		InitOptions: map[string]any{"password": "hunter2"},
+	}}}
+
+	sanitized, redactions := SanitizeConfig(cfg)
+
+	l := sanitized.LSPs[0]
+	if l.Env["GITHUB_TOKEN"] != Redacted || l.Env["GOFLAGS"] != Redacted {
+		t.Errorf("expected env values redacted, got %v", l.Env)
+	}
+	gopls := l.Settings["gopls"].(map[string]any)
+	if gopls["apiKey"] != Redacted {
+		t.Errorf("expected apiKey redacted, got %v", gopls["apiKey"])
+	}
+	if gopls["staticcheck"] != true {
+		t.Errorf("expected staticcheck kept, got %v", gopls["staticcheck"])
+	}
+	registry := gopls["registries"].([]any)[0].(map[string]any)
+	if registry["authToken"] != Redacted || registry["url"] != "https://example.com" {
+		t.Errorf("expected authToken redacted within the array, got %v", registry)
+	}
+	if !reflect.DeepEqual(l.Args, []string{Redacted, "--remote=" + Redacted, "-rpc.trace"}) {
+		t.Errorf("expected argument values redacted, got %v", l.Args)
+	}
+	if l.Command != "gopls-wrapper --token "+Redacted {
+		t.Errorf("expected command arguments redacted, got %q", l.Command)
+	}
+	if l.InitOptions["password"] != Redacted {
+		t.Errorf("expected password redacted, got %v", l.InitOptions["password"])
+	}
+
+	if cfg.LSPs[0].Env["GITHUB_TOKEN"] != "ghp_secret" {
+		t.Error("expected the original config to be unchanged")
+	}
+
+	expected := []string{
+		"lsp gopls: command: args[1]",
+		"lsp gopls: args[0]",
+		"lsp gopls: args[1]",
+		"lsp gopls: env.GITHUB_TOKEN",
+		"lsp gopls: env.GOFLAGS",
+		"lsp gopls: init_options.password",
+		"lsp gopls: settings.gopls.apiKey",
+		"lsp gopls: settings.gopls.registries[0].authToken",
+	}
+	if !reflect.DeepEqual(redactions, expected) {
+		t.Errorf("expected redactions %v, got %v", expected, redactions)
+	}
+}
+
+func TestSanitizeFormatters(t *testing.T) {
+	cfg := &config.FormatterConfig{Formatters: []config.Formatter{
+		{Name: "prettier", Env: map[string]string{"NPM_TOKEN": "x"}},
+		{Name: "gofmt"},
+	}}
+
+	sanitized, redactions := SanitizeFormatters(cfg)
+
+	if sanitized.Formatters[0].Env["NPM_TOKEN"] != Redacted {
+		t.Errorf("expected env value redacted, got %v", sanitized.Formatters[0].Env)
+	}
+	if len(redactions) != 1 || redactions[0] != "formatter prettier: env.NPM_TOKEN" {
+		t.Errorf("expected one redaction, got %v", redactions)
+	}
+}
+
+func TestBundle_RedactSecrets(t *testing.T) {
+	var s sanitizer
+	s.config(&config.Config{LSPs: []config.LSP{{
+		Name: "gopls",
+		Args: []string{"--token=ghp_secret", "-v"},
+		Env:  map[string]string{"DEBUG": "1"},
+	}}})
+
+	b := &Bundle{Files: []File{
+		{Name: "status.txt", Data: []byte("gopls running\n")},
+		{Name: "state.txt", Data: []byte(`{"args":["--token=ghp_secret"],"debug":"1"}`)},
+	}}
+	b.redactSecrets(s.secrets)
+
+	if string(b.Files[0].Data) != "gopls running\n" {
+		t.Errorf("expected status unchanged, got %q", b.Files[0].Data)
+	}
+	if expected := `{"args":["--token=<redacted>"],"debug":"1"}`; string(b.Files[1].Data) != expected {
+		t.Errorf("expected %s, got %s", expected, b.Files[1].Data)
+	}
+	if !reflect.DeepEqual(b.Redactions, []string{"state.txt: configured values"}) {
+		t.Errorf("unexpected redactions %v", b.Redactions)
+	}
+}
+
+func TestBundle_WriteTarGz(t *testing.T) {
+	b := &Bundle{Files: []File{
+		{Name: "version.txt", Data: []byte("lux dev\n")},
+		{Name: "config/lsps.toml", Data: []byte("[[lsp]]\n")},
+	}}
+
+	var buf bytes.Buffer
+	if err := b.WriteTarGz(&buf, "lux-report"); err != nil {
+		t.Fatalf("WriteTarGz: %v", err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(data)
+	}
+
+	expected := map[string]string{
+		"lux-report/version.txt":      "lux dev\n",
+		"lux-report/config/lsps.toml": "[[lsp]]\n",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestAddOutput_NoServer(t *testing.T) {
+	b := &Bundle{}
+	b.addOutput("status.txt", nil)
+
+	if len(b.Files) != 1 || !bytes.HasPrefix(b.Files[0].Data, []byte("not collected")) {
+		t.Errorf("expected a not-collected note, got %v", b.Files)
+	}
+}
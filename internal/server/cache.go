@@ -0,0 +1,236 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// responseCacheSize bounds how many answers a ResponseCache holds.
+const responseCacheSize = 512
+
+// CacheKey identifies a cacheable request: its method, and the document
+// version and position it asks about. Methods without a position, such as
+// textDocument/documentSymbol, leave Line and Character zero.
+type CacheKey struct {
+	Method    string
+	URI       lsp.DocumentURI
+	Version   int
+	Line      int
+	Character int
+}
+
+// Cacheable reports whether answers to method depend only on the document
+// and position asked about, so they can be reused until a document changes.
+func Cacheable(method string) bool {
+	switch method {
+	case lsp.MethodTextDocumentHover, lsp.MethodTextDocumentDefinition, lsp.MethodTextDocumentDocumentSymbol:
+		return true
+	}
+	return false
+}
+
+// ResponseCache remembers answers to cacheable requests, so repeats — MCP
+// agents often ask about the same positions over and over — are answered
+// without asking the backend again. It holds the most recently used
+// answers. A change to a document purges the answers about it; those about
+// other documents stay until they change too.
+type ResponseCache struct {
+	entries map[CacheKey]*list.Element
+	order   *list.List // most recently used first
+	size    int
+	gen     uint64
+	docGens map[lsp.DocumentURI]uint64
+	mu      sync.Mutex
+}
+
+type cacheEntry struct {
+	key    CacheKey
+	result json.RawMessage
+}
+
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{
+		entries: make(map[CacheKey]*list.Element),
+		order:   list.New(),
+		size:    responseCacheSize,
+		docGens: make(map[lsp.DocumentURI]uint64),
+	}
+}
+
+// Get returns the cached answer for key.
+func (c *ResponseCache) Get(key CacheKey) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).result, true
+}
+
+// Generation returns a token to pass to Put for an answer about uri about
+// to be requested.
+func (c *ResponseCache) Generation(uri lsp.DocumentURI) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation(uri)
+}
+
+// generation changes whenever answers about uri are purged: both counters
+// only grow. The caller holds c.mu.
+func (c *ResponseCache) generation(uri lsp.DocumentURI) uint64 {
+	return c.gen + c.docGens[uri]
+}
+
+// Put caches result for key, unless answers about its document were purged
+// since gen was taken: the answer may then describe it as it was before.
+func (c *ResponseCache) Put(key CacheKey, result json.RawMessage, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.generation(key.URI) {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).result = result
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: result})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Purge drops the cached answers about uri.
+func (c *ResponseCache) Purge(uri lsp.DocumentURI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docGens[uri]++
+	for key, elem := range c.entries {
+		if key.URI == uri {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// PurgeAll drops every cached answer, for changes that aren't to one
+// document, such as a new config.
+func (c *ResponseCache) PurgeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if len(c.entries) > 0 {
+		c.entries = make(map[CacheKey]*list.Element)
+		c.order.Init()
+	}
+}
+
+// changedDocuments returns the documents a notification of method changes
+// in ways cached answers may depend on.
+func changedDocuments(method string, params json.RawMessage) []lsp.DocumentURI {
+	var p struct {
+		TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+		Changes      []fileEvent                `json:"changes"`
+		Files        []struct {
+			URI    lsp.DocumentURI `json:"uri"`
+			OldURI lsp.DocumentURI `json:"oldUri"`
+			NewURI lsp.DocumentURI `json:"newUri"`
+		} `json:"files"`
+	}
+
+	switch method {
+	case lsp.MethodTextDocumentDidChange,
+		lsp.MethodTextDocumentDidClose,
+		lsp.MethodTextDocumentDidSave:
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil
+		}
+		return []lsp.DocumentURI{p.TextDocument.URI}
+	case lsp.MethodWorkspaceDidChangeWatchedFiles,
+		lsp.MethodWorkspaceDidCreateFiles,
+		lsp.MethodWorkspaceDidRenameFiles,
+		lsp.MethodWorkspaceDidDeleteFiles:
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	var uris []lsp.DocumentURI
+	for _, change := range p.Changes {
+		uris = append(uris, change.URI)
+	}
+	for _, file := range p.Files {
+		for _, uri := range []lsp.DocumentURI{file.URI, file.OldURI, file.NewURI} {
+			if uri != "" {
+				uris = append(uris, uri)
+			}
+		}
+	}
+	return uris
+}
+
+// responseCacheKey returns the cache key for msg, if it is a cacheable
+// request about a document the client has open; the versions of other
+// documents aren't known. Requests naming a lux.target aren't cached: their
+// answers are one server's, not the merged answer.
+func (s *Server) responseCacheKey(msg *jsonrpc.Message) (CacheKey, bool) {
+	if !msg.IsRequest() || !Cacheable(msg.Method) {
+		return CacheKey{}, false
+	}
+	if target, _, _ := requestTarget(msg.Params); target != "" {
+		return CacheKey{}, false
+	}
+	var p lsp.TextDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		return CacheKey{}, false
+	}
+	version, ok := s.documents.version(p.TextDocument.URI)
+	if !ok {
+		return CacheKey{}, false
+	}
+	return CacheKey{
+		Method:    msg.Method,
+		URI:       p.TextDocument.URI,
+		Version:   version,
+		Line:      p.Position.Line,
+		Character: p.Position.Character,
+	}, true
+}
+
+// handleCached answers cacheable requests from the response cache, and
+// everything else, and misses, with handleDefault.
+func (h *Handler) handleCached(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	if msg.IsNotification() {
+		for _, uri := range changedDocuments(msg.Method, msg.Params) {
+			h.server.responses.Purge(uri)
+		}
+	}
+
+	key, ok := h.server.responseCacheKey(msg)
+	if !ok {
+		return h.handleDefault(ctx, msg)
+	}
+	if result, hit := h.server.responses.Get(key); hit {
+		resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+		resp.Result = result
+		return resp, nil
+	}
+
+	gen := h.server.responses.Generation(key.URI)
+	resp, err := h.handleDefault(ctx, msg)
+	if err == nil && resp != nil && resp.Error == nil {
+		h.server.responses.Put(key, resp.Result, gen)
+	}
+	return resp, err
+}
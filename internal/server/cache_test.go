@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewResponseCache()
+	c.size = 2
+
+	key := func(line int) CacheKey {
+		return CacheKey{Method: lsp.MethodTextDocumentHover, URI: "file:///a.go", Version: 1, Line: line}
+	}
+	gen := c.Generation("file:///a.go")
+	c.Put(key(1), json.RawMessage(`"one"`), gen)
+	c.Put(key(2), json.RawMessage(`"two"`), gen)
+	c.Get(key(1))
+	c.Put(key(3), json.RawMessage(`"three"`), gen)
+
+	if _, ok := c.Get(key(2)); ok {
+		t.Error("expected the least recently used answer to be evicted")
+	}
+	if result, ok := c.Get(key(1)); !ok || string(result) != `"one"` {
+		t.Errorf("expected %q, got %q", `"one"`, result)
+	}
+	if _, ok := c.Get(key(3)); !ok {
+		t.Error("expected the newest answer to be cached")
+	}
+}
+
+func TestResponseCache_PurgeDropsLatePuts(t *testing.T) {
+	c := NewResponseCache()
+	key := CacheKey{Method: lsp.MethodTextDocumentDefinition, URI: "file:///a.go", Version: 1}
+	other := CacheKey{Method: lsp.MethodTextDocumentDefinition, URI: "file:///b.go", Version: 1}
+
+	gen, otherGen := c.Generation(key.URI), c.Generation(other.URI)
+	c.Put(key, json.RawMessage(`[]`), gen)
+	c.Put(other, json.RawMessage(`[]`), otherGen)
+	c.Purge(key.URI)
+	if _, ok := c.Get(key); ok {
+		t.Error("expected purge to drop the document's cached answers")
+	}
+	if _, ok := c.Get(other); !ok {
+		t.Error("expected answers about other documents to stay cached")
+	}
+
+	// An answer requested before the purge may describe old content.
+	c.Put(key, json.RawMessage(`[]`), gen)
+	if _, ok := c.Get(key); ok {
+		t.Error("expected an answer from before the purge to be dropped")
+	}
+	c.Put(other, json.RawMessage(`{}`), otherGen)
+	if result, _ := c.Get(other); string(result) != `{}` {
+		t.Errorf("expected answers about other documents to be cached, got %s", result)
+	}
+
+	c.PurgeAll()
+	if _, ok := c.Get(other); ok {
+		t.Error("expected PurgeAll to drop every cached answer")
+	}
+}
+
+func TestChangedDocuments(t *testing.T) {
+	tests := []struct {
+		method   string
+		params   string
+		expected string
+	}{
+		{lsp.MethodTextDocumentDidChange, `{"textDocument":{"uri":"file:///a.go","version":2},"contentChanges":[]}`, "[file:///a.go]"},
+		{lsp.MethodWorkspaceDidChangeWatchedFiles, `{"changes":[{"uri":"file:///a.go","type":2},{"uri":"file:///b.go","type":3}]}`, "[file:///a.go file:///b.go]"},
+		{lsp.MethodWorkspaceDidRenameFiles, `{"files":[{"oldUri":"file:///a.go","newUri":"file:///c.go"}]}`, "[file:///a.go file:///c.go]"},
+		{lsp.MethodTextDocumentDidOpen, `{"textDocument":{"uri":"file:///a.go"}}`, "[]"},
+	}
+
+	for _, tt := range tests {
+		if got := fmt.Sprint(changedDocuments(tt.method, json.RawMessage(tt.params))); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.method, tt.expected, got)
+		}
+	}
+}
+
+func TestServer_ResponseCacheKey(t *testing.T) {
+	s := &Server{documents: newDocumentStore()}
+	s.documents.apply(lsp.MethodTextDocumentDidOpen, json.RawMessage(`{"textDocument":{"uri":"file:///a.go","languageId":"go","version":3,"text":""}}`))
+
+	tests := []struct {
+		name     string
+		method   string
+		params   string
+		expected CacheKey
+		ok       bool
+	}{
+		{
+			name:     "hover on open document",
+			method:   lsp.MethodTextDocumentHover,
+			params:   `{"textDocument":{"uri":"file:///a.go"},"position":{"line":4,"character":7}}`,
+			expected: CacheKey{Method: lsp.MethodTextDocumentHover, URI: "file:///a.go", Version: 3, Line: 4, Character: 7},
+			ok:       true,
+		},
+		{
+			name:     "document symbols",
+			method:   lsp.MethodTextDocumentDocumentSymbol,
+			params:   `{"textDocument":{"uri":"file:///a.go"}}`,
+			expected: CacheKey{Method: lsp.MethodTextDocumentDocumentSymbol, URI: "file:///a.go", Version: 3},
+			ok:       true,
+		},
+		{
+			name:   "document not open",
+			method: lsp.MethodTextDocumentDefinition,
+			params: `{"textDocument":{"uri":"file:///b.go"},"position":{"line":0,"character":0}}`,
+		},
+		{
+			name:   "targeted request",
+			method: lsp.MethodTextDocumentHover,
+			params: `{"textDocument":{"uri":"file:///a.go"},"position":{"line":4,"character":7},"lux":{"target":"gopls"}}`,
+		},
+		{
+			name:   "uncacheable method",
+			method: lsp.MethodTextDocumentReferences,
+			params: `{"textDocument":{"uri":"file:///a.go"},"position":{"line":0,"character":0}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), tt.method, json.RawMessage(tt.params))
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, ok := s.responseCacheKey(msg)
+			if ok != tt.ok || key != tt.expected {
+				t.Errorf("expected %+v (%v), got %+v (%v)", tt.expected, tt.ok, key, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+// cancelTracker maps client request IDs to the contexts their forwarded
+// backend calls run under. Cancelling one makes the backend call send the
+// backend $/cancelRequest with the ID it was issued under.
+type cancelTracker struct {
+	cancels map[string]context.CancelFunc
+	mu      sync.Mutex
+}
+
+func newCancelTracker() *cancelTracker {
+	return &cancelTracker{cancels: make(map[string]context.CancelFunc)}
+}
+
+// track derives a cancellable context for the client request id and returns
+// a func that forgets it again.
+func (t *cancelTracker) track(ctx context.Context, id jsonrpc.ID) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := id.String()
+
+	t.mu.Lock()
+	t.cancels[key] = cancel
+	t.mu.Unlock()
+
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.cancels, key)
+		t.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel handles a client $/cancelRequest notification.
+func (t *cancelTracker) cancel(params json.RawMessage) {
+	var p struct {
+		ID jsonrpc.ID `json:"id"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	cancel, ok := t.cancels[p.ID.String()]
+	t.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// callErrorResponse converts an error from a backend call into the response
+// for client request id, preserving backend JSON-RPC errors and reporting
+// cancelled and timed-out requests as RequestCancelled.
+func callErrorResponse(id jsonrpc.ID, err error) (*jsonrpc.Message, error) {
+	var rpcErr *jsonrpc.Error
+	if errors.As(err, &rpcErr) {
+		return jsonrpc.NewErrorResponse(id, rpcErr.Code, rpcErr.Message, rpcErr.Data)
+	}
+	if errors.Is(err, context.Canceled) {
+		return jsonrpc.NewErrorResponse(id, jsonrpc.RequestCancelled, "request cancelled", nil)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return jsonrpc.NewErrorResponse(id, jsonrpc.RequestCancelled, err.Error(), nil)
+	}
+	return jsonrpc.NewErrorResponse(id, jsonrpc.InternalError, err.Error(), nil)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+// handleCodeAction asks every LSP matching the document for code actions and
+// returns them concatenated, primary server first.
+func (h *Handler) handleCodeAction(ctx context.Context, msg *jsonrpc.Message, names []string) (*jsonrpc.Message, error) {
+	results := h.server.fanOut(ctx, names, msg.Method, msg.Params)
+	return jsonrpc.NewResponse(*msg.ID, h.server.mergeCodeActions(results))
+}
+
+// mergeCodeActions concatenates the actions and commands each server
+// returned, tagging actions with their server and recording the owner of
+// every command they carry.
+func (s *Server) mergeCodeActions(results []fanoutResult) []map[string]json.RawMessage {
+	merged := []map[string]json.RawMessage{}
+	for _, r := range results {
+		if r.err != nil || len(r.result) == 0 {
+			continue
+		}
+
+		var actions []map[string]json.RawMessage
+		if err := json.Unmarshal(r.result, &actions); err != nil {
+			continue
+		}
+		for _, action := range actions {
+			if action == nil {
+				continue
+			}
+			s.claimCodeAction(action, r.server)
+			merged = append(merged, action)
+		}
+	}
+	return merged
+}
+
+// claimCodeAction records server as the owner of a Command or CodeAction's
+// command and, for a CodeAction, tags its data.
+func (s *Server) claimCodeAction(action map[string]json.RawMessage, server string) {
+	// A bare Command has a string "command"; a CodeAction has a Command
+	// object there, if anything.
+	var command string
+	if json.Unmarshal(action["command"], &command) == nil && command != "" {
+		s.commands.record(command, server)
+		return
+	}
+
+	var nested struct {
+		Command string `json:"command"`
+	}
+	if json.Unmarshal(action["command"], &nested) == nil {
+		s.commands.record(nested.Command, server)
+	}
+
+	tagOrigin(action, server)
+}
+
+// handleCodeActionResolve routes codeAction/resolve to the server that
+// produced the action. Actions that weren't tagged fall through to the
+// default handling.
+func (h *Handler) handleCodeActionResolve(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, bool, error) {
+	var action map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &action); err != nil {
+		return nil, false, nil
+	}
+
+	lspName, ok := untagOrigin(action)
+	if !ok {
+		return nil, false, nil
+	}
+
+	inst, err := h.startInstance(ctx, lspName, true)
+	if err != nil {
+		resp, err := jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
+			fmt.Sprintf("starting LSP %s: %v", lspName, err), nil)
+		return resp, true, err
+	}
+
+	// Nothing to resolve; hand the action back as the server produced it.
+	if !h.server.supportsMethod(inst, msg.Method) {
+		resp, err := jsonrpc.NewResponse(*msg.ID, action)
+		return resp, true, err
+	}
+
+	result, err := h.server.call(ctx, lspName, inst, msg.Method, action)
+	if err != nil {
+		resp, err := callErrorResponse(*msg.ID, err)
+		return resp, true, err
+	}
+
+	var resolved map[string]json.RawMessage
+	if err := json.Unmarshal(result, &resolved); err != nil || resolved == nil {
+		resp, err := jsonrpc.NewResponse(*msg.ID, action)
+		return resp, true, err
+	}
+	h.server.claimCodeAction(resolved, lspName)
+
+	resp, err := jsonrpc.NewResponse(*msg.ID, resolved)
+	return resp, true, err
+}
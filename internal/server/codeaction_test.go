@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergeCodeActions(t *testing.T) {
+	s := &Server{commands: newCommandOwners()}
+	results := []fanoutResult{
+		{server: "gopls", result: json.RawMessage(`[
+			{"title": "Fill struct", "kind": "refactor.rewrite", "data": {"id": 1}},
+			{"title": "Run test", "command": "gopls.run_tests", "arguments": []}
+		]`)},
+		{server: "golangci-lint", result: json.RawMessage(`[
+			{"title": "Disable lint", "kind": "quickfix", "command": {"title": "Disable", "command": "golangci.disable"}}
+		]`)},
+		{server: "broken", result: json.RawMessage(`null`)},
+	}
+
+	merged := s.mergeCodeActions(results)
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 actions, got %d", len(merged))
+	}
+
+	server, ok := untagOrigin(merged[0])
+	if !ok || server != "gopls" {
+		t.Errorf("expected action tagged with gopls, got %q", server)
+	}
+	if string(merged[0]["data"]) != `{"id":1}` {
+		t.Errorf("expected original data restored, got %s", merged[0]["data"])
+	}
+
+	if _, ok := merged[1]["data"]; ok {
+		t.Error("expected a bare command to be left untagged")
+	}
+
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"gopls.run_tests", "gopls"},
+		{"golangci.disable", "golangci-lint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got, _ := s.commands.owner(tt.command); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
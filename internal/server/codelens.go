@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+// handleCodeLens asks every LSP matching the document for code lenses and
+// returns them concatenated, primary server first.
+func (h *Handler) handleCodeLens(ctx context.Context, msg *jsonrpc.Message, names []string) (*jsonrpc.Message, error) {
+	results := h.server.fanOut(ctx, names, msg.Method, msg.Params)
+	return jsonrpc.NewResponse(*msg.ID, h.server.mergeCodeLenses(results))
+}
+
+// mergeCodeLenses concatenates the lenses each server returned, tagging
+// them with their server and recording the owner of their commands.
+func (s *Server) mergeCodeLenses(results []fanoutResult) []map[string]json.RawMessage {
+	merged := []map[string]json.RawMessage{}
+	for _, r := range results {
+		if r.err != nil || len(r.result) == 0 {
+			continue
+		}
+
+		var lenses []map[string]json.RawMessage
+		if err := json.Unmarshal(r.result, &lenses); err != nil {
+			continue
+		}
+		for _, lens := range lenses {
+			if lens == nil {
+				continue
+			}
+			s.claimCodeLens(lens, r.server)
+			merged = append(merged, lens)
+		}
+	}
+	return merged
+}
+
+// claimCodeLens tags a lens's data with server and records server as the
+// owner of its command, if it has been resolved to one.
+func (s *Server) claimCodeLens(lens map[string]json.RawMessage, server string) {
+	var command struct {
+		Command string `json:"command"`
+	}
+	if json.Unmarshal(lens["command"], &command) == nil {
+		s.commands.record(command.Command, server)
+	}
+
+	tagOrigin(lens, server)
+}
+
+// handleCodeLensResolve routes codeLens/resolve to the server that produced
+// the lens. Lenses that weren't tagged fall through to the default handling.
+func (h *Handler) handleCodeLensResolve(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, bool, error) {
+	var lens map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &lens); err != nil {
+		return nil, false, nil
+	}
+
+	lspName, ok := untagOrigin(lens)
+	if !ok {
+		return nil, false, nil
+	}
+
+	inst, err := h.startInstance(ctx, lspName, true)
+	if err != nil {
+		resp, err := jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
+			fmt.Sprintf("starting LSP %s: %v", lspName, err), nil)
+		return resp, true, err
+	}
+
+	// Nothing to resolve; hand the lens back as the server produced it.
+	if !h.server.supportsMethod(inst, msg.Method) {
+		h.server.claimCodeLens(lens, lspName)
+		resp, err := jsonrpc.NewResponse(*msg.ID, lens)
+		return resp, true, err
+	}
+
+	result, err := h.server.call(ctx, lspName, inst, msg.Method, lens)
+	if err != nil {
+		resp, err := callErrorResponse(*msg.ID, err)
+		return resp, true, err
+	}
+
+	var resolved map[string]json.RawMessage
+	if err := json.Unmarshal(result, &resolved); err != nil || resolved == nil {
+		h.server.claimCodeLens(lens, lspName)
+		resp, err := jsonrpc.NewResponse(*msg.ID, lens)
+		return resp, true, err
+	}
+	h.server.claimCodeLens(resolved, lspName)
+
+	resp, err := jsonrpc.NewResponse(*msg.ID, resolved)
+	return resp, true, err
+}
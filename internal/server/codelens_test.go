@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergeCodeLenses(t *testing.T) {
+	s := &Server{commands: newCommandOwners()}
+	results := []fanoutResult{
+		{server: "gopls", result: json.RawMessage(`[
+			{"range": {"start": {"line": 4, "character": 0}, "end": {"line": 4, "character": 8}}, "command": {"title": "run test", "command": "gopls.run_tests"}},
+			{"range": {"start": {"line": 9, "character": 0}, "end": {"line": 9, "character": 8}}, "data": {"id": 2}}
+		]`)},
+		{server: "nil", result: json.RawMessage(`[
+			{"range": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 3}}, "command": {"title": "eval", "command": "nil.eval"}}
+		]`)},
+		{server: "broken", result: json.RawMessage(`null`)},
+	}
+
+	merged := s.mergeCodeLenses(results)
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 lenses, got %d", len(merged))
+	}
+
+	servers := []string{"gopls", "gopls", "nil"}
+	for i, lens := range merged {
+		if server, ok := untagOrigin(lens); !ok || server != servers[i] {
+			t.Errorf("lens %d: expected %q, got %q", i, servers[i], server)
+		}
+	}
+	if string(merged[1]["data"]) != `{"id":2}` {
+		t.Errorf("expected original data restored, got %s", merged[1]["data"])
+	}
+	if _, ok := merged[0]["data"]; ok {
+		t.Errorf("expected no data on a lens without any, got %s", merged[0]["data"])
+	}
+
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"gopls.run_tests", "gopls"},
+		{"nil.eval", "nil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got, _ := s.commands.owner(tt.command); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
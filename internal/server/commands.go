@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/amarbel-llc/lux/internal/capabilities"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// commandOwners remembers which server owns each command, so a
+// workspace/executeCommand goes to that server rather than being routed by
+// file. Commands are learned from the code actions a server offers and from
+// its dynamic workspace/executeCommand registrations.
+type commandOwners struct {
+	offered    map[string]string            // command -> server that offered it in a code action
+	registered map[registrationKey][]string // dynamic registration -> its commands
+	mu         sync.Mutex
+}
+
+func newCommandOwners() *commandOwners {
+	return &commandOwners{
+		offered:    make(map[string]string),
+		registered: make(map[registrationKey][]string),
+	}
+}
+
+func (c *commandOwners) record(command, server string) {
+	if command == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offered[command] = server
+}
+
+// offeredCommands returns a copy of the commands offered in code actions
+// and the server that offered each.
+func (c *commandOwners) offeredCommands() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	offered := make(map[string]string, len(c.offered))
+	for command, server := range c.offered {
+		offered[command] = server
+	}
+	return offered
+}
+
+// register records the commands of a server's workspace/executeCommand
+// registration.
+func (c *commandOwners) register(server, id string, options json.RawMessage) {
+	var opts struct {
+		Commands []string `json:"commands"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil || len(opts.Commands) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.registered[registrationKey{server: server, id: id}] = opts.Commands
+}
+
+func (c *commandOwners) unregister(server, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.registered, registrationKey{server: server, id: id})
+}
+
+// forget drops a server's dynamic registrations, e.g. because it stopped; it
+// registers them again when it restarts.
+func (c *commandOwners) forget(server string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.registered {
+		if key.server == server {
+			delete(c.registered, key)
+		}
+	}
+}
+
+// owner returns the server that offered command in a code action, else one
+// that registered it.
+func (c *commandOwners) owner(command string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if server, ok := c.offered[command]; ok {
+		return server, true
+	}
+	for key, commands := range c.registered {
+		if containsString(commands, command) {
+			return key.server, true
+		}
+	}
+	return "", false
+}
+
+// commandOwner returns the server to run a workspace/executeCommand on: the
+// one that offered or registered the command, else the first running server
+// whose capabilities advertise it, else the first configured server whose
+// cached capabilities do. It returns "" when no server owns the command.
+func (s *Server) commandOwner(params json.RawMessage) string {
+	var p struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.Command == "" {
+		return ""
+	}
+
+	if server, ok := s.commands.owner(p.Command); ok {
+		return server
+	}
+
+	for _, status := range s.pool.Status() {
+		inst, ok := s.pool.Get(status.Name)
+		if ok && advertisesCommand(inst.Capabilities, p.Command) {
+			return status.Name
+		}
+	}
+
+	s.mu.RLock()
+	lsps := s.cfg.LSPs
+	s.mu.RUnlock()
+	for _, l := range lsps {
+		cache, err := capabilities.LoadCache(l.Name)
+		if err == nil && advertisesCommand(&cache.Capabilities, p.Command) {
+			return l.Name
+		}
+	}
+	return ""
+}
+
+func advertisesCommand(caps *lsp.ServerCapabilities, command string) bool {
+	return caps != nil && caps.ExecuteCommandProvider != nil && containsString(caps.ExecuteCommandProvider.Commands, command)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCommandOwners(t *testing.T) {
+	c := newCommandOwners()
+	c.register("rust-analyzer", "1", json.RawMessage(`{"commands": ["rust-analyzer.runSingle", "shared.cmd"]}`))
+	c.register("taplo", "a", json.RawMessage(`{"commands": ["taplo.reload"]}`))
+	c.record("shared.cmd", "gopls")
+
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"rust-analyzer.runSingle", "rust-analyzer"},
+		{"taplo.reload", "taplo"},
+		{"shared.cmd", "gopls"}, // offered in a code action wins
+		{"unknown", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got, _ := c.owner(tt.command); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	c.unregister("taplo", "a")
+	if _, ok := c.owner("taplo.reload"); ok {
+		t.Error("expected taplo.reload to be unowned after unregistering")
+	}
+
+	c.forget("rust-analyzer")
+	if _, ok := c.owner("rust-analyzer.runSingle"); ok {
+		t.Error("expected rust-analyzer's commands to be forgotten")
+	}
+	if got, _ := c.owner("shared.cmd"); got != "gopls" {
+		t.Errorf("expected offered commands to survive, got %q", got)
+	}
+}
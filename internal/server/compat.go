@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// legacyKinds is the number of symbol and completion item kinds in the
+// first versions of the protocol (File to Array, and Text to Reference),
+// which clients that don't list the kinds they support are assumed to take.
+const legacyKinds = 18
+
+// newerSymbolKinds maps the symbol kinds added after the first versions of
+// the protocol to the closest original kind.
+var newerSymbolKinds = map[int]int{
+	19: 5,  // Object -> Class
+	20: 7,  // Key -> Property
+	21: 14, // Null -> Constant
+	22: 14, // EnumMember -> Constant
+	23: 5,  // Struct -> Class
+	24: 8,  // Event -> Field
+	25: 12, // Operator -> Function
+	26: 13, // TypeParameter -> Variable
+}
+
+// newerCompletionKinds does the same for completion item kinds.
+var newerCompletionKinds = map[int]int{
+	19: 17, // Folder -> File
+	20: 12, // EnumMember -> Value
+	21: 12, // Constant -> Value
+	22: 7,  // Struct -> Class
+	23: 5,  // Event -> Field
+	24: 1,  // Operator -> Text
+	25: 1,  // TypeParameter -> Text
+}
+
+// clientCompat is what an older client can take in responses, so answers
+// from newer servers can be downconverted for it. Backends are told the
+// client's capabilities, but not all of them honor the kinds it lists.
+type clientCompat struct {
+	documentSymbolKinds  map[int]bool // nil takes every kind
+	workspaceSymbolKinds map[int]bool
+	completionKinds      map[int]bool
+}
+
+// newClientCompat works out what the client that sent params can take. A
+// client listing the kinds it supports gets those. One that doesn't gets the
+// original kinds if it predates LSP 3.17, recognizable by the missing
+// general.positionEncodings; newer clients that leave the lists out are
+// taken to support every kind. It returns nil if nothing needs converting.
+func newClientCompat(params *lsp.InitializeParams, raw json.RawMessage) *clientCompat {
+	var shape struct {
+		Capabilities struct {
+			General struct {
+				PositionEncodings []string `json:"positionEncodings"`
+			} `json:"general"`
+		} `json:"capabilities"`
+	}
+	json.Unmarshal(raw, &shape)
+	legacy := shape.Capabilities.General.PositionEncodings == nil
+
+	kinds := func(caps *lsp.ValueSetCaps) map[int]bool {
+		if caps != nil && len(caps.ValueSet) > 0 {
+			set := make(map[int]bool, len(caps.ValueSet))
+			for _, kind := range caps.ValueSet {
+				set[kind] = true
+			}
+			return set
+		}
+		if !legacy {
+			return nil
+		}
+		set := make(map[int]bool, legacyKinds)
+		for kind := 1; kind <= legacyKinds; kind++ {
+			set[kind] = true
+		}
+		return set
+	}
+
+	var compat clientCompat
+	var documentSymbol, workspaceSymbol, completion *lsp.ValueSetCaps
+	if td := params.Capabilities.TextDocument; td != nil {
+		if td.DocumentSymbol != nil {
+			documentSymbol = td.DocumentSymbol.SymbolKind
+		}
+		if td.Completion != nil {
+			completion = td.Completion.CompletionItemKind
+		}
+	}
+	if ws := params.Capabilities.Workspace; ws != nil && ws.Symbol != nil {
+		workspaceSymbol = ws.Symbol.SymbolKind
+	}
+	compat.documentSymbolKinds = kinds(documentSymbol)
+	compat.workspaceSymbolKinds = kinds(workspaceSymbol)
+	compat.completionKinds = kinds(completion)
+
+	if compat.documentSymbolKinds == nil && compat.workspaceSymbolKinds == nil && compat.completionKinds == nil {
+		return nil
+	}
+	return &compat
+}
+
+// downconvert rewrites the kinds in resp, an answer to method, that the
+// client doesn't support.
+func (s *Server) downconvert(method string, resp *jsonrpc.Message) *jsonrpc.Message {
+	if resp == nil || resp.Error != nil || len(resp.Result) == 0 {
+		return resp
+	}
+	s.mu.RLock()
+	compat := s.compat
+	s.mu.RUnlock()
+	if compat == nil {
+		return resp
+	}
+
+	var converted json.RawMessage
+	switch method {
+	case lsp.MethodTextDocumentDocumentSymbol:
+		converted = convertKinds(resp.Result, compat.documentSymbolKinds, newerSymbolKinds, true)
+	case lsp.MethodWorkspaceSymbol, lsp.MethodWorkspaceSymbolResolve:
+		converted = convertKinds(resp.Result, compat.workspaceSymbolKinds, newerSymbolKinds, true)
+	case lsp.MethodTextDocumentCompletion:
+		converted = convertCompletionKinds(resp.Result, compat.completionKinds)
+	case lsp.MethodCompletionItemResolve:
+		converted = convertKinds(resp.Result, compat.completionKinds, newerCompletionKinds, false)
+	default:
+		return resp
+	}
+	if converted != nil {
+		resp.Result = converted
+	}
+	return resp
+}
+
+// convertCompletionKinds is convertKinds for a completion answer, either an
+// item array or a CompletionList.
+func convertCompletionKinds(result json.RawMessage, supported map[int]bool) json.RawMessage {
+	var list map[string]json.RawMessage
+	if json.Unmarshal(result, &list) != nil || list == nil {
+		return convertKinds(result, supported, newerCompletionKinds, false)
+	}
+	items := convertKinds(list["items"], supported, newerCompletionKinds, false)
+	if items == nil {
+		return nil
+	}
+	list["items"] = items
+	converted, err := json.Marshal(list)
+	if err != nil {
+		return nil
+	}
+	return converted
+}
+
+// convertKinds replaces the unsupported "kind" of every object in result, a
+// single object or an array of them, and, for symbols, of their children.
+// Kinds are mapped through fallbacks; a kind that still isn't supported is
+// dropped from completion items, where it is optional, and becomes the
+// lowest supported kind for symbols, where it isn't. It returns nil if
+// nothing changed.
+func convertKinds(result json.RawMessage, supported map[int]bool, fallbacks map[int]int, symbols bool) json.RawMessage {
+	if supported == nil {
+		return nil
+	}
+
+	changed := false
+	var convert func(obj map[string]json.RawMessage)
+	convert = func(obj map[string]json.RawMessage) {
+		var kind int
+		if json.Unmarshal(obj["kind"], &kind) == nil && kind != 0 && !supported[kind] {
+			changed = true
+			replacement, ok := fallbacks[kind]
+			switch {
+			case ok && supported[replacement]:
+				obj["kind"], _ = json.Marshal(replacement)
+			case symbols:
+				obj["kind"], _ = json.Marshal(lowestKind(supported))
+			default:
+				delete(obj, "kind")
+			}
+		}
+		if !symbols {
+			return
+		}
+		var children []map[string]json.RawMessage
+		if json.Unmarshal(obj["children"], &children) != nil || len(children) == 0 {
+			return
+		}
+		for _, child := range children {
+			if child != nil {
+				convert(child)
+			}
+		}
+		obj["children"], _ = json.Marshal(children)
+	}
+
+	var converted []byte
+	var objs []map[string]json.RawMessage
+	if err := json.Unmarshal(result, &objs); err == nil {
+		for _, obj := range objs {
+			if obj != nil {
+				convert(obj)
+			}
+		}
+		converted, _ = json.Marshal(objs)
+	} else {
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(result, &obj) != nil || obj == nil {
+			return nil
+		}
+		convert(obj)
+		converted, _ = json.Marshal(obj)
+	}
+
+	if !changed {
+		return nil
+	}
+	return converted
+}
+
+func lowestKind(supported map[int]bool) int {
+	lowest := 0
+	for kind := range supported {
+		if lowest == 0 || kind < lowest {
+			lowest = kind
+		}
+	}
+	return lowest
+}
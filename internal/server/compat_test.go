@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestServer_Downconvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		init     string
+		method   string
+		result   string
+		expected string
+	}{
+		{
+			name:     "legacy client gets original symbol kinds",
+			init:     `{"capabilities":{}}`,
+			method:   lsp.MethodTextDocumentDocumentSymbol,
+			result:   `[{"name":"Config","kind":23,"children":[{"name":"Load","kind":6},{"name":"T","kind":26}]}]`,
+			expected: `[{"children":[{"kind":6,"name":"Load"},{"kind":13,"name":"T"}],"kind":5,"name":"Config"}]`,
+		},
+		{
+			name:     "listed kinds are kept",
+			init:     `{"capabilities":{"workspace":{"symbol":{"symbolKind":{"valueSet":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,23]}}}}}`,
+			method:   lsp.MethodWorkspaceSymbol,
+			result:   `[{"name":"Config","kind":23},{"name":"Enabled","kind":22}]`,
+			expected: `[{"kind":23,"name":"Config"},{"kind":14,"name":"Enabled"}]`,
+		},
+		{
+			name:     "unmappable symbol kind becomes the lowest supported",
+			init:     `{"capabilities":{"textDocument":{"documentSymbol":{"symbolKind":{"valueSet":[12,13]}}}}}`,
+			method:   lsp.MethodTextDocumentDocumentSymbol,
+			result:   `[{"name":"Config","kind":23}]`,
+			expected: `[{"kind":12,"name":"Config"}]`,
+		},
+		{
+			name:     "completion list kinds",
+			init:     `{"capabilities":{}}`,
+			method:   lsp.MethodTextDocumentCompletion,
+			result:   `{"isIncomplete":false,"items":[{"label":"MaxSize","kind":21},{"label":"+","kind":24},{"label":"fmt","kind":9}]}`,
+			expected: `{"isIncomplete":false,"items":[{"kind":12,"label":"MaxSize"},{"kind":1,"label":"+"},{"kind":9,"label":"fmt"}]}`,
+		},
+		{
+			name:     "unsupported completion kind is dropped",
+			init:     `{"capabilities":{"textDocument":{"completion":{"completionItemKind":{"valueSet":[2,3]}}}}}`,
+			method:   lsp.MethodCompletionItemResolve,
+			result:   `{"label":"MaxSize","kind":21}`,
+			expected: `{"label":"MaxSize"}`,
+		},
+		{
+			name:     "nothing to convert",
+			init:     `{"capabilities":{}}`,
+			method:   lsp.MethodTextDocumentDocumentSymbol,
+			result:   `[{"name":"main","kind":12}]`,
+			expected: `[{"name":"main","kind":12}]`,
+		},
+		{
+			name:     "newer client gets every kind",
+			init:     `{"capabilities":{"general":{"positionEncodings":["utf-16"]}}}`,
+			method:   lsp.MethodTextDocumentDocumentSymbol,
+			result:   `[{"name":"Config","kind":23}]`,
+			expected: `[{"name":"Config","kind":23}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var params lsp.InitializeParams
+			if err := json.Unmarshal([]byte(tt.init), &params); err != nil {
+				t.Fatal(err)
+			}
+			s := &Server{compat: newClientCompat(&params, json.RawMessage(tt.init))}
+
+			resp, _ := jsonrpc.NewResponse(jsonrpc.NewNumberID(1), nil)
+			resp.Result = json.RawMessage(tt.result)
+			if got := s.downconvert(tt.method, resp); string(got.Result) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got.Result)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// handleMergedCompletion asks every LSP matching the document for
+// completions and returns them as a single list.
+func (h *Handler) handleMergedCompletion(ctx context.Context, msg *jsonrpc.Message, names []string) (*jsonrpc.Message, error) {
+	results := h.server.fanOut(ctx, names, msg.Method, msg.Params)
+	return jsonrpc.NewResponse(*msg.ID, mergeCompletions(results))
+}
+
+type completionList struct {
+	IsIncomplete bool                         `json:"isIncomplete"`
+	Items        []map[string]json.RawMessage `json:"items"`
+}
+
+// mergeCompletions concatenates completion items, primary server first. The
+// merged list is incomplete if any server's was, or if any server failed, so
+// the client asks again as the user keeps typing.
+//
+// Items from different servers that would insert the same text under the same
+// label are collapsed into the richer one. Distinct items that still share a
+// label get their server appended to labelDetails.description so the user can
+// tell them apart.
+func mergeCompletions(results []fanoutResult) completionList {
+	merged := completionList{Items: []map[string]json.RawMessage{}}
+
+	var entries []completionEntry
+	byKey := make(map[completionKey]int)
+
+	for _, r := range results {
+		if r.err != nil {
+			merged.IsIncomplete = true
+			continue
+		}
+		if len(r.result) == 0 {
+			continue
+		}
+
+		var list completionList
+		if err := json.Unmarshal(r.result, &list.Items); err != nil {
+			if err := json.Unmarshal(r.result, &list); err != nil {
+				merged.IsIncomplete = true
+				continue
+			}
+		}
+		merged.IsIncomplete = merged.IsIncomplete || list.IsIncomplete
+
+		for _, item := range list.Items {
+			if item == nil {
+				continue
+			}
+			entry := completionEntry{item: item, server: r.server, key: completionKeyOf(item)}
+
+			// A server may offer several items with the same text (e.g.
+			// overloads); only collapse duplicates across servers.
+			i, dup := byKey[entry.key]
+			if !dup || entries[i].server == r.server {
+				if !dup {
+					byKey[entry.key] = len(entries)
+				}
+				entries = append(entries, entry)
+				continue
+			}
+			if completionRichness(item) > completionRichness(entries[i].item) {
+				entries[i].item = item
+				entries[i].server = r.server
+			}
+		}
+	}
+
+	servers := make(map[string]map[string]bool)
+	for _, e := range entries {
+		if servers[e.key.label] == nil {
+			servers[e.key.label] = make(map[string]bool)
+		}
+		servers[e.key.label][e.server] = true
+	}
+
+	for _, e := range entries {
+		if len(servers[e.key.label]) > 1 {
+			annotateCompletionOrigin(e.item, e.server)
+		}
+		tagOrigin(e.item, e.server)
+		merged.Items = append(merged.Items, e.item)
+	}
+
+	return merged
+}
+
+type completionEntry struct {
+	item   map[string]json.RawMessage
+	server string
+	key    completionKey
+}
+
+// completionKey identifies items that are the same suggestion: what the list
+// shows and what accepting it inserts.
+type completionKey struct {
+	label      string
+	insertText string
+}
+
+func completionKeyOf(item map[string]json.RawMessage) completionKey {
+	var key completionKey
+	json.Unmarshal(item["label"], &key.label)
+
+	var textEdit struct {
+		NewText string `json:"newText"`
+	}
+	switch {
+	case json.Unmarshal(item["insertText"], &key.insertText) == nil && key.insertText != "":
+	case json.Unmarshal(item["textEdit"], &textEdit) == nil && textEdit.NewText != "":
+		key.insertText = textEdit.NewText
+	default:
+		key.insertText = key.label
+	}
+	return key
+}
+
+// completionRichness scores how much an item tells the user: documentation
+// counts most, then detail, then data the server can resolve more from.
+func completionRichness(item map[string]json.RawMessage) int {
+	score := 0
+	if len(item["documentation"]) > 0 && string(item["documentation"]) != "null" {
+		score += 4
+	}
+	if len(item["detail"]) > 0 && string(item["detail"]) != `""` {
+		score += 2
+	}
+	if len(item["data"]) > 0 && string(item["data"]) != "null" {
+		score++
+	}
+	return score
+}
+
+// annotateCompletionOrigin appends server to the item's
+// labelDetails.description.
+func annotateCompletionOrigin(item map[string]json.RawMessage, server string) {
+	var details map[string]json.RawMessage
+	json.Unmarshal(item["labelDetails"], &details)
+	if details == nil {
+		details = make(map[string]json.RawMessage)
+	}
+
+	var description string
+	json.Unmarshal(details["description"], &description)
+	if description == "" {
+		description = server
+	} else {
+		description += " · " + server
+	}
+
+	details["description"], _ = json.Marshal(description)
+	item["labelDetails"], _ = json.Marshal(details)
+}
+
+// resolvesCompletions reports whether lspName may be sent
+// completionItem/resolve: it advertises a resolveProvider or registered
+// completion dynamically, whose options lux doesn't track.
+func (s *Server) resolvesCompletions(lspName string) bool {
+	inst, ok := s.pool.Get(lspName)
+	if !ok {
+		return false
+	}
+	if caps := inst.Capabilities; caps != nil && caps.CompletionProvider != nil && caps.CompletionProvider.ResolveProvider {
+		return true
+	}
+	return s.registrations.registered(lspName, lsp.MethodTextDocumentCompletion)
+}
+
+// tagCompletionResult tags the items in one server's completion answer,
+// either an item array or a CompletionList, leaving everything else as the
+// server sent it. Items relying on the list's default data get it in their
+// tag, since a tagged item's own data overrides the default.
+func tagCompletionResult(result json.RawMessage, server string) json.RawMessage {
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(result, &items); err == nil {
+		for _, item := range items {
+			if item != nil {
+				tagOrigin(item, server)
+			}
+		}
+		if tagged, err := json.Marshal(items); err == nil {
+			return tagged
+		}
+		return result
+	}
+
+	var list map[string]json.RawMessage
+	if err := json.Unmarshal(result, &list); err != nil || list == nil {
+		return result
+	}
+	if err := json.Unmarshal(list["items"], &items); err != nil {
+		return result
+	}
+	var defaults struct {
+		Data json.RawMessage `json:"data"`
+	}
+	json.Unmarshal(list["itemDefaults"], &defaults)
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		if _, ok := item["data"]; !ok && len(defaults.Data) > 0 {
+			item["data"] = defaults.Data
+		}
+		tagOrigin(item, server)
+	}
+	list["items"], _ = json.Marshal(items)
+	if tagged, err := json.Marshal(list); err == nil {
+		return tagged
+	}
+	return result
+}
+
+// handleCompletionResolve routes completionItem/resolve to the server that
+// produced the item: resolve params carry no document to route by. Items
+// that weren't tagged fall through to the default handling.
+func (h *Handler) handleCompletionResolve(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, bool, error) {
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &item); err != nil {
+		return nil, false, nil
+	}
+
+	lspName, ok := untagOrigin(item)
+	if !ok {
+		return nil, false, nil
+	}
+
+	inst, err := h.startInstance(ctx, lspName, true)
+	if err != nil {
+		resp, err := jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
+			fmt.Sprintf("starting LSP %s: %v", lspName, err), nil)
+		return resp, true, err
+	}
+
+	// Nothing to resolve; hand the item back as the server produced it.
+	if caps := inst.Capabilities; caps != nil && (caps.CompletionProvider == nil || !caps.CompletionProvider.ResolveProvider) {
+		resp, err := jsonrpc.NewResponse(*msg.ID, item)
+		return resp, true, err
+	}
+
+	result, err := h.server.call(ctx, lspName, inst, msg.Method, item)
+	if err != nil {
+		resp, err := callErrorResponse(*msg.ID, err)
+		return resp, true, err
+	}
+
+	var resolved map[string]json.RawMessage
+	if err := json.Unmarshal(result, &resolved); err != nil || resolved == nil {
+		resp, err := jsonrpc.NewResponse(*msg.ID, item)
+		return resp, true, err
+	}
+	tagOrigin(resolved, lspName)
+
+	resp, err := jsonrpc.NewResponse(*msg.ID, resolved)
+	return resp, true, err
+}
+
+// mergeCompletionTargets returns the LSPs to merge completions from, or nil
+// when completion_mode is not "merge" or only one LSP matches.
+func (h *Handler) mergeCompletionTargets(msg *jsonrpc.Message) []string {
+	h.server.mu.RLock()
+	merge := h.server.cfg.MergesCompletions()
+	h.server.mu.RUnlock()
+	if !merge {
+		return nil
+	}
+
+	names := h.server.routeAll(msg.Method, msg.Params)
+	if len(names) < 2 {
+		return nil
+	}
+	return names
+}
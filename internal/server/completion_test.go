@@ -0,0 +1,233 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+func TestMergeCompletions(t *testing.T) {
+	tests := []struct {
+		name       string
+		results    []fanoutResult
+		incomplete bool
+		labels     []string
+	}{
+		{
+			name: "array and list",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`[{"label":"Println"}]`)},
+				{server: "snippets", result: json.RawMessage(`{"isIncomplete":false,"items":[{"label":"fori"}]}`)},
+			},
+			labels: []string{"Println", "fori"},
+		},
+		{
+			name: "incomplete list",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`[{"label":"Println"}]`)},
+				{server: "snippets", result: json.RawMessage(`{"isIncomplete":true,"items":[]}`)},
+			},
+			incomplete: true,
+			labels:     []string{"Println"},
+		},
+		{
+			name: "failed server",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`null`)},
+				{server: "snippets", err: errors.New("context deadline exceeded")},
+			},
+			incomplete: true,
+			labels:     nil,
+		},
+		{
+			name: "duplicates across servers",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`[{"label":"Println"},{"label":"Printf"}]`)},
+				{server: "snippets", result: json.RawMessage(`[{"label":"Println"},{"label":"fori"}]`)},
+			},
+			labels: []string{"Println", "Printf", "fori"},
+		},
+		{
+			name: "duplicates within a server",
+			results: []fanoutResult{
+				{server: "clangd", result: json.RawMessage(`[{"label":"max","detail":"int"},{"label":"max","detail":"float"}]`)},
+			},
+			labels: []string{"max", "max"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := mergeCompletions(tt.results)
+
+			if merged.IsIncomplete != tt.incomplete {
+				t.Errorf("expected isIncomplete %v, got %v", tt.incomplete, merged.IsIncomplete)
+			}
+
+			var labels []string
+			for _, item := range merged.Items {
+				var label string
+				json.Unmarshal(item["label"], &label)
+				labels = append(labels, label)
+			}
+			if len(labels) != len(tt.labels) {
+				t.Fatalf("expected %v, got %v", tt.labels, labels)
+			}
+			for i := range labels {
+				if labels[i] != tt.labels[i] {
+					t.Errorf("expected %v, got %v", tt.labels, labels)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestMergeCompletions_KeepsRicherDuplicate(t *testing.T) {
+	merged := mergeCompletions([]fanoutResult{
+		{server: "gopls", result: json.RawMessage(`[{"label":"Println"}]`)},
+		{server: "docs", result: json.RawMessage(`[{"label":"Println","documentation":"Println formats..."}]`)},
+	})
+
+	if len(merged.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(merged.Items))
+	}
+	item := merged.Items[0]
+	if _, ok := item["documentation"]; !ok {
+		t.Error("expected the documented item to be kept")
+	}
+	if server, _ := untagOrigin(item); server != "docs" {
+		t.Errorf("expected %q, got %q", "docs", server)
+	}
+	if _, ok := item["labelDetails"]; ok {
+		t.Errorf("expected no origin annotation on a collapsed duplicate, got %s", item["labelDetails"])
+	}
+}
+
+func TestMergeCompletions_AnnotatesLabelCollisions(t *testing.T) {
+	merged := mergeCompletions([]fanoutResult{
+		{server: "tsserver", result: json.RawMessage(`[{"label":"useState","insertText":"useState()","labelDetails":{"description":"react"}}]`)},
+		{server: "snippets", result: json.RawMessage(`[{"label":"useState","insertText":"const [$1, set$1] = useState($2)"}]`)},
+	})
+
+	expected := []string{"react · tsserver", "snippets"}
+	if len(merged.Items) != len(expected) {
+		t.Fatalf("expected %d items, got %d", len(expected), len(merged.Items))
+	}
+	for i, item := range merged.Items {
+		var details struct {
+			Description string `json:"description"`
+		}
+		json.Unmarshal(item["labelDetails"], &details)
+		if details.Description != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], details.Description)
+		}
+	}
+}
+
+func TestCompletionTagRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "with data", data: `{"id":42}`},
+		{name: "without data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := map[string]json.RawMessage{"label": json.RawMessage(`"Println"`)}
+			if tt.data != "" {
+				item["data"] = json.RawMessage(tt.data)
+			}
+
+			tagOrigin(item, "gopls")
+
+			// The client echoes the item back as JSON.
+			raw, _ := json.Marshal(item)
+			var echoed map[string]json.RawMessage
+			json.Unmarshal(raw, &echoed)
+
+			server, ok := untagOrigin(echoed)
+			if !ok {
+				t.Fatal("expected tagged item")
+			}
+			if server != "gopls" {
+				t.Errorf("expected %q, got %q", "gopls", server)
+			}
+			if string(echoed["data"]) != tt.data {
+				t.Errorf("expected %q, got %q", tt.data, echoed["data"])
+			}
+		})
+	}
+}
+
+func TestUntagForeignItem(t *testing.T) {
+	item := map[string]json.RawMessage{"data": json.RawMessage(`{"id":42}`)}
+	if _, ok := untagOrigin(item); ok {
+		t.Error("expected untagged item to be left alone")
+	}
+	if string(item["data"]) != `{"id":42}` {
+		t.Errorf("expected data to be preserved, got %q", item["data"])
+	}
+}
+
+func TestTagCompletionResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   string
+		expected string
+	}{
+		{
+			name:     "item array",
+			result:   `[{"label":"Println","data":1}]`,
+			expected: `[{"data":{"luxServer":"gopls","luxData":1},"label":"Println"}]`,
+		},
+		{
+			name:     "completion list keeps other fields",
+			result:   `{"isIncomplete":true,"items":[{"label":"Println"}]}`,
+			expected: `{"isIncomplete":true,"items":[{"data":{"luxServer":"gopls"},"label":"Println"}]}`,
+		},
+		{
+			name:     "default data moves into the tag",
+			result:   `{"isIncomplete":false,"itemDefaults":{"data":"d"},"items":[{"label":"a"},{"label":"b","data":"own"}]}`,
+			expected: `{"isIncomplete":false,"itemDefaults":{"data":"d"},"items":[{"data":{"luxServer":"gopls","luxData":"d"},"label":"a"},{"data":{"luxServer":"gopls","luxData":"own"},"label":"b"}]}`,
+		},
+		{
+			name:     "no completions",
+			result:   `null`,
+			expected: `null`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tagCompletionResult(json.RawMessage(tt.result), "gopls")
+			if string(got) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTagForFollowUp_OnlyResolvingServers(t *testing.T) {
+	s := &Server{pool: subprocess.NewPool(nil, nil), registrations: newRegistrationRegistry()}
+	s.pool.Register("gopls", subprocess.Registration{})
+	s.pool.Register("marksman", subprocess.Registration{})
+	gopls, _ := s.pool.Get("gopls")
+	gopls.Capabilities = &lsp.ServerCapabilities{CompletionProvider: &lsp.CompletionOptions{ResolveProvider: true}}
+	marksman, _ := s.pool.Get("marksman")
+	marksman.Capabilities = &lsp.ServerCapabilities{CompletionProvider: &lsp.CompletionOptions{}}
+
+	result := json.RawMessage(`[{"label":"Println"}]`)
+	if got := s.tagForFollowUp(lsp.MethodTextDocumentCompletion, result, "marksman"); string(got) != string(result) {
+		t.Errorf("expected a server without resolveProvider to be left untagged, got %s", got)
+	}
+	expected := `[{"data":{"luxServer":"gopls"},"label":"Println"}]`
+	if got := s.tagForFollowUp(lsp.MethodTextDocumentCompletion, result, "gopls"); string(got) != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
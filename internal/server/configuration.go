@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// handleDidChangeConfiguration fans a client workspace/didChangeConfiguration
+// out to every running backend, each receiving only the section under its
+// settings key with its configured settings laid over it. Backends that pull
+// settings treat the notification as the cue to send workspace/configuration.
+func (s *Server) handleDidChangeConfiguration(raw json.RawMessage) {
+	var params struct {
+		Settings map[string]any `json:"settings"`
+	}
+	json.Unmarshal(raw, &params)
+
+	for _, status := range s.pool.Status() {
+		if status.State != subprocess.LSPStateRunning.String() {
+			continue
+		}
+		inst, ok := s.pool.Get(status.Name)
+		if !ok {
+			continue
+		}
+
+		key, settings := inst.SettingsKey, inst.Settings
+		if key == "" {
+			key, _ = splitInstanceName(status.Name)
+		}
+		section, _ := params.Settings[key].(map[string]any)
+
+		relevant := map[string]any{}
+		if merged := overlaySettings(section, settings); merged != nil {
+			relevant[key] = merged
+		}
+		if err := inst.Notify(lsp.MethodWorkspaceDidChangeConfiguration, map[string]any{"settings": relevant}); err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] didChangeConfiguration to %s: %v\n", status.Name, err)
+		}
+	}
+}
+
+// overlaySettings deep-merges over onto base without modifying either;
+// values from over win.
+func overlaySettings(base, over map[string]any) map[string]any {
+	if len(over) == 0 {
+		return base
+	}
+	if len(base) == 0 {
+		return over
+	}
+
+	merged := make(map[string]any, len(base)+len(over))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range over {
+		baseMap, baseIsMap := merged[k].(map[string]any)
+		overMap, overIsMap := v.(map[string]any)
+		if baseIsMap && overIsMap {
+			merged[k] = overlaySettings(baseMap, overMap)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOverlaySettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     map[string]any
+		over     map[string]any
+		expected map[string]any
+	}{
+		{"no overlay", map[string]any{"a": 1}, nil, map[string]any{"a": 1}},
+		{"no base", nil, map[string]any{"a": 1}, map[string]any{"a": 1}},
+		{"neither", nil, nil, nil},
+		{
+			"nested",
+			map[string]any{"analyses": map[string]any{"unusedparams": true, "shadow": false}, "gofumpt": false},
+			map[string]any{"analyses": map[string]any{"shadow": true}, "staticcheck": true},
+			map[string]any{"analyses": map[string]any{"unusedparams": true, "shadow": true}, "gofumpt": false, "staticcheck": true},
+		},
+		{
+			"scalar replaces map",
+			map[string]any{"lint": map[string]any{"enabled": true}},
+			map[string]any{"lint": false},
+			map[string]any{"lint": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlaySettings(tt.base, tt.over); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
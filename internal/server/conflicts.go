@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// editConflictSource is the diagnostic source, and the name diagnostics
+// are aggregated under, of edit conflicts lux reports itself.
+const editConflictSource = "lux"
+
+// editConflict is a server whose edits to uri were dropped, by composeEdits
+// or mergeWorkspaceEdits, because they conflict with with's.
+type editConflict struct {
+	server string
+	with   string
+	uri    lsp.DocumentURI
+	// edit is the first of the server's edits that overlapped one already
+	// accepted from with. It is zero when the server created, renamed, or
+	// deleted a file with changed (see file).
+	edit lsp.TextEdit
+	file bool
+}
+
+// reportEditConflicts logs the edits dropped from the answers to method and
+// shows the client where they were, as warnings on the ranges the dropped
+// edits touched, so the user can apply the lost fixes by hand. Conflicts
+// reported earlier for uris, the documents the answers changed, are
+// replaced, clearing them once servers agree.
+func (s *Server) reportEditConflicts(method string, uris []lsp.DocumentURI, conflicts []editConflict) {
+	severity := lsp.DiagnosticSeverityWarning
+	byURI := make(map[lsp.DocumentURI][]lsp.Diagnostic)
+	for _, uri := range uris {
+		byURI[uri] = []lsp.Diagnostic{}
+	}
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "[lux] dropping %s edits from %s: they conflict with %s's changes to %s\n", method, c.server, c.with, c.uri)
+		message := fmt.Sprintf("%s and %s disagree on this edit; %s's edits were not applied", c.with, c.server, c.server)
+		if c.file {
+			message = fmt.Sprintf("%s and %s disagree on changes to this file; %s's edits were not applied", c.with, c.server, c.server)
+		}
+		byURI[c.uri] = append(byURI[c.uri], lsp.Diagnostic{
+			Range:    c.edit.Range,
+			Severity: &severity,
+			Source:   editConflictSource,
+			Message:  message,
+		})
+	}
+
+	for uri, diagnostics := range byURI {
+		if len(diagnostics) == 0 && !s.diagnostics.reported(editConflictSource, uri) {
+			continue
+		}
+		params, err := json.Marshal(lsp.PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+		if err != nil {
+			continue
+		}
+		s.publishDiagnostics(editConflictSource, params)
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// ApplyDiagnosticConfig applies l's diagnostic_filter and diagnostic_source
+// config to a publishDiagnostics notification or a diagnostic report for
+// uri. The LSP server, the MCP server and `lux check` all shape diagnostics
+// through it. A nil l leaves raw alone.
+func ApplyDiagnosticConfig(l *config.LSP, uri lsp.DocumentURI, raw json.RawMessage) json.RawMessage {
+	if l == nil {
+		return raw
+	}
+	if drop := l.DiagnosticDropper(uri.Path()); drop != nil {
+		raw = lsp.FilterDiagnostics(raw, drop)
+	}
+	if l.DiagnosticSource != nil {
+		raw = lsp.RewriteDiagnosticSources(raw, l.RewriteDiagnosticSource)
+	}
+	return raw
+}
+
+// diagnosticsAggregator merges textDocument/publishDiagnostics from every
+// backend that reports on a URI, so one server's diagnostics don't replace
+// another's in the client.
+type diagnosticsAggregator struct {
+	// byURI holds the latest diagnostics per URI and server. Diagnostics are
+	// kept as raw objects so fields lux doesn't model pass through.
+	byURI map[lsp.DocumentURI]map[string][]map[string]json.RawMessage
+	mu    sync.Mutex
+}
+
+func newDiagnosticsAggregator() *diagnosticsAggregator {
+	return &diagnosticsAggregator{
+		byURI: make(map[lsp.DocumentURI]map[string][]map[string]json.RawMessage),
+	}
+}
+
+type rawPublishDiagnostics struct {
+	URI         lsp.DocumentURI              `json:"uri"`
+	Version     *int                         `json:"version,omitempty"`
+	Diagnostics []map[string]json.RawMessage `json:"diagnostics"`
+}
+
+// update records server's diagnostics and returns the combined notification
+// params for the URI. Diagnostics without a source are tagged with the server
+// name.
+func (a *diagnosticsAggregator) update(server string, params json.RawMessage) (json.RawMessage, error) {
+	var p rawPublishDiagnostics
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+
+	tag, _ := json.Marshal(server)
+	for _, d := range p.Diagnostics {
+		if _, ok := d["source"]; !ok {
+			d["source"] = tag
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	servers := a.byURI[p.URI]
+	if len(p.Diagnostics) == 0 {
+		delete(servers, server)
+	} else {
+		if servers == nil {
+			servers = make(map[string][]map[string]json.RawMessage)
+			a.byURI[p.URI] = servers
+		}
+		servers[server] = p.Diagnostics
+	}
+	if len(servers) == 0 {
+		delete(a.byURI, p.URI)
+	}
+
+	return json.Marshal(rawPublishDiagnostics{
+		URI:         p.URI,
+		Version:     p.Version,
+		Diagnostics: a.mergedLocked(p.URI),
+	})
+}
+
+// forget drops everything reported by server (e.g. after it is removed from
+// the config) and returns combined params for each URI that changed.
+func (a *diagnosticsAggregator) forget(server string) []json.RawMessage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var out []json.RawMessage
+	for uri, servers := range a.byURI {
+		if _, ok := servers[server]; !ok {
+			continue
+		}
+		delete(servers, server)
+		if len(servers) == 0 {
+			delete(a.byURI, uri)
+		}
+
+		params, err := json.Marshal(rawPublishDiagnostics{
+			URI:         uri,
+			Diagnostics: a.mergedLocked(uri),
+		})
+		if err == nil {
+			out = append(out, params)
+		}
+	}
+	return out
+}
+
+// reported reports whether server has diagnostics recorded for uri.
+func (a *diagnosticsAggregator) reported(server string, uri lsp.DocumentURI) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.byURI[uri][server]
+	return ok
+}
+
+func (a *diagnosticsAggregator) mergedLocked(uri lsp.DocumentURI) []map[string]json.RawMessage {
+	servers := a.byURI[uri]
+
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	merged := []map[string]json.RawMessage{}
+	for _, name := range names {
+		merged = append(merged, servers[name]...)
+	}
+	return merged
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func decodeSources(t *testing.T, params json.RawMessage) []string {
+	t.Helper()
+
+	var p struct {
+		Diagnostics []struct {
+			Source string `json:"source"`
+		} `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		t.Fatalf("decoding merged params: %v", err)
+	}
+
+	sources := make([]string, 0, len(p.Diagnostics))
+	for _, d := range p.Diagnostics {
+		sources = append(sources, d.Source)
+	}
+	return sources
+}
+
+func TestDiagnosticsAggregator(t *testing.T) {
+	a := newDiagnosticsAggregator()
+	uri := "file:///src/app.ts"
+
+	publish := func(server, diags string) []string {
+		t.Helper()
+		merged, err := a.update(server, json.RawMessage(`{"uri":"`+uri+`","diagnostics":`+diags+`}`))
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		return decodeSources(t, merged)
+	}
+
+	tests := []struct {
+		name     string
+		server   string
+		diags    string
+		expected []string
+	}{
+		{"first server", "tsserver", `[{"message":"a","source":"ts"}]`, []string{"ts"}},
+		{"second server is merged and tagged", "eslint", `[{"message":"b"}]`, []string{"eslint", "ts"}},
+		{"update replaces only that server", "tsserver", `[{"message":"c","source":"ts"},{"message":"d","source":"ts"}]`, []string{"eslint", "ts", "ts"}},
+		{"clearing one server keeps the other", "eslint", `[]`, []string{"ts", "ts"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := publish(tt.server, tt.diags)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("expected %v, got %v", tt.expected, got)
+					break
+				}
+			}
+		})
+	}
+
+	cleared := a.forget("tsserver")
+	if len(cleared) != 1 || len(decodeSources(t, cleared[0])) != 0 {
+		t.Errorf("expected one cleared URI after forget, got %s", cleared)
+	}
+}
+
+func TestServer_ApplyDiagnosticConfig(t *testing.T) {
+	s := &Server{cfg: &config.Config{LSPs: []config.LSP{{
+		Name:             "golangci",
+		DiagnosticFilter: &config.DiagnosticFilter{MinSeverity: "warning", ExcludeSources: []string{"misspell"}},
+	}}}}
+
+	params := json.RawMessage(`{"uri":"file:///src/main.go","diagnostics":[
+		{"message":"a","severity":1,"source":"govet"},
+		{"message":"b","severity":4,"source":"govet"},
+		{"message":"c","severity":2,"source":"misspell"}
+	]}`)
+	if got := decodeSources(t, s.applyDiagnosticConfig("golangci", "file:///src/main.go", params)); len(got) != 1 || got[0] != "govet" {
+		t.Errorf("expected only the govet error to be kept, got %v", got)
+	}
+
+	report := json.RawMessage(`{"kind":"full","items":[{"message":"b","severity":4}]}`)
+	if got := s.applyDiagnosticConfig("golangci", "file:///src/main.go", report); string(got) != `{"items":[],"kind":"full"}` {
+		t.Errorf("expected the report's items to be filtered, got %s", got)
+	}
+
+	if got := s.applyDiagnosticConfig("gopls", "file:///src/main.go", params); string(got) != string(params) {
+		t.Errorf("expected servers without a filter to be left alone, got %s", got)
+	}
+}
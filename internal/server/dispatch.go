@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"golang.org/x/sync/errgroup"
+)
+
+// dispatchConcurrency bounds how many messages from one connection are
+// handled at once.
+const dispatchConcurrency = 32
+
+// dispatcher runs one connection's messages on an errgroup limited to n
+// workers. It is the connection's subprocess.Dispatch, called as each
+// message is read, and waits there until a worker is free, so during a
+// message storm (a client replaying edits, a backend flooding progress) at
+// most n handlers run and the rest of the storm stays unread in the pipe.
+// close waits for the group, so shutdown knows every handler has returned
+// before the backends they use are stopped. It is the first stage of
+// requestScheduler.
+type dispatcher struct {
+	group  errgroup.Group
+	closed bool
+	mu     sync.RWMutex
+}
+
+func newDispatcher(n int) *dispatcher {
+	d := &dispatcher{}
+	d.group.SetLimit(n)
+	return d
+}
+
+// bypassesDispatch reports whether messages of method are handled without
+// waiting for a worker: cancellations, shutdown, and exit must get through
+// while every worker is busy with the requests they are about, and protocol
+// notifications like $/progress are cheap to handle.
+func bypassesDispatch(method string) bool {
+	return strings.HasPrefix(method, "$/") ||
+		method == lsp.MethodWindowWorkDoneProgressCancel ||
+		method == lsp.MethodShutdown ||
+		method == lsp.MethodExit
+}
+
+// Dispatch runs handle on one of the dispatcher's workers, waiting for one
+// to be free first. Messages arriving once the dispatcher is closed are
+// refused.
+func (d *dispatcher) Dispatch(ctx context.Context, msg *jsonrpc.Message, handle func()) bool {
+	if bypassesDispatch(msg.Method) {
+		go handle()
+		return true
+	}
+
+	// The read lock is held until the message is in the group, so close
+	// can't start waiting for the group while a message is being added.
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return false
+	}
+	d.group.Go(func() error {
+		handle()
+		return nil
+	})
+	return true
+}
+
+// close stops the dispatcher taking new messages and waits for those already
+// taken to be handled. Handlers are expected to return promptly once their
+// connection's context is cancelled.
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.group.Wait()
+}
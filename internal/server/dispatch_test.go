@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestDispatcher_BoundsConcurrency(t *testing.T) {
+	d := newDispatcher(2)
+	release := make(chan struct{})
+	var running, peak atomic.Int32
+	handle := func() {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+	}
+	hover, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), lsp.MethodTextDocumentHover, json.RawMessage(`{}`))
+
+	// Dispatch is called by the connection's read loop, which it holds once
+	// every worker is busy.
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		for i := 0; i < 5; i++ {
+			d.Dispatch(context.Background(), hover, handle)
+		}
+	}()
+	select {
+	case <-read:
+		t.Fatal("expected reading to wait for a free worker")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Cancellations get through while every worker is busy.
+	cancel, _ := jsonrpc.NewNotification(lsp.MethodCancelRequest, json.RawMessage(`{"id":1}`))
+	cancelled := make(chan struct{})
+	d.Dispatch(context.Background(), cancel, func() { close(cancelled) })
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the cancellation not to wait for a worker")
+	}
+
+	close(release)
+	<-read
+	d.close()
+	if got := peak.Load(); got > 2 {
+		t.Errorf("expected at most 2 messages handled at once, got %d", got)
+	}
+}
+
+func TestDispatcher_RefusesAfterClose(t *testing.T) {
+	d := newDispatcher(1)
+	d.close()
+
+	msg, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), lsp.MethodTextDocumentHover, json.RawMessage(`{}`))
+	if d.Dispatch(context.Background(), msg, func() { t.Error("expected the message not to be handled") }) {
+		t.Error("expected the message to be refused")
+	}
+}
+
+func TestDispatcher_CloseWaitsForHandlers(t *testing.T) {
+	d := newDispatcher(1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished atomic.Bool
+
+	msg, _ := jsonrpc.NewNotification(lsp.MethodTextDocumentDidSave, json.RawMessage(`{}`))
+	d.Dispatch(context.Background(), msg, func() {
+		close(started)
+		<-release
+		finished.Store(true)
+	})
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		d.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("expected close to wait for the running handler")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	<-closed
+	if !finished.Load() {
+		t.Error("expected the handler to have finished when close returned")
+	}
+}
@@ -0,0 +1,369 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// openDocument is the client's view of an open document.
+type openDocument struct {
+	languageID string
+	version    int
+	text       string
+}
+
+// documentStore keeps the text of every document the client has open and
+// which version each backend has seen, so a backend that starts (or restarts)
+// after documents were opened can be sent didOpen for them before anything
+// else, and isn't sent changes or closes for documents it never saw.
+//
+// mu guards the maps and is never held while sending: a backend's Notify
+// takes its instance lock, and the pool calls forget from a state change
+// while holding that same lock. Notifications to one server are instead
+// ordered by that server's send lock.
+type documentStore struct {
+	docs    map[lsp.DocumentURI]*openDocument
+	servers map[string]*serverDocuments
+	mu      sync.Mutex
+}
+
+// serverDocuments is what one server has been sent. forget replaces it, so a
+// send already under way records into the forgotten copy. sent and swapped
+// are guarded by documentStore.mu.
+type serverDocuments struct {
+	sent    map[lsp.DocumentURI]int  // uri -> version sent
+	swapped map[lsp.DocumentURI]bool // shown other text by withText
+	send    sync.Mutex
+}
+
+func newDocumentStore() *documentStore {
+	return &documentStore{
+		docs:    make(map[lsp.DocumentURI]*openDocument),
+		servers: make(map[string]*serverDocuments),
+	}
+}
+
+// server returns what server has been sent, locked for sending. The caller
+// must unlock its send lock.
+func (d *documentStore) server(server string) *serverDocuments {
+	d.mu.Lock()
+	sd, ok := d.servers[server]
+	if !ok {
+		sd = &serverDocuments{
+			sent:    make(map[lsp.DocumentURI]int),
+			swapped: make(map[lsp.DocumentURI]bool),
+		}
+		d.servers[server] = sd
+	}
+	d.mu.Unlock()
+
+	sd.send.Lock()
+	return sd
+}
+
+// notifier is the part of an LSP instance the store sends through.
+type notifier interface {
+	Notify(method string, params any) error
+}
+
+// apply records a didOpen, didChange, or didClose from the client. Changes
+// older than the stored version are ignored, since the client connection
+// handles messages concurrently.
+func (d *documentStore) apply(method string, params json.RawMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch method {
+	case lsp.MethodTextDocumentDidOpen:
+		var p lsp.DidOpenTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		d.docs[p.TextDocument.URI] = &openDocument{
+			languageID: p.TextDocument.LanguageID,
+			version:    p.TextDocument.Version,
+			text:       p.TextDocument.Text,
+		}
+
+	case lsp.MethodTextDocumentDidChange:
+		var p lsp.DidChangeTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		doc, ok := d.docs[p.TextDocument.URI]
+		if !ok || p.TextDocument.Version <= doc.version {
+			return
+		}
+		for _, change := range p.ContentChanges {
+			doc.text = applyContentChange(doc.text, change)
+		}
+		doc.version = p.TextDocument.Version
+
+	case lsp.MethodTextDocumentDidClose:
+		var p lsp.DidCloseTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		delete(d.docs, p.TextDocument.URI)
+	}
+}
+
+// replay sends didOpen to server for every open document it should have but
+// hasn't been sent. routes reports whether a document is routed to server.
+func (d *documentStore) replay(server string, inst notifier, routes func(lsp.DocumentURI) bool) error {
+	sd := d.server(server)
+	defer sd.send.Unlock()
+
+	d.mu.Lock()
+	var opens []lsp.TextDocumentItem
+	for uri, doc := range d.docs {
+		if _, ok := sd.sent[uri]; ok || !routes(uri) {
+			continue
+		}
+		sd.sent[uri] = doc.version
+		opens = append(opens, doc.item(uri))
+	}
+	d.mu.Unlock()
+
+	for _, item := range opens {
+		if err := notifyOpen(inst, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forward sends a client didOpen, didChange, or didClose for uri to server,
+// skipping what the server already has: a didOpen or didChange whose version
+// replay already sent, or a didClose for a document it was never sent.
+func (d *documentStore) forward(server string, inst notifier, method string, uri lsp.DocumentURI, params json.RawMessage) error {
+	sd := d.server(server)
+	defer sd.send.Unlock()
+
+	d.mu.Lock()
+	sentVersion, opened := sd.sent[uri]
+
+	switch method {
+	case lsp.MethodTextDocumentDidOpen:
+		doc, ok := d.docs[uri]
+		if opened || !ok {
+			d.mu.Unlock()
+			return nil
+		}
+		sd.sent[uri] = doc.version
+		item := doc.item(uri)
+		d.mu.Unlock()
+		return notifyOpen(inst, item)
+
+	case lsp.MethodTextDocumentDidChange:
+		// A swapped document is sent the client's text when it is
+		// restored, changes included.
+		var p lsp.DidChangeTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil || !opened || sd.swapped[uri] || p.TextDocument.Version <= sentVersion {
+			d.mu.Unlock()
+			return nil
+		}
+		sd.sent[uri] = p.TextDocument.Version
+
+	case lsp.MethodTextDocumentDidClose:
+		if !opened {
+			d.mu.Unlock()
+			return nil
+		}
+		delete(sd.sent, uri)
+		delete(sd.swapped, uri)
+	}
+	d.mu.Unlock()
+
+	return inst.Notify(method, params)
+}
+
+// opened reports whether server has been sent didOpen for uri.
+func (d *documentStore) opened(server string, uri lsp.DocumentURI) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sd, ok := d.servers[server]
+	if !ok {
+		return false
+	}
+	_, ok = sd.sent[uri]
+	return ok
+}
+
+// forget drops what server has been sent, e.g. because it stopped; a new
+// process starts with no documents open. It doesn't wait for sends under way.
+func (d *documentStore) forget(server string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.servers, server)
+}
+
+// withText runs fn while server sees text as the content of uri, then
+// restores the client's content. The swap is a close and reopen at the
+// client's version, since versions may only increase within an open
+// document. While fn runs, the client's changes to uri are held back from
+// server, to be sent with the restored content, and the diagnostics server
+// publishes for uri are dropped (see swapped): they are about text the user
+// never had.
+func (d *documentStore) withText(server string, inst notifier, uri lsp.DocumentURI, text string, fn func() error) error {
+	sd := d.server(server)
+
+	d.mu.Lock()
+	doc, ok := d.docs[uri]
+	_, opened := sd.sent[uri]
+	busy := sd.swapped[uri]
+	if !ok || !opened || busy {
+		d.mu.Unlock()
+		sd.send.Unlock()
+		if busy {
+			return fmt.Errorf("%s is already showing other text to %s", uri, server)
+		}
+		return fmt.Errorf("%s is not open in %s", uri, server)
+	}
+	sd.swapped[uri] = true
+	item := doc.item(uri)
+	d.mu.Unlock()
+
+	item.Text = text
+	err := reopen(inst, item)
+	sd.send.Unlock()
+
+	if err == nil {
+		err = fn()
+	}
+
+	sd.send.Lock()
+	defer sd.send.Unlock()
+
+	d.mu.Lock()
+	delete(sd.swapped, uri)
+	_, opened = sd.sent[uri]
+	doc, ok = d.docs[uri]
+	// A server forgotten meanwhile has restarted and been sent the client's
+	// text; a document closed meanwhile has been closed in server too.
+	if d.servers[server] != sd || !opened || !ok {
+		d.mu.Unlock()
+		return err
+	}
+	sd.sent[uri] = doc.version
+	item = doc.item(uri)
+	d.mu.Unlock()
+
+	if restoreErr := reopen(inst, item); restoreErr != nil {
+		return restoreErr
+	}
+	return err
+}
+
+// swapped reports whether server is being shown text for uri other than the
+// client's.
+func (d *documentStore) swapped(server string, uri lsp.DocumentURI) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sd, ok := d.servers[server]
+	return ok && sd.swapped[uri]
+}
+
+// text returns the client's content of uri, if it is open.
+func (d *documentStore) text(uri lsp.DocumentURI) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	doc, ok := d.docs[uri]
+	if !ok {
+		return "", false
+	}
+	return doc.text, true
+}
+
+// version returns the client's version of uri, if it is open.
+func (d *documentStore) version(uri lsp.DocumentURI) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	doc, ok := d.docs[uri]
+	if !ok {
+		return 0, false
+	}
+	return doc.version, true
+}
+
+// snapshot returns a copy of every open document.
+func (d *documentStore) snapshot() map[lsp.DocumentURI]openDocument {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	docs := make(map[lsp.DocumentURI]openDocument, len(d.docs))
+	for uri, doc := range d.docs {
+		docs[uri] = *doc
+	}
+	return docs
+}
+
+func (doc *openDocument) item(uri lsp.DocumentURI) lsp.TextDocumentItem {
+	return lsp.TextDocumentItem{
+		URI:        uri,
+		LanguageID: doc.languageID,
+		Version:    doc.version,
+		Text:       doc.text,
+	}
+}
+
+// reopen closes item's document in inst and opens it again as item.
+func reopen(inst notifier, item lsp.TextDocumentItem) error {
+	if err := inst.Notify(lsp.MethodTextDocumentDidClose, lsp.DidCloseTextDocumentParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: item.URI},
+	}); err != nil {
+		return err
+	}
+	return notifyOpen(inst, item)
+}
+
+func notifyOpen(inst notifier, item lsp.TextDocumentItem) error {
+	return inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{TextDocument: item})
+}
+
+// applyContentChange applies one didChange content change: a full
+// replacement, or an edit whose range is in UTF-16 code units.
+func applyContentChange(text string, change lsp.TextDocumentContentChangeEvent) string {
+	if change.Range == nil {
+		return change.Text
+	}
+
+	start := offsetAt(text, change.Range.Start)
+	end := offsetAt(text, change.Range.End)
+	if end < start {
+		end = start
+	}
+	return text[:start] + change.Text + text[end:]
+}
+
+// offsetAt converts an LSP position to a byte offset in text, clamping to the
+// end of the line or document.
+func offsetAt(text string, pos lsp.Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+
+	units := 0
+	for offset < len(text) && text[offset] != '\n' && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+		offset += size
+	}
+	return offset
+}
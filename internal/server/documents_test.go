@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+type recordingNotifier struct {
+	methods []string
+	params  []any
+}
+
+func (n *recordingNotifier) Notify(method string, params any) error {
+	n.methods = append(n.methods, method)
+	n.params = append(n.params, params)
+	return nil
+}
+
+func TestDocumentStore_Replay(t *testing.T) {
+	d := newDocumentStore()
+	uri := lsp.DocumentURI("file:///src/main.go")
+
+	d.apply(lsp.MethodTextDocumentDidOpen, json.RawMessage(`{"textDocument":{"uri":"file:///src/main.go","languageId":"go","version":1,"text":"package main\n"}}`))
+	d.apply(lsp.MethodTextDocumentDidOpen, json.RawMessage(`{"textDocument":{"uri":"file:///src/app.py","languageId":"python","version":1,"text":""}}`))
+	d.apply(lsp.MethodTextDocumentDidChange, json.RawMessage(`{"textDocument":{"uri":"file:///src/main.go","version":2},"contentChanges":[{"text":"package main\n\nfunc main() {}\n"}]}`))
+
+	gopls := &recordingNotifier{}
+	d.replay("gopls", gopls, func(u lsp.DocumentURI) bool { return u == uri })
+
+	if len(gopls.methods) != 1 || gopls.methods[0] != lsp.MethodTextDocumentDidOpen {
+		t.Fatalf("expected one didOpen, got %v", gopls.methods)
+	}
+	opened := gopls.params[0].(lsp.DidOpenTextDocumentParams).TextDocument
+	if opened.Version != 2 || opened.Text != "package main\n\nfunc main() {}\n" || opened.LanguageID != "go" {
+		t.Errorf("expected the current text at version 2, got %+v", opened)
+	}
+
+	// The client's own didOpen and the change already replayed are not sent
+	// again; later changes are.
+	d.forward("gopls", gopls, lsp.MethodTextDocumentDidOpen, uri, nil)
+	d.forward("gopls", gopls, lsp.MethodTextDocumentDidChange, uri, json.RawMessage(`{"textDocument":{"uri":"file:///src/main.go","version":2},"contentChanges":[]}`))
+	d.forward("gopls", gopls, lsp.MethodTextDocumentDidChange, uri, json.RawMessage(`{"textDocument":{"uri":"file:///src/main.go","version":3},"contentChanges":[]}`))
+	if len(gopls.methods) != 2 || gopls.methods[1] != lsp.MethodTextDocumentDidChange {
+		t.Errorf("expected only the version 3 change to be forwarded, got %v", gopls.methods)
+	}
+
+	d.forget("gopls")
+	if d.opened("gopls", uri) {
+		t.Error("expected a forgotten server to have nothing open")
+	}
+
+	restarted := &recordingNotifier{}
+	d.forward("gopls", restarted, lsp.MethodTextDocumentDidClose, uri, nil)
+	if len(restarted.methods) != 0 {
+		t.Errorf("expected no didClose for a document the server never saw, got %v", restarted.methods)
+	}
+}
+
+// forgettingNotifier forgets its server while sending, as a backend that
+// crashes mid-send does through the pool's state handler.
+type forgettingNotifier struct {
+	store  *documentStore
+	server string
+}
+
+func (n *forgettingNotifier) Notify(method string, params any) error {
+	n.store.forget(n.server)
+	return nil
+}
+
+func TestDocumentStore_ForgetWhileSending(t *testing.T) {
+	d := newDocumentStore()
+	uri := lsp.DocumentURI("file:///src/main.go")
+	d.apply(lsp.MethodTextDocumentDidOpen, json.RawMessage(`{"textDocument":{"uri":"file:///src/main.go","languageId":"go","version":1,"text":""}}`))
+
+	done := make(chan struct{})
+	go func() {
+		inst := &forgettingNotifier{store: d, server: "gopls"}
+		d.replay("gopls", inst, func(lsp.DocumentURI) bool { return true })
+		d.forward("gopls", inst, lsp.MethodTextDocumentDidOpen, uri, nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected forget not to wait on a send under way")
+	}
+
+	if d.opened("gopls", uri) {
+		t.Error("expected the forgotten server to have nothing open")
+	}
+}
+
+func TestApplyContentChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		change   lsp.TextDocumentContentChangeEvent
+		expected string
+	}{
+		{
+			name:     "full",
+			text:     "old",
+			change:   lsp.TextDocumentContentChangeEvent{Text: "new"},
+			expected: "new",
+		},
+		{
+			name: "insert",
+			text: "a\nbc\n",
+			change: lsp.TextDocumentContentChangeEvent{
+				Range: &lsp.Range{Start: lsp.Position{Line: 1, Character: 1}, End: lsp.Position{Line: 1, Character: 1}},
+				Text:  "X",
+			},
+			expected: "a\nbXc\n",
+		},
+		{
+			name: "replace across lines",
+			text: "one\ntwo\nthree",
+			change: lsp.TextDocumentContentChangeEvent{
+				Range: &lsp.Range{Start: lsp.Position{Line: 0, Character: 2}, End: lsp.Position{Line: 2, Character: 1}},
+				Text:  "-",
+			},
+			expected: "on-hree",
+		},
+		{
+			name: "utf-16 columns",
+			text: "x := \"😀\" + y",
+			change: lsp.TextDocumentContentChangeEvent{
+				Range: &lsp.Range{Start: lsp.Position{Line: 0, Character: 12}, End: lsp.Position{Line: 0, Character: 13}},
+				Text:  "z",
+			},
+			expected: "x := \"😀\" + z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyContentChange(tt.text, tt.change); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+	"github.com/amarbel-llc/lux/pkg/middleware"
+)
+
+// NewDryRun creates a server that accepts a client and routes its messages
+// like New's, but only logs to log which servers would handle each one. It
+// never builds or starts a server: requests are answered with null and
+// notifications are dropped, so a configuration can be tried against a real
+// editor session safely.
+func NewDryRun(cfg *config.Config, log io.Writer) (*Server, error) {
+	s, err := newServer(cfg, dryRunExecutor{})
+	if err != nil {
+		return nil, err
+	}
+	s.AddMiddleware(&dryRun{server: s, log: log})
+	return s, nil
+}
+
+// dryRunExecutor refuses to build or run anything, for whatever still asks
+// for a server in a dry run (lux start, an external formatter).
+type dryRunExecutor struct{}
+
+func (dryRunExecutor) Build(ctx context.Context, flake, binarySpec string) (string, error) {
+	return "", fmt.Errorf("dry run: not building %s", flake)
+}
+
+func (dryRunExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*subprocess.Process, error) {
+	return nil, fmt.Errorf("dry run: not running %s", path)
+}
+
+// dryRun is the middleware that logs routing decisions in place of acting on
+// them.
+type dryRun struct {
+	middleware.PassThrough
+	server *Server
+	log    io.Writer
+}
+
+// handledByLux reports whether lux answers method itself, without a backend,
+// so a dry run can let it through.
+func handledByLux(method string) bool {
+	switch method {
+	case lsp.MethodInitialize, lsp.MethodInitialized,
+		lsp.MethodShutdown, lsp.MethodExit, lsp.MethodCancelRequest:
+		return true
+	}
+	return false
+}
+
+func (d *dryRun) OnClientRequest(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, *jsonrpc.Message, error) {
+	if handledByLux(msg.Method) {
+		return msg, nil, nil
+	}
+
+	fmt.Fprintf(d.log, "[lux] dry-run: %s\n", d.describe(msg))
+
+	if !msg.IsRequest() {
+		return nil, nil, nil
+	}
+	resp, err := jsonrpc.NewResponse(*msg.ID, nil)
+	return nil, resp, err
+}
+
+// describe says which servers msg would be sent to.
+func (d *dryRun) describe(msg *jsonrpc.Message) string {
+	if msg.IsRequest() {
+		if target, _, ok := requestTarget(msg.Params); ok && target != "" {
+			return fmt.Sprintf("%s -> %s (lux.target)", msg.Method, target)
+		}
+	}
+
+	names := d.server.Router().RouteAll(msg.Method, msg.Params)
+	subject := msg.Method
+	if uri := documentURI(msg.Params); uri != "" {
+		subject += " " + string(uri)
+	} else if len(names) == 0 {
+		return fmt.Sprintf("%s: no document to route on", msg.Method)
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("%s: no matching server", subject)
+	}
+	return fmt.Sprintf("%s -> %s", subject, strings.Join(names, ", "))
+}
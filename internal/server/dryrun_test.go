@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestDryRun_LogsRoutes(t *testing.T) {
+	cfg := &config.Config{LSPs: []config.LSP{
+		{Name: "gopls", Extensions: []string{"go"}},
+		{Name: "golangci", Extensions: []string{"go"}},
+	}}
+	router, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	s := &Server{cfg: cfg, router: router}
+	s.AddMiddleware(&dryRun{server: s, log: &log})
+
+	open, _ := jsonrpc.NewNotification(lsp.MethodTextDocumentDidOpen,
+		json.RawMessage(`{"textDocument":{"uri":"file:///a.go","languageId":"go","version":1,"text":""}}`))
+	if _, resp, handled, _ := s.interceptClient(context.Background(), open); !handled || resp != nil {
+		t.Errorf("expected didOpen to be dropped, got %v, %v", resp, handled)
+	}
+
+	hover, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), lsp.MethodTextDocumentHover,
+		json.RawMessage(`{"textDocument":{"uri":"file:///a.md"},"position":{"line":0,"character":0}}`))
+	_, resp, handled, _ := s.interceptClient(context.Background(), hover)
+	if !handled || resp == nil || resp.Error != nil || len(resp.Result) != 0 {
+		t.Errorf("expected hover to be answered with null, got %+v", resp)
+	}
+
+	symbol, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(2), lsp.MethodWorkspaceSymbol,
+		json.RawMessage(`{"query":"x"}`))
+	s.interceptClient(context.Background(), symbol)
+
+	initialize, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(3), lsp.MethodInitialize, json.RawMessage(`{}`))
+	if next, _, handled, _ := s.interceptClient(context.Background(), initialize); handled || next != initialize {
+		t.Error("expected initialize to be handled by lux")
+	}
+
+	expected := "[lux] dry-run: textDocument/didOpen file:///a.go -> gopls, golangci\n" +
+		"[lux] dry-run: textDocument/hover file:///a.md: no matching server\n" +
+		"[lux] dry-run: workspace/symbol: no document to route on\n"
+	if log.String() != expected {
+		t.Errorf("expected %q, got %q", expected, log.String())
+	}
+}
+
+func TestDryRunExecutor_Refuses(t *testing.T) {
+	if _, err := (dryRunExecutor{}).Build(context.Background(), "nixpkgs#gopls", ""); err == nil {
+		t.Error("expected Build to fail")
+	}
+	if _, err := (dryRunExecutor{}).Execute(context.Background(), "gopls", nil, nil, ""); err == nil {
+		t.Error("expected Execute to fail")
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// fallsBack reports whether an empty answer to method from the primary LSP
+// should be retried on the next matching LSP (see fallback_mode). Hovers are
+// not listed: with several matching LSPs they are already asked of all of
+// them and the first non-empty one wins (see handleHover).
+func (s *Server) fallsBack(method string) bool {
+	switch method {
+	case lsp.MethodTextDocumentDefinition, lsp.MethodTextDocumentReferences,
+		lsp.MethodTextDocumentSignatureHelp:
+	default:
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg.FallsBackOnEmpty()
+}
+
+// fallback asks the LSPs matching the document after primary, in routing
+// order, until one answers with something. It returns that answer and the
+// LSP that gave it, or false when none did. Servers that fail, or don't
+// support the method, are skipped.
+func (h *Handler) fallback(ctx context.Context, msg *jsonrpc.Message, primary string) (json.RawMessage, string, bool) {
+	for _, name := range h.server.routeAll(msg.Method, msg.Params) {
+		if name == primary {
+			continue
+		}
+		inst, err := h.startInstance(ctx, name, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] fallback to %s: %v\n", name, err)
+			continue
+		}
+		if !h.server.supportsMethod(inst, msg.Method) {
+			continue
+		}
+		result, err := h.server.call(ctx, name, inst, msg.Method, msg.Params)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, "", false
+			}
+			continue
+		}
+		if !isEmptyAnswer(msg.Method, result) {
+			return result, name, true
+		}
+	}
+	return nil, "", false
+}
+
+// isEmptyAnswer reports whether result answers method with nothing: an
+// empty result, signature help without any signatures, or linked editing
+// ranges without any ranges.
+func isEmptyAnswer(method string, result json.RawMessage) bool {
+	if isEmptyResult(result) {
+		return true
+	}
+	switch method {
+	case lsp.MethodTextDocumentSignatureHelp:
+		var help struct {
+			Signatures []json.RawMessage `json:"signatures"`
+		}
+		return json.Unmarshal(result, &help) == nil && len(help.Signatures) == 0
+	case lsp.MethodTextDocumentLinkedEditingRange:
+		var linked struct {
+			Ranges []json.RawMessage `json:"ranges"`
+		}
+		return json.Unmarshal(result, &linked) == nil && len(linked.Ranges) == 0
+	}
+	return false
+}
+
+// isEmptyResult reports whether result is null, an empty list, or an empty
+// object.
+func isEmptyResult(result json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(result)
+	switch string(trimmed) {
+	case "", "null", "[]", "{}":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIsEmptyResult(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected bool
+	}{
+		{``, true},
+		{`null`, true},
+		{`[]`, true},
+		{`{}`, true},
+		{`[{"uri":"file:///a.go","range":{}}]`, false},
+		{`{"uri":"file:///a.go","range":{}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := isEmptyResult(json.RawMessage(tt.raw)); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsEmptyAnswer(t *testing.T) {
+	tests := []struct {
+		method   string
+		raw      string
+		expected bool
+	}{
+		{"textDocument/signatureHelp", `null`, true},
+		{"textDocument/signatureHelp", `{"signatures":[]}`, true},
+		{"textDocument/signatureHelp", `{"signatures":[{"label":"f(x int)"}],"activeSignature":0}`, false},
+		{"textDocument/definition", `{"signatures":[]}`, false},
+		{"textDocument/linkedEditingRange", `{"ranges":[]}`, true},
+		{"textDocument/linkedEditingRange", `{"ranges":[{"start":{"line":0,"character":1},"end":{"line":0,"character":4}}]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.raw, func(t *testing.T) {
+			if got := isEmptyAnswer(tt.method, json.RawMessage(tt.raw)); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+	"golang.org/x/sync/errgroup"
+)
+
+// fanoutResult is one backend's answer to a fanned-out request.
+type fanoutResult struct {
+	server string
+	result json.RawMessage
+	err    error
+}
+
+// fanoutTargets returns the backends a document-less request should go to:
+// running ones, or every configured one when fanout_scope is "all" (one per
+// workspace folder for per-folder LSPs).
+func (s *Server) fanoutTargets() []string {
+	s.mu.RLock()
+	cfg := s.cfg
+	s.mu.RUnlock()
+
+	var names []string
+	if cfg.FanoutScopeLevel() == config.FanoutScopeAll {
+		s.mu.RLock()
+		folders := s.folders
+		s.mu.RUnlock()
+
+		for _, l := range cfg.LSPs {
+			if !l.PerFolder || len(folders) == 0 {
+				names = append(names, l.Name)
+				continue
+			}
+			for _, folder := range folders {
+				names = append(names, s.backendFor(l.Name, lsp.URIFromPath(folder)))
+			}
+		}
+		return names
+	}
+
+	for _, status := range s.pool.Status() {
+		if status.State == subprocess.LSPStateRunning.String() {
+			names = append(names, status.Name)
+		}
+	}
+	return names
+}
+
+// fanoutConcurrency bounds how many backends are sent a fanned-out request
+// or broadcast notification at once, so fanout_scope = "all" doesn't start
+// every configured server in the same instant.
+const fanoutConcurrency = 8
+
+// forEachConcurrently calls fn for 0 through n-1, at most
+// fanoutConcurrency at a time, and returns when every call has.
+func forEachConcurrently(n int, fn func(i int)) {
+	var group errgroup.Group
+	group.SetLimit(fanoutConcurrency)
+	for i := 0; i < n; i++ {
+		group.Go(func() error {
+			fn(i)
+			return nil
+		})
+	}
+	group.Wait()
+}
+
+// fanOut sends method to every named backend that supports it concurrently,
+// each bounded by the fanout timeout. Results are returned in names order.
+func (s *Server) fanOut(ctx context.Context, names []string, method string, params json.RawMessage) []fanoutResult {
+	s.mu.RLock()
+	timeout := s.cfg.FanoutTimeoutDuration()
+	s.mu.RUnlock()
+
+	return s.fanOutWithin(ctx, names, method, params, timeout)
+}
+
+// fanOutWithin is fanOut with an explicit per-backend timeout.
+func (s *Server) fanOutWithin(ctx context.Context, names []string, method string, params json.RawMessage, timeout time.Duration) []fanoutResult {
+	same := func(*subprocess.LSPInstance) (json.RawMessage, bool) { return params, true }
+	return s.fanOutEach(ctx, names, method, same, timeout)
+}
+
+// fanOutEach is fanOutWithin with params chosen for each backend once it is
+// running; a backend paramsFor returns false for isn't sent the request.
+func (s *Server) fanOutEach(ctx context.Context, names []string, method string, paramsFor func(*subprocess.LSPInstance) (json.RawMessage, bool), timeout time.Duration) []fanoutResult {
+	s.mu.RLock()
+	initParams := s.initParams
+	s.mu.RUnlock()
+
+	results := make([]fanoutResult, len(names))
+	forEachConcurrently(len(names), func(i int) {
+		name := names[i]
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		results[i].server = name
+		inst, err := s.startWithin(callCtx, name, s.backendInitParams(name, initParams))
+		if err != nil {
+			results[i].err = err
+			return
+		}
+		if err := s.replayDocuments(name, inst); err != nil {
+			results[i].err = err
+			return
+		}
+		if !s.supportsMethod(inst, method) {
+			return
+		}
+		params, ok := paramsFor(inst)
+		if !ok {
+			return
+		}
+
+		results[i].result, results[i].err = s.call(callCtx, name, inst, method, params)
+	})
+
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] %s from %s: %v\n", method, r.server, r.err)
+		}
+	}
+	return results
+}
+
+// startWithin gets or starts name for a request bounded by ctx. The
+// instance outlives the request, so it is started detached from ctx, which
+// only bounds how long the request waits for it: a server still building
+// when ctx ends carries on in the background.
+func (s *Server) startWithin(ctx context.Context, name string, initParams *lsp.InitializeParams) (*subprocess.LSPInstance, error) {
+	type started struct {
+		inst *subprocess.LSPInstance
+		err  error
+	}
+	ch := make(chan started, 1)
+	go func() {
+		inst, err := s.pool.GetOrStart(context.WithoutCancel(ctx), name, initParams)
+		ch <- started{inst, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.inst, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// handleWorkspaceSymbol answers workspace/symbol, which has no document to
+// route on, by querying every target backend and merging the results.
+func (h *Handler) handleWorkspaceSymbol(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	results := h.server.fanOut(ctx, h.server.fanoutTargets(), msg.Method, msg.Params)
+	return jsonrpc.NewResponse(*msg.ID, mergeSymbols(results))
+}
+
+// mergeSymbols concatenates SymbolInformation / WorkspaceSymbol arrays,
+// dropping duplicates reported by more than one backend and tagging the
+// rest with their server for workspaceSymbol/resolve.
+func mergeSymbols(results []fanoutResult) []json.RawMessage {
+	merged := []json.RawMessage{}
+	seen := make(map[string]bool)
+
+	for _, r := range results {
+		if r.err != nil || len(r.result) == 0 {
+			continue
+		}
+
+		var symbols []json.RawMessage
+		if err := json.Unmarshal(r.result, &symbols); err != nil {
+			continue
+		}
+
+		for _, sym := range symbols {
+			key := symbolKey(sym)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, taggedWorkspaceSymbol(sym, r.server))
+		}
+	}
+
+	return merged
+}
+
+func symbolKey(sym json.RawMessage) string {
+	var s struct {
+		Name          string          `json:"name"`
+		Kind          int             `json:"kind"`
+		ContainerName string          `json:"containerName"`
+		Location      json.RawMessage `json:"location"`
+	}
+	if err := json.Unmarshal(sym, &s); err != nil {
+		return string(sym)
+	}
+
+	// Re-encode the location so formatting differences between servers
+	// don't defeat de-duplication.
+	var loc any
+	json.Unmarshal(s.Location, &loc)
+	locKey, _ := json.Marshal(loc)
+
+	return fmt.Sprintf("%s\x00%d\x00%s\x00%s", s.Name, s.Kind, s.ContainerName, locKey)
+}
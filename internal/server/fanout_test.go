@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/internal/subprocess/subprocesstest"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestMergeSymbols(t *testing.T) {
+	results := []fanoutResult{
+		{server: "gopls", result: json.RawMessage(`[
+			{"name":"Run","kind":12,"location":{"uri":"file:///a.go","range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}}}},
+			{"name":"Server","kind":23,"location":{"uri":"file:///a.go","range":{"start":{"line":5,"character":0},"end":{"line":5,"character":6}}}}
+		]`)},
+		{server: "other", result: json.RawMessage(`[
+			{"kind":12,"name":"Run","location":{"range":{"end":{"character":3,"line":1},"start":{"character":0,"line":1}},"uri":"file:///a.go"}},
+			{"name":"run","kind":12,"location":{"uri":"file:///b.py"}}
+		]`)},
+		{server: "broken", err: errors.New("timeout")},
+		{server: "nosupport"},
+		{server: "empty", result: json.RawMessage(`null`)},
+	}
+
+	merged := mergeSymbols(results)
+
+	var names []string
+	for _, sym := range merged {
+		var s struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(sym, &s)
+		names = append(names, s.Name)
+	}
+
+	expected := []string{"Run", "Server", "run"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, names)
+			break
+		}
+	}
+
+	servers := []string{"gopls", "gopls", "other"}
+	for i, raw := range merged {
+		var sym map[string]json.RawMessage
+		json.Unmarshal(raw, &sym)
+		if server, ok := untagOrigin(sym); !ok || server != servers[i] {
+			t.Errorf("symbol %d: expected %q, got %q", i, servers[i], server)
+		}
+		if _, ok := sym["data"]; ok {
+			t.Errorf("symbol %d: expected no data once untagged, got %s", i, sym["data"])
+		}
+	}
+}
+
+func TestForEachConcurrently(t *testing.T) {
+	const n = 3 * fanoutConcurrency
+	var running, peak, calls int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	done := make(chan struct{})
+	go func() {
+		forEachConcurrently(n, func(i int) {
+			now := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if now <= p || atomic.CompareAndSwapInt32(&peak, p, now) {
+					break
+				}
+			}
+			started <- struct{}{}
+			<-release
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&calls, 1)
+		})
+		close(done)
+	}()
+
+	// Let calls through one at a time: each released call makes room for
+	// exactly one more, so fanoutConcurrency must be running before the
+	// first is released.
+	for i := 0; i < fanoutConcurrency; i++ {
+		<-started
+	}
+	if got := atomic.LoadInt32(&running); got != fanoutConcurrency {
+		t.Errorf("expected %d calls running at once, got %d", fanoutConcurrency, got)
+	}
+	for i := fanoutConcurrency; i < n; i++ {
+		release <- struct{}{}
+		<-started
+	}
+	close(release)
+	<-done
+
+	if calls != n {
+		t.Errorf("expected %d calls, got %d", n, calls)
+	}
+	if peak > fanoutConcurrency {
+		t.Errorf("expected at most %d calls at once, got %d", fanoutConcurrency, peak)
+	}
+}
+
+func TestFanOut_InstanceOutlivesRequest(t *testing.T) {
+	cfg := &config.Config{LSPs: []config.LSP{{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}}}}
+	executor, err := subprocesstest.NewExecutor("gopls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newServer(cfg, executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.pool.StopAll)
+
+	s.fanOutWithin(context.Background(), []string{"gopls"}, lsp.MethodWorkspaceSymbol, json.RawMessage(`{"query":""}`), time.Minute)
+
+	time.Sleep(50 * time.Millisecond)
+	if state, _ := s.pool.State("gopls"); state != subprocess.LSPStateRunning {
+		t.Errorf("expected gopls to keep running after the fan-out, got %s", state)
+	}
+}
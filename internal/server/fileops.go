@@ -0,0 +1,455 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/gobwas/glob"
+)
+
+func isFileOperation(method string) bool {
+	switch method {
+	case lsp.MethodWorkspaceWillCreateFiles, lsp.MethodWorkspaceDidCreateFiles,
+		lsp.MethodWorkspaceWillRenameFiles, lsp.MethodWorkspaceDidRenameFiles,
+		lsp.MethodWorkspaceWillDeleteFiles, lsp.MethodWorkspaceDidDeleteFiles:
+		return true
+	}
+	return false
+}
+
+// handleFileOperation forwards a workspace file operation to the backends
+// whose fileOperations filters match some of its files, each sent only the
+// files it asked for. The did* notifications go to running backends; the
+// will* requests go to the fanout targets, and the WorkspaceEdits they return
+// are merged into one.
+func (h *Handler) handleFileOperation(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	files, err := fileOperationFiles(msg.Params)
+	if err != nil {
+		if msg.IsRequest() {
+			return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams, err.Error(), nil)
+		}
+		return nil, err
+	}
+	paramsFor := func(inst *subprocess.LSPInstance) (json.RawMessage, bool) {
+		return narrowFileOperation(lsp.FileOperationFilters(inst.Capabilities, msg.Method), files)
+	}
+
+	if msg.IsNotification() {
+		h.server.notifyFileOperation(msg.Method, paramsFor)
+		return nil, nil
+	}
+
+	h.server.mu.RLock()
+	timeout := h.server.cfg.FanoutTimeoutDuration()
+	h.server.mu.RUnlock()
+
+	results := h.server.fanOutEach(ctx, h.server.fanoutTargets(), msg.Method, paramsFor, timeout)
+	edit, conflicts := mergeWorkspaceEdits(results)
+	h.server.reportEditConflicts(msg.Method, edit.uris(), conflicts)
+
+	if edit == nil {
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	}
+	return jsonrpc.NewResponse(*msg.ID, edit)
+}
+
+// notifyFileOperation sends a did* file operation to every running backend
+// paramsFor has files for. Backends that aren't running will see the files
+// as they are when they start.
+func (s *Server) notifyFileOperation(method string, paramsFor func(*subprocess.LSPInstance) (json.RawMessage, bool)) {
+	for _, status := range s.pool.Status() {
+		if status.State != subprocess.LSPStateRunning.String() {
+			continue
+		}
+		inst, ok := s.pool.Get(status.Name)
+		if !ok {
+			continue
+		}
+		params, ok := paramsFor(inst)
+		if !ok {
+			continue
+		}
+		if err := inst.Notify(method, params); err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] %s to %s: %v\n", method, status.Name, err)
+		}
+	}
+}
+
+// fileOperationFile is one entry of a file operation's files: a FileCreate,
+// FileRename, or FileDelete, kept as sent.
+type fileOperationFile struct {
+	uri lsp.DocumentURI
+	raw json.RawMessage
+}
+
+// fileOperationFiles returns the files of a file operation's params. A rename
+// is matched against filters by its old URI.
+func fileOperationFiles(params json.RawMessage) ([]fileOperationFile, error) {
+	var p struct {
+		Files []json.RawMessage `json:"files"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid file operation params: %w", err)
+	}
+
+	files := make([]fileOperationFile, 0, len(p.Files))
+	for _, raw := range p.Files {
+		var f struct {
+			URI    lsp.DocumentURI `json:"uri"`
+			OldURI lsp.DocumentURI `json:"oldUri"`
+		}
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, fmt.Errorf("invalid file operation params: %w", err)
+		}
+		uri := f.URI
+		if uri == "" {
+			uri = f.OldURI
+		}
+		files = append(files, fileOperationFile{uri: uri, raw: raw})
+	}
+	return files, nil
+}
+
+// narrowFileOperation returns params holding the files opts match, or false
+// if it matches none.
+func narrowFileOperation(opts *lsp.FileOperationRegistrationOptions, files []fileOperationFile) (json.RawMessage, bool) {
+	if opts == nil {
+		return nil, false
+	}
+
+	var matched []json.RawMessage
+	for _, f := range files {
+		if matchesFileOperation(opts.Filters, f.uri) {
+			matched = append(matched, f.raw)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, false
+	}
+
+	params, err := json.Marshal(map[string]any{"files": matched})
+	if err != nil {
+		return nil, false
+	}
+	return params, true
+}
+
+// matchesFileOperation reports whether uri passes any of filters. A filter
+// limited to files or folders matches a path that no longer exists either
+// way, since a deleted or renamed file can't be checked.
+func matchesFileOperation(filters []lsp.FileOperationFilter, uri lsp.DocumentURI) bool {
+	scheme, _, _ := strings.Cut(string(uri), ":")
+	path := uri.Path()
+	if path == "" {
+		path = strings.TrimPrefix(string(uri), scheme+":")
+	}
+
+	for _, f := range filters {
+		if f.Scheme != "" && f.Scheme != scheme {
+			continue
+		}
+
+		pattern, name := f.Pattern.Glob, path
+		if f.Pattern.Options != nil && f.Pattern.Options.IgnoreCase {
+			pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+		}
+		g, err := glob.Compile(pattern, '/')
+		if err != nil || !g.Match(name) {
+			continue
+		}
+
+		if f.Pattern.Matches != "" {
+			if info, err := os.Stat(path); err == nil && info.IsDir() != (f.Pattern.Matches == "folder") {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// workspaceEdit is a WorkspaceEdit with its edits and document changes kept
+// as sent, so annotations and versions survive merging.
+type workspaceEdit struct {
+	Changes           map[lsp.DocumentURI][]json.RawMessage `json:"changes,omitempty"`
+	DocumentChanges   []json.RawMessage                     `json:"documentChanges,omitempty"`
+	ChangeAnnotations map[string]json.RawMessage            `json:"changeAnnotations,omitempty"`
+}
+
+// documentChange is one change a WorkspaceEdit makes: text edits to a
+// document, or the create, rename, or delete of a file (op).
+type documentChange struct {
+	uri     lsp.DocumentURI
+	version json.RawMessage
+	edits   []json.RawMessage
+	op      json.RawMessage
+	// touches are the URIs a file operation creates, renames, or deletes.
+	touches []lsp.DocumentURI
+}
+
+// mergeWorkspaceEdits combines the WorkspaceEdits of several servers, in
+// results order. As with composeEdits, a server's edit is taken all or
+// nothing: it is dropped if any of its text edits overlaps one already
+// accepted for the same document, or if it creates, renames, or deletes a
+// file another server changes. Changes identical to accepted ones are
+// skipped. The result uses documentChanges if any server did, and is nil if
+// no server returned an edit.
+func mergeWorkspaceEdits(results []fanoutResult) (*workspaceEdit, []editConflict) {
+	m := editMerge{
+		accepted: map[lsp.DocumentURI][]ownedEdit{},
+		edited:   map[lsp.DocumentURI]string{},
+		touched:  map[lsp.DocumentURI]string{},
+		ops:      map[string]bool{},
+	}
+	var merged []documentChange
+	var conflicts []editConflict
+	useDocumentChanges := false
+	annotations := map[string]json.RawMessage{}
+
+	for _, r := range results {
+		if r.err != nil || len(r.result) == 0 || string(r.result) == "null" {
+			continue
+		}
+		var edit workspaceEdit
+		if err := json.Unmarshal(r.result, &edit); err != nil {
+			continue
+		}
+		changes, err := edit.changes()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] ignoring WorkspaceEdit from %s: %v\n", r.server, err)
+			continue
+		}
+
+		kept, conflict := m.stage(r.server, changes)
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+			continue
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		m.accept(r.server, kept)
+
+		merged = append(merged, kept...)
+		if len(edit.DocumentChanges) > 0 {
+			useDocumentChanges = true
+		}
+		for id, a := range edit.ChangeAnnotations {
+			if _, ok := annotations[id]; !ok {
+				annotations[id] = a
+			}
+		}
+	}
+
+	if len(merged) == 0 {
+		return nil, conflicts
+	}
+
+	result := &workspaceEdit{}
+	if len(annotations) > 0 {
+		result.ChangeAnnotations = annotations
+	}
+	if !useDocumentChanges {
+		result.Changes = map[lsp.DocumentURI][]json.RawMessage{}
+		for _, c := range merged {
+			result.Changes[c.uri] = append(result.Changes[c.uri], c.edits...)
+		}
+		return result, conflicts
+	}
+
+	for _, c := range merged {
+		if c.op != nil {
+			result.DocumentChanges = append(result.DocumentChanges, c.op)
+			continue
+		}
+		version := c.version
+		if version == nil {
+			version = json.RawMessage("null")
+		}
+		raw, err := json.Marshal(map[string]any{
+			"textDocument": map[string]any{"uri": c.uri, "version": version},
+			"edits":        c.edits,
+		})
+		if err != nil {
+			continue
+		}
+		result.DocumentChanges = append(result.DocumentChanges, raw)
+	}
+	return result, conflicts
+}
+
+// editMerge is what mergeWorkspaceEdits has accepted so far.
+type editMerge struct {
+	accepted map[lsp.DocumentURI][]ownedEdit
+	edited   map[lsp.DocumentURI]string // server whose text edits each document has
+	touched  map[lsp.DocumentURI]string // server that created, renamed, or deleted each file
+	ops      map[string]bool            // accepted file operations, compacted
+}
+
+// ownedEdit is an accepted text edit and the server it came from.
+type ownedEdit struct {
+	edit   lsp.TextEdit
+	server string
+}
+
+// stage checks server's changes against those already accepted. It returns
+// them without the ones already accepted, or the first conflict.
+func (m *editMerge) stage(server string, changes []documentChange) ([]documentChange, *editConflict) {
+	other := func(owners map[lsp.DocumentURI]string, uri lsp.DocumentURI) (string, bool) {
+		owner, ok := owners[uri]
+		return owner, ok && owner != server
+	}
+
+	var kept []documentChange
+	for _, c := range changes {
+		if c.op != nil {
+			if m.ops[compactJSON(c.op)] {
+				continue
+			}
+			for _, uri := range c.touches {
+				if owner, ok := other(m.touched, uri); ok {
+					return nil, &editConflict{server: server, with: owner, uri: uri, file: true}
+				}
+				if owner, ok := other(m.edited, uri); ok {
+					return nil, &editConflict{server: server, with: owner, uri: uri, file: true}
+				}
+			}
+			kept = append(kept, c)
+			continue
+		}
+
+		if owner, ok := other(m.touched, c.uri); ok {
+			return nil, &editConflict{server: server, with: owner, uri: c.uri, file: true}
+		}
+		var edits []json.RawMessage
+	edits:
+		for _, raw := range c.edits {
+			var te lsp.TextEdit
+			if err := json.Unmarshal(raw, &te); err != nil {
+				continue
+			}
+			for _, prev := range m.accepted[c.uri] {
+				if te == prev.edit {
+					continue edits
+				}
+				if editsOverlap(te, prev.edit) {
+					return nil, &editConflict{server: server, with: prev.server, uri: c.uri, edit: te}
+				}
+			}
+			edits = append(edits, raw)
+		}
+		if len(edits) > 0 {
+			c.edits = edits
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+// accept records server's staged changes.
+func (m *editMerge) accept(server string, changes []documentChange) {
+	for _, c := range changes {
+		if c.op != nil {
+			m.ops[compactJSON(c.op)] = true
+			for _, uri := range c.touches {
+				m.touched[uri] = server
+			}
+			continue
+		}
+		m.edited[c.uri] = server
+		for _, raw := range c.edits {
+			var te lsp.TextEdit
+			json.Unmarshal(raw, &te)
+			m.accepted[c.uri] = append(m.accepted[c.uri], ownedEdit{edit: te, server: server})
+		}
+	}
+}
+
+// uris returns the documents e changes, creates, renames, or deletes, in
+// order. A nil edit changes none.
+func (e *workspaceEdit) uris() []lsp.DocumentURI {
+	if e == nil {
+		return nil
+	}
+	changes, err := e.changes()
+	if err != nil {
+		return nil
+	}
+	seen := make(map[lsp.DocumentURI]bool)
+	var uris []lsp.DocumentURI
+	for _, c := range changes {
+		for _, uri := range append([]lsp.DocumentURI{c.uri}, c.touches...) {
+			if uri != "" && !seen[uri] {
+				seen[uri] = true
+				uris = append(uris, uri)
+			}
+		}
+	}
+	return uris
+}
+
+// changes flattens e into documentChange entries: its documentChanges in
+// order, or else its changes by URI.
+func (e *workspaceEdit) changes() ([]documentChange, error) {
+	if len(e.DocumentChanges) == 0 {
+		uris := make([]string, 0, len(e.Changes))
+		for uri := range e.Changes {
+			uris = append(uris, string(uri))
+		}
+		sort.Strings(uris)
+
+		changes := make([]documentChange, 0, len(uris))
+		for _, uri := range uris {
+			changes = append(changes, documentChange{uri: lsp.DocumentURI(uri), edits: e.Changes[lsp.DocumentURI(uri)]})
+		}
+		return changes, nil
+	}
+
+	changes := make([]documentChange, 0, len(e.DocumentChanges))
+	for _, raw := range e.DocumentChanges {
+		var c struct {
+			Kind         string          `json:"kind"`
+			URI          lsp.DocumentURI `json:"uri"`
+			OldURI       lsp.DocumentURI `json:"oldUri"`
+			NewURI       lsp.DocumentURI `json:"newUri"`
+			TextDocument struct {
+				URI     lsp.DocumentURI `json:"uri"`
+				Version json.RawMessage `json:"version"`
+			} `json:"textDocument"`
+			Edits []json.RawMessage `json:"edits"`
+		}
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("parsing documentChanges: %w", err)
+		}
+
+		switch c.Kind {
+		case "create", "delete":
+			changes = append(changes, documentChange{op: raw, touches: []lsp.DocumentURI{c.URI}})
+		case "rename":
+			changes = append(changes, documentChange{op: raw, touches: []lsp.DocumentURI{c.OldURI, c.NewURI}})
+		case "":
+			changes = append(changes, documentChange{uri: c.TextDocument.URI, version: c.TextDocument.Version, edits: c.Edits})
+		default:
+			return nil, fmt.Errorf("unknown document change kind %q", c.Kind)
+		}
+	}
+	return changes, nil
+}
+
+// compactJSON returns raw without insignificant whitespace, for comparing
+// values sent by different servers.
+func compactJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
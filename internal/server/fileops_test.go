@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestMergeWorkspaceEdits(t *testing.T) {
+	tests := []struct {
+		name      string
+		results   []fanoutResult
+		expected  string
+		conflicts []string
+	}{
+		{
+			name: "changes to different documents",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]}}`)},
+				{server: "buf", result: json.RawMessage(`{"changes":{"file:///a.proto":[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"newText":"y"}]}}`)},
+			},
+			expected: `{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}],"file:///a.proto":[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"newText":"y"}]}}`,
+		},
+		{
+			name: "overlapping edits drop the later server",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]}}`)},
+				{server: "lint", result: json.RawMessage(`{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":2},"end":{"line":1,"character":5}},"newText":"z"}]}}`)},
+			},
+			expected:  `{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]}}`,
+			conflicts: []string{"lint"},
+		},
+		{
+			name: "identical edits are applied once",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]}}`)},
+				{server: "lint", result: json.RawMessage(`{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]}}`)},
+			},
+			expected: `{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]}}`,
+		},
+		{
+			name: "documentChanges from one server converts the rest",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]}}`)},
+				{server: "buf", result: json.RawMessage(`{"documentChanges":[{"kind":"create","uri":"file:///b.proto"},{"textDocument":{"uri":"file:///b.proto","version":null},"edits":[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"newText":"y"}]}]}`)},
+			},
+			expected: `{"documentChanges":[{"edits":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}],"textDocument":{"uri":"file:///a.go","version":null}},{"kind":"create","uri":"file:///b.proto"},{"edits":[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"newText":"y"}],"textDocument":{"uri":"file:///b.proto","version":null}}]}`,
+		},
+		{
+			name: "deleting a file another server edits conflicts",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]}}`)},
+				{server: "lint", result: json.RawMessage(`{"documentChanges":[{"kind":"delete","uri":"file:///a.go"}]}`)},
+			},
+			expected:  `{"changes":{"file:///a.go":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]}}`,
+			conflicts: []string{"lint"},
+		},
+		{
+			name: "no edits",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`null`)},
+				{server: "lint", err: errors.New("timeout")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit, conflicts := mergeWorkspaceEdits(tt.results)
+
+			var got string
+			if edit != nil {
+				data, err := json.Marshal(edit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = compactJSON(data)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+
+			var servers []string
+			for _, c := range conflicts {
+				servers = append(servers, c.server)
+			}
+			if !reflect.DeepEqual(servers, tt.conflicts) {
+				t.Errorf("expected conflicts %v, got %v", tt.conflicts, servers)
+			}
+		})
+	}
+}
+
+func TestNarrowFileOperation(t *testing.T) {
+	files, err := fileOperationFiles(json.RawMessage(`{"files":[
+		{"oldUri":"file:///src/util.go","newUri":"file:///src/app/util.go"},
+		{"oldUri":"file:///src/API.proto","newUri":"file:///src/api.proto"},
+		{"oldUri":"untitled:Untitled-1","newUri":"untitled:Untitled-2"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		filters  []lsp.FileOperationFilter
+		expected string
+	}{
+		{
+			name:     "glob",
+			filters:  []lsp.FileOperationFilter{{Pattern: lsp.FileOperationPattern{Glob: "**/*.go"}}},
+			expected: `{"files":[{"oldUri":"file:///src/util.go","newUri":"file:///src/app/util.go"}]}`,
+		},
+		{
+			name: "ignore case",
+			filters: []lsp.FileOperationFilter{{Pattern: lsp.FileOperationPattern{
+				Glob:    "**/*.proto",
+				Options: &lsp.FileOperationPatternOpts{IgnoreCase: true},
+			}}},
+			expected: `{"files":[{"oldUri":"file:///src/API.proto","newUri":"file:///src/api.proto"}]}`,
+		},
+		{
+			name:    "case sensitive",
+			filters: []lsp.FileOperationFilter{{Pattern: lsp.FileOperationPattern{Glob: "**/*.PROTO"}}},
+		},
+		{
+			name:     "scheme",
+			filters:  []lsp.FileOperationFilter{{Scheme: "file", Pattern: lsp.FileOperationPattern{Glob: "**"}}},
+			expected: `{"files":[{"oldUri":"file:///src/util.go","newUri":"file:///src/app/util.go"},{"oldUri":"file:///src/API.proto","newUri":"file:///src/api.proto"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, ok := narrowFileOperation(&lsp.FileOperationRegistrationOptions{Filters: tt.filters}, files)
+			if tt.expected == "" {
+				if ok {
+					t.Errorf("expected no files, got %s", params)
+				}
+				return
+			}
+			if got := compactJSON(params); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if _, ok := narrowFileOperation(nil, files); ok {
+		t.Error("expected a server without the capability to get no files")
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess/subprocesstest"
+	"github.com/amarbel-llc/lux/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// routingFixture is a routing regression case from testdata/fixtures: a
+// config, the fake servers behind it, the messages a client sends, and the
+// traffic each server should see. See testdata/fixtures/README.md.
+type routingFixture struct {
+	Description string                   `yaml:"description"`
+	Config      string                   `yaml:"config"`
+	Servers     map[string]fixtureServer `yaml:"servers"`
+	Messages    []fixtureMessage         `yaml:"messages"`
+	Forwarded   map[string][]string      `yaml:"forwarded"`
+}
+
+// fixtureServer is a fake server: a golden trace, inline capabilities, or
+// both, with canned results by method.
+type fixtureServer struct {
+	Trace        string         `yaml:"trace"`
+	Capabilities any            `yaml:"capabilities"`
+	Responses    map[string]any `yaml:"responses"`
+}
+
+// fixtureMessage is a client request or notification, with the result or
+// error a request should be answered with.
+type fixtureMessage struct {
+	Request string    `yaml:"request"`
+	Notify  string    `yaml:"notify"`
+	Params  any       `yaml:"params"`
+	Result  yaml.Node `yaml:"result"`
+	Error   string    `yaml:"error"`
+}
+
+// handshake is what lux sends every server it starts, left out of the
+// forwarded traffic fixtures list.
+var handshake = map[string]bool{
+	lsp.MethodInitialize:  true,
+	lsp.MethodInitialized: true,
+}
+
+func TestRoutingFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no fixtures in testdata/fixtures")
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture routingFixture
+			if err := yaml.Unmarshal(data, &fixture); err != nil {
+				t.Fatalf("parsing %s: %v", path, err)
+			}
+			fixture.run(t)
+		})
+	}
+}
+
+func (f *routingFixture) run(t *testing.T) {
+	home := t.TempDir()
+	for _, env := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME", "XDG_RUNTIME_DIR"} {
+		t.Setenv(env, home)
+	}
+
+	var cfg config.Config
+	if _, err := toml.Decode(f.Config, &cfg); err != nil {
+		t.Fatalf("parsing config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validating config: %v", err)
+	}
+
+	executor, err := subprocesstest.NewExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, server := range f.Servers {
+		executor.Add(name, server.trace(t, name))
+	}
+
+	s, err := newServer(&cfg, executor)
+	if err != nil {
+		t.Fatalf("creating server: %v", err)
+	}
+	t.Cleanup(s.pool.StopAll)
+	h := NewHandler(s)
+
+	for i, m := range f.Messages {
+		msg := m.message(t, i)
+		resp, err := h.Handle(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("message %d (%s): %v", i, msg.Method, err)
+		}
+		m.check(t, i, resp)
+	}
+
+	for name := range f.Servers {
+		expected := append([]string{}, f.Forwarded[name]...)
+		sort.Strings(expected)
+
+		var received []string
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			received = forwarded(executor.Server(name))
+			if reflect.DeepEqual(received, expected) || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !reflect.DeepEqual(received, expected) {
+			t.Errorf("%s: expected to receive %v, got %v", name, expected, received)
+		}
+	}
+}
+
+// forwarded returns the methods srv received past the handshake, sorted:
+// notifications are handled concurrently, so their order isn't stable.
+func forwarded(srv *subprocesstest.Server) []string {
+	received := []string{}
+	if srv == nil {
+		return received
+	}
+	for _, method := range srv.Received() {
+		if !handshake[method] {
+			received = append(received, method)
+		}
+	}
+	sort.Strings(received)
+	return received
+}
+
+func (s fixtureServer) trace(t *testing.T, name string) *subprocesstest.Trace {
+	trace := &subprocesstest.Trace{Server: name}
+	if s.Trace != "" {
+		golden, err := subprocesstest.LoadTrace(s.Trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trace = golden
+	}
+	if s.Capabilities != nil {
+		trace.Initialize = toJSON(t, map[string]any{"capabilities": s.Capabilities})
+	}
+	if trace.Initialize == nil {
+		trace.Initialize = json.RawMessage(`{"capabilities":{}}`)
+	}
+
+	responses := make(map[string]json.RawMessage, len(trace.Responses)+len(s.Responses))
+	for method, result := range trace.Responses {
+		responses[method] = result
+	}
+	for method, result := range s.Responses {
+		responses[method] = toJSON(t, result)
+	}
+	trace.Responses = responses
+	return trace
+}
+
+func (m fixtureMessage) message(t *testing.T, i int) *jsonrpc.Message {
+	params := toJSON(t, m.Params)
+	if m.Params == nil {
+		params = json.RawMessage(`{}`)
+	}
+
+	var msg *jsonrpc.Message
+	var err error
+	switch {
+	case m.Request != "" && m.Notify == "":
+		msg, err = jsonrpc.NewRequest(jsonrpc.NewNumberID(int64(i+1)), m.Request, params)
+	case m.Notify != "" && m.Request == "":
+		msg, err = jsonrpc.NewNotification(m.Notify, params)
+	default:
+		t.Fatalf("message %d: expected exactly one of request or notify", i)
+	}
+	if err != nil {
+		t.Fatalf("message %d: %v", i, err)
+	}
+	return msg
+}
+
+func (m fixtureMessage) check(t *testing.T, i int, resp *jsonrpc.Message) {
+	if m.Error != "" {
+		if resp == nil || resp.Error == nil || !strings.Contains(resp.Error.Message, m.Error) {
+			t.Errorf("message %d (%s): expected an error containing %q, got %+v", i, m.Request, m.Error, resp)
+		}
+		return
+	}
+	if m.Result.Kind == 0 {
+		return
+	}
+	if resp == nil || resp.Error != nil {
+		t.Errorf("message %d (%s): expected a result, got %+v", i, m.Request, resp)
+		return
+	}
+
+	var want any
+	if err := m.Result.Decode(&want); err != nil {
+		t.Fatalf("message %d: decoding expected result: %v", i, err)
+	}
+	var expected, got any
+	json.Unmarshal(toJSON(t, want), &expected)
+	if len(resp.Result) > 0 {
+		json.Unmarshal(resp.Result, &got)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("message %d (%s): expected result %s, got %s", i, m.Request, toJSON(t, want), resp.Result)
+	}
+}
+
+// toJSON converts a value decoded from YAML to JSON.
+func toJSON(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("converting %v to JSON: %v", v, err)
+	}
+	return data
+}
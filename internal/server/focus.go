@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// MethodDidChangeFocus is a lux-specific notification editor plugins send
+// when the user switches documents, so lux can favor the servers for the
+// document in front of them.
+const MethodDidChangeFocus = "lux/didChangeFocus"
+
+// DidChangeFocusParams names the focused document. An empty URI means no
+// document has focus, e.g. when the editor loses focus.
+type DidChangeFocusParams struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+}
+
+// handleDidChangeFocus doubles the concurrency budgets of the servers
+// matching the focused document, lets them start ahead of the startup
+// stagger, and, with focus_nice set, renices every other server's process.
+func (s *Server) handleDidChangeFocus(raw json.RawMessage) {
+	var params DidChangeFocusParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return
+	}
+
+	var focused []string
+	if uri := params.TextDocument.URI; uri != "" {
+		for _, name := range s.Router().matchAll(uri) {
+			focused = append(focused, s.backendFor(name, uri))
+		}
+	}
+	s.requests.setFocused(focused)
+
+	s.mu.RLock()
+	nice := s.cfg.FocusNice
+	s.mu.RUnlock()
+	if nice == 0 {
+		return
+	}
+
+	isFocused := make(map[string]bool, len(focused))
+	for _, name := range focused {
+		isFocused[name] = true
+	}
+	for _, status := range s.pool.Status() {
+		n := nice
+		if isFocused[status.Name] || len(focused) == 0 {
+			n = 0
+		}
+		if err := s.pool.SetNice(status.Name, n); err != nil && s.firstNiceFailure(status.Name) {
+			fmt.Fprintf(os.Stderr, "[lux] renicing %s: %v\n", status.Name, err)
+		}
+	}
+}
+
+// firstNiceFailure reports whether renicing lspName has not failed before.
+// Lowering niceness without privileges fails on every focus change, so it is
+// only logged once.
+func (s *Server) firstNiceFailure(lspName string) bool {
+	key := lspName + "\x00nice"
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	if s.health.warned[key] {
+		return false
+	}
+	s.health.warned[key] = true
+	return true
+}
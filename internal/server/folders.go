@@ -0,0 +1,258 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// folderSeparator joins an LSP name and a workspace folder in the pool name
+// of a per-folder backend instance, e.g. "gopls@/src/service-a".
+const folderSeparator = "@"
+
+func folderInstanceName(lspName, folder string) string {
+	return lspName + folderSeparator + folder
+}
+
+// splitInstanceName returns the configured LSP behind a pool name, and the
+// workspace folder for per-folder instances.
+func splitInstanceName(name string) (lspName, folder string) {
+	if i := strings.Index(name, folderSeparator); i >= 0 {
+		return name[:i], name[i+len(folderSeparator):]
+	}
+	return name, ""
+}
+
+// lspConfig returns the configuration of the LSP behind a pool name.
+func (s *Server) lspConfig(name string) *config.LSP {
+	lspName, _ := splitInstanceName(name)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg.FindLSP(lspName)
+}
+
+// initWorkspaceFolders records the client's workspace folders from its
+// initialize params, falling back to the root URI. The caller holds s.mu.
+func (s *Server) initWorkspaceFolders(params *lsp.InitializeParams) {
+	s.folders = nil
+	for _, f := range params.WorkspaceFolders {
+		s.folders = append(s.folders, f.URI.Path())
+	}
+	if len(s.folders) == 0 && params.RootURI != nil {
+		s.folders = []string{params.RootURI.Path()}
+	}
+}
+
+// folderFor returns the innermost workspace folder containing uri, or "".
+func (s *Server) folderFor(uri lsp.DocumentURI) string {
+	path := uri.Path()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	best := ""
+	for _, folder := range s.folders {
+		if (path == folder || strings.HasPrefix(path, folder+string(filepath.Separator))) && len(folder) > len(best) {
+			best = folder
+		}
+	}
+	return best
+}
+
+// backendName returns the pool name of the instance of lspName that serves
+// uri: a per-folder instance when the LSP has per_folder set and uri is in a
+// workspace folder, otherwise lspName itself.
+func (s *Server) backendName(lspName string, uri lsp.DocumentURI) string {
+	l := s.lspConfig(lspName)
+	if l == nil || !l.PerFolder || uri == "" {
+		return lspName
+	}
+	folder := s.folderFor(uri)
+	if folder == "" {
+		return lspName
+	}
+	return folderInstanceName(lspName, folder)
+}
+
+// backendFor is backendName, registering a per-folder instance with the pool
+// the first time it is needed.
+func (s *Server) backendFor(lspName string, uri lsp.DocumentURI) string {
+	name := s.backendName(lspName, uri)
+	if name == lspName {
+		return name
+	}
+
+	l := s.lspConfig(lspName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pool.Get(name); !ok && l != nil {
+		s.registerInstance(name, *l)
+	}
+	return name
+}
+
+// route is Router.Route resolved to a backend instance.
+func (s *Server) route(method string, params json.RawMessage) string {
+	lspName := s.Router().Route(method, params)
+	if lspName == "" {
+		return ""
+	}
+	return s.backendFor(lspName, documentURI(params))
+}
+
+// routeAll is Router.RouteAll resolved to backend instances.
+func (s *Server) routeAll(method string, params json.RawMessage) []string {
+	names := s.Router().RouteAll(method, params)
+	uri := documentURI(params)
+	for i, name := range names {
+		names[i] = s.backendFor(name, uri)
+	}
+	return names
+}
+
+// folderInstances returns the pool names of lspName's per-folder instances.
+func (s *Server) folderInstances(lspName string) []string {
+	var names []string
+	for _, status := range s.pool.Status() {
+		if base, folder := splitInstanceName(status.Name); base == lspName && folder != "" {
+			names = append(names, status.Name)
+		}
+	}
+	return names
+}
+
+// instanceInitParams scopes the client's initialize params to a per-folder
+// instance's folder; other instances get them unchanged.
+func instanceInitParams(name string, params *lsp.InitializeParams) *lsp.InitializeParams {
+	_, folder := splitInstanceName(name)
+	if folder == "" || params == nil {
+		return params
+	}
+
+	scoped := *params
+	uri := lsp.URIFromPath(folder)
+	scoped.RootURI = &uri
+	scoped.RootPath = &folder
+	scoped.WorkspaceFolders = []lsp.WorkspaceFolder{{URI: uri, Name: filepath.Base(folder)}}
+	return &scoped
+}
+
+// backendInitParams returns the initialize params for the backend instance
+// name: instanceInitParams, without the workspace folders its LSP's folders
+// filter hides. The root moves to the first folder left, or is cleared if
+// none is.
+func (s *Server) backendInitParams(name string, params *lsp.InitializeParams) *lsp.InitializeParams {
+	params = instanceInitParams(name, params)
+	l := s.lspConfig(name)
+	if _, folder := splitInstanceName(name); folder != "" || params == nil || l == nil || l.Folders == nil {
+		return params
+	}
+
+	var folders []lsp.WorkspaceFolder
+	for _, f := range params.WorkspaceFolders {
+		if l.SeesFolder(f.URI.Path()) {
+			folders = append(folders, f)
+		}
+	}
+	rootVisible := params.RootURI != nil && l.SeesFolder(params.RootURI.Path())
+	if len(folders) == len(params.WorkspaceFolders) && (rootVisible || params.RootURI == nil) {
+		return params
+	}
+
+	scoped := *params
+	scoped.WorkspaceFolders = folders
+	if !rootVisible {
+		scoped.RootURI, scoped.RootPath = nil, nil
+		if len(folders) > 0 {
+			uri := folders[0].URI
+			path := uri.Path()
+			scoped.RootURI, scoped.RootPath = &uri, &path
+		}
+	}
+	return &scoped
+}
+
+// visibleFolderChange returns the workspace folder change params narrowed
+// to the folders lspName sees, or false if none of them are.
+func (s *Server) visibleFolderChange(lspName string, params lsp.DidChangeWorkspaceFoldersParams) (lsp.DidChangeWorkspaceFoldersParams, bool) {
+	l := s.lspConfig(lspName)
+	if l == nil || l.Folders == nil {
+		return params, true
+	}
+
+	var narrowed lsp.DidChangeWorkspaceFoldersParams
+	for _, f := range params.Event.Added {
+		if l.SeesFolder(f.URI.Path()) {
+			narrowed.Event.Added = append(narrowed.Event.Added, f)
+		}
+	}
+	for _, f := range params.Event.Removed {
+		if l.SeesFolder(f.URI.Path()) {
+			narrowed.Event.Removed = append(narrowed.Event.Removed, f)
+		}
+	}
+	if len(narrowed.Event.Added) == 0 && len(narrowed.Event.Removed) == 0 {
+		return narrowed, false
+	}
+	if narrowed.Event.Added == nil {
+		narrowed.Event.Added = []lsp.WorkspaceFolder{}
+	}
+	if narrowed.Event.Removed == nil {
+		narrowed.Event.Removed = []lsp.WorkspaceFolder{}
+	}
+	return narrowed, true
+}
+
+// handleDidChangeWorkspaceFolders updates the workspace folders, stops the
+// per-folder instances of removed folders, and forwards the change to
+// running backends that span the whole workspace, narrowed to the folders
+// each one sees.
+func (s *Server) handleDidChangeWorkspaceFolders(raw json.RawMessage) {
+	var params lsp.DidChangeWorkspaceFoldersParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return
+	}
+
+	removed := make(map[string]bool)
+	for _, f := range params.Event.Removed {
+		removed[f.URI.Path()] = true
+	}
+
+	// Readers such as fanoutTargets keep s.folders after unlocking, so it is
+	// replaced rather than filtered in place.
+	s.mu.Lock()
+	folders := make([]string, 0, len(s.folders)+len(params.Event.Added))
+	for _, folder := range s.folders {
+		if !removed[folder] {
+			folders = append(folders, folder)
+		}
+	}
+	for _, f := range params.Event.Added {
+		folders = append(folders, f.URI.Path())
+	}
+	s.folders = folders
+	s.mu.Unlock()
+
+	for _, status := range s.pool.Status() {
+		_, folder := splitInstanceName(status.Name)
+		if folder == "" {
+			if inst, ok := s.pool.Get(status.Name); ok && status.State == subprocess.LSPStateRunning.String() {
+				if visible, ok := s.visibleFolderChange(status.Name, params); ok {
+					inst.Notify(lsp.MethodWorkspaceDidChangeFolders, visible)
+				}
+			}
+			continue
+		}
+		if removed[folder] {
+			if err := s.pool.Unregister(status.Name); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: stopping %s: %v\n", status.Name, err)
+			}
+			s.forgetDiagnostics(status.Name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func newFolderTestServer(folders ...string) *Server {
+	s := &Server{
+		cfg: &config.Config{
+			FanoutScope: config.FanoutScopeAll,
+			LSPs: []config.LSP{
+				{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}},
+				{Name: "jdtls", Flake: "nixpkgs#jdt-language-server", Extensions: []string{"java"}, PerFolder: true},
+			},
+		},
+		folders: folders,
+	}
+	s.pool = subprocess.NewPool(nil, nil)
+	for _, l := range s.cfg.LSPs {
+		s.registerLSP(l)
+	}
+	return s
+}
+
+func TestBackendFor(t *testing.T) {
+	s := newFolderTestServer("/ws/app", "/ws/app/lib", "/ws/tools")
+
+	tests := []struct {
+		lspName  string
+		uri      lsp.DocumentURI
+		expected string
+	}{
+		{"gopls", "file:///ws/app/main.go", "gopls"},
+		{"jdtls", "file:///ws/app/src/Main.java", "jdtls@/ws/app"},
+		{"jdtls", "file:///ws/app/lib/Lib.java", "jdtls@/ws/app/lib"},
+		{"jdtls", "file:///ws/application/Other.java", "jdtls"},
+		{"jdtls", "file:///elsewhere/Scratch.java", "jdtls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.uri), func(t *testing.T) {
+			got := s.backendFor(tt.lspName, tt.uri)
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if _, ok := s.pool.Get(got); !ok {
+				t.Errorf("expected %q to be registered with the pool", got)
+			}
+		})
+	}
+}
+
+func TestFanoutTargets_PerFolder(t *testing.T) {
+	s := newFolderTestServer("/ws/a", "/ws/b")
+
+	expected := []string{"gopls", "jdtls@/ws/a", "jdtls@/ws/b"}
+	got := s.fanoutTargets()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, got)
+			break
+		}
+	}
+}
+
+func TestInstanceInitParams(t *testing.T) {
+	root := lsp.DocumentURI("file:///ws")
+	params := &lsp.InitializeParams{
+		RootURI: &root,
+		WorkspaceFolders: []lsp.WorkspaceFolder{
+			{URI: "file:///ws/a", Name: "a"},
+			{URI: "file:///ws/b", Name: "b"},
+		},
+	}
+
+	if got := instanceInitParams("gopls", params); got != params {
+		t.Error("expected shared instances to get the client's params")
+	}
+
+	scoped := instanceInitParams("jdtls@/ws/b", params)
+	if scoped.RootURI == nil || *scoped.RootURI != "file:///ws/b" {
+		t.Errorf("expected root file:///ws/b, got %v", scoped.RootURI)
+	}
+	if len(scoped.WorkspaceFolders) != 1 || scoped.WorkspaceFolders[0].URI != "file:///ws/b" {
+		t.Errorf("expected the single folder file:///ws/b, got %+v", scoped.WorkspaceFolders)
+	}
+	if *params.RootURI != root {
+		t.Error("expected the client's params to be left unchanged")
+	}
+}
+
+func TestHandleDidChangeWorkspaceFolders(t *testing.T) {
+	s := newFolderTestServer("/ws/a", "/ws/b")
+	s.diagnostics = newDiagnosticsAggregator()
+	s.backendFor("jdtls", "file:///ws/a/A.java")
+	before := s.folders
+
+	s.handleDidChangeWorkspaceFolders([]byte(`{"event":{"added":[{"uri":"file:///ws/c","name":"c"}],"removed":[{"uri":"file:///ws/a","name":"a"}]}}`))
+
+	if _, ok := s.pool.Get("jdtls@/ws/a"); ok {
+		t.Error("expected the removed folder's instance to be unregistered")
+	}
+	if got := s.backendFor("jdtls", "file:///ws/c/C.java"); got != "jdtls@/ws/c" {
+		t.Errorf("expected the added folder to get its own instance, got %q", got)
+	}
+	if before[0] != "/ws/a" {
+		t.Errorf("expected the folders read before the change to be left alone, got %v", before)
+	}
+}
+
+func TestBackendInitParams(t *testing.T) {
+	s := newFolderTestServer("/ws/api", "/ws/web")
+	s.cfg.LSPs[0].Folders = &config.FolderFilter{Globs: []string{"api"}}
+
+	root := lsp.DocumentURI("file:///ws/web")
+	params := &lsp.InitializeParams{
+		RootURI: &root,
+		WorkspaceFolders: []lsp.WorkspaceFolder{
+			{URI: "file:///ws/api", Name: "api"},
+			{URI: "file:///ws/web", Name: "web"},
+		},
+	}
+
+	scoped := s.backendInitParams("gopls", params)
+	if scoped.RootURI == nil || *scoped.RootURI != "file:///ws/api" {
+		t.Errorf("expected root file:///ws/api, got %v", scoped.RootURI)
+	}
+	if scoped.RootPath == nil || *scoped.RootPath != "/ws/api" {
+		t.Errorf("expected root path /ws/api, got %v", scoped.RootPath)
+	}
+	if len(scoped.WorkspaceFolders) != 1 || scoped.WorkspaceFolders[0].URI != "file:///ws/api" {
+		t.Errorf("expected the single folder file:///ws/api, got %+v", scoped.WorkspaceFolders)
+	}
+	if *params.RootURI != root || len(params.WorkspaceFolders) != 2 {
+		t.Error("expected the client's params to be left unchanged")
+	}
+
+	if got := s.backendInitParams("jdtls", params); got != params {
+		t.Error("expected an LSP without a folders filter to get the client's params")
+	}
+
+	s.cfg.LSPs[0].Folders = &config.FolderFilter{Globs: []string{"docs"}}
+	scoped = s.backendInitParams("gopls", params)
+	if scoped.RootURI != nil || len(scoped.WorkspaceFolders) != 0 {
+		t.Errorf("expected no root or folders, got %v and %+v", scoped.RootURI, scoped.WorkspaceFolders)
+	}
+}
+
+func TestVisibleFolderChange(t *testing.T) {
+	s := newFolderTestServer("/ws/api")
+	s.cfg.LSPs[0].Folders = &config.FolderFilter{Globs: []string{"api", "svc-*"}}
+
+	params := lsp.DidChangeWorkspaceFoldersParams{Event: lsp.WorkspaceFoldersChangeEvent{
+		Added:   []lsp.WorkspaceFolder{{URI: "file:///ws/svc-auth", Name: "svc-auth"}, {URI: "file:///ws/web", Name: "web"}},
+		Removed: []lsp.WorkspaceFolder{{URI: "file:///ws/docs", Name: "docs"}},
+	}}
+
+	visible, ok := s.visibleFolderChange("gopls", params)
+	if !ok {
+		t.Fatal("expected gopls to be told about svc-auth")
+	}
+	if len(visible.Event.Added) != 1 || visible.Event.Added[0].URI != "file:///ws/svc-auth" {
+		t.Errorf("expected only svc-auth added, got %+v", visible.Event.Added)
+	}
+	if visible.Event.Removed == nil || len(visible.Event.Removed) != 0 {
+		t.Errorf("expected an empty removed list, got %#v", visible.Event.Removed)
+	}
+
+	hidden := lsp.DidChangeWorkspaceFoldersParams{Event: lsp.WorkspaceFoldersChangeEvent{
+		Added: []lsp.WorkspaceFolder{{URI: "file:///ws/web", Name: "web"}},
+	}}
+	if _, ok := s.visibleFolderChange("gopls", hidden); ok {
+		t.Error("expected a change to folders gopls doesn't see to be dropped")
+	}
+	if _, ok := s.visibleFolderChange("jdtls", hidden); !ok {
+		t.Error("expected an LSP without a folders filter to see every change")
+	}
+}
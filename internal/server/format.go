@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// formatChainTargets returns the LSPs to chain textDocument/formatting
+// through, or nil when format_mode is not "chain" or only one LSP matches.
+func (h *Handler) formatChainTargets(msg *jsonrpc.Message) []string {
+	h.server.mu.RLock()
+	chain := h.server.cfg.ChainsFormatting()
+	h.server.mu.RUnlock()
+	if !chain {
+		return nil
+	}
+
+	names := h.server.routeAll(msg.Method, msg.Params)
+	if len(names) < 2 {
+		return nil
+	}
+	return names
+}
+
+// handleFormatChain formats the document with each LSP in turn. The first
+// formats the client's text; each later one is shown the previous result and
+// formats that. The client gets the edits from its text to the final one,
+// one per run of changed lines. A server that fails is skipped, and the chain
+// continues from the text it was given.
+func (h *Handler) handleFormatChain(ctx context.Context, msg *jsonrpc.Message, names []string) (*jsonrpc.Message, error) {
+	uri := documentURI(msg.Params)
+	original, ok := h.server.documents.text(uri)
+	if !ok {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams,
+			fmt.Sprintf("%s is not open", uri), nil)
+	}
+
+	text := original
+	for _, name := range names {
+		formatted, err := h.formatWith(ctx, name, msg, uri, original, text)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] %s from %s: %v\n", msg.Method, name, err)
+			continue
+		}
+		text = formatted
+	}
+
+	edits := lsp.DiffEdits(original, text)
+	if edits == nil {
+		edits = []lsp.TextEdit{}
+	}
+	return jsonrpc.NewResponse(*msg.ID, edits)
+}
+
+// formatWith asks one LSP to format text, showing it text in place of the
+// client's content when they differ.
+func (h *Handler) formatWith(ctx context.Context, name string, msg *jsonrpc.Message, uri lsp.DocumentURI, original, text string) (string, error) {
+	inst, err := h.startInstance(ctx, name, true)
+	if err != nil {
+		return "", err
+	}
+	if !h.server.supportsMethod(inst, msg.Method) {
+		return text, nil
+	}
+
+	var result json.RawMessage
+	call := func() error {
+		result, err = h.server.call(ctx, name, inst, msg.Method, msg.Params)
+		return err
+	}
+	if text == original {
+		err = call()
+	} else {
+		err = h.server.documents.withText(name, inst, uri, text, call)
+		// Answers given while the server saw text are about the wrong
+		// content.
+		h.server.responses.Purge(uri)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var edits []lsp.TextEdit
+	if err := json.Unmarshal(result, &edits); err != nil {
+		return "", fmt.Errorf("parsing edits: %w", err)
+	}
+	return lsp.ApplyTextEdits(text, edits)
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestDocumentStore_WithText(t *testing.T) {
+	d := newDocumentStore()
+	uri := lsp.DocumentURI("file:///src/main.go")
+	d.apply(lsp.MethodTextDocumentDidOpen, json.RawMessage(`{"textDocument":{"uri":"file:///src/main.go","languageId":"go","version":4,"text":"original"}}`))
+
+	gopls := &recordingNotifier{}
+	d.replay("gopls", gopls, func(lsp.DocumentURI) bool { return true })
+	gopls.methods, gopls.params = nil, nil
+
+	var during []string
+	var swapped bool
+	err := d.withText("gopls", gopls, uri, "formatted", func() error {
+		during = append([]string(nil), gopls.methods...)
+		swapped = d.swapped("gopls", uri)
+
+		// The client edits while the server is shown other text: the
+		// change is held back and sent with the restored content.
+		change := json.RawMessage(`{"textDocument":{"uri":"file:///src/main.go","version":5},"contentChanges":[{"text":"edited"}]}`)
+		d.apply(lsp.MethodTextDocumentDidChange, change)
+		return d.forward("gopls", gopls, lsp.MethodTextDocumentDidChange, uri, change)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(during) != 2 || during[1] != lsp.MethodTextDocumentDidOpen {
+		t.Fatalf("expected close and reopen before fn, got %v", during)
+	}
+	if text := gopls.params[1].(lsp.DidOpenTextDocumentParams).TextDocument.Text; text != "formatted" {
+		t.Errorf("expected the server to see %q, got %q", "formatted", text)
+	}
+	if !swapped || d.swapped("gopls", uri) {
+		t.Error("expected the document to be swapped only while fn runs")
+	}
+	if len(gopls.methods) != 4 {
+		t.Fatalf("expected only the close and reopen to restore, got %v", gopls.methods)
+	}
+	restored := gopls.params[3].(lsp.DidOpenTextDocumentParams).TextDocument
+	if restored.Text != "edited" || restored.Version != 5 {
+		t.Errorf("expected the client's current text restored at version 5, got %+v", restored)
+	}
+
+	if err := d.withText("pyright", gopls, uri, "x", func() error { return nil }); err == nil {
+		t.Error("expected error for a server the document isn't open in")
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// isFormattingRequest reports whether method carries FormattingOptions.
+func isFormattingRequest(method string) bool {
+	switch method {
+	case lsp.MethodTextDocumentFormatting,
+		lsp.MethodTextDocumentRangeFormatting,
+		lsp.MethodTextDocumentOnTypeFormatting:
+		return true
+	}
+	return false
+}
+
+// indentation is the indentation a formatting policy enforces on the edits
+// servers return.
+type indentation struct {
+	tabSize      int
+	insertSpaces bool
+}
+
+// applyFormattingPolicy overrides the options of a formatting request with
+// the policy configured for its document's language. It returns the
+// indentation to normalize the answer to, or nil if the policy doesn't ask
+// for that.
+func (s *Server) applyFormattingPolicy(msg *jsonrpc.Message) (*jsonrpc.Message, *indentation) {
+	if !msg.IsRequest() || !isFormattingRequest(msg.Method) {
+		return msg, nil
+	}
+
+	uri := documentURI(msg.Params)
+	languageID := s.Router().GetLanguageID(uri)
+	s.mu.RLock()
+	policy, ok := s.cfg.FormattingPolicyFor(languageID, strings.TrimPrefix(uri.Extension(), "."))
+	s.mu.RUnlock()
+	if !ok {
+		return msg, nil
+	}
+
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return msg, nil
+	}
+	options := map[string]any{}
+	json.Unmarshal(params["options"], &options)
+	overrideFormattingOptions(options, policy)
+	params["options"], _ = json.Marshal(options)
+
+	rewritten := *msg
+	rewritten.Params, _ = json.Marshal(params)
+
+	if !policy.Normalize {
+		return &rewritten, nil
+	}
+	indent := &indentation{tabSize: policy.TabSize, insertSpaces: *policy.InsertSpaces}
+	if tabSize, ok := options["tabSize"].(float64); ok && indent.tabSize == 0 {
+		indent.tabSize = int(tabSize)
+	}
+	if indent.tabSize <= 0 {
+		indent.tabSize = 4
+	}
+	return &rewritten, indent
+}
+
+func overrideFormattingOptions(options map[string]any, policy config.FormattingPolicy) {
+	if policy.TabSize > 0 {
+		options["tabSize"] = policy.TabSize
+	}
+	for key, value := range map[string]*bool{
+		"insertSpaces":           policy.InsertSpaces,
+		"trimTrailingWhitespace": policy.TrimTrailingWhitespace,
+		"insertFinalNewline":     policy.InsertFinalNewline,
+		"trimFinalNewlines":      policy.TrimFinalNewlines,
+	} {
+		if value != nil {
+			options[key] = *value
+		}
+	}
+}
+
+// normalize rewrites the indentation in the edits of resp, an answer to a
+// formatting request, for servers that ignored the options. Only lines an
+// edit replaces from their start are touched: an edit beginning mid-line
+// can't be told apart from text after the indentation.
+func (indent *indentation) normalize(resp *jsonrpc.Message) *jsonrpc.Message {
+	if indent == nil || resp == nil || resp.Error != nil || len(resp.Result) == 0 {
+		return resp
+	}
+
+	var edits []lsp.TextEdit
+	if err := json.Unmarshal(resp.Result, &edits); err != nil || len(edits) == 0 {
+		return resp
+	}
+	for i, edit := range edits {
+		edits[i].NewText = indent.reindent(edit.NewText, edit.Range.Start.Character == 0)
+	}
+	if result, err := json.Marshal(edits); err == nil {
+		resp.Result = result
+	}
+	return resp
+}
+
+// reindent rewrites the leading whitespace of every line of text that starts
+// a line in the document: all but the first, and the first if startsLine.
+func (indent *indentation) reindent(text string, startsLine bool) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if (i == 0 && !startsLine) || line == "" {
+			continue
+		}
+		body := strings.TrimLeft(line, " \t")
+		lines[i] = indent.render(indent.width(line[:len(line)-len(body)])) + body
+	}
+	return strings.Join(lines, "\n")
+}
+
+// width is the number of columns whitespace ws spans.
+func (indent *indentation) width(ws string) int {
+	col := 0
+	for _, r := range ws {
+		if r == '\t' {
+			col += indent.tabSize - col%indent.tabSize
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+func (indent *indentation) render(width int) string {
+	if indent.insertSpaces {
+		return strings.Repeat(" ", width)
+	}
+	return strings.Repeat("\t", width/indent.tabSize) + strings.Repeat(" ", width%indent.tabSize)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestServer_ApplyFormattingPolicy(t *testing.T) {
+	tabs := false
+	cfg := &config.Config{Formatting: map[string]config.FormattingPolicy{
+		"go": {InsertSpaces: &tabs, Normalize: true},
+	}}
+	router, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{cfg: cfg, router: router}
+
+	msg, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), lsp.MethodTextDocumentFormatting,
+		json.RawMessage(`{"textDocument":{"uri":"file:///a.go"},"options":{"tabSize":2,"insertSpaces":true}}`))
+	rewritten, indent := s.applyFormattingPolicy(msg)
+
+	expected := `{"options":{"insertSpaces":false,"tabSize":2},"textDocument":{"uri":"file:///a.go"}}`
+	if string(rewritten.Params) != expected {
+		t.Errorf("expected %s, got %s", expected, rewritten.Params)
+	}
+	if indent == nil || indent.tabSize != 2 || indent.insertSpaces {
+		t.Fatalf("expected tab indentation with tab size 2, got %+v", indent)
+	}
+
+	resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+	resp.Result = json.RawMessage(`[
+		{"range":{"start":{"line":0,"character":0},"end":{"line":3,"character":0}},"newText":"func f() {\n    return\n  }\n"},
+		{"range":{"start":{"line":5,"character":4},"end":{"line":5,"character":4}},"newText":"  x"}
+	]`)
+	indent.normalize(resp)
+
+	var edits []lsp.TextEdit
+	json.Unmarshal(resp.Result, &edits)
+	if edits[0].NewText != "func f() {\n\t\treturn\n\t}\n" {
+		t.Errorf("expected reindented lines, got %q", edits[0].NewText)
+	}
+	if edits[1].NewText != "  x" {
+		t.Errorf("expected an edit starting mid-line to be left alone, got %q", edits[1].NewText)
+	}
+
+	other, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(2), lsp.MethodTextDocumentFormatting,
+		json.RawMessage(`{"textDocument":{"uri":"file:///a.py"},"options":{"tabSize":4,"insertSpaces":true}}`))
+	if got, indent := s.applyFormattingPolicy(other); got != other || indent != nil {
+		t.Error("expected a document without a policy to pass through")
+	}
+}
@@ -3,15 +3,17 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
-	"github.com/amarbel-llc/lux/internal/config"
+	"github.com/amarbel-llc/lux/internal/buildinfo"
 	"github.com/amarbel-llc/lux/internal/formatter"
 	"github.com/amarbel-llc/lux/internal/lsp"
 	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
 )
 
 type Handler struct {
@@ -23,18 +25,56 @@ func NewHandler(s *Server) *Handler {
 }
 
 func (h *Handler) Handle(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	if len(h.server.middleware) > 0 {
+		next, resp, handled, err := h.server.interceptClient(ctx, msg)
+		if handled {
+			return resp, err
+		}
+		msg = next
+	}
+
+	if msg.IsRequest() {
+		var done func()
+		ctx, done = h.server.cancels.track(ctx, *msg.ID)
+		defer done()
+	}
+
 	switch msg.Method {
+	case lsp.MethodCancelRequest:
+		h.server.cancels.cancel(msg.Params)
+		return nil, nil
+	case lsp.MethodWindowWorkDoneProgressCancel:
+		return nil, h.server.cancelProgress(msg.Params)
 	case lsp.MethodInitialize:
 		return h.handleInitialize(ctx, msg)
 	case lsp.MethodInitialized:
+		h.prewarm()
 		return nil, nil
 	case lsp.MethodShutdown:
 		return h.handleShutdown(ctx, msg)
 	case lsp.MethodExit:
 		h.handleExit()
 		return nil, nil
+	case lsp.MethodWorkspaceSymbol:
+		resp, err := h.handleWorkspaceSymbol(ctx, msg)
+		return h.server.downconvert(msg.Method, resp), err
+	case lsp.MethodWorkspaceSymbolResolve:
+		resp, err := h.handleWorkspaceSymbolResolve(ctx, msg)
+		return h.server.downconvert(msg.Method, resp), err
+	case lsp.MethodWorkspaceDidChangeFolders:
+		h.server.handleDidChangeWorkspaceFolders(msg.Params)
+		return nil, nil
+	case lsp.MethodWorkspaceDidChangeConfiguration:
+		h.server.handleDidChangeConfiguration(msg.Params)
+		return nil, nil
+	case MethodDidChangeFocus:
+		h.server.handleDidChangeFocus(msg.Params)
+		return nil, nil
 	default:
-		return h.handleDefault(ctx, msg)
+		msg, indent := h.server.applyFormattingPolicy(msg)
+		resp, err := h.handleCached(ctx, msg)
+		resp = indent.normalize(resp)
+		return h.server.downconvert(msg.Method, resp), err
 	}
 }
 
@@ -46,6 +86,8 @@ func (h *Handler) handleInitialize(ctx context.Context, msg *jsonrpc.Message) (*
 
 	h.server.mu.Lock()
 	h.server.initParams = &params
+	h.server.compat = newClientCompat(&params, msg.Params)
+	h.server.initWorkspaceFolders(&params)
 
 	// Detect project root from initialize params and load project config
 	if params.RootURI != nil {
@@ -65,6 +107,28 @@ func (h *Handler) handleInitialize(ctx context.Context, msg *jsonrpc.Message) (*
 			}
 		}
 		// If error, just continue with global config
+
+		if err := h.server.router.LoadOwnerRoutes(projectRoot); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+
+		go h.server.scanWorkspace(projectRoot)
+	}
+
+	if h.server.cfg.WatchesFiles() && !clientWatchesFiles(&params) {
+		// Backends only register watchers with clients that accept them.
+		h.server.watcher = newFileWatcher(h.server.watchRoots, h.server.notifyWatchedFiles)
+		advertiseWatchedFiles(&params)
+		go h.server.watcher.run(h.server.done)
+	}
+
+	// Servers' legends differ, so with more than one lux advertises a legend
+	// covering every cached one and translates tokens into it; the legend
+	// can't change later. A single server's tokens, deltas included, pass
+	// through under its own legend.
+	if legends := h.server.cachedLegends(); len(legends) > 1 || h.server.cfg.MergesSemanticTokens() {
+		legend := unifiedLegend(legends...)
+		h.server.legend = &legend
 	}
 
 	h.server.initialized = true
@@ -76,13 +140,16 @@ func (h *Handler) handleInitialize(ctx context.Context, msg *jsonrpc.Message) (*
 		Capabilities: capabilities,
 		ServerInfo: &lsp.ServerInfo{
 			Name:    "lux",
-			Version: "0.1.0",
+			Version: buildinfo.Version,
 		},
 	}
 
 	return jsonrpc.NewResponse(*msg.ID, result)
 }
 
+// handleShutdown stops every backend before answering, so a client that
+// kills lux as soon as shutdown is answered doesn't orphan them. The exit
+// that follows then only has lux itself left to stop.
 func (h *Handler) handleShutdown(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
 	h.server.pool.StopAll()
 	return jsonrpc.NewResponse(*msg.ID, nil)
@@ -93,18 +160,144 @@ func (h *Handler) handleExit() {
 	h.server.Close()
 }
 
+// handleDefault routes msg to the backends serving it, keeping edits to
+// read-only documents from the client: requests editing one are answered
+// without asking a server, and changes to them are dropped from the
+// workspace edits servers answer with.
 func (h *Handler) handleDefault(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	if msg.IsRequest() && editsDocument(msg.Method) && h.server.isReadOnly(documentURI(msg.Params)) {
+		return readOnlyResponse(msg)
+	}
+
+	resp, err := h.dispatch(ctx, msg)
+	if err == nil && resp != nil && resp.Error == nil && msg.IsRequest() {
+		resp.Result = h.server.dropReadOnlyEdits(msg.Method, resp.Result)
+	}
+	return resp, err
+}
+
+func (h *Handler) dispatch(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
 	if strings.HasPrefix(msg.Method, "$/") {
 		return nil, nil
 	}
 
+	if msg.IsRequest() {
+		if target, params, ok := requestTarget(msg.Params); ok {
+			stripped := *msg
+			stripped.Params = params
+			if target != "" {
+				return h.handleTargeted(ctx, &stripped, target)
+			}
+			msg = &stripped
+		}
+	}
+
+	if isFileOperation(msg.Method) {
+		return h.handleFileOperation(ctx, msg)
+	}
+
 	if msg.Method == lsp.MethodTextDocumentFormatting || msg.Method == lsp.MethodTextDocumentRangeFormatting {
 		if resp, handled := h.tryExternalFormat(ctx, msg); handled {
 			return resp, nil
 		}
 	}
 
-	lspName := h.server.router.Route(msg.Method, msg.Params)
+	if msg.Method == lsp.MethodTextDocumentFormatting && msg.IsRequest() {
+		if names := h.formatChainTargets(msg); names != nil {
+			return h.handleFormatChain(ctx, msg, names)
+		}
+	}
+
+	if msg.IsNotification() && isDocumentLifecycle(msg.Method) {
+		return nil, h.broadcastDocumentNotification(ctx, msg)
+	}
+
+	if msg.Method == lsp.MethodTextDocumentCompletion && msg.IsRequest() {
+		if names := h.mergeCompletionTargets(msg); names != nil {
+			return h.handleMergedCompletion(ctx, msg, names)
+		}
+	}
+
+	if msg.Method == lsp.MethodTextDocumentHover && msg.IsRequest() {
+		if names := h.server.routeAll(msg.Method, msg.Params); len(names) > 1 {
+			return h.handleHover(ctx, msg, names)
+		}
+	}
+
+	if takesFirstAnswer(msg.Method) && msg.IsRequest() {
+		if names := h.server.routeAll(msg.Method, msg.Params); len(names) > 1 {
+			return h.handleFirstAnswer(ctx, msg, names)
+		}
+	}
+
+	if msg.Method == lsp.MethodTextDocumentRename && msg.IsRequest() && h.server.mergesRenames() {
+		if names := h.server.routeAll(msg.Method, msg.Params); len(names) > 1 {
+			return h.handleRename(ctx, msg, names)
+		}
+	}
+
+	if legend := h.server.semanticLegend(); legend != nil && isSemanticTokensMethod(msg.Method) && msg.IsRequest() {
+		return h.handleSemanticTokens(ctx, msg, *legend)
+	}
+
+	if msg.Method == lsp.MethodTextDocumentWillSaveWaitUntil && msg.IsRequest() {
+		return h.handleWillSaveWaitUntil(ctx, msg)
+	}
+
+	if msg.Method == lsp.MethodCompletionItemResolve && msg.IsRequest() {
+		if resp, handled, err := h.handleCompletionResolve(ctx, msg); handled {
+			return resp, err
+		}
+	}
+
+	if msg.Method == lsp.MethodTextDocumentCodeAction && msg.IsRequest() {
+		if names := h.server.routeAll(msg.Method, msg.Params); len(names) > 0 {
+			return h.handleCodeAction(ctx, msg, names)
+		}
+	}
+
+	if msg.Method == lsp.MethodCodeActionResolve && msg.IsRequest() {
+		if resp, handled, err := h.handleCodeActionResolve(ctx, msg); handled {
+			return resp, err
+		}
+	}
+
+	if msg.Method == lsp.MethodTextDocumentCodeLens && msg.IsRequest() {
+		if names := h.server.routeAll(msg.Method, msg.Params); len(names) > 0 {
+			return h.handleCodeLens(ctx, msg, names)
+		}
+	}
+
+	if msg.Method == lsp.MethodCodeLensResolve && msg.IsRequest() {
+		if resp, handled, err := h.handleCodeLensResolve(ctx, msg); handled {
+			return resp, err
+		}
+	}
+
+	if msg.Method == lsp.MethodTextDocumentInlayHint && msg.IsRequest() {
+		if names := h.server.routeAll(msg.Method, msg.Params); len(names) > 0 {
+			return h.handleInlayHint(ctx, msg, names)
+		}
+	}
+
+	if msg.Method == lsp.MethodInlayHintResolve && msg.IsRequest() {
+		if resp, handled, err := h.handleInlayHintResolve(ctx, msg); handled {
+			return resp, err
+		}
+	}
+
+	if isHierarchyFollowUp(msg.Method) && msg.IsRequest() {
+		return h.handleHierarchyFollowUp(ctx, msg)
+	}
+
+	lspName := h.server.route(msg.Method, msg.Params)
+	if msg.Method == lsp.MethodWorkspaceExecuteCommand {
+		lspName = h.server.commandOwner(msg.Params)
+		if lspName == "" && msg.IsRequest() {
+			return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.MethodNotFound,
+				"no LSP owns this command", nil)
+		}
+	}
 	if lspName == "" {
 		if msg.IsRequest() {
 			return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.MethodNotFound,
@@ -113,11 +306,7 @@ func (h *Handler) handleDefault(ctx context.Context, msg *jsonrpc.Message) (*jso
 		return nil, nil
 	}
 
-	h.server.mu.RLock()
-	initParams := h.server.initParams
-	h.server.mu.RUnlock()
-
-	inst, err := h.server.pool.GetOrStart(ctx, lspName, initParams)
+	inst, err := h.startInstance(ctx, lspName, msg.IsRequest())
 	if err != nil {
 		if msg.IsRequest() {
 			return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
@@ -130,19 +319,141 @@ func (h *Handler) handleDefault(ctx context.Context, msg *jsonrpc.Message) (*jso
 		return nil, inst.Notify(msg.Method, msg.Params)
 	}
 
-	result, err := inst.Call(ctx, msg.Method, msg.Params)
+	h.server.checkMethodSupported(inst, msg.Method)
+
+	result, err := h.server.call(ctx, lspName, inst, msg.Method, msg.Params)
 	if err != nil {
-		if rpcErr, ok := err.(*jsonrpc.Error); ok {
-			return jsonrpc.NewErrorResponse(*msg.ID, rpcErr.Code, rpcErr.Message, rpcErr.Data)
+		return callErrorResponse(*msg.ID, err)
+	}
+
+	if isEmptyAnswer(msg.Method, result) && h.server.fallsBack(msg.Method) {
+		if fallback, name, ok := h.fallback(ctx, msg, lspName); ok {
+			result, lspName = fallback, name
 		}
-		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError, err.Error(), nil)
 	}
 
+	if msg.Method == lsp.MethodTextDocumentDiagnostic {
+		result = h.server.applyDiagnosticConfig(lspName, documentURI(msg.Params), result)
+	}
+
+	result = h.server.tagForFollowUp(msg.Method, result, lspName)
+
 	resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
 	resp.Result = result
 	return resp, nil
 }
 
+// tagForFollowUp tags the items in lspName's answer to method that later
+// requests, which name no document, must be routed back to lspName with.
+// Completions are only tagged if lspName resolves them, since tagging means
+// decoding every list on the hottest path.
+func (s *Server) tagForFollowUp(method string, result json.RawMessage, lspName string) json.RawMessage {
+	switch {
+	case method == lsp.MethodTextDocumentCompletion:
+		if !s.resolvesCompletions(lspName) {
+			return result
+		}
+		return tagCompletionResult(result, lspName)
+	case isHierarchyPrepare(method):
+		return tagHierarchyResult(method, result, lspName)
+	}
+	return result
+}
+
+// startInstance gets or starts lspName, waiting for its startup slot unless
+// focused (see startScheduler). Cancelling ctx ends the wait but not the
+// instance, which outlives the request (see startWithin).
+func (h *Handler) startInstance(ctx context.Context, lspName string, focused bool) (*subprocess.LSPInstance, error) {
+	h.server.mu.RLock()
+	clientParams := h.server.initParams
+	h.server.mu.RUnlock()
+	initParams := h.server.backendInitParams(lspName, clientParams)
+
+	if state, _ := h.server.pool.State(lspName); state != subprocess.LSPStateRunning && state != subprocess.LSPStateStarting {
+		h.server.scheduler.wait(ctx, lspName, focused)
+	}
+
+	inst, err := h.server.startWithin(ctx, lspName, initParams)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.server.replayDocuments(lspName, inst); err != nil {
+		return nil, fmt.Errorf("replaying open documents: %w", err)
+	}
+	return inst, nil
+}
+
+func isDocumentLifecycle(method string) bool {
+	switch method {
+	case lsp.MethodTextDocumentDidOpen,
+		lsp.MethodTextDocumentDidChange,
+		lsp.MethodTextDocumentWillSave,
+		lsp.MethodTextDocumentDidSave,
+		lsp.MethodTextDocumentDidClose:
+		return true
+	}
+	return false
+}
+
+// broadcastDocumentNotification sends a document lifecycle notification to
+// every LSP matching the document, so secondary servers (linters, formatters)
+// track the same document state as the primary. Servers are notified
+// concurrently, so one that is slow to start doesn't hold up the others, but
+// it returns only once all of them have been, which keeps each server's
+// notifications in order. didSave follows each server's declared save
+// options (see saveParams). Open, change, and close go through the document
+// store so a server started later can catch up.
+func (h *Handler) broadcastDocumentNotification(ctx context.Context, msg *jsonrpc.Message) error {
+	h.server.documents.apply(msg.Method, msg.Params)
+	uri := documentURI(msg.Params)
+
+	names := h.server.routeAll(msg.Method, msg.Params)
+	errs := make([]error, len(names))
+	forEachConcurrently(len(names), func(i int) {
+		lspName := names[i]
+		if msg.Method == lsp.MethodTextDocumentDidClose {
+			// Don't start a server just to close a document it never saw.
+			if !h.server.documents.opened(lspName, uri) {
+				return
+			}
+		}
+
+		inst, err := h.startInstance(ctx, lspName, h.server.requests.isFocused(lspName))
+		if err != nil {
+			errs[i] = fmt.Errorf("starting LSP %s: %w", lspName, err)
+			return
+		}
+
+		params := msg.Params
+		if msg.Method == lsp.MethodTextDocumentDidSave {
+			var ok bool
+			if params, ok = h.server.saveParams(inst, msg.Params); !ok {
+				return
+			}
+		}
+
+		switch msg.Method {
+		case lsp.MethodTextDocumentDidOpen, lsp.MethodTextDocumentDidChange, lsp.MethodTextDocumentDidClose:
+			err = h.server.documents.forward(lspName, inst, msg.Method, uri, params)
+		default:
+			err = inst.Notify(msg.Method, params)
+		}
+		if err != nil {
+			errs[i] = fmt.Errorf("notifying %s: %w", lspName, err)
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// documentURI returns params.textDocument.uri.
+func documentURI(params json.RawMessage) lsp.DocumentURI {
+	var p struct {
+		TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+	}
+	json.Unmarshal(params, &p)
+	return p.TextDocument.URI
+}
+
 func (h *Handler) tryExternalFormat(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, bool) {
 	if h.server.fmtRouter == nil {
 		return nil, false
@@ -205,26 +516,23 @@ func (h *Handler) forwardServerNotification(lspName string, msg *jsonrpc.Message
 func serverNotificationHandler(s *Server, lspName string) jsonrpc.Handler {
 	return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
 		if msg.IsNotification() {
-			if s.clientConn != nil {
+			msg.Params = s.plugins.filterNotification(ctx, msg.Method, msg.Params)
+			if msg.Method == lsp.MethodTextDocumentPublishDiagnostics {
+				s.publishDiagnostics(lspName, msg.Params)
+			} else if msg.Method == lsp.MethodProgress {
+				s.forwardProgress(lspName, msg.Params)
+			} else if msg.Method == lsp.MethodTelemetryEvent {
+				s.handleTelemetry(lspName, msg.Params)
+			} else if s.clientConn != nil {
+				if msg.Method == lsp.MethodWindowShowMessage || msg.Method == lsp.MethodWindowLogMessage {
+					msg.Params = prefixMessage(lspName, msg.Params)
+				}
 				s.clientConn.Notify(msg.Method, msg.Params)
 			}
 		}
 
 		if msg.IsRequest() {
-			// Intercept workspace/configuration requests from backend LSPs
-			if msg.Method == lsp.MethodWorkspaceConfiguration {
-				return handleWorkspaceConfiguration(s, lspName, msg)
-			}
-
-			if s.clientConn != nil {
-				result, err := s.clientConn.Call(ctx, msg.Method, msg.Params)
-				if err != nil {
-					return nil, err
-				}
-				resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
-				resp.Result = result
-				return resp, nil
-			}
+			return s.handleReverseRequest(ctx, lspName, msg)
 		}
 
 		return nil, nil
@@ -304,7 +612,11 @@ func (s *Server) aggregateCapabilities() lsp.ServerCapabilities {
 		caps = append(caps, defaultCapabilities())
 	}
 
-	return lsp.MergeCapabilities(caps...)
+	merged := lsp.MergeCapabilities(caps...)
+	if s.legend != nil {
+		merged.SemanticTokensProvider = semanticTokensProvider(*s.legend)
+	}
+	return merged
 }
 
 func (s *Server) loadCachedCapabilities() ([]lsp.ServerCapabilities, error) {
@@ -323,23 +635,67 @@ func (s *Server) loadCachedCapabilities() ([]lsp.ServerCapabilities, error) {
 
 func defaultCapabilities() lsp.ServerCapabilities {
 	return lsp.ServerCapabilities{
-		TextDocumentSync: 1,
-		HoverProvider:    true,
+		// Ask for saved text so it can be forwarded to servers that want it;
+		// saveParams strips it for the rest.
+		TextDocumentSync: map[string]any{
+			"openClose":         true,
+			"change":            1,
+			"willSaveWaitUntil": true,
+			"save":              map[string]any{"includeText": true},
+		},
+		HoverProvider: true,
 		CompletionProvider: &lsp.CompletionOptions{
 			TriggerCharacters: []string{"."},
+			ResolveProvider:   true,
+		},
+		SignatureHelpProvider: &lsp.SignatureHelpOptions{
+			TriggerCharacters:   []string{"(", ","},
+			RetriggerCharacters: []string{")"},
 		},
 		DefinitionProvider:              true,
 		TypeDefinitionProvider:          true,
 		ImplementationProvider:          true,
 		ReferencesProvider:              true,
+		DocumentHighlightProvider:       true,
+		LinkedEditingRangeProvider:      true,
 		DocumentSymbolProvider:          true,
-		CodeActionProvider:              true,
+		CodeActionProvider:              map[string]any{"resolveProvider": true},
+		CodeLensProvider:                &lsp.CodeLensOptions{ResolveProvider: true},
 		DocumentFormattingProvider:      true,
 		DocumentRangeFormattingProvider: true,
 		RenameProvider:                  true,
 		FoldingRangeProvider:            true,
 		SelectionRangeProvider:          true,
-		WorkspaceSymbolProvider:         true,
+		WorkspaceSymbolProvider:         map[string]any{"resolveProvider": true},
+		MonikerProvider:                 true,
+		CallHierarchyProvider:           true,
+		TypeHierarchyProvider:           true,
+		// Folder changes are needed to route to per-folder instances.
+		Workspace: &lsp.ServerWorkspaceCaps{
+			WorkspaceFolders: &lsp.WorkspaceFoldersServerCaps{
+				Supported:           true,
+				ChangeNotifications: true,
+			},
+			// Every file operation is asked for; each backend is then sent
+			// the files its own filters match.
+			FileOperations: allFileOperations(),
+		},
+	}
+}
+
+func allFileOperations() *lsp.FileOperationOptions {
+	all := func() *lsp.FileOperationRegistrationOptions {
+		return &lsp.FileOperationRegistrationOptions{
+			Filters: []lsp.FileOperationFilter{{Pattern: lsp.FileOperationPattern{Glob: "**/*"}}},
+		}
+	}
+	return &lsp.FileOperationOptions{
+		DidCreate:  all(),
+		WillCreate: all(),
+		DidRename:  all(),
+		WillRename: all(),
+		DidDelete:  all(),
+		WillDelete: all(),
 	}
 }
 
@@ -360,7 +716,7 @@ func (s *Server) routeToAllLSPs(ctx context.Context, method string, params any)
 	s.mu.RUnlock()
 
 	for _, lspCfg := range s.cfg.LSPs {
-		inst, err := s.pool.GetOrStart(ctx, lspCfg.Name, initParams)
+		inst, err := s.startWithin(ctx, lspCfg.Name, initParams)
 		if err != nil {
 			continue
 		}
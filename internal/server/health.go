@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// MethodHealthChanged is a lux-specific notification sent to the client when
+// a backend's health changes, so editor plugins can show a status indicator.
+const MethodHealthChanged = "lux/healthChanged"
+
+type HealthStatus string
+
+const (
+	HealthCrashed           HealthStatus = "crashed"
+	HealthFailed            HealthStatus = "failed"
+	HealthRestarting        HealthStatus = "restarting"
+	HealthRecovered         HealthStatus = "recovered"
+	HealthDisabled          HealthStatus = "disabled"
+	HealthMethodUnsupported HealthStatus = "methodUnsupported"
+	HealthMissingProject    HealthStatus = "missingProjectFile"
+)
+
+type HealthChangedParams struct {
+	Server  string       `json:"server"`
+	Status  HealthStatus `json:"status"`
+	Method  string       `json:"method,omitempty"`
+	Message string       `json:"message"`
+	// Stderr is the tail of the backend's stderr, sent when it is disabled.
+	Stderr string `json:"stderr,omitempty"`
+}
+
+// healthReporter tracks which backends are degraded and which warnings
+// (unsupported methods, failed renicing) have already been given, so each
+// problem is reported once.
+type healthReporter struct {
+	degraded map[string]bool
+	warned   map[string]bool
+	mu       sync.Mutex
+}
+
+func newHealthReporter() *healthReporter {
+	return &healthReporter{
+		degraded: make(map[string]bool),
+		warned:   make(map[string]bool),
+	}
+}
+
+// onStateChange is installed as the pool's StateHandler.
+func (s *Server) onStateChange(name string, from, to subprocess.LSPState, err error) {
+	if from == subprocess.LSPStateRunning && to != subprocess.LSPStateRunning {
+		s.endProgress(name)
+		s.withdrawRegistrations(name)
+		s.commands.forget(name)
+		if watcher := s.fileWatcher(); watcher != nil {
+			watcher.forget(name)
+		}
+		s.documents.forget(name)
+	}
+
+	params, ok := s.health.transition(name, from, to, err)
+	if !ok {
+		return
+	}
+	s.reportHealth(params)
+}
+
+func (h *healthReporter) transition(name string, from, to subprocess.LSPState, err error) (HealthChangedParams, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	params := HealthChangedParams{Server: name}
+	switch {
+	case to == subprocess.LSPStateDisabled:
+		h.degraded[name] = true
+		params.Status = HealthDisabled
+		params.Message = fmt.Sprintf("lux: %v", err)
+		var disabled *subprocess.DisabledError
+		if errors.As(err, &disabled) {
+			params.Stderr = disabled.StderrTail
+		}
+	case to == subprocess.LSPStateCrashed:
+		h.degraded[name] = true
+		params.Status = HealthCrashed
+		params.Message = fmt.Sprintf("lux: %s crashed: %v", name, err)
+	case to == subprocess.LSPStateFailed:
+		h.degraded[name] = true
+		params.Status = HealthFailed
+		params.Message = fmt.Sprintf("lux: %s failed to start: %v", name, err)
+	case to == subprocess.LSPStateStarting && h.degraded[name]:
+		params.Status = HealthRestarting
+		params.Message = fmt.Sprintf("lux: restarting %s", name)
+	case to == subprocess.LSPStateRunning && h.degraded[name]:
+		delete(h.degraded, name)
+		params.Status = HealthRecovered
+		params.Message = fmt.Sprintf("lux: %s recovered", name)
+	default:
+		return params, false
+	}
+
+	return params, true
+}
+
+// healthCheckPoll is how often the configuration is looked at again while
+// health checks are off, so a reload turning them on takes effect.
+const healthCheckPoll = 30 * time.Second
+
+// checkBackendHealth probes running backends every health_check_interval
+// until ctx is done. Unresponsive backends are restarted by the pool (see
+// subprocess.Pool.CheckHealth), and the client hears they crashed.
+func (s *Server) checkBackendHealth(ctx context.Context) error {
+	for {
+		s.mu.RLock()
+		interval, timeout := s.cfg.HealthCheck()
+		s.mu.RUnlock()
+
+		wait := interval
+		if wait <= 0 {
+			wait = healthCheckPoll
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		if interval > 0 {
+			s.pool.CheckHealth(ctx, timeout)
+		}
+	}
+}
+
+// checkMethodSupported warns the client, once per server and method, when a
+// request is routed to a server whose capabilities don't advertise it (either
+// because the server lacks it or because it was disabled in config).
+func (s *Server) checkMethodSupported(inst *subprocess.LSPInstance, method string) {
+	if s.supportsMethod(inst, method) {
+		return
+	}
+
+	key := inst.Name + "\x00" + method
+	s.health.mu.Lock()
+	if s.health.warned[key] {
+		s.health.mu.Unlock()
+		return
+	}
+	s.health.warned[key] = true
+	s.health.mu.Unlock()
+
+	s.reportHealth(HealthChangedParams{
+		Server:  inst.Name,
+		Status:  HealthMethodUnsupported,
+		Method:  method,
+		Message: fmt.Sprintf("lux: %s does not support %s (not advertised or disabled in config)", inst.Name, method),
+	})
+}
+
+// checkRequirements reports an error instead of letting a stopped server
+// start when none of the project files it needs (see config.LSP.Requires)
+// exist in the workspace, since it would start and then silently return
+// nothing. The client is told once, until the files appear. The pool runs
+// it before every start (see subprocess.Registration.Requires), so it covers
+// requests, prewarming, and `lux start` alike.
+func (s *Server) checkRequirements(lspName string) error {
+
+	s.mu.RLock()
+	root := s.projectRoot
+	s.mu.RUnlock()
+	if _, folder := splitInstanceName(lspName); folder != "" {
+		root = folder
+	}
+
+	l := s.lspConfig(lspName)
+	if root == "" || l == nil {
+		return nil
+	}
+
+	err := l.CheckRequirements(root)
+
+	key := lspName + "\x00requires"
+	s.health.mu.Lock()
+	warned := s.health.warned[key]
+	if err != nil {
+		s.health.warned[key] = true
+	} else {
+		delete(s.health.warned, key)
+	}
+	s.health.mu.Unlock()
+
+	if err != nil && !warned {
+		s.reportHealth(HealthChangedParams{
+			Server:  lspName,
+			Status:  HealthMissingProject,
+			Message: fmt.Sprintf("lux: not starting %v", err),
+		})
+	}
+	return err
+}
+
+func (s *Server) reportHealth(params HealthChangedParams) {
+	if s.clientConn == nil {
+		return
+	}
+
+	s.clientConn.Notify(MethodHealthChanged, params)
+
+	s.mu.RLock()
+	severity := s.cfg.HealthSeverityLevel()
+	s.mu.RUnlock()
+
+	msgType, ok := healthMessageType(severity)
+	if !ok {
+		return
+	}
+	if params.Status == HealthRecovered && msgType < lsp.MessageTypeInfo {
+		msgType = lsp.MessageTypeInfo
+	}
+
+	s.clientConn.Notify(lsp.MethodWindowShowMessage, lsp.ShowMessageParams{
+		Type:    msgType,
+		Message: params.Message,
+	})
+}
+
+func healthMessageType(severity string) (lsp.MessageType, bool) {
+	switch severity {
+	case config.HealthSeverityError:
+		return lsp.MessageTypeError, true
+	case config.HealthSeverityWarning:
+		return lsp.MessageTypeWarning, true
+	case config.HealthSeverityInfo:
+		return lsp.MessageTypeInfo, true
+	case config.HealthSeverityLog:
+		return lsp.MessageTypeLog, true
+	default:
+		return 0, false
+	}
+}
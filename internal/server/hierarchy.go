@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// isHierarchyPrepare reports whether method prepares hierarchy items.
+func isHierarchyPrepare(method string) bool {
+	return method == lsp.MethodTextDocumentPrepareCallHierarchy ||
+		method == lsp.MethodTextDocumentPrepareTypeHierarchy
+}
+
+// isHierarchyFollowUp reports whether method navigates from an item a
+// prepare request returned.
+func isHierarchyFollowUp(method string) bool {
+	switch method {
+	case lsp.MethodCallHierarchyIncomingCalls,
+		lsp.MethodCallHierarchyOutgoingCalls,
+		lsp.MethodTypeHierarchySupertypes,
+		lsp.MethodTypeHierarchySubtypes:
+		return true
+	}
+	return false
+}
+
+// tagHierarchyResult tags the items in server's answer to a hierarchy
+// request: the items themselves, or the caller (from) or callee (to) of
+// each call, so navigating further stays pinned too.
+func tagHierarchyResult(method string, result json.RawMessage, server string) json.RawMessage {
+	var entries []map[string]json.RawMessage
+	if err := json.Unmarshal(result, &entries); err != nil || len(entries) == 0 {
+		return result
+	}
+
+	field := ""
+	switch method {
+	case lsp.MethodCallHierarchyIncomingCalls:
+		field = "from"
+	case lsp.MethodCallHierarchyOutgoingCalls:
+		field = "to"
+	}
+
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		if field == "" {
+			tagOrigin(entry, server)
+			continue
+		}
+		var item map[string]json.RawMessage
+		if err := json.Unmarshal(entry[field], &item); err != nil || item == nil {
+			continue
+		}
+		tagOrigin(item, server)
+		entry[field], _ = json.Marshal(item)
+	}
+
+	tagged, err := json.Marshal(entries)
+	if err != nil {
+		return result
+	}
+	return tagged
+}
+
+// handleHierarchyFollowUp routes incoming and outgoing calls, supertypes,
+// and subtypes to the server that prepared the item. Items lux didn't tag
+// go to the primary LSP for the item's document.
+func (h *Handler) handleHierarchyFollowUp(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	var params map[string]json.RawMessage
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &params); err != nil || json.Unmarshal(params["item"], &item) != nil || item == nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams, "missing hierarchy item", nil)
+	}
+
+	lspName, ok := untagOrigin(item)
+	if !ok {
+		var uri lsp.DocumentURI
+		json.Unmarshal(item["uri"], &uri)
+		if name := h.server.Router().RouteByURI(uri); name != "" {
+			lspName = h.server.backendFor(name, uri)
+		}
+	}
+	if lspName == "" {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.MethodNotFound,
+			"no LSP configured for this file type", nil)
+	}
+	params["item"], _ = json.Marshal(item)
+
+	inst, err := h.startInstance(ctx, lspName, true)
+	if err != nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
+			fmt.Sprintf("starting LSP %s: %v", lspName, err), nil)
+	}
+
+	h.server.checkMethodSupported(inst, msg.Method)
+
+	result, err := h.server.call(ctx, lspName, inst, msg.Method, params)
+	if err != nil {
+		return callErrorResponse(*msg.ID, err)
+	}
+
+	resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+	resp.Result = tagHierarchyResult(msg.Method, result, lspName)
+	return resp, nil
+}
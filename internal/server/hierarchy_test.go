@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestTagHierarchyResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		result   string
+		expected string
+	}{
+		{
+			name:     "prepared items",
+			method:   lsp.MethodTextDocumentPrepareCallHierarchy,
+			result:   `[{"name":"main","data":{"id":1}},{"name":"run"}]`,
+			expected: `[{"data":{"luxServer":"gopls","luxData":{"id":1}},"name":"main"},{"data":{"luxServer":"gopls"},"name":"run"}]`,
+		},
+		{
+			name:     "incoming calls tag the caller",
+			method:   lsp.MethodCallHierarchyIncomingCalls,
+			result:   `[{"from":{"name":"main"},"fromRanges":[]}]`,
+			expected: `[{"from":{"data":{"luxServer":"gopls"},"name":"main"},"fromRanges":[]}]`,
+		},
+		{
+			name:     "outgoing calls tag the callee",
+			method:   lsp.MethodCallHierarchyOutgoingCalls,
+			result:   `[{"to":{"name":"run","data":2},"fromRanges":[]}]`,
+			expected: `[{"fromRanges":[],"to":{"data":{"luxServer":"gopls","luxData":2},"name":"run"}}]`,
+		},
+		{
+			name:     "supertypes",
+			method:   lsp.MethodTypeHierarchySupertypes,
+			result:   `[{"name":"Reader","data":"r"}]`,
+			expected: `[{"data":{"luxServer":"gopls","luxData":"r"},"name":"Reader"}]`,
+		},
+		{
+			name:     "no items",
+			method:   lsp.MethodTextDocumentPrepareCallHierarchy,
+			result:   `null`,
+			expected: `null`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tagHierarchyResult(tt.method, json.RawMessage(tt.result), "gopls")
+			if string(got) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUntagHierarchyItem(t *testing.T) {
+	tagged := tagHierarchyResult(lsp.MethodTextDocumentPrepareCallHierarchy,
+		json.RawMessage(`[{"name":"main","data":{"id":1}},{"name":"run"}]`), "gopls")
+
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(tagged, &items); err != nil {
+		t.Fatal(err)
+	}
+
+	server, ok := untagOrigin(items[0])
+	if !ok || server != "gopls" {
+		t.Errorf("expected %q, got %q (%v)", "gopls", server, ok)
+	}
+	if string(items[0]["data"]) != `{"id":1}` {
+		t.Errorf("expected %s, got %s", `{"id":1}`, items[0]["data"])
+	}
+
+	if _, ok := untagOrigin(items[1]); !ok {
+		t.Error("expected item without data to be tagged")
+	}
+	if _, ok := items[1]["data"]; ok {
+		t.Errorf("expected data to be removed, got %s", items[1]["data"])
+	}
+
+	if _, ok := untagOrigin(map[string]json.RawMessage{"data": json.RawMessage(`{"id":1}`)}); ok {
+		t.Error("expected untagged item to be reported as such")
+	}
+}
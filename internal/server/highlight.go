@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// takesFirstAnswer reports whether method is asked of every LSP matching
+// the document, taking the first non-empty answer. Document highlights and
+// linked editing ranges are often provided by only one of several servers
+// for a file, and not necessarily the primary.
+func takesFirstAnswer(method string) bool {
+	switch method {
+	case lsp.MethodTextDocumentDocumentHighlight, lsp.MethodTextDocumentLinkedEditingRange:
+		return true
+	}
+	return false
+}
+
+// handleFirstAnswer asks every LSP in names and returns the first non-empty
+// answer in routing order. If none has one, it returns null, or the first
+// error when every server failed.
+func (h *Handler) handleFirstAnswer(ctx context.Context, msg *jsonrpc.Message, names []string) (*jsonrpc.Message, error) {
+	results := h.server.fanOut(ctx, names, msg.Method, msg.Params)
+
+	answered := false
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		answered = true
+		if !isEmptyAnswer(msg.Method, r.result) {
+			return jsonrpc.NewResponse(*msg.ID, r.result)
+		}
+	}
+	if !answered && len(results) > 0 {
+		return callErrorResponse(*msg.ID, results[0].err)
+	}
+	return jsonrpc.NewResponse(*msg.ID, nil)
+}
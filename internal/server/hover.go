@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+// hoverResult is a textDocument/hover result with its contents kept raw,
+// since servers answer with MarkupContent, a MarkedString, or a list of them.
+type hoverResult struct {
+	Contents json.RawMessage `json:"contents"`
+	Range    json.RawMessage `json:"range,omitempty"`
+}
+
+// handleHover asks every LSP matching the document for a hover. With
+// hover_mode = "merge" the results are combined under a header per server;
+// otherwise the first non-empty one, in config order, is returned.
+func (h *Handler) handleHover(ctx context.Context, msg *jsonrpc.Message, names []string) (*jsonrpc.Message, error) {
+	h.server.mu.RLock()
+	merge := h.server.cfg.MergesHovers()
+	h.server.mu.RUnlock()
+
+	results := h.server.fanOut(ctx, names, msg.Method, msg.Params)
+
+	resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+	if merge {
+		merged := mergeHovers(results)
+		if merged == nil {
+			return resp, nil
+		}
+		return jsonrpc.NewResponse(*msg.ID, merged)
+	}
+
+	for _, r := range results {
+		if hoverMarkdown(r.result) != "" {
+			resp.Result = r.result
+			return resp, nil
+		}
+	}
+	return resp, nil
+}
+
+// mergeHovers concatenates non-empty hovers as markdown sections headed by
+// the server name. A single non-empty hover is returned as the server sent
+// it. The range is taken from the first hover that has one.
+func mergeHovers(results []fanoutResult) *hoverResult {
+	var sections []string
+	var first json.RawMessage
+	merged := &hoverResult{}
+
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		md := hoverMarkdown(r.result)
+		if md == "" {
+			continue
+		}
+
+		if first == nil {
+			first = r.result
+		}
+		if merged.Range == nil {
+			var hover hoverResult
+			json.Unmarshal(r.result, &hover)
+			merged.Range = hover.Range
+		}
+		sections = append(sections, fmt.Sprintf("**%s**\n\n%s", r.server, md))
+	}
+
+	switch len(sections) {
+	case 0:
+		return nil
+	case 1:
+		var hover hoverResult
+		json.Unmarshal(first, &hover)
+		return &hover
+	}
+
+	merged.Contents, _ = json.Marshal(map[string]string{
+		"kind":  "markdown",
+		"value": strings.Join(sections, "\n\n---\n\n"),
+	})
+	return merged
+}
+
+// hoverMarkdown renders a hover result's contents as markdown, returning ""
+// for a null or empty hover.
+func hoverMarkdown(raw json.RawMessage) string {
+	var hover hoverResult
+	if err := json.Unmarshal(raw, &hover); err != nil || len(hover.Contents) == 0 {
+		return ""
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(hover.Contents, &list); err != nil {
+		list = []json.RawMessage{hover.Contents}
+	}
+
+	var parts []string
+	for _, item := range list {
+		if md := markedStringMarkdown(item); md != "" {
+			parts = append(parts, md)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// markedStringMarkdown renders a MarkupContent, a plain MarkedString, or a
+// {language, value} MarkedString as markdown.
+func markedStringMarkdown(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strings.TrimSpace(s)
+	}
+
+	var v struct {
+		Kind     string `json:"kind"`
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+
+	value := strings.TrimSpace(v.Value)
+	if value == "" {
+		return ""
+	}
+	if v.Language != "" {
+		return fmt.Sprintf("```%s\n%s\n```", v.Language, value)
+	}
+	if v.Kind == "plaintext" {
+		return fmt.Sprintf("```\n%s\n```", value)
+	}
+	return value
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestHoverMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{name: "null", raw: `null`, expected: ""},
+		{name: "markup", raw: `{"contents":{"kind":"markdown","value":"func Run()"}}`, expected: "func Run()"},
+		{name: "plaintext", raw: `{"contents":{"kind":"plaintext","value":"int"}}`, expected: "```\nint\n```"},
+		{name: "marked string", raw: `{"contents":"docs"}`, expected: "docs"},
+		{name: "language string", raw: `{"contents":{"language":"go","value":"var x int"}}`, expected: "```go\nvar x int\n```"},
+		{name: "list", raw: `{"contents":[{"language":"python","value":"def f()"},"Does f."]}`, expected: "```python\ndef f()\n```\n\nDoes f."},
+		{name: "empty markup", raw: `{"contents":{"kind":"markdown","value":""}}`, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hoverMarkdown(json.RawMessage(tt.raw))
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMergeHovers(t *testing.T) {
+	results := []fanoutResult{
+		{server: "gopls", result: json.RawMessage(`{"contents":{"kind":"markdown","value":"func Run()"},"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}}}`)},
+		{server: "empty", result: json.RawMessage(`null`)},
+		{server: "broken", err: errors.New("timeout")},
+		{server: "docs", result: json.RawMessage(`{"contents":"Runs the server."}`)},
+	}
+
+	merged := mergeHovers(results)
+	if merged == nil {
+		t.Fatal("expected merged hover")
+	}
+
+	var contents struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	}
+	json.Unmarshal(merged.Contents, &contents)
+
+	expected := "**gopls**\n\nfunc Run()\n\n---\n\n**docs**\n\nRuns the server."
+	if contents.Value != expected {
+		t.Errorf("expected %q, got %q", expected, contents.Value)
+	}
+	if contents.Kind != "markdown" {
+		t.Errorf("expected %q, got %q", "markdown", contents.Kind)
+	}
+	if merged.Range == nil {
+		t.Error("expected range from first hover")
+	}
+}
+
+func TestMergeHoversSingle(t *testing.T) {
+	results := []fanoutResult{
+		{server: "gopls", result: json.RawMessage(`{"contents":"docs"}`)},
+		{server: "empty", result: json.RawMessage(`null`)},
+	}
+
+	merged := mergeHovers(results)
+	if merged == nil {
+		t.Fatal("expected hover")
+	}
+	if string(merged.Contents) != `"docs"` {
+		t.Errorf("expected %q, got %q", `"docs"`, merged.Contents)
+	}
+
+	if mergeHovers(results[1:]) != nil {
+		t.Error("expected nil for no hovers")
+	}
+}
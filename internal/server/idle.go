@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// idleCheckInterval is how often backends are checked for having been idle
+// longer than their idle_timeout.
+const idleCheckInterval = 30 * time.Second
+
+// stopIdleBackends stops backends idle for longer than their configured
+// idle_timeout until ctx is done, freeing the memory of servers the user has
+// stopped using. They start again on their next request.
+func (s *Server) stopIdleBackends(ctx context.Context) error {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.stopIdle()
+		}
+	}
+}
+
+// stopIdle stops the backends that are idle now. Per-folder instances use
+// the idle_timeout of the LSP they run.
+func (s *Server) stopIdle() []string {
+	s.mu.RLock()
+	cfg := s.cfg
+	s.mu.RUnlock()
+
+	stopped := s.pool.StopIdle(func(name string) time.Duration {
+		lspName, _ := splitInstanceName(name)
+		return cfg.IdleTimeoutFor(lspName)
+	})
+	for _, name := range stopped {
+		fmt.Fprintf(os.Stderr, "[lux] stopped %s after it was idle for longer than its idle_timeout\n", name)
+	}
+	return stopped
+}
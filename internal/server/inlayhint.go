@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// handleInlayHint asks every LSP matching the document for inlay hints and
+// returns them as a single list.
+func (h *Handler) handleInlayHint(ctx context.Context, msg *jsonrpc.Message, names []string) (*jsonrpc.Message, error) {
+	results := h.server.fanOut(ctx, names, msg.Method, msg.Params)
+	return jsonrpc.NewResponse(*msg.ID, mergeInlayHints(results))
+}
+
+type inlayHintEntry struct {
+	hint     map[string]json.RawMessage
+	position lsp.Position
+}
+
+// mergeInlayHints combines the hints each server returned, tagged with
+// their server, sorted by position. Hints at the same position keep server
+// order, primary first.
+func mergeInlayHints(results []fanoutResult) []map[string]json.RawMessage {
+	var entries []inlayHintEntry
+	for _, r := range results {
+		if r.err != nil || len(r.result) == 0 {
+			continue
+		}
+
+		var hints []map[string]json.RawMessage
+		if err := json.Unmarshal(r.result, &hints); err != nil {
+			continue
+		}
+		for _, hint := range hints {
+			if hint == nil {
+				continue
+			}
+			entry := inlayHintEntry{hint: hint}
+			json.Unmarshal(hint["position"], &entry.position)
+			tagOrigin(hint, r.server)
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return positionBefore(entries[i].position, entries[j].position)
+	})
+
+	merged := make([]map[string]json.RawMessage, 0, len(entries))
+	for _, e := range entries {
+		merged = append(merged, e.hint)
+	}
+	return merged
+}
+
+// handleInlayHintResolve routes inlayHint/resolve to the server that
+// produced the hint. Hints that weren't tagged fall through to the default
+// handling.
+func (h *Handler) handleInlayHintResolve(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, bool, error) {
+	var hint map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &hint); err != nil {
+		return nil, false, nil
+	}
+
+	lspName, ok := untagOrigin(hint)
+	if !ok {
+		return nil, false, nil
+	}
+
+	inst, err := h.startInstance(ctx, lspName, true)
+	if err != nil {
+		resp, err := jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
+			fmt.Sprintf("starting LSP %s: %v", lspName, err), nil)
+		return resp, true, err
+	}
+
+	// Nothing to resolve; hand the hint back as the server produced it.
+	if !h.server.supportsMethod(inst, msg.Method) {
+		tagOrigin(hint, lspName)
+		resp, err := jsonrpc.NewResponse(*msg.ID, hint)
+		return resp, true, err
+	}
+
+	result, err := h.server.call(ctx, lspName, inst, msg.Method, hint)
+	if err != nil {
+		resp, err := callErrorResponse(*msg.ID, err)
+		return resp, true, err
+	}
+
+	var resolved map[string]json.RawMessage
+	if err := json.Unmarshal(result, &resolved); err != nil || resolved == nil {
+		tagOrigin(hint, lspName)
+		resp, err := jsonrpc.NewResponse(*msg.ID, hint)
+		return resp, true, err
+	}
+	tagOrigin(resolved, lspName)
+
+	resp, err := jsonrpc.NewResponse(*msg.ID, resolved)
+	return resp, true, err
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMergeInlayHints(t *testing.T) {
+	results := []fanoutResult{
+		{server: "rust-analyzer", result: json.RawMessage(`[
+			{"position": {"line": 4, "character": 10}, "label": ": i32", "data": {"id": 7}},
+			{"position": {"line": 1, "character": 2}, "label": ": String"}
+		]`)},
+		{server: "lint", result: json.RawMessage(`[
+			{"position": {"line": 4, "character": 10}, "label": "unused"},
+			{"position": {"line": 2, "character": 0}, "label": "note"}
+		]`)},
+		{server: "broken", err: errors.New("timeout")},
+	}
+
+	merged := mergeInlayHints(results)
+
+	expected := []struct {
+		label  string
+		server string
+	}{
+		{": String", "rust-analyzer"},
+		{"note", "lint"},
+		{": i32", "rust-analyzer"},
+		{"unused", "lint"},
+	}
+	if len(merged) != len(expected) {
+		t.Fatalf("expected %d hints, got %d", len(expected), len(merged))
+	}
+	for i, e := range expected {
+		var label string
+		json.Unmarshal(merged[i]["label"], &label)
+		if label != e.label {
+			t.Errorf("hint %d: expected %q, got %q", i, e.label, label)
+		}
+		server, ok := untagOrigin(merged[i])
+		if !ok || server != e.server {
+			t.Errorf("hint %d: expected tag %q, got %q", i, e.server, server)
+		}
+	}
+
+	if string(merged[2]["data"]) != `{"id":7}` {
+		t.Errorf("expected original data restored, got %s", merged[2]["data"])
+	}
+	if _, ok := merged[0]["data"]; ok {
+		t.Error("expected no data on a hint that had none")
+	}
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// lane classifies requests by how much their latency matters.
+type lane int
+
+const (
+	// laneInteractive is for requests a user is waiting on at the cursor:
+	// hover, completion, definition, and anything not known to be background.
+	laneInteractive lane = iota
+	// laneBackground is for whole-document or whole-workspace work editors
+	// issue on their own: diagnostic pulls, full semantic tokens, symbol
+	// searches, and decorations.
+	laneBackground
+)
+
+func (l lane) String() string {
+	if l == laneBackground {
+		return "background"
+	}
+	return "interactive"
+}
+
+func laneFor(method string) lane {
+	switch method {
+	case lsp.MethodTextDocumentDiagnostic,
+		lsp.MethodWorkspaceDiagnostic,
+		lsp.MethodTextDocumentSemanticTokensFull,
+		lsp.MethodTextDocumentSemanticTokensDelta,
+		lsp.MethodWorkspaceSymbol,
+		lsp.MethodTextDocumentDocumentSymbol,
+		lsp.MethodTextDocumentCodeLens,
+		lsp.MethodTextDocumentInlayHint,
+		lsp.MethodTextDocumentFoldingRange,
+		lsp.MethodTextDocumentDocumentLink,
+		lsp.MethodTextDocumentDocumentColor:
+		return laneBackground
+	}
+	return laneInteractive
+}
+
+type laneKey struct {
+	server  string
+	lane    lane
+	focused bool
+}
+
+// focusedBudgetFactor multiplies the budgets of servers for the focused
+// document (see lux/didChangeFocus).
+const focusedBudgetFactor = 2
+
+// inflightLimit is an LSP's max_in_flight and max_queued.
+type inflightLimit struct {
+	max    int
+	queued int
+}
+
+// backendQueue holds one backend's max_in_flight slots and counts the
+// requests waiting for them.
+type backendQueue struct {
+	slots   chan struct{}
+	waiting int
+}
+
+// requestScheduler is the one place that decides when lux's work runs. Work
+// is admitted in a fixed order, each stage waiting only once the stages
+// before it have been passed:
+//
+//  1. a message from a connection takes one of that connection's dispatch
+//     workers (see dispatcher);
+//  2. a request it sends a backend then takes a slot in its lane's budget on
+//     that backend, so a burst of background requests queues behind its own
+//     budget instead of occupying the server while a keystroke's completion
+//     waits;
+//  3. and last one of the backend's max_in_flight slots, shared by both
+//     lanes, so a slow server under load is sent requests as it finishes
+//     others rather than all at once. Requests beyond its max_queued are
+//     cancelled instead of waiting.
+//
+// A request waiting at any stage holds nothing of the stages after it.
+type requestScheduler struct {
+	dispatch int
+	lanes    map[lane]int             // 0 means unlimited
+	inflight map[string]inflightLimit // by LSP name
+	slots    map[laneKey]chan struct{}
+	queues   map[string]*backendQueue // by pool name
+	focused  map[string]bool
+	mu       sync.Mutex
+}
+
+func newRequestScheduler(cfg *config.Config) *requestScheduler {
+	r := &requestScheduler{dispatch: dispatchConcurrency}
+	r.setLimits(cfg)
+	return r
+}
+
+// setLimits takes the lane budgets and max_in_flight limits from cfg.
+// Requests already holding a slot release it against the old limit.
+func (r *requestScheduler) setLimits(cfg *config.Config) {
+	interactive, background := cfg.LaneLimits()
+	inflight := make(map[string]inflightLimit)
+	for i := range cfg.LSPs {
+		if max, queued := cfg.LSPs[i].InFlightLimit(); max > 0 {
+			inflight[cfg.LSPs[i].Name] = inflightLimit{max: max, queued: queued}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lanes = map[lane]int{laneInteractive: interactive, laneBackground: background}
+	r.inflight = inflight
+	r.slots = make(map[laneKey]chan struct{})
+	r.queues = make(map[string]*backendQueue)
+}
+
+// setFocused gives servers larger lane budgets than the rest. Requests
+// already holding a slot release it against the budget they took it from.
+func (r *requestScheduler) setFocused(servers []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.focused = make(map[string]bool, len(servers))
+	for _, server := range servers {
+		r.focused[server] = true
+	}
+}
+
+func (r *requestScheduler) isFocused(server string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.focused[server]
+}
+
+// newDispatcher returns the dispatcher for one connection's messages, the
+// first stage of the schedule.
+func (r *requestScheduler) newDispatcher() *dispatcher {
+	return newDispatcher(r.dispatch)
+}
+
+// acquire waits for a slot in method's lane on server and then for one of
+// server's max_in_flight slots, and returns the function that releases both.
+func (r *requestScheduler) acquire(ctx context.Context, server, method string) (func(), error) {
+	releaseLane, err := r.acquireLane(ctx, server, method)
+	if err != nil {
+		return nil, err
+	}
+	releaseSlot, err := r.acquireInFlight(ctx, server)
+	if err != nil {
+		releaseLane()
+		return nil, err
+	}
+	return func() {
+		releaseSlot()
+		releaseLane()
+	}, nil
+}
+
+func (r *requestScheduler) acquireLane(ctx context.Context, server, method string) (func(), error) {
+	key := laneKey{server: server, lane: laneFor(method)}
+
+	r.mu.Lock()
+	limit := r.lanes[key.lane]
+	if limit <= 0 {
+		r.mu.Unlock()
+		return func() {}, nil
+	}
+	if r.focused[server] {
+		key.focused = true
+		limit *= focusedBudgetFactor
+	}
+	slots, ok := r.slots[key]
+	if !ok {
+		slots = make(chan struct{}, limit)
+		r.slots[key] = slots
+	}
+	r.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// acquireInFlight waits for one of server's max_in_flight slots. When
+// server's queue is already full it fails at once with a RequestCancelled
+// error.
+func (r *requestScheduler) acquireInFlight(ctx context.Context, server string) (func(), error) {
+	lspName, _ := splitInstanceName(server)
+
+	r.mu.Lock()
+	limit, ok := r.inflight[lspName]
+	if !ok {
+		r.mu.Unlock()
+		return func() {}, nil
+	}
+	bq, ok := r.queues[server]
+	if !ok {
+		bq = &backendQueue{slots: make(chan struct{}, limit.max)}
+		r.queues[server] = bq
+	}
+	release := func() { <-bq.slots }
+
+	select {
+	case bq.slots <- struct{}{}:
+		r.mu.Unlock()
+		return release, nil
+	default:
+	}
+	if bq.waiting >= limit.queued {
+		r.mu.Unlock()
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.RequestCancelled,
+			Message: fmt.Sprintf("%s is busy: %d requests in flight and %d queued", server, limit.max, limit.queued),
+		}
+	}
+	bq.waiting++
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		bq.waiting--
+		r.mu.Unlock()
+	}()
+	select {
+	case bq.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// call forwards a request to a backend within its lane's budget and its
+// max_in_flight, recording it as in flight while it runs. The configured
+// transforms rewrite the params on the way out and the result on the way
+// back; a request they drop isn't sent and answers null.
+func (s *Server) call(ctx context.Context, lspName string, inst *subprocess.LSPInstance, method string, params any) (json.RawMessage, error) {
+	if timeout := s.requestTimeout(lspName, method); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout,
+			fmt.Errorf("%s to %s timed out after %s: %w", method, lspName, timeout, context.DeadlineExceeded))
+		defer cancel()
+	}
+
+	if rules := s.transforms(lspName, method, config.TransformRequest); len(rules) > 0 {
+		if raw, err := json.Marshal(params); err == nil {
+			transformed, dropped := applyTransforms(rules, raw)
+			if dropped {
+				return json.RawMessage("null"), nil
+			}
+			params = transformed
+		}
+	}
+
+	release, err := s.requests.acquire(ctx, lspName, method)
+	if err != nil {
+		return nil, timeoutCause(ctx, err)
+	}
+	defer release()
+
+	done := s.inflight.begin(lspName, method)
+	defer done()
+	result, err := inst.Call(ctx, method, params)
+	if err != nil {
+		err = timeoutCause(ctx, err)
+	} else if rules := s.transforms(lspName, method, config.TransformResponse); len(rules) > 0 {
+		if transformed, dropped := applyTransforms(rules, result); dropped {
+			result = json.RawMessage("null")
+		} else {
+			result = transformed
+		}
+	}
+	if len(s.middleware) > 0 {
+		result, err = s.interceptBackend(ctx, lspName, method, result, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// requestTimeout returns the configured timeout for a request to a backend,
+// or 0 for none.
+func (s *Server) requestTimeout(name, method string) time.Duration {
+	lspName, _ := splitInstanceName(name)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cfg == nil {
+		return 0
+	}
+	return s.cfg.RequestTimeout(lspName, method)
+}
+
+// timeoutCause replaces err with the reason the request's context ran out of
+// time, if it did. Cancelling the context already sent the backend
+// $/cancelRequest.
+func timeoutCause(ctx context.Context, err error) error {
+	if ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	return context.Cause(ctx)
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestLaneFor(t *testing.T) {
+	tests := []struct {
+		method   string
+		expected lane
+	}{
+		{lsp.MethodTextDocumentHover, laneInteractive},
+		{lsp.MethodTextDocumentCompletion, laneInteractive},
+		{lsp.MethodTextDocumentDefinition, laneInteractive},
+		{lsp.MethodTextDocumentSemanticTokensRange, laneInteractive},
+		{"custom/method", laneInteractive},
+		{lsp.MethodTextDocumentDiagnostic, laneBackground},
+		{lsp.MethodTextDocumentSemanticTokensFull, laneBackground},
+		{lsp.MethodWorkspaceSymbol, laneBackground},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			if got := laneFor(tt.method); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// laneConfig is a config with an unlimited interactive lane and a
+// background lane of one.
+func laneConfig(lsps ...config.LSP) *config.Config {
+	return &config.Config{InteractiveConcurrency: -1, BackgroundConcurrency: 1, LSPs: lsps}
+}
+
+func TestRequestScheduler_Lanes(t *testing.T) {
+	l := newRequestScheduler(laneConfig())
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, "gopls", lsp.MethodTextDocumentDiagnostic)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The background lane is full; interactive requests and other servers
+	// are unaffected.
+	if _, err := l.acquire(ctx, "gopls", lsp.MethodTextDocumentHover); err != nil {
+		t.Errorf("expected interactive request to proceed, got %v", err)
+	}
+	if _, err := l.acquire(ctx, "pyright", lsp.MethodTextDocumentDiagnostic); err != nil {
+		t.Errorf("expected another server's background request to proceed, got %v", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(waitCtx, "gopls", lsp.MethodWorkspaceSymbol); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected background request to wait for a slot, got %v", err)
+	}
+
+	release()
+	if _, err := l.acquire(ctx, "gopls", lsp.MethodWorkspaceSymbol); err != nil {
+		t.Errorf("expected released slot to be reused, got %v", err)
+	}
+}
+
+func TestRequestScheduler_Focused(t *testing.T) {
+	l := newRequestScheduler(laneConfig())
+	l.setFocused([]string{"gopls"})
+	ctx := context.Background()
+
+	for i := 0; i < focusedBudgetFactor; i++ {
+		if _, err := l.acquire(ctx, "gopls", lsp.MethodTextDocumentDiagnostic); err != nil {
+			t.Fatalf("expected focused server's request %d to proceed, got %v", i, err)
+		}
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(waitCtx, "gopls", lsp.MethodTextDocumentDiagnostic); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the focused budget to be bounded too, got %v", err)
+	}
+
+	// Once focus moves on, the server is back to its own budget.
+	l.setFocused([]string{"pyright"})
+	release, err := l.acquire(ctx, "gopls", lsp.MethodTextDocumentDiagnostic)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+	if !l.isFocused("pyright") || l.isFocused("gopls") {
+		t.Error("expected focus to move to pyright")
+	}
+}
+
+func TestCall_Timeout(t *testing.T) {
+	toBackendR, toBackendW := io.Pipe()
+	toLuxR, toLuxW := io.Pipe()
+	backend := jsonrpc.NewConn(toBackendR, toLuxW, func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		<-ctx.Done() // a stuck server
+		return nil, ctx.Err()
+	})
+	conn := subprocess.NewConn(toLuxR, toBackendW, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go backend.Run(ctx)
+	go conn.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		toBackendW.Close()
+		toLuxW.Close()
+	})
+
+	cfg := &config.Config{
+		InteractiveConcurrency: -1,
+		BackgroundConcurrency:  -1,
+		LSPs: []config.LSP{{
+			Name:            "gopls",
+			RequestTimeouts: map[string]string{lsp.MethodTextDocumentCompletion: "20ms"},
+		}},
+	}
+	s := &Server{
+		cfg:      cfg,
+		requests: newRequestScheduler(cfg),
+		inflight: newInflightTracker(),
+	}
+	inst := &subprocess.LSPInstance{Name: "gopls", State: subprocess.LSPStateRunning, Conn: conn}
+
+	_, err := s.call(context.Background(), "gopls", inst, lsp.MethodTextDocumentCompletion, map[string]any{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	resp, _ := callErrorResponse(jsonrpc.NewNumberID(1), err)
+	if resp.Error == nil || resp.Error.Code != jsonrpc.RequestCancelled {
+		t.Fatalf("expected RequestCancelled, got %+v", resp.Error)
+	}
+	if !strings.Contains(resp.Error.Message, "timed out after 20ms") {
+		t.Errorf("expected the timeout in the message, got %q", resp.Error.Message)
+	}
+}
+
+func TestCall_LaneBeforeBackendSlot(t *testing.T) {
+	toBackendR, toBackendW := io.Pipe()
+	toLuxR, toLuxW := io.Pipe()
+	release := make(chan struct{})
+	backend := jsonrpc.NewConn(toBackendR, toLuxW, func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		if msg.Method == lsp.MethodTextDocumentDiagnostic {
+			<-release
+		}
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	})
+	conn := subprocess.NewConn(toLuxR, toBackendW, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go backend.Run(ctx)
+	go conn.Run(ctx)
+	t.Cleanup(func() {
+		close(release)
+		cancel()
+		toBackendW.Close()
+		toLuxW.Close()
+	})
+
+	cfg := laneConfig(config.LSP{Name: "gopls", MaxInFlight: 2})
+	s := &Server{
+		cfg:      cfg,
+		requests: newRequestScheduler(cfg),
+		inflight: newInflightTracker(),
+	}
+	inst := &subprocess.LSPInstance{Name: "gopls", State: subprocess.LSPStateRunning, Conn: conn}
+
+	// Two background requests: one runs, the other waits for its lane.
+	for i := 0; i < 2; i++ {
+		go s.call(ctx, "gopls", inst, lsp.MethodTextDocumentDiagnostic, map[string]any{})
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	hoverCtx, hoverCancel := context.WithTimeout(ctx, time.Second)
+	defer hoverCancel()
+	if _, err := s.call(hoverCtx, "gopls", inst, lsp.MethodTextDocumentHover, map[string]any{}); err != nil {
+		t.Fatalf("expected the interactive request to get the free backend slot, got %v", err)
+	}
+}
+
+func TestRequestScheduler_InFlight(t *testing.T) {
+	q := newRequestScheduler(&config.Config{LSPs: []config.LSP{
+		{Name: "rust-analyzer", MaxInFlight: 1, MaxQueued: 1},
+		{Name: "gopls"},
+	}})
+	ctx := context.Background()
+
+	release, err := q.acquireInFlight(ctx, "rust-analyzer")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	queued := make(chan error, 1)
+	go func() {
+		release, err := q.acquireInFlight(ctx, "rust-analyzer")
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// The one queue place is taken: the next request is turned away.
+	_, err = q.acquireInFlight(ctx, "rust-analyzer")
+	var rpcErr *jsonrpc.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc.RequestCancelled {
+		t.Errorf("expected RequestCancelled on overflow, got %v", err)
+	}
+
+	// Servers without max_in_flight, and other instances, are unaffected.
+	if _, err := q.acquireInFlight(ctx, "gopls"); err != nil {
+		t.Errorf("expected an unlimited server's request to proceed, got %v", err)
+	}
+	if _, err := q.acquireInFlight(ctx, "rust-analyzer@/src/other"); err != nil {
+		t.Errorf("expected another instance's request to proceed, got %v", err)
+	}
+
+	release()
+	select {
+	case err := <-queued:
+		if err != nil {
+			t.Errorf("expected the queued request to get the slot, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued request never got the released slot")
+	}
+}
+
+func TestRequestScheduler_InFlightCancelled(t *testing.T) {
+	q := newRequestScheduler(&config.Config{LSPs: []config.LSP{
+		{Name: "rust-analyzer", MaxInFlight: 1},
+	}})
+
+	if _, err := q.acquireInFlight(context.Background(), "rust-analyzer"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.acquireInFlight(ctx, "rust-analyzer"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request to wait until its deadline, got %v", err)
+	}
+	if waiting := q.queues["rust-analyzer"].waiting; waiting != 0 {
+		t.Errorf("expected the gave-up request to leave the queue, got %d waiting", waiting)
+	}
+}
+
+func TestRequestScheduler_OverflowReleasesLane(t *testing.T) {
+	r := newRequestScheduler(laneConfig(config.LSP{Name: "gopls", MaxInFlight: 1, MaxQueued: -1}))
+	ctx := context.Background()
+
+	release, err := r.acquire(ctx, "gopls", lsp.MethodTextDocumentHover)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	// The backend is full and queues nothing, so the background request is
+	// turned away, giving back the lane slot it took first.
+	if _, err := r.acquire(ctx, "gopls", lsp.MethodTextDocumentDiagnostic); err == nil {
+		t.Fatal("expected the request to be turned away")
+	}
+	releaseLane, err := r.acquireLane(ctx, "gopls", lsp.MethodTextDocumentDiagnostic)
+	if err != nil {
+		t.Fatalf("expected the background lane to be free, got %v", err)
+	}
+	releaseLane()
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// prefixMessage returns the params of a window/showMessage,
+// window/showMessageRequest, or window/logMessage from lspName with the
+// message prefixed by the server's name, the way lux prefixes its own
+// messages with "lux: ", so the user can tell which server is talking.
+// Messages the server already prefixed itself are left alone, as are
+// params that can't be parsed. Other fields, such as a request's actions,
+// are kept as they are.
+func prefixMessage(lspName string, params json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(params, &fields); err != nil || fields == nil {
+		return params
+	}
+	var message string
+	if err := json.Unmarshal(fields["message"], &message); err != nil {
+		return params
+	}
+
+	prefix := lspName + ": "
+	if strings.HasPrefix(message, prefix) {
+		return params
+	}
+	fields["message"], _ = json.Marshal(prefix + message)
+
+	prefixed, err := json.Marshal(fields)
+	if err != nil {
+		return params
+	}
+	return prefixed
+}
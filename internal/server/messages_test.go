@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPrefixMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   string
+		expected string
+	}{
+		{
+			name:     "log message",
+			params:   `{"type":4,"message":"loaded 12 packages"}`,
+			expected: `{"message":"gopls: loaded 12 packages","type":4}`,
+		},
+		{
+			name:     "request keeps its actions",
+			params:   `{"type":2,"message":"go.mod is out of date","actions":[{"title":"Run go mod tidy"}]}`,
+			expected: `{"actions":[{"title":"Run go mod tidy"}],"message":"gopls: go.mod is out of date","type":2}`,
+		},
+		{
+			name:     "already prefixed",
+			params:   `{"type":1,"message":"gopls: crashed"}`,
+			expected: `{"type":1,"message":"gopls: crashed"}`,
+		},
+		{
+			name:     "no message",
+			params:   `{"type":1}`,
+			expected: `{"type":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixMessage("gopls", json.RawMessage(tt.params)); string(got) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
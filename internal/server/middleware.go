@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/pkg/middleware"
+)
+
+// AddMiddleware registers m to intercept traffic, after any middleware
+// already added. It must be called before Run. Middleware registered with
+// package middleware is added when the server is created.
+func (s *Server) AddMiddleware(m middleware.Middleware) {
+	s.middleware = append(s.middleware, m)
+}
+
+// interceptClient runs msg through every middleware's OnClientRequest. It
+// returns the message to handle, or, if a middleware answered or dropped
+// it, the response to send and handled true.
+func (s *Server) interceptClient(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, *jsonrpc.Message, bool, error) {
+	for _, m := range s.middleware {
+		next, resp, err := m.OnClientRequest(ctx, msg)
+		if err != nil {
+			return nil, nil, true, err
+		}
+		if resp != nil {
+			if !msg.IsRequest() {
+				resp = nil
+			}
+			return nil, resp, true, nil
+		}
+		if next == nil {
+			if !msg.IsRequest() {
+				return nil, nil, true, nil
+			}
+			resp, err := jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.RequestCancelled, "dropped by middleware", nil)
+			return nil, resp, true, err
+		}
+		msg = next
+	}
+	return msg, nil, false, nil
+}
+
+// interceptBackend runs a backend's answer through every middleware's
+// OnBackendResponse.
+func (s *Server) interceptBackend(ctx context.Context, server, method string, result json.RawMessage, err error) (json.RawMessage, error) {
+	for _, m := range s.middleware {
+		result, err = m.OnBackendResponse(ctx, server, method, result, err)
+	}
+	return result, err
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess/subprocesstest"
+	"github.com/amarbel-llc/lux/pkg/config"
+	"github.com/amarbel-llc/lux/pkg/middleware"
+)
+
+// hoverAnswerer answers hover requests itself and drops didSave.
+type hoverAnswerer struct {
+	middleware.PassThrough
+}
+
+func (hoverAnswerer) OnClientRequest(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, *jsonrpc.Message, error) {
+	switch msg.Method {
+	case lsp.MethodTextDocumentHover:
+		resp, err := jsonrpc.NewResponse(*msg.ID, map[string]string{"contents": "from middleware"})
+		return nil, resp, err
+	case lsp.MethodTextDocumentDidSave, lsp.MethodTextDocumentDefinition:
+		return nil, nil, nil
+	}
+	return msg, nil, nil
+}
+
+// backendRewriter replaces every backend error with an empty result.
+type backendRewriter struct {
+	middleware.PassThrough
+	seen []string
+}
+
+func (b *backendRewriter) OnBackendResponse(ctx context.Context, server, method string, result json.RawMessage, err error) (json.RawMessage, error) {
+	b.seen = append(b.seen, server+" "+method)
+	if err != nil {
+		return json.RawMessage(`[]`), nil
+	}
+	return result, nil
+}
+
+func TestHandler_Middleware(t *testing.T) {
+	s := &Server{}
+	s.AddMiddleware(middleware.PassThrough{})
+	s.AddMiddleware(hoverAnswerer{})
+	h := NewHandler(s)
+
+	hover, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), lsp.MethodTextDocumentHover, json.RawMessage(`{}`))
+	resp, err := h.Handle(context.Background(), hover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Result) != `{"contents":"from middleware"}` {
+		t.Errorf("expected the middleware's answer, got %s", resp.Result)
+	}
+
+	definition, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(2), lsp.MethodTextDocumentDefinition, json.RawMessage(`{}`))
+	resp, err = h.Handle(context.Background(), definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == nil || resp.Error.Code != jsonrpc.RequestCancelled {
+		t.Errorf("expected a dropped request to be cancelled, got %+v", resp)
+	}
+
+	save, _ := jsonrpc.NewNotification(lsp.MethodTextDocumentDidSave, json.RawMessage(`{}`))
+	if resp, err := h.Handle(context.Background(), save); resp != nil || err != nil {
+		t.Errorf("expected a dropped notification to go unanswered, got %+v, %v", resp, err)
+	}
+}
+
+func TestServer_InterceptBackend(t *testing.T) {
+	rewriter := &backendRewriter{}
+	s := &Server{}
+	s.AddMiddleware(rewriter)
+
+	result, err := s.interceptBackend(context.Background(), "gopls", lsp.MethodTextDocumentReferences, nil, errors.New("crashed"))
+	if err != nil || string(result) != `[]` {
+		t.Errorf("expected %s, got %s, %v", `[]`, result, err)
+	}
+	if len(rewriter.seen) != 1 || rewriter.seen[0] != "gopls textDocument/references" {
+		t.Errorf("expected the answer to be observed, got %v", rewriter.seen)
+	}
+}
+
+// registeredMiddleware is registered with package middleware, as an
+// embedder's would be, so every server the tests create installs it. It
+// changes nothing.
+var registeredMiddleware = &struct{ middleware.PassThrough }{}
+
+func init() {
+	middleware.Register("test-registered", registeredMiddleware)
+}
+
+func TestNewServer_InstallsRegisteredMiddleware(t *testing.T) {
+	executor, err := subprocesstest.NewExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newServer(&config.Config{}, executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.middleware) == 0 || s.middleware[0] != registeredMiddleware {
+		t.Errorf("expected the registered middleware installed first, got %v", s.middleware)
+	}
+}
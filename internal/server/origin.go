@@ -0,0 +1,35 @@
+package server
+
+import "encoding/json"
+
+// originTag wraps the data of an item lux hands the client — a completion
+// item, code action, code lens, inlay hint, call or type hierarchy item, or
+// workspace symbol — with the LSP that produced it. The request that later
+// resolves or expands the item names no document to route by, so it is
+// routed back to the same server by the tag.
+type originTag struct {
+	Server string          `json:"luxServer"`
+	Data   json.RawMessage `json:"luxData,omitempty"`
+}
+
+// tagOrigin replaces obj's data with an originTag naming server.
+func tagOrigin(obj map[string]json.RawMessage, server string) {
+	tag, _ := json.Marshal(originTag{Server: server, Data: obj["data"]})
+	obj["data"] = tag
+}
+
+// untagOrigin restores obj's original data and reports the server that
+// produced it, or false if obj wasn't tagged by lux.
+func untagOrigin(obj map[string]json.RawMessage) (string, bool) {
+	var tag originTag
+	if err := json.Unmarshal(obj["data"], &tag); err != nil || tag.Server == "" {
+		return "", false
+	}
+
+	if len(tag.Data) == 0 {
+		delete(obj, "data")
+	} else {
+		obj["data"] = tag.Data
+	}
+	return tag.Server, true
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/pkg/config"
+	"github.com/amarbel-llc/lux/pkg/middleware"
+	"github.com/amarbel-llc/lux/pkg/plugin"
+)
+
+// pluginFilter is a loaded plugin and the methods it filters.
+type pluginFilter struct {
+	name    string
+	methods map[string]bool
+	filter  plugin.Filter
+}
+
+// pluginSet is the middleware that passes traffic for the configured methods
+// through the plugins, in config order.
+type pluginSet struct {
+	middleware.PassThrough
+	filters []pluginFilter
+}
+
+// loadPlugins loads the plugins in cfgs. A plugin that can't be loaded is
+// skipped with a warning, so a broken filter doesn't take routing down with
+// it. It returns nil if none loaded.
+func loadPlugins(ctx context.Context, cfgs []config.Plugin) *pluginSet {
+	var set pluginSet
+	for _, c := range cfgs {
+		load, ok := plugin.Lookup(c.RuntimeName())
+		if !ok {
+			fmt.Fprintf(os.Stderr, "warning: plugin %s: runtime %q is not available in this build\n", c.Name, c.RuntimeName())
+			continue
+		}
+		filter, err := load(ctx, c.ModulePath())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: plugin %s: loading %s: %v\n", c.Name, c.ModulePath(), err)
+			continue
+		}
+
+		methods := make(map[string]bool, len(c.Methods))
+		for _, m := range c.Methods {
+			methods[m] = true
+		}
+		set.filters = append(set.filters, pluginFilter{name: c.Name, methods: methods, filter: filter})
+	}
+
+	if len(set.filters) == 0 {
+		return nil
+	}
+	return &set
+}
+
+// apply passes payload, a message of method at point, through every plugin
+// filtering method. A plugin that fails leaves the payload as it was.
+func (p *pluginSet) apply(ctx context.Context, point plugin.Point, method string, payload json.RawMessage) json.RawMessage {
+	if p == nil {
+		return payload
+	}
+	for _, f := range p.filters {
+		if !f.methods[method] {
+			continue
+		}
+		filtered, err := f.filter.Filter(ctx, point, method, payload)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] plugin %s: %s: %v\n", f.name, method, err)
+			continue
+		}
+		payload = filtered
+	}
+	return payload
+}
+
+func (p *pluginSet) OnClientRequest(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, *jsonrpc.Message, error) {
+	filtered := *msg
+	filtered.Params = p.apply(ctx, plugin.Request, msg.Method, msg.Params)
+	return &filtered, nil, nil
+}
+
+func (p *pluginSet) OnBackendResponse(ctx context.Context, server, method string, result json.RawMessage, err error) (json.RawMessage, error) {
+	if err != nil {
+		return result, err
+	}
+	return p.apply(ctx, plugin.Response, method, result), nil
+}
+
+// filterNotification passes the params of a notification from a backend
+// through the plugins.
+func (p *pluginSet) filterNotification(ctx context.Context, method string, params json.RawMessage) json.RawMessage {
+	return p.apply(ctx, plugin.Notification, method, params)
+}
+
+func (p *pluginSet) close() {
+	if p == nil {
+		return
+	}
+	for _, f := range p.filters {
+		f.filter.Close()
+	}
+}
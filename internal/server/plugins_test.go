@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+	"github.com/amarbel-llc/lux/pkg/plugin"
+)
+
+// replaceFilter swaps every occurrence of old for new in the payloads it is
+// given, and fails on payloads containing "fail".
+type replaceFilter struct {
+	old, new string
+	points   []plugin.Point
+	closed   bool
+}
+
+func (f *replaceFilter) Filter(ctx context.Context, point plugin.Point, method string, payload json.RawMessage) (json.RawMessage, error) {
+	f.points = append(f.points, point)
+	if strings.Contains(string(payload), "fail") {
+		return nil, errors.New("refused")
+	}
+	return json.RawMessage(strings.ReplaceAll(string(payload), f.old, f.new)), nil
+}
+
+func (f *replaceFilter) Close() error {
+	f.closed = true
+	return nil
+}
+
+var testFilter = &replaceFilter{old: "noisy", new: "quiet"}
+
+func init() {
+	plugin.Register("test", func(ctx context.Context, path string) (plugin.Filter, error) {
+		if strings.HasSuffix(path, "missing.wasm") {
+			return nil, errors.New("no such module")
+		}
+		return testFilter, nil
+	})
+}
+
+func TestPluginSet_FiltersConfiguredMethods(t *testing.T) {
+	set := loadPlugins(context.Background(), []config.Plugin{
+		{Name: "quiet", Module: "/plugins/quiet.wasm", Runtime: "test", Methods: []string{
+			lsp.MethodTextDocumentHover, lsp.MethodTextDocumentPublishDiagnostics,
+		}},
+		{Name: "missing", Module: "/plugins/missing.wasm", Runtime: "test", Methods: []string{lsp.MethodTextDocumentHover}},
+		{Name: "unlinked", Module: "/plugins/quiet.wasm", Methods: []string{lsp.MethodTextDocumentHover}},
+	})
+	if set == nil || len(set.filters) != 1 {
+		t.Fatalf("expected only the loadable plugin, got %+v", set)
+	}
+	testFilter.points = nil
+
+	hover, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), lsp.MethodTextDocumentHover, json.RawMessage(`"noisy"`))
+	next, _, _ := set.OnClientRequest(context.Background(), hover)
+	if string(next.Params) != `"quiet"` {
+		t.Errorf("expected filtered params, got %s", next.Params)
+	}
+
+	result, _ := set.OnBackendResponse(context.Background(), "gopls", lsp.MethodTextDocumentHover, json.RawMessage(`"noisy"`), nil)
+	if string(result) != `"quiet"` {
+		t.Errorf("expected filtered result, got %s", result)
+	}
+
+	if result, _ := set.OnBackendResponse(context.Background(), "gopls", lsp.MethodTextDocumentHover, json.RawMessage(`"fail"`), nil); string(result) != `"fail"` {
+		t.Errorf("expected a failing filter to leave the result alone, got %s", result)
+	}
+
+	if params := set.filterNotification(context.Background(), lsp.MethodTextDocumentPublishDiagnostics, json.RawMessage(`"noisy"`)); string(params) != `"quiet"` {
+		t.Errorf("expected filtered notification, got %s", params)
+	}
+
+	definition, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(2), lsp.MethodTextDocumentDefinition, json.RawMessage(`"noisy"`))
+	if next, _, _ := set.OnClientRequest(context.Background(), definition); string(next.Params) != `"noisy"` {
+		t.Errorf("expected unconfigured methods to pass through, got %s", next.Params)
+	}
+
+	expected := []plugin.Point{plugin.Request, plugin.Response, plugin.Response, plugin.Notification}
+	if len(testFilter.points) != len(expected) {
+		t.Fatalf("expected calls at %v, got %v", expected, testFilter.points)
+	}
+	for i, point := range expected {
+		if testFilter.points[i] != point {
+			t.Errorf("expected call %d at %s, got %s", i, point, testFilter.points[i])
+		}
+	}
+
+	set.close()
+	if !testFilter.closed {
+		t.Error("expected close to close the filters")
+	}
+}
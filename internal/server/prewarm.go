@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// SetPrewarmAll prewarms every configured LSP, as if each set prewarm (see
+// `lux serve --prewarm`). It must be called before Run.
+func (s *Server) SetPrewarmAll(all bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prewarmAll = all
+}
+
+// prewarmNames returns the LSPs to prewarm. Per-folder LSPs are left out:
+// which instances they need depends on the documents opened.
+func (s *Server) prewarmNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var names []string
+	for _, l := range s.cfg.LSPs {
+		if (l.Prewarm || s.prewarmAll) && !l.PerFolder {
+			names = append(names, l.Name)
+		}
+	}
+	return names
+}
+
+// prebuild builds the servers of the LSPs to prewarm while lux waits for
+// the client to initialize, which starting them needs.
+func (s *Server) prebuild(ctx context.Context) {
+	names := s.prewarmNames()
+	forEachConcurrently(len(names), func(i int) {
+		name := names[i]
+		if _, err := s.pool.Prebuild(ctx, name); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "[lux] prewarming %s: %v\n", name, err)
+		}
+	})
+}
+
+// prewarm starts the LSPs to prewarm once the client has initialized, in
+// the background start slots of the scheduler.
+func (h *Handler) prewarm() {
+	for _, name := range h.server.prewarmNames() {
+		go func(name string) {
+			// The instance outlives this call, so it isn't started under a
+			// request's context.
+			if _, err := h.startInstance(context.Background(), name, false); err != nil {
+				fmt.Fprintf(os.Stderr, "[lux] prewarming %s: %v\n", name, err)
+			}
+		}(name)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/internal/subprocess/subprocesstest"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestPrewarm(t *testing.T) {
+	home := t.TempDir()
+	for _, env := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME", "XDG_RUNTIME_DIR"} {
+		t.Setenv(env, home)
+	}
+
+	cfg := &config.Config{
+		StartupStagger: "0",
+		LSPs: []config.LSP{
+			{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}, Prewarm: true},
+			{Name: "rust-analyzer", Flake: "nixpkgs#rust-analyzer", Extensions: []string{"rs"}},
+		},
+	}
+	executor, err := subprocesstest.NewExecutor("gopls", "rust-analyzer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newServer(cfg, executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.pool.StopAll)
+	h := NewHandler(s)
+
+	if names := s.prewarmNames(); len(names) != 1 || names[0] != "gopls" {
+		t.Fatalf("expected only gopls to be prewarmed, got %v", names)
+	}
+
+	initialize, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), lsp.MethodInitialize, map[string]any{})
+	if _, err := h.Handle(context.Background(), initialize); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := s.pool.State("gopls"); state != subprocess.LSPStateIdle {
+		t.Fatalf("expected gopls to wait for initialized, got %s", state)
+	}
+
+	initialized, _ := jsonrpc.NewNotification(lsp.MethodInitialized, map[string]any{})
+	if _, err := h.Handle(context.Background(), initialized); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		state, _ := s.pool.State("gopls")
+		if state == subprocess.LSPStateRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected gopls to be started, state is %s", state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state, _ := s.pool.State("rust-analyzer"); state != subprocess.LSPStateIdle {
+		t.Errorf("expected rust-analyzer left idle, got %s", state)
+	}
+
+	s.SetPrewarmAll(true)
+	if names := s.prewarmNames(); len(names) != 2 {
+		t.Errorf("expected --prewarm to prewarm both, got %v", names)
+	}
+}
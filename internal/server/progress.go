@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// progressToken identifies a work-done progress token created by a backend.
+type progressToken struct {
+	server string
+	token  string // the backend's token, JSON-encoded
+}
+
+// progressRegistry rewrites progress tokens created by backends so that two
+// servers picking the same token (typically small integers) don't collide on
+// the client, and maps the client's tokens back for cancellation.
+type progressRegistry struct {
+	toClient   map[progressToken]string
+	fromClient map[string]progressToken
+	mu         sync.Mutex
+}
+
+func newProgressRegistry() *progressRegistry {
+	return &progressRegistry{
+		toClient:   make(map[progressToken]string),
+		fromClient: make(map[string]progressToken),
+	}
+}
+
+// create registers a backend token and returns the token to use with the
+// client.
+func (r *progressRegistry) create(server string, token json.RawMessage) string {
+	key := progressToken{server: server, token: string(token)}
+	clientToken := fmt.Sprintf("lux/%s/%s", server, token)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.toClient[key] = clientToken
+	r.fromClient[clientToken] = key
+	return clientToken
+}
+
+// drop registers a backend token whose progress should not reach the client.
+func (r *progressRegistry) drop(server string, token json.RawMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.toClient[progressToken{server: server, token: string(token)}] = ""
+}
+
+// clientToken returns the client token for a backend token ("" if dropped),
+// or false if the backend didn't create it through lux (e.g. a workDoneToken
+// the client sent with a request, which is already the client's).
+func (r *progressRegistry) clientToken(server string, token json.RawMessage) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clientToken, ok := r.toClient[progressToken{server: server, token: string(token)}]
+	return clientToken, ok
+}
+
+// backendToken returns the server and backend token behind a client token.
+func (r *progressRegistry) backendToken(clientToken string) (progressToken, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.fromClient[clientToken]
+	return key, ok
+}
+
+func (r *progressRegistry) end(server string, token json.RawMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := progressToken{server: server, token: string(token)}
+	if clientToken := r.toClient[key]; clientToken != "" {
+		delete(r.fromClient, clientToken)
+	}
+	delete(r.toClient, key)
+}
+
+// forget drops every token of a server and returns their client tokens.
+func (r *progressRegistry) forget(server string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var forgotten []string
+	for key, clientToken := range r.toClient {
+		if key.server == server {
+			delete(r.toClient, key)
+			if clientToken != "" {
+				delete(r.fromClient, clientToken)
+				forgotten = append(forgotten, clientToken)
+			}
+		}
+	}
+	return forgotten
+}
+
+// endProgress ends any progress a server left open on the client, e.g.
+// because it crashed or was stopped mid-task.
+func (s *Server) endProgress(lspName string) {
+	for _, clientToken := range s.progress.forget(lspName) {
+		if s.clientConn != nil {
+			s.clientConn.Notify(lsp.MethodProgress, map[string]any{
+				"token": clientToken,
+				"value": map[string]string{"kind": "end"},
+			})
+		}
+	}
+}
+
+type progressParams struct {
+	Token json.RawMessage `json:"token"`
+	Value json.RawMessage `json:"value"`
+}
+
+// handleProgressCreate answers a backend's window/workDoneProgress/create by
+// creating a rewritten token on the client. If the client doesn't support
+// work-done progress, the backend still gets a success response and its
+// progress for the token is dropped.
+func (s *Server) handleProgressCreate(ctx context.Context, lspName string, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	var params progressParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil || len(params.Token) == 0 {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams, "invalid params", nil)
+	}
+
+	if s.clientConn == nil || !s.clientSupportsProgress() {
+		s.progress.drop(lspName, params.Token)
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	}
+
+	clientToken := s.progress.create(lspName, params.Token)
+	if _, err := s.clientConn.Call(ctx, msg.Method, map[string]any{"token": clientToken}); err != nil {
+		s.progress.end(lspName, params.Token)
+		return callErrorResponse(*msg.ID, err)
+	}
+	return jsonrpc.NewResponse(*msg.ID, nil)
+}
+
+// forwardProgress sends a backend's $/progress to the client under the
+// client's token.
+func (s *Server) forwardProgress(lspName string, raw json.RawMessage) {
+	var params progressParams
+	if err := json.Unmarshal(raw, &params); err != nil || s.clientConn == nil {
+		return
+	}
+
+	clientToken, ok := s.progress.clientToken(lspName, params.Token)
+	if !ok {
+		// Not created through lux: the token came from the client.
+		s.clientConn.Notify(lsp.MethodProgress, raw)
+		return
+	}
+
+	var value struct {
+		Kind string `json:"kind"`
+	}
+	json.Unmarshal(params.Value, &value)
+	if value.Kind == "end" {
+		s.progress.end(lspName, params.Token)
+	}
+	if clientToken == "" {
+		return
+	}
+
+	s.clientConn.Notify(lsp.MethodProgress, map[string]any{
+		"token": clientToken,
+		"value": params.Value,
+	})
+}
+
+// cancelProgress routes the client's window/workDoneProgress/cancel to the
+// backend that created the token.
+func (s *Server) cancelProgress(raw json.RawMessage) error {
+	var params struct {
+		Token json.RawMessage `json:"token"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil
+	}
+
+	var clientToken string
+	if err := json.Unmarshal(params.Token, &clientToken); err != nil {
+		return nil
+	}
+
+	key, ok := s.progress.backendToken(clientToken)
+	if !ok {
+		return nil
+	}
+
+	inst, ok := s.pool.Get(key.server)
+	if !ok {
+		return nil
+	}
+	return inst.Notify(lsp.MethodWindowWorkDoneProgressCancel, map[string]json.RawMessage{
+		"token": json.RawMessage(key.token),
+	})
+}
+
+func (s *Server) clientSupportsProgress() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.initParams != nil && s.initParams.Capabilities.Window != nil && s.initParams.Capabilities.Window.WorkDoneProgress
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestProgressRegistry(t *testing.T) {
+	r := newProgressRegistry()
+
+	gopls := r.create("gopls", json.RawMessage(`1`))
+	pyright := r.create("pyright", json.RawMessage(`1`))
+	if gopls == pyright {
+		t.Fatalf("expected distinct client tokens, got %q twice", gopls)
+	}
+
+	got, ok := r.clientToken("gopls", json.RawMessage(`1`))
+	if !ok || got != gopls {
+		t.Errorf("expected %q, got %q", gopls, got)
+	}
+
+	if _, ok := r.clientToken("gopls", json.RawMessage(`"client-token"`)); ok {
+		t.Error("expected client-originated token to be unknown")
+	}
+
+	key, ok := r.backendToken(pyright)
+	if !ok || key.server != "pyright" || key.token != "1" {
+		t.Errorf("expected pyright/1, got %+v", key)
+	}
+
+	r.end("gopls", json.RawMessage(`1`))
+	if _, ok := r.clientToken("gopls", json.RawMessage(`1`)); ok {
+		t.Error("expected ended token to be forgotten")
+	}
+	if _, ok := r.backendToken(gopls); ok {
+		t.Error("expected ended client token to be forgotten")
+	}
+
+	r.drop("pyright", json.RawMessage(`2`))
+	if got, ok := r.clientToken("pyright", json.RawMessage(`2`)); !ok || got != "" {
+		t.Errorf("expected dropped token, got %q, %v", got, ok)
+	}
+
+	forgotten := r.forget("pyright")
+	if len(forgotten) != 1 || forgotten[0] != pyright {
+		t.Errorf("expected [%q], got %v", pyright, forgotten)
+	}
+}
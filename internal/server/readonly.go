@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// editsDocument reports whether answers to method are edits to the
+// document it names, which can't be applied to read-only documents. Code
+// actions aren't: those with edits have theirs filtered like any workspace
+// edit (see dropReadOnlyEdits), and those that run commands are kept.
+func editsDocument(method string) bool {
+	switch method {
+	case lsp.MethodTextDocumentRename,
+		lsp.MethodTextDocumentPrepareRename,
+		lsp.MethodTextDocumentFormatting,
+		lsp.MethodTextDocumentRangeFormatting,
+		lsp.MethodTextDocumentOnTypeFormatting,
+		lsp.MethodTextDocumentWillSaveWaitUntil:
+		return true
+	}
+	return false
+}
+
+// isReadOnly reports whether uri is in the Nix store or under one of
+// read_only_roots.
+func (s *Server) isReadOnly(uri lsp.DocumentURI) bool {
+	if uri == "" {
+		return false
+	}
+	s.mu.RLock()
+	cfg, projectRoot := s.cfg, s.projectRoot
+	s.mu.RUnlock()
+	return cfg.IsReadOnly(uri.Path(), projectRoot)
+}
+
+// readOnlyResponse answers an editing request on a read-only document
+// without asking a server, as if no server had anything to offer: edits
+// there would only fail when the client applies them.
+func readOnlyResponse(msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	switch msg.Method {
+	case lsp.MethodTextDocumentRename:
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidRequest,
+			fmt.Sprintf("%s is read-only", documentURI(msg.Params).Path()), nil)
+	case lsp.MethodTextDocumentPrepareRename:
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	default:
+		return jsonrpc.NewResponse(*msg.ID, []any{})
+	}
+}
+
+// dropReadOnlyEdits removes the changes to read-only documents from the
+// workspace edits in result, the answer to method: a rename in a writable
+// document can still change a read-only one that uses the symbol. Code
+// actions left with neither edits nor a command are dropped.
+func (s *Server) dropReadOnlyEdits(method string, result json.RawMessage) json.RawMessage {
+	switch method {
+	case lsp.MethodTextDocumentRename,
+		lsp.MethodWorkspaceWillCreateFiles,
+		lsp.MethodWorkspaceWillRenameFiles,
+		lsp.MethodWorkspaceWillDeleteFiles:
+		filtered, _ := s.writableEdit(result)
+		return filtered
+	case lsp.MethodCodeActionResolve:
+		filtered, _ := s.writableCodeAction(result)
+		return filtered
+	case lsp.MethodTextDocumentCodeAction:
+		var actions []json.RawMessage
+		if err := json.Unmarshal(result, &actions); err != nil {
+			return result
+		}
+		kept := make([]json.RawMessage, 0, len(actions))
+		changed := false
+		for _, action := range actions {
+			filtered, useful := s.writableCodeAction(action)
+			if !useful {
+				changed = true
+				continue
+			}
+			changed = changed || !bytes.Equal(filtered, action)
+			kept = append(kept, filtered)
+		}
+		if !changed {
+			return result
+		}
+		filtered, _ := json.Marshal(kept)
+		return filtered
+	}
+	return result
+}
+
+// writableCodeAction returns action, a Command or CodeAction, without its
+// edits to read-only documents, and whether it still does anything.
+func (s *Server) writableCodeAction(action json.RawMessage) (json.RawMessage, bool) {
+	var a map[string]json.RawMessage
+	if err := json.Unmarshal(action, &a); err != nil || a["edit"] == nil {
+		return action, true
+	}
+
+	edit, kept := s.writableEdit(a["edit"])
+	if kept && bytes.Equal(edit, a["edit"]) {
+		return action, true
+	}
+	if kept {
+		a["edit"] = edit
+	} else {
+		delete(a, "edit")
+	}
+	filtered, _ := json.Marshal(a)
+	_, hasCommand := a["command"]
+	return filtered, kept || hasCommand
+}
+
+// writableApplyEdit returns the params of a backend's workspace/applyEdit
+// request without the changes to read-only documents it asks for, and
+// false if it asks for nothing else.
+func (s *Server) writableApplyEdit(params json.RawMessage) (json.RawMessage, bool) {
+	var p map[string]json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil || p["edit"] == nil {
+		return params, true
+	}
+
+	edit, kept := s.writableEdit(p["edit"])
+	if !kept {
+		return nil, false
+	}
+	if bytes.Equal(edit, p["edit"]) {
+		return params, true
+	}
+	p["edit"] = edit
+	filtered, _ := json.Marshal(p)
+	return filtered, true
+}
+
+// writableEdit returns edit, a WorkspaceEdit, without its changes to
+// read-only documents, and false if those were all it had.
+func (s *Server) writableEdit(edit json.RawMessage) (json.RawMessage, bool) {
+	var we map[string]json.RawMessage
+	if err := json.Unmarshal(edit, &we); err != nil || we == nil {
+		return edit, true
+	}
+
+	dropped, left := false, false
+	if raw, ok := we["changes"]; ok {
+		var changes map[lsp.DocumentURI]json.RawMessage
+		if err := json.Unmarshal(raw, &changes); err == nil {
+			for uri := range changes {
+				if s.isReadOnly(uri) {
+					delete(changes, uri)
+					dropped = true
+				}
+			}
+			left = left || len(changes) > 0
+			we["changes"], _ = json.Marshal(changes)
+		}
+	}
+	if raw, ok := we["documentChanges"]; ok {
+		var changes []json.RawMessage
+		if err := json.Unmarshal(raw, &changes); err == nil {
+			kept := make([]json.RawMessage, 0, len(changes))
+			for _, change := range changes {
+				if s.changesReadOnly(change) {
+					dropped = true
+					continue
+				}
+				kept = append(kept, change)
+			}
+			left = left || len(kept) > 0
+			we["documentChanges"], _ = json.Marshal(kept)
+		}
+	}
+
+	if !dropped {
+		return edit, true
+	}
+	filtered, _ := json.Marshal(we)
+	return filtered, left
+}
+
+// changesReadOnly reports whether change, a TextDocumentEdit or a file
+// create, rename, or delete, touches a read-only document.
+func (s *Server) changesReadOnly(change json.RawMessage) bool {
+	var c struct {
+		TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+		URI          lsp.DocumentURI            `json:"uri"`
+		OldURI       lsp.DocumentURI            `json:"oldUri"`
+		NewURI       lsp.DocumentURI            `json:"newUri"`
+	}
+	json.Unmarshal(change, &c)
+	for _, uri := range []lsp.DocumentURI{c.TextDocument.URI, c.URI, c.OldURI, c.NewURI} {
+		if s.isReadOnly(uri) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestHandler_ReadOnlyDocuments(t *testing.T) {
+	s := &Server{cfg: &config.Config{ReadOnlyRoots: []string{"gen"}}, projectRoot: "/src/app"}
+	h := NewHandler(s)
+
+	tests := []struct {
+		name     string
+		method   string
+		uri      string
+		expected string
+		isError  bool
+	}{
+		{"format in the nix store", lsp.MethodTextDocumentFormatting, "file:///nix/store/abc-go/src/fmt/print.go", `[]`, false},
+		{"range format in a configured root", lsp.MethodTextDocumentRangeFormatting, "file:///src/app/gen/api.pb.go", `[]`, false},
+		{"prepare rename", lsp.MethodTextDocumentPrepareRename, "file:///nix/store/abc-go/src/fmt/print.go", `null`, false},
+		{"rename", lsp.MethodTextDocumentRename, "file:///nix/store/abc-go/src/fmt/print.go", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), tt.method, map[string]any{
+				"textDocument": map[string]string{"uri": tt.uri},
+			})
+			resp, err := h.handleDefault(context.Background(), msg)
+			if err != nil {
+				t.Fatalf("handleDefault: %v", err)
+			}
+			if tt.isError {
+				if resp.Error == nil {
+					t.Errorf("expected an error, got %s", resp.Result)
+				}
+				return
+			}
+			result := string(resp.Result)
+			if result == "" {
+				result = "null"
+			}
+			if resp.Error != nil || result != tt.expected {
+				t.Errorf("expected %s, got %s (%v)", tt.expected, resp.Result, resp.Error)
+			}
+		})
+	}
+
+	if s.isReadOnly(lsp.DocumentURI("file:///src/app/main.go")) {
+		t.Error("expected project files outside read_only_roots to be writable")
+	}
+	for _, method := range []string{lsp.MethodTextDocumentHover, lsp.MethodTextDocumentCodeAction} {
+		if editsDocument(method) {
+			t.Errorf("expected %s to be allowed on read-only documents", method)
+		}
+	}
+}
+
+func TestServer_DropReadOnlyEdits(t *testing.T) {
+	s := &Server{cfg: &config.Config{ReadOnlyRoots: []string{"gen"}}, projectRoot: "/src/app"}
+
+	tests := []struct {
+		name     string
+		method   string
+		result   string
+		expected string
+	}{
+		{
+			name:     "rename",
+			method:   lsp.MethodTextDocumentRename,
+			result:   `{"changes":{"file:///src/app/main.go":[],"file:///src/app/gen/api.pb.go":[]}}`,
+			expected: `{"changes":{"file:///src/app/main.go":[]}}`,
+		},
+		{
+			name:     "document changes",
+			method:   lsp.MethodTextDocumentRename,
+			result:   `{"documentChanges":[{"textDocument":{"uri":"file:///nix/store/abc-go/src/fmt/print.go","version":1},"edits":[]},{"kind":"rename","oldUri":"file:///src/app/a.go","newUri":"file:///src/app/b.go"}]}`,
+			expected: `{"documentChanges":[{"kind":"rename","oldUri":"file:///src/app/a.go","newUri":"file:///src/app/b.go"}]}`,
+		},
+		{
+			name:     "writable rename",
+			method:   lsp.MethodTextDocumentRename,
+			result:   `{"changes": {"file:///src/app/main.go": []}}`,
+			expected: `{"changes": {"file:///src/app/main.go": []}}`,
+		},
+		{
+			name:   "code actions",
+			method: lsp.MethodTextDocumentCodeAction,
+			result: `[` +
+				`{"title":"organize imports","command":"gopls.organize"},` +
+				`{"title":"fix","edit":{"changes":{"file:///src/app/gen/api.pb.go":[]}}},` +
+				`{"title":"fix and run","edit":{"changes":{"file:///src/app/gen/api.pb.go":[]}},"command":{"title":"run","command":"gopls.run"}},` +
+				`{"title":"extract","edit":{"changes":{"file:///src/app/main.go":[]}}}]`,
+			expected: `[` +
+				`{"title":"organize imports","command":"gopls.organize"},` +
+				`{"command":{"title":"run","command":"gopls.run"},"title":"fix and run"},` +
+				`{"title":"extract","edit":{"changes":{"file:///src/app/main.go":[]}}}]`,
+		},
+		{
+			name:     "hover",
+			method:   lsp.MethodTextDocumentHover,
+			result:   `{"contents":"file:///src/app/gen/api.pb.go"}`,
+			expected: `{"contents":"file:///src/app/gen/api.pb.go"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(s.dropReadOnlyEdits(tt.method, json.RawMessage(tt.result))); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if _, ok := s.writableApplyEdit(json.RawMessage(`{"edit":{"changes":{"file:///src/app/gen/api.pb.go":[]}}}`)); ok {
+		t.Error("expected an applyEdit changing only read-only documents to be refused")
+	}
+}
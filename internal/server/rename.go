@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// requestFailed is LSP's RequestFailed error code: the request was valid but
+// couldn't be carried out.
+const requestFailed = -32803
+
+// renameConflict is one entry of the data of a strict rename's error.
+type renameConflict struct {
+	Server string `json:"server"`
+	With   string `json:"with"`
+	URI    string `json:"uri"`
+}
+
+// mergesRenames reports whether renames go to every LSP matching a document.
+func (s *Server) mergesRenames() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg.MergesRenames()
+}
+
+// handleRename asks every LSP matching the document to rename the symbol
+// and merges their WorkspaceEdits with mergeWorkspaceEdits, earlier servers
+// in routing order winning conflicts. Under rename_mode = "strict" a
+// conflict fails the rename instead, with the conflicts as the error's data.
+// If no server has an edit, the first server's error is returned.
+func (h *Handler) handleRename(ctx context.Context, msg *jsonrpc.Message, names []string) (*jsonrpc.Message, error) {
+	h.server.mu.RLock()
+	strict := h.server.cfg.RenameMode == config.RenameModeStrict
+	h.server.mu.RUnlock()
+
+	results := h.server.fanOut(ctx, names, msg.Method, msg.Params)
+	edit, conflicts := mergeWorkspaceEdits(results)
+
+	if strict && len(conflicts) > 0 {
+		data := make([]renameConflict, len(conflicts))
+		servers := make([]string, len(conflicts))
+		for i, c := range conflicts {
+			data[i] = renameConflict{Server: c.server, With: c.with, URI: string(c.uri)}
+			servers[i] = fmt.Sprintf("%s and %s on %s", c.with, c.server, c.uri.Path())
+		}
+		return jsonrpc.NewErrorResponse(*msg.ID, requestFailed,
+			"rename: servers disagree: "+strings.Join(servers, "; "), map[string]any{"conflicts": data})
+	}
+	h.server.reportEditConflicts(msg.Method, edit.uris(), conflicts)
+
+	if edit != nil {
+		return jsonrpc.NewResponse(*msg.ID, edit)
+	}
+	for _, r := range results {
+		if r.err != nil {
+			return callErrorResponse(*msg.ID, r.err)
+		}
+	}
+	return jsonrpc.NewResponse(*msg.ID, nil)
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// unregisterTimeout bounds the client/unregisterCapability sent on behalf of
+// a backend that stopped.
+const unregisterTimeout = 5 * time.Second
+
+// handleReverseRequest answers a request a backend sent to lux in its role as
+// the backend's client. Most are forwarded to the real client under a new ID
+// (jsonrpc.Conn assigns its own), with the client's response or error relayed
+// back to the backend that asked.
+func (s *Server) handleReverseRequest(ctx context.Context, lspName string, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	switch msg.Method {
+	case lsp.MethodWorkspaceConfiguration:
+		if inst, ok := s.pool.Get(lspName); ok && len(inst.Settings) == 0 && s.clientConn != nil && s.clientSupportsConfiguration() {
+			return s.forwardToClient(ctx, msg)
+		}
+		return handleWorkspaceConfiguration(s, lspName, msg)
+	case lsp.MethodWindowWorkDoneProgressCreate:
+		return s.handleProgressCreate(ctx, lspName, msg)
+	case lsp.MethodClientRegisterCapability:
+		return s.handleRegisterCapability(ctx, lspName, msg)
+	case lsp.MethodClientUnregisterCapability:
+		return s.handleUnregisterCapability(ctx, lspName, msg)
+	case lsp.MethodWindowShowMessageRequest:
+		// The client answers lux's own request; its choice is relayed back
+		// to the backend that asked.
+		msg.Params = prefixMessage(lspName, msg.Params)
+	case lsp.MethodWorkspaceApplyEdit:
+		if !s.clientSupportsApplyEdit() {
+			return jsonrpc.NewResponse(*msg.ID, map[string]any{
+				"applied":       false,
+				"failureReason": "client does not support workspace/applyEdit",
+			})
+		}
+		params, ok := s.writableApplyEdit(msg.Params)
+		if !ok {
+			return jsonrpc.NewResponse(*msg.ID, map[string]any{
+				"applied":       false,
+				"failureReason": "the edit only changes read-only documents",
+			})
+		}
+		msg.Params = params
+	}
+	return s.forwardToClient(ctx, msg)
+}
+
+// forwardToClient relays a backend request to the client and its response
+// back, preserving the client's error code.
+func (s *Server) forwardToClient(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	if s.clientConn == nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.MethodNotFound, fmt.Sprintf("no client connected to handle %s", msg.Method), nil)
+	}
+
+	result, err := s.clientConn.Call(ctx, msg.Method, msg.Params)
+	if err != nil {
+		return callErrorResponse(*msg.ID, err)
+	}
+	resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+	resp.Result = result
+	return resp, nil
+}
+
+// registration is a dynamic capability registration as sent to the client.
+type registration struct {
+	ID              string          `json:"id"`
+	Method          string          `json:"method"`
+	RegisterOptions json.RawMessage `json:"registerOptions,omitempty"`
+}
+
+type registrationKey struct {
+	server string
+	id     string
+}
+
+// registrationRegistry rewrites the IDs of backend capability registrations,
+// which only need to be unique per backend, so that they are unique on the
+// client, and remembers them so a stopped backend's registrations can be
+// withdrawn. Registrations the client can't take are held locally instead.
+// Either way they count towards the backend's capabilities.
+type registrationRegistry struct {
+	active map[registrationKey]registration // forwarded to the client
+	local  map[registrationKey]registration // held by lux
+	mu     sync.Mutex
+}
+
+func newRegistrationRegistry() *registrationRegistry {
+	return &registrationRegistry{
+		active: make(map[registrationKey]registration),
+		local:  make(map[registrationKey]registration),
+	}
+}
+
+// keep records registrations held by lux rather than forwarded.
+func (r *registrationRegistry) keep(server string, regs []registration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, reg := range regs {
+		r.local[registrationKey{server: server, id: reg.ID}] = reg
+	}
+}
+
+// registered reports whether a server dynamically registered method.
+func (r *registrationRegistry) registered(server, method string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, regs := range []map[registrationKey]registration{r.active, r.local} {
+		for key, reg := range regs {
+			if key.server == server && reg.Method == method {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// register records a backend's registrations and returns them with client
+// IDs.
+func (r *registrationRegistry) register(server string, regs []registration) []registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rewritten := make([]registration, len(regs))
+	for i, reg := range regs {
+		clientReg := reg
+		clientReg.ID = fmt.Sprintf("lux/%s/%s", server, reg.ID)
+		r.active[registrationKey{server: server, id: reg.ID}] = clientReg
+		rewritten[i] = clientReg
+	}
+	return rewritten
+}
+
+// unregister forgets a backend's registrations and returns the client
+// registrations to withdraw. IDs lux doesn't know are skipped.
+func (r *registrationRegistry) unregister(server string, regs []registration) []registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var withdrawn []registration
+	for _, reg := range regs {
+		key := registrationKey{server: server, id: reg.ID}
+		delete(r.local, key)
+		if clientReg, ok := r.active[key]; ok {
+			delete(r.active, key)
+			withdrawn = append(withdrawn, registration{ID: clientReg.ID, Method: clientReg.Method})
+		}
+	}
+	return withdrawn
+}
+
+// forget drops every registration of a server and returns them as client
+// registrations to withdraw.
+func (r *registrationRegistry) forget(server string) []registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var withdrawn []registration
+	for key, clientReg := range r.active {
+		if key.server == server {
+			delete(r.active, key)
+			withdrawn = append(withdrawn, registration{ID: clientReg.ID, Method: clientReg.Method})
+		}
+	}
+	for key := range r.local {
+		if key.server == server {
+			delete(r.local, key)
+		}
+	}
+	return withdrawn
+}
+
+func (s *Server) handleRegisterCapability(ctx context.Context, lspName string, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	var params struct {
+		Registrations []registration `json:"registrations"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams, "invalid params", nil)
+	}
+
+	for _, reg := range params.Registrations {
+		if reg.Method == lsp.MethodWorkspaceExecuteCommand {
+			s.commands.register(lspName, reg.ID, reg.RegisterOptions)
+		}
+	}
+
+	regs := params.Registrations
+	if watcher := s.fileWatcher(); watcher != nil {
+		regs = nil
+		for _, reg := range params.Registrations {
+			if reg.Method != lsp.MethodWorkspaceDidChangeWatchedFiles {
+				regs = append(regs, reg)
+				continue
+			}
+			if err := watcher.register(lspName, reg.ID, reg.RegisterOptions); err != nil {
+				return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams, err.Error(), nil)
+			}
+		}
+	}
+
+	// Registrations the client can't take are acknowledged and held, so the
+	// backend's dynamic capabilities still route requests to it.
+	var forward, held []registration
+	for _, reg := range regs {
+		if s.clientConn != nil && s.clientSupportsDynamicRegistration(reg.Method) {
+			forward = append(forward, reg)
+		} else {
+			held = append(held, reg)
+		}
+	}
+	s.registrations.keep(lspName, held)
+	if len(forward) == 0 {
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	}
+	regs = forward
+
+	rewritten := s.registrations.register(lspName, regs)
+	if _, err := s.clientConn.Call(ctx, msg.Method, map[string]any{"registrations": rewritten}); err != nil {
+		s.registrations.unregister(lspName, regs)
+		return callErrorResponse(*msg.ID, err)
+	}
+	return jsonrpc.NewResponse(*msg.ID, nil)
+}
+
+func (s *Server) handleUnregisterCapability(ctx context.Context, lspName string, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	// The field name's misspelling is part of the protocol.
+	var params struct {
+		Unregisterations []registration `json:"unregisterations"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams, "invalid params", nil)
+	}
+
+	for _, reg := range params.Unregisterations {
+		if reg.Method == lsp.MethodWorkspaceExecuteCommand {
+			s.commands.unregister(lspName, reg.ID)
+		}
+	}
+
+	regs := params.Unregisterations
+	if watcher := s.fileWatcher(); watcher != nil {
+		regs = nil
+		for _, reg := range params.Unregisterations {
+			if !watcher.unregister(lspName, reg.ID) {
+				regs = append(regs, reg)
+			}
+		}
+	}
+
+	withdrawn := s.registrations.unregister(lspName, regs)
+	if s.clientConn == nil || len(withdrawn) == 0 {
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	}
+
+	if _, err := s.clientConn.Call(ctx, msg.Method, map[string]any{"unregisterations": withdrawn}); err != nil {
+		return callErrorResponse(*msg.ID, err)
+	}
+	return jsonrpc.NewResponse(*msg.ID, nil)
+}
+
+// withdrawRegistrations unregisters the capabilities a server registered on
+// the client, e.g. because it crashed or was stopped. The server re-registers
+// them when it starts again.
+func (s *Server) withdrawRegistrations(lspName string) {
+	withdrawn := s.registrations.forget(lspName)
+	if s.clientConn == nil || len(withdrawn) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+		defer cancel()
+		s.clientConn.Call(ctx, lsp.MethodClientUnregisterCapability, map[string]any{"unregisterations": withdrawn})
+	}()
+}
+
+func (s *Server) clientSupportsDynamicRegistration(method string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.initParams == nil {
+		return true
+	}
+	return lsp.SupportsDynamicRegistration(&s.initParams.Capabilities, method)
+}
+
+// supportsMethod reports whether a backend provides method, through its
+// initialize capabilities or a dynamic registration.
+func (s *Server) supportsMethod(inst *subprocess.LSPInstance, method string) bool {
+	return lsp.SupportsMethod(inst.Capabilities, method) || s.registrations.registered(inst.Name, lsp.RegistrationMethod(method))
+}
+
+func (s *Server) clientSupportsApplyEdit() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.initParams != nil && s.initParams.Capabilities.Workspace != nil && s.initParams.Capabilities.Workspace.ApplyEdit
+}
+
+func (s *Server) clientSupportsConfiguration() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.initParams != nil && s.initParams.Capabilities.Workspace != nil && s.initParams.Capabilities.Workspace.Configuration
+}
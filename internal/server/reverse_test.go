@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+func TestRegistrationRegistry(t *testing.T) {
+	r := newRegistrationRegistry()
+
+	gopls := r.register("gopls", []registration{{ID: "1", Method: "workspace/didChangeWatchedFiles"}})
+	pyright := r.register("pyright", []registration{{ID: "1", Method: "workspace/didChangeWatchedFiles"}})
+	if gopls[0].ID == pyright[0].ID {
+		t.Fatalf("expected distinct client IDs, got %q twice", gopls[0].ID)
+	}
+
+	withdrawn := r.unregister("gopls", []registration{{ID: "1"}, {ID: "unknown"}})
+	if len(withdrawn) != 1 || withdrawn[0].ID != gopls[0].ID || withdrawn[0].Method != "workspace/didChangeWatchedFiles" {
+		t.Errorf("expected [%s], got %+v", gopls[0].ID, withdrawn)
+	}
+
+	withdrawn = r.forget("pyright")
+	if len(withdrawn) != 1 || withdrawn[0].ID != pyright[0].ID {
+		t.Errorf("expected [%s], got %+v", pyright[0].ID, withdrawn)
+	}
+	if withdrawn = r.forget("pyright"); len(withdrawn) != 0 {
+		t.Errorf("expected nothing left, got %+v", withdrawn)
+	}
+}
+
+// fakeClient connects a Server to an in-memory client that answers every
+// request with reply and records what it received.
+func fakeClient(t *testing.T, s *Server, reply func(msg *jsonrpc.Message) (*jsonrpc.Message, error)) <-chan *jsonrpc.Message {
+	t.Helper()
+
+	toClientR, toClientW := io.Pipe()
+	toServerR, toServerW := io.Pipe()
+	received := make(chan *jsonrpc.Message, 10)
+
+	client := jsonrpc.NewConn(toClientR, toServerW, func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		received <- msg
+		return reply(msg)
+	})
+	s.clientConn = subprocess.NewConn(toServerR, toClientW, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go client.Run(ctx)
+	go s.clientConn.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		toClientW.Close()
+		toServerW.Close()
+	})
+	return received
+}
+
+func TestHandleReverseRequest_RegisterCapability(t *testing.T) {
+	s := &Server{registrations: newRegistrationRegistry()}
+	received := fakeClient(t, s, func(msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	})
+
+	req, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(7), lsp.MethodClientRegisterCapability, map[string]any{
+		"registrations": []map[string]any{{"id": "watch", "method": "workspace/didChangeWatchedFiles"}},
+	})
+	resp, err := s.handleReverseRequest(context.Background(), "gopls", req)
+	if err != nil || resp.Error != nil {
+		t.Fatalf("expected success, got %+v, %v", resp, err)
+	}
+	if resp.ID.String() != req.ID.String() {
+		t.Errorf("expected response ID %s, got %s", req.ID, resp.ID)
+	}
+
+	got := <-received
+	var params struct {
+		Registrations []registration `json:"registrations"`
+	}
+	json.Unmarshal(got.Params, &params)
+	if len(params.Registrations) != 1 || params.Registrations[0].ID != "lux/gopls/watch" {
+		t.Errorf("expected rewritten registration ID, got %s", got.Params)
+	}
+}
+
+func TestHandleReverseRequest_RegisterCapabilityHeld(t *testing.T) {
+	s := &Server{
+		registrations: newRegistrationRegistry(),
+		initParams: &lsp.InitializeParams{Capabilities: lsp.ClientCapabilities{
+			TextDocument: &lsp.TextDocumentClientCapabilities{
+				Formatting: &lsp.FormattingClientCaps{DynamicRegistration: true},
+			},
+		}},
+	}
+	received := fakeClient(t, s, func(msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	})
+
+	req, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), lsp.MethodClientRegisterCapability, map[string]any{
+		"registrations": []map[string]any{
+			{"id": "fmt", "method": lsp.MethodTextDocumentFormatting},
+			{"id": "tokens", "method": "textDocument/semanticTokens"},
+		},
+	})
+	resp, err := s.handleReverseRequest(context.Background(), "taplo", req)
+	if err != nil || resp.Error != nil {
+		t.Fatalf("expected success, got %+v, %v", resp, err)
+	}
+
+	got := <-received
+	var params struct {
+		Registrations []registration `json:"registrations"`
+	}
+	json.Unmarshal(got.Params, &params)
+	if len(params.Registrations) != 1 || params.Registrations[0].Method != lsp.MethodTextDocumentFormatting {
+		t.Errorf("expected only the formatting registration forwarded, got %s", got.Params)
+	}
+
+	inst := &subprocess.LSPInstance{Name: "taplo", Capabilities: &lsp.ServerCapabilities{}}
+	for _, method := range []string{lsp.MethodTextDocumentFormatting, lsp.MethodTextDocumentSemanticTokensFull} {
+		if !s.supportsMethod(inst, method) {
+			t.Errorf("expected %s to be supported through registration", method)
+		}
+	}
+	if s.supportsMethod(inst, lsp.MethodTextDocumentHover) {
+		t.Error("expected hover to be unsupported")
+	}
+
+	s.registrations.forget("taplo")
+	if s.supportsMethod(inst, lsp.MethodTextDocumentSemanticTokensFull) {
+		t.Error("expected held registrations to be forgotten")
+	}
+}
+
+func TestHandleReverseRequest_ClientError(t *testing.T) {
+	s := &Server{registrations: newRegistrationRegistry()}
+	fakeClient(t, s, func(msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		return jsonrpc.NewErrorResponse(*msg.ID, -32803, "document not found", nil)
+	})
+
+	req, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(3), lsp.MethodWindowShowDocument, map[string]any{"uri": "file:///a.go"})
+	resp, err := s.handleReverseRequest(context.Background(), "gopls", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Error == nil || resp.Error.Code != -32803 {
+		t.Errorf("expected the client's error code, got %+v", resp.Error)
+	}
+}
+
+func TestHandleReverseRequest_ApplyEditUnsupported(t *testing.T) {
+	s := &Server{
+		registrations: newRegistrationRegistry(),
+		initParams:    &lsp.InitializeParams{},
+	}
+
+	req, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), lsp.MethodWorkspaceApplyEdit, map[string]any{"edit": map[string]any{}})
+	resp, err := s.handleReverseRequest(context.Background(), "gopls", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var result struct {
+		Applied bool `json:"applied"`
+	}
+	json.Unmarshal(resp.Result, &result)
+	if result.Applied {
+		t.Error("expected applied: false when the client lacks applyEdit")
+	}
+}
+
+func TestHandleReverseRequest_ShowMessageRequest(t *testing.T) {
+	s := &Server{registrations: newRegistrationRegistry()}
+	received := fakeClient(t, s, func(msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		return jsonrpc.NewResponse(*msg.ID, map[string]string{"title": "Retry"})
+	})
+
+	req, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(4), lsp.MethodWindowShowMessageRequest, map[string]any{
+		"type":    1,
+		"message": "build failed",
+		"actions": []map[string]string{{"title": "Retry"}},
+	})
+	resp, err := s.handleReverseRequest(context.Background(), "rust-analyzer", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var shown lsp.ShowMessageParams
+	json.Unmarshal((<-received).Params, &shown)
+	if shown.Message != "rust-analyzer: build failed" {
+		t.Errorf("expected the message prefixed with the server, got %q", shown.Message)
+	}
+	if string(resp.Result) != `{"title":"Retry"}` {
+		t.Errorf("expected the client's choice relayed, got %s", resp.Result)
+	}
+}
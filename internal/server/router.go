@@ -2,79 +2,156 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
-	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
 	"github.com/amarbel-llc/lux/pkg/filematch"
 )
 
 type Router struct {
 	matchers    *filematch.MatcherSet
+	configured  map[string]bool
+	owners      *ownerRoutes
 	languageMap map[lsp.DocumentURI]string
 	mu          sync.RWMutex
 }
 
 func NewRouter(cfg *config.Config) (*Router, error) {
 	matchers := filematch.NewMatcherSet()
+	configured := make(map[string]bool)
 
 	for _, l := range cfg.LSPs {
 		if err := matchers.Add(l.Name, l.Extensions, l.Patterns, l.LanguageIDs); err != nil {
 			return nil, err
 		}
+		configured[l.Name] = true
 	}
 
 	return &Router{
 		matchers:    matchers,
+		configured:  configured,
 		languageMap: make(map[lsp.DocumentURI]string),
 	}, nil
 }
 
-func (r *Router) Route(method string, params json.RawMessage) string {
-	var paramsMap map[string]any
-	if err := json.Unmarshal(params, &paramsMap); err != nil {
-		return ""
+// LoadOwnerRoutes reads the .lux-routes file in root, if any. Among the LSPs
+// matching a file, the one its directory is routed to becomes the primary.
+// Routes naming unconfigured servers are dropped.
+func (r *Router) LoadOwnerRoutes(root string) error {
+	owners, err := loadOwnerRoutes(root)
+	if err != nil {
+		return err
 	}
 
-	uri := lsp.ExtractURI(method, paramsMap)
-	if uri == "" {
-		return ""
+	var unknown []string
+	if owners != nil {
+		routes := owners.routes[:0]
+		for _, route := range owners.routes {
+			if !r.configured[route.server] {
+				unknown = append(unknown, route.server)
+				continue
+			}
+			routes = append(routes, route)
+		}
+		owners.routes = routes
 	}
 
-	if method == lsp.MethodTextDocumentDidOpen {
-		langID := lsp.ExtractLanguageID(paramsMap)
-		if langID != "" {
-			r.mu.Lock()
-			r.languageMap[uri] = langID
-			r.mu.Unlock()
-		}
+	r.mu.Lock()
+	r.owners = owners
+	r.mu.Unlock()
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("%s names unconfigured servers: %s", RoutesFileName, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Route returns the primary LSP for the document in params. Documents the
+// client opened are routed by the language ID from their didOpen as well as
+// by file name, for every later request until didClose.
+func (r *Router) Route(method string, params json.RawMessage) string {
+	if matches := r.RouteAll(method, params); len(matches) > 0 {
+		return matches[0]
+	}
+	return ""
+}
+
+// RouteAll is like Route but returns every LSP whose matcher hits the
+// document, primary first.
+func (r *Router) RouteAll(method string, params json.RawMessage) []string {
+	uri, ok := r.track(method, params)
+	if !ok {
+		return nil
 	}
 
+	matches := r.matchAll(uri)
 	if method == lsp.MethodTextDocumentDidClose {
+		// Forget the language only now, so the close goes to the servers
+		// that were sent the open.
 		r.mu.Lock()
 		delete(r.languageMap, uri)
 		r.mu.Unlock()
 	}
+	return matches
+}
 
+// matchAll returns every LSP whose matcher hits uri in config order, except
+// that those claiming the document's language ID come first, and the server
+// the routes file assigns to the file's directory, if it is among them,
+// comes before all.
+func (r *Router) matchAll(uri lsp.DocumentURI) []string {
 	r.mu.RLock()
 	langID := r.languageMap[uri]
+	owners := r.owners
 	r.mu.RUnlock()
 
-	path := uri.Path()
-	ext := uri.Extension()
+	matches := r.matchers.MatchAll(uri.Path(), uri.Extension(), langID)
 
-	return r.matchers.Match(path, ext, langID)
+	for _, owner := range owners.match(uri.Path()) {
+		for i, name := range matches {
+			if name == owner {
+				primary := append([]string{owner}, matches[:i]...)
+				return append(primary, matches[i+1:]...)
+			}
+		}
+	}
+	return matches
 }
 
-func (r *Router) RouteByURI(uri lsp.DocumentURI) string {
-	r.mu.RLock()
-	langID := r.languageMap[uri]
-	r.mu.RUnlock()
+// track extracts the document URI from params and records its language ID on
+// didOpen.
+func (r *Router) track(method string, params json.RawMessage) (lsp.DocumentURI, bool) {
+	var paramsMap map[string]any
+	if err := json.Unmarshal(params, &paramsMap); err != nil {
+		return "", false
+	}
 
-	path := uri.Path()
-	ext := uri.Extension()
+	uri := lsp.ExtractURI(method, paramsMap)
+	if uri == "" {
+		return "", false
+	}
 
-	return r.matchers.Match(path, ext, langID)
+	if method == lsp.MethodTextDocumentDidOpen {
+		langID := lsp.ExtractLanguageID(paramsMap)
+		if langID != "" {
+			r.mu.Lock()
+			r.languageMap[uri] = langID
+			r.mu.Unlock()
+		}
+	}
+
+	return uri, true
+}
+
+func (r *Router) RouteByURI(uri lsp.DocumentURI) string {
+	if matches := r.matchAll(uri); len(matches) > 0 {
+		return matches[0]
+	}
+	return ""
 }
 
 func (r *Router) RouteByExtension(ext string) string {
@@ -85,6 +162,31 @@ func (r *Router) RouteByLanguageID(langID string) string {
 	return r.matchers.MatchByLanguageID(langID)
 }
 
+// inheritLanguages copies the language IDs of open documents from a router
+// being replaced.
+func (r *Router) inheritLanguages(old *Router) {
+	old.mu.RLock()
+	defer old.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for uri, langID := range old.languageMap {
+		r.languageMap[uri] = langID
+	}
+}
+
+// OpenDocuments returns the URIs the client currently has open, sorted.
+func (r *Router) OpenDocuments() []lsp.DocumentURI {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	uris := make([]lsp.DocumentURI, 0, len(r.languageMap))
+	for uri := range r.languageMap {
+		uris = append(uris, uri)
+	}
+	sort.Slice(uris, func(i, j int) bool { return uris[i] < uris[j] })
+	return uris
+}
+
 func (r *Router) SetLanguageID(uri lsp.DocumentURI, langID string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
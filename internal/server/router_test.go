@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestRouterLanguageID(t *testing.T) {
+	cfg := &config.Config{LSPs: []config.LSP{
+		{Name: "clangd", Extensions: []string{"h", "c", "cpp"}},
+		{Name: "ccls-objc", LanguageIDs: []string{"objective-c"}},
+		{Name: "gopls", Extensions: []string{"go"}, LanguageIDs: []string{"go"}},
+	}}
+	router, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := lsp.URIFromPath("/src/view.h")
+	script := lsp.URIFromPath("/src/build")
+	params := func(uri lsp.DocumentURI, extra map[string]any) json.RawMessage {
+		doc := map[string]any{"uri": uri}
+		for k, v := range extra {
+			doc[k] = v
+		}
+		raw, _ := json.Marshal(map[string]any{"textDocument": doc})
+		return raw
+	}
+
+	if got := router.Route(lsp.MethodTextDocumentHover, params(header, nil)); got != "clangd" {
+		t.Errorf("before didOpen: expected %q, got %q", "clangd", got)
+	}
+
+	router.Route(lsp.MethodTextDocumentDidOpen, params(header, map[string]any{"languageId": "objective-c"}))
+	router.Route(lsp.MethodTextDocumentDidOpen, params(script, map[string]any{"languageId": "go"}))
+
+	tests := []struct {
+		uri      lsp.DocumentURI
+		expected []string
+	}{
+		{header, []string{"ccls-objc", "clangd"}},
+		{script, []string{"gopls"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.uri), func(t *testing.T) {
+			if got := router.RouteAll(lsp.MethodTextDocumentDefinition, params(tt.uri, nil)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// didClose still reaches the servers that were sent didOpen.
+	if got := router.RouteAll(lsp.MethodTextDocumentDidClose, params(script, nil)); !reflect.DeepEqual(got, []string{"gopls"}) {
+		t.Errorf("didClose: expected [gopls], got %v", got)
+	}
+	if got := router.Route(lsp.MethodTextDocumentHover, params(script, nil)); got != "" {
+		t.Errorf("after didClose: expected no route, got %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// RoutesFileName is a file at the repository root mapping directories to the
+// LSP that serves them, CODEOWNERS-style, for monorepos where teams pick
+// their own servers. It takes precedence over config order when several
+// LSPs match a file.
+const RoutesFileName = ".lux-routes"
+
+type ownerRoute struct {
+	// prefix is a slash-separated directory relative to the root; "" matches
+	// everything.
+	prefix string
+	server string
+}
+
+// ownerRoutes is a parsed routes file. As in CODEOWNERS, later lines take
+// precedence over earlier ones.
+type ownerRoutes struct {
+	root   string
+	routes []ownerRoute
+}
+
+// parseOwnerRoutes reads lines of the form "<directory> <server>". Blank
+// lines and lines starting with # are ignored; "*" or "/" as the directory
+// matches the whole repository.
+func parseOwnerRoutes(r io.Reader) ([]ownerRoute, error) {
+	var routes []ownerRoute
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"<directory> <server>\", got %q", lineNo, line)
+		}
+
+		prefix := strings.Trim(fields[0], "/")
+		if prefix == "*" {
+			prefix = ""
+		}
+		if prefix != "" {
+			prefix = path.Clean(prefix)
+		}
+		if prefix == ".." || strings.HasPrefix(prefix, "../") {
+			return nil, fmt.Errorf("line %d: directory %q is outside the repository", lineNo, fields[0])
+		}
+
+		routes = append(routes, ownerRoute{prefix: prefix, server: fields[1]})
+	}
+
+	return routes, scanner.Err()
+}
+
+// loadOwnerRoutes reads the routes file in root, returning nil if there is
+// none.
+func loadOwnerRoutes(root string) (*ownerRoutes, error) {
+	f, err := os.Open(filepath.Join(root, RoutesFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	routes, err := parseOwnerRoutes(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", RoutesFileName, err)
+	}
+	return &ownerRoutes{root: root, routes: routes}, nil
+}
+
+// match returns the servers routed to the directories containing filePath,
+// most specific (latest in the file) first.
+func (o *ownerRoutes) match(filePath string) []string {
+	if o == nil {
+		return nil
+	}
+
+	rel, err := filepath.Rel(o.root, filePath)
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil
+	}
+
+	var servers []string
+	for i := len(o.routes) - 1; i >= 0; i-- {
+		prefix := o.routes[i].prefix
+		if prefix == "" || rel == prefix || strings.HasPrefix(rel, prefix+"/") {
+			servers = append(servers, o.routes[i].server)
+		}
+	}
+	return servers
+}
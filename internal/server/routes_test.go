@@ -0,0 +1,107 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestOwnerRoutesMatch(t *testing.T) {
+	input := `
+# Default for the whole repo
+*                     gopls
+
+/services/payments/   gopls-payments
+web                   typescript-language-server
+web/legacy/           flow
+`
+	routes, err := parseOwnerRoutes(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	owners := &ownerRoutes{root: "/repo", routes: routes}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/repo/main.go", "gopls"},
+		{"/repo/services/payments/api.go", "gopls-payments gopls"},
+		{"/repo/services/paymentsv2/api.go", "gopls"},
+		{"/repo/web/app.ts", "typescript-language-server gopls"},
+		{"/repo/web/legacy/old.js", "flow typescript-language-server gopls"},
+		{"/elsewhere/main.go", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := strings.Join(owners.match(tt.path), " "); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseOwnerRoutesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "missing server", input: "web/\n"},
+		{name: "extra field", input: "web/ tsserver eslint\n"},
+		{name: "outside repo", input: "../other gopls\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseOwnerRoutes(strings.NewReader(tt.input)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestRouterOwnerRoutes(t *testing.T) {
+	root := t.TempDir()
+	routes := "services/payments/ gopls-payments\nweb/ unknown-server\n"
+	if err := os.WriteFile(filepath.Join(root, RoutesFileName), []byte(routes), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{LSPs: []config.LSP{
+		{Name: "gopls", Extensions: []string{"go"}},
+		{Name: "gopls-payments", Extensions: []string{"go"}},
+		{Name: "marksman", Extensions: []string{"md"}},
+	}}
+	router, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := router.LoadOwnerRoutes(root); err == nil {
+		t.Error("expected error for unconfigured server")
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"main.go", "gopls"},
+		{"services/payments/api.go", "gopls-payments"},
+		// The routed server doesn't handle markdown, so matching falls back.
+		{"services/payments/README.md", "marksman"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			uri := lsp.URIFromPath(filepath.Join(root, tt.path))
+			if got := router.RouteByURI(uri); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// saveParams shapes a didSave notification for one backend according to the
+// save options it declared. It reports false when the backend should not be
+// sent the notification at all.
+func (s *Server) saveParams(inst *subprocess.LSPInstance, params json.RawMessage) (json.RawMessage, bool) {
+	wantsSave, includeText := lsp.SaveOptions(inst.Capabilities)
+
+	if !wantsSave {
+		l := s.lspConfig(inst.Name)
+		force := l != nil && l.ForceSave
+		if !force {
+			return nil, false
+		}
+	}
+
+	shaped, err := shapeSaveParams(params, includeText, os.ReadFile)
+	if err != nil {
+		return params, true
+	}
+	return shaped, true
+}
+
+// shapeSaveParams strips the text field from didSave params, or synthesizes
+// it when it is wanted but the client didn't send it. The document was just
+// saved, so its contents on disk are the saved text.
+func shapeSaveParams(params json.RawMessage, includeText bool, readFile func(string) ([]byte, error)) (json.RawMessage, error) {
+	var p lsp.DidSaveTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !includeText && p.Text != nil:
+		p.Text = nil
+	case includeText && p.Text == nil:
+		data, err := readFile(p.TextDocument.URI.Path())
+		if err != nil {
+			return nil, err
+		}
+		text := string(data)
+		p.Text = &text
+	default:
+		return params, nil
+	}
+
+	return json.Marshal(p)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestShapeSaveParams(t *testing.T) {
+	readFile := func(path string) ([]byte, error) {
+		if path == "/tmp/main.go" {
+			return []byte("package main\n"), nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	tests := []struct {
+		name        string
+		params      string
+		includeText bool
+		expected    string
+	}{
+		{
+			name:        "strips text",
+			params:      `{"textDocument":{"uri":"file:///tmp/main.go"},"text":"package main\n"}`,
+			includeText: false,
+			expected:    `{"textDocument":{"uri":"file:///tmp/main.go"}}`,
+		},
+		{
+			name:        "synthesizes text",
+			params:      `{"textDocument":{"uri":"file:///tmp/main.go"}}`,
+			includeText: true,
+			expected:    `{"textDocument":{"uri":"file:///tmp/main.go"},"text":"package main\n"}`,
+		},
+		{
+			name:        "keeps client text",
+			params:      `{"textDocument":{"uri":"file:///tmp/main.go"},"text":"unsaved"}`,
+			includeText: true,
+			expected:    `{"textDocument":{"uri":"file:///tmp/main.go"},"text":"unsaved"}`,
+		},
+		{
+			name:        "no text either way",
+			params:      `{"textDocument":{"uri":"file:///tmp/main.go"}}`,
+			includeText: false,
+			expected:    `{"textDocument":{"uri":"file:///tmp/main.go"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := shapeSaveParams(json.RawMessage(tt.params), tt.includeText, readFile)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestShapeSaveParamsMissingFile(t *testing.T) {
+	readFile := func(string) ([]byte, error) { return nil, errors.New("not found") }
+
+	_, err := shapeSaveParams(json.RawMessage(`{"textDocument":{"uri":"file:///gone.go"}}`), true, readFile)
+	if err == nil {
+		t.Error("expected error for unreadable file")
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// startScheduler staggers backend startup when many servers would start at
+// once (e.g. a polyglot repo opened with many files). Starts triggered by
+// requests are treated as the focused document and go immediately; starts
+// triggered by notifications such as didOpen are given successive slots
+// stagger apart. A request for a server waiting on its slot promotes it.
+type startScheduler struct {
+	stagger  time.Duration
+	nextSlot time.Time
+	waiting  map[string]chan struct{}
+	mu       sync.Mutex
+}
+
+func newStartScheduler(stagger time.Duration) *startScheduler {
+	return &startScheduler{
+		stagger: stagger,
+		waiting: make(map[string]chan struct{}),
+	}
+}
+
+// wait blocks until name may be started. It returns early if ctx is done.
+func (sch *startScheduler) wait(ctx context.Context, name string, focused bool) {
+	if sch.stagger <= 0 {
+		return
+	}
+
+	sch.mu.Lock()
+	if ready, ok := sch.waiting[name]; ok {
+		if focused {
+			close(ready)
+			delete(sch.waiting, name)
+			sch.mu.Unlock()
+			return
+		}
+		sch.mu.Unlock()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	now := time.Now()
+	if focused {
+		if sch.nextSlot.Before(now) {
+			sch.nextSlot = now
+		}
+		sch.nextSlot = sch.nextSlot.Add(sch.stagger)
+		sch.mu.Unlock()
+		return
+	}
+
+	slot := sch.nextSlot
+	if slot.Before(now) {
+		slot = now
+	}
+	sch.nextSlot = slot.Add(sch.stagger)
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		sch.mu.Unlock()
+		return
+	}
+
+	ready := make(chan struct{})
+	sch.waiting[name] = ready
+	sch.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	sch.mu.Lock()
+	if sch.waiting[name] == ready {
+		close(ready)
+		delete(sch.waiting, name)
+	}
+	sch.mu.Unlock()
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/internal/subprocess/subprocesstest"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestStartScheduler(t *testing.T) {
+	const stagger = 50 * time.Millisecond
+	sch := newStartScheduler(stagger)
+	ctx := context.Background()
+
+	start := time.Now()
+	sch.wait(ctx, "first", false)
+	if elapsed := time.Since(start); elapsed > stagger/2 {
+		t.Errorf("first start: expected no delay, waited %s", elapsed)
+	}
+
+	start = time.Now()
+	sch.wait(ctx, "second", false)
+	if elapsed := time.Since(start); elapsed < stagger/2 {
+		t.Errorf("second start: expected to be deferred, waited %s", elapsed)
+	}
+
+	// A deferred server is promoted as soon as a request needs it.
+	done := make(chan time.Duration)
+	go func() {
+		start := time.Now()
+		sch.wait(ctx, "third", false)
+		done <- time.Since(start)
+	}()
+	for waiting := false; !waiting; {
+		time.Sleep(time.Millisecond)
+		sch.mu.Lock()
+		_, waiting = sch.waiting["third"]
+		sch.mu.Unlock()
+	}
+	sch.wait(ctx, "third", true)
+
+	if elapsed := <-done; elapsed > stagger/2 {
+		t.Errorf("promoted start: expected early release, waited %s", elapsed)
+	}
+
+	off := newStartScheduler(0)
+	start = time.Now()
+	off.wait(ctx, "a", false)
+	off.wait(ctx, "b", false)
+	if elapsed := time.Since(start); elapsed > stagger/2 {
+		t.Errorf("disabled scheduler: expected no delay, waited %s", elapsed)
+	}
+}
+
+func TestHandler_StartInstanceOutlivesRequest(t *testing.T) {
+	cfg := &config.Config{
+		StartupStagger: "0",
+		LSPs:           []config.LSP{{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}}},
+	}
+	executor, err := subprocesstest.NewExecutor("gopls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newServer(cfg, executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.pool.StopAll)
+	h := NewHandler(s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := h.startInstance(ctx, "gopls", true); err != nil {
+		t.Fatal(err)
+	}
+	// As when the request is answered or the client cancels it.
+	cancel()
+
+	time.Sleep(50 * time.Millisecond)
+	if state, _ := s.pool.State("gopls"); state != subprocess.LSPStateRunning {
+		t.Errorf("expected gopls to keep running after its request ended, got %s", state)
+	}
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/capabilities"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// semanticLegend is a SemanticTokensLegend: token data refers to types and
+// modifiers by index into these lists.
+type semanticLegend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+// standardLegend holds the token types and modifiers predefined by the LSP
+// specification. The legend lux advertises starts with it, so the common
+// types keep the same indices whichever servers are configured.
+var standardLegend = semanticLegend{
+	TokenTypes: []string{
+		"namespace", "type", "class", "enum", "interface", "struct",
+		"typeParameter", "parameter", "variable", "property", "enumMember",
+		"event", "function", "method", "macro", "keyword", "modifier",
+		"comment", "string", "number", "regexp", "operator", "decorator",
+	},
+	TokenModifiers: []string{
+		"declaration", "definition", "readonly", "static", "deprecated",
+		"abstract", "async", "modification", "documentation", "defaultLibrary",
+	},
+}
+
+// maxTokenModifiers is how many modifiers fit the bitmask of a token.
+const maxTokenModifiers = 32
+
+// unifiedLegend returns standardLegend extended with the types and modifiers
+// of each server legend it lacks, in order. Modifiers beyond the 32 a bitmask
+// can hold are left out.
+func unifiedLegend(legends ...semanticLegend) semanticLegend {
+	unified := semanticLegend{
+		TokenTypes:     append([]string(nil), standardLegend.TokenTypes...),
+		TokenModifiers: append([]string(nil), standardLegend.TokenModifiers...),
+	}
+	types := make(map[string]bool)
+	for _, t := range unified.TokenTypes {
+		types[t] = true
+	}
+	modifiers := make(map[string]bool)
+	for _, m := range unified.TokenModifiers {
+		modifiers[m] = true
+	}
+
+	for _, legend := range legends {
+		for _, t := range legend.TokenTypes {
+			if !types[t] {
+				types[t] = true
+				unified.TokenTypes = append(unified.TokenTypes, t)
+			}
+		}
+		for _, m := range legend.TokenModifiers {
+			if !modifiers[m] && len(unified.TokenModifiers) < maxTokenModifiers {
+				modifiers[m] = true
+				unified.TokenModifiers = append(unified.TokenModifiers, m)
+			}
+		}
+	}
+	return unified
+}
+
+// semanticTokensProvider is the capability advertised for legend. Deltas
+// aren't offered: they would have to be translated against per-server
+// result IDs.
+func semanticTokensProvider(legend semanticLegend) map[string]any {
+	return map[string]any{
+		"legend": legend,
+		"full":   true,
+		"range":  true,
+	}
+}
+
+// legendTranslation maps one server's legend indices onto another legend.
+type legendTranslation struct {
+	types     []int    // server type index -> target index, or -1
+	modifiers []uint32 // server modifier bit -> target modifier mask
+}
+
+func newLegendTranslation(from, to semanticLegend) legendTranslation {
+	typeIndex := make(map[string]int, len(to.TokenTypes))
+	for i, t := range to.TokenTypes {
+		typeIndex[t] = i
+	}
+	modifierIndex := make(map[string]int, len(to.TokenModifiers))
+	for i, m := range to.TokenModifiers {
+		modifierIndex[m] = i
+	}
+
+	tr := legendTranslation{
+		types:     make([]int, len(from.TokenTypes)),
+		modifiers: make([]uint32, len(from.TokenModifiers)),
+	}
+	for i, t := range from.TokenTypes {
+		if j, ok := typeIndex[t]; ok {
+			tr.types[i] = j
+		} else {
+			tr.types[i] = -1
+		}
+	}
+	for i, m := range from.TokenModifiers {
+		if j, ok := modifierIndex[m]; ok {
+			tr.modifiers[i] = 1 << j
+		}
+	}
+	return tr
+}
+
+// semanticToken is a token with an absolute position.
+type semanticToken struct {
+	line, char, length, tokenType, modifiers uint32
+}
+
+// decodeTokens converts the relative five-integer encoding to absolute
+// tokens.
+func decodeTokens(data []uint32) []semanticToken {
+	tokens := make([]semanticToken, 0, len(data)/5)
+	var line, char uint32
+	for i := 0; i+4 < len(data); i += 5 {
+		if data[i] != 0 {
+			line += data[i]
+			char = data[i+1]
+		} else {
+			char += data[i+1]
+		}
+		tokens = append(tokens, semanticToken{line: line, char: char, length: data[i+2], tokenType: data[i+3], modifiers: data[i+4]})
+	}
+	return tokens
+}
+
+// encodeTokens converts sorted absolute tokens back to the relative encoding.
+func encodeTokens(tokens []semanticToken) []uint32 {
+	data := make([]uint32, 0, len(tokens)*5)
+	var line, char uint32
+	for _, t := range tokens {
+		deltaChar := t.char
+		if t.line == line {
+			deltaChar = t.char - char
+		}
+		data = append(data, t.line-line, deltaChar, t.length, t.tokenType, t.modifiers)
+		line, char = t.line, t.char
+	}
+	return data
+}
+
+// identity reports whether the translation leaves every token unchanged.
+func (tr legendTranslation) identity() bool {
+	for i, j := range tr.types {
+		if i != j {
+			return false
+		}
+	}
+	for i, mask := range tr.modifiers {
+		if mask != 1<<i {
+			return false
+		}
+	}
+	return true
+}
+
+// translate rewrites tokens into the target legend, dropping those whose
+// type it doesn't have.
+func (tr legendTranslation) translate(tokens []semanticToken) []semanticToken {
+	translated := tokens[:0]
+	for _, t := range tokens {
+		if int(t.tokenType) >= len(tr.types) || tr.types[t.tokenType] < 0 {
+			continue
+		}
+		t.tokenType = uint32(tr.types[t.tokenType])
+
+		var mods uint32
+		for bit := 0; bit < len(tr.modifiers); bit++ {
+			if t.modifiers&(1<<bit) != 0 {
+				mods |= tr.modifiers[bit]
+			}
+		}
+		t.modifiers = mods
+		translated = append(translated, t)
+	}
+	return translated
+}
+
+// semanticTokensResult holds the data of a SemanticTokens response.
+type semanticTokensResult struct {
+	Data []uint32 `json:"data"`
+}
+
+// mergeSemanticTokens combines translated token sets, primary first. A token
+// overlapping one already taken from an earlier server is dropped, so each
+// character is colored by at most one server.
+func mergeSemanticTokens(sets [][]semanticToken) []semanticToken {
+	if len(sets) == 0 {
+		return nil
+	}
+	merged := sets[0]
+	for _, set := range sets[1:] {
+		merged = mergeTokenSet(merged, set)
+	}
+	return merged
+}
+
+// mergeTokenSet adds the tokens of set that don't overlap merged to it. Both
+// are sorted by position, as decoded tokens are, so one sweep over the two
+// finds each token's neighbors.
+func mergeTokenSet(merged, set []semanticToken) []semanticToken {
+	out := make([]semanticToken, 0, len(merged)+len(set))
+	i := 0
+	for _, t := range set {
+		for i < len(merged) && (merged[i].line < t.line || merged[i].line == t.line && merged[i].char+merged[i].length <= t.char) {
+			out = append(out, merged[i])
+			i++
+		}
+		if i < len(merged) && merged[i].line == t.line && merged[i].char < t.char+t.length {
+			continue
+		}
+		if n := len(out); n > 0 && out[n-1].line == t.line && out[n-1].char+out[n-1].length > t.char {
+			continue
+		}
+		out = append(out, t)
+	}
+	return append(out, merged[i:]...)
+}
+
+// serverLegend extracts the legend from a server's semanticTokensProvider.
+func serverLegend(caps *lsp.ServerCapabilities) (semanticLegend, bool) {
+	if caps == nil || caps.SemanticTokensProvider == nil {
+		return semanticLegend{}, false
+	}
+	raw, err := json.Marshal(caps.SemanticTokensProvider)
+	if err != nil {
+		return semanticLegend{}, false
+	}
+	var provider struct {
+		Legend *semanticLegend `json:"legend"`
+	}
+	if err := json.Unmarshal(raw, &provider); err != nil || provider.Legend == nil {
+		return semanticLegend{}, false
+	}
+	return *provider.Legend, true
+}
+
+// handleSemanticTokens answers semantic token requests in the legend lux
+// advertised, translating each server's token indices into it. With
+// semantic_tokens_mode "merge" every LSP matching the document is asked and
+// the tokens are combined; otherwise only the primary is. Delta requests are
+// answered with full results, since no delta support is advertised.
+func (h *Handler) handleSemanticTokens(ctx context.Context, msg *jsonrpc.Message, legend semanticLegend) (*jsonrpc.Message, error) {
+	method, params := msg.Method, msg.Params
+	if method == lsp.MethodTextDocumentSemanticTokensDelta {
+		method = lsp.MethodTextDocumentSemanticTokensFull
+		var p map[string]json.RawMessage
+		if err := json.Unmarshal(params, &p); err == nil {
+			delete(p, "previousResultId")
+			params, _ = json.Marshal(p)
+		}
+	}
+
+	names := h.server.routeAll(method, params)
+	if len(names) > 1 && !h.server.mergesSemanticTokens() {
+		names = names[:1]
+	}
+	results := h.server.fanOut(ctx, names, method, params)
+
+	var sets [][]semanticToken
+	for _, r := range results {
+		if r.err != nil || len(r.result) == 0 {
+			continue
+		}
+		inst, ok := h.server.pool.Get(r.server)
+		if !ok {
+			continue
+		}
+		from, ok := serverLegend(inst.Capabilities)
+		if !ok {
+			continue
+		}
+		tr := newLegendTranslation(from, legend)
+
+		// A lone answer already in lux's legend needs no decoding.
+		if len(names) == 1 && tr.identity() {
+			return jsonrpc.NewResponse(*msg.ID, r.result)
+		}
+
+		var tokens semanticTokensResult
+		if err := json.Unmarshal(r.result, &tokens); err != nil {
+			continue
+		}
+		sets = append(sets, tr.translate(decodeTokens(tokens.Data)))
+	}
+
+	if len(sets) == 0 {
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	}
+	return jsonrpc.NewResponse(*msg.ID, semanticTokensResult{Data: encodeTokens(mergeSemanticTokens(sets))})
+}
+
+func (s *Server) mergesSemanticTokens() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg.MergesSemanticTokens()
+}
+
+// semanticLegend returns the legend advertised at initialize, or nil when
+// none was and semantic tokens pass through untranslated.
+func (s *Server) semanticLegend() *semanticLegend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.legend
+}
+
+// cachedLegends returns the semantic tokens legends in the capability caches
+// of the configured LSPs.
+func (s *Server) cachedLegends() []semanticLegend {
+	var legends []semanticLegend
+	for _, l := range s.cfg.LSPs {
+		cache, err := capabilities.LoadCache(l.Name)
+		if err != nil {
+			continue
+		}
+		if legend, ok := serverLegend(&cache.Capabilities); ok {
+			legends = append(legends, legend)
+		}
+	}
+	return legends
+}
+
+func isSemanticTokensMethod(method string) bool {
+	switch method {
+	case lsp.MethodTextDocumentSemanticTokensFull,
+		lsp.MethodTextDocumentSemanticTokensDelta,
+		lsp.MethodTextDocumentSemanticTokensRange:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestDecodeEncodeTokens(t *testing.T) {
+	data := []uint32{
+		0, 4, 3, 1, 0,
+		0, 6, 5, 2, 1,
+		2, 1, 4, 0, 0,
+	}
+
+	tokens := decodeTokens(data)
+	want := []semanticToken{
+		{line: 0, char: 4, length: 3, tokenType: 1},
+		{line: 0, char: 10, length: 5, tokenType: 2, modifiers: 1},
+		{line: 2, char: 1, length: 4},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("expected %+v, got %+v", want, tokens)
+	}
+	if got := encodeTokens(tokens); !reflect.DeepEqual(got, data) {
+		t.Errorf("expected %v, got %v", data, got)
+	}
+}
+
+func TestLegendTranslation(t *testing.T) {
+	tr := newLegendTranslation(semanticLegend{
+		TokenTypes:     []string{"function", "customThing", "variable"},
+		TokenModifiers: []string{"customMod", "readonly", "declaration"},
+	}, standardLegend)
+
+	tokens := tr.translate([]semanticToken{
+		{line: 0, char: 0, length: 3, tokenType: 0, modifiers: 0b110},
+		{line: 0, char: 4, length: 3, tokenType: 1},
+		{line: 1, char: 0, length: 3, tokenType: 2, modifiers: 0b001},
+		{line: 2, char: 0, length: 3, tokenType: 9},
+	})
+
+	want := []semanticToken{
+		{line: 0, char: 0, length: 3, tokenType: 12, modifiers: 1<<2 | 1<<0},
+		{line: 1, char: 0, length: 3, tokenType: 8},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("expected %+v, got %+v", want, tokens)
+	}
+
+	if tr.identity() {
+		t.Error("expected a reordering translation not to be the identity")
+	}
+	if !newLegendTranslation(standardLegend, unifiedLegend()).identity() {
+		t.Error("expected translating the standard legend into itself to be the identity")
+	}
+}
+
+func TestUnifiedLegend(t *testing.T) {
+	legend := unifiedLegend(
+		semanticLegend{TokenTypes: []string{"variable", "lifetime"}, TokenModifiers: []string{"mutable"}},
+		semanticLegend{TokenTypes: []string{"lifetime", "selfKeyword"}, TokenModifiers: []string{"readonly", "mutable"}},
+	)
+
+	std := len(standardLegend.TokenTypes)
+	if got := legend.TokenTypes[std:]; !reflect.DeepEqual(got, []string{"lifetime", "selfKeyword"}) {
+		t.Errorf("expected extra types [lifetime selfKeyword], got %v", got)
+	}
+	if got := legend.TokenModifiers[len(standardLegend.TokenModifiers):]; !reflect.DeepEqual(got, []string{"mutable"}) {
+		t.Errorf("expected extra modifiers [mutable], got %v", got)
+	}
+	if legend.TokenTypes[8] != "variable" {
+		t.Errorf("expected standard types to keep their indices, got %q at 8", legend.TokenTypes[8])
+	}
+
+	// A non-standard type survives translation into the unified legend.
+	tr := newLegendTranslation(semanticLegend{TokenTypes: []string{"selfKeyword"}, TokenModifiers: []string{"mutable"}}, legend)
+	tokens := tr.translate([]semanticToken{{length: 4, modifiers: 1}})
+	want := []semanticToken{{length: 4, tokenType: uint32(std + 1), modifiers: 1 << len(standardLegend.TokenModifiers)}}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("expected %+v, got %+v", want, tokens)
+	}
+}
+
+func TestUnifiedLegend_ModifierLimit(t *testing.T) {
+	var many []string
+	for i := 0; i < 40; i++ {
+		many = append(many, fmt.Sprintf("mod%d", i))
+	}
+
+	legend := unifiedLegend(semanticLegend{TokenModifiers: many})
+	if len(legend.TokenModifiers) != maxTokenModifiers {
+		t.Errorf("expected %d modifiers, got %d", maxTokenModifiers, len(legend.TokenModifiers))
+	}
+}
+
+func TestMergeSemanticTokens(t *testing.T) {
+	primary := []semanticToken{
+		{line: 0, char: 4, length: 3, tokenType: 1},
+		{line: 2, char: 0, length: 5, tokenType: 2},
+	}
+	secondary := []semanticToken{
+		{line: 0, char: 0, length: 3, tokenType: 3},
+		{line: 0, char: 5, length: 4, tokenType: 3},
+		{line: 1, char: 0, length: 2, tokenType: 3},
+		{line: 2, char: 4, length: 2, tokenType: 3},
+	}
+
+	got := mergeSemanticTokens([][]semanticToken{primary, secondary})
+	want := []semanticToken{
+		{line: 0, char: 0, length: 3, tokenType: 3},
+		{line: 0, char: 4, length: 3, tokenType: 1},
+		{line: 1, char: 0, length: 2, tokenType: 3},
+		{line: 2, char: 0, length: 5, tokenType: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestServerLegend(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider any
+		ok       bool
+	}{
+		{"missing", nil, false},
+		{"bool", true, false},
+		{"options", map[string]any{
+			"legend": map[string]any{"tokenTypes": []string{"function"}, "tokenModifiers": []string{}},
+			"full":   true,
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legend, ok := serverLegend(&lsp.ServerCapabilities{SemanticTokensProvider: tt.provider})
+			if ok != tt.ok {
+				t.Fatalf("expected ok=%v, got %v", tt.ok, ok)
+			}
+			if ok && (len(legend.TokenTypes) != 1 || legend.TokenTypes[0] != "function") {
+				t.Errorf("expected [function], got %v", legend.TokenTypes)
+			}
+		})
+	}
+}
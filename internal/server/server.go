@@ -2,62 +2,120 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
 
 	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
-	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/control"
 	"github.com/amarbel-llc/lux/internal/formatter"
 	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/stats"
 	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+	"github.com/amarbel-llc/lux/pkg/middleware"
+	"golang.org/x/sync/errgroup"
 )
 
 type Server struct {
-	cfg         *config.Config
-	pool        *subprocess.Pool
-	router      *Router
-	fmtRouter   *formatter.Router
-	executor    subprocess.Executor
-	clientConn  *jsonrpc.Conn
-	controlSrv  *control.Server
-	initParams  *lsp.InitializeParams
-	projectRoot string
-	initialized bool
-	mu          sync.RWMutex
-	done        chan struct{}
+	cfg           *config.Config
+	pool          *subprocess.Pool
+	router        *Router
+	fmtRouter     *formatter.Router
+	executor      subprocess.Executor
+	clientConn    *subprocess.Conn
+	controlSrv    *control.Server
+	health        *healthReporter
+	inflight      *inflightTracker
+	cancels       *cancelTracker
+	progress      *progressRegistry
+	registrations *registrationRegistry
+	commands      *commandOwners
+	watcher       *fileWatcher
+	legend        *semanticLegend
+	documents     *documentStore
+	responses     *ResponseCache
+	requests      *requestScheduler
+	usage         *stats.Recorder
+	diagnostics   *diagnosticsAggregator
+	scheduler     *startScheduler
+	gaps          []config.WorkspaceGap
+	listeners     []namedListener
+	middleware    []middleware.Middleware
+	plugins       *pluginSet
+	initParams    *lsp.InitializeParams
+	compat        *clientCompat
+	projectRoot   string
+	folders       []string
+	initialized   bool
+	prewarmAll    bool
+	mu            sync.RWMutex
+	done          chan struct{}
 }
 
 func New(cfg *config.Config) (*Server, error) {
+	return newServer(cfg, subprocess.NewExecutor(cfg.ExecutorKind(), config.StateDir()))
+}
+
+func newServer(cfg *config.Config, executor subprocess.Executor) (*Server, error) {
 	router, err := NewRouter(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("creating router: %w", err)
 	}
 
-	executor := subprocess.NewNixExecutor()
-
 	s := &Server{
-		cfg:      cfg,
-		router:   router,
-		executor: executor,
-		done:     make(chan struct{}),
+		cfg:           cfg,
+		router:        router,
+		executor:      executor,
+		health:        newHealthReporter(),
+		inflight:      newInflightTracker(),
+		cancels:       newCancelTracker(),
+		progress:      newProgressRegistry(),
+		registrations: newRegistrationRegistry(),
+		commands:      newCommandOwners(),
+		documents:     newDocumentStore(),
+		responses:     NewResponseCache(),
+		requests:      newRequestScheduler(cfg),
+		diagnostics:   newDiagnosticsAggregator(),
+		scheduler:     newStartScheduler(cfg.StartupStaggerDuration()),
+		done:          make(chan struct{}),
 	}
 
 	s.pool = subprocess.NewPool(executor, func(lspName string) jsonrpc.Handler {
 		return serverNotificationHandler(s, lspName)
 	})
+	s.pool.SetDispatch(func(string) subprocess.Dispatch {
+		return s.requests.newDispatcher().Dispatch
+	})
+	s.pool.SetStateHandler(s.onStateChange)
+
+	maxFailures, window := cfg.RestartBudget()
+	s.pool.SetRestartPolicy(subprocess.RestartPolicy{MaxFailures: maxFailures, Window: window})
+
+	retries, backoff := cfg.AutoRestartPolicy()
+	s.pool.SetAutoRestart(subprocess.AutoRestart{
+		MaxRetries:     retries,
+		InitialBackoff: backoff,
+		MaxBackoff:     config.MaxRestartBackoff,
+	})
+	s.pool.AddHooks(subprocess.Hooks{OnRestart: s.onRestart})
+
+	if cfg.UsageStats {
+		s.usage = stats.NewRecorder(stats.DefaultPath())
+		s.pool.SetCallHandler(s.usage.Record)
+	}
 
 	for _, l := range cfg.LSPs {
-		// Convert config.CapabilityOverride to subprocess.CapabilityOverride
-		var capOverrides *subprocess.CapabilityOverride
-		if l.Capabilities != nil {
-			capOverrides = &subprocess.CapabilityOverride{
-				Disable: l.Capabilities.Disable,
-				Enable:  l.Capabilities.Enable,
-			}
-		}
-		s.pool.Register(l.Name, l.Flake, l.Binary, l.Args, l.Env, l.InitOptions, l.Settings, l.SettingsWireKey(), capOverrides)
+		s.registerLSP(l)
+	}
+
+	for _, m := range middleware.Registered() {
+		s.AddMiddleware(m)
+	}
+	if s.plugins = loadPlugins(context.Background(), cfg.Plugins); s.plugins != nil {
+		s.AddMiddleware(s.plugins)
 	}
 
 	fmtCfg, err := config.LoadMergedFormatters()
@@ -75,34 +133,117 @@ func New(cfg *config.Config) (*Server, error) {
 	return s, nil
 }
 
+// Listener is a frontend hosted alongside the LSP stdio session, sharing the
+// server's pool. Run should return once ctx is cancelled.
+type Listener interface {
+	Run(ctx context.Context) error
+}
+
+// ListenerFunc adapts a function to the Listener interface.
+type ListenerFunc func(ctx context.Context) error
+
+func (f ListenerFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+type namedListener struct {
+	name     string
+	listener Listener
+}
+
+// AddListener registers an additional frontend (e.g. an MCP transport) to run
+// alongside the LSP session. It must be called before Run.
+func (s *Server) AddListener(name string, l Listener) {
+	s.listeners = append(s.listeners, namedListener{name: name, listener: l})
+}
+
+// Run hosts the LSP stdio session, the control socket, and any added
+// listeners concurrently. When any of them exits, the rest are cancelled and
+// the pool is shut down once they have returned.
 func (s *Server) Run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	handler := NewHandler(s)
-	s.clientConn = jsonrpc.NewConn(os.Stdin, os.Stdout, handler.Handle)
+	dispatch := s.requests.newDispatcher()
+	s.clientConn = subprocess.NewConn(os.Stdin, os.Stdout, handler.Handle)
+	s.clientConn.SetDispatch(dispatch.Dispatch)
+
+	listeners := []namedListener{{name: "lsp", listener: ListenerFunc(s.clientConn.Run)}}
 
 	controlSrv, err := control.NewServer(s.cfg.SocketPath(), s.pool)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "warning: could not start control socket: %v\n", err)
 	} else {
 		s.controlSrv = controlSrv
-		go s.controlSrv.Run(ctx)
+		s.controlSrv.SetGapsProvider(s.WorkspaceGaps)
+		s.controlSrv.SetReloader(s.Reload)
+		s.controlSrv.SetDumper(s.dumpState)
+		s.controlSrv.SetStateProvider(
+			func(withText bool) any { return s.ExportState(withText) },
+			func(data []byte) (any, error) { return s.LoadState(data) },
+		)
+		listeners = append(listeners, namedListener{name: "control", listener: s.controlSrv})
+	}
+
+	listeners = append(listeners, namedListener{name: "signals", listener: ListenerFunc(s.handleSignals)})
+	listeners = append(listeners, namedListener{name: "idle", listener: ListenerFunc(s.stopIdleBackends)})
+	listeners = append(listeners, namedListener{name: "health", listener: ListenerFunc(s.checkBackendHealth)})
+	listeners = append(listeners, s.listeners...)
+
+	go s.prebuild(ctx)
+
+	// The group's context is cancelled by the first listener to return, so
+	// every listener exits with it; errListenerDone marks a clean exit.
+	g, gctx := errgroup.WithContext(ctx)
+	for _, l := range listeners {
+		l := l
+		g.Go(func() error {
+			if err := runListener(gctx, l.listener); err != nil {
+				return fmt.Errorf("%s: %w", l.name, err)
+			}
+			return errListenerDone
+		})
+	}
+	g.Go(func() error {
+		select {
+		case <-s.done:
+			return errListenerDone
+		case <-gctx.Done():
+			return nil
+		}
+	})
+
+	runErr := g.Wait()
+	if errors.Is(runErr, errListenerDone) {
+		runErr = nil
+	}
+	if runErr == nil {
+		runErr = ctx.Err()
 	}
 
-	errCh := make(chan error, 1)
-	go func() {
-		errCh <- s.clientConn.Run(ctx)
-	}()
+	// Client requests still being handled were cancelled with gctx; let them
+	// answer before the backends they are waiting on are stopped.
+	dispatch.close()
+	s.shutdown()
+	return runErr
+}
+
+// errListenerDone ends Run's group when a listener returns without error.
+var errListenerDone = errors.New("listener done")
+
+// runListener runs l until it returns or ctx is cancelled, whichever is first.
+// Listeners reading stdio may not unblock until EOF; such a listener is left
+// to finish on its own once ctx is cancelled, rather than holding up
+// shutdown.
+func runListener(ctx context.Context, l Listener) error {
+	errs := make(chan error, 1)
+	go func() { errs <- l.Run(ctx) }()
 
 	select {
-	case err := <-errCh:
-		s.shutdown()
+	case err := <-errs:
 		return err
 	case <-ctx.Done():
-		s.shutdown()
-		return ctx.Err()
-	case <-s.done:
 		return nil
 	}
 }
@@ -110,9 +251,17 @@ func (s *Server) Run(ctx context.Context) error {
 func (s *Server) shutdown() {
 	s.pool.StopAll()
 
+	if s.usage != nil {
+		if err := s.usage.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not save usage stats: %v\n", err)
+		}
+	}
+
 	if s.controlSrv != nil {
 		s.controlSrv.Close()
 	}
+
+	s.plugins.close()
 }
 
 func (s *Server) Close() {
@@ -124,26 +273,265 @@ func (s *Server) Pool() *subprocess.Pool {
 }
 
 func (s *Server) Router() *Router {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.router
 }
 
+// IsOpenInEditor reports whether the LSP client has uri open.
+func (s *Server) IsOpenInEditor(uri lsp.DocumentURI) bool {
+	return s.Router().GetLanguageID(uri) != ""
+}
+
 func (s *Server) reloadPool(cfg *config.Config) error {
 	s.cfg = cfg
 
 	// Re-register all LSPs with updated config
 	for _, l := range cfg.LSPs {
-		// Convert config.CapabilityOverride to subprocess.CapabilityOverride
-		var capOverrides *subprocess.CapabilityOverride
-		if l.Capabilities != nil {
-			capOverrides = &subprocess.CapabilityOverride{
-				Disable: l.Capabilities.Disable,
-				Enable:  l.Capabilities.Enable,
+		s.registerLSP(l)
+	}
+
+	return nil
+}
+
+// scanWorkspace reports source files in projectRoot that no configured LSP
+// handles, logging suggestions from the built-in registry and keeping the
+// results for the control socket.
+func (s *Server) scanWorkspace(projectRoot string) {
+	s.mu.RLock()
+	cfg := s.cfg
+	s.mu.RUnlock()
+
+	gaps, err := config.ScanWorkspace(projectRoot, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] workspace scan failed: %v\n", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.gaps = gaps
+	s.mu.Unlock()
+
+	for _, gap := range gaps {
+		msg := fmt.Sprintf("lux: %s", gap)
+		fmt.Fprintf(os.Stderr, "[lux] %s\n", gap)
+		if s.clientConn != nil {
+			s.clientConn.Notify(lsp.MethodWindowLogMessage, lsp.ShowMessageParams{
+				Type:    lsp.MessageTypeInfo,
+				Message: msg,
+			})
+		}
+	}
+}
+
+// WorkspaceGaps returns the results of the most recent workspace scan.
+func (s *Server) WorkspaceGaps() []config.WorkspaceGap {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.gaps
+}
+
+func (s *Server) registerLSP(l config.LSP) {
+	s.registerInstance(l.Name, l)
+}
+
+// registerInstance registers l with the pool under name, which differs from
+// l.Name for per-folder instances. An LSP the pool can't run is left
+// unregistered with a warning.
+func (s *Server) registerInstance(name string, l config.LSP) {
+	r, err := NewRegistration(l)
+	if err == nil {
+		r.Requires = func() error { return s.checkRequirements(name) }
+		err = s.pool.Register(name, r)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", name, err)
+	}
+}
+
+// NewRegistration converts l to what the pool needs to start its server.
+// The LSP server, the MCP server and `lux check` all register through it.
+func NewRegistration(l config.LSP) (subprocess.Registration, error) {
+	memory, cpus, err := l.ResourceLimits()
+	if err != nil {
+		return subprocess.Registration{}, err
+	}
+
+	var capOverrides *subprocess.CapabilityOverride
+	if l.Capabilities != nil {
+		capOverrides = &subprocess.CapabilityOverride{
+			Disable: l.Capabilities.Disable,
+			Enable:  l.Capabilities.Enable,
+		}
+	}
+	var mappings []subprocess.PathMapping
+	for _, m := range l.PathMappings {
+		mappings = append(mappings, subprocess.PathMapping(m))
+	}
+	kind, address := l.BackendTransport()
+
+	return subprocess.Registration{
+		Flake:        l.Flake,
+		Binary:       l.Binary,
+		Args:         l.Args,
+		Env:          l.Env,
+		InitOptions:  l.InitOptions,
+		Settings:     l.Settings,
+		SettingsKey:  l.SettingsWireKey(),
+		CapOverrides: capOverrides,
+		Framing:      l.Framing,
+		InitSettings: l.SettingsInInitOptions,
+		PathMappings: mappings,
+		Remote:       l.Remote,
+		Command:      l.Command,
+		Transport:    subprocess.Transport{Kind: kind, Address: address},
+		Limits:       subprocess.Limits{Memory: memory, CPUs: cpus},
+	}, nil
+}
+
+// Reload re-reads the configuration (merged with the project config when a
+// project root is known) and applies the differences: removed LSPs are
+// stopped, changed ones are restarted lazily, settings-only changes are pushed
+// to running servers, and file matchers are rebuilt.
+func (s *Server) Reload() (config.Diff, error) {
+	s.mu.RLock()
+	projectRoot := s.projectRoot
+	oldCfg := s.cfg
+	s.mu.RUnlock()
+
+	var cfg *config.Config
+	var err error
+	if projectRoot != "" {
+		cfg, err = config.LoadWithProject(projectRoot)
+	} else {
+		cfg, err = config.Load()
+	}
+	if err != nil {
+		return config.Diff{}, fmt.Errorf("loading config: %w", err)
+	}
+
+	router, err := NewRouter(cfg)
+	if err != nil {
+		return config.Diff{}, fmt.Errorf("creating router: %w", err)
+	}
+	if projectRoot != "" {
+		if err := router.LoadOwnerRoutes(projectRoot); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+
+	diff := config.DiffConfigs(oldCfg, cfg)
+
+	for _, name := range diff.Removed {
+		for _, inst := range append([]string{name}, s.folderInstances(name)...) {
+			if err := s.pool.Unregister(inst); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: stopping removed LSP %s: %v\n", inst, err)
 			}
+			s.forgetDiagnostics(inst)
 		}
-		s.pool.Register(l.Name, l.Flake, l.Binary, l.Args, l.Env, l.InitOptions, l.Settings, l.SettingsWireKey(), capOverrides)
 	}
 
-	return nil
+	for _, name := range diff.Changed {
+		// Per-folder instances are registered again when next needed.
+		for _, inst := range s.folderInstances(name) {
+			if err := s.pool.Unregister(inst); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: stopping changed LSP %s: %v\n", inst, err)
+			}
+			s.forgetDiagnostics(inst)
+		}
+		if err := s.pool.Stop(name); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: stopping changed LSP %s: %v\n", name, err)
+		}
+		s.forgetDiagnostics(name)
+		s.registerLSP(*cfg.FindLSP(name))
+	}
+
+	for _, name := range diff.Added {
+		s.registerLSP(*cfg.FindLSP(name))
+	}
+
+	for _, name := range diff.SettingsChanged {
+		l := cfg.FindLSP(name)
+		for _, inst := range append([]string{name}, s.folderInstances(name)...) {
+			if err := s.pool.UpdateSettings(inst, l.Settings, l.SettingsWireKey()); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: updating settings for %s: %v\n", inst, err)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	router.inheritLanguages(s.router)
+	s.router = router
+	s.cfg = cfg
+	s.mu.Unlock()
+
+	s.requests.setLimits(cfg)
+	s.responses.PurgeAll()
+
+	return diff, nil
+}
+
+// applyDiagnosticConfig is ApplyDiagnosticConfig with lspName's config.
+func (s *Server) applyDiagnosticConfig(lspName string, uri lsp.DocumentURI, params json.RawMessage) json.RawMessage {
+	return ApplyDiagnosticConfig(s.lspConfig(lspName), uri, params)
+}
+
+// publishDiagnostics merges a backend's diagnostics with those of other
+// servers reporting on the same URI and forwards the combined list. Those a
+// backend publishes while shown other text for the URI are dropped.
+func (s *Server) publishDiagnostics(lspName string, params json.RawMessage) {
+	var p struct {
+		URI lsp.DocumentURI `json:"uri"`
+	}
+	json.Unmarshal(params, &p)
+	if s.documents.swapped(lspName, p.URI) {
+		return
+	}
+	params = s.applyDiagnosticConfig(lspName, p.URI, params)
+
+	merged, err := s.diagnostics.update(lspName, params)
+	if err != nil {
+		merged = params
+	}
+
+	if s.clientConn != nil {
+		s.clientConn.Notify(lsp.MethodTextDocumentPublishDiagnostics, merged)
+	}
+}
+
+func (s *Server) forgetDiagnostics(lspName string) {
+	for _, params := range s.diagnostics.forget(lspName) {
+		if s.clientConn != nil {
+			s.clientConn.Notify(lsp.MethodTextDocumentPublishDiagnostics, params)
+		}
+	}
+}
+
+// onRestart is the pool's OnRestart hook: a server the pool restarted after
+// a crash is sent the documents it had open.
+func (s *Server) onRestart(e subprocess.LifecycleEvent) {
+	inst, ok := s.pool.Get(e.Name)
+	if !ok {
+		return
+	}
+	if err := s.replayDocuments(e.Name, inst); err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] replaying open documents to %s: %v\n", e.Name, err)
+	}
+}
+
+// replayDocuments sends inst didOpen for the open documents routed to lspName
+// that it hasn't seen, so requests about them have context even if the
+// server started (or restarted) after they were opened.
+func (s *Server) replayDocuments(lspName string, inst *subprocess.LSPInstance) error {
+	router := s.Router()
+	return s.documents.replay(lspName, inst, func(uri lsp.DocumentURI) bool {
+		for _, name := range router.matchAll(uri) {
+			if s.backendName(name, uri) == lspName {
+				return true
+			}
+		}
+		return false
+	})
 }
 
 func (s *Server) FormatterRouter() *formatter.Router {
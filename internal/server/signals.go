@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// inflightRequest is a client request currently being forwarded to an LSP.
+type inflightRequest struct {
+	Server  string
+	Method  string
+	Started time.Time
+}
+
+type inflightTracker struct {
+	next uint64
+	reqs map[uint64]inflightRequest
+	mu   sync.Mutex
+}
+
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{reqs: make(map[uint64]inflightRequest)}
+}
+
+// begin records a request and returns a func that removes it again.
+func (t *inflightTracker) begin(server, method string) func() {
+	t.mu.Lock()
+	id := t.next
+	t.next++
+	t.reqs[id] = inflightRequest{Server: server, Method: method, Started: time.Now()}
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		delete(t.reqs, id)
+		t.mu.Unlock()
+	}
+}
+
+func (t *inflightTracker) snapshot() []inflightRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reqs := make([]inflightRequest, 0, len(t.reqs))
+	for _, r := range t.reqs {
+		reqs = append(reqs, r)
+	}
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].Started.Before(reqs[j].Started)
+	})
+	return reqs
+}
+
+// handleSignals reloads the config on SIGHUP and dumps a state report to
+// stderr on SIGUSR1, so a stuck daemon can be inspected even when the
+// control socket is unusable. SIGINT and SIGTERM end Run, which stops the
+// backends rather than leaving them orphaned.
+func (s *Server) handleSignals(ctx context.Context) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig := <-sigs:
+			switch sig {
+			case syscall.SIGHUP:
+				diff, err := s.Reload()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "[lux] reload failed: %v\n", err)
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "[lux] config reloaded: %+v\n", diff)
+			case syscall.SIGUSR1:
+				s.dumpState(os.Stderr)
+			case syscall.SIGINT, syscall.SIGTERM:
+				fmt.Fprintf(os.Stderr, "[lux] %v received, shutting down\n", sig)
+				return nil
+			}
+		}
+	}
+}
+
+func (s *Server) dumpState(w io.Writer) {
+	now := time.Now()
+
+	fmt.Fprintf(w, "[lux] state dump at %s\n", now.Format(time.RFC3339))
+	fmt.Fprintf(w, "  goroutines: %d\n", runtime.NumGoroutine())
+
+	statuses := s.pool.Status()
+	fmt.Fprintf(w, "  instances: %d\n", len(statuses))
+	for _, st := range statuses {
+		line := fmt.Sprintf("    %s: %s", st.Name, st.State)
+		if !st.StartedAt.IsZero() {
+			line += fmt.Sprintf(" (up %s)", now.Sub(st.StartedAt).Round(time.Second))
+		}
+		if st.Error != "" {
+			line += fmt.Sprintf(" error=%q", st.Error)
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	docs := s.Router().OpenDocuments()
+	fmt.Fprintf(w, "  open documents: %d\n", len(docs))
+	for _, uri := range docs {
+		fmt.Fprintf(w, "    %s\n", uri)
+	}
+
+	reqs := s.inflight.snapshot()
+	fmt.Fprintf(w, "  in-flight requests: %d\n", len(reqs))
+	for _, r := range reqs {
+		fmt.Fprintf(w, "    %s -> %s (%s)\n", r.Method, r.Server, now.Sub(r.Started).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// State is a snapshot of what a server routes by: its workspace folders,
+// the documents the client has open and the backends each goes to, the
+// capabilities of running backends, and the owners of code action commands.
+// "lux state dump" writes one from a user's server and "lux state load"
+// feeds it to a test instance, so routing anomalies in bug reports can be
+// reproduced deterministically.
+type State struct {
+	DumpedAt    time.Time         `json:"dumped_at"`
+	ProjectRoot string            `json:"project_root,omitempty"`
+	Folders     []string          `json:"folders,omitempty"`
+	Documents   []DocumentState   `json:"documents"`
+	Servers     []ServerState     `json:"servers"`
+	Commands    map[string]string `json:"commands,omitempty"`
+}
+
+// DocumentState is an open document and the backends it routed to, primary
+// first. Its text, which may be private, is only dumped on request; Length
+// is its size in bytes either way.
+type DocumentState struct {
+	URI        lsp.DocumentURI `json:"uri"`
+	LanguageID string          `json:"language_id,omitempty"`
+	Version    int             `json:"version"`
+	Length     int             `json:"length"`
+	Text       string          `json:"text,omitempty"`
+	Routes     []string        `json:"routes"`
+}
+
+// ServerState is a backend instance and, if it is running, the
+// capabilities it advertised.
+type ServerState struct {
+	Name         string                  `json:"name"`
+	State        string                  `json:"state"`
+	Capabilities *lsp.ServerCapabilities `json:"capabilities,omitempty"`
+}
+
+// RouteMismatch is a loaded document that routes differently than it did
+// in the dumped server.
+type RouteMismatch struct {
+	URI    lsp.DocumentURI `json:"uri"`
+	Dumped []string        `json:"dumped"`
+	Loaded []string        `json:"loaded"`
+}
+
+// documentRoutes returns the backends uri routes to, primary first, without
+// registering per-folder instances.
+func (s *Server) documentRoutes(uri lsp.DocumentURI) []string {
+	routes := []string{}
+	for _, name := range s.Router().matchAll(uri) {
+		routes = append(routes, s.backendName(name, uri))
+	}
+	return routes
+}
+
+// ExportState snapshots the server's routing state, with the text of open
+// documents if withText is set.
+func (s *Server) ExportState(withText bool) State {
+	s.mu.RLock()
+	state := State{
+		DumpedAt:    time.Now(),
+		ProjectRoot: s.projectRoot,
+		Folders:     append([]string(nil), s.folders...),
+	}
+	s.mu.RUnlock()
+
+	router := s.Router()
+	for uri, doc := range s.documents.snapshot() {
+		languageID := doc.languageID
+		if languageID == "" {
+			languageID = router.GetLanguageID(uri)
+		}
+		dumped := DocumentState{
+			URI:        uri,
+			LanguageID: languageID,
+			Version:    doc.version,
+			Length:     len(doc.text),
+			Routes:     s.documentRoutes(uri),
+		}
+		if withText {
+			dumped.Text = doc.text
+		}
+		state.Documents = append(state.Documents, dumped)
+	}
+	sort.Slice(state.Documents, func(i, j int) bool {
+		return state.Documents[i].URI < state.Documents[j].URI
+	})
+
+	for _, status := range s.pool.Status() {
+		server := ServerState{Name: status.Name, State: status.State}
+		if inst, ok := s.pool.Get(status.Name); ok {
+			server.Capabilities = inst.Capabilities
+		}
+		state.Servers = append(state.Servers, server)
+	}
+
+	state.Commands = s.commands.offeredCommands()
+	return state
+}
+
+// ImportState opens the documents in state as if the client had, empty if
+// they were dumped without their text, and takes over its workspace folders
+// and command owners. Backends are started as
+// usual when requests arrive, so their capabilities are their own rather
+// than the dumped ones. It returns the documents that route differently
+// here than they did in the dumped server.
+func (s *Server) ImportState(state State) ([]RouteMismatch, error) {
+	s.mu.Lock()
+	s.projectRoot = state.ProjectRoot
+	s.folders = append([]string(nil), state.Folders...)
+	s.mu.Unlock()
+
+	router := s.Router()
+	for _, doc := range state.Documents {
+		params, err := json.Marshal(lsp.DidOpenTextDocumentParams{
+			TextDocument: lsp.TextDocumentItem{
+				URI:        doc.URI,
+				LanguageID: doc.LanguageID,
+				Version:    doc.Version,
+				Text:       doc.Text,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", doc.URI, err)
+		}
+		router.track(lsp.MethodTextDocumentDidOpen, params)
+		s.documents.apply(lsp.MethodTextDocumentDidOpen, params)
+	}
+	s.responses.PurgeAll()
+
+	for command, server := range state.Commands {
+		s.commands.record(command, server)
+	}
+
+	var mismatches []RouteMismatch
+	for _, doc := range state.Documents {
+		if routes := s.documentRoutes(doc.URI); !reflect.DeepEqual(routes, doc.Routes) {
+			mismatches = append(mismatches, RouteMismatch{URI: doc.URI, Dumped: doc.Routes, Loaded: routes})
+		}
+	}
+	return mismatches, nil
+}
+
+// LoadState is ImportState for a state dump's JSON.
+func (s *Server) LoadState(data []byte) ([]RouteMismatch, error) {
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing state: %w", err)
+	}
+	return s.ImportState(state)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func newStateTestServer(t *testing.T, lsps ...config.LSP) *Server {
+	t.Helper()
+	cfg := &config.Config{LSPs: lsps}
+	router, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		cfg:       cfg,
+		router:    router,
+		documents: newDocumentStore(),
+		responses: NewResponseCache(),
+		commands:  newCommandOwners(),
+		pool:      subprocess.NewPool(nil, nil),
+	}
+	for _, l := range lsps {
+		s.registerLSP(l)
+	}
+	return s
+}
+
+func TestServer_StateRoundTrip(t *testing.T) {
+	gopls := config.LSP{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}, LanguageIDs: []string{"go"}}
+	jdtls := config.LSP{Name: "jdtls", Flake: "nixpkgs#jdt-language-server", Extensions: []string{"java"}, PerFolder: true}
+
+	dumped := newStateTestServer(t, gopls, jdtls)
+	dumped.folders = []string{"/ws/app"}
+	for _, doc := range []lsp.TextDocumentItem{
+		{URI: "file:///ws/app/main.go", LanguageID: "go", Version: 2, Text: "package main"},
+		{URI: "file:///ws/app/Main.java", LanguageID: "java", Version: 1, Text: "class Main {}"},
+		{URI: "file:///ws/app/build", LanguageID: "go", Version: 1, Text: "package build"},
+	} {
+		params, _ := json.Marshal(lsp.DidOpenTextDocumentParams{TextDocument: doc})
+		dumped.Router().Route(lsp.MethodTextDocumentDidOpen, params)
+		dumped.documents.apply(lsp.MethodTextDocumentDidOpen, params)
+	}
+	dumped.commands.record("gopls.tidy", "gopls")
+
+	data, err := json.Marshal(dumped.ExportState(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newStateTestServer(t, gopls, jdtls)
+	mismatches, err := loaded.LoadState(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("expected no mismatches, got %+v", mismatches)
+	}
+
+	if got := loaded.route(lsp.MethodTextDocumentHover, json.RawMessage(`{"textDocument":{"uri":"file:///ws/app/build"}}`)); got != "gopls" {
+		t.Errorf("expected the loaded language ID to route to %q, got %q", "gopls", got)
+	}
+	if got := loaded.route(lsp.MethodTextDocumentHover, json.RawMessage(`{"textDocument":{"uri":"file:///ws/app/Main.java"}}`)); got != "jdtls@/ws/app" {
+		t.Errorf("expected the loaded folders to route to %q, got %q", "jdtls@/ws/app", got)
+	}
+	if text, _ := loaded.documents.text("file:///ws/app/main.go"); text != "package main" {
+		t.Errorf("expected %q, got %q", "package main", text)
+	}
+	if owner, _ := loaded.commands.owner("gopls.tidy"); owner != "gopls" {
+		t.Errorf("expected %q, got %q", "gopls", owner)
+	}
+}
+
+func TestServer_ExportStateWithoutText(t *testing.T) {
+	s := newStateTestServer(t, config.LSP{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}})
+	s.documents.apply(lsp.MethodTextDocumentDidOpen, json.RawMessage(`{"textDocument":{"uri":"file:///a.go","languageId":"go","version":3,"text":"package a"}}`))
+
+	docs := s.ExportState(false).Documents
+	if len(docs) != 1 || docs[0].Text != "" || docs[0].Version != 3 || docs[0].Length != len("package a") {
+		t.Errorf("expected the document's version and length without its text, got %+v", docs)
+	}
+}
+
+func TestServer_ImportStateReportsMismatches(t *testing.T) {
+	s := newStateTestServer(t, config.LSP{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}})
+
+	mismatches, err := s.ImportState(State{Documents: []DocumentState{
+		{URI: "file:///a.go", Version: 1, Routes: []string{"gopls"}},
+		{URI: "file:///a.rs", Version: 1, Routes: []string{"rust-analyzer"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []RouteMismatch{{URI: "file:///a.rs", Dumped: []string{"rust-analyzer"}, Loaded: []string{}}}
+	if !reflect.DeepEqual(mismatches, expected) {
+		t.Errorf("expected %+v, got %+v", expected, mismatches)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+// taggedWorkspaceSymbol is tagOrigin for an encoded symbol.
+// Symbols that aren't objects are returned as they are.
+func taggedWorkspaceSymbol(sym json.RawMessage, server string) json.RawMessage {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(sym, &obj); err != nil || obj == nil {
+		return sym
+	}
+	tagOrigin(obj, server)
+	tagged, err := json.Marshal(obj)
+	if err != nil {
+		return sym
+	}
+	return tagged
+}
+
+// handleWorkspaceSymbolResolve routes workspaceSymbol/resolve to the server
+// that produced the symbol. A symbol lux didn't tag has no document to
+// route by either, so it is handed back as it is.
+func (h *Handler) handleWorkspaceSymbolResolve(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	var sym map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &sym); err != nil || sym == nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams, "invalid params", nil)
+	}
+
+	lspName, ok := untagOrigin(sym)
+	if !ok {
+		return jsonrpc.NewResponse(*msg.ID, sym)
+	}
+
+	inst, err := h.startInstance(ctx, lspName, true)
+	if err != nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
+			fmt.Sprintf("starting LSP %s: %v", lspName, err), nil)
+	}
+
+	// Nothing to resolve; hand the symbol back as the server produced it.
+	if !h.server.supportsMethod(inst, msg.Method) {
+		tagOrigin(sym, lspName)
+		return jsonrpc.NewResponse(*msg.ID, sym)
+	}
+
+	result, err := h.server.call(ctx, lspName, inst, msg.Method, sym)
+	if err != nil {
+		return callErrorResponse(*msg.ID, err)
+	}
+
+	var resolved map[string]json.RawMessage
+	if err := json.Unmarshal(result, &resolved); err != nil || resolved == nil {
+		tagOrigin(sym, lspName)
+		return jsonrpc.NewResponse(*msg.ID, sym)
+	}
+	tagOrigin(resolved, lspName)
+	return jsonrpc.NewResponse(*msg.ID, resolved)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+// requestExtension is lux's namespace in request params. Clients set
+// lux.target to name the LSP that should answer a request, bypassing
+// routing.
+type requestExtension struct {
+	Target string `json:"target"`
+}
+
+// requestTarget returns the LSP named by params' lux.target, and params with
+// the lux field stripped so servers never see it. ok is false if params has
+// no lux field.
+func requestTarget(params json.RawMessage) (target string, stripped json.RawMessage, ok bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(params, &fields); err != nil {
+		return "", params, false
+	}
+	raw, ok := fields["lux"]
+	if !ok {
+		return "", params, false
+	}
+
+	var ext requestExtension
+	json.Unmarshal(raw, &ext)
+	delete(fields, "lux")
+	stripped, err := json.Marshal(fields)
+	if err != nil {
+		return "", params, false
+	}
+	return ext.Target, stripped, true
+}
+
+// handleTargeted sends msg to the LSP the client named, without merging
+// answers from other servers or falling back to them.
+func (h *Handler) handleTargeted(ctx context.Context, msg *jsonrpc.Message, target string) (*jsonrpc.Message, error) {
+	if h.server.lspConfig(target) == nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams,
+			fmt.Sprintf("unknown LSP %q in lux.target", target), nil)
+	}
+	lspName := h.server.backendFor(target, documentURI(msg.Params))
+
+	inst, err := h.startInstance(ctx, lspName, true)
+	if err != nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
+			fmt.Sprintf("starting LSP %s: %v", lspName, err), nil)
+	}
+
+	h.server.checkMethodSupported(inst, msg.Method)
+
+	result, err := h.server.call(ctx, lspName, inst, msg.Method, msg.Params)
+	if err != nil {
+		return callErrorResponse(*msg.ID, err)
+	}
+
+	resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+	resp.Result = h.server.tagForFollowUp(msg.Method, result, lspName)
+	return resp, nil
+}
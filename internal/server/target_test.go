@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRequestTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   string
+		target   string
+		stripped string
+		ok       bool
+	}{
+		{
+			name:     "target named",
+			params:   `{"textDocument":{"uri":"file:///a.go"},"lux":{"target":"gopls"}}`,
+			target:   "gopls",
+			stripped: `{"textDocument":{"uri":"file:///a.go"}}`,
+			ok:       true,
+		},
+		{
+			name:     "empty extension",
+			params:   `{"textDocument":{"uri":"file:///a.go"},"lux":{}}`,
+			stripped: `{"textDocument":{"uri":"file:///a.go"}}`,
+			ok:       true,
+		},
+		{
+			name:     "no extension",
+			params:   `{"textDocument":{"uri":"file:///a.go"}}`,
+			stripped: `{"textDocument":{"uri":"file:///a.go"}}`,
+		},
+		{
+			name:     "array params",
+			params:   `[1,2]`,
+			stripped: `[1,2]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, stripped, ok := requestTarget(json.RawMessage(tt.params))
+			if target != tt.target || ok != tt.ok {
+				t.Errorf("expected %q (%v), got %q (%v)", tt.target, tt.ok, target, ok)
+			}
+			if string(stripped) != tt.stripped {
+				t.Errorf("expected %s, got %s", tt.stripped, stripped)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// handleTelemetry applies telemetry_mode to a telemetry/event from lspName:
+// it is forwarded to the client as the backend sent it, dropped, or written
+// to lux's log with the backend's name.
+func (s *Server) handleTelemetry(lspName string, params json.RawMessage) {
+	s.mu.RLock()
+	policy := s.cfg.TelemetryPolicy()
+	s.mu.RUnlock()
+
+	switch policy {
+	case config.TelemetryModeDrop:
+	case config.TelemetryModeLog:
+		fmt.Fprintf(os.Stderr, "[lux] telemetry from %s: %s\n", lspName, params)
+	default:
+		if s.clientConn != nil {
+			s.clientConn.Notify(lsp.MethodTelemetryEvent, params)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestHandleTelemetry(t *testing.T) {
+	tests := []struct {
+		mode      string
+		forwarded bool
+	}{
+		{"", true},
+		{config.TelemetryModeForward, true},
+		{config.TelemetryModeDrop, false},
+		{config.TelemetryModeLog, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			s := &Server{cfg: &config.Config{TelemetryMode: tt.mode}}
+			received := fakeClient(t, s, func(msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+				return nil, nil
+			})
+
+			s.handleTelemetry("gopls", json.RawMessage(`{"event":"indexed","files":120}`))
+			// The marker is sent after the event; once it has arrived, so
+			// has any forwarded event.
+			s.clientConn.Notify(lsp.MethodWindowLogMessage, lsp.ShowMessageParams{Type: lsp.MessageTypeLog, Message: "marker"})
+
+			forwarded := false
+			for seen := 0; seen < 2; seen++ {
+				var msg *jsonrpc.Message
+				select {
+				case msg = <-received:
+				case <-time.After(50 * time.Millisecond):
+				}
+				if msg == nil {
+					break
+				}
+				if msg.Method == lsp.MethodTelemetryEvent {
+					forwarded = true
+					if string(msg.Params) != `{"event":"indexed","files":120}` {
+						t.Errorf("expected the event unchanged, got %s", msg.Params)
+					}
+				}
+			}
+			if forwarded != tt.forwarded {
+				t.Errorf("expected forwarded: %v, got %v", tt.forwarded, forwarded)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// transforms returns the transform rules for method to lspName in direction,
+// in config order.
+func (s *Server) transforms(lspName, method, direction string) []config.Transform {
+	name, _ := splitInstanceName(lspName)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cfg == nil {
+		return nil
+	}
+
+	var rules []config.Transform
+	for _, t := range s.cfg.Transforms {
+		if t.Method == method && (t.Server == "" || t.Server == name) && t.TransformDirection() == direction {
+			rules = append(rules, t)
+		}
+	}
+	return rules
+}
+
+// applyTransforms rewrites payload, the params or result of a message, with
+// rules. It reports dropped if a rule removed the payload as a whole.
+func applyTransforms(rules []config.Transform, payload json.RawMessage) (result json.RawMessage, dropped bool) {
+	var doc any
+	if len(payload) > 0 {
+		var err error
+		if doc, err = decodeJSON(payload); err != nil {
+			return payload, false
+		}
+	}
+
+	for _, t := range rules {
+		rule, err := compileTransform(t)
+		if err != nil {
+			continue
+		}
+		if doc, dropped = rule.at(doc, t.PathSegments()); dropped {
+			return nil, true
+		}
+	}
+
+	result, err := json.Marshal(doc)
+	if err != nil {
+		return payload, false
+	}
+	return result, false
+}
+
+// transformRule is a Transform with its match and value as decoded JSON.
+type transformRule struct {
+	action string
+	match  any
+	value  json.RawMessage
+}
+
+func compileTransform(t config.Transform) (*transformRule, error) {
+	rule := &transformRule{action: t.Action}
+	if t.Match != nil {
+		raw, err := json.Marshal(t.Match)
+		if err != nil {
+			return nil, err
+		}
+		if rule.match, err = decodeJSON(raw); err != nil {
+			return nil, err
+		}
+	}
+	if t.Value != nil {
+		raw, err := json.Marshal(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		rule.value = raw
+	}
+	return rule, nil
+}
+
+// at applies the rule to the values at path under v. It returns v as
+// rewritten, and whether v itself was dropped.
+func (r *transformRule) at(v any, path []string) (any, bool) {
+	if len(path) == 0 {
+		return r.apply(v, true)
+	}
+
+	switch node := v.(type) {
+	case map[string]any:
+		child, ok := node[path[0]]
+		if !ok && len(path) > 1 {
+			return node, false
+		}
+		if !ok {
+			if child, dropped := r.apply(nil, false); !dropped && child != nil {
+				node[path[0]] = child
+			}
+			return node, false
+		}
+		if child, dropped := r.at(child, path[1:]); dropped {
+			delete(node, path[0])
+		} else {
+			node[path[0]] = child
+		}
+		return node, false
+
+	case []any:
+		if path[0] == "*" {
+			kept := make([]any, 0, len(node))
+			for _, elem := range node {
+				if elem, dropped := r.at(elem, path[1:]); !dropped {
+					kept = append(kept, elem)
+				}
+			}
+			return kept, false
+		}
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(node) {
+			return node, false
+		}
+		elem, dropped := r.at(node[i], path[1:])
+		if dropped {
+			return append(node[:i:i], node[i+1:]...), false
+		}
+		node[i] = elem
+		return node, false
+	}
+	return v, false
+}
+
+// apply acts on v, a value the path selected, or nil with exists false if
+// the path's last key is missing.
+func (r *transformRule) apply(v any, exists bool) (any, bool) {
+	if r.match != nil && (!exists || !contains(v, r.match)) {
+		return v, false
+	}
+
+	switch r.action {
+	case config.TransformDrop:
+		return nil, exists
+	case config.TransformSet:
+		return r.newValue(v), false
+	case config.TransformDefault:
+		if v == nil {
+			return r.newValue(v), false
+		}
+	}
+	return v, false
+}
+
+// newValue decodes a fresh copy of the rule's value, so the values placed at
+// different paths don't share state, or returns v if there is none.
+func (r *transformRule) newValue(v any) any {
+	value, err := decodeJSON(r.value)
+	if err != nil {
+		return v
+	}
+	return value
+}
+
+// contains reports whether v matches pattern: an object with at least
+// pattern's keys, each containing pattern's value, or a value equal to it.
+func contains(v, pattern any) bool {
+	switch p := pattern.(type) {
+	case map[string]any:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, want := range p {
+			got, ok := obj[k]
+			if !ok || !contains(got, want) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		a, errA := n.Float64()
+		b, errB := p.Float64()
+		return errA == nil && errB == nil && a == b
+	}
+	return reflect.DeepEqual(v, pattern)
+}
+
+// decodeJSON decodes raw keeping numbers as written, so IDs and versions
+// survive a round trip.
+func decodeJSON(raw json.RawMessage) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
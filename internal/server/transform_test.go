@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestApplyTransforms(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []config.Transform
+		payload  string
+		expected string
+		dropped  bool
+	}{
+		{
+			name:     "default replaces a null result",
+			rules:    []config.Transform{{Action: config.TransformDefault, Value: []any{}}},
+			payload:  `null`,
+			expected: `[]`,
+		},
+		{
+			name:     "default keeps a present value",
+			rules:    []config.Transform{{Path: "items", Action: config.TransformDefault, Value: []any{}}},
+			payload:  `{"isIncomplete":false,"items":[1]}`,
+			expected: `{"isIncomplete":false,"items":[1]}`,
+		},
+		{
+			name:     "default injects a missing field",
+			rules:    []config.Transform{{Path: "context.includeDeclaration", Action: config.TransformDefault, Value: true}},
+			payload:  `{"context":{}}`,
+			expected: `{"context":{"includeDeclaration":true}}`,
+		},
+		{
+			name:     "set rewrites every matched element",
+			rules:    []config.Transform{{Path: "*.severity", Action: config.TransformSet, Value: int64(2)}},
+			payload:  `[{"severity":1},{"severity":3}]`,
+			expected: `[{"severity":2},{"severity":2}]`,
+		},
+		{
+			name: "drop removes matching elements",
+			rules: []config.Transform{{
+				Path:   "diagnostics.*",
+				Match:  map[string]any{"source": "cSpell"},
+				Action: config.TransformDrop,
+			}},
+			payload:  `{"diagnostics":[{"source":"cSpell","code":1},{"source":"go","code":2}]}`,
+			expected: `{"diagnostics":[{"code":2,"source":"go"}]}`,
+		},
+		{
+			name:     "match compares numbers by value",
+			rules:    []config.Transform{{Path: "0.kind", Match: int64(15), Action: config.TransformSet, Value: int64(1)}},
+			payload:  `[{"kind":15.0},{"kind":15}]`,
+			expected: `[{"kind":1},{"kind":15}]`,
+		},
+		{
+			name:    "drop of the whole payload",
+			rules:   []config.Transform{{Action: config.TransformDrop}},
+			payload: `{"x":1}`,
+			dropped: true,
+		},
+		{
+			name:     "large numbers survive",
+			rules:    []config.Transform{{Path: "missing", Action: config.TransformDrop}},
+			payload:  `{"version":9007199254740993}`,
+			expected: `{"version":9007199254740993}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, dropped := applyTransforms(tt.rules, json.RawMessage(tt.payload))
+			if dropped != tt.dropped {
+				t.Fatalf("expected dropped %v, got %v", tt.dropped, dropped)
+			}
+			if !dropped && string(result) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestServer_Transforms(t *testing.T) {
+	s := &Server{cfg: &config.Config{Transforms: []config.Transform{
+		{Method: "textDocument/references", Action: config.TransformDefault, Value: []any{}},
+		{Method: "textDocument/references", Server: "pyright", Action: config.TransformDrop},
+		{Method: "textDocument/references", Direction: config.TransformRequest, Action: config.TransformDrop},
+	}}}
+
+	if rules := s.transforms("gopls", "textDocument/references", config.TransformResponse); len(rules) != 1 {
+		t.Errorf("expected 1 rule for gopls, got %d", len(rules))
+	}
+	if rules := s.transforms("pyright", "textDocument/references", config.TransformResponse); len(rules) != 2 {
+		t.Errorf("expected 2 rules for pyright, got %d", len(rules))
+	}
+	if rules := s.transforms("gopls", "textDocument/hover", config.TransformResponse); len(rules) != 0 {
+		t.Errorf("expected no rules for hover, got %d", len(rules))
+	}
+}
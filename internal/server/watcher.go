@@ -0,0 +1,558 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gobwas/glob"
+)
+
+// watchPollInterval is how often the file watcher rescans the workspace when
+// polling, and otherwise looks for new roots to watch.
+const watchPollInterval = 2 * time.Second
+
+// maxWatchFiles bounds how many files a rescan visits, like the workspace
+// scan at initialize.
+const maxWatchFiles = 20000
+
+// File change types and watch kinds from the LSP specification.
+const (
+	fileCreated = 1
+	fileChanged = 2
+	fileDeleted = 3
+
+	watchCreate = 1
+	watchChange = 2
+	watchDelete = 4
+)
+
+// fileEvent is a FileEvent of workspace/didChangeWatchedFiles.
+type fileEvent struct {
+	URI  lsp.DocumentURI `json:"uri"`
+	Type int             `json:"type"`
+}
+
+// watchPattern is one FileSystemWatcher of a server's registration.
+type watchPattern struct {
+	glob glob.Glob
+	base string // matched relative to this directory, or against the absolute path if ""
+	kind int
+}
+
+func (p watchPattern) matches(path string, change int) bool {
+	var mask int
+	switch change {
+	case fileCreated:
+		mask = watchCreate
+	case fileChanged:
+		mask = watchChange
+	case fileDeleted:
+		mask = watchDelete
+	}
+	if p.kind&mask == 0 {
+		return false
+	}
+
+	if p.base == "" {
+		return p.glob.Match(filepath.ToSlash(path))
+	}
+	rel, err := filepath.Rel(p.base, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return p.glob.Match(filepath.ToSlash(rel))
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// fileWatcher watches the workspace for file changes on behalf of servers
+// whose client can't watch files, and reports the changes each server
+// registered watchers for. It uses the platform's file notifications, and
+// falls back to polling, bounded by maxWatchFiles, where they aren't
+// available.
+type fileWatcher struct {
+	roots  func() []string
+	notify func(server string, events []fileEvent)
+
+	patterns map[string]map[string][]watchPattern // server -> registration ID -> watchers
+	snapshot map[string]fileStamp                 // nil until the first scan
+	mu       sync.Mutex
+}
+
+func newFileWatcher(roots func() []string, notify func(server string, events []fileEvent)) *fileWatcher {
+	return &fileWatcher{
+		roots:    roots,
+		notify:   notify,
+		patterns: make(map[string]map[string][]watchPattern),
+	}
+}
+
+// register adds a server's workspace/didChangeWatchedFiles registration.
+func (w *fileWatcher) register(server, id string, options json.RawMessage) error {
+	var opts struct {
+		Watchers []struct {
+			GlobPattern json.RawMessage `json:"globPattern"`
+			Kind        *int            `json:"kind,omitempty"`
+		} `json:"watchers"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return fmt.Errorf("parsing watchers: %w", err)
+	}
+
+	var patterns []watchPattern
+	for _, watcher := range opts.Watchers {
+		p, err := parseGlobPattern(watcher.GlobPattern)
+		if err != nil {
+			return err
+		}
+		p.kind = watchCreate | watchChange | watchDelete
+		if watcher.Kind != nil {
+			p.kind = *watcher.Kind
+		}
+		patterns = append(patterns, p)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.patterns[server] == nil {
+		w.patterns[server] = make(map[string][]watchPattern)
+	}
+	w.patterns[server][id] = patterns
+	return nil
+}
+
+// unregister removes a registration, reporting whether it was the watcher's.
+func (w *fileWatcher) unregister(server, id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.patterns[server][id]; !ok {
+		return false
+	}
+	delete(w.patterns[server], id)
+	return true
+}
+
+// forget drops every registration of a server, e.g. because it stopped.
+func (w *fileWatcher) forget(server string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.patterns, server)
+}
+
+// parseGlobPattern parses a GlobPattern: a pattern string, or a
+// RelativePattern whose baseUri is a URI or a WorkspaceFolder.
+func parseGlobPattern(raw json.RawMessage) (watchPattern, error) {
+	var pattern, base string
+	if err := json.Unmarshal(raw, &pattern); err != nil {
+		var relative struct {
+			BaseURI json.RawMessage `json:"baseUri"`
+			Pattern string          `json:"pattern"`
+		}
+		if err := json.Unmarshal(raw, &relative); err != nil {
+			return watchPattern{}, fmt.Errorf("invalid glob pattern %s", raw)
+		}
+		pattern = relative.Pattern
+
+		var uri lsp.DocumentURI
+		if err := json.Unmarshal(relative.BaseURI, &uri); err != nil {
+			var folder lsp.WorkspaceFolder
+			if err := json.Unmarshal(relative.BaseURI, &folder); err != nil {
+				return watchPattern{}, fmt.Errorf("invalid baseUri %s", relative.BaseURI)
+			}
+			uri = folder.URI
+		}
+		base = uri.Path()
+	}
+
+	g, err := glob.Compile(pattern, '/')
+	if err != nil {
+		return watchPattern{}, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	return watchPattern{glob: g, base: base}, nil
+}
+
+// run watches until done is closed.
+func (w *fileWatcher) run(done <-chan struct{}) {
+	notifier, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] file watcher: %v; polling instead\n", err)
+		w.runPolling(done)
+		return
+	}
+	defer notifier.Close()
+	w.runNotify(done, notifier)
+}
+
+// runPolling rescans the workspace every watchPollInterval until done is
+// closed.
+func (w *fileWatcher) runPolling(done <-chan struct{}) {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// runNotify delivers the changes notifier reports until done is closed,
+// batched over watchBatchDelay so a burst of writes, such as a branch
+// switch, reaches servers as one notification. Directories are watched once
+// some server has registered watchers, and roots added later (new workspace
+// folders) are picked up every watchPollInterval.
+func (w *fileWatcher) runNotify(done <-chan struct{}, notifier *fsnotify.Watcher) {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	batch := time.NewTimer(watchBatchDelay)
+	batch.Stop()
+
+	dirs := &watchedDirs{notifier: notifier, watched: make(map[string]bool)}
+	var pending []fileEvent
+	w.watchNewRoots(dirs)
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			w.watchNewRoots(dirs)
+		case event, ok := <-notifier.Events:
+			if !ok {
+				return
+			}
+			changes := dirs.translate(event)
+			if len(changes) > 0 && len(pending) == 0 {
+				batch.Reset(watchBatchDelay)
+			}
+			pending = append(pending, changes...)
+		case err, ok := <-notifier.Errors:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "[lux] file watcher: %v\n", err)
+		case <-batch.C:
+			w.dispatch(coalesceFileEvents(pending))
+			pending = nil
+		}
+	}
+}
+
+// watchNewRoots starts watching roots not yet watched, once some server has
+// registered watchers.
+func (w *fileWatcher) watchNewRoots(dirs *watchedDirs) {
+	w.mu.Lock()
+	watching := len(w.patterns) > 0
+	w.mu.Unlock()
+	if !watching {
+		return
+	}
+	for _, root := range w.roots() {
+		if !dirs.watched[root] {
+			dirs.add(root, nil)
+		}
+	}
+}
+
+// watchBatchDelay is how long changes are collected before servers are
+// notified of them.
+const watchBatchDelay = 100 * time.Millisecond
+
+// maxWatchDirs bounds how many directories are watched, since each takes a
+// kernel watch.
+const maxWatchDirs = 8192
+
+// watchedDirs are the directories an fsnotify watcher watches.
+type watchedDirs struct {
+	notifier *fsnotify.Watcher
+	watched  map[string]bool
+	full     bool // maxWatchDirs was reached and reported
+}
+
+// add watches dir and the directories under it, skipping hidden ones and
+// node_modules like scanFiles. If created is non-nil, the files found are
+// appended to it as created: they appeared with a new directory, before it
+// was watched.
+func (d *watchedDirs) add(dir string, created *[]fileEvent) {
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if entry != nil && entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			if created != nil {
+				*created = append(*created, fileEvent{URI: lsp.URIFromPath(path), Type: fileCreated})
+			}
+			return nil
+		}
+		if path != dir && skipWatchDir(entry.Name()) {
+			return filepath.SkipDir
+		}
+		if d.watched[path] {
+			return nil
+		}
+		if len(d.watched) >= maxWatchDirs {
+			if !d.full {
+				d.full = true
+				fmt.Fprintf(os.Stderr, "[lux] file watcher: watching the first %d directories only\n", maxWatchDirs)
+			}
+			return filepath.SkipAll
+		}
+		if err := d.notifier.Add(path); err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] file watcher: %s: %v\n", path, err)
+			return filepath.SkipDir
+		}
+		d.watched[path] = true
+		return nil
+	})
+}
+
+// translate turns an fsnotify event into file events, watching directories
+// as they are created.
+func (d *watchedDirs) translate(event fsnotify.Event) []fileEvent {
+	uri := lsp.URIFromPath(event.Name)
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Stat(event.Name)
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			return []fileEvent{{URI: uri, Type: fileCreated}}
+		}
+		if skipWatchDir(info.Name()) {
+			return nil
+		}
+		var created []fileEvent
+		d.add(event.Name, &created)
+		return created
+	case event.Has(fsnotify.Write):
+		return []fileEvent{{URI: uri, Type: fileChanged}}
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		d.forget(event.Name)
+		return []fileEvent{{URI: uri, Type: fileDeleted}}
+	}
+	return nil
+}
+
+// forget stops watching path, if it was a watched directory, and the
+// directories under it. A directory renamed within the workspace is watched
+// again under its new name when its Create arrives.
+func (d *watchedDirs) forget(path string) {
+	prefix := path + string(filepath.Separator)
+	for dir := range d.watched {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			d.notifier.Remove(dir)
+			delete(d.watched, dir)
+		}
+	}
+}
+
+// coalesceFileEvents reduces events to one per file, in the order files were
+// first seen: a file created and then written was created, one created and
+// then deleted is dropped, and one deleted and then created was changed.
+func coalesceFileEvents(events []fileEvent) []fileEvent {
+	var order []lsp.DocumentURI
+	latest := make(map[lsp.DocumentURI]int)
+	for _, e := range events {
+		prev, seen := latest[e.URI]
+		if !seen {
+			order = append(order, e.URI)
+			latest[e.URI] = e.Type
+			continue
+		}
+		switch {
+		case prev == fileCreated && e.Type == fileChanged:
+		case prev == fileCreated && e.Type == fileDeleted:
+			latest[e.URI] = 0
+		case prev == fileDeleted && e.Type == fileCreated:
+			latest[e.URI] = fileChanged
+		default:
+			latest[e.URI] = e.Type
+		}
+	}
+
+	var coalesced []fileEvent
+	for _, uri := range order {
+		if t := latest[uri]; t != 0 {
+			coalesced = append(coalesced, fileEvent{URI: uri, Type: t})
+		}
+	}
+	return coalesced
+}
+
+// poll rescans the workspace and notifies servers of changes since the last
+// scan matching their watchers. Nothing is scanned while no server has
+// registered watchers.
+func (w *fileWatcher) poll() {
+	w.mu.Lock()
+	watching := len(w.patterns) > 0
+	if !watching {
+		w.snapshot = nil
+	}
+	w.mu.Unlock()
+	if !watching {
+		return
+	}
+
+	current := scanFiles(w.roots())
+
+	w.mu.Lock()
+	previous := w.snapshot
+	w.snapshot = current
+	if previous == nil {
+		w.mu.Unlock()
+		return
+	}
+
+	var changes []fileEvent
+	for path, stamp := range current {
+		old, ok := previous[path]
+		switch {
+		case !ok:
+			changes = append(changes, fileEvent{URI: lsp.URIFromPath(path), Type: fileCreated})
+		case !old.modTime.Equal(stamp.modTime) || old.size != stamp.size:
+			changes = append(changes, fileEvent{URI: lsp.URIFromPath(path), Type: fileChanged})
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			changes = append(changes, fileEvent{URI: lsp.URIFromPath(path), Type: fileDeleted})
+		}
+	}
+
+	w.mu.Unlock()
+
+	w.dispatch(changes)
+}
+
+// dispatch notifies each server of the changes its watchers match.
+func (w *fileWatcher) dispatch(changes []fileEvent) {
+	if len(changes) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	matched := make(map[string][]fileEvent)
+	for server, registrations := range w.patterns {
+		for _, change := range changes {
+			if matchesAny(registrations, change.URI.Path(), change.Type) {
+				matched[server] = append(matched[server], change)
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	for server, events := range matched {
+		w.notify(server, events)
+	}
+}
+
+func matchesAny(registrations map[string][]watchPattern, path string, change int) bool {
+	for _, patterns := range registrations {
+		for _, p := range patterns {
+			if p.matches(path, change) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scanFiles stamps every file under roots, skipping hidden directories and
+// node_modules.
+func scanFiles(roots []string) map[string]fileStamp {
+	files := make(map[string]fileStamp)
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && skipWatchDir(d.Name()) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if len(files) >= maxWatchFiles {
+				return filepath.SkipAll
+			}
+			if info, err := d.Info(); err == nil {
+				files[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// skipWatchDir reports whether a directory is left out of watching: hidden
+// directories, such as .git, and node_modules.
+func skipWatchDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "node_modules"
+}
+
+// watchRoots returns the directories the file watcher scans: the workspace
+// folders, or the project root.
+func (s *Server) watchRoots() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.folders) > 0 {
+		return append([]string(nil), s.folders...)
+	}
+	if s.projectRoot != "" {
+		return []string{s.projectRoot}
+	}
+	return nil
+}
+
+// notifyWatchedFiles sends a server the changes its watchers matched.
+func (s *Server) notifyWatchedFiles(server string, events []fileEvent) {
+	inst, ok := s.pool.Get(server)
+	if !ok {
+		return
+	}
+	for _, event := range events {
+		s.responses.Purge(event.URI)
+	}
+	if err := inst.Notify(lsp.MethodWorkspaceDidChangeWatchedFiles, map[string]any{"changes": events}); err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] didChangeWatchedFiles to %s: %v\n", server, err)
+	}
+}
+
+func clientWatchesFiles(params *lsp.InitializeParams) bool {
+	workspace := params.Capabilities.Workspace
+	return workspace != nil && workspace.DidChangeWatchedFiles != nil && workspace.DidChangeWatchedFiles.DynamicRegistration
+}
+
+// advertiseWatchedFiles claims file watching support in the initialize params
+// passed to backends, since lux watches for them.
+func advertiseWatchedFiles(params *lsp.InitializeParams) {
+	if params.Capabilities.Workspace == nil {
+		params.Capabilities.Workspace = &lsp.WorkspaceClientCapabilities{}
+	}
+	params.Capabilities.Workspace.DidChangeWatchedFiles = &lsp.DidChangeWatchedFilesCaps{DynamicRegistration: true}
+}
+
+func (s *Server) fileWatcher() *fileWatcher {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.watcher
+}
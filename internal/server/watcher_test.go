@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestFileWatcher(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.go", "package a")
+	write("go.mod", "module a")
+
+	received := make(map[string][]fileEvent)
+	w := newFileWatcher(
+		func() []string { return []string{root} },
+		func(server string, events []fileEvent) { received[server] = append(received[server], events...) },
+	)
+
+	if err := w.register("gopls", "1", json.RawMessage(`{"watchers":[{"globPattern":"**/*.go"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	relative := `{"watchers":[{"globPattern":{"baseUri":"` + string(lsp.URIFromPath(root)) + `","pattern":"go.mod"},"kind":4}]}`
+	if err := w.register("gomod", "1", json.RawMessage(relative)); err != nil {
+		t.Fatal(err)
+	}
+
+	w.poll()
+	if len(received) != 0 {
+		t.Fatalf("expected the first scan to be a baseline, got %v", received)
+	}
+
+	write("a.go", "package a\n\nfunc A() {}\n")
+	write("b.go", "package a")
+	write("notes.txt", "")
+	os.Remove(filepath.Join(root, "go.mod"))
+	w.poll()
+
+	gopls := received["gopls"]
+	sort.Slice(gopls, func(i, j int) bool { return gopls[i].URI < gopls[j].URI })
+	expected := []fileEvent{
+		{URI: lsp.URIFromPath(filepath.Join(root, "a.go")), Type: fileChanged},
+		{URI: lsp.URIFromPath(filepath.Join(root, "b.go")), Type: fileCreated},
+	}
+	if len(gopls) != 2 || gopls[0] != expected[0] || gopls[1] != expected[1] {
+		t.Errorf("expected %v, got %v", expected, gopls)
+	}
+
+	if gomod := received["gomod"]; len(gomod) != 1 || gomod[0].Type != fileDeleted {
+		t.Errorf("expected go.mod deletion, got %v", gomod)
+	}
+
+	if !w.unregister("gopls", "1") || w.unregister("gopls", "1") {
+		t.Error("expected the registration to be removed once")
+	}
+}
+
+func TestFileWatcher_Notify(t *testing.T) {
+	root := t.TempDir()
+	events := make(chan fileEvent, 16)
+	w := newFileWatcher(
+		func() []string { return []string{root} },
+		func(server string, batch []fileEvent) {
+			for _, e := range batch {
+				events <- e
+			}
+		},
+	)
+	if err := w.register("gopls", "1", json.RawMessage(`{"watchers":[{"globPattern":"**/*.go"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go w.run(done)
+	time.Sleep(200 * time.Millisecond)
+
+	if err := os.MkdirAll(filepath.Join(root, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(root, "pkg", "a.go"), []byte("package pkg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(root, "notes.txt"), nil, 0644)
+
+	expected := fileEvent{URI: lsp.URIFromPath(filepath.Join(root, "pkg", "a.go")), Type: fileCreated}
+	select {
+	case got := <-events:
+		if got != expected {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the created file")
+	}
+}
+
+func TestCoalesceFileEvents(t *testing.T) {
+	a, b, c := lsp.DocumentURI("file:///a.go"), lsp.DocumentURI("file:///b.go"), lsp.DocumentURI("file:///c.go")
+	events := []fileEvent{
+		{URI: a, Type: fileCreated},
+		{URI: b, Type: fileChanged},
+		{URI: a, Type: fileChanged},
+		{URI: c, Type: fileCreated},
+		{URI: b, Type: fileChanged},
+		{URI: c, Type: fileDeleted},
+		{URI: b, Type: fileDeleted},
+		{URI: b, Type: fileCreated},
+	}
+	expected := []fileEvent{{URI: a, Type: fileCreated}, {URI: b, Type: fileChanged}}
+
+	got := coalesceFileEvents(events)
+	if len(got) != len(expected) || got[0] != expected[0] || got[1] != expected[1] {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
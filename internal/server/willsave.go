@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// handleWillSaveWaitUntil collects edits from every LSP matching the
+// document within save_timeout and returns them combined, so each server can
+// apply its on-save fixes (organize imports, formatting) to the same save.
+func (h *Handler) handleWillSaveWaitUntil(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	h.server.mu.RLock()
+	timeout := h.server.cfg.SaveTimeoutDuration()
+	h.server.mu.RUnlock()
+
+	names := h.server.routeAll(msg.Method, msg.Params)
+	results := h.server.fanOutWithin(ctx, names, msg.Method, msg.Params, timeout)
+
+	uri := documentURI(msg.Params)
+	edits, conflicts := composeEdits(uri, results)
+	h.server.reportEditConflicts(msg.Method, []lsp.DocumentURI{uri}, conflicts)
+
+	return jsonrpc.NewResponse(*msg.ID, edits)
+}
+
+// composeEdits combines TextEdits to uri from several servers, primary
+// first. A
+// server's edits are taken all or nothing: if any of them overlaps an edit
+// already accepted from another server, the whole set is dropped and the
+// server is reported as conflicting. Edits identical to accepted ones are
+// skipped rather than applied twice.
+func composeEdits(uri lsp.DocumentURI, results []fanoutResult) ([]lsp.TextEdit, []editConflict) {
+	composed := []lsp.TextEdit{}
+	var owners []string // server of each composed edit
+	var conflicts []editConflict
+
+	for _, r := range results {
+		if r.err != nil || len(r.result) == 0 {
+			continue
+		}
+
+		var edits []lsp.TextEdit
+		if err := json.Unmarshal(r.result, &edits); err != nil || len(edits) == 0 {
+			continue
+		}
+
+		var accepted []lsp.TextEdit
+		var conflict *editConflict
+	edits:
+		for _, edit := range edits {
+			for i, prev := range composed {
+				if edit == prev {
+					continue edits
+				}
+				if editsOverlap(edit, prev) {
+					conflict = &editConflict{server: r.server, with: owners[i], uri: uri, edit: edit}
+					break edits
+				}
+			}
+			accepted = append(accepted, edit)
+		}
+
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+			continue
+		}
+		composed = append(composed, accepted...)
+		for range accepted {
+			owners = append(owners, r.server)
+		}
+	}
+
+	return composed, conflicts
+}
+
+// editsOverlap reports whether two edits touch the same text. Two insertions
+// at the same position overlap too, since their order would be ambiguous.
+func editsOverlap(a, b lsp.TextEdit) bool {
+	if a.Range.Start == a.Range.End && b.Range.Start == b.Range.End {
+		return a.Range.Start == b.Range.Start
+	}
+	return positionBefore(a.Range.Start, b.Range.End) && positionBefore(b.Range.Start, a.Range.End)
+}
+
+func positionBefore(a, b lsp.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Character < b.Character
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestComposeEdits(t *testing.T) {
+	tests := []struct {
+		name      string
+		results   []fanoutResult
+		newTexts  []string
+		conflicts []string
+	}{
+		{
+			name: "disjoint edits",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`[{"range":{"start":{"line":2,"character":0},"end":{"line":4,"character":0}},"newText":"imports"}]`)},
+				{server: "lint", result: json.RawMessage(`[{"range":{"start":{"line":10,"character":0},"end":{"line":10,"character":4}},"newText":"fix"}]`)},
+			},
+			newTexts: []string{"imports", "fix"},
+		},
+		{
+			name: "adjacent edits",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`[{"range":{"start":{"line":2,"character":0},"end":{"line":4,"character":0}},"newText":"imports"}]`)},
+				{server: "lint", result: json.RawMessage(`[{"range":{"start":{"line":4,"character":0},"end":{"line":4,"character":0}},"newText":"// ok\n"}]`)},
+			},
+			newTexts: []string{"imports", "// ok\n"},
+		},
+		{
+			name: "overlap drops the later server",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`[{"range":{"start":{"line":2,"character":0},"end":{"line":4,"character":0}},"newText":"imports"}]`)},
+				{server: "lint", result: json.RawMessage(`[
+					{"range":{"start":{"line":10,"character":0},"end":{"line":10,"character":4}},"newText":"fix"},
+					{"range":{"start":{"line":3,"character":0},"end":{"line":3,"character":5}},"newText":"clash"}
+				]`)},
+			},
+			newTexts:  []string{"imports"},
+			conflicts: []string{"lint"},
+		},
+		{
+			name: "insertions at the same position",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"newText":"a"}]`)},
+				{server: "lint", result: json.RawMessage(`[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"newText":"b"}]`)},
+			},
+			newTexts:  []string{"a"},
+			conflicts: []string{"lint"},
+		},
+		{
+			name: "identical edits are applied once",
+			results: []fanoutResult{
+				{server: "gopls", result: json.RawMessage(`[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]`)},
+				{server: "lint", result: json.RawMessage(`[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}},"newText":"x"}]`)},
+			},
+			newTexts: []string{"x"},
+		},
+		{
+			name: "failed and empty servers",
+			results: []fanoutResult{
+				{server: "gopls", err: errors.New("context deadline exceeded")},
+				{server: "lint", result: json.RawMessage(`null`)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits, conflicts := composeEdits("file:///src/main.go", tt.results)
+
+			if len(edits) != len(tt.newTexts) {
+				t.Fatalf("expected %d edits, got %d: %+v", len(tt.newTexts), len(edits), edits)
+			}
+			for i, edit := range edits {
+				if edit.NewText != tt.newTexts[i] {
+					t.Errorf("expected %q, got %q", tt.newTexts[i], edit.NewText)
+				}
+			}
+
+			if len(conflicts) != len(tt.conflicts) {
+				t.Fatalf("expected conflicts %v, got %v", tt.conflicts, conflicts)
+			}
+			for i := range conflicts {
+				if conflicts[i].server != tt.conflicts[i] {
+					t.Errorf("expected %q, got %q", tt.conflicts[i], conflicts[i].server)
+				}
+			}
+		})
+	}
+}
+
+func TestPublishEditConflicts(t *testing.T) {
+	s := &Server{cfg: &config.Config{}, diagnostics: newDiagnosticsAggregator()}
+	uri := lsp.DocumentURI("file:///src/main.go")
+
+	_, conflicts := composeEdits(uri, []fanoutResult{
+		{server: "gopls", result: json.RawMessage(`[{"range":{"start":{"line":2,"character":0},"end":{"line":4,"character":0}},"newText":"imports"}]`)},
+		{server: "lint", result: json.RawMessage(`[{"range":{"start":{"line":3,"character":0},"end":{"line":3,"character":5}},"newText":"clash"}]`)},
+	})
+	s.reportEditConflicts(lsp.MethodTextDocumentWillSaveWaitUntil, []lsp.DocumentURI{uri}, conflicts)
+
+	reported := s.diagnostics.byURI[uri][editConflictSource]
+	if len(reported) != 1 {
+		t.Fatalf("expected one conflict diagnostic, got %v", reported)
+	}
+	var d lsp.Diagnostic
+	raw, _ := json.Marshal(reported[0])
+	json.Unmarshal(raw, &d)
+	if d.Range.Start.Line != 3 || d.Range.End.Character != 5 {
+		t.Errorf("expected the dropped edit's range, got %+v", d.Range)
+	}
+	expected := "gopls and lint disagree on this edit; lint's edits were not applied"
+	if d.Message != expected {
+		t.Errorf("expected %q, got %q", expected, d.Message)
+	}
+
+	s.reportEditConflicts(lsp.MethodTextDocumentWillSaveWaitUntil, []lsp.DocumentURI{uri}, nil)
+	if s.diagnostics.reported(editConflictSource, uri) {
+		t.Error("expected a save without conflicts to clear them")
+	}
+}
@@ -0,0 +1,203 @@
+// Package stats keeps an opt-in, local-only record of which LSP servers and
+// methods lux forwards requests to. Nothing is sent anywhere; the data exists
+// so users can tune their own configuration (for example, spotting a
+// configured server that never gets used).
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+// Usage is the persisted usage record.
+type Usage struct {
+	Since   time.Time               `json:"since"`
+	Servers map[string]*ServerUsage `json:"servers"`
+}
+
+type ServerUsage struct {
+	Requests int64            `json:"requests"`
+	LastUsed time.Time        `json:"last_used"`
+	Methods  map[string]int64 `json:"methods"`
+}
+
+// DefaultPath is where usage is recorded.
+func DefaultPath() string {
+	return filepath.Join(config.DataDir(), "usage.json")
+}
+
+// Load reads the usage record at path. A missing file is an empty record.
+func Load(path string) (*Usage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Usage{Servers: make(map[string]*ServerUsage)}, nil
+		}
+		return nil, fmt.Errorf("reading usage: %w", err)
+	}
+
+	var u Usage
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("parsing usage: %w", err)
+	}
+	if u.Servers == nil {
+		u.Servers = make(map[string]*ServerUsage)
+	}
+	return &u, nil
+}
+
+func (u *Usage) save(path string) error {
+	data, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating data directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("writing usage: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (u *Usage) add(server, method string, count int64, at time.Time) {
+	su, ok := u.Servers[server]
+	if !ok {
+		su = &ServerUsage{Methods: make(map[string]int64)}
+		u.Servers[server] = su
+	}
+	su.Requests += count
+	su.Methods[method] += count
+	if at.After(su.LastUsed) {
+		su.LastUsed = at
+	}
+}
+
+// Recorder counts requests in memory and merges them into the file at path on
+// Flush, so several lux processes can share one record.
+type Recorder struct {
+	path    string
+	pending *Usage
+	mu      sync.Mutex
+}
+
+func NewRecorder(path string) *Recorder {
+	return &Recorder{
+		path:    path,
+		pending: &Usage{Servers: make(map[string]*ServerUsage)},
+	}
+}
+
+// Record counts one request; it matches subprocess.CallHandler.
+func (r *Recorder) Record(server, method string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending.add(server, method, 1, time.Now())
+}
+
+// Flush merges pending counts into the on-disk record.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = &Usage{Servers: make(map[string]*ServerUsage)}
+	r.mu.Unlock()
+
+	if len(pending.Servers) == 0 {
+		return nil
+	}
+
+	u, err := Load(r.path)
+	if err != nil {
+		return err
+	}
+	if u.Since.IsZero() {
+		u.Since = time.Now()
+	}
+
+	for server, su := range pending.Servers {
+		for method, count := range su.Methods {
+			u.add(server, method, count, su.LastUsed)
+		}
+	}
+
+	return u.save(r.path)
+}
+
+// Report is the exported summary of a usage record against the current
+// configuration.
+type Report struct {
+	Since   time.Time      `json:"since,omitempty"`
+	Servers []ServerReport `json:"servers"`
+}
+
+type ServerReport struct {
+	Name       string         `json:"name"`
+	Configured bool           `json:"configured"`
+	Unused     bool           `json:"unused,omitempty"`
+	Requests   int64          `json:"requests"`
+	LastUsed   *time.Time     `json:"last_used,omitempty"`
+	Methods    []MethodReport `json:"methods,omitempty"`
+}
+
+type MethodReport struct {
+	Method   string `json:"method"`
+	Requests int64  `json:"requests"`
+}
+
+// Export summarizes u, listing every configured server (marking those never
+// used) plus any recorded server no longer in cfg. Servers and methods are
+// sorted by request count, busiest first.
+func Export(u *Usage, cfg *config.Config) Report {
+	report := Report{Since: u.Since}
+
+	seen := make(map[string]bool)
+	for _, l := range cfg.LSPs {
+		seen[l.Name] = true
+		report.Servers = append(report.Servers, serverReport(l.Name, true, u.Servers[l.Name]))
+	}
+	for name, su := range u.Servers {
+		if !seen[name] {
+			report.Servers = append(report.Servers, serverReport(name, false, su))
+		}
+	}
+
+	sort.SliceStable(report.Servers, func(i, j int) bool {
+		a, b := report.Servers[i], report.Servers[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Name < b.Name
+	})
+
+	return report
+}
+
+func serverReport(name string, configured bool, su *ServerUsage) ServerReport {
+	sr := ServerReport{Name: name, Configured: configured}
+	if su == nil || su.Requests == 0 {
+		sr.Unused = true
+		return sr
+	}
+
+	sr.Requests = su.Requests
+	lastUsed := su.LastUsed
+	sr.LastUsed = &lastUsed
+	for method, count := range su.Methods {
+		sr.Methods = append(sr.Methods, MethodReport{Method: method, Requests: count})
+	}
+	sort.Slice(sr.Methods, func(i, j int) bool {
+		if sr.Methods[i].Requests != sr.Methods[j].Requests {
+			return sr.Methods[i].Requests > sr.Methods[j].Requests
+		}
+		return sr.Methods[i].Method < sr.Methods[j].Method
+	})
+	return sr
+}
@@ -0,0 +1,74 @@
+package stats
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/amarbel-llc/lux/pkg/config"
+)
+
+func TestRecorder_FlushAccumulates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+
+	for i := 0; i < 2; i++ {
+		r := NewRecorder(path)
+		r.Record("gopls", "textDocument/hover")
+		r.Record("gopls", "textDocument/definition")
+		if err := r.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+
+	u, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	gopls := u.Servers["gopls"]
+	if gopls == nil {
+		t.Fatal("expected usage for gopls")
+	}
+	if gopls.Requests != 4 {
+		t.Errorf("expected 4 requests, got %d", gopls.Requests)
+	}
+	if gopls.Methods["textDocument/hover"] != 2 {
+		t.Errorf("expected 2 hover requests, got %d", gopls.Methods["textDocument/hover"])
+	}
+	if u.Since.IsZero() {
+		t.Error("expected since to be set")
+	}
+}
+
+func TestExport(t *testing.T) {
+	u := &Usage{Servers: map[string]*ServerUsage{
+		"gopls": {Requests: 3, Methods: map[string]int64{"textDocument/hover": 1, "textDocument/definition": 2}},
+		"old":   {Requests: 1, Methods: map[string]int64{"textDocument/hover": 1}},
+	}}
+	cfg := &config.Config{LSPs: []config.LSP{{Name: "gopls"}, {Name: "pyright"}}}
+
+	report := Export(u, cfg)
+
+	if len(report.Servers) != 3 {
+		t.Fatalf("expected 3 servers, got %d", len(report.Servers))
+	}
+
+	tests := []struct {
+		name       string
+		configured bool
+		unused     bool
+	}{
+		{"gopls", true, false},
+		{"old", false, false},
+		{"pyright", true, true},
+	}
+	for i, tt := range tests {
+		got := report.Servers[i]
+		if got.Name != tt.name || got.Configured != tt.configured || got.Unused != tt.unused {
+			t.Errorf("server %d: expected %+v, got %+v", i, tt, got)
+		}
+	}
+
+	if m := report.Servers[0].Methods; len(m) != 2 || m[0].Method != "textDocument/definition" {
+		t.Errorf("expected methods sorted by count, got %+v", m)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package subprocess
+
+func processAlive(pid int) bool {
+	return true
+}
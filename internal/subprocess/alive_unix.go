@@ -0,0 +1,14 @@
+//go:build unix
+
+package subprocess
+
+import "syscall"
+
+// processAlive reports whether process pid still exists. A pid of 0 (no
+// local process) is taken to be alive.
+func processAlive(pid int) bool {
+	if pid == 0 {
+		return true
+	}
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
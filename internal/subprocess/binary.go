@@ -0,0 +1,96 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/amarbel-llc/lux/pkg/executor"
+)
+
+// BinaryExecutor runs LSPs from binaries already installed on the system. It
+// never invokes nix: Build resolves the binary spec, after expanding
+// environment variables, as an absolute path or by looking it up in PATH.
+type BinaryExecutor struct{}
+
+func NewBinaryExecutor() *BinaryExecutor {
+	return &BinaryExecutor{}
+}
+
+// Build resolves binarySpec, falling back to a name derived from flake (the
+// last attribute component, so "nixpkgs#nodePackages.bash-language-server"
+// becomes "bash-language-server") when no binary is configured.
+func (e *BinaryExecutor) Build(ctx context.Context, flake, binarySpec string) (string, error) {
+	name := os.ExpandEnv(binarySpec)
+	if name == "" {
+		name = binaryNameFromFlake(flake)
+	}
+	if name == "" {
+		return "", fmt.Errorf("no binary configured for %q", flake)
+	}
+	return lookExecutable("binary", name)
+}
+
+// lookExecutable resolves name as an absolute path or by looking it up in
+// PATH. what names it in errors.
+func lookExecutable(what, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", fmt.Errorf("%s %q not found: %w", what, name, err)
+		}
+		if info.IsDir() {
+			return "", fmt.Errorf("%s %q is a directory", what, name)
+		}
+		if info.Mode()&0111 == 0 {
+			return "", fmt.Errorf("%s %q is not executable", what, name)
+		}
+		return name, nil
+	}
+
+	if strings.Contains(name, "/") {
+		return "", fmt.Errorf("%s %q must be a command name or an absolute path", what, name)
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s %q not found in PATH: %w", what, name, err)
+	}
+	return path, nil
+}
+
+func (e *BinaryExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	return startProcess(ctx, path, args, env, workDir)
+}
+
+func binaryNameFromFlake(flake string) string {
+	attr := flake
+	if i := strings.LastIndex(attr, "#"); i >= 0 {
+		attr = attr[i+1:]
+	} else {
+		attr = filepath.Base(attr)
+	}
+	if i := strings.LastIndex(attr, "."); i >= 0 {
+		attr = attr[i+1:]
+	}
+	return attr
+}
+
+// NewExecutor returns the executor for kind (as in config.Config.ExecutorKind):
+// "nix", "binary", or the name of one registered with executor.Register. A
+// nix executor caches its builds in cacheDir (see NewNixExecutor).
+func NewExecutor(kind, cacheDir string) Executor {
+	switch kind {
+	case executor.Binary:
+		return NewBinaryExecutor()
+	case executor.Nix:
+		return NewNixExecutor(cacheDir)
+	}
+	if factory, ok := executor.Lookup(kind); ok {
+		return factory()
+	}
+	return NewNixExecutor(cacheDir)
+}
@@ -0,0 +1,82 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amarbel-llc/lux/pkg/executor"
+)
+
+func TestBinaryNameFromFlake(t *testing.T) {
+	tests := []struct {
+		flake    string
+		expected string
+	}{
+		{"nixpkgs#gopls", "gopls"},
+		{"nixpkgs#nodePackages.bash-language-server", "bash-language-server"},
+		{"github:oxalica/nil", "nil"},
+		{"gopls", "gopls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flake, func(t *testing.T) {
+			if got := binaryNameFromFlake(tt.flake); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBinaryExecutor_Build(t *testing.T) {
+	tmpDir := t.TempDir()
+	execPath := filepath.Join(tmpDir, "fake-lsp")
+	if err := os.WriteFile(execPath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("failed to create executable: %v", err)
+	}
+	t.Setenv("PATH", tmpDir)
+	t.Setenv("LSP_DIR", tmpDir)
+
+	e := NewBinaryExecutor()
+	ctx := context.Background()
+
+	if got, err := e.Build(ctx, "nixpkgs#fake-lsp", ""); err != nil || got != execPath {
+		t.Errorf("PATH lookup: expected %s, got %q (err %v)", execPath, got, err)
+	}
+	if got, err := e.Build(ctx, "", execPath); err != nil || got != execPath {
+		t.Errorf("absolute path: expected %s, got %q (err %v)", execPath, got, err)
+	}
+	if got, err := e.Build(ctx, "", "$LSP_DIR/fake-lsp"); err != nil || got != execPath {
+		t.Errorf("expanded path: expected %s, got %q (err %v)", execPath, got, err)
+	}
+	if got, err := e.Build(ctx, "nixpkgs#gopls", execPath); err != nil || got != execPath {
+		t.Errorf("spec over flake: expected %s, got %q (err %v)", execPath, got, err)
+	}
+	if _, err := e.Build(ctx, "nixpkgs#missing-lsp", ""); err == nil {
+		t.Error("expected error for binary missing from PATH")
+	}
+	if _, err := e.Build(ctx, "", "bin/fake-lsp"); err == nil {
+		t.Error("expected error for relative path")
+	}
+}
+
+type launcherExecutor struct{ BinaryExecutor }
+
+// Registering from init rather than the test keeps it to once per test
+// binary, since Register panics on a second call (e.g. under -count=2).
+func init() {
+	executor.Register("launcher", func() executor.Executor { return &launcherExecutor{} })
+}
+
+func TestNewExecutor(t *testing.T) {
+	if _, ok := NewExecutor("binary", "").(*BinaryExecutor); !ok {
+		t.Error("expected BinaryExecutor for binary")
+	}
+	if _, ok := NewExecutor("nix", "").(*NixExecutor); !ok {
+		t.Error("expected NixExecutor for nix")
+	}
+	if _, ok := NewExecutor("launcher", "").(*launcherExecutor); !ok {
+		t.Error("expected the registered executor for launcher")
+	}
+}
@@ -0,0 +1,99 @@
+package subprocess
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RestartPolicy is the circuit breaker for crash-looping servers: once an
+// instance fails MaxFailures times within Window it is disabled instead of
+// being started again on the next request.
+type RestartPolicy struct {
+	MaxFailures int
+	Window      time.Duration
+}
+
+// DefaultRestartPolicy allows 5 failures in 5 minutes.
+var DefaultRestartPolicy = RestartPolicy{MaxFailures: 5, Window: 5 * time.Minute}
+
+// DisabledError is returned for an instance whose circuit breaker has
+// tripped. It carries the tail of the server's stderr for diagnosis.
+type DisabledError struct {
+	Name       string
+	Failures   int
+	Window     time.Duration
+	LastError  error
+	StderrTail string
+}
+
+func (e *DisabledError) Error() string {
+	msg := fmt.Sprintf("LSP %s disabled after %d failures in %s (last error: %v); run `lux start %s` to retry",
+		e.Name, e.Failures, e.Window, e.LastError, e.Name)
+	if e.StderrTail != "" {
+		msg += "\nstderr:\n" + e.StderrTail
+	}
+	return msg
+}
+
+func (e *DisabledError) Unwrap() error {
+	return e.LastError
+}
+
+// recordFailure notes a failure at now and reports whether the breaker
+// trips. It must be called with inst.mu held.
+func (policy RestartPolicy) recordFailure(inst *LSPInstance, now time.Time) bool {
+	if policy.MaxFailures <= 0 {
+		return false
+	}
+
+	cutoff := now.Add(-policy.Window)
+	kept := inst.failures[:0]
+	for _, t := range inst.failures {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	inst.failures = append(kept, now)
+
+	return len(inst.failures) >= policy.MaxFailures
+}
+
+// stderrTailLines is how much backend stderr is kept for disabled-server
+// reports.
+const stderrTailLines = 20
+
+// tailBuffer keeps the last stderrTailLines lines written to it.
+type tailBuffer struct {
+	lines   []string
+	partial string
+	mu      sync.Mutex
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	text := b.partial + string(p)
+	parts := strings.Split(text, "\n")
+	b.partial = parts[len(parts)-1]
+	for _, line := range parts[:len(parts)-1] {
+		b.lines = append(b.lines, line)
+	}
+	if len(b.lines) > stderrTailLines {
+		b.lines = b.lines[len(b.lines)-stderrTailLines:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines := b.lines
+	if b.partial != "" {
+		lines = append(append([]string(nil), lines...), b.partial)
+	}
+	return strings.Join(lines, "\n")
+}
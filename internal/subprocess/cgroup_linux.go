@@ -0,0 +1,168 @@
+//go:build linux
+
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cpuPeriod is the cpu.max period, in microseconds, CPU limits are
+// expressed over.
+const cpuPeriod = 100000
+
+// luxLeaf is the group lux moves itself into, below its own, so that the
+// servers' groups can be its siblings.
+const luxLeaf = "lux"
+
+// serverCgroups is the group the servers' groups are made in: lux's own,
+// once lux has moved out of it. It is set up the first time a server needs
+// a limit.
+var serverCgroups struct {
+	once        sync.Once
+	dir         string
+	controllers []string
+	err         error
+}
+
+// cgroupParent returns the group to make the servers' groups in and the
+// controllers enabled for them.
+func cgroupParent() (string, []string, error) {
+	serverCgroups.once.Do(func() {
+		own, err := ownCgroup()
+		if err != nil {
+			serverCgroups.err = err
+			return
+		}
+		serverCgroups.dir = own
+		serverCgroups.controllers, serverCgroups.err = delegateCgroup(own, os.Getpid())
+	})
+	return serverCgroups.dir, serverCgroups.controllers, serverCgroups.err
+}
+
+// delegateCgroup readies dir, the group process pid is in, to hold the
+// servers' groups. cgroup v2 only lets a group without processes of its own
+// enable controllers for its children, so pid is first moved into a leaf
+// group below dir; then the memory and cpu controllers dir has are enabled
+// for its children. It returns the controllers enabled. dir has to be
+// delegated to the user running lux, and lux has to be alone in it, as when
+// lux runs under systemd-run --user -p Delegate=yes.
+func delegateCgroup(dir string, pid int) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("reading cgroup controllers: %w", err)
+	}
+	var enable []string
+	for _, c := range strings.Fields(string(data)) {
+		if c == "memory" || c == "cpu" {
+			enable = append(enable, c)
+		}
+	}
+	if len(enable) == 0 {
+		return nil, fmt.Errorf("cgroup %s has neither the memory nor the cpu controller delegated", dir)
+	}
+
+	leaf := filepath.Join(dir, luxLeaf)
+	if err := os.Mkdir(leaf, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("creating cgroup %s: %w", leaf, err)
+	}
+	if err := os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0); err != nil {
+		return nil, fmt.Errorf("moving lux into %s: %w", leaf, err)
+	}
+
+	control := make([]string, len(enable))
+	for i, c := range enable {
+		control[i] = "+" + c
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(strings.Join(control, " ")), 0); err != nil {
+		if errors.Is(err, syscall.EBUSY) {
+			return nil, fmt.Errorf("enabling cgroup controllers in %s: other processes share lux's cgroup", dir)
+		}
+		return nil, fmt.Errorf("enabling cgroup controllers in %s: %w", dir, err)
+	}
+	return enable, nil
+}
+
+// cgroupLimitsMemory reports whether servers' memory_limit is enforced by
+// their cgroup's memory.max.
+func cgroupLimitsMemory() bool {
+	_, controllers, err := cgroupParent()
+	return err == nil && slices.Contains(controllers, "memory")
+}
+
+// limitCgroup moves process pid into a cgroup v2 group of its own, a sibling
+// of lux's, with memory.max and cpu.max set from limits. Where lux's cgroup
+// isn't delegated, the error says so; a memory limit then falls back to the
+// address-space rlimit (see limitAddressSpace) and a CPU limit doesn't apply.
+func limitCgroup(name string, pid int, limits Limits) error {
+	if pid == 0 || limits.isZero() {
+		return nil
+	}
+
+	parent, controllers, err := cgroupParent()
+	if err != nil {
+		return err
+	}
+	return limitCgroupIn(parent, controllers, name, pid, limits)
+}
+
+func limitCgroupIn(parent string, controllers []string, name string, pid int, limits Limits) error {
+	dir := filepath.Join(parent, cgroupName(name))
+	if err := os.Mkdir(dir, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("creating cgroup: %w", err)
+	}
+
+	var files [][2]string
+	if limits.Memory > 0 && slices.Contains(controllers, "memory") {
+		files = append(files, [2]string{"memory.max", strconv.FormatInt(limits.Memory, 10)})
+	}
+	if limits.CPUs > 0 && slices.Contains(controllers, "cpu") {
+		quota := max(int64(limits.CPUs*cpuPeriod), 1000)
+		files = append(files, [2]string{"cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriod)})
+	}
+	files = append(files, [2]string{"cgroup.procs", strconv.Itoa(pid)})
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f[0]), []byte(f[1]), 0); err != nil {
+			return fmt.Errorf("writing %s: %w", f[0], err)
+		}
+	}
+	if limits.CPUs > 0 && !slices.Contains(controllers, "cpu") {
+		return fmt.Errorf("cgroup %s has no cpu controller delegated; cpu_limit doesn't apply", parent)
+	}
+	return nil
+}
+
+// removeCgroup removes the cgroup limitCgroup made for the named instance,
+// once its processes have exited. Failures are ignored.
+func removeCgroup(name string) {
+	if parent, _, err := cgroupParent(); err == nil {
+		os.Remove(filepath.Join(parent, cgroupName(name)))
+	}
+}
+
+// ownCgroup returns the directory of lux's cgroup v2 group.
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("finding lux's cgroup: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join(cgroupRoot, path), nil
+		}
+	}
+	return "", errors.New("finding lux's cgroup: no cgroup v2 hierarchy")
+}
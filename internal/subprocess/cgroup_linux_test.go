@@ -0,0 +1,83 @@
+//go:build linux
+
+package subprocess
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestDelegateCgroup_NoControllers(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("io pids\n"), 0o644)
+
+	_, err := delegateCgroup(dir, os.Getpid())
+	if err == nil || !strings.Contains(err.Error(), "neither the memory nor the cpu controller") {
+		t.Errorf("expected an error naming the missing controllers, got %v", err)
+	}
+}
+
+// TestLimitCgroup_Delegated runs against the real hierarchy, so it needs the
+// test's cgroup delegated to it with nothing else in it, as under
+// systemd-run --user -p Delegate=yes go test ./internal/subprocess/. It
+// moves the test process into a leaf group and back.
+func TestLimitCgroup_Delegated(t *testing.T) {
+	own, err := ownCgroup()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, file := range []string{"cgroup.procs", "cgroup.subtree_control"} {
+		if syscall.Access(filepath.Join(own, file), 2 /* W_OK */) != nil {
+			t.Skipf("%s is not delegated", own)
+		}
+	}
+	procs, err := os.ReadFile(filepath.Join(own, "cgroup.procs"))
+	if err != nil || strings.TrimSpace(string(procs)) != strconv.Itoa(os.Getpid()) {
+		t.Skipf("%s has other processes", own)
+	}
+
+	controllers, err := delegateCgroup(own, os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.WriteFile(filepath.Join(own, "cgroup.subtree_control"), []byte("-memory -cpu"), 0)
+		os.WriteFile(filepath.Join(own, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0)
+		os.Remove(filepath.Join(own, luxLeaf))
+	})
+
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	dir := filepath.Join(own, cgroupName("test"))
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.Remove(dir)
+	})
+
+	limits := Limits{Memory: 64 << 20, CPUs: 0.5}
+	if err := limitCgroupIn(own, controllers, "test", cmd.Process.Pid, limits); err != nil {
+		t.Fatal(err)
+	}
+
+	membership, _ := os.ReadFile(filepath.Join("/proc", strconv.Itoa(cmd.Process.Pid), "cgroup"))
+	if !strings.Contains(string(membership), cgroupName("test")) {
+		t.Errorf("expected the process in its own group, got %q", membership)
+	}
+	for file, expected := range map[string]string{"memory.max": "67108864", "cpu.max": "50000 100000"} {
+		controller, _, _ := strings.Cut(file, ".")
+		if !strings.Contains(strings.Join(controllers, " "), controller) {
+			continue
+		}
+		if got, _ := os.ReadFile(filepath.Join(dir, file)); strings.TrimSpace(string(got)) != expected {
+			t.Errorf("expected %s %q, got %q", file, expected, got)
+		}
+	}
+}
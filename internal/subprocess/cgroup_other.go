@@ -0,0 +1,23 @@
+//go:build !linux
+
+package subprocess
+
+import "errors"
+
+// cgroupLimitsMemory reports whether servers' memory_limit is enforced by a
+// cgroup. There are no cgroups here.
+func cgroupLimitsMemory() bool {
+	return false
+}
+
+// limitCgroup applies the limits only cgroups can enforce. There are no
+// cgroups here, so a CPU limit is unsupported; memory is limited by the
+// address-space rlimit limitAddressSpace sets.
+func limitCgroup(name string, pid int, limits Limits) error {
+	if pid == 0 || limits.CPUs <= 0 {
+		return nil
+	}
+	return errors.ErrUnsupported
+}
+
+func removeCgroup(name string) {}
@@ -0,0 +1,263 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// errConnClosed answers calls still waiting when a connection stops reading.
+var errConnClosed = errors.New("connection closed")
+
+// Conn is lux's connection to a backend, and to the editor it serves. It
+// works like jsonrpc.Conn, except that Call knows the ID it gives each
+// request, so a call whose ctx ends before the peer answers sends it
+// $/cancelRequest for it and the peer stops working on it.
+type Conn struct {
+	stream   *jsonrpc.Stream
+	handler  jsonrpc.Handler
+	nextID   atomic.Int64
+	closed   atomic.Bool
+	inOrder  bool
+	dispatch Dispatch
+
+	mu      sync.Mutex
+	pending map[string]func(*jsonrpc.Message)
+	done    bool // Run has returned, so no answers will be read
+}
+
+// NewConn returns a connection reading messages from r and writing them to
+// w. handler answers the backend's requests and notifications; it may be nil.
+func NewConn(r io.Reader, w io.Writer, handler jsonrpc.Handler) *Conn {
+	return &Conn{
+		stream:  jsonrpc.NewStream(r, w),
+		handler: handler,
+		pending: make(map[string]func(*jsonrpc.Message)),
+	}
+}
+
+// Dispatch decides when Run handles a request or notification it has read:
+// it calls handle, on a goroutine of its own or not, or returns false to
+// refuse the message, answering a request with RequestCancelled. It is
+// called on Run's goroutine, so one that waits, such as for a free worker,
+// holds off reading further messages until it returns.
+type Dispatch func(ctx context.Context, msg *jsonrpc.Message, handle func()) bool
+
+// SetDispatch makes Run hand each message to d rather than handling it on a
+// goroutine of its own. Call it before Run.
+func (c *Conn) SetDispatch(d Dispatch) {
+	c.dispatch = d
+}
+
+// HandleInOrder makes Run handle each message before reading the next, for
+// protocols whose messages must be passed on in the order they came, such
+// as DAP's events. The handler, and the callbacks given Go, then must not
+// wait on answers read by the same connection. Call it before Run.
+func (c *Conn) HandleInOrder() {
+	c.inOrder = true
+}
+
+// Run reads messages until r fails, handling each request or notification
+// on a goroutine of its own (see SetDispatch and HandleInOrder). It returns
+// nil if the connection was closed.
+func (c *Conn) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer c.failPending()
+
+	for {
+		msg, err := c.stream.Read()
+		if err != nil {
+			if c.closed.Load() {
+				return nil
+			}
+			return fmt.Errorf("reading message: %w", err)
+		}
+
+		if msg.IsResponse() {
+			c.deliver(msg)
+			continue
+		}
+		switch {
+		case c.inOrder:
+			c.handle(ctx, msg)
+		case c.dispatch != nil:
+			if !c.dispatch(ctx, msg, func() { c.handle(ctx, msg) }) {
+				c.refuse(msg)
+			}
+		default:
+			go c.handle(ctx, msg)
+		}
+	}
+}
+
+// Call sends a request and waits for its result. If ctx ends first, the
+// backend is sent $/cancelRequest for the request.
+func (c *Conn) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	type answer struct {
+		result json.RawMessage
+		err    error
+	}
+	ch := make(chan answer, 1)
+	err := c.Go(ctx, method, params, func(result json.RawMessage, err error) {
+		ch <- answer{result, err}
+	})
+	if err != nil {
+		return nil, err
+	}
+	a := <-ch
+	return a.result, a.err
+}
+
+// Go sends a request without waiting for its result, which is passed to
+// done once the backend answers. done runs on Run's goroutine, so it is
+// called before the messages read after the answer are handled. If ctx ends
+// first, the backend is sent $/cancelRequest for the request and done is
+// given ctx's error.
+func (c *Conn) Go(ctx context.Context, method string, params any, done func(json.RawMessage, error)) error {
+	id := jsonrpc.NewNumberID(c.nextID.Add(1))
+	msg, err := jsonrpc.NewRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+
+	answered := make(chan struct{})
+	c.mu.Lock()
+	if c.done {
+		c.mu.Unlock()
+		return errConnClosed
+	}
+	c.pending[id.String()] = func(resp *jsonrpc.Message) {
+		close(answered)
+		switch {
+		case resp == nil:
+			done(nil, errConnClosed)
+		case resp.Error != nil:
+			done(nil, resp.Error)
+		default:
+			done(resp.Result, nil)
+		}
+	}
+	c.mu.Unlock()
+
+	if err := c.stream.Write(msg); err != nil {
+		c.take(id)
+		return err
+	}
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-answered:
+			case <-ctx.Done():
+				if _, ok := c.take(id); ok {
+					c.Notify(lsp.MethodCancelRequest, map[string]any{"id": id})
+					done(nil, ctx.Err())
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Reply answers the backend's request id, for handlers that answer later
+// rather than by returning a response. A *jsonrpc.Error is sent as it is,
+// ctx errors as RequestCancelled, and other errors as InternalError.
+func (c *Conn) Reply(id jsonrpc.ID, result json.RawMessage, err error) error {
+	var resp *jsonrpc.Message
+	var rpcErr *jsonrpc.Error
+	switch {
+	case errors.As(err, &rpcErr):
+		resp = &jsonrpc.Message{JSONRPC: jsonrpc.Version, ID: &id, Error: rpcErr}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		resp, _ = jsonrpc.NewErrorResponse(id, jsonrpc.RequestCancelled, err.Error(), nil)
+	case err != nil:
+		resp, _ = jsonrpc.NewErrorResponse(id, jsonrpc.InternalError, err.Error(), nil)
+	default:
+		resp, _ = jsonrpc.NewResponse(id, result)
+	}
+	return c.stream.Write(resp)
+}
+
+// Notify sends a notification.
+func (c *Conn) Notify(method string, params any) error {
+	msg, err := jsonrpc.NewNotification(method, params)
+	if err != nil {
+		return err
+	}
+	return c.stream.Write(msg)
+}
+
+// Close marks the connection closed, so the read error that follows ends Run
+// without an error.
+func (c *Conn) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func (c *Conn) handle(ctx context.Context, msg *jsonrpc.Message) {
+	if c.handler == nil {
+		return
+	}
+	// A message that waited for a worker until the connection ended isn't
+	// worth starting on.
+	if ctx.Err() != nil {
+		c.refuse(msg)
+		return
+	}
+
+	resp, err := c.handler(ctx, msg)
+	if err != nil {
+		if !msg.IsRequest() {
+			return
+		}
+		resp, _ = jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError, err.Error(), nil)
+	}
+	if resp != nil {
+		c.stream.Write(resp)
+	}
+}
+
+// refuse answers a request that won't be handled.
+func (c *Conn) refuse(msg *jsonrpc.Message) {
+	if msg.IsRequest() {
+		c.Reply(*msg.ID, nil, context.Canceled)
+	}
+}
+
+func (c *Conn) deliver(msg *jsonrpc.Message) {
+	if done, ok := c.take(*msg.ID); ok {
+		done(msg)
+	}
+}
+
+// take removes the call waiting on id, so that only one of its answer, its
+// cancellation, and the connection closing ends it.
+func (c *Conn) take(id jsonrpc.ID) (func(*jsonrpc.Message), bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	done, ok := c.pending[id.String()]
+	delete(c.pending, id.String())
+	return done, ok
+}
+
+// failPending ends the calls still waiting for an answer that will no longer
+// be read, and makes later calls fail at once.
+func (c *Conn) failPending() {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[string]func(*jsonrpc.Message))
+	c.done = true
+	c.mu.Unlock()
+
+	for _, done := range pending {
+		done(nil)
+	}
+}
@@ -0,0 +1,239 @@
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// dapMessage is a Debug Adapter Protocol message: a request, a response, or
+// an event.
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    *bool           `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+}
+
+// dapStream translates between DAP and JSON-RPC, so debug adapters and
+// their clients are served by Conn like language servers. DAP requests
+// become JSON-RPC requests named by their command, with their seq as ID;
+// events become notifications named by their event; and responses are
+// matched back to the requests they answer. $/cancelRequest becomes DAP's
+// cancel request.
+type dapStream struct {
+	r       *bufio.Reader
+	w       io.Writer
+	pending bytes.Buffer
+	buf     []byte
+	wmu     sync.Mutex
+
+	// mu guards the state shared by reads and writes. It isn't held while
+	// writing, so that a peer waiting for its output to be read can't
+	// block one waiting for its input to be.
+	mu       sync.Mutex
+	seq      int
+	sent     map[int]jsonrpc.ID // seq of each request written -> its ID
+	seqs     map[string]int     // ID of each request written -> its seq
+	received map[int]string     // seq of each request read -> its command
+}
+
+func newDAPStream(r io.Reader, w io.Writer) (*dapStream, *dapStream) {
+	s := &dapStream{
+		r:        bufio.NewReader(r),
+		w:        w,
+		sent:     make(map[int]jsonrpc.ID),
+		seqs:     make(map[string]int),
+		received: make(map[int]string),
+	}
+	return s, s
+}
+
+// Read presents the DAP messages read from r as framed JSON-RPC ones.
+// Responses to requests the stream didn't send, such as those to cancel
+// requests, are dropped.
+func (s *dapStream) Read(p []byte) (int, error) {
+	for s.pending.Len() == 0 {
+		body, err := readFrame(s.r)
+		if err != nil {
+			return 0, err
+		}
+		var dm dapMessage
+		if err := json.Unmarshal(body, &dm); err != nil {
+			return 0, fmt.Errorf("parsing message: %w", err)
+		}
+		msg := s.fromDAP(&dm)
+		if msg == nil {
+			continue
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return 0, err
+		}
+		writeFrame(&s.pending, data)
+	}
+	return s.pending.Read(p)
+}
+
+func (s *dapStream) fromDAP(dm *dapMessage) *jsonrpc.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := &jsonrpc.Message{JSONRPC: jsonrpc.Version}
+	switch dm.Type {
+	case "request":
+		id := jsonrpc.NewNumberID(int64(dm.Seq))
+		s.received[dm.Seq] = dm.Command
+		msg.ID, msg.Method, msg.Params = &id, dm.Command, dm.Arguments
+	case "event":
+		msg.Method, msg.Params = dm.Event, dm.Body
+	case "response":
+		id, ok := s.sent[dm.RequestSeq]
+		if !ok {
+			return nil
+		}
+		delete(s.sent, dm.RequestSeq)
+		delete(s.seqs, id.String())
+		msg.ID = &id
+		switch {
+		case dm.Success != nil && !*dm.Success:
+			code := jsonrpc.InternalError
+			if dm.Message == "cancelled" {
+				code = jsonrpc.RequestCancelled
+			}
+			msg.Error = &jsonrpc.Error{Code: code, Message: dm.Message, Data: dm.Body}
+		case len(dm.Body) == 0:
+			msg.Result = json.RawMessage("null")
+		default:
+			msg.Result = dm.Body
+		}
+	default:
+		return nil
+	}
+	return msg
+}
+
+// Write writes the framed JSON-RPC messages written to it as DAP messages,
+// whatever pieces they arrive in.
+func (s *dapStream) Write(p []byte) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.buf = append(s.buf, p...)
+	for {
+		body, n, err := cutFrame(s.buf)
+		if err != nil || n == 0 {
+			return len(p), err
+		}
+
+		var msg jsonrpc.Message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return 0, fmt.Errorf("parsing message: %w", err)
+		}
+		s.buf = append(s.buf[:0], s.buf[n:]...)
+		dm := s.toDAP(&msg)
+		if dm == nil {
+			continue
+		}
+		data, err := json.Marshal(dm)
+		if err != nil {
+			return 0, err
+		}
+		if err := writeFrame(s.w, data); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (s *dapStream) toDAP(msg *jsonrpc.Message) *dapMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	dm := &dapMessage{Seq: s.seq}
+	switch {
+	case msg.Method == lsp.MethodCancelRequest:
+		var p struct {
+			ID jsonrpc.ID `json:"id"`
+		}
+		json.Unmarshal(msg.Params, &p)
+		seq, ok := s.seqs[p.ID.String()]
+		if !ok {
+			return nil
+		}
+		dm.Type, dm.Command = "request", "cancel"
+		dm.Arguments, _ = json.Marshal(map[string]int{"requestId": seq})
+	case msg.IsRequest():
+		s.sent[dm.Seq] = *msg.ID
+		s.seqs[msg.ID.String()] = dm.Seq
+		dm.Type, dm.Command, dm.Arguments = "request", msg.Method, msg.Params
+	case msg.IsNotification():
+		dm.Type, dm.Event, dm.Body = "event", msg.Method, msg.Params
+	case msg.IsResponse():
+		requestSeq, err := strconv.Atoi(msg.ID.String())
+		if err != nil {
+			return nil
+		}
+		success := msg.Error == nil
+		dm.Type, dm.RequestSeq, dm.Success = "response", requestSeq, &success
+		dm.Command = s.received[requestSeq]
+		delete(s.received, requestSeq)
+		if msg.Error != nil {
+			dm.Message, dm.Body = msg.Error.Message, msg.Error.Data
+			if msg.Error.Code == jsonrpc.RequestCancelled {
+				dm.Message = "cancelled"
+			}
+		} else if string(msg.Result) != "null" {
+			dm.Body = msg.Result
+		}
+	default:
+		return nil
+	}
+	return dm
+}
+
+// readFrame reads one Content-Length framed message body.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header line: %s", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("parsing Content-Length: %w", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -1,19 +1,12 @@
 package subprocess
 
 import (
-	"context"
-	"io"
+	"github.com/amarbel-llc/lux/pkg/executor"
 )
 
-type Process struct {
-	Stdin  io.WriteCloser
-	Stdout io.ReadCloser
-	Stderr io.ReadCloser
-	Wait   func() error
-	Kill   func() error
-}
-
-type Executor interface {
-	Build(ctx context.Context, flake, binarySpec string) (string, error)
-	Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error)
-}
+// Process and Executor are defined in pkg/executor so that executors can be
+// written outside this module.
+type (
+	Process  = executor.Process
+	Executor = executor.Executor
+)
@@ -0,0 +1,233 @@
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/go-lib-mcp/transport"
+)
+
+// Framings of a server's stdio (see config.LSP.Framing).
+const (
+	FramingLSP    = "lsp"
+	FramingNDJSON = "ndjson"
+	FramingAuto   = "auto"
+	FramingDAP    = "dap"
+)
+
+// FrameStdio adapts a server's stdout and stdin to the Content-Length framed
+// JSON-RPC messages Conn reads and writes. Newline-delimited JSON is decoded
+// and encoded with the MCP stdio transport, the Debug Adapter Protocol is
+// translated to JSON-RPC (see newDAPStream), and "auto" picks one of the
+// first two by what the server writes (see autoFraming).
+func FrameStdio(framing string, stdout io.Reader, stdin io.Writer) (io.Reader, io.Writer) {
+	switch framing {
+	case FramingNDJSON:
+		return newNDJSONReader(stdout), newNDJSONWriter(stdin)
+	case FramingAuto:
+		return newAutoFraming(stdout, stdin)
+	case FramingDAP:
+		return newDAPStream(stdout, stdin)
+	default:
+		return stdout, stdin
+	}
+}
+
+// ndjsonReader presents newline-delimited JSON messages as framed ones.
+type ndjsonReader struct {
+	stdio   *transport.Stdio
+	pending bytes.Buffer
+	// skipOrphans drops errors with no id, the answers of a server to lines
+	// it couldn't parse, which answer nothing Conn sent (see autoFraming).
+	skipOrphans bool
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	return &ndjsonReader{stdio: transport.NewStdio(r, nil)}
+}
+
+func (r *ndjsonReader) Read(p []byte) (int, error) {
+	for r.pending.Len() == 0 {
+		msg, err := r.stdio.Read()
+		if err != nil {
+			return 0, err
+		}
+		if r.skipOrphans && msg.ID == nil && msg.Method == "" {
+			continue
+		}
+		body, err := json.Marshal(msg)
+		if err != nil {
+			return 0, err
+		}
+		writeFrame(&r.pending, body)
+	}
+	return r.pending.Read(p)
+}
+
+// ndjsonWriter writes the framed messages written to it as newline-delimited
+// JSON, whatever pieces they arrive in.
+type ndjsonWriter struct {
+	stdio *transport.Stdio
+	buf   []byte
+	mu    sync.Mutex
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{stdio: transport.NewStdio(nil, w)}
+}
+
+func (w *ndjsonWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		body, n, err := cutFrame(w.buf)
+		if err != nil || n == 0 {
+			return len(p), err
+		}
+
+		var msg jsonrpc.Message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return 0, fmt.Errorf("parsing message: %w", err)
+		}
+		w.buf = append(w.buf[:0], w.buf[n:]...)
+		if err := w.stdio.Write(&msg); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// autoFraming decides a server's framing by the first byte it writes: '{'
+// for newline-delimited JSON, anything else for Content-Length headers.
+// Servers write nothing before they are sent initialize, so until one has
+// written, messages are sent in a form both kinds read: framed, with a
+// newline after the body that its Content-Length counts. A server reading
+// headers finds the JSON body it expects, trailing whitespace and all; one
+// reading lines finds a header line, which it ignores or answers with an
+// error (see ndjsonReader.skipOrphans), and then the body on a line of its
+// own.
+type autoFraming struct {
+	stdin   io.Writer
+	ndjson  *ndjsonWriter
+	framing atomic.Value // string, once decided
+	buf     []byte
+	mu      sync.Mutex
+}
+
+func newAutoFraming(stdout io.Reader, stdin io.Writer) (io.Reader, io.Writer) {
+	a := &autoFraming{stdin: stdin, ndjson: newNDJSONWriter(stdin)}
+	return &autoReader{src: bufio.NewReader(stdout), auto: a}, a
+}
+
+func (a *autoFraming) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.buf) == 0 {
+		switch a.framing.Load() {
+		case FramingNDJSON:
+			return a.ndjson.Write(p)
+		case FramingLSP:
+			return a.stdin.Write(p)
+		}
+	}
+
+	a.buf = append(a.buf, p...)
+	for {
+		body, n, err := cutFrame(a.buf)
+		if err != nil || n == 0 {
+			return len(p), err
+		}
+		line := append(append([]byte(nil), body...), '\n')
+		a.buf = append(a.buf[:0], a.buf[n:]...)
+		if err := writeFrame(a.stdin, line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// autoReader reads a server's output once its first byte has decided the
+// framing.
+type autoReader struct {
+	src  *bufio.Reader
+	auto *autoFraming
+	r    io.Reader
+}
+
+func (r *autoReader) Read(p []byte) (int, error) {
+	if r.r == nil {
+		first, err := r.firstByte()
+		if err != nil {
+			return 0, err
+		}
+		if first == '{' {
+			r.auto.framing.Store(FramingNDJSON)
+			r.r = &ndjsonReader{stdio: transport.NewStdio(r.src, nil), skipOrphans: true}
+		} else {
+			r.auto.framing.Store(FramingLSP)
+			r.r = r.src
+		}
+	}
+	return r.r.Read(p)
+}
+
+// firstByte returns the first byte the server writes other than whitespace,
+// without consuming it.
+func (r *autoReader) firstByte() (byte, error) {
+	for {
+		b, err := r.src.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			r.src.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+// cutFrame returns the body of the first Content-Length framed message in
+// buf and the length of its frame, or a length of 0 if buf doesn't hold a
+// whole frame yet.
+func cutFrame(buf []byte) ([]byte, int, error) {
+	end := bytes.Index(buf, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, 0, nil
+	}
+	length, err := contentLength(buf[:end])
+	if err != nil {
+		return nil, 0, err
+	}
+	start := end + 4
+	if len(buf) < start+length {
+		return nil, 0, nil
+	}
+	return buf[start : start+length], start + length, nil
+}
+
+// writeFrame writes body with a Content-Length header.
+func writeFrame(w io.Writer, body []byte) error {
+	_, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func contentLength(header []byte) (int, error) {
+	for _, line := range strings.Split(string(header), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			return strconv.Atoi(strings.TrimSpace(value))
+		}
+	}
+	return 0, fmt.Errorf("missing Content-Length header")
+}
@@ -0,0 +1,181 @@
+package subprocess
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+// ndjsonServer answers every request read from in with {"echo": method} on
+// out, one JSON message per line, and lines that aren't JSON with a parse
+// error.
+func ndjsonServer(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var msg jsonrpc.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			fmt.Fprintln(out, `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`)
+			continue
+		}
+		if msg.ID == nil {
+			continue
+		}
+		resp, _ := jsonrpc.NewResponse(*msg.ID, map[string]string{"echo": msg.Method})
+		data, _ := json.Marshal(resp)
+		fmt.Fprintf(out, "%s\n", data)
+	}
+}
+
+// lspServer answers like ndjsonServer but with Content-Length headers.
+func lspServer(in io.Reader, out io.Writer) {
+	stream := jsonrpc.NewStream(in, out)
+	for {
+		msg, err := stream.Read()
+		if err != nil {
+			return
+		}
+		if msg.ID == nil {
+			continue
+		}
+		resp, _ := jsonrpc.NewResponse(*msg.ID, map[string]string{"echo": msg.Method})
+		stream.Write(resp)
+	}
+}
+
+// dapServer answers every DAP request read from in with a response whose
+// body is {"echo": command}.
+func dapServer(in io.Reader, out io.Writer) {
+	r := bufio.NewReader(in)
+	for seq := 1; ; seq++ {
+		body, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		var req dapMessage
+		json.Unmarshal(body, &req)
+		resp, _ := json.Marshal(map[string]any{
+			"seq":         seq,
+			"type":        "response",
+			"request_seq": req.Seq,
+			"success":     true,
+			"command":     req.Command,
+			"body":        map[string]string{"echo": req.Command},
+		})
+		writeFrame(out, resp)
+	}
+}
+
+func callThrough(t *testing.T, framing string, serve func(in io.Reader, out io.Writer)) {
+	t.Helper()
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	t.Cleanup(func() { stdinW.Close(); stdoutW.Close() })
+	go serve(stdinR, stdoutW)
+
+	r, w := FrameStdio(framing, stdoutR, stdinW)
+	conn := jsonrpc.NewConn(r, w, func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		return nil, nil
+	})
+	go conn.Run(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, method := range []string{"initialize", "textDocument/hover"} {
+		result, err := conn.Call(ctx, method, map[string]any{"n": 1})
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		expected := fmt.Sprintf(`{"echo":%q}`, method)
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	}
+}
+
+func TestFrameStdio(t *testing.T) {
+	tests := []struct {
+		name    string
+		framing string
+		serve   func(in io.Reader, out io.Writer)
+	}{
+		{"lsp", FramingLSP, lspServer},
+		{"ndjson", FramingNDJSON, ndjsonServer},
+		{"auto lsp", FramingAuto, lspServer},
+		{"auto ndjson", FramingAuto, ndjsonServer},
+		{"dap", FramingDAP, dapServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callThrough(t, tt.framing, tt.serve)
+		})
+	}
+}
+
+func TestNDJSONWriter_SplitWrites(t *testing.T) {
+	pr, pw := io.Pipe()
+	w := newNDJSONWriter(pw)
+
+	frame := "Content-Length: 40\r\n\r\n" + `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	go func() {
+		for i := 0; i < len(frame); i += 7 {
+			end := min(i+7, len(frame))
+			w.Write([]byte(frame[i:end]))
+		}
+	}()
+
+	line, err := bufio.NewReader(pr).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if line != `{"jsonrpc":"2.0","id":1,"method":"ping"}`+"\n" {
+		t.Errorf("unexpected line %q", line)
+	}
+}
+
+func TestDAPStream_Cancel(t *testing.T) {
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	t.Cleanup(func() { stdinW.Close(); stdoutW.Close() })
+
+	r, w := FrameStdio(FramingDAP, stdoutR, stdinW)
+	conn := NewConn(r, w, nil)
+	go conn.Run(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := conn.Call(ctx, "evaluate", map[string]string{"expression": "x"})
+		errs <- err
+	}()
+
+	adapter := bufio.NewReader(stdinR)
+	body, err := readFrame(adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req dapMessage
+	json.Unmarshal(body, &req)
+	if req.Type != "request" || req.Command != "evaluate" || string(req.Arguments) != `{"expression":"x"}` {
+		t.Fatalf("unexpected request %s", body)
+	}
+
+	cancel()
+	if body, err = readFrame(adapter); err != nil {
+		t.Fatal(err)
+	}
+	var cancelReq dapMessage
+	json.Unmarshal(body, &cancelReq)
+	if cancelReq.Command != "cancel" || string(cancelReq.Arguments) != fmt.Sprintf(`{"requestId":%d}`, req.Seq) {
+		t.Errorf("expected a cancel request for seq %d, got %s", req.Seq, body)
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("expected the call to end cancelled, got %v", err)
+	}
+}
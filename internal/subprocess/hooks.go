@@ -0,0 +1,138 @@
+package subprocess
+
+import (
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// LifecycleEvent describes an instance as it starts, stops, or crashes.
+type LifecycleEvent struct {
+	Name string
+	// Pid is the server's process ID, or 0 if the executor runs no local
+	// process.
+	Pid int
+	// Capabilities are those the server answered initialize with, after
+	// overrides; set for OnStart.
+	Capabilities *lsp.ServerCapabilities
+	// Uptime is how long the server had been running; set for OnStop and
+	// OnCrash.
+	Uptime time.Duration
+	// Err is why the server went down; set for OnCrash.
+	Err error
+
+	inst *LSPInstance
+}
+
+// Hooks subscribe to instance lifecycle events, for subsystems that follow
+// backends (metrics, session persistence, client notifications) without a
+// StateHandler of their own. Nil hooks are skipped.
+//
+// Hooks other than OnRestart run synchronously, in the order they were added,
+// while the pool holds the instance's lock: they must not call the pool's
+// methods for the same instance, and should hand slow work to a goroutine.
+//
+// The pool's own idle tracking, usage sampling, and auto-restart (see
+// poolHooks) are hooks too, run before any added ones.
+type Hooks struct {
+	// OnStart is called once an instance has been initialized and is
+	// running.
+	OnStart func(LifecycleEvent)
+	// OnStop is called once a running instance has been stopped on request.
+	OnStop func(LifecycleEvent)
+	// OnCrash is called when a running instance fails.
+	OnCrash func(LifecycleEvent)
+	// OnRestart is called after the pool has restarted a crashed instance
+	// (see AutoRestart), without the instance lock held, so that state the
+	// server had before it crashed, such as open documents, can be
+	// replayed.
+	OnRestart func(LifecycleEvent)
+}
+
+// AddHooks subscribes h to the lifecycle events of every instance, after
+// any hooks already added.
+func (p *Pool) AddHooks(h Hooks) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hooks = append(p.hooks, h)
+}
+
+// poolHooks are the pool's own lifecycle subscribers: a started instance
+// counts as just used (see StopIdle) and starts its usage sampling over, and
+// a crashed one is restarted as AutoRestart allows.
+func (p *Pool) poolHooks() Hooks {
+	return Hooks{
+		OnStart: func(e LifecycleEvent) {
+			e.inst.touch()
+			e.inst.usage.reset()
+		},
+		OnCrash: func(e LifecycleEvent) {
+			if e.Uptime >= restartStableAfter {
+				e.inst.restarts = 0
+			}
+			if e.inst.State == LSPStateCrashed {
+				p.scheduleRestart(e.inst)
+			}
+		},
+	}
+}
+
+// lifecycleEvent returns the event for inst with the fields every hook is
+// given set. The caller holds inst.mu.
+func lifecycleEvent(inst *LSPInstance) LifecycleEvent {
+	event := LifecycleEvent{Name: inst.Name, inst: inst}
+	if inst.Process != nil {
+		event.Pid = inst.Process.Pid
+	}
+	return event
+}
+
+// runHooks calls the hooks for the transition of inst from one state to
+// another. It must be called with inst.mu held.
+func (p *Pool) runHooks(inst *LSPInstance, from, to LSPState, err error) {
+	p.mu.RLock()
+	hooks := p.hooks
+	p.mu.RUnlock()
+
+	event := lifecycleEvent(inst)
+	var hook func(Hooks) func(LifecycleEvent)
+	switch {
+	case to == LSPStateRunning:
+		event.Capabilities = inst.Capabilities
+		hook = func(h Hooks) func(LifecycleEvent) { return h.OnStart }
+	case from == LSPStateStopping && to == LSPStateStopped:
+		event.Uptime = time.Since(inst.StartedAt)
+		hook = func(h Hooks) func(LifecycleEvent) { return h.OnStop }
+	case from == LSPStateRunning && (to == LSPStateCrashed || to == LSPStateFailed || to == LSPStateDisabled):
+		event.Uptime = time.Since(inst.StartedAt)
+		event.Err = err
+		hook = func(h Hooks) func(LifecycleEvent) { return h.OnCrash }
+	default:
+		return
+	}
+
+	for _, h := range hooks {
+		if f := hook(h); f != nil {
+			f(event)
+		}
+	}
+}
+
+// runRestartHooks calls the OnRestart hooks for inst, which the pool has just
+// restarted. It must be called without inst.mu held.
+func (p *Pool) runRestartHooks(inst *LSPInstance) {
+	p.mu.RLock()
+	hooks := p.hooks
+	p.mu.RUnlock()
+
+	inst.mu.RLock()
+	event := lifecycleEvent(inst)
+	event.Capabilities = inst.Capabilities
+	inst.mu.RUnlock()
+
+	for _, h := range hooks {
+		if h.OnRestart != nil {
+			h.OnRestart(event)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package subprocess
+
+import "time"
+
+// touch records that inst was just used.
+func (inst *LSPInstance) touch() {
+	inst.lastUsed.Store(time.Now().UnixNano())
+}
+
+// IdleFor returns how long it has been since inst was last sent a request
+// or notification, or since it started if it hasn't been.
+func (inst *LSPInstance) IdleFor() time.Duration {
+	return time.Since(time.Unix(0, inst.lastUsed.Load()))
+}
+
+// StopIdle stops the running instances that have been idle for longer than
+// timeout returns for their name and returns the names of those stopped. A
+// timeout of 0 keeps an instance running however long it is idle, and an
+// instance with a request in flight is never idle. A stopped instance
+// starts again on its next request.
+func (p *Pool) StopIdle(timeout func(name string) time.Duration) []string {
+	p.mu.RLock()
+	instances := make([]*LSPInstance, 0, len(p.instances))
+	for _, inst := range p.instances {
+		instances = append(instances, inst)
+	}
+	p.mu.RUnlock()
+
+	var stopped []string
+	for _, inst := range instances {
+		limit := timeout(inst.Name)
+		if limit <= 0 {
+			continue
+		}
+
+		// Only instances that look idle are locked, so one busy starting or
+		// stopping doesn't hold up the sweep; the check is repeated under
+		// the lock.
+		if !inst.idle(limit) {
+			continue
+		}
+		inst.mu.Lock()
+		if inst.State == LSPStateRunning && inst.idle(limit) {
+			p.stop(inst)
+			stopped = append(stopped, inst.Name)
+		}
+		inst.mu.Unlock()
+	}
+	return stopped
+}
+
+// idle reports whether inst has no request in flight and has been idle for
+// longer than limit. It reads only atomics, so it needs no lock.
+func (inst *LSPInstance) idle(limit time.Duration) bool {
+	return inst.active.Load() == 0 && inst.IdleFor() > limit
+}
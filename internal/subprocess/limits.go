@@ -0,0 +1,46 @@
+package subprocess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits caps the resources of a server's process (see
+// config.LSP.MemoryLimit and CPULimit). The zero Limits is no limit.
+type Limits struct {
+	// Memory is the most memory the server may use, in bytes.
+	Memory int64
+	// CPUs is how many CPUs' worth of time the server may use.
+	CPUs float64
+}
+
+func (l Limits) isZero() bool {
+	return l.Memory <= 0 && l.CPUs <= 0
+}
+
+// limitAddressSpace returns the command running path with args under an
+// address-space rlimit (ulimit -v) of limits.Memory: a shell sets it and then
+// execs the server, so it applies whatever the platform, and on the remote
+// machine for a remote server. The server keeps the shell's pid.
+//
+// It is the fallback for where no cgroup enforces memory.max, and a blunt
+// one: it caps the virtual memory a server reserves, not what it uses, and
+// runtimes that reserve far more than they use (V8, the JVM, Go) fail to
+// start under a limit near their working set.
+func limitAddressSpace(path string, args []string, limits Limits) (string, []string) {
+	if limits.Memory <= 0 {
+		return path, args
+	}
+	script := fmt.Sprintf(`ulimit -v %d && exec "$0" "$@"`, max(limits.Memory/1024, 1))
+	return "sh", append([]string{"-c", script, path}, args...)
+}
+
+// cgroupName returns the cgroup directory name for the named instance.
+func cgroupName(name string) string {
+	return "lux-" + strings.Map(func(r rune) rune {
+		if r == '/' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, strings.TrimPrefix(name, "/"))
+}
@@ -0,0 +1,37 @@
+package subprocess
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestLimitAddressSpace(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+
+	path, args := limitAddressSpace("sh", []string{"-c", "ulimit -v; echo $#", "x", "a b"}, Limits{Memory: 512 << 20})
+	proc, err := startProcess(context.Background(), path, args, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := io.ReadAll(proc.Stdout)
+	proc.Wait()
+
+	if got := strings.Fields(string(out)); len(got) != 2 || got[0] != "524288" || got[1] != "1" {
+		t.Errorf("expected the limit in KiB and the arguments intact, got %q", out)
+	}
+
+	if path, args := limitAddressSpace("gopls", []string{"serve"}, Limits{CPUs: 2}); path != "gopls" || len(args) != 1 {
+		t.Errorf("expected no wrapper without a memory limit, got %s %v", path, args)
+	}
+}
+
+func TestCgroupName(t *testing.T) {
+	if got := cgroupName("gopls@/home/me/src"); got != "lux-gopls@_home_me_src" {
+		t.Errorf("expected slashes replaced, got %q", got)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package subprocess
+
+import "strconv"
+
+// niceCommand returns the command running path with args at niceness nice,
+// set by nice(1) before it execs the server, so every thread and child the
+// server starts inherits it. The server keeps nice's pid.
+func niceCommand(path string, args []string, nice int) (string, []string) {
+	if nice == 0 {
+		return path, args
+	}
+	return "nice", append([]string{"-n", strconv.Itoa(nice), path}, args...)
+}
@@ -0,0 +1,37 @@
+package subprocess
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// setNice sets the niceness of process pid. On Linux niceness belongs to
+// each thread, so every task of the process is reniced: threads a server
+// started earlier don't follow the main one. Lowering it again, as when a
+// server regains focus, needs CAP_SYS_NICE or a high enough RLIMIT_NICE.
+func setNice(pid, nice int) error {
+	if pid == 0 {
+		return nil
+	}
+
+	tasks, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(pid), "task"))
+	if err != nil {
+		return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+	}
+
+	var first error
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		// A thread that exits meanwhile is no longer there to renice.
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice); err != nil && !errors.Is(err, syscall.ESRCH) && first == nil {
+			first = err
+		}
+	}
+	return first
+}
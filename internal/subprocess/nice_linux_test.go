@@ -0,0 +1,81 @@
+package subprocess
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// taskNice returns the niceness of every task of process pid.
+func taskNice(t *testing.T, pid int) []int {
+	t.Helper()
+	dir := filepath.Join("/proc", strconv.Itoa(pid), "task")
+	tasks, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nice []int
+	for _, task := range tasks {
+		stat, err := os.ReadFile(filepath.Join(dir, task.Name(), "stat"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Fields after the parenthesized command name start at state.
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		n, err := strconv.Atoi(fields[16])
+		if err != nil {
+			t.Fatal(err)
+		}
+		nice = append(nice, n)
+	}
+	return nice
+}
+
+func TestNice(t *testing.T) {
+	if _, err := exec.LookPath("nice"); err != nil {
+		t.Skip("nice not installed")
+	}
+
+	path, args := niceCommand("sleep", []string{"10"}, 5)
+	cmd := exec.Command(path, args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	// nice sets the niceness, then execs the server.
+	comm := filepath.Join("/proc", strconv.Itoa(cmd.Process.Pid), "comm")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if name, _ := os.ReadFile(comm); strings.TrimSpace(string(name)) == "sleep" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("nice never ran the server")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	base := taskNice(t, os.Getpid())[0]
+	for _, n := range taskNice(t, cmd.Process.Pid) {
+		if n != min(base+5, 19) {
+			t.Errorf("expected the server started at niceness %d, got %d", min(base+5, 19), n)
+		}
+	}
+
+	if err := setNice(cmd.Process.Pid, 19); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range taskNice(t, cmd.Process.Pid) {
+		if n != 19 {
+			t.Errorf("expected every task reniced to 19, got %d", n)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package subprocess
+
+import "errors"
+
+func setNice(pid, nice int) error {
+	if pid == 0 {
+		return nil
+	}
+	return errors.ErrUnsupported
+}
+
+func niceCommand(path string, args []string, nice int) (string, []string) {
+	return path, args
+}
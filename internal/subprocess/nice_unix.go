@@ -0,0 +1,14 @@
+//go:build unix && !linux
+
+package subprocess
+
+import "syscall"
+
+// setNice sets the niceness of process pid, all of its threads included.
+// Lowering it again, as when a server regains focus, needs privileges.
+func setNice(pid, nice int) error {
+	if pid == 0 {
+		return nil
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
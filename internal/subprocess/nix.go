@@ -14,18 +14,26 @@ import (
 type NixExecutor struct {
 	cache   map[string]string
 	cacheMu sync.RWMutex
+
+	// builds persists what cache holds across runs; nil keeps it in memory.
+	builds *nixBuildCache
 }
 
-func NewNixExecutor() *NixExecutor {
-	return &NixExecutor{
-		cache: make(map[string]string),
+// NewNixExecutor returns a NixExecutor whose builds are cached in cacheDir,
+// so that later runs skip evaluating the flakes again. An empty cacheDir
+// keeps builds in memory for this run only.
+func NewNixExecutor(cacheDir string) *NixExecutor {
+	e := &NixExecutor{cache: make(map[string]string)}
+	if cacheDir != "" {
+		e.builds = &nixBuildCache{dir: cacheDir}
 	}
+	return e
 }
 
 func (e *NixExecutor) Build(ctx context.Context, flake, binarySpec string) (string, error) {
-	cacheKey := flake
+	cacheKey := resolveFlakeRef(flake)
 	if binarySpec != "" {
-		cacheKey = flake + "::" + binarySpec
+		cacheKey += "::" + binarySpec
 	}
 
 	e.cacheMu.RLock()
@@ -35,7 +43,30 @@ func (e *NixExecutor) Build(ctx context.Context, flake, binarySpec string) (stri
 	}
 	e.cacheMu.RUnlock()
 
-	cmd := exec.CommandContext(ctx, "nix", "build", flake, "--no-link", "--print-out-paths")
+	var lockHash string
+	var lockErr error
+	if e.builds != nil {
+		// Without the lock, say offline, a cached build beats failing.
+		lockHash, lockErr = flakeLockHash(ctx, flake)
+		if lockErr != nil {
+			fmt.Fprintf(os.Stderr, "[lux] checking flake lock of %s: %v\n", flake, lockErr)
+		}
+		if path, ok := e.builds.lookup(cacheKey, lockHash, lockErr != nil); ok {
+			e.remember(cacheKey, path)
+			return path, nil
+		}
+	}
+
+	// A cached store path is pinned with a GC root so it outlives this run.
+	args := []string{"build", flake, "--no-link", "--print-out-paths"}
+	if e.builds != nil {
+		link := e.builds.outLink(cacheKey)
+		if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+			return "", fmt.Errorf("creating nix GC root directory: %w", err)
+		}
+		args = []string{"build", flake, "--out-link", link, "--print-out-paths"}
+	}
+	cmd := exec.CommandContext(ctx, "nix", args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -57,11 +88,20 @@ func (e *NixExecutor) Build(ctx context.Context, flake, binarySpec string) (stri
 		return "", err
 	}
 
+	e.remember(cacheKey, binPath)
+	if e.builds != nil {
+		if err := e.builds.store(cacheKey, lockHash, binPath); err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] saving nix build cache: %v\n", err)
+		}
+	}
+
+	return binPath, nil
+}
+
+func (e *NixExecutor) remember(cacheKey, binPath string) {
 	e.cacheMu.Lock()
 	e.cache[cacheKey] = binPath
 	e.cacheMu.Unlock()
-
-	return binPath, nil
 }
 
 func findExecutable(storePath, binarySpec string) (string, error) {
@@ -125,6 +165,10 @@ func findExecutable(storePath, binarySpec string) (string, error) {
 }
 
 func (e *NixExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	return startProcess(ctx, path, args, env, workDir)
+}
+
+func startProcess(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
 	cmd := exec.CommandContext(ctx, path, args...)
 
 	if workDir != "" {
@@ -178,18 +222,26 @@ func (e *NixExecutor) Execute(ctx context.Context, path string, args []string, e
 			}
 			return nil
 		},
+		Pid: cmd.Process.Pid,
 	}, nil
 }
 
-func (e *NixExecutor) ClearCache() {
+// ClearCache forgets every build, including those cached across runs, so
+// the next Build of each flake evaluates it again.
+func (e *NixExecutor) ClearCache() error {
 	e.cacheMu.Lock()
 	e.cache = make(map[string]string)
 	e.cacheMu.Unlock()
+
+	if e.builds == nil {
+		return nil
+	}
+	return e.builds.clear()
 }
 
 func (e *NixExecutor) CachedPath(flake string) (string, bool) {
 	e.cacheMu.RLock()
 	defer e.cacheMu.RUnlock()
-	path, ok := e.cache[flake]
+	path, ok := e.cache[resolveFlakeRef(flake)]
 	return path, ok
 }
@@ -1,6 +1,7 @@
 package subprocess
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -171,3 +172,153 @@ func TestFindExecutable_MultipleExecutablesDefaultToFirst(t *testing.T) {
 		t.Errorf("expected one of the executables, got %s", result)
 	}
 }
+
+func TestLocalFlakeDir(t *testing.T) {
+	tests := []struct {
+		flake string
+		dir   string
+		local bool
+	}{
+		{"nixpkgs#gopls", "", false},
+		{"github:amarbel-llc/lux", "", false},
+		{".#gopls", ".", true},
+		{"./tools#gopls", "./tools", true},
+		{"/src/tools", "/src/tools", true},
+		{"path:./tools#gopls", "./tools", true},
+		{"git+file:///src/tools?ref=main#gopls", "/src/tools", true},
+	}
+	for _, tt := range tests {
+		dir, local := localFlakeDir(tt.flake)
+		if dir != tt.dir || local != tt.local {
+			t.Errorf("localFlakeDir(%q) = %q, %v, want %q, %v", tt.flake, dir, local, tt.dir, tt.local)
+		}
+	}
+}
+
+// fakeNix puts a nix on PATH whose builds print storePath and counts them
+// in the returned file, and whose flake metadata is read from the file
+// next to it named metadata.
+func fakeNix(t *testing.T, storePath string) string {
+	t.Helper()
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = flake ]; then cat " + filepath.Join(dir, "metadata") + "; exit; fi\n" +
+		"echo >> " + calls + "\necho " + storePath + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "nix"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	setNixMetadata(t, calls, `{"locked": {"rev": "a"}}`)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+// setNixMetadata sets what the fake nix whose builds are counted in calls
+// reports as flake metadata.
+func setNixMetadata(t *testing.T, calls, metadata string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(filepath.Dir(calls), "metadata"), []byte(metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func nixBuilds(t *testing.T, calls string) int {
+	t.Helper()
+	data, err := os.ReadFile(calls)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return len(data)
+}
+
+func TestNixExecutor_PersistentCache(t *testing.T) {
+	storePath := t.TempDir()
+	if err := os.Mkdir(filepath.Join(storePath, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	execPath := filepath.Join(storePath, "bin", "gopls")
+	if err := os.WriteFile(execPath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	calls := fakeNix(t, storePath)
+
+	flakeDir := t.TempDir()
+	lock := filepath.Join(flakeDir, "flake.lock")
+	if err := os.WriteFile(lock, []byte(`{"version": 7}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stateDir := t.TempDir()
+	build := func(flake string) {
+		t.Helper()
+		e := &NixExecutor{cache: make(map[string]string), builds: &nixBuildCache{dir: stateDir}}
+		path, err := e.Build(context.Background(), flake, "")
+		if err != nil {
+			t.Fatalf("Build(%q): %v", flake, err)
+		}
+		if path != execPath {
+			t.Errorf("Build(%q) = %q, want %q", flake, path, execPath)
+		}
+	}
+
+	local := flakeDir + "#gopls"
+	build(local)
+	build(local)
+	build("nixpkgs#gopls")
+	build("nixpkgs#gopls")
+	if n := nixBuilds(t, calls); n != 2 {
+		t.Errorf("nix build ran %d times, want 2 (once per flake)", n)
+	}
+
+	if err := os.WriteFile(lock, []byte(`{"version": 7, "nodes": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	build(local)
+	build("nixpkgs#gopls")
+	if n := nixBuilds(t, calls); n != 3 {
+		t.Errorf("nix build ran %d times, want 3 (again for the changed lock)", n)
+	}
+
+	setNixMetadata(t, calls, `{"locked": {"rev": "b"}}`)
+	build("nixpkgs#gopls")
+	build(local)
+	if n := nixBuilds(t, calls); n != 4 {
+		t.Errorf("nix build ran %d times, want 4 (again for the updated upstream flake)", n)
+	}
+
+	setNixMetadata(t, calls, "")
+	build("nixpkgs#gopls")
+	if n := nixBuilds(t, calls); n != 4 {
+		t.Errorf("nix build ran %d times, want 4 (the cached build while the lock can't be read)", n)
+	}
+
+	e := &NixExecutor{cache: make(map[string]string), builds: &nixBuildCache{dir: stateDir}}
+	if err := e.ClearCache(); err != nil {
+		t.Fatal(err)
+	}
+	build("nixpkgs#gopls")
+	if n := nixBuilds(t, calls); n != 5 {
+		t.Errorf("nix build ran %d times, want 5 (again after ClearCache)", n)
+	}
+}
+
+func TestResolveFlakeRef(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		flake    string
+		expected string
+	}{
+		{"nixpkgs#gopls", "nixpkgs#gopls"},
+		{"/src/tools#gopls", "/src/tools#gopls"},
+		{".#gopls", cwd + "#gopls"},
+		{"path:./tools#gopls", "path:" + filepath.Join(cwd, "tools") + "#gopls"},
+	}
+	for _, tt := range tests {
+		if got := resolveFlakeRef(tt.flake); got != tt.expected {
+			t.Errorf("resolveFlakeRef(%q) = %q, want %q", tt.flake, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// nixBuildCache remembers across runs the store paths nix builds resolved
+// to, so that starting a server again doesn't evaluate its flake. Entries
+// are keyed by flake reference, with a local flake's directory made
+// absolute, and binary. Each entry also records a hash of the flake's lock
+// (see flakeLockHash) and is dropped once it changes. Each store path is pinned with a GC root
+// under the cache's directory so garbage collection doesn't remove it.
+type nixBuildCache struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+// nixCacheEntry is one build in the cache file.
+type nixCacheEntry struct {
+	LockHash string `json:"lock_hash,omitempty"`
+	Path     string `json:"path"`
+}
+
+func (c *nixBuildCache) file() string {
+	return filepath.Join(c.dir, "nix-builds.json")
+}
+
+// outLink returns where the GC root of the build with key is kept.
+func (c *nixBuildCache) outLink(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, "gcroots", hex.EncodeToString(sum[:8]))
+}
+
+// lookup returns the executable cached for key if it is still current: the
+// flake's lock hash is unchanged, or anyLock when the lock couldn't be
+// checked, and the path still exists.
+func (c *nixBuildCache) lookup(key, lockHash string, anyLock bool) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.load()[key]
+	if !ok || (entry.LockHash != lockHash && !anyLock) {
+		return "", false
+	}
+	if _, err := os.Stat(entry.Path); err != nil {
+		return "", false
+	}
+	return entry.Path, true
+}
+
+// store records the executable key resolved to.
+func (c *nixBuildCache) store(key, lockHash, path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := c.load()
+	entries[key] = nixCacheEntry{LockHash: lockHash, Path: path}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	tmp := c.file() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.file())
+}
+
+// clear removes the cache file and the GC roots it kept.
+func (c *nixBuildCache) clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := os.Remove(c.file())
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return errors.Join(err, os.RemoveAll(filepath.Join(c.dir, "gcroots")))
+}
+
+// load reads the cache file. A missing or unreadable file is an empty cache.
+// The caller holds c.mu.
+func (c *nixBuildCache) load() map[string]nixCacheEntry {
+	entries := make(map[string]nixCacheEntry)
+	data, err := os.ReadFile(c.file())
+	if err != nil {
+		return entries
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] ignoring unreadable nix build cache %s: %v\n", c.file(), err)
+		return make(map[string]nixCacheEntry)
+	}
+	return entries
+}
+
+// flakeLockHash returns a hash identifying the locked revision of flake: of
+// the flake.nix and flake.lock of a flake on the local filesystem, or of
+// the locked source `nix flake metadata` resolves any other reference to, so
+// that a cached build is dropped once the flake is updated upstream.
+func flakeLockHash(ctx context.Context, flake string) (string, error) {
+	if dir, ok := localFlakeDir(flake); ok {
+		return localFlakeLockHash(dir)
+	}
+
+	ref, _, _ := strings.Cut(flake, "#")
+	cmd := exec.CommandContext(ctx, "nix", "flake", "metadata", "--json", ref)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("nix flake metadata: %w\n%s", err, stderr.String())
+	}
+	var metadata struct {
+		Locked json.RawMessage `json:"locked"`
+	}
+	if err := json.Unmarshal(out, &metadata); err != nil {
+		return "", fmt.Errorf("reading nix flake metadata: %w", err)
+	}
+	if len(metadata.Locked) == 0 {
+		return "", fmt.Errorf("nix flake metadata has no locked source for %s", ref)
+	}
+	sum := sha256.Sum256(metadata.Locked)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func localFlakeLockHash(dir string) (string, error) {
+	h := sha256.New()
+	for _, name := range []string{"flake.nix", "flake.lock"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resolveFlakeRef returns flake with a relative local directory made
+// absolute, so that ".#gopls" in two projects are two cache entries.
+func resolveFlakeRef(flake string) string {
+	dir, ok := localFlakeDir(flake)
+	if !ok || filepath.IsAbs(dir) {
+		return flake
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return flake
+	}
+	return strings.Replace(flake, dir, abs, 1)
+}
+
+// localFlakeDir returns the directory of a flake reference such as
+// ".#gopls", "/src/tools", or "path:./tools#gopls", and whether it refers
+// to one at all.
+func localFlakeDir(flake string) (string, bool) {
+	ref, _, _ := strings.Cut(flake, "#")
+	ref, _, _ = strings.Cut(ref, "?")
+	for _, scheme := range []string{"path:", "git+file://", "git+file:"} {
+		if rest, ok := strings.CutPrefix(ref, scheme); ok {
+			return rest, rest != ""
+		}
+	}
+	if strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, ".") {
+		return ref, true
+	}
+	return "", false
+}
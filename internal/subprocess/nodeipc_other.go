@@ -0,0 +1,13 @@
+//go:build !unix
+
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+func startNodeIPC(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	return nil, fmt.Errorf("the node-ipc transport: %w", errors.ErrUnsupported)
+}
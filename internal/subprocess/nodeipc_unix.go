@@ -0,0 +1,69 @@
+//go:build unix
+
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startNodeIPC starts a server that talks over a Node.js IPC channel, as
+// vscode-languageserver servers do when passed --node-ipc. The channel is one
+// end of a socket pair, handed to the server as NODE_CHANNEL_FD, and carries
+// newline-delimited JSON. The server's stdout and stderr are only logged.
+func startNodeIPC(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("creating IPC channel: %w", err)
+	}
+	channel := os.NewFile(uintptr(fds[0]), "node-ipc")
+	serverEnd := os.NewFile(uintptr(fds[1]), "node-ipc-server")
+	defer serverEnd.Close()
+
+	output, outputW, err := os.Pipe()
+	if err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("creating output pipe: %w", err)
+	}
+	defer outputW.Close()
+
+	cmd := exec.CommandContext(ctx, path, append(append([]string(nil), args...), "--node-ipc")...)
+	cmd.Dir = workDir
+	// ExtraFiles start at fd 3.
+	cmd.Env = append(os.Environ(), "NODE_CHANNEL_FD=3", "NODE_CHANNEL_SERIALIZATION_MODE=json")
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	cmd.ExtraFiles = []*os.File{serverEnd}
+	cmd.Stdout = outputW
+	cmd.Stderr = outputW
+
+	if err := cmd.Start(); err != nil {
+		channel.Close()
+		output.Close()
+		return nil, fmt.Errorf("starting process: %w", err)
+	}
+
+	return &Process{
+		Stdin:  channel,
+		Stdout: channel,
+		Stderr: output,
+		Wait:   cmd.Wait,
+		Kill: func() error {
+			if cmd.Process != nil {
+				return cmd.Process.Kill()
+			}
+			return nil
+		},
+		Pid: cmd.Process.Pid,
+	}, nil
+}
@@ -0,0 +1,198 @@
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PathMapping maps a directory on the host to where a server sees it, for
+// servers running in a container or another mount namespace (see
+// config.LSP.PathMappings).
+type PathMapping struct {
+	Host    string
+	Backend string
+}
+
+// pathMap rewrites paths in one direction, longest prefix first.
+type pathMap []pathMapEntry
+
+type pathMapEntry struct {
+	from, to string
+}
+
+// newPathMaps returns the host-to-backend and backend-to-host maps of
+// mappings.
+func newPathMaps(mappings []PathMapping) (toBackend, toHost pathMap) {
+	for _, m := range mappings {
+		host, backend := path.Clean(m.Host), path.Clean(m.Backend)
+		toBackend = append(toBackend, pathMapEntry{from: host, to: backend})
+		toHost = append(toHost, pathMapEntry{from: backend, to: host})
+	}
+	for _, m := range []pathMap{toBackend, toHost} {
+		sort.SliceStable(m, func(i, j int) bool { return len(m[i].from) > len(m[j].from) })
+	}
+	return toBackend, toHost
+}
+
+// path maps p by the first entry whose directory contains it.
+func (m pathMap) path(p string) string {
+	for _, e := range m {
+		if e.from == "/" {
+			return path.Join(e.to, p)
+		}
+		rest, ok := strings.CutPrefix(p, e.from)
+		if ok && (rest == "" || rest[0] == '/') {
+			return e.to + rest
+		}
+	}
+	return p
+}
+
+// uri maps the path of a file URI, leaving other strings alone.
+func (m pathMap) uri(s string) string {
+	p, ok := strings.CutPrefix(s, "file://")
+	if !ok {
+		return s
+	}
+	return "file://" + m.path(p)
+}
+
+// rewrite maps the file URIs in a decoded JSON value: string values, object
+// keys (a WorkspaceEdit's changes are keyed by URI), and initialize's
+// rootPath.
+func (m pathMap) rewrite(v any) any {
+	switch v := v.(type) {
+	case string:
+		return m.uri(v)
+	case []any:
+		for i := range v {
+			v[i] = m.rewrite(v[i])
+		}
+		return v
+	case map[string]any:
+		rewritten := make(map[string]any, len(v))
+		for k, val := range v {
+			if s, ok := val.(string); ok && k == "rootPath" {
+				rewritten[k] = m.path(s)
+				continue
+			}
+			rewritten[m.uri(k)] = m.rewrite(val)
+		}
+		return rewritten
+	}
+	return v
+}
+
+// message returns body with its file URIs mapped. Messages that can't hold
+// any are returned as they are.
+func (m pathMap) message(body []byte) ([]byte, error) {
+	if !bytes.Contains(body, []byte("file:")) && !bytes.Contains(body, []byte(`"rootPath"`)) {
+		return body, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var msg any
+	if err := dec.Decode(&msg); err != nil {
+		return nil, fmt.Errorf("parsing message: %w", err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(m.rewrite(msg)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// mapPaths wraps a server's framed stdout and stdin so that file URIs are
+// seen by the server under its own paths and by lux under the host's.
+func mapPaths(mappings []PathMapping, stdout io.Reader, stdin io.Writer) (io.Reader, io.Writer) {
+	toBackend, toHost := newPathMaps(mappings)
+	return &pathMapReader{src: bufio.NewReader(stdout), m: toHost},
+		&pathMapWriter{dst: stdin, m: toBackend}
+}
+
+// pathMapReader maps the messages of a framed stream as they are read.
+type pathMapReader struct {
+	src     *bufio.Reader
+	m       pathMap
+	pending bytes.Buffer
+}
+
+func (r *pathMapReader) Read(p []byte) (int, error) {
+	if r.pending.Len() == 0 {
+		var header bytes.Buffer
+		for {
+			line, err := r.src.ReadBytes('\n')
+			if err != nil {
+				return 0, err
+			}
+			if len(bytes.TrimSpace(line)) == 0 {
+				break
+			}
+			header.Write(line)
+		}
+		length, err := contentLength(bytes.TrimRight(header.Bytes(), "\r\n"))
+		if err != nil {
+			return 0, err
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r.src, body); err != nil {
+			return 0, err
+		}
+		if body, err = r.m.message(body); err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(&r.pending, "Content-Length: %d\r\n\r\n", len(body))
+		r.pending.Write(body)
+	}
+	return r.pending.Read(p)
+}
+
+// pathMapWriter maps the framed messages written to it, whatever pieces
+// they arrive in.
+type pathMapWriter struct {
+	dst io.Writer
+	m   pathMap
+	buf []byte
+	mu  sync.Mutex
+}
+
+func (w *pathMapWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		end := bytes.Index(w.buf, []byte("\r\n\r\n"))
+		if end < 0 {
+			return len(p), nil
+		}
+		length, err := contentLength(w.buf[:end])
+		if err != nil {
+			return 0, err
+		}
+		start := end + 4
+		if len(w.buf) < start+length {
+			return len(p), nil
+		}
+
+		body, err := w.m.message(w.buf[start : start+length])
+		if err != nil {
+			return 0, err
+		}
+		if _, err := fmt.Fprintf(w.dst, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[start+length:]...)
+	}
+}
@@ -0,0 +1,139 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+func TestPathMap(t *testing.T) {
+	toBackend, toHost := newPathMaps([]PathMapping{
+		{Host: "/home/me/src", Backend: "/workspace"},
+		{Host: "/home/me/src/vendor", Backend: "/deps"},
+	})
+
+	tests := []struct {
+		name     string
+		m        pathMap
+		body     string
+		expected string
+	}{
+		{
+			name:     "document URI",
+			m:        toBackend,
+			body:     `{"jsonrpc":"2.0","id":1,"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///home/me/src/main.go"},"position":{"line":3,"character":4}}}`,
+			expected: `{"id":1,"jsonrpc":"2.0","method":"textDocument/hover","params":{"position":{"character":4,"line":3},"textDocument":{"uri":"file:///workspace/main.go"}}}`,
+		},
+		{
+			name:     "longest prefix wins",
+			m:        toBackend,
+			body:     `{"uri":"file:///home/me/src/vendor/lib/a.go"}`,
+			expected: `{"uri":"file:///deps/lib/a.go"}`,
+		},
+		{
+			name:     "sibling directory with a shared prefix",
+			m:        toBackend,
+			body:     `{"uri":"file:///home/me/src2/a.go"}`,
+			expected: `{"uri":"file:///home/me/src2/a.go"}`,
+		},
+		{
+			name:     "initialize root",
+			m:        toBackend,
+			body:     `{"rootPath":"/home/me/src","rootUri":"file:///home/me/src","workspaceFolders":[{"uri":"file:///home/me/src","name":"src"}]}`,
+			expected: `{"rootPath":"/workspace","rootUri":"file:///workspace","workspaceFolders":[{"name":"src","uri":"file:///workspace"}]}`,
+		},
+		{
+			name:     "WorkspaceEdit keys",
+			m:        toHost,
+			body:     `{"changes":{"file:///workspace/a.go":[{"newText":"x"}]}}`,
+			expected: `{"changes":{"file:///home/me/src/a.go":[{"newText":"x"}]}}`,
+		},
+		{
+			name:     "large IDs survive",
+			m:        toHost,
+			body:     `{"id":9007199254740993,"result":{"uri":"file:///workspace/a.go"}}`,
+			expected: `{"id":9007199254740993,"result":{"uri":"file:///home/me/src/a.go"}}`,
+		},
+		{
+			name:     "no file URIs",
+			m:        toHost,
+			body:     `{"id":1, "result":null}`,
+			expected: `{"id":1, "result":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.message([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// paramsServer answers every request with the params it received, which it
+// also sends on seen.
+func paramsServer(in io.Reader, out io.Writer, seen chan<- json.RawMessage) {
+	stream := jsonrpc.NewStream(in, out)
+	for {
+		msg, err := stream.Read()
+		if err != nil {
+			return
+		}
+		if msg.ID == nil {
+			continue
+		}
+		seen <- msg.Params
+		resp, _ := jsonrpc.NewResponse(*msg.ID, map[string]any{"received": msg.Params})
+		stream.Write(resp)
+	}
+}
+
+func TestMapPaths(t *testing.T) {
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	t.Cleanup(func() { stdinW.Close(); stdoutW.Close() })
+	seen := make(chan json.RawMessage, 1)
+	go paramsServer(stdinR, stdoutW, seen)
+
+	r, w := mapPaths([]PathMapping{{Host: "/home/me/src", Backend: "/workspace"}}, stdoutR, stdinW)
+	conn := jsonrpc.NewConn(r, w, func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		return nil, nil
+	})
+	go conn.Run(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := conn.Call(ctx, "textDocument/definition", map[string]any{
+		"textDocument": map[string]string{"uri": "file:///home/me/src/main.go"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params := string(<-seen); params != `{"textDocument":{"uri":"file:///workspace/main.go"}}` {
+		t.Errorf("expected the server to see /workspace, got %s", params)
+	}
+
+	var got struct {
+		Received struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		} `json:"received"`
+	}
+	if err := json.Unmarshal(result, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Received.TextDocument.URI != "file:///home/me/src/main.go" {
+		t.Errorf("expected the host URI back, got %s", result)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
@@ -21,8 +24,24 @@ const (
 	LSPStateStopping
 	LSPStateStopped
 	LSPStateFailed
+	// LSPStateCrashed means a running instance's process died or its
+	// connection broke. The pool restarts it if auto-restart is on (see
+	// AutoRestart); otherwise the next request does.
+	LSPStateCrashed
+	// LSPStateDisabled means the restart circuit breaker tripped; the
+	// instance is not started again until ResetFailures.
+	LSPStateDisabled
 )
 
+func isLSPState(name string) bool {
+	for state := LSPStateIdle; state <= LSPStateDisabled; state++ {
+		if state.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (s LSPState) String() string {
 	switch s {
 	case LSPStateIdle:
@@ -37,6 +56,10 @@ func (s LSPState) String() string {
 		return "stopped"
 	case LSPStateFailed:
 		return "failed"
+	case LSPStateCrashed:
+		return "crashed"
+	case LSPStateDisabled:
+		return "disabled"
 	default:
 		return "unknown"
 	}
@@ -52,14 +75,33 @@ type LSPInstance struct {
 	Settings     map[string]any
 	SettingsKey  string
 	CapOverrides *CapabilityOverride
+	Framing      string
 	State        LSPState
 	Process      *Process
-	Conn         *jsonrpc.Conn
+	Conn         *Conn
 	Capabilities *lsp.ServerCapabilities
 	StartedAt    time.Time
 	Error        error
 
 	knownFolders map[string]bool
+	initSettings bool
+	pathMappings []PathMapping
+	remote       string
+	command      string
+	transport    Transport
+	onCall       CallHandler
+	failures     []time.Time
+	initParams   *lsp.InitializeParams
+	restarts     int
+	restartTimer *time.Timer
+	lastUsed     atomic.Int64
+	active       atomic.Int32
+	unhealthy    bool
+	stderrTail   *tailBuffer
+	requires     func() error
+	nice         int
+	limits       Limits
+	usage        usageSampler
 	mu           sync.RWMutex
 	ctx          context.Context
 	cancel       context.CancelFunc
@@ -73,37 +115,326 @@ type CapabilityOverride struct {
 // HandlerFactory creates a jsonrpc.Handler for a specific LSP instance by name.
 type HandlerFactory func(lspName string) jsonrpc.Handler
 
+// StateHandler is notified of instance state transitions. It is called with
+// the instance lock held and must not call back into the pool.
+type StateHandler func(name string, from, to LSPState, err error)
+
+// CallHandler is notified of every request sent to an instance via Call.
+type CallHandler func(name, method string)
+
 type Pool struct {
 	executor       Executor
 	instances      map[string]*LSPInstance
 	mu             sync.RWMutex
 	handlerFactory HandlerFactory
+	extraFactories []HandlerFactory
+	dispatch       func(lspName string) Dispatch
+	stateHandler   StateHandler
+	callHandler    CallHandler
+	hooks          []Hooks
+	restartPolicy  RestartPolicy
+	autoRestart    AutoRestart
 }
 
 func NewPool(executor Executor, handlerFactory HandlerFactory) *Pool {
-	return &Pool{
+	p := &Pool{
 		executor:       executor,
 		instances:      make(map[string]*LSPInstance),
 		handlerFactory: handlerFactory,
+		restartPolicy:  DefaultRestartPolicy,
+	}
+	p.hooks = []Hooks{p.poolHooks()}
+	return p
+}
+
+// AddHandlerFactory attaches another consumer of backend messages, for when
+// several frontends in one process share the pool. Notifications are delivered
+// to every handler; requests go to each handler in turn until one responds.
+// Instances started before the call keep their existing handlers.
+func (p *Pool) AddHandlerFactory(f HandlerFactory) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.extraFactories = append(p.extraFactories, f)
+}
+
+func (p *Pool) connHandler(name string) jsonrpc.Handler {
+	p.mu.RLock()
+	handlers := []jsonrpc.Handler{p.handlerFactory(name)}
+	for _, f := range p.extraFactories {
+		handlers = append(handlers, f(name))
+	}
+	p.mu.RUnlock()
+
+	if len(handlers) == 1 {
+		return handlers[0]
+	}
+
+	return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		if !msg.IsRequest() {
+			for _, h := range handlers {
+				h(ctx, msg)
+			}
+			return nil, nil
+		}
+
+		for _, h := range handlers {
+			resp, err := h(ctx, msg)
+			if resp != nil || err != nil {
+				return resp, err
+			}
+		}
+		return nil, nil
+	}
+}
+
+// SetStateHandler installs a handler for instance state transitions. It must
+// be called before any instance is started.
+func (p *Pool) SetStateHandler(h StateHandler) {
+	p.stateHandler = h
+}
+
+// SetDispatch installs f to give each instance's connection the Dispatch it
+// runs the backend's requests and notifications through (see
+// Conn.SetDispatch). It takes effect for instances started afterwards.
+func (p *Pool) SetDispatch(f func(lspName string) Dispatch) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dispatch = f
+}
+
+// SetCallHandler installs a handler observing requests made through
+// LSPInstance.Call. It takes effect for instances started afterwards.
+func (p *Pool) SetCallHandler(h CallHandler) {
+	p.callHandler = h
+}
+
+// SetRestartPolicy configures the restart circuit breaker. A policy with
+// MaxFailures <= 0 never disables instances.
+func (p *Pool) SetRestartPolicy(policy RestartPolicy) {
+	p.restartPolicy = policy
+}
+
+// ResetFailures clears the failure history of the named LSP, re-enabling it
+// if its circuit breaker had tripped.
+func (p *Pool) ResetFailures(name string) error {
+	p.mu.RLock()
+	inst, ok := p.instances[name]
+	p.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("unknown LSP: %s", name)
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	inst.failures = nil
+	inst.restarts = 0
+	if inst.State == LSPStateDisabled {
+		p.setState(inst, LSPStateIdle, nil)
+		inst.Error = nil
+	}
+	return nil
+}
+
+// setState must be called with inst.mu held. Entering LSPStateFailed or
+// LSPStateCrashed counts against the restart policy and becomes
+// LSPStateDisabled when it trips.
+func (p *Pool) setState(inst *LSPInstance, state LSPState, err error) {
+	if (state == LSPStateFailed || state == LSPStateCrashed) && p.restartPolicy.recordFailure(inst, time.Now()) {
+		state = LSPStateDisabled
+		disabled := &DisabledError{
+			Name:      inst.Name,
+			Failures:  len(inst.failures),
+			Window:    p.restartPolicy.Window,
+			LastError: err,
+		}
+		if inst.stderrTail != nil {
+			disabled.StderrTail = inst.stderrTail.String()
+		}
+		err = disabled
+	}
+
+	from := inst.State
+	inst.State = state
+	if err != nil {
+		inst.Error = err
+	}
+	if from == state {
+		return
+	}
+	if p.stateHandler != nil {
+		p.stateHandler(inst.Name, from, state, err)
+	}
+	p.runHooks(inst, from, state, err)
+}
+
+// Registration is what the pool needs to start an LSP's server.
+type Registration struct {
+	Flake        string
+	Binary       string
+	Args         []string
+	Env          map[string]string
+	InitOptions  map[string]any
+	Settings     map[string]any
+	SettingsKey  string
+	CapOverrides *CapabilityOverride
+	Framing      string
+	// InitSettings also sends Settings in initializationOptions.
+	InitSettings bool
+	// PathMappings are applied to the file URIs exchanged with the server.
+	PathMappings []PathMapping
+	// Remote runs the server on another machine, reached at an ssh:// URL.
+	Remote string
+	// Command runs the server as given instead of building its flake or
+	// binary with the pool's executor.
+	Command   string
+	Transport Transport
+	Limits    Limits
+	// Requires, if set, is checked before each start. While it returns an
+	// error the server isn't started, and the error is returned by
+	// GetOrStart and shown in its status.
+	Requires func() error
+}
+
+func (r Registration) validate() error {
+	if r.Remote != "" {
+		if _, err := parseRemote(r.Remote); err != nil {
+			return err
+		}
+	}
+	switch r.Transport.Kind {
+	case "", TransportStdio, TransportNodeIPC:
+	case TransportTCP, TransportUnix:
+		if r.Transport.Address == "" {
+			return fmt.Errorf("%s transport needs an address", r.Transport.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown transport %q", r.Transport.Kind)
 	}
+	return nil
 }
 
-func (p *Pool) Register(name, flake, binary string, args []string, env map[string]string, initOpts map[string]any, settings map[string]any, settingsKey string, capOverrides *CapabilityOverride) {
+// Register adds the LSP described by r to the pool under name, idle until it
+// is first started. An invalid r is reported and nothing is registered.
+func (p *Pool) Register(name string, r Registration) error {
+	if err := r.validate(); err != nil {
+		return fmt.Errorf("registering %s: %w", name, err)
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	p.instances[name] = &LSPInstance{
 		Name:         name,
-		Flake:        flake,
-		Binary:       binary,
-		Args:         args,
-		Env:          env,
-		InitOptions:  initOpts,
-		Settings:     settings,
-		SettingsKey:  settingsKey,
-		CapOverrides: capOverrides,
+		Flake:        r.Flake,
+		Binary:       r.Binary,
+		Args:         r.Args,
+		Env:          r.Env,
+		InitOptions:  r.InitOptions,
+		Settings:     r.Settings,
+		SettingsKey:  r.SettingsKey,
+		CapOverrides: r.CapOverrides,
+		Framing:      r.Framing,
 		State:        LSPStateIdle,
+		initSettings: r.InitSettings,
+		pathMappings: r.PathMappings,
+		remote:       r.Remote,
+		command:      r.Command,
+		transport:    r.Transport,
+		limits:       r.Limits,
+		requires:     r.Requires,
+	}
+	return nil
+}
+
+// checkRequires runs inst's Requires check if it is about to be started,
+// recording a failure as its error. The check runs without the instance
+// locked, since it may look at the workspace or call back into the pool.
+func (p *Pool) checkRequires(inst *LSPInstance) error {
+	inst.mu.RLock()
+	starting := inst.State != LSPStateRunning && inst.State != LSPStateStarting && inst.State != LSPStateDisabled
+	requires := inst.requires
+	inst.mu.RUnlock()
+
+	if !starting || requires == nil {
+		return nil
+	}
+	err := requires()
+	if err != nil {
+		inst.mu.Lock()
+		inst.Error = err
+		inst.mu.Unlock()
+	}
+	return err
+}
+
+// Unregister stops the named LSP if it is running and removes it from the
+// pool.
+func (p *Pool) Unregister(name string) error {
+	if err := p.Stop(name); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.instances, name)
+	return nil
+}
+
+// SetNice sets the scheduling niceness of the named LSP's process, now if
+// it is running and whenever it starts. Processes without a Pid are left
+// alone. The niceness is only recorded once it has been applied, so a
+// failure (such as lowering it without privileges) leaves the previous
+// value in place.
+func (p *Pool) SetNice(name string, nice int) error {
+	p.mu.RLock()
+	inst, ok := p.instances[name]
+	p.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown LSP: %s", name)
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.nice == nice {
+		return nil
+	}
+	if inst.State == LSPStateRunning && inst.Process != nil {
+		if err := setNice(inst.Process.Pid, nice); err != nil {
+			return err
+		}
 	}
+	inst.nice = nice
+	return nil
+}
+
+// UpdateSettings replaces the settings for the named LSP and, if it is
+// running, pushes them via workspace/didChangeConfiguration.
+func (p *Pool) UpdateSettings(name string, settings map[string]any, settingsKey string) error {
+	p.mu.RLock()
+	inst, ok := p.instances[name]
+	p.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("unknown LSP: %s", name)
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	inst.Settings = settings
+	inst.SettingsKey = settingsKey
+
+	if inst.State != LSPStateRunning {
+		return nil
+	}
+
+	return inst.Conn.Notify(lsp.MethodWorkspaceDidChangeConfiguration, map[string]any{
+		"settings": map[string]any{
+			settingsKey: settings,
+		},
+	})
 }
 
 func (p *Pool) Get(name string) (*LSPInstance, bool) {
@@ -113,6 +444,21 @@ func (p *Pool) Get(name string) (*LSPInstance, bool) {
 	return inst, ok
 }
 
+// State returns the current state of the named LSP.
+func (p *Pool) State(name string) (LSPState, bool) {
+	p.mu.RLock()
+	inst, ok := p.instances[name]
+	p.mu.RUnlock()
+
+	if !ok {
+		return LSPStateIdle, false
+	}
+
+	inst.mu.RLock()
+	defer inst.mu.RUnlock()
+	return inst.State, true
+}
+
 func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.InitializeParams) (*LSPInstance, error) {
 	p.mu.RLock()
 	inst, ok := p.instances[name]
@@ -122,6 +468,10 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 		return nil, fmt.Errorf("unknown LSP: %s", name)
 	}
 
+	if err := p.checkRequires(inst); err != nil {
+		return nil, err
+	}
+
 	inst.mu.Lock()
 	defer inst.mu.Unlock()
 
@@ -137,7 +487,7 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 			if inst.State == LSPStateRunning {
 				return inst, nil
 			}
-			if inst.State == LSPStateFailed {
+			if inst.State == LSPStateFailed || inst.State == LSPStateDisabled {
 				err := inst.Error
 				inst.mu.Unlock()
 				return nil, err
@@ -146,37 +496,62 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 		}
 	}
 
-	inst.State = LSPStateStarting
-	inst.ctx, inst.cancel = context.WithCancel(ctx)
-
-	binPath, err := p.executor.Build(inst.ctx, inst.Flake, inst.Binary)
-	if err != nil {
-		inst.State = LSPStateFailed
-		inst.Error = err
-		return nil, fmt.Errorf("building %s: %w", name, err)
+	if inst.State == LSPStateDisabled {
+		return nil, inst.Error
 	}
 
-	var workDir string
-	if initParams != nil && initParams.RootPath != nil {
-		workDir = *initParams.RootPath
-	}
+	p.setState(inst, LSPStateStarting, nil)
+	inst.ctx, inst.cancel = context.WithCancel(ctx)
+	inst.onCall = p.callHandler
+	inst.initParams = initParams
 
-	proc, err := p.executor.Execute(inst.ctx, binPath, inst.Args, inst.Env, workDir)
+	proc, err := p.connect(inst, initParams)
 	if err != nil {
-		inst.State = LSPStateFailed
-		inst.Error = err
-		return nil, fmt.Errorf("executing %s: %w", name, err)
+		p.setState(inst, LSPStateFailed, err)
+		return nil, err
 	}
 
 	inst.Process = proc
-	go NewStderrLogger(name, os.Stderr).Run(proc.Stderr)
-	inst.Conn = jsonrpc.NewConn(proc.Stdout, proc.Stdin, p.handlerFactory(name))
+	if err := limitCgroup(name, proc.Pid, inst.limits); err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] limiting %s: %v\n", name, err)
+	}
+	inst.stderrTail = &tailBuffer{}
+	go NewStderrLogger(name, os.Stderr).Run(io.TeeReader(proc.Stderr, inst.stderrTail))
+	framing := inst.Framing
+	if inst.transport.Kind == TransportNodeIPC {
+		framing = FramingNDJSON
+	}
+	stdout, stdin := FrameStdio(framing, proc.Stdout, proc.Stdin)
+	if len(inst.pathMappings) > 0 {
+		stdout, stdin = mapPaths(inst.pathMappings, stdout, stdin)
+	}
+	conn := NewConn(stdout, stdin, p.connHandler(name))
+	p.mu.RLock()
+	if p.dispatch != nil {
+		conn.SetDispatch(p.dispatch(name))
+	}
+	p.mu.RUnlock()
+	if framing == FramingDAP {
+		// A debug adapter's events are passed on in the order it sent them.
+		conn.HandleInOrder()
+	}
+	inst.Conn = conn
 
 	go func() {
-		if err := inst.Conn.Run(inst.ctx); err != nil {
+		if err := conn.Run(inst.ctx); err != nil {
 			inst.mu.Lock()
-			inst.State = LSPStateFailed
-			inst.Error = err
+			// A connection the instance has since replaced, as when a
+			// health check killed it and it was restarted, is ignored.
+			state := inst.State
+			if inst.Conn != conn {
+				state = LSPStateStopped
+			}
+			switch state {
+			case LSPStateRunning:
+				p.setState(inst, LSPStateCrashed, err)
+			case LSPStateStarting:
+				p.setState(inst, LSPStateFailed, err)
+			}
 			inst.mu.Unlock()
 		}
 	}()
@@ -184,25 +559,23 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 	if initParams != nil {
 		// Merge LSP-specific init options into params
 		customParams := *initParams
-		if len(inst.InitOptions) > 0 {
+		if initOpts := inst.initializationOptions(); len(initOpts) > 0 {
 			customParams.InitializationOptions = mergeInitOptionsToJSON(
 				initParams.InitializationOptions,
-				inst.InitOptions,
+				initOpts,
 			)
 		}
 
 		result, err := inst.Conn.Call(inst.ctx, lsp.MethodInitialize, &customParams)
 		if err != nil {
-			inst.State = LSPStateFailed
-			inst.Error = err
+			p.setState(inst, LSPStateFailed, err)
 			proc.Kill()
 			return nil, fmt.Errorf("initializing %s: %w", name, err)
 		}
 
 		var initResult lsp.InitializeResult
 		if err := json.Unmarshal(result, &initResult); err != nil {
-			inst.State = LSPStateFailed
-			inst.Error = err
+			p.setState(inst, LSPStateFailed, err)
 			proc.Kill()
 			return nil, fmt.Errorf("parsing init result from %s: %w", name, err)
 		}
@@ -220,8 +593,7 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 		}
 
 		if err := inst.Conn.Notify(lsp.MethodInitialized, struct{}{}); err != nil {
-			inst.State = LSPStateFailed
-			inst.Error = err
+			p.setState(inst, LSPStateFailed, err)
 			proc.Kill()
 			return nil, fmt.Errorf("sending initialized to %s: %w", name, err)
 		}
@@ -240,9 +612,9 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 		}
 	}
 
-	inst.State = LSPStateRunning
-	inst.StartedAt = time.Now()
 	inst.Error = nil
+	inst.StartedAt = time.Now()
+	p.setState(inst, LSPStateRunning, nil)
 
 	inst.knownFolders = make(map[string]bool)
 	if initParams != nil && initParams.RootURI != nil {
@@ -252,6 +624,62 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 	return inst, nil
 }
 
+// Prebuild builds the named LSP's server without starting it, so that its
+// first start doesn't wait on the build, and returns the path it built.
+// Servers lux attaches to or runs on another machine have nothing to build
+// and return "".
+func (p *Pool) Prebuild(ctx context.Context, name string) (string, error) {
+	p.mu.RLock()
+	inst, ok := p.instances[name]
+	p.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown LSP: %s", name)
+	}
+
+	inst.mu.RLock()
+	if inst.attaches() || inst.remote != "" {
+		inst.mu.RUnlock()
+		return "", nil
+	}
+	flake := inst.Flake
+	executor, spec, err := p.executorFor(inst)
+	inst.mu.RUnlock()
+	if err != nil {
+		return "", err
+	}
+
+	path, err := executor.Build(ctx, flake, spec)
+	if err != nil {
+		return "", fmt.Errorf("building %s: %w", name, err)
+	}
+	return path, nil
+}
+
+// executorFor returns the executor that builds and runs inst, and the spec
+// to pass its Build. A command (see Registration.Command) is resolved by a
+// BinaryExecutor whichever executor the pool has, so servers installed by
+// other means work without nix. The caller holds inst.mu.
+func (p *Pool) executorFor(inst *LSPInstance) (Executor, string, error) {
+	if inst.command != "" {
+		return NewBinaryExecutor(), inst.command, nil
+	}
+	if inst.remote != "" {
+		remote, err := newSSHExecutor(inst.remote, inst.pathMappings)
+		if err != nil {
+			return nil, "", err
+		}
+		return remote, inst.Binary, nil
+	}
+	return p.executor, inst.Binary, nil
+}
+
+// stopTimeout is how long a stopping server has to answer shutdown and
+// exit before it is killed.
+const stopTimeout = 5 * time.Second
+
+// Stop shuts a server down the way the LSP specification asks: a shutdown
+// request, then an exit notification, then waiting for the process to exit
+// on its own. A server that is still running after stopTimeout is killed.
 func (p *Pool) Stop(name string) error {
 	p.mu.RLock()
 	inst, ok := p.instances[name]
@@ -264,26 +692,33 @@ func (p *Pool) Stop(name string) error {
 	inst.mu.Lock()
 	defer inst.mu.Unlock()
 
+	inst.cancelRestart()
 	if inst.State != LSPStateRunning {
 		return nil
 	}
+	p.stop(inst)
+	return nil
+}
 
-	inst.State = LSPStateStopping
+// stop shuts down inst, which is running. The caller holds inst.mu.
+func (p *Pool) stop(inst *LSPInstance) {
+	p.setState(inst, LSPStateStopping, nil)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
 	defer cancel()
 
-	if inst.Conn != nil {
+	// An attached server outlives lux's connection to it, so it is only
+	// disconnected. Debug adapters have no shutdown; the client ends their
+	// session.
+	if inst.Conn != nil && !inst.attaches() && inst.Framing != FramingDAP {
 		inst.Conn.Call(ctx, lsp.MethodShutdown, nil)
 		inst.Conn.Notify(lsp.MethodExit, nil)
-		inst.Conn.Close()
-	}
-
-	if inst.cancel != nil {
-		inst.cancel()
 	}
 
 	if inst.Process != nil {
+		// Servers that ignore exit still see their input close.
+		inst.Process.Stdin.Close()
+
 		done := make(chan struct{})
 		go func() {
 			inst.Process.Wait()
@@ -297,12 +732,22 @@ func (p *Pool) Stop(name string) error {
 		}
 	}
 
-	inst.State = LSPStateStopped
+	// Cancelling the instance context kills the process, so it waits until
+	// the server has had its chance to exit cleanly.
+	if inst.Conn != nil {
+		inst.Conn.Close()
+	}
+	if inst.cancel != nil {
+		inst.cancel()
+	}
+
+	p.setState(inst, LSPStateStopped, nil)
+	if !inst.limits.isZero() {
+		removeCgroup(inst.Name)
+	}
 	inst.Process = nil
 	inst.Conn = nil
 	inst.Capabilities = nil
-
-	return nil
 }
 
 func (p *Pool) StopAll() {
@@ -313,31 +758,132 @@ func (p *Pool) StopAll() {
 	}
 	p.mu.RUnlock()
 
+	// Servers are stopped together, so stopping them all takes at most
+	// stopTimeout rather than that for each.
+	var wg sync.WaitGroup
 	for _, name := range names {
-		p.Stop(name)
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			p.Stop(name)
+		}(name)
+	}
+	wg.Wait()
+}
+
+// Sort keys for StatusOptions.SortBy.
+const (
+	StatusSortName   = "name"
+	StatusSortState  = "state"
+	StatusSortUptime = "uptime"
+)
+
+// StatusOptions orders and filters Pool.StatusWith results.
+type StatusOptions struct {
+	// SortBy is StatusSortName (the default), StatusSortState (in lifecycle
+	// order), or StatusSortUptime (longest-running first, then servers that
+	// aren't running). Ties are broken by name.
+	SortBy string
+	// States keeps only servers in one of these states; empty keeps all.
+	States []string
+}
+
+// Validate reports an unknown sort key or state.
+func (o StatusOptions) Validate() error {
+	switch o.SortBy {
+	case "", StatusSortName, StatusSortState, StatusSortUptime:
+	default:
+		return fmt.Errorf("invalid sort %q (expected name, state, or uptime)", o.SortBy)
 	}
+	for _, state := range o.States {
+		if !isLSPState(state) {
+			return fmt.Errorf("invalid state %q", state)
+		}
+	}
+	return nil
 }
 
+// Status returns every registered server, sorted by name.
 func (p *Pool) Status() []LSPStatus {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	return p.StatusWith(StatusOptions{})
+}
+
+// StatusWith returns the registered servers ordered and filtered by opts.
+func (p *Pool) StatusWith(opts StatusOptions) []LSPStatus {
+	keep := make(map[string]bool, len(opts.States))
+	for _, state := range opts.States {
+		keep[state] = true
+	}
 
-	var statuses []LSPStatus
+	type entry struct {
+		status LSPStatus
+		state  LSPState
+		inst   *LSPInstance
+	}
+
+	p.mu.RLock()
+	var entries []entry
 	for name, inst := range p.instances {
 		inst.mu.RLock()
 		status := LSPStatus{
-			Name:      name,
-			Flake:     inst.Flake,
-			State:     inst.State.String(),
-			StartedAt: inst.StartedAt,
+			Name:         name,
+			Flake:        inst.Flake,
+			State:        inst.State.String(),
+			StartedAt:    inst.StartedAt,
+			NeverStarted: inst.StartedAt.IsZero(),
+			Unhealthy:    inst.unhealthy,
 		}
 		if inst.Error != nil {
 			status.Error = inst.Error.Error()
 		}
+		if inst.State == LSPStateRunning && inst.Process != nil {
+			status.Pid = inst.Process.Pid
+		}
+		state := inst.State
 		inst.mu.RUnlock()
-		statuses = append(statuses, status)
+
+		if len(keep) > 0 && !keep[status.State] {
+			continue
+		}
+		entries = append(entries, entry{status: status, state: state, inst: inst})
+	}
+	p.mu.RUnlock()
+
+	// Sampling may run ps, so it happens without the pool locked.
+	for i := range entries {
+		e := &entries[i]
+		if e.status.Pid == 0 {
+			continue
+		}
+		rss, cpu, err := e.inst.usage.sample(e.status.Pid, e.status.StartedAt)
+		if err == nil {
+			e.status.RSS, e.status.CPU = rss, cpu
+		}
 	}
 
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch opts.SortBy {
+		case StatusSortState:
+			if a.state != b.state {
+				return a.state < b.state
+			}
+		case StatusSortUptime:
+			aUp, bUp := a.state == LSPStateRunning, b.state == LSPStateRunning
+			if aUp != bUp {
+				return aUp
+			}
+			if aUp && !a.status.StartedAt.Equal(b.status.StartedAt) {
+				return a.status.StartedAt.Before(b.status.StartedAt)
+			}
+		}
+		return a.status.Name < b.status.Name
+	})
+
+	statuses := make([]LSPStatus, len(entries))
+	for i, e := range entries {
+		statuses[i] = e.status
+	}
 	return statuses
 }
 
@@ -346,18 +892,46 @@ type LSPStatus struct {
 	Flake     string    `json:"flake"`
 	State     string    `json:"state"`
 	StartedAt time.Time `json:"started_at,omitempty"`
-	Error     string    `json:"error,omitempty"`
+	// NeverStarted distinguishes a server that is registered but has never
+	// run from one that is idle or stopped after running.
+	NeverStarted bool `json:"never_started,omitempty"`
+	// Unhealthy is set when the server failed its last health check (see
+	// Pool.CheckHealth).
+	Unhealthy bool `json:"unhealthy,omitempty"`
+	// Pid, RSS (resident memory, in bytes), and CPU (percent of one CPU
+	// since the previous status, or since it started) describe a running
+	// server's local process; they are unset for servers without one.
+	Pid   int     `json:"pid,omitempty"`
+	RSS   int64   `json:"rss,omitempty"`
+	CPU   float64 `json:"cpu,omitempty"`
+	Error string  `json:"error,omitempty"`
 }
 
+// Call sends a request to the running server and waits for its result. The
+// instance lock isn't held while waiting, so a server that is slow to answer
+// doesn't hold up its other requests, its status, or health checks; a call
+// in flight counts as activity, so StopIdle leaves the instance running.
 func (inst *LSPInstance) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
 	inst.mu.RLock()
-	defer inst.mu.RUnlock()
-
 	if inst.State != LSPStateRunning {
+		inst.mu.RUnlock()
 		return nil, fmt.Errorf("LSP %s is not running", inst.Name)
 	}
 
-	return inst.Conn.Call(ctx, method, params)
+	if inst.onCall != nil {
+		inst.onCall(inst.Name, method)
+	}
+
+	inst.active.Add(1)
+	inst.touch()
+	conn := inst.Conn
+	inst.mu.RUnlock()
+	defer func() {
+		inst.touch()
+		inst.active.Add(-1)
+	}()
+
+	return conn.Call(ctx, method, params)
 }
 
 func (inst *LSPInstance) Notify(method string, params any) error {
@@ -368,6 +942,7 @@ func (inst *LSPInstance) Notify(method string, params any) error {
 		return fmt.Errorf("LSP %s is not running", inst.Name)
 	}
 
+	inst.touch()
 	return inst.Conn.Notify(method, params)
 }
 
@@ -401,6 +976,25 @@ func (inst *LSPInstance) EnsureWorkspaceFolder(projectRoot string) error {
 	return nil
 }
 
+// initializationOptions returns the LSP's init_options, overlaid on its
+// settings when it is configured to take them there: some servers read
+// their settings from initializationOptions rather than pulling them with
+// workspace/configuration. The caller holds inst.mu.
+func (inst *LSPInstance) initializationOptions() map[string]any {
+	if !inst.initSettings || len(inst.Settings) == 0 {
+		return inst.InitOptions
+	}
+
+	opts := make(map[string]any, len(inst.Settings)+len(inst.InitOptions))
+	for k, v := range inst.Settings {
+		opts[k] = v
+	}
+	for k, v := range inst.InitOptions {
+		opts[k] = v
+	}
+	return opts
+}
+
 func mergeInitOptionsToJSON(existing json.RawMessage, custom map[string]any) json.RawMessage {
 	if len(custom) == 0 {
 		return existing
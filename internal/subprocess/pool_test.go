@@ -0,0 +1,294 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+func TestConnHandler_SharedPool(t *testing.T) {
+	var primaryNotes, secondaryNotes int
+
+	pool := NewPool(nil, func(name string) jsonrpc.Handler {
+		return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+			if msg.IsNotification() {
+				primaryNotes++
+				return nil, nil
+			}
+			// The primary frontend declines requests it can't answer.
+			return nil, nil
+		}
+	})
+	pool.AddHandlerFactory(func(name string) jsonrpc.Handler {
+		return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+			if msg.IsNotification() {
+				secondaryNotes++
+				return nil, nil
+			}
+			return jsonrpc.NewResponse(*msg.ID, "secondary")
+		}
+	})
+
+	handler := pool.connHandler("test")
+
+	note, _ := jsonrpc.NewNotification("window/logMessage", map[string]string{"message": "hi"})
+	if _, err := handler(context.Background(), note); err != nil {
+		t.Fatalf("notification: unexpected error: %v", err)
+	}
+	if primaryNotes != 1 || secondaryNotes != 1 {
+		t.Errorf("expected notification delivered to both handlers, got primary=%d secondary=%d", primaryNotes, secondaryNotes)
+	}
+
+	req, _ := jsonrpc.NewRequest(jsonrpc.NewNumberID(1), "workspace/configuration", nil)
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("request: unexpected error: %v", err)
+	}
+	if resp == nil || string(resp.Result) != `"secondary"` {
+		t.Errorf("expected fallback to secondary handler, got %+v", resp)
+	}
+}
+
+type failingExecutor struct {
+	builds int
+}
+
+func (e *failingExecutor) Build(ctx context.Context, flake, binarySpec string) (string, error) {
+	e.builds++
+	return "", errors.New("build failed")
+}
+
+func (e *failingExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	return nil, errors.New("not reached")
+}
+
+func TestPool_RestartCircuitBreaker(t *testing.T) {
+	executor := &failingExecutor{}
+	pool := NewPool(executor, func(name string) jsonrpc.Handler { return nil })
+	pool.SetRestartPolicy(RestartPolicy{MaxFailures: 3, Window: time.Minute})
+	pool.Register("broken", Registration{Flake: "nixpkgs#broken", SettingsKey: "broken"})
+
+	for i := 0; i < 5; i++ {
+		pool.GetOrStart(context.Background(), "broken", nil)
+	}
+
+	if executor.builds != 3 {
+		t.Errorf("expected 3 build attempts before the breaker trips, got %d", executor.builds)
+	}
+
+	inst, _ := pool.Get("broken")
+	if inst.State != LSPStateDisabled {
+		t.Errorf("expected state disabled, got %s", inst.State)
+	}
+
+	_, err := pool.GetOrStart(context.Background(), "broken", nil)
+	var disabled *DisabledError
+	if !errors.As(err, &disabled) || disabled.Failures != 3 {
+		t.Errorf("expected DisabledError after 3 failures, got %v", err)
+	}
+
+	if err := pool.ResetFailures("broken"); err != nil {
+		t.Fatalf("ResetFailures: %v", err)
+	}
+	pool.GetOrStart(context.Background(), "broken", nil)
+	if executor.builds != 4 {
+		t.Errorf("expected a new build attempt after reset, got %d builds", executor.builds)
+	}
+}
+
+func TestPool_Requires(t *testing.T) {
+	executor := &failingExecutor{}
+	pool := NewPool(executor, func(name string) jsonrpc.Handler { return nil })
+	missing := errors.New("clangd needs compile_commands.json")
+	requires := missing
+	pool.Register("clangd", Registration{
+		Flake:    "nixpkgs#clang-tools",
+		Requires: func() error { return requires },
+	})
+
+	if _, err := pool.GetOrStart(context.Background(), "clangd", nil); !errors.Is(err, missing) {
+		t.Errorf("expected the requirement error, got %v", err)
+	}
+	if executor.builds != 0 {
+		t.Errorf("expected no build while the requirement is missing, got %d", executor.builds)
+	}
+	status := pool.Status()[0]
+	if status.State != "idle" || status.Error != missing.Error() {
+		t.Errorf("expected idle with the requirement error in status, got %+v", status)
+	}
+
+	requires = nil
+	pool.GetOrStart(context.Background(), "clangd", nil)
+	if executor.builds != 1 {
+		t.Errorf("expected a build once the requirement is met, got %d", executor.builds)
+	}
+}
+
+func TestAutoRestart_Backoff(t *testing.T) {
+	policy := AutoRestart{MaxRetries: 5, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, want := range expected {
+		if got := policy.backoff(attempt); got != want {
+			t.Errorf("attempt %d: expected %s, got %s", attempt, want, got)
+		}
+	}
+}
+
+func TestPool_StatusWith(t *testing.T) {
+	pool := NewPool(&failingExecutor{}, func(name string) jsonrpc.Handler { return nil })
+	for _, name := range []string{"pyright", "gopls", "marksman", "nil"} {
+		pool.Register(name, Registration{Flake: "nixpkgs#" + name, SettingsKey: name})
+	}
+
+	now := time.Now()
+	setState := func(name string, state LSPState, startedAt time.Time) {
+		inst, _ := pool.Get(name)
+		inst.State = state
+		inst.StartedAt = startedAt
+	}
+	setState("pyright", LSPStateRunning, now.Add(-time.Minute))
+	setState("gopls", LSPStateRunning, now.Add(-time.Hour))
+	setState("marksman", LSPStateStopped, now.Add(-2*time.Hour))
+
+	names := func(statuses []LSPStatus) string {
+		var names []string
+		for _, s := range statuses {
+			names = append(names, s.Name)
+		}
+		return strings.Join(names, " ")
+	}
+
+	tests := []struct {
+		name     string
+		opts     StatusOptions
+		expected string
+	}{
+		{"default", StatusOptions{}, "gopls marksman nil pyright"},
+		{"state", StatusOptions{SortBy: StatusSortState}, "nil gopls pyright marksman"},
+		{"uptime", StatusOptions{SortBy: StatusSortUptime}, "gopls pyright marksman nil"},
+		{"filter", StatusOptions{States: []string{"idle", "stopped"}}, "marksman nil"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(pool.StatusWith(tt.opts)); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	for _, s := range pool.Status() {
+		if s.NeverStarted != (s.Name == "nil") {
+			t.Errorf("%s: expected never_started=%v, got %v", s.Name, s.Name == "nil", s.NeverStarted)
+		}
+	}
+
+	if err := (StatusOptions{SortBy: "memory"}).Validate(); err == nil {
+		t.Error("expected error for unknown sort")
+	}
+	if err := (StatusOptions{States: []string{"sleeping"}}).Validate(); err == nil {
+		t.Error("expected error for unknown state")
+	}
+}
+
+func TestPool_StopIdleSkipsBusyInstances(t *testing.T) {
+	pool := NewPool(&failingExecutor{}, func(name string) jsonrpc.Handler { return nil })
+	pool.Register("gopls", Registration{Flake: "nixpkgs#gopls", SettingsKey: "gopls"})
+
+	inst, _ := pool.Get("gopls")
+	inst.State = LSPStateRunning
+	inst.touch()
+
+	// An instance used recently is passed over without waiting for its lock,
+	// held here as a slow start or stop would.
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	done := make(chan []string, 1)
+	go func() { done <- pool.StopIdle(func(string) time.Duration { return time.Hour }) }()
+
+	select {
+	case stopped := <-done:
+		if len(stopped) != 0 {
+			t.Errorf("expected nothing stopped, got %v", stopped)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("StopIdle waited on the lock of an instance that isn't idle")
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	var b tailBuffer
+	for i := 0; i < stderrTailLines+5; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	b.Write([]byte("partial"))
+
+	lines := strings.Split(b.String(), "\n")
+	if len(lines) != stderrTailLines+1 {
+		t.Fatalf("expected %d lines, got %d", stderrTailLines+1, len(lines))
+	}
+	if lines[0] != "line 5" || lines[len(lines)-1] != "partial" {
+		t.Errorf("unexpected tail: first %q, last %q", lines[0], lines[len(lines)-1])
+	}
+}
+
+func TestPool_RegisterInvalid(t *testing.T) {
+	pool := NewPool(&failingExecutor{}, func(name string) jsonrpc.Handler { return nil })
+
+	tests := []struct {
+		name string
+		r    Registration
+	}{
+		{"remote", Registration{Remote: "example.com"}},
+		{"transport", Registration{Transport: Transport{Kind: "pipe"}}},
+		{"address", Registration{Transport: Transport{Kind: TransportTCP}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := pool.Register(tt.name, tt.r); err == nil {
+				t.Error("expected an error")
+			}
+			if _, ok := pool.Get(tt.name); ok {
+				t.Error("expected nothing registered")
+			}
+		})
+	}
+}
+
+func TestPool_Command(t *testing.T) {
+	pool := NewPool(&failingExecutor{}, nil)
+	if err := pool.Register("fake", Registration{Flake: "nixpkgs#fake", Command: "/bin/fake-lsp"}); err != nil {
+		t.Fatal(err)
+	}
+
+	inst, _ := pool.Get("fake")
+	executor, spec, err := pool.executorFor(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := executor.(*BinaryExecutor); !ok || spec != "/bin/fake-lsp" {
+		t.Errorf("executorFor = %T, %q, want a binary executor and the command", executor, spec)
+	}
+}
+
+func TestLSPInstance_InitializationOptions(t *testing.T) {
+	inst := &LSPInstance{
+		InitOptions: map[string]any{"a": 1},
+		Settings:    map[string]any{"a": 2, "b": 2},
+	}
+	if got := inst.initializationOptions(); len(got) != 1 || got["a"] != 1 {
+		t.Errorf("expected only init_options without init settings, got %v", got)
+	}
+
+	inst.initSettings = true
+	if got := inst.initializationOptions(); len(got) != 2 || got["a"] != 1 || got["b"] != 2 {
+		t.Errorf("expected settings under init_options, got %v", got)
+	}
+}
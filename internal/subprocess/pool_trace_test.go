@@ -0,0 +1,444 @@
+package subprocess_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/internal/subprocess/subprocesstest"
+)
+
+func newTracePool(t *testing.T, servers ...string) (*subprocess.Pool, *subprocesstest.Executor) {
+	t.Helper()
+
+	executor, err := subprocesstest.NewExecutor(servers...)
+	if err != nil {
+		t.Fatalf("creating fake executor: %v", err)
+	}
+
+	pool := subprocess.NewPool(executor, func(name string) jsonrpc.Handler { return nil })
+	t.Cleanup(pool.StopAll)
+	return pool, executor
+}
+
+func TestPool_GoldenTraces(t *testing.T) {
+	for _, name := range subprocesstest.TraceNames() {
+		t.Run(name, func(t *testing.T) {
+			pool, _ := newTracePool(t, name)
+			pool.Register(name, subprocess.Registration{Flake: "nixpkgs#" + name, SettingsKey: name})
+
+			inst, err := pool.GetOrStart(context.Background(), name, &lsp.InitializeParams{})
+			if err != nil {
+				t.Fatalf("GetOrStart: %v", err)
+			}
+
+			trace, _ := subprocesstest.LoadTrace(name)
+			expected, err := trace.Capabilities()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inst.Capabilities == nil {
+				t.Fatal("expected capabilities after initialize")
+			}
+			if lsp.SupportsMethod(inst.Capabilities, lsp.MethodTextDocumentHover) != lsp.SupportsMethod(&expected, lsp.MethodTextDocumentHover) {
+				t.Errorf("hover support: expected %v", lsp.SupportsMethod(&expected, lsp.MethodTextDocumentHover))
+			}
+
+			if err := pool.Stop(name); err != nil {
+				t.Errorf("Stop: %v", err)
+			}
+		})
+	}
+}
+
+func TestPool_TraceCallAndSettings(t *testing.T) {
+	pool, executor := newTracePool(t, "gopls")
+	pool.Register("gopls", subprocess.Registration{
+		Flake:        "nixpkgs#gopls",
+		Settings:     map[string]any{"staticcheck": true},
+		SettingsKey:  "gopls",
+		CapOverrides: &subprocess.CapabilityOverride{Disable: []string{"hoverProvider"}},
+	})
+
+	inst, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+
+	if lsp.SupportsMethod(inst.Capabilities, lsp.MethodTextDocumentHover) {
+		t.Error("expected hoverProvider disabled by override")
+	}
+	if !lsp.SupportsMethod(inst.Capabilities, lsp.MethodTextDocumentDefinition) {
+		t.Error("expected definitionProvider from trace")
+	}
+
+	result, err := inst.Call(context.Background(), lsp.MethodTextDocumentDefinition, nil)
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	var locations []lsp.Location
+	if err := json.Unmarshal(result, &locations); err != nil || len(locations) != 1 {
+		t.Errorf("expected one recorded location, got %s (%v)", result, err)
+	}
+
+	if _, err := inst.Call(context.Background(), "textDocument/unknown", nil); err == nil {
+		t.Error("expected error for method without a recorded response")
+	}
+
+	received := executor.Server("gopls").Received()
+	expected := []string{lsp.MethodInitialize, lsp.MethodInitialized, lsp.MethodWorkspaceDidChangeConfiguration}
+	for i, method := range expected {
+		if i >= len(received) || received[i] != method {
+			t.Fatalf("expected %v to start %v", received, expected)
+		}
+	}
+}
+
+func TestPool_StopAllShutsDownEachServer(t *testing.T) {
+	names := []string{"gopls", "pyright", "rust-analyzer"}
+	pool, executor := newTracePool(t, names...)
+	for _, name := range names {
+		pool.Register(name, subprocess.Registration{Flake: "nixpkgs#" + name, SettingsKey: name})
+		if _, err := pool.GetOrStart(context.Background(), name, &lsp.InitializeParams{}); err != nil {
+			t.Fatalf("GetOrStart %s: %v", name, err)
+		}
+	}
+
+	pool.StopAll()
+
+	for _, name := range names {
+		received := executor.Server(name).Received()
+		n := len(received)
+		if n < 2 || received[n-2] != lsp.MethodShutdown || received[n-1] != lsp.MethodExit {
+			t.Errorf("%s: expected shutdown then exit, got %v", name, received)
+		}
+		if inst, _ := pool.Get(name); inst != nil && inst.State != subprocess.LSPStateStopped {
+			t.Errorf("%s: expected stopped, got %s", name, inst.State)
+		}
+	}
+}
+
+func TestMergeCapabilities_GoldenTraces(t *testing.T) {
+	var all []lsp.ServerCapabilities
+	for _, name := range subprocesstest.TraceNames() {
+		trace, err := subprocesstest.LoadTrace(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		caps, err := trace.Capabilities()
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, caps)
+	}
+
+	merged := lsp.MergeCapabilities(all...)
+
+	for _, method := range []string{
+		lsp.MethodTextDocumentHover,
+		lsp.MethodTextDocumentDefinition,
+		lsp.MethodTextDocumentRename,
+		lsp.MethodTextDocumentFormatting,
+		lsp.MethodTextDocumentCompletion,
+	} {
+		if !lsp.SupportsMethod(&merged, method) {
+			t.Errorf("merged capabilities: expected support for %s", method)
+		}
+	}
+
+	if merged.CompletionProvider == nil || len(merged.CompletionProvider.TriggerCharacters) < 2 {
+		t.Errorf("expected merged completion trigger characters, got %+v", merged.CompletionProvider)
+	}
+}
+
+func TestPool_CancelForwardedToBackend(t *testing.T) {
+	executor, err := subprocesstest.NewExecutor()
+	if err != nil {
+		t.Fatalf("creating fake executor: %v", err)
+	}
+	trace, err := subprocesstest.LoadTrace("gopls")
+	if err != nil {
+		t.Fatalf("loading trace: %v", err)
+	}
+	trace.Hang = []string{lsp.MethodWorkspaceSymbol}
+	executor.Add("gopls", trace)
+
+	pool := subprocess.NewPool(executor, func(name string) jsonrpc.Handler { return nil })
+	t.Cleanup(pool.StopAll)
+	pool.Register("gopls", subprocess.Registration{Flake: "nixpkgs#gopls", SettingsKey: "gopls"})
+
+	inst, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := inst.Call(ctx, lsp.MethodWorkspaceSymbol, map[string]string{"query": "Run"})
+		errc <- err
+	}()
+
+	srv := executor.Server("gopls")
+	deadline := time.Now().Add(2 * time.Second)
+	for !contains(srv.Received(), lsp.MethodWorkspaceSymbol) {
+		if time.Now().After(deadline) {
+			t.Fatal("backend never received the request")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	for len(srv.Cancelled()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("backend never received $/cancelRequest")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// initialize was request 1, so the symbol request went out as 2.
+	if got := srv.Cancelled(); got[0] != "2" {
+		t.Errorf("expected cancelled ID %q, got %q", "2", got[0])
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPool_LifecycleHooks(t *testing.T) {
+	pool, executor := newTracePool(t, "gopls")
+	pool.Register("gopls", subprocess.Registration{Flake: "nixpkgs#gopls", SettingsKey: "gopls"})
+
+	events := make(chan string, 10)
+	pool.AddHooks(subprocess.Hooks{
+		OnStart: func(e subprocess.LifecycleEvent) {
+			if e.Capabilities == nil {
+				t.Error("expected capabilities on start")
+			}
+			events <- "start " + e.Name
+		},
+		OnStop: func(e subprocess.LifecycleEvent) { events <- "stop " + e.Name },
+		OnCrash: func(e subprocess.LifecycleEvent) {
+			if e.Err == nil {
+				t.Error("expected the crash's error")
+			}
+			events <- "crash " + e.Name
+		},
+	})
+	pool.AddHooks(subprocess.Hooks{OnStop: func(e subprocess.LifecycleEvent) { events <- "second stop" }})
+
+	expect := func(expected string) {
+		t.Helper()
+		select {
+		case got := <-events:
+			if got != expected {
+				t.Errorf("expected %q, got %q", expected, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %q, got nothing", expected)
+		}
+	}
+
+	if _, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{}); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	expect("start gopls")
+
+	if err := pool.Stop("gopls"); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	expect("stop gopls")
+	expect("second stop")
+
+	if _, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{}); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	expect("start gopls")
+
+	executor.Server("gopls").Crash()
+	expect("crash gopls")
+}
+
+func TestPool_AutoRestart(t *testing.T) {
+	pool, executor := newTracePool(t, "gopls")
+	pool.SetAutoRestart(subprocess.AutoRestart{MaxRetries: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond})
+	restarted := make(chan *subprocess.LSPInstance, 1)
+	pool.AddHooks(subprocess.Hooks{OnRestart: func(e subprocess.LifecycleEvent) {
+		inst, _ := pool.Get(e.Name)
+		restarted <- inst
+	}})
+	pool.Register("gopls", subprocess.Registration{Flake: "nixpkgs#gopls", SettingsKey: "gopls"})
+
+	if _, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{}); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	crashed := executor.Server("gopls")
+	crashed.Crash()
+
+	select {
+	case inst := <-restarted:
+		if inst.Capabilities == nil {
+			t.Error("expected the restarted server to have been initialized")
+		}
+	case <-time.After(2 * time.Second):
+		state, _ := pool.State("gopls")
+		t.Fatalf("expected gopls to be restarted, state is %s", state)
+	}
+
+	if state, _ := pool.State("gopls"); state != subprocess.LSPStateRunning {
+		t.Errorf("expected running after the restart, got %s", state)
+	}
+	if executor.Server("gopls") == crashed {
+		t.Error("expected a new server process")
+	}
+}
+
+func TestPool_StopIdle(t *testing.T) {
+	pool, _ := newTracePool(t, "gopls")
+	pool.Register("gopls", subprocess.Registration{Flake: "nixpkgs#gopls", SettingsKey: "gopls"})
+
+	inst, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+
+	timeout := func(string) time.Duration { return time.Hour }
+	if stopped := pool.StopIdle(timeout); len(stopped) != 0 {
+		t.Fatalf("expected nothing stopped within the timeout, got %v", stopped)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := inst.Call(context.Background(), lsp.MethodTextDocumentHover, map[string]any{}); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if idle := inst.IdleFor(); idle >= 20*time.Millisecond {
+		t.Errorf("expected the request to reset the idle time, got %s", idle)
+	}
+
+	if stopped := pool.StopIdle(func(string) time.Duration { return 0 }); len(stopped) != 0 {
+		t.Fatalf("expected a zero timeout to keep the server, got %v", stopped)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	stopped := pool.StopIdle(func(string) time.Duration { return 10 * time.Millisecond })
+	if len(stopped) != 1 || stopped[0] != "gopls" {
+		t.Fatalf("expected gopls stopped, got %v", stopped)
+	}
+	if state, _ := pool.State("gopls"); state != subprocess.LSPStateStopped {
+		t.Errorf("expected stopped, got %s", state)
+	}
+}
+
+func TestPool_CheckHealth(t *testing.T) {
+	executor, err := subprocesstest.NewExecutor("gopls")
+	if err != nil {
+		t.Fatalf("creating fake executor: %v", err)
+	}
+	trace, err := subprocesstest.LoadTrace("gopls")
+	if err != nil {
+		t.Fatalf("loading trace: %v", err)
+	}
+	trace.Server = "hung"
+	trace.Hang = []string{lsp.MethodWorkspaceSymbol}
+	executor.Add("hung", trace)
+
+	pool := subprocess.NewPool(executor, func(name string) jsonrpc.Handler { return nil })
+	t.Cleanup(pool.StopAll)
+	pool.Register("gopls", subprocess.Registration{Flake: "nixpkgs#gopls", SettingsKey: "gopls"})
+	pool.Register("hung", subprocess.Registration{Flake: "nixpkgs#hung", SettingsKey: "hung"})
+
+	for _, name := range []string{"gopls", "hung"} {
+		if _, err := pool.GetOrStart(context.Background(), name, &lsp.InitializeParams{}); err != nil {
+			t.Fatalf("GetOrStart %s: %v", name, err)
+		}
+	}
+
+	unhealthy := pool.CheckHealth(context.Background(), 100*time.Millisecond)
+	if len(unhealthy) != 1 || unhealthy[0] != "hung" {
+		t.Fatalf("expected only hung to be unhealthy, got %v", unhealthy)
+	}
+
+	for _, status := range pool.Status() {
+		switch status.Name {
+		case "gopls":
+			if status.Unhealthy || status.State != "running" {
+				t.Errorf("expected gopls healthy and running, got %+v", status)
+			}
+		case "hung":
+			if !status.Unhealthy || status.State != "crashed" {
+				t.Errorf("expected hung unhealthy and crashed, got %+v", status)
+			}
+		}
+	}
+}
+
+func TestPool_CheckHealthWithCallInFlight(t *testing.T) {
+	executor, err := subprocesstest.NewExecutor()
+	if err != nil {
+		t.Fatalf("creating fake executor: %v", err)
+	}
+	trace, err := subprocesstest.LoadTrace("gopls")
+	if err != nil {
+		t.Fatalf("loading trace: %v", err)
+	}
+	trace.Server = "hung"
+	trace.Hang = []string{lsp.MethodWorkspaceSymbol, lsp.MethodTextDocumentHover}
+	executor.Add("hung", trace)
+
+	pool := subprocess.NewPool(executor, func(name string) jsonrpc.Handler { return nil })
+	t.Cleanup(pool.StopAll)
+	pool.Register("hung", subprocess.Registration{Flake: "nixpkgs#hung", SettingsKey: "hung"})
+
+	inst, err := pool.GetOrStart(context.Background(), "hung", &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	callErr := make(chan error, 1)
+	go func() {
+		_, err := inst.Call(ctx, lsp.MethodTextDocumentHover, map[string]any{})
+		callErr <- err
+	}()
+	for !slices.Contains(executor.Server("hung").Received(), lsp.MethodTextDocumentHover) {
+		time.Sleep(time.Millisecond)
+	}
+
+	checked := make(chan []string, 1)
+	go func() { checked <- pool.CheckHealth(context.Background(), 50*time.Millisecond) }()
+
+	select {
+	case unhealthy := <-checked:
+		if len(unhealthy) != 1 || unhealthy[0] != "hung" {
+			t.Fatalf("expected hung to be unhealthy, got %v", unhealthy)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("health check blocked behind the request in flight")
+	}
+
+	select {
+	case err := <-callErr:
+		if err == nil {
+			t.Error("expected the request to the killed server to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request to the killed server never returned")
+	}
+}
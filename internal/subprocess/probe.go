@@ -0,0 +1,116 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// CheckHealth probes every running instance and returns the names of those
+// found unresponsive. A server advertising workspace/symbol is sent one with
+// an empty query and must answer within timeout, even if only with an
+// error; one that doesn't is checked for its process still existing. An
+// unresponsive instance is marked unhealthy in its status, killed, and
+// handled as crashed, so auto-restart (see AutoRestart) or the next request
+// starts it again. It stays marked until a probe succeeds.
+func (p *Pool) CheckHealth(ctx context.Context, timeout time.Duration) []string {
+	p.mu.RLock()
+	instances := make([]*LSPInstance, 0, len(p.instances))
+	for _, inst := range p.instances {
+		instances = append(instances, inst)
+	}
+	p.mu.RUnlock()
+
+	var (
+		unhealthy []string
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+	)
+	for _, inst := range instances {
+		wg.Add(1)
+		go func(inst *LSPInstance) {
+			defer wg.Done()
+			if p.probe(ctx, inst, timeout) {
+				return
+			}
+			mu.Lock()
+			unhealthy = append(unhealthy, inst.Name)
+			mu.Unlock()
+		}(inst)
+	}
+	wg.Wait()
+	return unhealthy
+}
+
+// probe checks inst and reports whether it is healthy. Instances that
+// aren't running are healthy.
+func (p *Pool) probe(ctx context.Context, inst *LSPInstance, timeout time.Duration) bool {
+	inst.mu.RLock()
+	if inst.State != LSPStateRunning {
+		inst.mu.RUnlock()
+		return true
+	}
+	conn, capabilities, proc := inst.Conn, inst.Capabilities, inst.Process
+	inst.mu.RUnlock()
+
+	// The instance lock isn't held while waiting on the server, so requests
+	// to it and its status don't wait behind the probe.
+	err := ping(ctx, conn, capabilities, proc, timeout)
+
+	if ctx.Err() != nil {
+		return true
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if err == nil {
+		inst.unhealthy = false
+		return true
+	}
+	if inst.State != LSPStateRunning || inst.Conn != conn {
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "[lux] %s is unresponsive, restarting it: %v\n", inst.Name, err)
+	inst.unhealthy = true
+	if inst.Process != nil {
+		inst.Process.Kill()
+	}
+	if inst.cancel != nil {
+		inst.cancel()
+	}
+	p.setState(inst, LSPStateCrashed, fmt.Errorf("not responding to health checks: %w", err))
+	return false
+}
+
+// ping sends a server its liveness probe over conn, or checks that its
+// process is alive if it has no probe to answer.
+func ping(ctx context.Context, conn *Conn, capabilities *lsp.ServerCapabilities, proc *Process, timeout time.Duration) error {
+	if !lsp.SupportsMethod(capabilities, lsp.MethodWorkspaceSymbol) {
+		if proc != nil && !processAlive(proc.Pid) {
+			return errors.New("process has exited")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := conn.Call(ctx, lsp.MethodWorkspaceSymbol, map[string]string{"query": ""})
+
+	// An error answer still shows the server is reading its input.
+	var rpcErr *jsonrpc.Error
+	if errors.As(err, &rpcErr) {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("no answer within %s", timeout)
+	}
+	return err
+}
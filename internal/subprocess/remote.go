@@ -0,0 +1,111 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// sshExecutor runs servers on another machine over ssh (see
+// config.LSP.Remote). The server's stdio is carried by the ssh connection;
+// nothing is built locally, so the binary is looked up on the remote PATH.
+type sshExecutor struct {
+	target   *url.URL
+	toRemote pathMap
+}
+
+// newSSHExecutor returns an executor for remote, an ssh://[user@]host[:port]
+// URL. The working directory is mapped with mappings, like the file URIs the
+// server sees.
+func newSSHExecutor(remote string, mappings []PathMapping) (*sshExecutor, error) {
+	target, err := parseRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+	toRemote, _ := newPathMaps(mappings)
+	return &sshExecutor{target: target, toRemote: toRemote}, nil
+}
+
+// parseRemote parses remote as an ssh://[user@]host[:port] URL.
+func parseRemote(remote string) (*url.URL, error) {
+	target, err := url.Parse(remote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote %q: %w", remote, err)
+	}
+	if target.Scheme != "ssh" || target.Hostname() == "" {
+		return nil, fmt.Errorf("invalid remote %q (expected ssh://[user@]host[:port])", remote)
+	}
+	return target, nil
+}
+
+// Build returns binarySpec, or the binary name flake implies when none is
+// configured.
+func (e *sshExecutor) Build(ctx context.Context, flake, binarySpec string) (string, error) {
+	name := binarySpec
+	if name == "" {
+		name = binaryNameFromFlake(flake)
+	}
+	if name == "" {
+		return "", fmt.Errorf("no binary configured for %q", flake)
+	}
+	return name, nil
+}
+
+func (e *sshExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	proc, err := startProcess(ctx, "ssh", e.sshArgs(path, args, env, workDir), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", e.target.Host, err)
+	}
+	// The local ssh client isn't the server; renicing it would do nothing.
+	proc.Pid = 0
+	return proc, nil
+}
+
+// sshArgs returns the arguments of the ssh command running path on the
+// remote machine. ssh runs in batch mode, since its stdin is the LSP stream
+// and can't answer a password prompt.
+func (e *sshExecutor) sshArgs(path string, args []string, env map[string]string, workDir string) []string {
+	sshArgs := []string{"-T", "-o", "BatchMode=yes"}
+	if port := e.target.Port(); port != "" {
+		sshArgs = append(sshArgs, "-p", port)
+	}
+	host := e.target.Hostname()
+	if user := e.target.User.Username(); user != "" {
+		host = user + "@" + host
+	}
+	sshArgs = append(sshArgs, host, "--")
+
+	var command []string
+	if workDir != "" {
+		command = append(command, "cd", shellQuote(e.toRemote.path(workDir)), "&&")
+	}
+	command = append(command, "exec")
+	if len(env) > 0 {
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		command = append(command, "env")
+		for _, k := range keys {
+			command = append(command, shellQuote(k+"="+env[k]))
+		}
+	}
+	command = append(command, shellQuote(path))
+	for _, arg := range args {
+		command = append(command, shellQuote(arg))
+	}
+	return append(sshArgs, strings.Join(command, " "))
+}
+
+// shellQuote quotes s for the remote shell.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,48 @@
+package subprocess
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSSHExecutor_Args(t *testing.T) {
+	e, err := newSSHExecutor("ssh://me@build.example.com:2222", []PathMapping{{Host: "/home/me/src", Backend: "/srv/src"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := e.sshArgs("rust-analyzer", []string{"--log", "it's here"}, map[string]string{"RA_LOG": "info", "A": "1"}, "/home/me/src/app")
+	expected := []string{
+		"-T", "-o", "BatchMode=yes", "-p", "2222", "me@build.example.com", "--",
+		`cd /srv/src/app && exec env A=1 RA_LOG=info rust-analyzer --log 'it'\''s here'`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	got = e.sshArgs("gopls", nil, nil, "")
+	expected = []string{"-T", "-o", "BatchMode=yes", "-p", "2222", "me@build.example.com", "--", "exec gopls"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestSSHExecutor_Build(t *testing.T) {
+	e, err := newSSHExecutor("ssh://build", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := e.Build(context.Background(), "nixpkgs#nodePackages.bash-language-server", ""); got != "bash-language-server" {
+		t.Errorf("expected the flake's binary name, got %q", got)
+	}
+	if got, _ := e.Build(context.Background(), "nixpkgs#gopls", "/opt/gopls/bin/gopls"); got != "/opt/gopls/bin/gopls" {
+		t.Errorf("expected the configured binary, got %q", got)
+	}
+
+	for _, remote := range []string{"build", "tcp://build:22", "ssh://"} {
+		if _, err := newSSHExecutor(remote, nil); err == nil {
+			t.Errorf("expected %q to be rejected", remote)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// AutoRestart restarts instances that crash while running instead of
+// leaving them for the next request to start. The first restart waits
+// InitialBackoff and each one after it twice as long, up to MaxBackoff; after
+// MaxRetries attempts in a row the instance is left crashed. The restart
+// circuit breaker (RestartPolicy) still applies, so a crash loop ends with
+// the instance disabled. The zero AutoRestart restarts nothing.
+type AutoRestart struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// restartStableAfter is how long an instance has to run before a crash
+// starts its backoff over.
+const restartStableAfter = time.Minute
+
+// SetAutoRestart configures restarting crashed instances. It must be called
+// before any instance is started.
+func (p *Pool) SetAutoRestart(policy AutoRestart) {
+	p.autoRestart = policy
+}
+
+// backoff returns how long to wait before the restart following attempt
+// earlier ones.
+func (policy AutoRestart) backoff(attempt int) time.Duration {
+	d := policy.InitialBackoff
+	for i := 0; i < attempt && (policy.MaxBackoff <= 0 || d < policy.MaxBackoff); i++ {
+		d *= 2
+	}
+	if policy.MaxBackoff > 0 && d > policy.MaxBackoff {
+		d = policy.MaxBackoff
+	}
+	return d
+}
+
+// scheduleRestart starts inst again once its backoff has passed, unless it
+// has used up its retries. It is run by the OnCrash hook of poolHooks and
+// after a failed restart. The caller holds inst.mu.
+func (p *Pool) scheduleRestart(inst *LSPInstance) {
+	policy := p.autoRestart
+	if policy.MaxRetries <= 0 || inst.restarts >= policy.MaxRetries {
+		return
+	}
+
+	delay := policy.backoff(inst.restarts)
+	inst.restarts++
+	inst.cancelRestart()
+	inst.restartTimer = time.AfterFunc(delay, func() { p.restart(inst) })
+}
+
+// restart is run by the timer scheduleRestart sets. An instance a request
+// has started again in the meantime is left alone, and one that fails to
+// start is tried again after a longer backoff.
+func (p *Pool) restart(inst *LSPInstance) {
+	inst.mu.Lock()
+	inst.restartTimer = nil
+	state, initParams := inst.State, inst.initParams
+	inst.mu.Unlock()
+
+	if state != LSPStateCrashed && state != LSPStateFailed {
+		return
+	}
+
+	if _, err := p.GetOrStart(context.Background(), inst.Name, initParams); err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] restarting %s: %v\n", inst.Name, err)
+		inst.mu.Lock()
+		if inst.State == LSPStateFailed {
+			p.scheduleRestart(inst)
+		}
+		inst.mu.Unlock()
+		return
+	}
+
+	p.runRestartHooks(inst)
+}
+
+// cancelRestart stops a pending restart. The caller holds inst.mu.
+func (inst *LSPInstance) cancelRestart() {
+	if inst.restartTimer != nil {
+		inst.restartTimer.Stop()
+		inst.restartTimer = nil
+	}
+}
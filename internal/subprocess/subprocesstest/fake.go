@@ -0,0 +1,293 @@
+// Package subprocesstest provides a hermetic subprocess.Executor that serves
+// golden LSP traces in-process, so pool and routing tests can exercise
+// realistic server behavior without nix, network access, or real binaries.
+package subprocesstest
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+//go:embed traces/*.json
+var traceFS embed.FS
+
+// Trace is a golden fixture describing how a server answers: the result it
+// returns from initialize and canned results for other requests.
+type Trace struct {
+	Server     string                     `json:"server"`
+	Version    string                     `json:"version"`
+	Initialize json.RawMessage            `json:"initialize"`
+	Responses  map[string]json.RawMessage `json:"responses,omitempty"`
+	// Hang lists methods the server never answers until the client cancels
+	// them with $/cancelRequest, for exercising slow requests.
+	Hang []string `json:"hang,omitempty"`
+}
+
+// Capabilities decodes the server capabilities from the initialize result.
+func (t *Trace) Capabilities() (lsp.ServerCapabilities, error) {
+	var result lsp.InitializeResult
+	if err := json.Unmarshal(t.Initialize, &result); err != nil {
+		return lsp.ServerCapabilities{}, fmt.Errorf("parsing %s initialize result: %w", t.Server, err)
+	}
+	return result.Capabilities, nil
+}
+
+// LoadTrace loads the golden trace for server (e.g. "gopls").
+func LoadTrace(server string) (*Trace, error) {
+	data, err := traceFS.ReadFile(path.Join("traces", server+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("no trace for %s: %w", server, err)
+	}
+
+	var t Trace
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("parsing trace for %s: %w", server, err)
+	}
+	return &t, nil
+}
+
+// TraceNames lists the available golden traces.
+func TraceNames() []string {
+	entries, _ := traceFS.ReadDir("traces")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	return names
+}
+
+// Executor is a subprocess.Executor whose processes are in-memory fake
+// servers replaying traces. Binaries are resolved by the configured binary
+// name, or the last attribute of the flake when none is set.
+type Executor struct {
+	traces  map[string]*Trace
+	servers map[string]*Server
+	mu      sync.Mutex
+}
+
+var _ subprocess.Executor = (*Executor)(nil)
+
+// NewExecutor returns an executor serving the named golden traces.
+func NewExecutor(servers ...string) (*Executor, error) {
+	e := &Executor{
+		traces:  make(map[string]*Trace),
+		servers: make(map[string]*Server),
+	}
+	for _, name := range servers {
+		t, err := LoadTrace(name)
+		if err != nil {
+			return nil, err
+		}
+		e.Add(name, t)
+	}
+	return e, nil
+}
+
+// Add makes trace available under binary name.
+func (e *Executor) Add(name string, trace *Trace) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.traces[name] = trace
+}
+
+// Server returns the most recently started fake server for name.
+func (e *Executor) Server(name string) *Server {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.servers[name]
+}
+
+func (e *Executor) Build(ctx context.Context, flake, binarySpec string) (string, error) {
+	name := binarySpec
+	if name == "" {
+		name = flake
+		if i := strings.LastIndex(name, "#"); i >= 0 {
+			name = name[i+1:]
+		}
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.traces[name]; !ok {
+		return "", fmt.Errorf("no fake server for %q", name)
+	}
+	return name, nil
+}
+
+func (e *Executor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*subprocess.Process, error) {
+	e.mu.Lock()
+	trace, ok := e.traces[path]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no fake server for %q", path)
+	}
+
+	srv, proc := startServer(ctx, trace)
+
+	e.mu.Lock()
+	e.servers[path] = srv
+	e.mu.Unlock()
+
+	return proc, nil
+}
+
+// Server is a running fake LSP. It records every method it receives.
+type Server struct {
+	trace     *Trace
+	exit      func() error
+	received  []string
+	hanging   map[string]chan struct{}
+	cancelled []string
+	mu        sync.Mutex
+}
+
+// Received returns the methods received so far, in order.
+func (s *Server) Received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// Cancelled returns the IDs of hanging requests cancelled so far.
+func (s *Server) Cancelled() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.cancelled...)
+}
+
+// Crash kills the server as if its process had died.
+func (s *Server) Crash() {
+	s.exit()
+}
+
+func startServer(ctx context.Context, trace *Trace) (*Server, *subprocess.Process) {
+	srv := &Server{trace: trace, hanging: make(map[string]chan struct{})}
+
+	clientToServerR, clientToServerW := io.Pipe()
+	serverToClientR, serverToClientW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+
+	ctx, cancel := context.WithCancel(ctx)
+	conn := jsonrpc.NewConn(clientToServerR, serverToClientW, srv.handle)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.Run(ctx)
+	}()
+
+	var once sync.Once
+	kill := func() error {
+		once.Do(func() {
+			cancel()
+			conn.Close()
+			clientToServerR.Close()
+			serverToClientW.Close()
+			stderrW.Close()
+		})
+		return nil
+	}
+	srv.exit = kill
+
+	// Like exec.CommandContext, cancelling ctx kills the process.
+	go func() {
+		<-ctx.Done()
+		kill()
+	}()
+
+	return srv, &subprocess.Process{
+		Stdin:  clientToServerW,
+		Stdout: serverToClientR,
+		Stderr: stderrR,
+		Wait: func() error {
+			<-done
+			kill()
+			return nil
+		},
+		Kill: kill,
+	}
+}
+
+func (s *Server) handle(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	s.mu.Lock()
+	s.received = append(s.received, msg.Method)
+	s.mu.Unlock()
+
+	if msg.IsNotification() {
+		switch msg.Method {
+		case lsp.MethodExit:
+			s.exit()
+		case lsp.MethodCancelRequest:
+			s.cancel(msg.Params)
+		}
+		return nil, nil
+	}
+
+	for _, method := range s.trace.Hang {
+		if msg.Method == method {
+			return s.hang(ctx, msg)
+		}
+	}
+
+	switch msg.Method {
+	case lsp.MethodInitialize:
+		resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+		resp.Result = s.trace.Initialize
+		return resp, nil
+	case lsp.MethodShutdown:
+		return jsonrpc.NewResponse(*msg.ID, nil)
+	}
+
+	if result, ok := s.trace.Responses[msg.Method]; ok {
+		resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+		resp.Result = result
+		return resp, nil
+	}
+
+	return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.MethodNotFound,
+		fmt.Sprintf("%s: method not found: %s", s.trace.Server, msg.Method), nil)
+}
+
+// hang blocks until msg is cancelled, then answers it as LSP servers do.
+func (s *Server) hang(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	cancelled := make(chan struct{})
+	s.mu.Lock()
+	s.hanging[msg.ID.String()] = cancelled
+	s.mu.Unlock()
+
+	select {
+	case <-cancelled:
+	case <-ctx.Done():
+	}
+	return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.RequestCancelled, "request cancelled", nil)
+}
+
+func (s *Server) cancel(params json.RawMessage) {
+	var p struct {
+		ID jsonrpc.ID `json:"id"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := p.ID.String()
+	if ch, ok := s.hanging[id]; ok {
+		delete(s.hanging, id)
+		s.cancelled = append(s.cancelled, id)
+		close(ch)
+	}
+}
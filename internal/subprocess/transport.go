@@ -0,0 +1,184 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// Transports a server can be reached over (see config.LSP.Transport).
+const (
+	TransportStdio   = "stdio"
+	TransportTCP     = "tcp"
+	TransportUnix    = "unix"
+	TransportNodeIPC = "node-ipc"
+)
+
+// Transport is how lux talks to an LSP's server. Address is where a tcp
+// (host:port) or unix (socket path) server listens. The zero Transport is
+// stdio.
+type Transport struct {
+	Kind    string
+	Address string
+}
+
+// dialTimeout is how long lux keeps trying to reach a server listening on a
+// socket before giving up on starting it.
+const dialTimeout = 10 * time.Second
+
+// attaches reports whether inst's server is one lux connects to without
+// starting: a socket server with neither flake nor binary. The caller holds
+// inst.mu.
+func (inst *LSPInstance) attaches() bool {
+	switch inst.transport.Kind {
+	case TransportTCP, TransportUnix:
+		return inst.Flake == "" && inst.Binary == "" && inst.command == ""
+	}
+	return false
+}
+
+// connect starts inst's server, connects to it, or both, as its transport
+// asks. Whatever the transport, the returned Process carries the server's
+// messages on Stdin and Stdout. The caller holds inst.mu.
+func (p *Pool) connect(inst *LSPInstance, initParams *lsp.InitializeParams) (*Process, error) {
+	if inst.attaches() {
+		return dial(inst.ctx, inst.transport.Kind, inst.transport.Address)
+	}
+
+	executor, spec, err := p.executorFor(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	binPath, err := executor.Build(inst.ctx, inst.Flake, spec)
+	if err != nil {
+		return nil, fmt.Errorf("building %s: %w", inst.Name, err)
+	}
+
+	var workDir string
+	if initParams != nil && initParams.RootPath != nil {
+		workDir = *initParams.RootPath
+	}
+
+	// A local server's memory is limited by its cgroup where lux can make
+	// one; the address-space rlimit is the fallback.
+	args := inst.Args
+	if inst.limits.Memory > 0 && (inst.remote != "" || !cgroupLimitsMemory()) {
+		binPath, args = limitAddressSpace(binPath, args, inst.limits)
+	}
+	// A local server starts at the niceness it was last set to (see SetNice)
+	// rather than being reniced once its threads are already running.
+	if inst.remote == "" {
+		binPath, args = niceCommand(binPath, args, inst.nice)
+	}
+
+	if inst.transport.Kind == TransportNodeIPC {
+		proc, err := startNodeIPC(inst.ctx, binPath, args, inst.Env, workDir)
+		if err != nil {
+			return nil, fmt.Errorf("executing %s: %w", inst.Name, err)
+		}
+		return proc, nil
+	}
+
+	proc, err := executor.Execute(inst.ctx, binPath, args, inst.Env, workDir)
+	if err != nil {
+		return nil, fmt.Errorf("executing %s: %w", inst.Name, err)
+	}
+
+	switch inst.transport.Kind {
+	case TransportTCP, TransportUnix:
+		conn, err := dial(inst.ctx, inst.transport.Kind, inst.transport.Address)
+		if err != nil {
+			proc.Kill()
+			return nil, err
+		}
+		// The server talks over the socket; anything it writes to stdout
+		// is only logged.
+		go NewStderrLogger(inst.Name, os.Stderr).Run(proc.Stdout)
+		return &Process{
+			Stdin:  conn.Stdin,
+			Stdout: conn.Stdout,
+			Stderr: proc.Stderr,
+			Wait:   proc.Wait,
+			Kill: func() error {
+				conn.Kill()
+				return proc.Kill()
+			},
+			Pid: proc.Pid,
+		}, nil
+	}
+	return proc, nil
+}
+
+// dial connects to a server listening on address, retrying with backoff for
+// up to dialTimeout since a server started alongside lux may not be
+// listening yet. A dropped connection fails the instance like a crashed
+// process, and the next request reconnects.
+func dial(ctx context.Context, network, address string) (*Process, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	backoff := 50 * time.Millisecond
+	for {
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err == nil {
+			return connProcess(conn), nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connecting to %s: %w", address, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Second)
+	}
+}
+
+// connProcess presents a connection to a server as its Process. Closing
+// stdin or killing it closes the connection, and Wait returns once it is
+// closed by either side.
+func connProcess(conn net.Conn) *Process {
+	c := &closingConn{Conn: conn, done: make(chan struct{})}
+	return &Process{
+		Stdin:  c,
+		Stdout: c,
+		Stderr: io.NopCloser(strings.NewReader("")),
+		Wait: func() error {
+			<-c.done
+			return nil
+		},
+		Kill: c.Close,
+	}
+}
+
+// closingConn is a connection that records being closed, locally or by the
+// server hanging up.
+type closingConn struct {
+	net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *closingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err != nil {
+		c.Close()
+	}
+	return n, err
+}
+
+func (c *closingConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		err = c.Conn.Close()
+		close(c.done)
+	})
+	return err
+}
@@ -0,0 +1,193 @@
+package subprocess
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// socketServer is a language server listening on a socket, answering
+// requests like lspServer and recording the methods it receives.
+type socketServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	conns    []net.Conn
+	methods  []string
+}
+
+func newSocketServer(t *testing.T, network, address string) *socketServer {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &socketServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.conns = append(srv.conns, conn)
+			srv.mu.Unlock()
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (s *socketServer) serve(conn net.Conn) {
+	stream := jsonrpc.NewStream(conn, conn)
+	for {
+		msg, err := stream.Read()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.methods = append(s.methods, msg.Method)
+		s.mu.Unlock()
+		if msg.ID == nil {
+			continue
+		}
+		resp, _ := jsonrpc.NewResponse(*msg.ID, map[string]string{"echo": msg.Method})
+		stream.Write(resp)
+	}
+}
+
+// hangUp closes the server's side of every connection.
+func (s *socketServer) hangUp() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *socketServer) received() (conns int, methods []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns), append([]string(nil), s.methods...)
+}
+
+func TestPool_Attach(t *testing.T) {
+	tests := []struct {
+		transport string
+		address   func(t *testing.T) string
+	}{
+		{TransportTCP, func(t *testing.T) string { return "127.0.0.1:0" }},
+		{TransportUnix, func(t *testing.T) string { return filepath.Join(t.TempDir(), "ls.sock") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.transport, func(t *testing.T) {
+			srv := newSocketServer(t, tt.transport, tt.address(t))
+			testAttach(t, srv, Transport{Kind: tt.transport, Address: srv.listener.Addr().String()})
+		})
+	}
+}
+
+func testAttach(t *testing.T, srv *socketServer, transport Transport) {
+	pool := NewPool(nil, func(name string) jsonrpc.Handler {
+		return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+			return nil, nil
+		}
+	})
+	if err := pool.Register("debug-ls", Registration{SettingsKey: "debug-ls", Transport: transport}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	call := func() {
+		t.Helper()
+		inst, err := pool.GetOrStart(ctx, "debug-ls", &lsp.InitializeParams{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := inst.Call(ctx, "textDocument/hover", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(result) != `{"echo":"textDocument/hover"}` {
+			t.Errorf("expected the hover echoed, got %s", result)
+		}
+	}
+
+	call()
+
+	// A dropped connection fails the instance, and the next request
+	// reconnects and initializes again.
+	srv.hangUp()
+	for {
+		if state, _ := pool.State("debug-ls"); state != LSPStateRunning {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("expected the instance to notice the dropped connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	call()
+
+	if err := pool.Stop("debug-ls"); err != nil {
+		t.Fatal(err)
+	}
+
+	conns, methods := srv.received()
+	if conns != 2 {
+		t.Errorf("expected 2 connections, got %d", conns)
+	}
+	initializes := 0
+	for _, method := range methods {
+		switch method {
+		case lsp.MethodInitialize:
+			initializes++
+		case lsp.MethodShutdown, lsp.MethodExit:
+			t.Errorf("expected the attached server not to be shut down, got %s", method)
+		}
+	}
+	if initializes != 2 {
+		t.Errorf("expected an initialize per connection, got %d", initializes)
+	}
+}
+
+func TestStartNodeIPC(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+
+	// The server answers one message on its IPC channel with the channel fd
+	// and the flag it was started with.
+	script := `read -r msg <&3; printf '{"jsonrpc":"2.0","id":1,"result":"%s %s"}\n' "$NODE_CHANNEL_FD" "$1" >&3`
+	proc, err := startNodeIPC(context.Background(), "/bin/sh", []string{"-c", script, "sh"}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Kill()
+
+	r, w := FrameStdio(FramingNDJSON, proc.Stdout, proc.Stdin)
+	conn := jsonrpc.NewConn(r, w, func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		return nil, nil
+	})
+	go conn.Run(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := conn.Call(ctx, "initialize", map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != `"3 --node-ipc"` {
+		t.Errorf("expected the channel on fd 3 and --node-ipc, got %s", result)
+	}
+}
@@ -0,0 +1,52 @@
+package subprocess
+
+import (
+	"sync"
+	"time"
+)
+
+// processUsage is a process's resident memory, in bytes, and the CPU time
+// it has used since it started.
+type processUsage struct {
+	rss int64
+	cpu time.Duration
+}
+
+// usageSampler turns an instance's successive CPU time readings into the
+// share of a CPU it used in between.
+type usageSampler struct {
+	at  time.Time
+	cpu time.Duration
+	mu  sync.Mutex
+}
+
+// reset starts sampling over, for a new process.
+func (s *usageSampler) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at, s.cpu = time.Time{}, 0
+}
+
+// sample reads the usage of process pid and returns its RSS and the
+// percentage of one CPU it has used since the previous sample, or since it
+// started for the first one (startedAt).
+func (s *usageSampler) sample(pid int, startedAt time.Time) (rss int64, cpuPercent float64, err error) {
+	usage, err := readUsage(pid)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	since, cpu := startedAt, time.Duration(0)
+	if !s.at.IsZero() {
+		since, cpu = s.at, s.cpu
+	}
+	if elapsed := now.Sub(since); elapsed > 0 && usage.cpu >= cpu {
+		cpuPercent = 100 * float64(usage.cpu-cpu) / float64(elapsed)
+	}
+	s.at, s.cpu = now, usage.cpu
+	return usage.rss, cpuPercent, nil
+}
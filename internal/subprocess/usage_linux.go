@@ -0,0 +1,44 @@
+//go:build linux
+
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the kernel's USER_HZ, the unit of CPU times in
+// /proc/<pid>/stat; it is 100 on every Linux architecture Go supports.
+const clockTicks = 100
+
+// readUsage reads the usage of process pid from /proc.
+func readUsage(pid int) (processUsage, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return processUsage{}, err
+	}
+	// The command name, field 2, is parenthesized and may hold spaces.
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return processUsage{}, fmt.Errorf("parsing /proc/%d/stat", pid)
+	}
+	// Fields from 3 (state) on; utime and stime are 14 and 15, rss 24.
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 22 {
+		return processUsage{}, fmt.Errorf("parsing /proc/%d/stat", pid)
+	}
+	utime, err1 := strconv.ParseInt(fields[11], 10, 64)
+	stime, err2 := strconv.ParseInt(fields[12], 10, 64)
+	pages, err3 := strconv.ParseInt(fields[21], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return processUsage{}, fmt.Errorf("parsing /proc/%d/stat", pid)
+	}
+
+	return processUsage{
+		rss: pages * int64(os.Getpagesize()),
+		cpu: time.Duration(utime+stime) * time.Second / clockTicks,
+	}, nil
+}
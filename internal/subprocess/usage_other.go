@@ -0,0 +1,55 @@
+//go:build !linux
+
+package subprocess
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readUsage reads the usage of process pid with ps, where there is no
+// /proc to read it from.
+func readUsage(pid int) (processUsage, error) {
+	out, err := exec.Command("ps", "-o", "rss=,time=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return processUsage{}, fmt.Errorf("running ps: %w", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return processUsage{}, fmt.Errorf("parsing ps output %q", out)
+	}
+	kib, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return processUsage{}, fmt.Errorf("parsing ps output %q", out)
+	}
+	cpu, err := parseCPUTime(fields[1])
+	if err != nil {
+		return processUsage{}, err
+	}
+	return processUsage{rss: kib * 1024, cpu: cpu}, nil
+}
+
+// parseCPUTime parses ps's [[dd-]hh:]mm:ss[.ss] CPU time.
+func parseCPUTime(s string) (time.Duration, error) {
+	var total time.Duration
+	if days, rest, ok := strings.Cut(s, "-"); ok {
+		d, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("parsing CPU time %q", s)
+		}
+		total, s = time.Duration(d)*24*time.Hour, rest
+	}
+
+	var seconds float64
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parsing CPU time %q", s)
+		}
+		seconds = seconds*60 + n
+	}
+	return total + time.Duration(seconds*float64(time.Second)), nil
+}
@@ -0,0 +1,31 @@
+package subprocess
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUsageSampler(t *testing.T) {
+	var sampler usageSampler
+	startedAt := time.Now().Add(-time.Second)
+
+	rss, cpu, err := sampler.sample(os.Getpid(), startedAt)
+	if err != nil {
+		t.Skipf("reading usage: %v", err)
+	}
+	if rss <= 0 {
+		t.Errorf("expected a resident set, got %d", rss)
+	}
+	if cpu < 0 {
+		t.Errorf("expected a CPU percentage, got %f", cpu)
+	}
+
+	// Burn some CPU so the next sample, taken over a short interval, sees it.
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for n := 0; time.Now().Before(deadline); n++ {
+	}
+	if _, cpu, err = sampler.sample(os.Getpid(), startedAt); err != nil || cpu <= 0 {
+		t.Errorf("expected CPU use since the previous sample, got %f (%v)", cpu, err)
+	}
+}
@@ -0,0 +1,332 @@
+// Package client talks to a running lux server over its control socket, so
+// other tools can inspect and manage the language servers lux runs for a
+// workspace. The socket's path comes from config.Config.SocketPath in
+// github.com/amarbel-llc/lux/pkg/config.
+//
+// Like every package under pkg/, its API follows semantic versioning: it
+// changes incompatibly only with a new major version of lux.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/buildinfo"
+)
+
+// StatusOptions orders and filters the servers a status lists.
+type StatusOptions struct {
+	// SortBy is "name" (the default), "state" (in lifecycle order), or
+	// "uptime" (longest-running first, then servers that aren't running).
+	SortBy string
+	// States keeps only servers in one of these states; empty keeps all.
+	States []string
+}
+
+// ServerStatus is the state of one language server.
+type ServerStatus struct {
+	Name      string    `json:"name"`
+	Flake     string    `json:"flake"`
+	State     string    `json:"state"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+	// NeverStarted distinguishes a server that is registered but has never
+	// run from one that is idle or stopped after running.
+	NeverStarted bool `json:"never_started,omitempty"`
+	// Unhealthy is set when the server failed its last health check.
+	Unhealthy bool `json:"unhealthy,omitempty"`
+	// Pid, RSS (resident memory, in bytes), and CPU (percent of one CPU
+	// since the previous status) describe a running server's process.
+	Pid   int     `json:"pid,omitempty"`
+	RSS   int64   `json:"rss,omitempty"`
+	CPU   float64 `json:"cpu,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// BuildInfo describes the lux binary a server runs.
+type BuildInfo struct {
+	Version     string `json:"version"`
+	Commit      string `json:"commit,omitempty"`
+	LSPProtocol string `json:"lspProtocol"`
+	MCPProtocol string `json:"mcpProtocol"`
+}
+
+// String formats b on one line, as `lux status` shows it.
+func (b BuildInfo) String() string {
+	return buildinfo.Info(b).String()
+}
+
+// Client is a connection to a lux server's control socket. It is not safe
+// for concurrent use.
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewClient connects to the control socket at path.
+func NewClient(path string) (*Client, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no lux server running (socket %s not found)", path)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to socket: %w", err)
+	}
+	return &Client{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// send sends cmd and decodes the response into result, which may be nil.
+func (c *Client) send(cmd string, result any) error {
+	if _, err := c.conn.Write([]byte(cmd + "\n")); err != nil {
+		return err
+	}
+
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(line, &failure); err != nil {
+		return err
+	}
+	if failure.Error != "" {
+		return errors.New(failure.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(line, result)
+}
+
+// Servers returns the state of every language server, ordered and filtered
+// by opts.
+func (c *Client) Servers(opts StatusOptions) ([]ServerStatus, error) {
+	_, servers, err := c.status(opts)
+	return servers, err
+}
+
+// Build returns what the server reports about the lux binary it runs, or nil
+// if it predates reporting it.
+func (c *Client) Build() (*BuildInfo, error) {
+	build, _, err := c.status(StatusOptions{})
+	return build, err
+}
+
+func (c *Client) status(opts StatusOptions) (*BuildInfo, []ServerStatus, error) {
+	cmd := "status"
+	if opts.SortBy != "" {
+		cmd += " sort=" + opts.SortBy
+	}
+	if len(opts.States) > 0 {
+		cmd += " state=" + strings.Join(opts.States, ",")
+	}
+
+	var result struct {
+		Lux  *BuildInfo     `json:"lux"`
+		LSPs []ServerStatus `json:"lsps"`
+	}
+	if err := c.send(cmd, &result); err != nil {
+		return nil, nil, err
+	}
+	return result.Lux, result.LSPs, nil
+}
+
+// Status writes the server's lux version and the servers' states to w, one
+// per line, as `lux status` shows them.
+func (c *Client) Status(w io.Writer, opts StatusOptions) error {
+	build, servers, err := c.status(opts)
+	if err != nil {
+		return err
+	}
+
+	if build != nil {
+		fmt.Fprintln(w, build)
+	}
+
+	if servers == nil {
+		fmt.Fprintln(w, "No LSPs registered")
+		return nil
+	}
+
+	for _, s := range servers {
+		state := s.State
+		if s.NeverStarted {
+			state += " (never started)"
+		} else if !s.StartedAt.IsZero() && s.State == "running" {
+			state += fmt.Sprintf(" (up %s)", time.Since(s.StartedAt).Round(time.Second))
+		}
+		if s.Unhealthy {
+			state += " (unhealthy)"
+		}
+		if s.Pid != 0 {
+			state += fmt.Sprintf(" [pid %d, %s, %.1f%% CPU]", s.Pid, formatBytes(s.RSS), s.CPU)
+		}
+		if s.Error != "" && s.State != "running" {
+			state += ": " + s.Error
+		}
+		fmt.Fprintf(w, "%-20s %s\n", s.Name, state)
+	}
+
+	return nil
+}
+
+// formatBytes formats n bytes in binary units, as status shows memory.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, prefix := float64(n)/unit, 0
+	for value >= unit && prefix < len("KMGT")-1 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[prefix])
+}
+
+// Start starts the named server without waiting for a matching request.
+func (c *Client) Start(name string) error {
+	return c.send("start "+name, nil)
+}
+
+// Stop stops the named server.
+func (c *Client) Stop(name string) error {
+	return c.send("stop "+name, nil)
+}
+
+// Dump writes the server's state dump to w.
+func (c *Client) Dump(w io.Writer) error {
+	var result struct {
+		Dump string `json:"dump"`
+	}
+	if err := c.send("dump", &result); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, result.Dump)
+	return err
+}
+
+// State writes the server's routing state to w as indented JSON, in the
+// form LoadState accepts. Open documents' text is only included if withText
+// is set.
+func (c *Client) State(w io.Writer, withText bool) error {
+	var result struct {
+		State json.RawMessage `json:"state"`
+	}
+	command := "state"
+	if withText {
+		command += " text"
+	}
+	if err := c.send(command, &result); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, result.State, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// Document is a document open in the server's client, as the client last
+// synced it.
+type Document struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+// Documents returns the documents open in the server's client, with their
+// text.
+func (c *Client) Documents() ([]Document, error) {
+	var result struct {
+		State struct {
+			Documents []Document `json:"documents"`
+		} `json:"state"`
+	}
+	if err := c.send("state text", &result); err != nil {
+		return nil, err
+	}
+	return result.State.Documents, nil
+}
+
+// LoadState loads a routing state written by State into the server, and
+// writes the documents that route differently there than they did in the
+// server the state came from to w.
+func (c *Client) LoadState(state []byte, w io.Writer) error {
+	var line bytes.Buffer
+	if err := json.Compact(&line, state); err != nil {
+		return fmt.Errorf("parsing state: %w", err)
+	}
+
+	var result struct {
+		Mismatches []struct {
+			URI    string   `json:"uri"`
+			Dumped []string `json:"dumped"`
+			Loaded []string `json:"loaded"`
+		} `json:"mismatches"`
+	}
+	if err := c.send("load-state "+line.String(), &result); err != nil {
+		return err
+	}
+
+	if len(result.Mismatches) == 0 {
+		fmt.Fprintln(w, "Every document routes as it did")
+		return nil
+	}
+	for _, m := range result.Mismatches {
+		fmt.Fprintln(w, m.URI)
+		fmt.Fprintf(w, "  dumped: %s\n", strings.Join(m.Dumped, ", "))
+		fmt.Fprintf(w, "  loaded: %s\n", strings.Join(m.Loaded, ", "))
+	}
+	return nil
+}
+
+// Reload makes the server reload its configuration and writes what changed
+// to w.
+func (c *Client) Reload(w io.Writer) error {
+	var result struct {
+		Changes map[string]any `json:"changes"`
+	}
+	if err := c.send("reload", &result); err != nil {
+		return err
+	}
+
+	changes := result.Changes
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return nil
+	}
+
+	for _, key := range []string{"added", "removed", "changed", "settings_changed"} {
+		names, ok := changes[key].([]any)
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			fmt.Fprintf(w, "%-18s %v\n", key, name)
+		}
+	}
+	if changes["matchers_changed"] == true {
+		fmt.Fprintln(w, "file matchers rebuilt")
+	}
+
+	return nil
+}
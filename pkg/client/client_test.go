@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// serve answers each command on a fake control socket with the response
+// responses maps it to.
+func serve(t *testing.T, responses map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lux.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			conn.Write([]byte(responses[scanner.Text()] + "\n"))
+		}
+	}()
+	return path
+}
+
+func TestClient_Servers(t *testing.T) {
+	path := serve(t, map[string]string{
+		"status state=running": `{"lsps": [{"name": "gopls", "flake": "nixpkgs#gopls", "state": "running", "started_at": "2026-01-02T03:04:05Z"}]}`,
+		"stop nope":            `{"error": "unknown LSP: nope"}`,
+	})
+
+	c, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	servers, err := c.Servers(StatusOptions{States: []string{"running"}})
+	if err != nil {
+		t.Fatalf("Servers: %v", err)
+	}
+	if len(servers) != 1 || servers[0].Name != "gopls" || servers[0].State != "running" || servers[0].StartedAt.Year() != 2026 {
+		t.Errorf("unexpected servers %+v", servers)
+	}
+
+	if err := c.Stop("nope"); err == nil || err.Error() != "unknown LSP: nope" {
+		t.Errorf("expected the server's error, got %v", err)
+	}
+}
+
+func TestClient_StatusEmpty(t *testing.T) {
+	path := serve(t, map[string]string{"status": `{"lsps": null}`})
+
+	c, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	var buf bytes.Buffer
+	if err := c.Status(&buf, StatusOptions{}); err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if buf.String() != "No LSPs registered\n" {
+		t.Errorf("expected %q, got %q", "No LSPs registered\n", buf.String())
+	}
+}
+
+func TestClient_StatusBuild(t *testing.T) {
+	path := serve(t, map[string]string{"status": `{"lux": {"version": "0.2.0", "commit": "0123456789abcdef", "lspProtocol": "3.17", "mcpProtocol": "2024-11-05"}, "lsps": null}`})
+
+	c, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	var buf bytes.Buffer
+	if err := c.Status(&buf, StatusOptions{}); err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	expected := "lux 0.2.0 (commit 0123456789ab, LSP 3.17, MCP 2024-11-05)\nNo LSPs registered\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestClient_StatusUsage(t *testing.T) {
+	path := serve(t, map[string]string{"status": `{"lsps": [{"name": "rust-analyzer", "state": "running", "pid": 4242, "rss": 1610612736, "cpu": 12.34}, {"name": "gopls", "state": "stopped"}]}`})
+
+	c, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	var buf bytes.Buffer
+	if err := c.Status(&buf, StatusOptions{}); err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	expected := "rust-analyzer        running [pid 4242, 1.5 GiB, 12.3% CPU]\n" +
+		"gopls                stopped\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestClient_StatusError(t *testing.T) {
+	path := serve(t, map[string]string{"status": `{"lsps": [{"name": "clangd", "state": "idle", "never_started": true, "error": "clangd needs compile_commands.json in /src"}]}`})
+
+	c, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	var buf bytes.Buffer
+	if err := c.Status(&buf, StatusOptions{}); err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	expected := "clangd               idle (never started): clangd needs compile_commands.json in /src\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestNewClient_NoServer(t *testing.T) {
+	if _, err := NewClient(filepath.Join(t.TempDir(), "missing.sock")); err == nil {
+		t.Error("expected an error when no server is running")
+	}
+}
+
+func TestClient_LoadState(t *testing.T) {
+	path := serve(t, map[string]string{
+		`load-state {"documents":[{"uri":"file:///a.rs","routes":["rust-analyzer"]}]}`: `{"ok": true, "mismatches": [{"uri": "file:///a.rs", "dumped": ["rust-analyzer"], "loaded": ["rust-analyzer", "ra-multiplex"]}]}`,
+	})
+
+	c, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	state := []byte("{\n  \"documents\": [\n    {\"uri\": \"file:///a.rs\", \"routes\": [\"rust-analyzer\"]}\n  ]\n}\n")
+	var buf bytes.Buffer
+	if err := c.LoadState(state, &buf); err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	expected := "file:///a.rs\n  dumped: rust-analyzer\n  loaded: rust-analyzer, ra-multiplex\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestClient_Documents(t *testing.T) {
+	path := serve(t, map[string]string{
+		"state text": `{"state": {"documents": [{"uri": "file:///a.go", "version": 3, "length": 10, "text": "package a\n", "routes": ["gopls"]}]}}`,
+	})
+
+	c, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	docs, err := c.Documents()
+	if err != nil {
+		t.Fatalf("Documents: %v", err)
+	}
+	if len(docs) != 1 || docs[0].URI != "file:///a.go" || docs[0].Version != 3 || docs[0].Text != "package a\n" {
+		t.Errorf("unexpected documents %+v", docs)
+	}
+}
@@ -0,0 +1,1564 @@
+// Package config reads lux's configuration: the language servers of
+// lsps.toml, the formatters of formatters.toml, and the per-project files
+// that override them. Tools that work alongside lux can load the same
+// configuration it does, e.g. to find a workspace's control socket.
+//
+// This package is part of lux's public API and follows semantic versioning.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gobwas/glob"
+	"github.com/amarbel-llc/lux/pkg/executor"
+	"github.com/amarbel-llc/lux/pkg/plugin"
+)
+
+type Config struct {
+	Socket                 string `toml:"socket"`
+	HealthSeverity         string `toml:"health_severity,omitempty"`
+	Executor               string `toml:"executor,omitempty"`
+	UsageStats             bool   `toml:"usage_stats,omitempty"`
+	MaxRestarts            int    `toml:"max_restarts,omitempty"`
+	RestartWindow          string `toml:"restart_window,omitempty"`
+	AutoRestarts           int    `toml:"auto_restarts,omitempty"`
+	RestartBackoff         string `toml:"restart_backoff,omitempty"`
+	StartupStagger         string `toml:"startup_stagger,omitempty"`
+	IdleTimeout            string `toml:"idle_timeout,omitempty"`
+	HealthCheckInterval    string `toml:"health_check_interval,omitempty"`
+	HealthCheckTimeout     string `toml:"health_check_timeout,omitempty"`
+	FanoutScope            string `toml:"fanout_scope,omitempty"`
+	FanoutTimeout          string `toml:"fanout_timeout,omitempty"`
+	CompletionMode         string `toml:"completion_mode,omitempty"`
+	SaveTimeout            string `toml:"save_timeout,omitempty"`
+	HoverMode              string `toml:"hover_mode,omitempty"`
+	RenameMode             string `toml:"rename_mode,omitempty"`
+	SemanticTokensMode     string `toml:"semantic_tokens_mode,omitempty"`
+	FormatMode             string `toml:"format_mode,omitempty"`
+	FileWatcher            string `toml:"file_watcher,omitempty"`
+	FallbackMode           string `toml:"fallback_mode,omitempty"`
+	TelemetryMode          string `toml:"telemetry_mode,omitempty"`
+	InteractiveConcurrency int    `toml:"interactive_concurrency,omitempty"`
+	BackgroundConcurrency  int    `toml:"background_concurrency,omitempty"`
+	FocusNice              int    `toml:"focus_nice,omitempty"`
+	LSPs                   []LSP  `toml:"lsp"`
+	DAPs                   []DAP  `toml:"dap,omitempty"`
+
+	// ToolTimeouts bounds MCP tool calls by tool name, as durations; the
+	// "default" entry applies to tools without one of their own.
+	ToolTimeouts map[string]string `toml:"tool_timeouts,omitempty"`
+
+	// MaxToolOutput caps the text of an MCP tool result, in bytes; larger
+	// results are summarized with the rest available page by page. -1
+	// removes the cap.
+	MaxToolOutput int `toml:"max_tool_output,omitempty"`
+
+	// RequestTimeouts bounds requests forwarded to backends by LSP method,
+	// as durations; the "default" entry applies to methods without one of
+	// their own. An LSP's own request_timeouts take precedence.
+	RequestTimeouts map[string]string `toml:"request_timeouts,omitempty"`
+
+	// ReadOnlyRoots lists directories whose documents lux won't ask servers
+	// to edit (rename, format, code actions), in addition to the Nix store.
+	// Relative roots are relative to the project root.
+	ReadOnlyRoots []string `toml:"read_only_roots,omitempty"`
+
+	// Formatting overrides the options sent with formatting requests, by
+	// language ID, or by file extension for documents opened without one,
+	// so a repository's indentation policy holds whatever the editor asks.
+	Formatting map[string]FormattingPolicy `toml:"formatting,omitempty"`
+
+	// Plugins are traffic filters lux loads at startup and calls for the
+	// methods they list. Only the global config may declare them.
+	Plugins []Plugin `toml:"plugin,omitempty"`
+
+	// Transforms rewrite the params lux sends backends and the results they
+	// answer with, in order, to work around server quirks.
+	Transforms []Transform `toml:"transforms,omitempty"`
+}
+
+// Fanout scopes select which backends receive requests that have no document
+// to route on, such as workspace/symbol.
+const (
+	FanoutScopeRunning = "running"
+	FanoutScopeAll     = "all"
+)
+
+// Completion modes choose between asking only the primary LSP for a file and
+// merging completions from every matching LSP.
+const (
+	CompletionModePrimary = "primary"
+	CompletionModeMerge   = "merge"
+)
+
+// Hover modes choose how hovers from several LSPs matching a file are
+// combined: the first non-empty one, or all of them under per-server headers.
+const (
+	HoverModeFirst = "first"
+	HoverModeMerge = "merge"
+)
+
+// Rename modes choose between renaming with the primary LSP for a file and
+// asking every matching LSP, merging their edits. When merged edits
+// conflict, "merge" keeps the earlier server's in routing order and "strict"
+// fails the rename.
+const (
+	RenameModePrimary = "primary"
+	RenameModeMerge   = "merge"
+	RenameModeStrict  = "strict"
+)
+
+// Semantic tokens modes choose between using the primary LSP's tokens and
+// merging tokens from every matching LSP.
+const (
+	SemanticTokensModePrimary = "primary"
+	SemanticTokensModeMerge   = "merge"
+)
+
+// Format modes choose between formatting with the primary LSP for a file and
+// running every matching LSP in turn, each formatting the previous result.
+const (
+	FormatModePrimary = "primary"
+	FormatModeChain   = "chain"
+)
+
+// File watcher settings choose whether lux watches the workspace itself on
+// behalf of servers when the client can't: never, or only for clients without
+// dynamic registration for workspace/didChangeWatchedFiles.
+const (
+	FileWatcherOff  = "off"
+	FileWatcherAuto = "auto"
+)
+
+// Fallback modes choose what happens when the primary LSP for a file answers
+// hover, definition, or references with nothing: reply with that, or retry
+// the next matching LSP.
+const (
+	FallbackModeOff   = "off"
+	FallbackModeEmpty = "empty"
+)
+
+// Telemetry modes choose what happens to telemetry/event notifications from
+// backends: pass them to the client, discard them, or write them to lux's
+// log instead.
+const (
+	TelemetryModeForward = "forward"
+	TelemetryModeDrop    = "drop"
+	TelemetryModeLog     = "log"
+)
+
+// Transports an LSP's server can be reached over. "stdio" is the server's
+// standard input and output; "tcp" and "unix" connect to the socket at the
+// LSP's address; "node-ipc" is a Node.js IPC channel, for servers built on
+// vscode-languageserver.
+const (
+	TransportStdio   = "stdio"
+	TransportTCP     = "tcp"
+	TransportUnix    = "unix"
+	TransportNodeIPC = "node-ipc"
+)
+
+// Framings of an LSP's stdio.
+const (
+	FramingLSP    = "lsp"
+	FramingNDJSON = "ndjson"
+	FramingAuto   = "auto"
+)
+
+// Executors control how LSP and formatter binaries are obtained.
+// ExecutorBinary never invokes nix; binaries are resolved from PATH or
+// absolute paths.
+const (
+	ExecutorNix    = "nix"
+	ExecutorBinary = "binary"
+)
+
+// Health severities control how degraded-functionality warnings are shown to
+// the client via window/showMessage. HealthSeverityOff suppresses the message
+// but still sends lux/healthChanged.
+const (
+	HealthSeverityError   = "error"
+	HealthSeverityWarning = "warning"
+	HealthSeverityInfo    = "info"
+	HealthSeverityLog     = "log"
+	HealthSeverityOff     = "off"
+)
+
+type LSP struct {
+	Name         string              `toml:"name"`
+	Flake        string              `toml:"flake"`
+	Binary       string              `toml:"binary,omitempty"`
+	Command      string              `toml:"command,omitempty"`
+	Extensions   []string            `toml:"extensions"`
+	Patterns     []string            `toml:"patterns"`
+	LanguageIDs  []string            `toml:"language_ids"`
+	Args         []string            `toml:"args"`
+	Env          map[string]string   `toml:"env,omitempty"`
+	InitOptions  map[string]any      `toml:"init_options,omitempty"`
+	Settings     map[string]any      `toml:"settings,omitempty"`
+	SettingsKey  string              `toml:"settings_key,omitempty"`
+	Capabilities *CapabilityOverride `toml:"capabilities,omitempty"`
+
+	// SettingsInInitOptions also sends Settings in initializationOptions,
+	// for servers that read their settings only from there.
+	SettingsInInitOptions bool `toml:"settings_in_init_options,omitempty"`
+
+	DiagnosticSource *DiagnosticSource `toml:"diagnostic_source,omitempty"`
+
+	// DiagnosticFilter drops diagnostics from this server before they are
+	// forwarded, to quiet noisy linters.
+	DiagnosticFilter *DiagnosticFilter `toml:"diagnostic_filter,omitempty"`
+
+	// ForceSave sends textDocument/didSave even when the server doesn't ask
+	// for it, for servers that lint on save without declaring save options.
+	ForceSave bool `toml:"force_save,omitempty"`
+
+	// Requires lists files (globs matched in the workspace root and a few
+	// directories below it) of which at least one must exist for the server to
+	// be useful, such as clangd's compile_commands.json. RequiresHint tells the user how to create one.
+	// Unset, the built-in registry's requirements for the name apply.
+	Requires     []string `toml:"requires,omitempty"`
+	RequiresHint string   `toml:"requires_hint,omitempty"`
+
+	// PerFolder runs a separate instance for each workspace folder of a
+	// multi-root workspace, for servers that only understand one root.
+	PerFolder bool `toml:"per_folder,omitempty"`
+
+	// Prewarm builds the server as soon as lux starts and starts it once
+	// the client has initialized, rather than on the first request that
+	// needs it.
+	Prewarm bool `toml:"prewarm,omitempty"`
+
+	// Folders limits the workspace folders the server is told about, e.g.
+	// to Go module roots for gopls. Unset, it sees every folder.
+	Folders *FolderFilter `toml:"folders,omitempty"`
+
+	// RequestTimeouts overrides the top-level request_timeouts for this
+	// server, by LSP method or "default".
+	RequestTimeouts map[string]string `toml:"request_timeouts,omitempty"`
+
+	// MaxInFlight caps the requests sent to the server at once; further
+	// requests wait for one to finish. MaxQueued bounds how many may wait
+	// (DefaultMaxQueued if unset, none if negative); beyond that they are
+	// cancelled. Unset, the server only has its lane budgets.
+	MaxInFlight int `toml:"max_in_flight,omitempty"`
+	MaxQueued   int `toml:"max_queued,omitempty"`
+
+	// IdleTimeout overrides the top-level idle_timeout for this server;
+	// "0" keeps it running however long it is unused.
+	IdleTimeout string `toml:"idle_timeout,omitempty"`
+
+	// MemoryLimit caps the server's memory, as a size such as "4G"; it is
+	// set as its cgroup v2 memory.max on Linux, or failing that as its
+	// address-space rlimit. CPULimit caps it to that many CPUs' worth of
+	// time, through cgroup v2 cpu.max, so it only applies on Linux.
+	MemoryLimit string  `toml:"memory_limit,omitempty"`
+	CPULimit    float64 `toml:"cpu_limit,omitempty"`
+
+	// Framing is how messages are delimited on the server's stdin and
+	// stdout: "lsp" Content-Length headers (the default), "ndjson" one JSON
+	// message per line, or "auto" to tell by the first thing the server
+	// writes, which is usually its answer to initialize.
+	Framing string `toml:"framing,omitempty"`
+
+	// PathMappings translate paths for a server that sees the filesystem
+	// elsewhere than lux does, such as one running in a container. They
+	// apply to every file URI exchanged with the server.
+	PathMappings []PathMapping `toml:"path_mappings,omitempty"`
+
+	// Remote runs the server on another machine, reached at an
+	// ssh://[user@]host[:port] URL. Its binary (or the one its flake names)
+	// is looked up on the remote PATH.
+	Remote string `toml:"remote,omitempty"`
+
+	// Transport is how lux talks to the server: "stdio" (the default),
+	// "tcp", "unix", or "node-ipc".
+	Transport string `toml:"transport,omitempty"`
+
+	// Address is where a tcp (host:port) or unix (socket path) server
+	// listens. lux starts the server and then connects, or with neither
+	// flake nor binary only connects to one already running.
+	Address string `toml:"address,omitempty"`
+
+	// Attach connects to a server already listening on a TCP host:port
+	// instead of starting one, such as a debug build run by hand. lux
+	// reconnects if the connection drops, and leaves the server running
+	// when it disconnects. It is shorthand for transport = "tcp" with that
+	// address and no flake or binary.
+	Attach string `toml:"attach,omitempty"`
+}
+
+// DAP is a debug adapter that `lux dap` can front. It is chosen by the
+// adapterID of the client's initialize request rather than by file type.
+type DAP struct {
+	Name   string            `toml:"name"`
+	Flake  string            `toml:"flake"`
+	Binary string            `toml:"binary,omitempty"`
+	Args   []string          `toml:"args"`
+	Env    map[string]string `toml:"env,omitempty"`
+
+	// AdapterIDs are further adapterID values the adapter serves besides
+	// its name, e.g. "go" for delve.
+	AdapterIDs []string `toml:"adapter_ids,omitempty"`
+}
+
+// FormattingPolicy overrides the FormattingOptions of formatting requests
+// for one language. Unset fields keep the editor's values.
+type FormattingPolicy struct {
+	TabSize                int   `toml:"tab_size,omitempty"`
+	InsertSpaces           *bool `toml:"insert_spaces,omitempty"`
+	TrimTrailingWhitespace *bool `toml:"trim_trailing_whitespace,omitempty"`
+	InsertFinalNewline     *bool `toml:"insert_final_newline,omitempty"`
+	TrimFinalNewlines      *bool `toml:"trim_final_newlines,omitempty"`
+
+	// Normalize rewrites the indentation of the lines formatting edits
+	// replace to follow InsertSpaces and the tab size, for servers that
+	// ignore the options.
+	Normalize bool `toml:"normalize,omitempty"`
+}
+
+// Plugin is a traffic filter module (see package plugin).
+type Plugin struct {
+	Name string `toml:"name"`
+
+	// Module is the path of the module to load, relative to the directory
+	// of the config file if not absolute.
+	Module string `toml:"module"`
+
+	// Runtime is the plugin runtime that loads Module (default "wasm").
+	Runtime string `toml:"runtime,omitempty"`
+
+	// Methods are the LSP methods whose messages are passed through the
+	// filter, in every direction they travel.
+	Methods []string `toml:"methods"`
+}
+
+// RuntimeName returns the runtime that loads the plugin.
+func (p Plugin) RuntimeName() string {
+	if p.Runtime == "" {
+		return plugin.WASM
+	}
+	return p.Runtime
+}
+
+// ModulePath returns the absolute path of the plugin's module.
+func (p Plugin) ModulePath() string {
+	if filepath.IsAbs(p.Module) {
+		return p.Module
+	}
+	return filepath.Join(filepath.Dir(ConfigPath()), p.Module)
+}
+
+// Transform directions: the params of requests lux sends a backend, or the
+// results it answers with.
+const (
+	TransformRequest  = "request"
+	TransformResponse = "response"
+)
+
+// Transform actions.
+const (
+	TransformDrop    = "drop"    // remove the value at Path
+	TransformSet     = "set"     // replace the value at Path with Value
+	TransformDefault = "default" // set the value at Path to Value if missing or null
+)
+
+// Transform is a rule rewriting the messages of one method.
+type Transform struct {
+	Method string `toml:"method"`
+
+	// Server limits the rule to one LSP; empty applies it to all.
+	Server string `toml:"server,omitempty"`
+
+	// Direction is TransformRequest or TransformResponse (the default).
+	Direction string `toml:"direction,omitempty"`
+
+	// Path selects the values the rule acts on: dot-separated object keys
+	// and array indexes, with "*" for every element of an array. Empty
+	// selects the whole params or result.
+	Path string `toml:"path,omitempty"`
+
+	// Match limits the rule to values that contain it: objects with at
+	// least its keys, recursively, or values equal to it.
+	Match any `toml:"match,omitempty"`
+
+	Action string `toml:"action"`
+	Value  any    `toml:"value,omitempty"`
+}
+
+// TransformDirection returns the direction the rule applies in.
+func (t Transform) TransformDirection() string {
+	if t.Direction == "" {
+		return TransformResponse
+	}
+	return t.Direction
+}
+
+// PathSegments returns the components of Path.
+func (t Transform) PathSegments() []string {
+	if t.Path == "" {
+		return nil
+	}
+	return strings.Split(t.Path, ".")
+}
+
+type CapabilityOverride struct {
+	Disable []string `toml:"disable,omitempty"`
+	Enable  []string `toml:"enable,omitempty"`
+}
+
+// DiagnosticSource rewrites the source field of diagnostics from one LSP, so
+// that merged diagnostics from several servers stay distinguishable.
+type DiagnosticSource struct {
+	// Rename maps source strings to replacements (e.g. "ts" -> "tsserver").
+	Rename map[string]string `toml:"rename,omitempty"`
+	// Prefix prepends the LSP name ("gopls: compiler"), and fills in the name
+	// when the server sends no source at all.
+	Prefix bool `toml:"prefix,omitempty"`
+}
+
+// DiagnosticFilter drops diagnostics from one LSP. Codes and sources are
+// those the server sends, before diagnostic_source rewrites them.
+type DiagnosticFilter struct {
+	// MinSeverity drops diagnostics less severe than it: "error",
+	// "warning", "information", or "hint". Diagnostics without a severity
+	// are kept.
+	MinSeverity    string   `toml:"min_severity,omitempty"`
+	ExcludeCodes   []string `toml:"exclude_codes,omitempty"`
+	ExcludeSources []string `toml:"exclude_sources,omitempty"`
+	// ExcludePaths drops every diagnostic on files matching one of these
+	// globs, matched against the file name and the full path.
+	ExcludePaths []string `toml:"exclude_paths,omitempty"`
+}
+
+// FolderFilter selects the workspace folders one LSP sees: those matching
+// one of Globs, or containing one of Markers. Empty, it selects every
+// folder.
+type FolderFilter struct {
+	// Globs are matched against the folder's full path and its name.
+	Globs []string `toml:"globs,omitempty"`
+	// Markers are files, such as go.mod, marking a folder as a project
+	// root.
+	Markers []string `toml:"markers,omitempty"`
+}
+
+// PathMapping maps a directory on the host to where a server sees it.
+type PathMapping struct {
+	Host    string `toml:"host"`
+	Backend string `toml:"backend"`
+}
+
+// diagnosticSeverities maps min_severity values to LSP DiagnosticSeverity.
+var diagnosticSeverities = map[string]int{
+	"error":       1,
+	"warning":     2,
+	"information": 3,
+	"hint":        4,
+}
+
+func configDir() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "lux")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".", ".config", "lux")
+	}
+	return filepath.Join(home, ".config", "lux")
+}
+
+func dataDir() string {
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" {
+		return filepath.Join(xdg, "lux")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".", ".local", "share", "lux")
+	}
+	return filepath.Join(home, ".local", "share", "lux")
+}
+
+func stateDir() string {
+	if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "lux")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".", ".local", "state", "lux")
+	}
+	return filepath.Join(home, ".local", "state", "lux")
+}
+
+func runtimeDir() string {
+	if xdg := os.Getenv("XDG_RUNTIME_DIR"); xdg != "" {
+		return xdg
+	}
+	return os.TempDir()
+}
+
+func ConfigPath() string {
+	return filepath.Join(configDir(), "lsps.toml")
+}
+
+func DataDir() string {
+	return dataDir()
+}
+
+// StateDir is where lux keeps state worth keeping across runs but not
+// backing up, such as the nix build cache.
+func StateDir() string {
+	return stateDir()
+}
+
+func CapabilitiesDir() string {
+	return filepath.Join(dataDir(), "capabilities")
+}
+
+// SocketPath returns the control socket path for the workspace containing
+// the current directory. See SocketPathFor.
+func (c *Config) SocketPath() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "."
+	}
+	return c.SocketPathFor(ResolveWorkspace(cwd))
+}
+
+func Load() (*Config, error) {
+	return LoadFrom(ConfigPath())
+}
+
+func LoadFrom(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	var cfg Config
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validating config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+func (c *Config) Validate() error {
+	switch c.HealthSeverity {
+	case "", HealthSeverityError, HealthSeverityWarning, HealthSeverityInfo, HealthSeverityLog, HealthSeverityOff:
+	default:
+		return fmt.Errorf("invalid health_severity %q (expected error, warning, info, log, or off)", c.HealthSeverity)
+	}
+
+	switch c.Executor {
+	case "", ExecutorBinary:
+	case ExecutorNix:
+		if !nixAllowed {
+			return fmt.Errorf("executor %q is not available in this build", c.Executor)
+		}
+	default:
+		if _, ok := executor.Lookup(c.Executor); !ok {
+			return fmt.Errorf("invalid executor %q (expected %s)", c.Executor, executorChoices())
+		}
+	}
+
+	if c.MaxRestarts < -1 {
+		return fmt.Errorf("invalid max_restarts %d (expected -1 to disable, or a positive count)", c.MaxRestarts)
+	}
+	if c.AutoRestarts < -1 {
+		return fmt.Errorf("invalid auto_restarts %d (expected -1 to disable, or a positive count)", c.AutoRestarts)
+	}
+	if c.InteractiveConcurrency < -1 {
+		return fmt.Errorf("invalid interactive_concurrency %d (expected -1 for no limit, or a positive count)", c.InteractiveConcurrency)
+	}
+	if c.BackgroundConcurrency < -1 {
+		return fmt.Errorf("invalid background_concurrency %d (expected -1 for no limit, or a positive count)", c.BackgroundConcurrency)
+	}
+	if c.FocusNice < 0 || c.FocusNice > 19 {
+		return fmt.Errorf("invalid focus_nice %d (expected 0 to 19)", c.FocusNice)
+	}
+	if c.MaxToolOutput < -1 {
+		return fmt.Errorf("invalid max_tool_output %d (expected -1 for no limit, or a size in bytes)", c.MaxToolOutput)
+	}
+	if c.RestartWindow != "" {
+		if d, err := time.ParseDuration(c.RestartWindow); err != nil || d <= 0 {
+			return fmt.Errorf("invalid restart_window %q (expected a duration such as \"5m\")", c.RestartWindow)
+		}
+	}
+
+	if c.RestartBackoff != "" {
+		if d, err := time.ParseDuration(c.RestartBackoff); err != nil || d <= 0 {
+			return fmt.Errorf("invalid restart_backoff %q (expected a duration such as \"1s\")", c.RestartBackoff)
+		}
+	}
+
+	if c.IdleTimeout != "" {
+		if d, err := time.ParseDuration(c.IdleTimeout); err != nil || d < 0 {
+			return fmt.Errorf("invalid idle_timeout %q (expected a duration such as \"30m\", or \"0\" to disable)", c.IdleTimeout)
+		}
+	}
+
+	if c.HealthCheckInterval != "" {
+		if d, err := time.ParseDuration(c.HealthCheckInterval); err != nil || d < 0 {
+			return fmt.Errorf("invalid health_check_interval %q (expected a duration such as \"1m\", or \"0\" to disable)", c.HealthCheckInterval)
+		}
+	}
+	if c.HealthCheckTimeout != "" {
+		if d, err := time.ParseDuration(c.HealthCheckTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid health_check_timeout %q (expected a duration such as \"10s\")", c.HealthCheckTimeout)
+		}
+	}
+
+	if c.StartupStagger != "" {
+		if d, err := time.ParseDuration(c.StartupStagger); err != nil || d < 0 {
+			return fmt.Errorf("invalid startup_stagger %q (expected a duration such as \"500ms\", or \"0\" to disable)", c.StartupStagger)
+		}
+	}
+
+	switch c.FanoutScope {
+	case "", FanoutScopeRunning, FanoutScopeAll:
+	default:
+		return fmt.Errorf("invalid fanout_scope %q (expected running or all)", c.FanoutScope)
+	}
+	switch c.CompletionMode {
+	case "", CompletionModePrimary, CompletionModeMerge:
+	default:
+		return fmt.Errorf("invalid completion_mode %q (expected primary or merge)", c.CompletionMode)
+	}
+	switch c.HoverMode {
+	case "", HoverModeFirst, HoverModeMerge:
+	default:
+		return fmt.Errorf("invalid hover_mode %q (expected first or merge)", c.HoverMode)
+	}
+
+	switch c.RenameMode {
+	case "", RenameModePrimary, RenameModeMerge, RenameModeStrict:
+	default:
+		return fmt.Errorf("invalid rename_mode %q (expected primary, merge, or strict)", c.RenameMode)
+	}
+	switch c.SemanticTokensMode {
+	case "", SemanticTokensModePrimary, SemanticTokensModeMerge:
+	default:
+		return fmt.Errorf("invalid semantic_tokens_mode %q (expected primary or merge)", c.SemanticTokensMode)
+	}
+	switch c.FormatMode {
+	case "", FormatModePrimary, FormatModeChain:
+	default:
+		return fmt.Errorf("invalid format_mode %q (expected primary or chain)", c.FormatMode)
+	}
+	switch c.FileWatcher {
+	case "", FileWatcherOff, FileWatcherAuto:
+	default:
+		return fmt.Errorf("invalid file_watcher %q (expected off or auto)", c.FileWatcher)
+	}
+	switch c.FallbackMode {
+	case "", FallbackModeOff, FallbackModeEmpty:
+	default:
+		return fmt.Errorf("invalid fallback_mode %q (expected off or empty)", c.FallbackMode)
+	}
+	switch c.TelemetryMode {
+	case "", TelemetryModeForward, TelemetryModeDrop, TelemetryModeLog:
+	default:
+		return fmt.Errorf("invalid telemetry_mode %q (expected forward, drop, or log)", c.TelemetryMode)
+	}
+	if c.SaveTimeout != "" {
+		if d, err := time.ParseDuration(c.SaveTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid save_timeout %q (expected a duration such as \"1s\")", c.SaveTimeout)
+		}
+	}
+	if c.FanoutTimeout != "" {
+		if d, err := time.ParseDuration(c.FanoutTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid fanout_timeout %q (expected a duration such as \"2s\")", c.FanoutTimeout)
+		}
+	}
+	for tool, timeout := range c.ToolTimeouts {
+		if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid tool_timeouts.%s %q (expected a duration such as \"30s\")", tool, timeout)
+		}
+	}
+	for method, timeout := range c.RequestTimeouts {
+		if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid request_timeouts.%q %q (expected a duration such as \"2s\")", method, timeout)
+		}
+	}
+
+	for i, root := range c.ReadOnlyRoots {
+		if root == "" {
+			return fmt.Errorf("read_only_roots[%d]: path is required", i)
+		}
+	}
+
+	for lang, policy := range c.Formatting {
+		if policy.TabSize < 0 {
+			return fmt.Errorf("invalid formatting.%s.tab_size %d (expected a positive number)", lang, policy.TabSize)
+		}
+		if policy.Normalize && policy.InsertSpaces == nil {
+			return fmt.Errorf("formatting.%s: normalize requires insert_spaces", lang)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, lsp := range c.LSPs {
+		if lsp.Name == "" {
+			return fmt.Errorf("lsp[%d]: name is required", i)
+		}
+		if lsp.Command != "" {
+			if lsp.Flake != "" || lsp.Binary != "" {
+				return fmt.Errorf("lsp[%d] (%s): command can't be combined with flake or binary", i, lsp.Name)
+			}
+			if lsp.Remote != "" {
+				return fmt.Errorf("lsp[%d] (%s): command can't be combined with remote", i, lsp.Name)
+			}
+		} else if lsp.Flake == "" && !lsp.Attaches() {
+			if c.ExecutorKind() == ExecutorNix && lsp.Remote == "" {
+				return fmt.Errorf("lsp[%d] (%s): flake is required", i, lsp.Name)
+			}
+			if lsp.Binary == "" {
+				return fmt.Errorf("lsp[%d] (%s): flake or binary is required", i, lsp.Name)
+			}
+		}
+		if names[lsp.Name] {
+			return fmt.Errorf("lsp[%d]: duplicate name %q", i, lsp.Name)
+		}
+		names[lsp.Name] = true
+
+		for method, timeout := range lsp.RequestTimeouts {
+			if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+				return fmt.Errorf("lsp[%d] (%s): invalid request_timeouts.%q %q (expected a duration such as \"2s\")", i, lsp.Name, method, timeout)
+			}
+		}
+
+		if lsp.MaxInFlight < 0 {
+			return fmt.Errorf("lsp[%d] (%s): invalid max_in_flight %d (expected a positive number)", i, lsp.Name, lsp.MaxInFlight)
+		}
+		if lsp.MaxQueued != 0 && lsp.MaxInFlight == 0 {
+			return fmt.Errorf("lsp[%d] (%s): max_queued needs max_in_flight", i, lsp.Name)
+		}
+
+		if lsp.IdleTimeout != "" {
+			if d, err := time.ParseDuration(lsp.IdleTimeout); err != nil || d < 0 {
+				return fmt.Errorf("lsp[%d] (%s): invalid idle_timeout %q (expected a duration such as \"30m\", or \"0\" to disable)", i, lsp.Name, lsp.IdleTimeout)
+			}
+		}
+
+		if lsp.MemoryLimit != "" {
+			if _, err := parseSize(lsp.MemoryLimit); err != nil {
+				return fmt.Errorf("lsp[%d] (%s): invalid memory_limit %q (expected a size such as \"4G\")", i, lsp.Name, lsp.MemoryLimit)
+			}
+		}
+		if lsp.CPULimit < 0 {
+			return fmt.Errorf("lsp[%d] (%s): invalid cpu_limit %g (expected a positive number of CPUs)", i, lsp.Name, lsp.CPULimit)
+		}
+		if (lsp.MemoryLimit != "" || lsp.CPULimit != 0) && lsp.Attaches() {
+			return fmt.Errorf("lsp[%d] (%s): memory_limit and cpu_limit need a server lux starts", i, lsp.Name)
+		}
+
+		switch lsp.Framing {
+		case "", FramingLSP, FramingNDJSON, FramingAuto:
+		default:
+			return fmt.Errorf("lsp[%d] (%s): invalid framing %q (expected lsp, ndjson, or auto)", i, lsp.Name, lsp.Framing)
+		}
+
+		if f := lsp.DiagnosticFilter; f != nil {
+			if _, ok := diagnosticSeverities[f.MinSeverity]; f.MinSeverity != "" && !ok {
+				return fmt.Errorf("lsp[%d] (%s): invalid diagnostic_filter.min_severity %q (expected error, warning, information, or hint)", i, lsp.Name, f.MinSeverity)
+			}
+			for _, pattern := range f.ExcludePaths {
+				if _, err := glob.Compile(pattern); err != nil {
+					return fmt.Errorf("lsp[%d] (%s): invalid diagnostic_filter.exclude_paths pattern %q: %w", i, lsp.Name, pattern, err)
+				}
+			}
+		}
+
+		if f := lsp.Folders; f != nil {
+			for _, pattern := range f.Globs {
+				if _, err := glob.Compile(pattern); err != nil {
+					return fmt.Errorf("lsp[%d] (%s): invalid folders.globs pattern %q: %w", i, lsp.Name, pattern, err)
+				}
+			}
+		}
+
+		if lsp.Remote != "" {
+			if u, err := url.Parse(lsp.Remote); err != nil || u.Scheme != "ssh" || u.Hostname() == "" {
+				return fmt.Errorf("lsp[%d] (%s): invalid remote %q (expected ssh://[user@]host[:port])", i, lsp.Name, lsp.Remote)
+			}
+		}
+
+		if lsp.Attach != "" {
+			if host, port, err := net.SplitHostPort(lsp.Attach); err != nil || host == "" || port == "" {
+				return fmt.Errorf("lsp[%d] (%s): invalid attach address %q (expected host:port)", i, lsp.Name, lsp.Attach)
+			}
+			if lsp.Remote != "" {
+				return fmt.Errorf("lsp[%d] (%s): attach and remote are mutually exclusive", i, lsp.Name)
+			}
+			if lsp.Transport != "" || lsp.Address != "" {
+				return fmt.Errorf("lsp[%d] (%s): attach and transport are mutually exclusive", i, lsp.Name)
+			}
+		}
+
+		switch lsp.Transport {
+		case "", TransportStdio, TransportNodeIPC:
+			if lsp.Address != "" {
+				return fmt.Errorf("lsp[%d] (%s): address is only used by the tcp and unix transports", i, lsp.Name)
+			}
+			if lsp.Transport == TransportNodeIPC && lsp.Remote != "" {
+				return fmt.Errorf("lsp[%d] (%s): the node-ipc transport can't be used with remote", i, lsp.Name)
+			}
+		case TransportTCP:
+			if host, port, err := net.SplitHostPort(lsp.Address); err != nil || host == "" || port == "" {
+				return fmt.Errorf("lsp[%d] (%s): invalid tcp address %q (expected host:port)", i, lsp.Name, lsp.Address)
+			}
+		case TransportUnix:
+			if lsp.Address == "" {
+				return fmt.Errorf("lsp[%d] (%s): the unix transport needs an address (the socket path)", i, lsp.Name)
+			}
+			if lsp.Remote != "" {
+				return fmt.Errorf("lsp[%d] (%s): the unix transport can't be used with remote", i, lsp.Name)
+			}
+		default:
+			return fmt.Errorf("lsp[%d] (%s): invalid transport %q (expected stdio, tcp, unix, or node-ipc)", i, lsp.Name, lsp.Transport)
+		}
+
+		for _, m := range lsp.PathMappings {
+			if !filepath.IsAbs(m.Host) || !filepath.IsAbs(m.Backend) {
+				return fmt.Errorf("lsp[%d] (%s): invalid path_mappings entry %q -> %q (expected absolute host and backend paths)", i, lsp.Name, m.Host, m.Backend)
+			}
+		}
+
+		if len(lsp.Extensions) == 0 && len(lsp.Patterns) == 0 && len(lsp.LanguageIDs) == 0 {
+			return fmt.Errorf("lsp[%d] (%s): at least one of extensions, patterns, or language_ids is required", i, lsp.Name)
+		}
+
+		// Validate environment variable names
+		for k := range lsp.Env {
+			if !isValidEnvVarName(k) {
+				return fmt.Errorf("lsp[%d] (%s): invalid environment variable name %q", i, lsp.Name, k)
+			}
+		}
+
+		// Validate init_options can be marshaled to JSON
+		if len(lsp.InitOptions) > 0 {
+			if _, err := json.Marshal(lsp.InitOptions); err != nil {
+				return fmt.Errorf("lsp[%d] (%s): invalid init_options: %w", i, lsp.Name, err)
+			}
+		}
+
+		// Validate settings can be marshaled to JSON
+		if len(lsp.Settings) > 0 {
+			if _, err := json.Marshal(lsp.Settings); err != nil {
+				return fmt.Errorf("lsp[%d] (%s): invalid settings: %w", i, lsp.Name, err)
+			}
+		}
+
+		// Validate capability names (warn only, don't error)
+		if lsp.Capabilities != nil {
+			for _, name := range append(lsp.Capabilities.Disable, lsp.Capabilities.Enable...) {
+				if !isKnownCapability(name) {
+					fmt.Fprintf(os.Stderr, "warning: unknown capability %q in lsp %s\n", name, lsp.Name)
+				}
+			}
+		}
+	}
+
+	adapterIDs := make(map[string]string)
+	for i, dap := range c.DAPs {
+		if dap.Name == "" {
+			return fmt.Errorf("dap[%d]: name is required", i)
+		}
+		if dap.Flake == "" && dap.Binary == "" {
+			return fmt.Errorf("dap[%d] (%s): flake or binary is required", i, dap.Name)
+		}
+		for _, id := range append([]string{dap.Name}, dap.AdapterIDs...) {
+			if other, ok := adapterIDs[id]; ok {
+				return fmt.Errorf("dap[%d] (%s): adapter ID %q is already served by %s", i, dap.Name, id, other)
+			}
+			adapterIDs[id] = dap.Name
+		}
+		for k := range dap.Env {
+			if !isValidEnvVarName(k) {
+				return fmt.Errorf("dap[%d] (%s): invalid environment variable name %q", i, dap.Name, k)
+			}
+		}
+	}
+
+	plugins := make(map[string]bool)
+	for i, p := range c.Plugins {
+		if p.Name == "" {
+			return fmt.Errorf("plugin[%d]: name is required", i)
+		}
+		if plugins[p.Name] {
+			return fmt.Errorf("plugin[%d]: duplicate name %q", i, p.Name)
+		}
+		plugins[p.Name] = true
+		if p.Module == "" {
+			return fmt.Errorf("plugin[%d] (%s): module is required", i, p.Name)
+		}
+		if len(p.Methods) == 0 {
+			return fmt.Errorf("plugin[%d] (%s): methods is required", i, p.Name)
+		}
+	}
+
+	for i, t := range c.Transforms {
+		if t.Method == "" {
+			return fmt.Errorf("transforms[%d]: method is required", i)
+		}
+		switch t.Direction {
+		case "", TransformRequest, TransformResponse:
+		default:
+			return fmt.Errorf("invalid transforms[%d].direction %q (expected request or response)", i, t.Direction)
+		}
+		switch t.Action {
+		case TransformDrop:
+		case TransformSet, TransformDefault:
+			if t.Value == nil {
+				return fmt.Errorf("transforms[%d]: %s requires a value", i, t.Action)
+			}
+		default:
+			return fmt.Errorf("invalid transforms[%d].action %q (expected drop, set, or default)", i, t.Action)
+		}
+		for _, segment := range t.PathSegments() {
+			if segment == "" {
+				return fmt.Errorf("invalid transforms[%d].path %q (expected dot-separated keys)", i, t.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// DebugAdapter returns the adapter serving adapterID: the one named so, or
+// the one listing it in adapter_ids.
+func (c *Config) DebugAdapter(adapterID string) (DAP, bool) {
+	for _, dap := range c.DAPs {
+		if dap.Name == adapterID {
+			return dap, true
+		}
+	}
+	for _, dap := range c.DAPs {
+		for _, id := range dap.AdapterIDs {
+			if id == adapterID {
+				return dap, true
+			}
+		}
+	}
+	return DAP{}, false
+}
+
+// HealthSeverityLevel returns the configured health severity, defaulting to
+// warning.
+func (c *Config) HealthSeverityLevel() string {
+	if c.HealthSeverity == "" {
+		return HealthSeverityWarning
+	}
+	return c.HealthSeverity
+}
+
+// executorChoices lists the valid executor values for error messages.
+func executorChoices() string {
+	choices := append([]string{ExecutorNix, ExecutorBinary}, executor.Names()...)
+	if !nixAllowed {
+		choices = choices[1:]
+	}
+	if len(choices) == 1 {
+		return choices[0]
+	}
+	return strings.Join(choices[:len(choices)-1], ", ") + ", or " + choices[len(choices)-1]
+}
+
+// ExecutorKind returns the configured executor, defaulting to nix (or to
+// binary in builds with the nonix tag).
+func (c *Config) ExecutorKind() string {
+	if c.Executor == "" {
+		return defaultExecutor
+	}
+	return c.Executor
+}
+
+// Restart budget defaults: a server failing DefaultMaxRestarts times within
+// DefaultRestartWindow is disabled until restarted by hand.
+const (
+	DefaultMaxRestarts   = 5
+	DefaultRestartWindow = 5 * time.Minute
+)
+
+// RestartBudget returns how many failures are tolerated within the window
+// before a server is disabled. A count of 0 means the breaker is off
+// (max_restarts = -1).
+func (c *Config) RestartBudget() (int, time.Duration) {
+	max := c.MaxRestarts
+	switch {
+	case max == 0:
+		max = DefaultMaxRestarts
+	case max < 0:
+		max = 0
+	}
+
+	window := DefaultRestartWindow
+	if d, err := time.ParseDuration(c.RestartWindow); err == nil && d > 0 {
+		window = d
+	}
+	return max, window
+}
+
+// Auto-restart defaults: a crashed server is restarted up to
+// DefaultAutoRestarts times in a row, first after DefaultRestartBackoff and
+// then after twice as long each time, up to MaxRestartBackoff.
+const (
+	DefaultAutoRestarts   = 3
+	DefaultRestartBackoff = time.Second
+	MaxRestartBackoff     = 30 * time.Second
+)
+
+// AutoRestartPolicy returns how many times in a row a crashed server is
+// restarted and the backoff before the first restart. A count of 0 means
+// crashed servers wait for the next request (auto_restarts = -1).
+func (c *Config) AutoRestartPolicy() (int, time.Duration) {
+	retries := c.AutoRestarts
+	switch {
+	case retries == 0:
+		retries = DefaultAutoRestarts
+	case retries < 0:
+		retries = 0
+	}
+
+	backoff := DefaultRestartBackoff
+	if d, err := time.ParseDuration(c.RestartBackoff); err == nil && d > 0 {
+		backoff = d
+	}
+	return retries, backoff
+}
+
+// DefaultStartupStagger is the delay between background server starts.
+const DefaultStartupStagger = 500 * time.Millisecond
+
+// StartupStaggerDuration returns the delay between background server starts
+// when several would start at once; 0 disables staggering.
+func (c *Config) StartupStaggerDuration() time.Duration {
+	if d, err := time.ParseDuration(c.StartupStagger); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultStartupStagger
+}
+
+// DefaultFanoutTimeout bounds how long each backend may take to answer a
+// fanned-out request.
+const DefaultFanoutTimeout = 2 * time.Second
+
+// FanoutScopeLevel returns the configured fanout scope, defaulting to
+// running backends only.
+func (c *Config) FanoutScopeLevel() string {
+	if c.FanoutScope == "" {
+		return FanoutScopeRunning
+	}
+	return c.FanoutScope
+}
+
+// FanoutTimeoutDuration returns the per-backend timeout for fanned-out
+// requests.
+func (c *Config) FanoutTimeoutDuration() time.Duration {
+	if d, err := time.ParseDuration(c.FanoutTimeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultFanoutTimeout
+}
+
+// DefaultToolTimeout bounds an MCP tool call when tool_timeouts sets no
+// timeout for it.
+const DefaultToolTimeout = 30 * time.Second
+
+// TimeoutKeyDefault is the tool_timeouts and request_timeouts entry applying
+// to everything without an entry of its own.
+const TimeoutKeyDefault = "default"
+
+// ToolTimeout returns the timeout tool_timeouts sets for tool itself, if any.
+func (c *Config) ToolTimeout(tool string) (time.Duration, bool) {
+	d, err := time.ParseDuration(c.ToolTimeouts[tool])
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// DefaultToolTimeoutDuration returns the timeout for tools without one of
+// their own: the "default" entry of tool_timeouts, else DefaultToolTimeout.
+func (c *Config) DefaultToolTimeoutDuration() time.Duration {
+	if d, ok := c.ToolTimeout(TimeoutKeyDefault); ok {
+		return d
+	}
+	return DefaultToolTimeout
+}
+
+// DefaultMaxToolOutput caps MCP tool results when max_tool_output is unset,
+// well under the message limits of common MCP clients.
+const DefaultMaxToolOutput = 32 * 1024
+
+// ToolOutputBudget returns the byte cap for MCP tool results, or 0 for none.
+func (c *Config) ToolOutputBudget() int {
+	return laneLimit(c.MaxToolOutput, DefaultMaxToolOutput)
+}
+
+// DefaultRequestTimeout bounds a request forwarded to a backend when
+// request_timeouts sets nothing for it, so a stuck server can't hang the
+// editor. workspace/executeCommand is exempt, since commands such as running
+// tests can take arbitrarily long.
+const DefaultRequestTimeout = time.Minute
+
+// RequestTimeout returns how long a request for method to the named LSP may
+// take, or 0 for no limit. The LSP's request_timeouts entry for the method
+// wins, then its "default" entry, then the top-level entries likewise.
+func (c *Config) RequestTimeout(lspName, method string) time.Duration {
+	var tables []map[string]string
+	if l := c.FindLSP(lspName); l != nil {
+		tables = append(tables, l.RequestTimeouts)
+	}
+	tables = append(tables, c.RequestTimeouts)
+
+	for _, table := range tables {
+		for _, key := range []string{method, TimeoutKeyDefault} {
+			if d, err := time.ParseDuration(table[key]); err == nil && d > 0 {
+				return d
+			}
+		}
+	}
+
+	if method == "workspace/executeCommand" {
+		return 0
+	}
+	return DefaultRequestTimeout
+}
+
+// IdleTimeoutFor returns how long the named LSP may go unused before it is
+// stopped, or 0 to keep it running. Its own idle_timeout wins over the
+// top-level one; neither set, servers are never stopped for being idle.
+func (c *Config) IdleTimeoutFor(lspName string) time.Duration {
+	timeout := c.IdleTimeout
+	if l := c.FindLSP(lspName); l != nil && l.IdleTimeout != "" {
+		timeout = l.IdleTimeout
+	}
+	if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
+
+// DefaultHealthCheckTimeout is how long a backend has to answer a health
+// check before it is restarted.
+const DefaultHealthCheckTimeout = 10 * time.Second
+
+// HealthCheck returns how often running backends are probed for liveness,
+// or 0 if they aren't (the default), and how long each probe may take.
+func (c *Config) HealthCheck() (interval, timeout time.Duration) {
+	if d, err := time.ParseDuration(c.HealthCheckInterval); err == nil && d > 0 {
+		interval = d
+	}
+	timeout = DefaultHealthCheckTimeout
+	if d, err := time.ParseDuration(c.HealthCheckTimeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return interval, timeout
+}
+
+// DefaultSaveTimeout bounds how long servers may take to answer
+// willSaveWaitUntil; the editor is blocked on the save meanwhile.
+const DefaultSaveTimeout = time.Second
+
+// SaveTimeoutDuration returns the per-server timeout for willSaveWaitUntil.
+func (c *Config) SaveTimeoutDuration() time.Duration {
+	if d, err := time.ParseDuration(c.SaveTimeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultSaveTimeout
+}
+
+// Default per-server concurrency budgets for the two request lanes.
+// Background work (diagnostic pulls, full semantic tokens, symbol searches)
+// gets a small budget so it can't crowd out hover and completion.
+const (
+	DefaultInteractiveConcurrency = 8
+	DefaultBackgroundConcurrency  = 2
+)
+
+// LaneLimits returns how many interactive and background requests may be in
+// flight to each server at once. 0 means no limit (a setting of -1).
+func (c *Config) LaneLimits() (interactive, background int) {
+	return laneLimit(c.InteractiveConcurrency, DefaultInteractiveConcurrency),
+		laneLimit(c.BackgroundConcurrency, DefaultBackgroundConcurrency)
+}
+
+func laneLimit(configured, def int) int {
+	switch {
+	case configured == 0:
+		return def
+	case configured < 0:
+		return 0
+	}
+	return configured
+}
+
+// MergesCompletions reports whether completion_mode is "merge".
+func (c *Config) MergesCompletions() bool {
+	return c.CompletionMode == CompletionModeMerge
+}
+
+// MergesHovers reports whether hover_mode is "merge".
+func (c *Config) MergesHovers() bool {
+	return c.HoverMode == HoverModeMerge
+}
+
+// MergesRenames reports whether rename_mode asks every matching LSP.
+func (c *Config) MergesRenames() bool {
+	return c.RenameMode == RenameModeMerge || c.RenameMode == RenameModeStrict
+}
+
+// MergesSemanticTokens reports whether semantic_tokens_mode is "merge".
+func (c *Config) MergesSemanticTokens() bool {
+	return c.SemanticTokensMode == SemanticTokensModeMerge
+}
+
+// ChainsFormatting reports whether format_mode is "chain".
+func (c *Config) ChainsFormatting() bool {
+	return c.FormatMode == FormatModeChain
+}
+
+// WatchesFiles reports whether file_watcher is "auto".
+func (c *Config) WatchesFiles() bool {
+	return c.FileWatcher == FileWatcherAuto
+}
+
+// FallsBackOnEmpty reports whether fallback_mode is "empty".
+func (c *Config) FallsBackOnEmpty() bool {
+	return c.FallbackMode == FallbackModeEmpty
+}
+
+// TelemetryPolicy returns telemetry_mode, defaulting to "forward".
+func (c *Config) TelemetryPolicy() string {
+	if c.TelemetryMode == "" {
+		return TelemetryModeForward
+	}
+	return c.TelemetryMode
+}
+
+// FormattingPolicyFor returns the formatting policy for a document with
+// languageID, or, failing that, extension ext (without the dot).
+func (c *Config) FormattingPolicyFor(languageID, ext string) (FormattingPolicy, bool) {
+	if policy, ok := c.Formatting[languageID]; ok && languageID != "" {
+		return policy, true
+	}
+	if policy, ok := c.Formatting[ext]; ok && ext != "" {
+		return policy, true
+	}
+	return FormattingPolicy{}, false
+}
+
+// NixStore is always read-only.
+const NixStore = "/nix/store"
+
+// IsReadOnly reports whether path is in the Nix store or under one of
+// read_only_roots, relative ones taken relative to projectRoot.
+func (c *Config) IsReadOnly(path, projectRoot string) bool {
+	for _, root := range append([]string{NixStore}, c.ReadOnlyRoots...) {
+		if !filepath.IsAbs(root) {
+			if projectRoot == "" {
+				continue
+			}
+			root = filepath.Join(projectRoot, root)
+		}
+		root = filepath.Clean(root)
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *LSP) SettingsWireKey() string {
+	if l.SettingsKey != "" {
+		return l.SettingsKey
+	}
+	return l.Name
+}
+
+// RewriteDiagnosticSource applies the diagnostic_source settings to a
+// diagnostic's source.
+func (l *LSP) RewriteDiagnosticSource(source string) string {
+	if l.DiagnosticSource == nil {
+		return source
+	}
+
+	if renamed, ok := l.DiagnosticSource.Rename[source]; ok {
+		source = renamed
+	}
+
+	if l.DiagnosticSource.Prefix {
+		switch source {
+		case "":
+			source = l.Name
+		case l.Name:
+		default:
+			source = l.Name + ": " + source
+		}
+	}
+
+	return source
+}
+
+// DiagnosticDropper returns the diagnostic_filter test for the diagnostics
+// on the file at path, suited to lsp.FilterDiagnostics, or nil if the server
+// has no filter.
+func (l *LSP) DiagnosticDropper(path string) func(severity int, code, source string) bool {
+	f := l.DiagnosticFilter
+	if f == nil {
+		return nil
+	}
+
+	for _, pattern := range f.ExcludePaths {
+		g, err := glob.Compile(pattern)
+		if err == nil && (g.Match(filepath.Base(path)) || g.Match(path)) {
+			return func(int, string, string) bool { return true }
+		}
+	}
+
+	minSeverity := diagnosticSeverities[f.MinSeverity]
+	codes := make(map[string]bool, len(f.ExcludeCodes))
+	for _, code := range f.ExcludeCodes {
+		codes[code] = true
+	}
+	sources := make(map[string]bool, len(f.ExcludeSources))
+	for _, source := range f.ExcludeSources {
+		sources[source] = true
+	}
+
+	return func(severity int, code, source string) bool {
+		if minSeverity > 0 && severity > minSeverity {
+			return true
+		}
+		return codes[code] || sources[source]
+	}
+}
+
+// ResourceLimits returns the LSP's memory limit in bytes and CPU limit in
+// CPUs, 0 for none, or an error for a memory limit that isn't a size.
+func (l *LSP) ResourceLimits() (memory int64, cpus float64, err error) {
+	if memory, err = parseSize(l.MemoryLimit); err != nil {
+		return 0, 0, fmt.Errorf("memory_limit: %w", err)
+	}
+	return memory, l.CPULimit, nil
+}
+
+// parseSize parses a size in bytes with an optional K, M, G, or T suffix
+// (powers of 1024, an optional trailing "B" or "iB" allowed), such as "512M"
+// or "1.5G". The empty string is 0.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	number := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	scale := 1.0
+	if n := len(number); n > 0 {
+		if i := strings.IndexByte("KMGT", number[n-1]); i >= 0 {
+			scale = math.Pow(1024, float64(i+1))
+			number = number[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || value <= 0 || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(value * scale), nil
+}
+
+// DefaultMaxQueued is how many requests may wait for a server at its
+// max_in_flight when max_queued is unset.
+const DefaultMaxQueued = 32
+
+// InFlightLimit returns how many requests may be in flight to the LSP's
+// server at once and how many more may wait for a slot, or 0, 0 for no
+// limit.
+func (l *LSP) InFlightLimit() (maxInFlight, maxQueued int) {
+	if l.MaxInFlight <= 0 {
+		return 0, 0
+	}
+	return l.MaxInFlight, laneLimit(l.MaxQueued, DefaultMaxQueued)
+}
+
+// BackendTransport returns the transport the LSP's server is reached over
+// and, for tcp and unix, its address, with attach expanded.
+func (l *LSP) BackendTransport() (transport, address string) {
+	if l.Attach != "" {
+		return TransportTCP, l.Attach
+	}
+	if l.Transport == "" {
+		return TransportStdio, ""
+	}
+	return l.Transport, l.Address
+}
+
+// Attaches reports whether lux connects to the LSP's server without
+// starting it: a tcp or unix server with no flake, binary, or command.
+func (l *LSP) Attaches() bool {
+	transport, _ := l.BackendTransport()
+	return (transport == TransportTCP || transport == TransportUnix) && l.Flake == "" && l.Binary == "" && l.Command == ""
+}
+
+// SeesFolder reports whether the workspace folder at path passes the LSP's
+// folders filter. A folder that no longer exists can't be checked for
+// markers and passes, so servers still hear that it was removed.
+func (l *LSP) SeesFolder(path string) bool {
+	f := l.Folders
+	if f == nil || (len(f.Globs) == 0 && len(f.Markers) == 0) {
+		return true
+	}
+
+	for _, pattern := range f.Globs {
+		g, err := glob.Compile(pattern)
+		if err == nil && (g.Match(filepath.Base(path)) || g.Match(path)) {
+			return true
+		}
+	}
+	if len(f.Markers) == 0 {
+		return false
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return true
+	}
+	for _, marker := range f.Markers {
+		if _, err := os.Stat(filepath.Join(path, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) FindLSP(name string) *LSP {
+	for i := range c.LSPs {
+		if c.LSPs[i].Name == name {
+			return &c.LSPs[i]
+		}
+	}
+	return nil
+}
+
+func Save(cfg *Config) error {
+	return SaveTo(ConfigPath(), cfg)
+}
+
+func SaveTo(path string, cfg *Config) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating config file: %w", err)
+	}
+	defer f.Close()
+
+	encoder := toml.NewEncoder(f)
+	if err := encoder.Encode(cfg); err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+
+	return nil
+}
+
+func AddLSP(lsp LSP) error {
+	return AddLSPTo(ConfigPath(), lsp)
+}
+
+func AddLSPTo(path string, lsp LSP) error {
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i, existing := range cfg.LSPs {
+		if existing.Name == lsp.Name {
+			cfg.LSPs[i] = lsp
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		cfg.LSPs = append(cfg.LSPs, lsp)
+	}
+
+	// A config that doesn't validate couldn't be loaded again.
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return SaveTo(path, cfg)
+}
+
+func isValidEnvVarName(name string) bool {
+	matched, _ := regexp.MatchString(`^[a-zA-Z_][a-zA-Z0-9_]*$`, name)
+	return matched
+}
+
+var knownCapabilities = map[string]bool{
+	"hover":                       true,
+	"hoverProvider":               true,
+	"completion":                  true,
+	"completionProvider":          true,
+	"definition":                  true,
+	"definitionProvider":          true,
+	"typeDefinition":              true,
+	"typeDefinitionProvider":      true,
+	"implementation":              true,
+	"implementationProvider":      true,
+	"references":                  true,
+	"referencesProvider":          true,
+	"documentHighlight":           true,
+	"documentHighlightProvider":   true,
+	"documentSymbol":              true,
+	"documentSymbolProvider":      true,
+	"codeAction":                  true,
+	"codeActionProvider":          true,
+	"codeLens":                    true,
+	"codeLensProvider":            true,
+	"documentFormatting":          true,
+	"documentFormattingProvider":  true,
+	"documentRangeFormatting":     true,
+	"documentRangeFormattingProvider": true,
+	"rename":                      true,
+	"renameProvider":              true,
+	"foldingRange":                true,
+	"foldingRangeProvider":        true,
+	"selectionRange":              true,
+	"selectionRangeProvider":      true,
+	"semanticTokens":              true,
+	"semanticTokensProvider":      true,
+	"inlayHint":                   true,
+	"inlayHintProvider":           true,
+	"diagnostic":                  true,
+	"diagnosticProvider":          true,
+	"workspaceSymbol":             true,
+	"workspaceSymbolProvider":     true,
+	"moniker":                     true,
+	"monikerProvider":             true,
+	"linkedEditingRange":          true,
+	"linkedEditingRangeProvider":  true,
+}
+
+func isKnownCapability(name string) bool {
+	return knownCapabilities[name]
+}
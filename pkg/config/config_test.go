@@ -0,0 +1,1259 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/amarbel-llc/lux/pkg/executor"
+)
+
+func TestLSP_BinaryField_TOML(t *testing.T) {
+	tests := []struct {
+		name     string
+		toml     string
+		expected LSP
+	}{
+		{
+			name: "with binary field",
+			toml: `
+name = "test"
+flake = "nixpkgs#gopls"
+binary = "gopls"
+extensions = ["go"]
+`,
+			expected: LSP{
+				Name:       "test",
+				Flake:      "nixpkgs#gopls",
+				Binary:     "gopls",
+				Extensions: []string{"go"},
+			},
+		},
+		{
+			name: "without binary field",
+			toml: `
+name = "test"
+flake = "nixpkgs#gopls"
+extensions = ["go"]
+`,
+			expected: LSP{
+				Name:       "test",
+				Flake:      "nixpkgs#gopls",
+				Binary:     "",
+				Extensions: []string{"go"},
+			},
+		},
+		{
+			name: "with binary as relative path",
+			toml: `
+name = "test"
+flake = "github:owner/repo"
+binary = "bin/custom-lsp"
+extensions = ["custom"]
+`,
+			expected: LSP{
+				Name:       "test",
+				Flake:      "github:owner/repo",
+				Binary:     "bin/custom-lsp",
+				Extensions: []string{"custom"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lsp LSP
+			if err := toml.Unmarshal([]byte(tt.toml), &lsp); err != nil {
+				t.Fatalf("failed to parse TOML: %v", err)
+			}
+
+			if lsp.Name != tt.expected.Name {
+				t.Errorf("Name: expected %q, got %q", tt.expected.Name, lsp.Name)
+			}
+			if lsp.Flake != tt.expected.Flake {
+				t.Errorf("Flake: expected %q, got %q", tt.expected.Flake, lsp.Flake)
+			}
+			if lsp.Binary != tt.expected.Binary {
+				t.Errorf("Binary: expected %q, got %q", tt.expected.Binary, lsp.Binary)
+			}
+			if len(lsp.Extensions) != len(tt.expected.Extensions) {
+				t.Errorf("Extensions length: expected %d, got %d", len(tt.expected.Extensions), len(lsp.Extensions))
+			}
+		})
+	}
+}
+
+func TestConfig_BinaryField_SaveAndLoad(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "lsps.toml")
+
+	os.Setenv("XDG_CONFIG_HOME", tmpDir)
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+
+	originalConfig := &Config{
+		Socket: "/tmp/test.sock",
+		LSPs: []LSP{
+			{
+				Name:       "gopls",
+				Flake:      "nixpkgs#gopls",
+				Binary:     "gopls",
+				Extensions: []string{"go"},
+			},
+			{
+				Name:       "custom",
+				Flake:      "github:owner/repo",
+				Binary:     "bin/custom-lsp",
+				Extensions: []string{"custom"},
+			},
+			{
+				Name:       "default",
+				Flake:      "nixpkgs#rust-analyzer",
+				Extensions: []string{"rs"},
+			},
+		},
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		t.Fatalf("failed to create config dir: %v", err)
+	}
+
+	if err := Save(originalConfig); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+
+	loadedConfig, err := Load()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if len(loadedConfig.LSPs) != len(originalConfig.LSPs) {
+		t.Fatalf("expected %d LSPs, got %d", len(originalConfig.LSPs), len(loadedConfig.LSPs))
+	}
+
+	for i, expectedLSP := range originalConfig.LSPs {
+		gotLSP := loadedConfig.LSPs[i]
+
+		if gotLSP.Name != expectedLSP.Name {
+			t.Errorf("LSP[%d] Name: expected %q, got %q", i, expectedLSP.Name, gotLSP.Name)
+		}
+		if gotLSP.Flake != expectedLSP.Flake {
+			t.Errorf("LSP[%d] Flake: expected %q, got %q", i, expectedLSP.Flake, gotLSP.Flake)
+		}
+		if gotLSP.Binary != expectedLSP.Binary {
+			t.Errorf("LSP[%d] Binary: expected %q, got %q", i, expectedLSP.Binary, gotLSP.Binary)
+		}
+	}
+}
+
+func TestConfig_BinaryOmitempty(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "lux", "lsps.toml")
+
+	os.Setenv("XDG_CONFIG_HOME", tmpDir)
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+
+	config := &Config{
+		LSPs: []LSP{
+			{
+				Name:       "test",
+				Flake:      "nixpkgs#gopls",
+				Extensions: []string{"go"},
+			},
+		},
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		t.Fatalf("failed to create config dir: %v", err)
+	}
+
+	if err := Save(config); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to read config file: %v", err)
+	}
+
+	content := string(data)
+	if contains(content, "binary") {
+		t.Error("expected binary field to be omitted when empty, but it was present in TOML")
+	}
+}
+
+func contains(s, substr string) bool {
+	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || contains(s[1:], substr)))
+}
+
+func TestAddLSP_WithBinary(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.Setenv("XDG_CONFIG_HOME", tmpDir)
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, "lux"), 0755); err != nil {
+		t.Fatalf("failed to create config dir: %v", err)
+	}
+
+	lsp := LSP{
+		Name:       "test-lsp",
+		Flake:      "nixpkgs#test",
+		Binary:     "custom-binary",
+		Extensions: []string{"test"},
+	}
+
+	if err := AddLSP(lsp); err != nil {
+		t.Fatalf("failed to add LSP: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if len(cfg.LSPs) != 1 {
+		t.Fatalf("expected 1 LSP, got %d", len(cfg.LSPs))
+	}
+
+	if cfg.LSPs[0].Binary != "custom-binary" {
+		t.Errorf("expected binary %q, got %q", "custom-binary", cfg.LSPs[0].Binary)
+	}
+}
+
+func TestLSP_SettingsField_TOML(t *testing.T) {
+	input := `
+name = "gopls"
+flake = "nixpkgs#gopls"
+extensions = ["go"]
+language_ids = ["go"]
+
+[settings]
+  gofumpt = true
+  staticcheck = true
+
+  [settings.analyses]
+    unusedparams = true
+    shadow = true
+    ST1000 = false
+`
+	var lsp LSP
+	if err := toml.Unmarshal([]byte(input), &lsp); err != nil {
+		t.Fatalf("failed to parse TOML: %v", err)
+	}
+
+	if lsp.Settings == nil {
+		t.Fatal("expected Settings to be non-nil")
+	}
+
+	if gofumpt, ok := lsp.Settings["gofumpt"].(bool); !ok || !gofumpt {
+		t.Errorf("expected gofumpt=true, got %v", lsp.Settings["gofumpt"])
+	}
+
+	analyses, ok := lsp.Settings["analyses"].(map[string]any)
+	if !ok {
+		t.Fatal("expected analyses to be a map")
+	}
+
+	if shadow, ok := analyses["shadow"].(bool); !ok || !shadow {
+		t.Errorf("expected analyses.shadow=true, got %v", analyses["shadow"])
+	}
+
+	if st1000, ok := analyses["ST1000"].(bool); !ok || st1000 {
+		t.Errorf("expected analyses.ST1000=false, got %v", analyses["ST1000"])
+	}
+}
+
+func TestLSP_SettingsValidation(t *testing.T) {
+	cfg := &Config{
+		LSPs: []LSP{
+			{
+				Name:       "test",
+				Flake:      "nixpkgs#test",
+				Extensions: []string{"go"},
+				Settings: map[string]any{
+					"valid_key": "valid_value",
+					"nested": map[string]any{
+						"deep": true,
+					},
+				},
+			},
+		},
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected valid settings to pass validation, got: %v", err)
+	}
+}
+
+func TestLSP_SettingsWireKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		lspName     string
+		settingsKey string
+		expected    string
+	}{
+		{"defaults to name", "gopls", "", "gopls"},
+		{"uses explicit key", "gopls", "custom", "custom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lsp := &LSP{Name: tt.lspName, SettingsKey: tt.settingsKey}
+			if got := lsp.SettingsWireKey(); got != tt.expected {
+				t.Errorf("SettingsWireKey() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLSP_SettingsDeepMerge(t *testing.T) {
+	global := LSP{
+		Name:       "gopls",
+		Flake:      "nixpkgs#gopls",
+		Extensions: []string{"go"},
+		Settings: map[string]any{
+			"gofumpt":     true,
+			"staticcheck": true,
+			"analyses": map[string]any{
+				"unusedparams": true,
+				"shadow":       true,
+			},
+		},
+	}
+
+	project := LSP{
+		Name:       "gopls",
+		Flake:      "nixpkgs#gopls",
+		Extensions: []string{"go"},
+		Settings: map[string]any{
+			"staticcheck": false,
+			"analyses": map[string]any{
+				"shadow":  false,
+				"ST1000":  false,
+			},
+		},
+	}
+
+	result := mergeLSP(global, project)
+
+	if result.Settings == nil {
+		t.Fatal("expected merged Settings to be non-nil")
+	}
+
+	// gofumpt should be preserved from global
+	if gofumpt, ok := result.Settings["gofumpt"].(bool); !ok || !gofumpt {
+		t.Errorf("expected gofumpt=true (from global), got %v", result.Settings["gofumpt"])
+	}
+
+	// staticcheck should be overridden by project
+	if sc, ok := result.Settings["staticcheck"].(bool); !ok || sc {
+		t.Errorf("expected staticcheck=false (from project), got %v", result.Settings["staticcheck"])
+	}
+
+	// analyses should be deep merged
+	analyses, ok := result.Settings["analyses"].(map[string]any)
+	if !ok {
+		t.Fatal("expected analyses to be a map")
+	}
+
+	// unusedparams from global should be preserved
+	if up, ok := analyses["unusedparams"].(bool); !ok || !up {
+		t.Errorf("expected analyses.unusedparams=true (from global), got %v", analyses["unusedparams"])
+	}
+
+	// shadow should be overridden by project
+	if shadow, ok := analyses["shadow"].(bool); !ok || shadow {
+		t.Errorf("expected analyses.shadow=false (from project), got %v", analyses["shadow"])
+	}
+
+	// ST1000 should be added from project
+	if st, ok := analyses["ST1000"].(bool); !ok || st {
+		t.Errorf("expected analyses.ST1000=false (from project), got %v", analyses["ST1000"])
+	}
+}
+
+func TestAddLSP_UpdateWithBinary(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.Setenv("XDG_CONFIG_HOME", tmpDir)
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, "lux"), 0755); err != nil {
+		t.Fatalf("failed to create config dir: %v", err)
+	}
+
+	firstLSP := LSP{
+		Name:       "test-lsp",
+		Flake:      "nixpkgs#test",
+		Extensions: []string{"test"},
+	}
+
+	if err := AddLSP(firstLSP); err != nil {
+		t.Fatalf("failed to add first LSP: %v", err)
+	}
+
+	updatedLSP := LSP{
+		Name:       "test-lsp",
+		Flake:      "nixpkgs#test-v2",
+		Binary:     "custom-binary",
+		Extensions: []string{"test"},
+	}
+
+	if err := AddLSP(updatedLSP); err != nil {
+		t.Fatalf("failed to update LSP: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if len(cfg.LSPs) != 1 {
+		t.Fatalf("expected 1 LSP, got %d", len(cfg.LSPs))
+	}
+
+	if cfg.LSPs[0].Binary != "custom-binary" {
+		t.Errorf("expected binary %q, got %q", "custom-binary", cfg.LSPs[0].Binary)
+	}
+	if cfg.LSPs[0].Flake != "nixpkgs#test-v2" {
+		t.Errorf("expected flake %q, got %q", "nixpkgs#test-v2", cfg.LSPs[0].Flake)
+	}
+}
+
+func TestConfig_HealthSeverityValidation(t *testing.T) {
+	tests := []struct {
+		severity string
+		wantErr  bool
+	}{
+		{"", false},
+		{"error", false},
+		{"warning", false},
+		{"info", false},
+		{"log", false},
+		{"off", false},
+		{"loud", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.severity, func(t *testing.T) {
+			cfg := &Config{HealthSeverity: tt.severity}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if got := (&Config{}).HealthSeverityLevel(); got != HealthSeverityWarning {
+		t.Errorf("expected default severity %q, got %q", HealthSeverityWarning, got)
+	}
+}
+
+func TestConfig_TelemetryModeValidation(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr bool
+	}{
+		{"", false},
+		{"forward", false},
+		{"drop", false},
+		{"log", false},
+		{"ignore", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cfg := &Config{TelemetryMode: tt.mode}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if got := (&Config{}).TelemetryPolicy(); got != TelemetryModeForward {
+		t.Errorf("expected default mode %q, got %q", TelemetryModeForward, got)
+	}
+}
+
+// Register panics when called twice, so the test executor is registered
+// once per binary instead of once per run of the test.
+func init() {
+	executor.Register("config-test", func() executor.Executor { return nil })
+}
+
+func TestConfig_ExecutorValidation(t *testing.T) {
+	binaryOnly := LSP{Name: "gopls", Binary: "gopls", Extensions: []string{"go"}}
+	commandOnly := LSP{Name: "gopls", Command: "$HOME/go/bin/gopls", Extensions: []string{"go"}}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"default", Config{}, false},
+		{"nix", Config{Executor: "nix"}, !nixAllowed},
+		{"binary", Config{Executor: "binary"}, false},
+		{"unknown", Config{Executor: "docker"}, true},
+		{"binary without flake", Config{Executor: "binary", LSPs: []LSP{binaryOnly}}, false},
+		{"nix without flake", Config{Executor: "nix", LSPs: []LSP{binaryOnly}}, true},
+		{"registered", Config{Executor: "config-test"}, false},
+		{"registered without flake", Config{Executor: "config-test", LSPs: []LSP{binaryOnly}}, false},
+		{"command", Config{LSPs: []LSP{commandOnly}}, false},
+		{"command with flake", Config{LSPs: []LSP{{Name: "gopls", Command: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}}}}, true},
+		{"command with remote", Config{LSPs: []LSP{{Name: "gopls", Command: "gopls", Remote: "ssh://build", Extensions: []string{"go"}}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if got := (&Config{}).ExecutorKind(); got != defaultExecutor {
+		t.Errorf("expected default executor %q, got %q", defaultExecutor, got)
+	}
+}
+
+func TestLSP_RewriteDiagnosticSource(t *testing.T) {
+	l := LSP{
+		Name: "tsserver",
+		DiagnosticSource: &DiagnosticSource{
+			Rename: map[string]string{"ts": "typescript"},
+			Prefix: true,
+		},
+	}
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"ts", "tsserver: typescript"},
+		{"eslint", "tsserver: eslint"},
+		{"", "tsserver"},
+		{"tsserver", "tsserver"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := l.RewriteDiagnosticSource(tt.source); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	plain := LSP{Name: "gopls"}
+	if got := plain.RewriteDiagnosticSource("compiler"); got != "compiler" {
+		t.Errorf("expected source unchanged without config, got %q", got)
+	}
+}
+
+func TestLSP_DiagnosticDropper(t *testing.T) {
+	l := LSP{
+		Name: "golangci",
+		DiagnosticFilter: &DiagnosticFilter{
+			MinSeverity:    "warning",
+			ExcludeCodes:   []string{"ST1000", "1002"},
+			ExcludeSources: []string{"misspell"},
+			ExcludePaths:   []string{"*.pb.go", "/src/vendor/**"},
+		},
+	}
+
+	drop := l.DiagnosticDropper("/src/main.go")
+	tests := []struct {
+		name     string
+		severity int
+		code     string
+		source   string
+		expected bool
+	}{
+		{"error", 1, "", "govet", false},
+		{"warning", 2, "", "govet", false},
+		{"information", 3, "", "govet", true},
+		{"no severity", 0, "", "govet", false},
+		{"excluded code", 1, "ST1000", "stylecheck", true},
+		{"excluded numeric code", 1, "1002", "", true},
+		{"excluded source", 1, "", "misspell", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := drop(tt.severity, tt.code, tt.source); got != tt.expected {
+				t.Errorf("expected drop %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	for _, path := range []string{"/src/api/api.pb.go", "/src/vendor/x/y.go"} {
+		if !l.DiagnosticDropper(path)(1, "", "govet") {
+			t.Errorf("expected every diagnostic on %s to be dropped", path)
+		}
+	}
+
+	if (&LSP{Name: "gopls"}).DiagnosticDropper("/src/main.go") != nil {
+		t.Error("expected no dropper without a filter")
+	}
+
+	invalid := Config{LSPs: []LSP{{
+		Name:             "golangci",
+		Flake:            "nixpkgs#golangci",
+		Extensions:       []string{"go"},
+		DiagnosticFilter: &DiagnosticFilter{MinSeverity: "fatal"},
+	}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected an unknown min_severity to be rejected")
+	}
+}
+
+func TestConfig_RestartBudget(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		wantMax     int
+		wantWindow  time.Duration
+		wantInvalid bool
+	}{
+		{"defaults", Config{}, DefaultMaxRestarts, DefaultRestartWindow, false},
+		{"custom", Config{MaxRestarts: 3, RestartWindow: "10m"}, 3, 10 * time.Minute, false},
+		{"disabled", Config{MaxRestarts: -1}, 0, DefaultRestartWindow, false},
+		{"bad window", Config{RestartWindow: "soon"}, DefaultMaxRestarts, DefaultRestartWindow, true},
+		{"bad count", Config{MaxRestarts: -2}, 0, DefaultRestartWindow, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantInvalid {
+				t.Fatalf("expected invalid: %v, got %v", tt.wantInvalid, err)
+			}
+			if tt.wantInvalid {
+				return
+			}
+			max, window := tt.cfg.RestartBudget()
+			if max != tt.wantMax || window != tt.wantWindow {
+				t.Errorf("expected (%d, %s), got (%d, %s)", tt.wantMax, tt.wantWindow, max, window)
+			}
+		})
+	}
+}
+
+func TestConfig_AutoRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		wantRetries int
+		wantBackoff time.Duration
+		wantInvalid bool
+	}{
+		{"defaults", Config{}, DefaultAutoRestarts, DefaultRestartBackoff, false},
+		{"custom", Config{AutoRestarts: 10, RestartBackoff: "250ms"}, 10, 250 * time.Millisecond, false},
+		{"disabled", Config{AutoRestarts: -1}, 0, DefaultRestartBackoff, false},
+		{"bad backoff", Config{RestartBackoff: "later"}, 0, 0, true},
+		{"bad count", Config{AutoRestarts: -2}, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantInvalid {
+				t.Fatalf("expected invalid: %v, got %v", tt.wantInvalid, err)
+			}
+			if tt.wantInvalid {
+				return
+			}
+			retries, backoff := tt.cfg.AutoRestartPolicy()
+			if retries != tt.wantRetries || backoff != tt.wantBackoff {
+				t.Errorf("expected (%d, %s), got (%d, %s)", tt.wantRetries, tt.wantBackoff, retries, backoff)
+			}
+		})
+	}
+}
+
+func TestConfig_IdleTimeoutFor(t *testing.T) {
+	cfg := Config{
+		IdleTimeout: "30m",
+		LSPs: []LSP{
+			{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}},
+			{Name: "rust-analyzer", Flake: "nixpkgs#rust-analyzer", Extensions: []string{"rs"}, IdleTimeout: "5m"},
+			{Name: "nil", Flake: "nixpkgs#nil", Extensions: []string{"nix"}, IdleTimeout: "0"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]time.Duration{
+		"gopls":         30 * time.Minute,
+		"rust-analyzer": 5 * time.Minute,
+		"nil":           0,
+		"unknown":       30 * time.Minute,
+	}
+	for name, want := range tests {
+		if got := cfg.IdleTimeoutFor(name); got != want {
+			t.Errorf("%s: expected %s, got %s", name, want, got)
+		}
+	}
+
+	if got := (&Config{}).IdleTimeoutFor("gopls"); got != 0 {
+		t.Errorf("expected no idle timeout by default, got %s", got)
+	}
+
+	invalid := Config{LSPs: []LSP{{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}, IdleTimeout: "-1m"}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected a negative idle_timeout to be rejected")
+	}
+}
+
+func TestConfig_HealthCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          Config
+		wantInterval time.Duration
+		wantTimeout  time.Duration
+		wantInvalid  bool
+	}{
+		{"defaults", Config{}, 0, DefaultHealthCheckTimeout, false},
+		{"custom", Config{HealthCheckInterval: "1m", HealthCheckTimeout: "5s"}, time.Minute, 5 * time.Second, false},
+		{"disabled", Config{HealthCheckInterval: "0"}, 0, DefaultHealthCheckTimeout, false},
+		{"bad interval", Config{HealthCheckInterval: "often"}, 0, 0, true},
+		{"bad timeout", Config{HealthCheckTimeout: "0"}, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantInvalid {
+				t.Fatalf("expected invalid: %v, got %v", tt.wantInvalid, err)
+			}
+			if tt.wantInvalid {
+				return
+			}
+			interval, timeout := tt.cfg.HealthCheck()
+			if interval != tt.wantInterval || timeout != tt.wantTimeout {
+				t.Errorf("expected (%s, %s), got (%s, %s)", tt.wantInterval, tt.wantTimeout, interval, timeout)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"":       0,
+		"4096":   4096,
+		"512K":   512 << 10,
+		"512M":   512 << 20,
+		"1.5G":   3 << 29,
+		"2GiB":   2 << 30,
+		"1t":     1 << 40,
+		"64 MB":  64 << 20,
+	}
+	for in, want := range tests {
+		got, err := parseSize(in)
+		if err != nil || got != want {
+			t.Errorf("parseSize(%q): expected %d, got %d (%v)", in, want, got, err)
+		}
+	}
+
+	for _, in := range []string{"lots", "-1G", "0", "G"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q): expected an error", in)
+		}
+	}
+}
+
+func TestLSP_ResourceLimits(t *testing.T) {
+	l := LSP{Name: "rust-analyzer", Flake: "nixpkgs#rust-analyzer", Extensions: []string{"rs"}, MemoryLimit: "4G", CPULimit: 2}
+	if err := (&Config{LSPs: []LSP{l}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if memory, cpus, err := l.ResourceLimits(); memory != 4<<30 || cpus != 2 || err != nil {
+		t.Errorf("expected (4G, 2), got (%d, %g, %v)", memory, cpus, err)
+	}
+
+	invalid := []LSP{
+		{Name: "a", Flake: "nixpkgs#a", Extensions: []string{"a"}, MemoryLimit: "big"},
+		{Name: "b", Flake: "nixpkgs#b", Extensions: []string{"b"}, CPULimit: -1},
+		{Name: "c", Extensions: []string{"c"}, Attach: "localhost:9000", MemoryLimit: "1G"},
+	}
+	for _, l := range invalid {
+		if err := (&Config{LSPs: []LSP{l}}).Validate(); err == nil {
+			t.Errorf("%s: expected the limits to be rejected", l.Name)
+		}
+	}
+}
+
+func TestConfig_LaneLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		interactive int
+		background  int
+	}{
+		{"defaults", Config{}, DefaultInteractiveConcurrency, DefaultBackgroundConcurrency},
+		{"configured", Config{InteractiveConcurrency: 4, BackgroundConcurrency: 1}, 4, 1},
+		{"unlimited", Config{InteractiveConcurrency: -1, BackgroundConcurrency: -1}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interactive, background := tt.cfg.LaneLimits()
+			if interactive != tt.interactive || background != tt.background {
+				t.Errorf("expected %d/%d, got %d/%d", tt.interactive, tt.background, interactive, background)
+			}
+		})
+	}
+
+	if err := (&Config{BackgroundConcurrency: -2}).Validate(); err == nil {
+		t.Error("expected error for background_concurrency below -1")
+	}
+}
+
+func TestConfig_ToolOutputBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected int
+	}{
+		{"default", Config{}, DefaultMaxToolOutput},
+		{"configured", Config{MaxToolOutput: 4096}, 4096},
+		{"unlimited", Config{MaxToolOutput: -1}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.ToolOutputBudget(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+
+	if err := (&Config{MaxToolOutput: -2}).Validate(); err == nil {
+		t.Error("expected error for max_tool_output below -1")
+	}
+}
+
+func TestConfig_IsReadOnly(t *testing.T) {
+	cfg := Config{ReadOnlyRoots: []string{"/opt/vendor", "gen/"}}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/nix/store/abc-go-1.22/src/fmt/print.go", true},
+		{"/opt/vendor/lib.go", true},
+		{"/opt/vendored/lib.go", false},
+		{"/home/user/project/gen/api.pb.go", true},
+		{"/home/user/project/main.go", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := cfg.IsReadOnly(tt.path, "/home/user/project"); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if cfg.IsReadOnly("/home/user/project/gen/api.pb.go", "") {
+		t.Error("expected relative roots to be ignored without a project root")
+	}
+}
+
+func TestConfig_FormattingPolicy(t *testing.T) {
+	var cfg Config
+	_, err := toml.Decode(`
+[formatting.go]
+insert_spaces = false
+normalize = true
+
+[formatting.nix]
+tab_size = 2
+insert_spaces = true
+`, &cfg)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	policy, ok := cfg.FormattingPolicyFor("go", "go")
+	if !ok || policy.InsertSpaces == nil || *policy.InsertSpaces || !policy.Normalize {
+		t.Errorf("expected the go policy, got %+v (%v)", policy, ok)
+	}
+	if policy, ok := cfg.FormattingPolicyFor("", "nix"); !ok || policy.TabSize != 2 {
+		t.Errorf("expected the extension to select the nix policy, got %+v (%v)", policy, ok)
+	}
+	if _, ok := cfg.FormattingPolicyFor("python", "py"); ok {
+		t.Error("expected no policy for python")
+	}
+
+	if err := (&Config{Formatting: map[string]FormattingPolicy{"go": {Normalize: true}}}).Validate(); err == nil {
+		t.Error("expected normalize without insert_spaces to be rejected")
+	}
+}
+
+func TestConfig_ValidatePlugins(t *testing.T) {
+	valid := Plugin{Name: "quiet", Module: "quiet.wasm", Methods: []string{"textDocument/publishDiagnostics"}}
+	if err := (&Config{Plugins: []Plugin{valid}}).Validate(); err != nil {
+		t.Errorf("expected a valid plugin, got %v", err)
+	}
+	if valid.RuntimeName() != "wasm" {
+		t.Errorf("expected the default runtime to be wasm, got %q", valid.RuntimeName())
+	}
+	if path := valid.ModulePath(); path != filepath.Join(filepath.Dir(ConfigPath()), "quiet.wasm") {
+		t.Errorf("expected the module relative to the config, got %q", path)
+	}
+
+	noMethods := valid
+	noMethods.Methods = nil
+	for _, plugins := range [][]Plugin{
+		{noMethods},
+		{{Name: "quiet", Methods: valid.Methods}},
+		{valid, valid},
+	} {
+		if err := (&Config{Plugins: plugins}).Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", plugins)
+		}
+	}
+}
+
+func TestConfig_Transforms(t *testing.T) {
+	var cfg Config
+	_, err := toml.Decode(`
+[[transforms]]
+method = "textDocument/references"
+server = "pyright"
+action = "default"
+value = []
+
+[[transforms]]
+method = "textDocument/publishDiagnostics"
+path = "diagnostics.*"
+match = { source = "cSpell" }
+action = "drop"
+`, &cfg)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if len(cfg.Transforms) != 2 || cfg.Transforms[0].TransformDirection() != TransformResponse {
+		t.Errorf("expected two response transforms, got %+v", cfg.Transforms)
+	}
+	if segments := cfg.Transforms[1].PathSegments(); len(segments) != 2 || segments[1] != "*" {
+		t.Errorf("expected path segments [diagnostics *], got %v", segments)
+	}
+
+	for _, transform := range []Transform{
+		{Action: TransformDrop},
+		{Method: "textDocument/hover", Action: "rename"},
+		{Method: "textDocument/hover", Action: TransformSet},
+		{Method: "textDocument/hover", Direction: "both", Action: TransformDrop},
+		{Method: "textDocument/hover", Path: "contents..value", Action: TransformDrop},
+	} {
+		if err := (&Config{Transforms: []Transform{transform}}).Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", transform)
+		}
+	}
+}
+
+func TestLSP_CheckRequirements(t *testing.T) {
+	root := t.TempDir()
+
+	clangd := LSP{Name: "clangd"}
+	err := clangd.CheckRequirements(root)
+	var missing *MissingRequirementError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected MissingRequirementError from the registry default, got %v", err)
+	}
+	if missing.Hint == "" {
+		t.Error("expected the registry hint")
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "compile_flags.txt"), []byte("-std=c++20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := clangd.CheckRequirements(root); err != nil {
+		t.Errorf("expected requirement met, got %v", err)
+	}
+
+	nested := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(nested, "build"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(nested, "build", "compile_commands.json"), []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := clangd.CheckRequirements(nested); err != nil {
+		t.Errorf("expected a compile_commands.json under build/ to meet the requirement, got %v", err)
+	}
+
+	skipped := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(skipped, "node_modules", "dep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(skipped, "node_modules", "dep", "compile_flags.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := clangd.CheckRequirements(skipped); err == nil {
+		t.Error("expected files under node_modules to be ignored")
+	}
+
+	custom := LSP{Name: "bazel-lsp", Requires: []string{"*.bazel"}}
+	if err := custom.CheckRequirements(root); err == nil {
+		t.Error("expected error for missing *.bazel")
+	}
+
+	none := LSP{Name: "clangd", Requires: []string{}}
+	if err := none.CheckRequirements(t.TempDir()); err != nil {
+		t.Errorf("expected an empty requires list to disable the check, got %v", err)
+	}
+}
+
+func TestConfig_PathMappings(t *testing.T) {
+	data := `
+[[lsp]]
+name = "clangd"
+flake = "nixpkgs#clang-tools"
+extensions = ["c"]
+path_mappings = [{ host = "/home/me/src", backend = "/workspace" }]
+`
+	var cfg Config
+	if _, err := toml.Decode(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	expected := PathMapping{Host: "/home/me/src", Backend: "/workspace"}
+	if len(cfg.LSPs[0].PathMappings) != 1 || cfg.LSPs[0].PathMappings[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, cfg.LSPs[0].PathMappings)
+	}
+
+	cfg.LSPs[0].PathMappings[0].Backend = "workspace"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected a relative backend path to be rejected")
+	}
+}
+
+func TestConfig_RemoteValidation(t *testing.T) {
+	tests := []struct {
+		remote  string
+		wantErr bool
+	}{
+		{"ssh://build", false},
+		{"ssh://me@build.example.com:2222", false},
+		{"build", true},
+		{"tcp://build:22", true},
+		{"ssh://", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			cfg := &Config{LSPs: []LSP{{Name: "rust-analyzer", Binary: "rust-analyzer", Extensions: []string{"rs"}, Remote: tt.remote}}}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfig_TransportValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		lsp     LSP
+		wantErr bool
+	}{
+		{"attach", LSP{Attach: "localhost:5007"}, false},
+		{"attach missing port", LSP{Attach: "localhost"}, true},
+		{"attach missing host", LSP{Attach: ":5007"}, true},
+		{"attach with remote", LSP{Attach: "localhost:5007", Remote: "ssh://build"}, true},
+		{"attach with transport", LSP{Attach: "localhost:5007", Transport: "tcp"}, true},
+		{"tcp attach", LSP{Transport: "tcp", Address: "localhost:5007"}, false},
+		{"tcp started", LSP{Flake: "nixpkgs#kotlin-language-server", Transport: "tcp", Address: "localhost:5007"}, false},
+		{"tcp without address", LSP{Flake: "nixpkgs#kotlin-language-server", Transport: "tcp"}, true},
+		{"unix", LSP{Transport: "unix", Address: "/run/ls.sock"}, false},
+		{"unix with remote", LSP{Binary: "ls", Transport: "unix", Address: "/run/ls.sock", Remote: "ssh://build"}, true},
+		{"node-ipc", LSP{Flake: "nixpkgs#vscode-langservers-extracted", Transport: "node-ipc"}, false},
+		{"node-ipc with address", LSP{Flake: "nixpkgs#vscode-langservers-extracted", Transport: "node-ipc", Address: "localhost:1"}, true},
+		{"stdio without flake", LSP{Transport: "stdio"}, true},
+		{"unknown", LSP{Flake: "nixpkgs#gopls", Transport: "pipe"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.lsp.Name = "debug-ls"
+			tt.lsp.Extensions = []string{"kt"}
+			cfg := &Config{LSPs: []LSP{tt.lsp}}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLSP_SeesFolder(t *testing.T) {
+	root := t.TempDir()
+	module := filepath.Join(root, "api")
+	scripts := filepath.Join(root, "scripts")
+	for _, dir := range []string{module, scripts} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(module, "go.mod"), []byte("module api\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		folders  *FolderFilter
+		path     string
+		expected bool
+	}{
+		{"no filter", nil, scripts, true},
+		{"marker present", &FolderFilter{Markers: []string{"go.mod"}}, module, true},
+		{"marker missing", &FolderFilter{Markers: []string{"go.mod"}}, scripts, false},
+		{"removed folder", &FolderFilter{Markers: []string{"go.mod"}}, filepath.Join(root, "gone"), true},
+		{"glob on name", &FolderFilter{Globs: []string{"script*"}}, scripts, true},
+		{"glob on path", &FolderFilter{Globs: []string{root + "/api"}}, module, true},
+		{"glob miss", &FolderFilter{Globs: []string{"web"}}, scripts, false},
+		{"glob or marker", &FolderFilter{Globs: []string{"scripts"}, Markers: []string{"go.mod"}}, scripts, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := LSP{Name: "gopls", Folders: tt.folders}
+			if got := l.SeesFolder(tt.path); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestConfig_ToolTimeouts(t *testing.T) {
+	cfg := Config{ToolTimeouts: map[string]string{"default": "10s", "lsp_references": "2m"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d, ok := cfg.ToolTimeout("lsp_references"); !ok || d != 2*time.Minute {
+		t.Errorf("expected 2m for lsp_references, got %s (%v)", d, ok)
+	}
+	if _, ok := cfg.ToolTimeout("lsp_hover"); ok {
+		t.Error("expected no timeout of its own for lsp_hover")
+	}
+	if d := cfg.DefaultToolTimeoutDuration(); d != 10*time.Second {
+		t.Errorf("expected 10s default, got %s", d)
+	}
+	if d := (&Config{}).DefaultToolTimeoutDuration(); d != DefaultToolTimeout {
+		t.Errorf("expected %s default, got %s", DefaultToolTimeout, d)
+	}
+
+	if err := (&Config{ToolTimeouts: map[string]string{"lsp_hover": "forever"}}).Validate(); err == nil {
+		t.Error("expected error for an invalid tool timeout")
+	}
+}
+
+func TestConfig_RequestTimeout(t *testing.T) {
+	cfg := Config{
+		RequestTimeouts: map[string]string{"default": "10s", "textDocument/references": "30s"},
+		LSPs: []LSP{
+			{Name: "rust-analyzer", Flake: "x", Extensions: []string{"rs"}, RequestTimeouts: map[string]string{"textDocument/completion": "2s"}},
+			{Name: "slow", Flake: "x", Extensions: []string{"x"}, RequestTimeouts: map[string]string{"default": "5m"}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		lsp      string
+		method   string
+		expected time.Duration
+	}{
+		{"rust-analyzer", "textDocument/completion", 2 * time.Second},
+		{"rust-analyzer", "textDocument/references", 30 * time.Second},
+		{"rust-analyzer", "textDocument/hover", 10 * time.Second},
+		{"slow", "textDocument/references", 5 * time.Minute},
+		{"unknown", "textDocument/hover", 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lsp+" "+tt.method, func(t *testing.T) {
+			if got := cfg.RequestTimeout(tt.lsp, tt.method); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	empty := &Config{}
+	if got := empty.RequestTimeout("gopls", "textDocument/hover"); got != DefaultRequestTimeout {
+		t.Errorf("expected %s, got %s", DefaultRequestTimeout, got)
+	}
+	if got := empty.RequestTimeout("gopls", "workspace/executeCommand"); got != 0 {
+		t.Errorf("expected no limit for executeCommand, got %s", got)
+	}
+
+	bad := Config{LSPs: []LSP{{Name: "gopls", Flake: "x", Extensions: []string{"go"}, RequestTimeouts: map[string]string{"default": "-1s"}}}}
+	if err := bad.Validate(); err == nil {
+		t.Error("expected error for a negative request timeout")
+	}
+}
+
+func TestLSP_InFlightLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		lsp            LSP
+		wantErr        bool
+		expectedMax    int
+		expectedQueued int
+	}{
+		{"unset", LSP{}, false, 0, 0},
+		{"default queue", LSP{MaxInFlight: 4}, false, 4, DefaultMaxQueued},
+		{"queue", LSP{MaxInFlight: 4, MaxQueued: 10}, false, 4, 10},
+		{"no queue", LSP{MaxInFlight: 4, MaxQueued: -1}, false, 4, 0},
+		{"negative", LSP{MaxInFlight: -1}, true, 0, 0},
+		{"queue without limit", LSP{MaxQueued: 10}, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.lsp
+			l.Name = "rust-analyzer"
+			l.Flake = "nixpkgs#rust-analyzer"
+			l.Extensions = []string{"rs"}
+			err := (&Config{LSPs: []LSP{l}}).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			max, queued := l.InFlightLimit()
+			if max != tt.expectedMax || queued != tt.expectedQueued {
+				t.Errorf("expected %d, %d, got %d, %d", tt.expectedMax, tt.expectedQueued, max, queued)
+			}
+		})
+	}
+}
+
+func TestLSP_Framing(t *testing.T) {
+	for _, framing := range []string{"", FramingLSP, FramingNDJSON, FramingAuto} {
+		l := LSP{Name: "a", Flake: "nixpkgs#a", Extensions: []string{"a"}, Framing: framing}
+		if err := (&Config{LSPs: []LSP{l}}).Validate(); err != nil {
+			t.Errorf("framing %q: %v", framing, err)
+		}
+	}
+
+	l := LSP{Name: "a", Flake: "nixpkgs#a", Extensions: []string{"a"}, Framing: "json"}
+	if err := (&Config{LSPs: []LSP{l}}).Validate(); err == nil {
+		t.Error("expected an unknown framing to be rejected")
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import "reflect"
+
+// Diff describes how the LSP entries of two configs differ.
+type Diff struct {
+	// Added are LSPs present only in the new config.
+	Added []string `json:"added,omitempty"`
+	// Removed are LSPs present only in the old config.
+	Removed []string `json:"removed,omitempty"`
+	// Changed are LSPs whose definition changed in a way that requires a
+	// restart (flake, binary, args, env, init options, capabilities,
+	// framing).
+	Changed []string `json:"changed,omitempty"`
+	// SettingsChanged are LSPs where only settings differ, which can be
+	// pushed to a running server without restarting it.
+	SettingsChanged []string `json:"settings_changed,omitempty"`
+	// MatchersChanged is set when file matching (extensions, patterns,
+	// language IDs) changed for any LSP.
+	MatchersChanged bool `json:"matchers_changed,omitempty"`
+}
+
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 &&
+		len(d.SettingsChanged) == 0 && !d.MatchersChanged
+}
+
+// DiffConfigs compares the LSPs in old and new.
+func DiffConfigs(old, new *Config) Diff {
+	var d Diff
+
+	oldByName := make(map[string]LSP, len(old.LSPs))
+	for _, l := range old.LSPs {
+		oldByName[l.Name] = l
+	}
+	newNames := make(map[string]bool, len(new.LSPs))
+
+	for _, n := range new.LSPs {
+		newNames[n.Name] = true
+		o, ok := oldByName[n.Name]
+		if !ok {
+			d.Added = append(d.Added, n.Name)
+			d.MatchersChanged = true
+			continue
+		}
+
+		if !sameMatchers(o, n) {
+			d.MatchersChanged = true
+		}
+
+		switch {
+		case !sameProcess(o, n):
+			d.Changed = append(d.Changed, n.Name)
+		case !reflect.DeepEqual(o.Settings, n.Settings) || o.SettingsWireKey() != n.SettingsWireKey():
+			d.SettingsChanged = append(d.SettingsChanged, n.Name)
+		}
+	}
+
+	for _, o := range old.LSPs {
+		if !newNames[o.Name] {
+			d.Removed = append(d.Removed, o.Name)
+			d.MatchersChanged = true
+		}
+	}
+
+	return d
+}
+
+func sameMatchers(a, b LSP) bool {
+	return reflect.DeepEqual(a.Extensions, b.Extensions) &&
+		reflect.DeepEqual(a.Patterns, b.Patterns) &&
+		reflect.DeepEqual(a.LanguageIDs, b.LanguageIDs)
+}
+
+func sameProcess(a, b LSP) bool {
+	return a.Flake == b.Flake &&
+		a.Binary == b.Binary &&
+		a.Command == b.Command &&
+		reflect.DeepEqual(a.Args, b.Args) &&
+		reflect.DeepEqual(a.Env, b.Env) &&
+		reflect.DeepEqual(a.InitOptions, b.InitOptions) &&
+		a.SettingsInInitOptions == b.SettingsInInitOptions &&
+		reflect.DeepEqual(a.Capabilities, b.Capabilities) &&
+		a.PerFolder == b.PerFolder &&
+		reflect.DeepEqual(a.Folders, b.Folders) &&
+		a.Framing == b.Framing &&
+		reflect.DeepEqual(a.PathMappings, b.PathMappings) &&
+		a.Remote == b.Remote &&
+		a.Attach == b.Attach &&
+		a.Transport == b.Transport &&
+		a.Address == b.Address &&
+		a.MemoryLimit == b.MemoryLimit &&
+		a.CPULimit == b.CPULimit
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	old := &Config{
+		LSPs: []LSP{
+			{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}},
+			{Name: "pyright", Flake: "nixpkgs#pyright", Extensions: []string{"py"}},
+			{Name: "nil", Flake: "nixpkgs#nil", Extensions: []string{"nix"},
+				Settings: map[string]any{"formatting": "nixfmt"}},
+			{Name: "lua", Flake: "nixpkgs#lua-language-server", Extensions: []string{"lua"}},
+		},
+	}
+	new := &Config{
+		LSPs: []LSP{
+			{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}},
+			{Name: "pyright", Flake: "nixpkgs#basedpyright", Extensions: []string{"py"}},
+			{Name: "nil", Flake: "nixpkgs#nil", Extensions: []string{"nix"},
+				Settings: map[string]any{"formatting": "alejandra"}},
+			{Name: "rust-analyzer", Flake: "nixpkgs#rust-analyzer", Extensions: []string{"rs"}},
+		},
+	}
+
+	d := DiffConfigs(old, new)
+
+	if !reflect.DeepEqual(d.Added, []string{"rust-analyzer"}) {
+		t.Errorf("Added: expected [rust-analyzer], got %v", d.Added)
+	}
+	if !reflect.DeepEqual(d.Removed, []string{"lua"}) {
+		t.Errorf("Removed: expected [lua], got %v", d.Removed)
+	}
+	if !reflect.DeepEqual(d.Changed, []string{"pyright"}) {
+		t.Errorf("Changed: expected [pyright], got %v", d.Changed)
+	}
+	if !reflect.DeepEqual(d.SettingsChanged, []string{"nil"}) {
+		t.Errorf("SettingsChanged: expected [nil], got %v", d.SettingsChanged)
+	}
+	if !d.MatchersChanged {
+		t.Error("expected MatchersChanged")
+	}
+
+	if d := DiffConfigs(old, old); !d.Empty() {
+		t.Errorf("expected empty diff for identical configs, got %+v", d)
+	}
+}
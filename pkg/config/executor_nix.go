@@ -0,0 +1,9 @@
+//go:build !nonix
+
+package config
+
+// defaultExecutor is used when the config does not set executor. Builds with
+// the nonix tag default to (and only allow) the binary executor.
+const defaultExecutor = ExecutorNix
+
+const nixAllowed = true
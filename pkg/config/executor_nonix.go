@@ -0,0 +1,7 @@
+//go:build nonix
+
+package config
+
+const defaultExecutor = ExecutorBinary
+
+const nixAllowed = false
@@ -0,0 +1,378 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LoadWithProject loads global config and merges with project-level config
+func LoadWithProject(projectRoot string) (*Config, error) {
+	// Load global config
+	globalCfg, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Try to load project config
+	projectCfg, err := loadProjectConfig(projectRoot)
+	if err != nil {
+		// No project config or error loading - use global only
+		return globalCfg, nil
+	}
+
+	// Merge project over global
+	merged := mergeConfigs(globalCfg, projectCfg)
+	return merged, nil
+}
+
+func loadProjectConfig(projectRoot string) (*Config, error) {
+	configPath := ProjectConfigPath(projectRoot)
+	if configPath == "" {
+		return nil, fmt.Errorf("no project config found")
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading project config: %w", err)
+	}
+
+	var cfg Config
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing project config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validating project config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// mergeConfigs merges project config over global config
+// Strategy: LSPs by name are deeply merged, new LSPs are added
+func mergeConfigs(global, project *Config) *Config {
+	merged := &Config{
+		Socket:                 global.Socket,
+		HealthSeverity:         global.HealthSeverity,
+		Executor:               global.Executor,
+		UsageStats:             global.UsageStats || project.UsageStats,
+		MaxRestarts:            global.MaxRestarts,
+		RestartWindow:          global.RestartWindow,
+		AutoRestarts:           global.AutoRestarts,
+		RestartBackoff:         global.RestartBackoff,
+		StartupStagger:         global.StartupStagger,
+		IdleTimeout:            global.IdleTimeout,
+		HealthCheckInterval:    global.HealthCheckInterval,
+		HealthCheckTimeout:     global.HealthCheckTimeout,
+		FanoutScope:            global.FanoutScope,
+		FanoutTimeout:          global.FanoutTimeout,
+		CompletionMode:         global.CompletionMode,
+		SaveTimeout:            global.SaveTimeout,
+		HoverMode:              global.HoverMode,
+		RenameMode:             global.RenameMode,
+		SemanticTokensMode:     global.SemanticTokensMode,
+		FormatMode:             global.FormatMode,
+		FileWatcher:            global.FileWatcher,
+		FallbackMode:           global.FallbackMode,
+		TelemetryMode:          global.TelemetryMode,
+		InteractiveConcurrency: global.InteractiveConcurrency,
+		BackgroundConcurrency:  global.BackgroundConcurrency,
+		FocusNice:              global.FocusNice,
+		LSPs:                   make([]LSP, 0, len(global.LSPs)+len(project.LSPs)),
+	}
+
+	// Use project socket if specified
+	if project.Socket != "" {
+		merged.Socket = project.Socket
+	}
+
+	if project.HealthSeverity != "" {
+		merged.HealthSeverity = project.HealthSeverity
+	}
+
+	if project.Executor != "" {
+		merged.Executor = project.Executor
+	}
+
+	if project.MaxRestarts != 0 {
+		merged.MaxRestarts = project.MaxRestarts
+	}
+
+	if project.RestartWindow != "" {
+		merged.RestartWindow = project.RestartWindow
+	}
+
+	if project.AutoRestarts != 0 {
+		merged.AutoRestarts = project.AutoRestarts
+	}
+
+	if project.RestartBackoff != "" {
+		merged.RestartBackoff = project.RestartBackoff
+	}
+
+	if project.StartupStagger != "" {
+		merged.StartupStagger = project.StartupStagger
+	}
+
+	if project.IdleTimeout != "" {
+		merged.IdleTimeout = project.IdleTimeout
+	}
+
+	if project.HealthCheckInterval != "" {
+		merged.HealthCheckInterval = project.HealthCheckInterval
+	}
+
+	if project.HealthCheckTimeout != "" {
+		merged.HealthCheckTimeout = project.HealthCheckTimeout
+	}
+
+	if project.FanoutScope != "" {
+		merged.FanoutScope = project.FanoutScope
+	}
+
+	if project.FanoutTimeout != "" {
+		merged.FanoutTimeout = project.FanoutTimeout
+	}
+
+	merged.ToolTimeouts = mergeStringMaps(global.ToolTimeouts, project.ToolTimeouts)
+	merged.MaxToolOutput = global.MaxToolOutput
+	if project.MaxToolOutput != 0 {
+		merged.MaxToolOutput = project.MaxToolOutput
+	}
+	merged.RequestTimeouts = mergeStringMaps(global.RequestTimeouts, project.RequestTimeouts)
+	merged.ReadOnlyRoots = append(append([]string(nil), global.ReadOnlyRoots...), project.ReadOnlyRoots...)
+	merged.Formatting = mergeFormatting(global.Formatting, project.Formatting)
+
+	if project.CompletionMode != "" {
+		merged.CompletionMode = project.CompletionMode
+	}
+
+	if project.SaveTimeout != "" {
+		merged.SaveTimeout = project.SaveTimeout
+	}
+
+	if project.HoverMode != "" {
+		merged.HoverMode = project.HoverMode
+	}
+	if project.RenameMode != "" {
+		merged.RenameMode = project.RenameMode
+	}
+	if project.SemanticTokensMode != "" {
+		merged.SemanticTokensMode = project.SemanticTokensMode
+	}
+	if project.FormatMode != "" {
+		merged.FormatMode = project.FormatMode
+	}
+	if project.FileWatcher != "" {
+		merged.FileWatcher = project.FileWatcher
+	}
+	if project.FallbackMode != "" {
+		merged.FallbackMode = project.FallbackMode
+	}
+	if project.TelemetryMode != "" {
+		merged.TelemetryMode = project.TelemetryMode
+	}
+
+	if project.InteractiveConcurrency != 0 {
+		merged.InteractiveConcurrency = project.InteractiveConcurrency
+	}
+
+	if project.BackgroundConcurrency != 0 {
+		merged.BackgroundConcurrency = project.BackgroundConcurrency
+	}
+
+	if project.FocusNice != 0 {
+		merged.FocusNice = project.FocusNice
+	}
+
+	// Build map of project LSPs by name
+	projectMap := make(map[string]LSP)
+	for _, lsp := range project.LSPs {
+		projectMap[lsp.Name] = lsp
+	}
+
+	// Start with global LSPs, replacing with merged project versions where they exist
+	for _, globalLSP := range global.LSPs {
+		if projectLSP, exists := projectMap[globalLSP.Name]; exists {
+			// Use deep merged version
+			merged.LSPs = append(merged.LSPs, mergeLSP(globalLSP, projectLSP))
+			delete(projectMap, globalLSP.Name) // Mark as processed
+		} else {
+			merged.LSPs = append(merged.LSPs, globalLSP)
+		}
+	}
+
+	// Add remaining project LSPs that weren't in global
+	for _, lsp := range projectMap {
+		merged.LSPs = append(merged.LSPs, lsp)
+	}
+
+	// Project debug adapters replace global ones of the same name and are
+	// looked up first
+	merged.DAPs = append([]DAP(nil), project.DAPs...)
+	for _, globalDAP := range global.DAPs {
+		if !hasDAP(project.DAPs, globalDAP.Name) {
+			merged.DAPs = append(merged.DAPs, globalDAP)
+		}
+	}
+
+	// Plugins run inside lux, so a checked-out project can't add them
+	merged.Plugins = global.Plugins
+
+	// Project transforms apply after global ones
+	merged.Transforms = append(append([]Transform(nil), global.Transforms...), project.Transforms...)
+
+	return merged
+}
+
+// mergeLSP merges project LSP over global LSP with deep merge for maps
+func mergeLSP(global, project LSP) LSP {
+	// Start with project (most fields are simple replacements)
+	result := project
+
+	// Deep merge for Env (project env vars override global)
+	if len(global.Env) > 0 {
+		if result.Env == nil {
+			result.Env = make(map[string]string)
+		}
+		for k, v := range global.Env {
+			if _, exists := result.Env[k]; !exists {
+				result.Env[k] = v
+			}
+		}
+	}
+
+	// Deep merge for InitOptions
+	if len(global.InitOptions) > 0 {
+		result.InitOptions = deepMergeMap(global.InitOptions, project.InitOptions)
+	}
+
+	// Deep merge for Settings
+	if len(global.Settings) > 0 {
+		result.Settings = deepMergeMap(global.Settings, project.Settings)
+	}
+
+	if result.DiagnosticSource == nil {
+		result.DiagnosticSource = global.DiagnosticSource
+	}
+	if result.DiagnosticFilter == nil {
+		result.DiagnosticFilter = global.DiagnosticFilter
+	}
+	if result.Folders == nil {
+		result.Folders = global.Folders
+	}
+	if result.PathMappings == nil {
+		result.PathMappings = global.PathMappings
+	}
+
+	result.RequestTimeouts = mergeStringMaps(global.RequestTimeouts, project.RequestTimeouts)
+	if result.MaxInFlight == 0 {
+		result.MaxInFlight = global.MaxInFlight
+	}
+	if result.MaxQueued == 0 {
+		result.MaxQueued = global.MaxQueued
+	}
+	if result.IdleTimeout == "" {
+		result.IdleTimeout = global.IdleTimeout
+	}
+	if result.MemoryLimit == "" {
+		result.MemoryLimit = global.MemoryLimit
+	}
+	if result.CPULimit == 0 {
+		result.CPULimit = global.CPULimit
+	}
+
+	if result.Requires == nil {
+		result.Requires = global.Requires
+	}
+	if result.RequiresHint == "" {
+		result.RequiresHint = global.RequiresHint
+	}
+
+	return result
+}
+
+func hasDAP(daps []DAP, name string) bool {
+	for _, dap := range daps {
+		if dap.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeStringMaps returns global's entries overridden by project's, or nil
+// if both are empty.
+func mergeStringMaps(global, project map[string]string) map[string]string {
+	if len(global)+len(project) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(global)+len(project))
+	for k, v := range global {
+		merged[k] = v
+	}
+	for k, v := range project {
+		merged[k] = v
+	}
+	return merged
+}
+
+// mergeFormatting takes each language's policy from the project if it has
+// one, and from the global config otherwise.
+func mergeFormatting(global, project map[string]FormattingPolicy) map[string]FormattingPolicy {
+	if len(global)+len(project) == 0 {
+		return nil
+	}
+	merged := make(map[string]FormattingPolicy, len(global)+len(project))
+	for lang, policy := range global {
+		merged[lang] = policy
+	}
+	for lang, policy := range project {
+		merged[lang] = policy
+	}
+	return merged
+}
+
+// deepMergeMap performs deep merge of maps, with project values taking precedence
+func deepMergeMap(global, project map[string]any) map[string]any {
+	if len(project) == 0 {
+		return global
+	}
+
+	result := make(map[string]any)
+
+	// Start with global
+	for k, v := range global {
+		result[k] = v
+	}
+
+	// Override with project (deep merge for nested maps)
+	for k, v := range project {
+		result[k] = deepMergeValue(result[k], v)
+	}
+
+	return result
+}
+
+// deepMergeValue recursively merges values, with new taking precedence
+func deepMergeValue(existing, new any) any {
+	// If new is a map and existing is a map, merge recursively
+	existingMap, existingIsMap := existing.(map[string]any)
+	newMap, newIsMap := new.(map[string]any)
+
+	if existingIsMap && newIsMap {
+		merged := make(map[string]any)
+		for k, v := range existingMap {
+			merged[k] = v
+		}
+		for k, v := range newMap {
+			merged[k] = deepMergeValue(merged[k], v)
+		}
+		return merged
+	}
+
+	// Otherwise, new value completely replaces existing
+	return new
+}
@@ -0,0 +1,119 @@
+package config
+
+import "strings"
+
+// RegistryEntry describes a well-known language server that lux can suggest
+// when it finds source files no configured LSP handles.
+type RegistryEntry struct {
+	Name        string   `json:"name"`
+	Flake       string   `json:"flake"`
+	Binary      string   `json:"binary,omitempty"`
+	Extensions  []string `json:"extensions"`
+	LanguageIDs []string `json:"language_ids"`
+
+	// Requires and RequiresHint are the defaults for LSP.Requires and
+	// LSP.RequiresHint.
+	Requires     []string `json:"requires,omitempty"`
+	RequiresHint string   `json:"requires_hint,omitempty"`
+}
+
+// BuiltinRegistry lists the language servers lux knows how to suggest.
+var BuiltinRegistry = []RegistryEntry{
+	{
+		Name:        "gopls",
+		Flake:       "nixpkgs#gopls",
+		Extensions:  []string{"go"},
+		LanguageIDs: []string{"go"},
+	},
+	{
+		Name:        "pyright",
+		Flake:       "nixpkgs#pyright",
+		Extensions:  []string{"py", "pyi"},
+		LanguageIDs: []string{"python"},
+	},
+	{
+		Name:        "typescript-language-server",
+		Flake:       "nixpkgs#nodePackages.typescript-language-server",
+		Extensions:  []string{"js", "ts", "jsx", "tsx", "mjs", "cjs"},
+		LanguageIDs: []string{"javascript", "typescript", "javascriptreact", "typescriptreact"},
+	},
+	{
+		Name:        "nil",
+		Flake:       "nixpkgs#nil",
+		Extensions:  []string{"nix"},
+		LanguageIDs: []string{"nix"},
+	},
+	{
+		Name:        "rust-analyzer",
+		Flake:       "nixpkgs#rust-analyzer",
+		Extensions:  []string{"rs"},
+		LanguageIDs: []string{"rust"},
+	},
+	{
+		Name:        "lua-language-server",
+		Flake:       "nixpkgs#lua-language-server",
+		Extensions:  []string{"lua"},
+		LanguageIDs: []string{"lua"},
+	},
+	{
+		Name:        "clangd",
+		Flake:       "nixpkgs#clang-tools",
+		Binary:      "clangd",
+		Extensions:  []string{"c", "h", "cc", "cpp", "cxx", "hpp"},
+		LanguageIDs: []string{"c", "cpp"},
+		Requires:    []string{"compile_commands.json", "build/compile_commands.json", "compile_flags.txt"},
+		RequiresHint: "generate one with `cmake -DCMAKE_EXPORT_COMPILE_COMMANDS=ON` " +
+			"or `bear -- make`, or list compiler flags in compile_flags.txt",
+	},
+	{
+		Name:         "jdtls",
+		Flake:        "nixpkgs#jdt-language-server",
+		Binary:       "jdtls",
+		Extensions:   []string{"java"},
+		LanguageIDs:  []string{"java"},
+		Requires:     []string{"pom.xml", "build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts", ".project"},
+		RequiresHint: "jdtls only analyzes Maven, Gradle, or Eclipse projects",
+	},
+	{
+		Name:        "bash-language-server",
+		Flake:       "nixpkgs#nodePackages.bash-language-server",
+		Extensions:  []string{"sh", "bash"},
+		LanguageIDs: []string{"shellscript"},
+	},
+}
+
+// LookupRegistryByExtension returns the built-in registry entry handling ext
+// (with or without a leading dot), or nil if there is none.
+func LookupRegistryByExtension(ext string) *RegistryEntry {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	for i := range BuiltinRegistry {
+		for _, e := range BuiltinRegistry[i].Extensions {
+			if e == ext {
+				return &BuiltinRegistry[i]
+			}
+		}
+	}
+	return nil
+}
+
+// LSP returns a config entry for the registry server.
+func (e RegistryEntry) LSP() LSP {
+	return LSP{
+		Name:        e.Name,
+		Flake:       e.Flake,
+		Binary:      e.Binary,
+		Extensions:  e.Extensions,
+		LanguageIDs: e.LanguageIDs,
+	}
+}
+
+// LookupRegistryByName returns the built-in registry entry called name, or nil
+// if there is none.
+func LookupRegistryByName(name string) *RegistryEntry {
+	for i := range BuiltinRegistry {
+		if BuiltinRegistry[i].Name == name {
+			return &BuiltinRegistry[i]
+		}
+	}
+	return nil
+}
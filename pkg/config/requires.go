@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Requirements returns the files one of which must exist in the workspace
+// for the LSP to work, and a hint on creating one: its own requires settings,
+// or the built-in registry's for a server of the same name.
+func (l *LSP) Requirements() ([]string, string) {
+	if l.Requires != nil {
+		return l.Requires, l.RequiresHint
+	}
+	if entry := LookupRegistryByName(l.Name); entry != nil {
+		return entry.Requires, entry.RequiresHint
+	}
+	return nil, ""
+}
+
+// MissingRequirementError reports that none of an LSP's required files exist
+// in the workspace.
+type MissingRequirementError struct {
+	LSP      string
+	Root     string
+	Requires []string
+	Hint     string
+}
+
+func (e *MissingRequirementError) Error() string {
+	msg := fmt.Sprintf("%s needs %s in %s", e.LSP, strings.Join(e.Requires, " or "), e.Root)
+	if e.Hint != "" {
+		msg += "; " + e.Hint
+	}
+	return msg
+}
+
+// requirementSearchDepth is how many directories below the workspace root
+// CheckRequirements looks for a required file, which is deep enough for a
+// compile_commands.json under build/ or a subproject's manifest.
+const requirementSearchDepth = 3
+
+// requirementSkipDirs are directories CheckRequirements doesn't search below
+// the root: dependencies and build outputs that don't hold a project's own
+// configuration.
+var requirementSkipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"target":       true,
+	"result":       true,
+}
+
+// CheckRequirements returns a *MissingRequirementError if the LSP has
+// requirements and none of them match a file under root. A pattern is
+// matched against each directory down to requirementSearchDepth below root,
+// so "compile_commands.json" is found in root/build as well as in root.
+func (l *LSP) CheckRequirements(root string) error {
+	requires, hint := l.Requirements()
+	if len(requires) == 0 {
+		return nil
+	}
+
+	if requirementsMet(root, requires, requirementSearchDepth) {
+		return nil
+	}
+
+	return &MissingRequirementError{LSP: l.Name, Root: root, Requires: requires, Hint: hint}
+}
+
+// requirementsMet reports whether one of the patterns matches relative to dir
+// or, down to depth levels, one of its subdirectories.
+func requirementsMet(dir string, patterns []string, depth int) bool {
+	for _, pattern := range patterns {
+		if matches, _ := filepath.Glob(filepath.Join(dir, pattern)); len(matches) > 0 {
+			return true
+		}
+	}
+	if depth == 0 {
+		return false
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || strings.HasPrefix(name, ".") || requirementSkipDirs[name] {
+			continue
+		}
+		if requirementsMet(filepath.Join(dir, name), patterns, depth-1) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/amarbel-llc/lux/pkg/filematch"
+)
+
+// maxScanFiles bounds how many files a workspace scan visits so that huge
+// trees don't stall initialization.
+const maxScanFiles = 20000
+
+var scanSkipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"target":       true,
+	"dist":         true,
+	"build":        true,
+	"result":       true,
+}
+
+// WorkspaceGap is a source file extension present in a workspace that no
+// configured LSP handles.
+type WorkspaceGap struct {
+	Extension  string         `json:"extension"`
+	Files      int            `json:"files"`
+	Suggestion *RegistryEntry `json:"suggestion,omitempty"`
+}
+
+func (g WorkspaceGap) String() string {
+	msg := fmt.Sprintf("%d .%s file(s) have no LSP configured", g.Files, g.Extension)
+	if g.Suggestion != nil {
+		msg += fmt.Sprintf(" (suggestion: lux add %s)", g.Suggestion.Flake)
+	}
+	return msg
+}
+
+// ScanWorkspace walks root looking for files with extensions from the
+// built-in registry that cfg does not route to any LSP. Results are sorted by
+// file count, most common first.
+func ScanWorkspace(root string, cfg *Config) ([]WorkspaceGap, error) {
+	matchers := filematch.NewMatcherSet()
+	for _, l := range cfg.LSPs {
+		if err := matchers.Add(l.Name, l.Extensions, l.Patterns, l.LanguageIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	counts := make(map[string]int)
+	visited := 0
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are skipped rather than failing the scan.
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || scanSkipDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		visited++
+		if visited > maxScanFiles {
+			return filepath.SkipAll
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext == "" || LookupRegistryByExtension(ext) == nil {
+			return nil
+		}
+		if matchers.Match(path, ext, "") != "" {
+			return nil
+		}
+		counts[strings.TrimPrefix(ext, ".")]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gaps := make([]WorkspaceGap, 0, len(counts))
+	for ext, n := range counts {
+		gaps = append(gaps, WorkspaceGap{
+			Extension:  ext,
+			Files:      n,
+			Suggestion: LookupRegistryByExtension(ext),
+		})
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].Files != gaps[j].Files {
+			return gaps[i].Files > gaps[j].Files
+		}
+		return gaps[i].Extension < gaps[j].Extension
+	})
+
+	return gaps, nil
+}
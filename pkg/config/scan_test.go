@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanWorkspace(t *testing.T) {
+	root := t.TempDir()
+	files := []string{
+		"main.go",
+		"pkg/util.go",
+		"scripts/a.py",
+		"scripts/b.py",
+		"node_modules/dep/index.js",
+		".git/hooks/pre-commit.sh",
+		"README.md",
+	}
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &Config{
+		LSPs: []LSP{
+			{Name: "gopls", Flake: "nixpkgs#gopls", Extensions: []string{"go"}},
+		},
+	}
+
+	gaps, err := ScanWorkspace(root, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(gaps) != 1 {
+		t.Fatalf("expected 1 gap, got %d: %+v", len(gaps), gaps)
+	}
+	if gaps[0].Extension != "py" {
+		t.Errorf("Extension: expected %q, got %q", "py", gaps[0].Extension)
+	}
+	if gaps[0].Files != 2 {
+		t.Errorf("Files: expected %d, got %d", 2, gaps[0].Files)
+	}
+	if gaps[0].Suggestion == nil || gaps[0].Suggestion.Name != "pyright" {
+		t.Errorf("Suggestion: expected pyright, got %+v", gaps[0].Suggestion)
+	}
+}
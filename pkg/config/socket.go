@@ -0,0 +1,58 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// DefaultSocketTemplate gives each workspace its own control socket, so two
+// lux servers for different projects don't collide.
+const DefaultSocketTemplate = "${XDG_RUNTIME_DIR}/lux/${workspaceHash}.sock"
+
+// SocketPathFor expands the socket template (the socket setting, or
+// DefaultSocketTemplate) for workspace. Besides environment variables, the
+// template may use ${workspace} (the workspace path), ${workspaceName} (its
+// base name) and ${workspaceHash} (a short stable hash of the path).
+// ${XDG_RUNTIME_DIR} falls back to the system temp directory when unset.
+func (c *Config) SocketPathFor(workspace string) string {
+	template := c.Socket
+	if template == "" {
+		template = DefaultSocketTemplate
+	}
+
+	return os.Expand(template, func(name string) string {
+		switch name {
+		case "workspace":
+			return workspace
+		case "workspaceName":
+			return filepath.Base(workspace)
+		case "workspaceHash":
+			return WorkspaceHash(workspace)
+		case "XDG_RUNTIME_DIR":
+			return runtimeDir()
+		default:
+			return os.Getenv(name)
+		}
+	})
+}
+
+// WorkspaceHash returns a short, stable identifier for a workspace path.
+func WorkspaceHash(workspace string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(workspace)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// ResolveWorkspace maps a directory to the workspace it belongs to: the
+// enclosing project root if one is found, otherwise the directory itself.
+func ResolveWorkspace(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	if root, err := FindProjectRoot(abs); err == nil {
+		return root
+	}
+	return abs
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSocketPathFor(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	t.Setenv("LUX_TEST_DIR", "/tmp/lux-test")
+
+	tests := []struct {
+		name      string
+		socket    string
+		workspace string
+		expected  string
+	}{
+		{"default", "", "/home/u/proj", "/run/user/1000/lux/" + WorkspaceHash("/home/u/proj") + ".sock"},
+		{"literal path", "/tmp/lux.sock", "/home/u/proj", "/tmp/lux.sock"},
+		{"workspace name", "${XDG_RUNTIME_DIR}/lux-${workspaceName}.sock", "/home/u/proj", "/run/user/1000/lux-proj.sock"},
+		{"env var", "${LUX_TEST_DIR}/${workspaceHash}.sock", "/home/u/proj", "/tmp/lux-test/" + WorkspaceHash("/home/u/proj") + ".sock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Socket: tt.socket}
+			if got := cfg.SocketPathFor(tt.workspace); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	cfg := &Config{}
+	if cfg.SocketPathFor("/home/u/a") == cfg.SocketPathFor("/home/u/b") {
+		t.Error("expected different workspaces to get different default sockets")
+	}
+}
+
+func TestResolveWorkspace(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "pkg", "deep")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ResolveWorkspace(sub); got != root {
+		t.Errorf("expected subdirectory to resolve to %q, got %q", root, got)
+	}
+
+	if hash := WorkspaceHash(root); len(hash) != 12 || strings.ContainsAny(hash, "/.") {
+		t.Errorf("unexpected workspace hash %q", hash)
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// starterServer is a registry server proposed for a workspace, with the
+// source files that led to it.
+type starterServer struct {
+	entry *RegistryEntry
+	files int
+	found []string // "42 .go" style counts, most common first
+}
+
+// StarterConfig scans root for source files the built-in registry knows and
+// returns a commented lsps.toml proposing a server for each language found,
+// the most common first. It fails if no known source files are found.
+func StarterConfig(root string) ([]byte, error) {
+	census, err := ScanWorkspace(root, &Config{})
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", root, err)
+	}
+
+	servers := starterServers(census)
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no source files lux knows a server for in %s; add servers with `lux add <flake>`", root)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# lux configuration generated by `lux init` for %s.\n", root)
+	fmt.Fprintln(&b, "# Servers were proposed from the source files found there; remove any you")
+	fmt.Fprintln(&b, "# don't want. See the README for every option.")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "# Optional: use binaries from PATH instead of building flakes with nix")
+	fmt.Fprintln(&b, "# executor = \"binary\"")
+
+	for _, s := range servers {
+		e := s.entry
+		fmt.Fprintln(&b)
+		fmt.Fprintf(&b, "# %s: %s file(s) in the workspace\n", e.Name, strings.Join(s.found, ", "))
+		if len(e.Requires) > 0 {
+			fmt.Fprintf(&b, "# Starts only with one of %s in the workspace; %s\n", strings.Join(e.Requires, ", "), e.RequiresHint)
+		}
+		fmt.Fprintln(&b, "[[lsp]]")
+		fmt.Fprintf(&b, "name = %q\n", e.Name)
+		fmt.Fprintf(&b, "flake = %q\n", e.Flake)
+		if e.Binary != "" {
+			fmt.Fprintf(&b, "binary = %q\n", e.Binary)
+		}
+		fmt.Fprintf(&b, "extensions = %s\n", tomlStringList(e.Extensions))
+		fmt.Fprintf(&b, "language_ids = %s\n", tomlStringList(e.LanguageIDs))
+	}
+
+	return b.Bytes(), nil
+}
+
+// starterServers groups a workspace census by the registry server handling
+// each extension, ordered by total file count.
+func starterServers(census []WorkspaceGap) []*starterServer {
+	var servers []*starterServer
+	byName := make(map[string]*starterServer)
+	for _, gap := range census {
+		if gap.Suggestion == nil {
+			continue
+		}
+		s, ok := byName[gap.Suggestion.Name]
+		if !ok {
+			s = &starterServer{entry: gap.Suggestion}
+			byName[gap.Suggestion.Name] = s
+			servers = append(servers, s)
+		}
+		s.files += gap.Files
+		s.found = append(s.found, fmt.Sprintf("%d .%s", gap.Files, gap.Extension))
+	}
+
+	sort.SliceStable(servers, func(i, j int) bool {
+		return servers[i].files > servers[j].files
+	})
+	return servers
+}
+
+func tomlStringList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
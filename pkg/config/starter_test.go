@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStarterConfig(t *testing.T) {
+	root := t.TempDir()
+	files := []string{
+		"main.go",
+		"lexer.c",
+		"lexer.h",
+		"parser.h",
+		"node_modules/dep/index.js",
+		"README.md",
+	}
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := StarterConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	configPath := filepath.Join(t.TempDir(), "lsps.toml")
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFrom(configPath)
+	if err != nil {
+		t.Fatalf("generated config doesn't load: %v\n%s", err, data)
+	}
+
+	var names []string
+	for _, l := range cfg.LSPs {
+		names = append(names, l.Name)
+	}
+	if got := strings.Join(names, " "); got != "clangd gopls" {
+		t.Errorf("expected %q, got %q", "clangd gopls", got)
+	}
+	if !strings.Contains(string(data), "# clangd: 2 .h, 1 .c file(s)") {
+		t.Errorf("expected a census comment for clangd, got:\n%s", data)
+	}
+}
+
+func TestStarterConfigEmptyWorkspace(t *testing.T) {
+	if _, err := StarterConfig(t.TempDir()); err == nil {
+		t.Error("expected error for a workspace with no known source files")
+	}
+}
@@ -0,0 +1,97 @@
+// Package executor defines how lux obtains and launches language server
+// binaries, and lets other Go packages register their own executors (bazel run
+// targets, devcontainers, corporate launchers) without changing lux itself.
+//
+// An executor registers itself from an init function:
+//
+//	func init() {
+//		executor.Register("bazel", func() executor.Executor { return &Bazel{} })
+//	}
+//
+// and is selected with executor = "bazel" in lsps.toml once its package is
+// linked into the lux binary (a blank import in cmd/lux is enough).
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Process is a running language server. Stdin and Stdout carry the LSP
+// stream; Stderr is logged. Wait blocks until the process exits and Kill
+// terminates it. Pid, if set, is the local process lux may renice (see
+// focus_nice); executors that don't run a local process leave it 0.
+type Process struct {
+	Stdin  io.WriteCloser
+	Stdout io.ReadCloser
+	Stderr io.ReadCloser
+	Wait   func() error
+	Kill   func() error
+	Pid    int
+}
+
+// Executor resolves an LSP's configured flake and binary to something
+// runnable, then starts it.
+type Executor interface {
+	// Build returns the path (or any executor-specific reference) that
+	// Execute should run for the given flake and binary spec.
+	Build(ctx context.Context, flake, binarySpec string) (string, error)
+	Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error)
+}
+
+// Factory creates an executor. It is called once per lux process (or per
+// command) that uses the executor.
+type Factory func() Executor
+
+// Reserved names the built-in executors use; they cannot be registered.
+const (
+	Nix    = "nix"
+	Binary = "binary"
+)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes an executor available under name. Like database/sql.Register,
+// it panics if name is empty, reserved, already registered, or factory is nil.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if name == "" || name == Nix || name == Binary {
+		panic(fmt.Sprintf("executor: invalid name %q", name))
+	}
+	if factory == nil {
+		panic("executor: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic(fmt.Sprintf("executor: Register called twice for %q", name))
+	}
+	factories[name] = factory
+}
+
+// Lookup returns the factory registered under name.
+func Lookup(name string) (Factory, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	factory, ok := factories[name]
+	return factory, ok
+}
+
+// Names returns the registered executor names, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,3 +1,6 @@
+// Package filematch decides which language servers handle a file, by file
+// extension, glob pattern, or language ID. It is part of lux's public API and
+// follows semantic versioning.
 package filematch
 
 import (
@@ -111,13 +114,30 @@ func (ms *MatcherSet) Add(name string, extensions, patterns, languageIDs []strin
 	return nil
 }
 
+// Match returns the first matcher name that matches, preferring one that
+// claims languageID over one that only matches the path or extension.
 func (ms *MatcherSet) Match(path, ext, languageID string) string {
+	if names := ms.MatchAll(path, ext, languageID); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// MatchAll returns every matcher name that matches, in the order they were
+// added except that those claiming languageID come first: a document's
+// language ID says more about it than its file name. The first is the one
+// Match returns.
+func (ms *MatcherSet) MatchAll(path, ext, languageID string) []string {
+	var byLanguage, others []string
 	for _, nm := range ms.matchers {
-		if nm.matcher.Matches(path, ext, languageID) {
-			return nm.name
+		switch {
+		case languageID != "" && nm.matcher.MatchesLanguageID(languageID):
+			byLanguage = append(byLanguage, nm.name)
+		case nm.matcher.Matches(path, ext, languageID):
+			others = append(others, nm.name)
 		}
 	}
-	return ""
+	return append(byLanguage, others...)
 }
 
 func (ms *MatcherSet) MatchByExtension(ext string) string {
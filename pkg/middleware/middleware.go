@@ -0,0 +1,93 @@
+// Package middleware lets code built into lux intercept the traffic between
+// the client and the backends, to rewrite, filter, or observe it without
+// changing the router.
+//
+// A middleware registers itself from an init function:
+//
+//	func init() {
+//		middleware.Register("audit", &Audit{})
+//	}
+//
+// and is installed in every lux server once its package is linked into the
+// lux binary (a blank import in cmd/lux is enough).
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/amarbel-llc/go-lib-mcp/jsonrpc"
+)
+
+// Middleware intercepts traffic between the client and the backends. Embed
+// PassThrough to implement only the hooks needed.
+type Middleware interface {
+	// OnClientRequest is called with every request and notification from
+	// the client before lux handles it. It returns the message to handle in
+	// its place (msg itself to pass it through), or a response to answer a
+	// request without routing it. Returning neither drops the message; a
+	// dropped request is answered with a RequestCancelled error.
+	OnClientRequest(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, *jsonrpc.Message, error)
+
+	// OnBackendResponse is called with each backend's answer to a request
+	// lux sent it, before answers are merged or returned to the client. It
+	// returns the result and error to use in their place.
+	OnBackendResponse(ctx context.Context, server, method string, result json.RawMessage, err error) (json.RawMessage, error)
+}
+
+// PassThrough is a Middleware that changes nothing.
+type PassThrough struct{}
+
+func (PassThrough) OnClientRequest(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, *jsonrpc.Message, error) {
+	return msg, nil, nil
+}
+
+func (PassThrough) OnBackendResponse(ctx context.Context, server, method string, result json.RawMessage, err error) (json.RawMessage, error) {
+	return result, err
+}
+
+type registered struct {
+	name string
+	m    Middleware
+}
+
+var (
+	mu         sync.RWMutex
+	middleware []registered
+)
+
+// Register installs m, under name, in the lux servers started after it. Each
+// message passes through the registered middleware in the order they were
+// registered, before lux's own. Like database/sql.Register, it panics if name
+// is empty, already registered, or m is nil.
+func Register(name string, m Middleware) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if name == "" {
+		panic("middleware: Register name is empty")
+	}
+	if m == nil {
+		panic("middleware: Register middleware is nil")
+	}
+	for _, r := range middleware {
+		if r.name == name {
+			panic(fmt.Sprintf("middleware: Register called twice for %q", name))
+		}
+	}
+	middleware = append(middleware, registered{name: name, m: m})
+}
+
+// Registered returns the registered middleware, in registration order.
+func Registered() []Middleware {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	ms := make([]Middleware, len(middleware))
+	for i, r := range middleware {
+		ms[i] = r.m
+	}
+	return ms
+}
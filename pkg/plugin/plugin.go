@@ -0,0 +1,99 @@
+// Package plugin lets lux run traffic filters declared in its config without
+// being recompiled: a filter is handed the JSON of messages for the methods it
+// is configured for and returns what lux should use in their place, to strip
+// noisy diagnostics, rewrite code actions, and the like.
+//
+// Filters are loaded by a runtime, which turns the module a [[plugin]] entry
+// names into a Filter. WASM modules use the "wasm" runtime in package
+// plugin/wasm; like executors, runtimes register themselves from an init
+// function:
+//
+//	func init() {
+//		plugin.Register(plugin.WASM, Load)
+//	}
+//
+// and become available once their package is linked into the lux binary (a
+// blank import in cmd/lux is enough).
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Point is where in lux's traffic a filter is called.
+type Point string
+
+const (
+	// Request is a request or notification from the client; the payload is
+	// its params.
+	Request Point = "request"
+	// Response is a backend's answer to a request; the payload is its
+	// result.
+	Response Point = "response"
+	// Notification is a notification from a backend, such as
+	// textDocument/publishDiagnostics; the payload is its params.
+	Notification Point = "notification"
+)
+
+// Filter transforms the messages of the methods it is configured for.
+type Filter interface {
+	// Filter returns the payload to use in place of payload, a message of
+	// method at point. Returning payload unchanged passes it through.
+	Filter(ctx context.Context, point Point, method string, payload json.RawMessage) (json.RawMessage, error)
+	Close() error
+}
+
+// Loader loads the filter in the module at path.
+type Loader func(ctx context.Context, path string) (Filter, error)
+
+// WASM is the name of the runtime for WebAssembly modules, the default for
+// [[plugin]] entries.
+const WASM = "wasm"
+
+var (
+	mu      sync.RWMutex
+	loaders = make(map[string]Loader)
+)
+
+// Register makes a runtime available under name. Like database/sql.Register,
+// it panics if name is empty, already registered, or loader is nil.
+func Register(name string, loader Loader) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if name == "" {
+		panic("plugin: Register name is empty")
+	}
+	if loader == nil {
+		panic("plugin: Register loader is nil")
+	}
+	if _, dup := loaders[name]; dup {
+		panic(fmt.Sprintf("plugin: Register called twice for %q", name))
+	}
+	loaders[name] = loader
+}
+
+// Lookup returns the loader registered under name.
+func Lookup(name string) (Loader, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	loader, ok := loaders[name]
+	return loader, ok
+}
+
+// Names returns the registered runtime names, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(loaders))
+	for name := range loaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,36 @@
+;; nullresponse.wasm: answers every backend response with null and passes
+;; everything else through unchanged. Assembled from this file with
+;; `wat2wasm nullresponse.wat`.
+(module
+  (memory (export "memory") 1)
+  (global $heap (mut i32) (i32.const 2048))
+  (data (i32.const 1024) "null")
+
+  ;; A bump allocator; the test module never frees.
+  (func (export "alloc") (param $size i32) (result i32)
+    global.get $heap
+    global.get $heap
+    local.get $size
+    i32.add
+    global.set $heap)
+
+  (func (export "filter")
+    (param $point i32) (param $point_len i32)
+    (param $method i32) (param $method_len i32)
+    (param $payload i32) (param $payload_len i32)
+    (result i64)
+    ;; "response" is the only point eight bytes long.
+    local.get $point_len
+    i32.const 8
+    i32.eq
+    if (result i64)
+      i64.const 0x0000040000000004 ;; "null" at 1024
+    else
+      local.get $payload
+      i64.extend_i32_u
+      i64.const 32
+      i64.shl
+      local.get $payload_len
+      i64.extend_i32_u
+      i64.or
+    end))
@@ -0,0 +1,137 @@
+// Package wasm is the "wasm" plugin runtime: it loads traffic filters
+// compiled to WebAssembly and runs them with wazero, a runtime with no cgo
+// dependencies. The package registers itself on import.
+//
+// A module exports its linear memory as "memory" and two functions:
+//
+//	alloc(size i32) -> i32
+//	filter(point, point_len, method, method_len, payload, payload_len i32) -> i64
+//
+// For each message lux calls alloc for room to write the point, the method,
+// and the payload (each a UTF-8 string or JSON document), then calls filter
+// with their addresses and lengths. filter returns the payload to use in
+// place of the message's, packed as its address in the high 32 bits and its
+// length in the low 32; it may return the payload it was given to pass it
+// through. A trap fails the call, which leaves the message as it was. Memory
+// is the module's to manage: lux never frees what alloc returned.
+//
+// Modules may import WASI; they are given no filesystem, arguments, or
+// environment.
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/amarbel-llc/lux/pkg/plugin"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+func init() {
+	plugin.Register(plugin.WASM, Load)
+}
+
+// Load compiles and instantiates the module at path.
+func Load(ctx context.Context, path string) (plugin.Filter, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	runtime := wazero.NewRuntime(ctx)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("instantiating WASI: %w", err)
+	}
+
+	// Modules are reactors: _initialize, if exported, sets them up, and
+	// they are never run as a command.
+	config := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	mod, err := runtime.InstantiateWithConfig(ctx, code, config)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("instantiating module: %w", err)
+	}
+
+	f := &filter{
+		runtime: runtime,
+		memory:  mod.Memory(),
+		alloc:   mod.ExportedFunction("alloc"),
+		filter:  mod.ExportedFunction("filter"),
+	}
+	switch {
+	case f.memory == nil:
+		err = fmt.Errorf("module exports no memory")
+	case f.alloc == nil:
+		err = fmt.Errorf("module exports no alloc function")
+	case f.filter == nil:
+		err = fmt.Errorf("module exports no filter function")
+	}
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	return f, nil
+}
+
+// filter is a loaded module. A module instance runs one call at a time.
+type filter struct {
+	runtime wazero.Runtime
+	memory  api.Memory
+	alloc   api.Function
+	filter  api.Function
+	mu      sync.Mutex
+}
+
+func (f *filter) Filter(ctx context.Context, point plugin.Point, method string, payload json.RawMessage) (json.RawMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	args := make([]uint64, 0, 6)
+	for _, arg := range [][]byte{[]byte(point), []byte(method), payload} {
+		ptr, err := f.write(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, uint64(ptr), uint64(len(arg)))
+	}
+
+	results, err := f.filter.Call(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("calling filter: %w", err)
+	}
+	ptr, size := uint32(results[0]>>32), uint32(results[0])
+	out, ok := f.memory.Read(ptr, size)
+	if !ok {
+		return nil, fmt.Errorf("filter returned %d bytes at %d, outside its memory", size, ptr)
+	}
+
+	filtered := make(json.RawMessage, len(out))
+	copy(filtered, out)
+	if !json.Valid(filtered) {
+		return nil, fmt.Errorf("filter returned invalid JSON")
+	}
+	return filtered, nil
+}
+
+// write copies data into memory the module allocated for it.
+func (f *filter) write(ctx context.Context, data []byte) (uint32, error) {
+	results, err := f.alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("calling alloc: %w", err)
+	}
+	ptr := uint32(results[0])
+	if !f.memory.Write(ptr, data) {
+		return 0, fmt.Errorf("alloc returned %d, outside its memory", ptr)
+	}
+	return ptr, nil
+}
+
+func (f *filter) Close() error {
+	return f.runtime.Close(context.Background())
+}
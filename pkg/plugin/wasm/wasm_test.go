@@ -0,0 +1,48 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/amarbel-llc/lux/pkg/plugin"
+)
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	f, err := Load(ctx, filepath.Join("testdata", "nullresponse.wasm"))
+	if err != nil {
+		t.Fatalf("loading module: %v", err)
+	}
+	defer f.Close()
+
+	params := json.RawMessage(`{"textDocument":{"uri":"file:///a.go"}}`)
+	got, err := f.Filter(ctx, plugin.Request, "textDocument/hover", params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != string(params) {
+		t.Errorf("expected the request passed through, got %s", got)
+	}
+
+	got, err = f.Filter(ctx, plugin.Response, "textDocument/hover", json.RawMessage(`{"contents":"noisy"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != "null" {
+		t.Errorf("expected the module's null, got %s", got)
+	}
+}
+
+func TestLoad_Registered(t *testing.T) {
+	if _, ok := plugin.Lookup(plugin.WASM); !ok {
+		t.Error("expected the wasm runtime to be registered")
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	if _, err := Load(context.Background(), filepath.Join("testdata", "nullresponse.wat")); err == nil {
+		t.Error("expected an error loading a non-module")
+	}
+}